@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+// NewAFXDPBackend fails on platforms other than Linux
+func NewAFXDPBackend(AFXDPConfig) (*AFXDPBackend, error) {
+	return nil, errAFXDPUnsupported
+}
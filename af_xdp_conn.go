@@ -0,0 +1,435 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/randutil"
+	"github.com/pion/transport/v3/deadline"
+	"github.com/pion/turn/v4/internal/afxdp"
+	"github.com/pion/turn/v4/internal/bufpool"
+)
+
+const defaultAFXDPReadQueueSize = 1024
+
+// AFXDPConfig configures an AFXDPBackend
+type AFXDPConfig struct {
+	// Interface is the name of the network interface the backend sends and receives on
+	Interface string
+
+	// Queues is the number of RX queues of the interface, an AF_XDP socket is bound to each.
+	// Defaults to 1, which needs the interface configured with a single queue, e.g. with
+	// ethtool -L eth0 combined 1.
+	Queues int
+
+	// LocalIP is the IPv4 address of the interface the listeners and relay sockets use
+	LocalIP net.IP
+
+	// GatewayMAC is the hardware address of the router datagrams are sent to until a
+	// datagram from their destination is received. Optional, without it the server only
+	// answers addresses it received from.
+	GatewayMAC net.HardwareAddr
+
+	// PinPath is the directory the maps of the loaded redirect program are pinned in, e.g.
+	// /sys/fs/bpf/turn
+	PinPath string
+
+	// Frames is the number of frames of the memory of every socket, half of them for either
+	// direction. Must be a power of two. Defaults to 4096.
+	Frames int
+
+	// ReadQueueSize is the number of received datagrams every PacketConn buffers until they
+	// are read, further datagrams are dropped. Defaults to 1024.
+	ReadQueueSize int
+
+	LoggerFactory logging.LoggerFactory
+}
+
+// afxdpDevice is an AF_XDP socket, see afxdp.Socket
+type afxdpDevice interface {
+	Receive(handle func(frame []byte)) error
+	Transmit(encode func(buf []byte) int) error
+	Close() error
+}
+
+// afxdpPorts selects the ports the program redirects to the sockets
+type afxdpPorts interface {
+	Add(port uint16) error
+	Remove(port uint16) error
+	Close() error
+}
+
+// AFXDPBackend sends and receives the UDP datagrams of its PacketConns as raw frames on
+// AF_XDP sockets, which bypasses the UDP stack of the kernel for dedicated relay
+// appliances. The XDP program of examples/turn-server/af-xdp redirects the datagrams to the
+// ports of the PacketConns to the sockets; ARP and everything else still go to the kernel.
+//
+// Use ListenPacket for the PacketConnConfigs of the server and a RelayAddressGeneratorAFXDP
+// for its relay sockets. Only IPv4 is supported, and datagrams too large for a frame are
+// neither sent nor received.
+type AFXDPBackend struct {
+	log      logging.LeveledLogger
+	localIP  netip.Addr
+	localMAC [6]byte
+	gateway  *[6]byte
+
+	devices []afxdpDevice
+	next    atomic.Uint32 // Device of the next write
+	ports   afxdpPorts
+	pool    *bufpool.Pool
+
+	connsLock sync.RWMutex
+	conns     map[uint16]*afxdpConn
+
+	neighborsLock sync.RWMutex
+	neighbors     map[netip.Addr][6]byte
+
+	queueSize int
+	receivers sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newAFXDPBackend(config AFXDPConfig, localMAC net.HardwareAddr, devices []afxdpDevice, ports afxdpPorts) (*AFXDPBackend, error) {
+	localIP, ok := netip.AddrFromSlice(config.LocalIP.To4())
+	if !ok || len(localMAC) != 6 || (config.GatewayMAC != nil && len(config.GatewayMAC) != 6) {
+		return nil, errInvalidAFXDPConfig
+	}
+	if config.ReadQueueSize == 0 {
+		config.ReadQueueSize = defaultAFXDPReadQueueSize
+	}
+	if config.LoggerFactory == nil {
+		config.LoggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	b := &AFXDPBackend{
+		log:       config.LoggerFactory.NewLogger("turn"),
+		localIP:   localIP,
+		devices:   devices,
+		ports:     ports,
+		pool:      bufpool.New(afxdp.MaxPayload),
+		conns:     map[uint16]*afxdpConn{},
+		neighbors: map[netip.Addr][6]byte{},
+		queueSize: config.ReadQueueSize,
+	}
+	copy(b.localMAC[:], localMAC)
+	if config.GatewayMAC != nil {
+		b.gateway = &[6]byte{}
+		copy(b.gateway[:], config.GatewayMAC)
+	}
+
+	for _, d := range devices {
+		b.receivers.Add(1)
+		go func(d afxdpDevice) {
+			defer b.receivers.Done()
+			var datagram afxdp.Datagram
+			err := d.Receive(func(frame []byte) {
+				if afxdp.Parse(frame, &datagram) {
+					b.receive(&datagram)
+				}
+			})
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				b.log.Errorf("AF_XDP socket failed: %v", err)
+			}
+		}(d)
+	}
+	return b, nil
+}
+
+// ListenPacket returns a PacketConn for a UDP port of the LocalIP
+func (b *AFXDPBackend) ListenPacket(port int) (net.PacketConn, error) {
+	if port <= 0 || port > 0xffff {
+		return nil, errInvalidAFXDPPort
+	}
+
+	b.connsLock.Lock()
+	defer b.connsLock.Unlock()
+	if b.conns == nil {
+		return nil, net.ErrClosed
+	} else if b.conns[uint16(port)] != nil {
+		return nil, fmt.Errorf("%w: %d", errAFXDPPortInUse, port)
+	}
+	if err := b.ports.Add(uint16(port)); err != nil {
+		return nil, err
+	}
+
+	c := &afxdpConn{
+		backend:      b,
+		port:         uint16(port),
+		packets:      make(chan afxdpPacket, b.queueSize),
+		closed:       make(chan struct{}),
+		readDeadline: deadline.New(),
+	}
+	b.conns[c.port] = c
+	return c, nil
+}
+
+// Close closes the sockets and all PacketConns
+func (b *AFXDPBackend) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		b.connsLock.Lock()
+		conns := b.conns
+		b.conns = nil
+		b.connsLock.Unlock()
+		for _, c := range conns {
+			if closeErr := c.close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+
+		for _, d := range b.devices {
+			if closeErr := d.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		b.receivers.Wait()
+		if closeErr := b.ports.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (b *AFXDPBackend) receive(d *afxdp.Datagram) {
+	if d.Dst.Addr() != b.localIP {
+		return
+	}
+	b.connsLock.RLock()
+	c := b.conns[d.Dst.Port()]
+	b.connsLock.RUnlock()
+	if c == nil {
+		return
+	}
+
+	// Answers go back the way the datagram came
+	b.neighborsLock.RLock()
+	mac, ok := b.neighbors[d.Src.Addr()]
+	b.neighborsLock.RUnlock()
+	if !ok || mac != d.SrcMAC {
+		b.neighborsLock.Lock()
+		b.neighbors[d.Src.Addr()] = d.SrcMAC
+		b.neighborsLock.Unlock()
+	}
+
+	c.deliver(d.Src, d.Payload)
+}
+
+func (b *AFXDPBackend) write(port uint16, p []byte, addr net.Addr) error {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return errAFXDPNotUDP
+	}
+	dst := udpAddr.AddrPort()
+	dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+	if !dst.Addr().Is4() {
+		return errAFXDPNotIPv4
+	}
+
+	b.neighborsLock.RLock()
+	mac, ok := b.neighbors[dst.Addr()]
+	b.neighborsLock.RUnlock()
+	if !ok {
+		if b.gateway == nil {
+			return fmt.Errorf("%w: %s", errAFXDPNoRoute, dst.Addr())
+		}
+		mac = *b.gateway
+	}
+
+	d := afxdp.Datagram{
+		SrcMAC:  b.localMAC,
+		DstMAC:  mac,
+		Src:     netip.AddrPortFrom(b.localIP, port),
+		Dst:     dst,
+		Payload: p,
+	}
+	device := b.devices[int(b.next.Add(1))%len(b.devices)]
+	return device.Transmit(func(buf []byte) int {
+		return afxdp.Encode(buf, &d)
+	})
+}
+
+type afxdpPacket struct {
+	data *[]byte
+	from netip.AddrPort
+}
+
+// afxdpConn is a UDP port of an AFXDPBackend
+type afxdpConn struct {
+	backend      *AFXDPBackend
+	port         uint16
+	packets      chan afxdpPacket
+	closed       chan struct{}
+	closeOnce    sync.Once
+	readDeadline *deadline.Deadline
+	dropped      atomic.Uint64
+}
+
+func (c *afxdpConn) deliver(from netip.AddrPort, payload []byte) {
+	p := afxdpPacket{data: c.backend.pool.Copy(payload), from: from}
+	select {
+	case <-c.closed:
+		c.backend.pool.Put(p.data)
+	case c.packets <- p:
+	default:
+		// Like a full socket buffer
+		c.dropped.Add(1)
+		c.backend.pool.Put(p.data)
+	}
+}
+
+func (c *afxdpConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	default:
+	}
+
+	select {
+	case packet := <-c.packets:
+		n := copy(p, *packet.data)
+		c.backend.pool.Put(packet.data)
+		return n, net.UDPAddrFromAddrPort(packet.from), nil
+	case <-c.closed:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	case <-c.readDeadline.Done():
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: os.ErrDeadlineExceeded}
+	}
+}
+
+func (c *afxdpConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: net.ErrClosed}
+	default:
+	}
+	if err := c.backend.write(c.port, p, addr); err != nil {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: err}
+	}
+	return len(p), nil
+}
+
+func (c *afxdpConn) Close() error {
+	c.backend.connsLock.Lock()
+	if c.backend.conns[c.port] == c {
+		delete(c.backend.conns, c.port)
+	}
+	c.backend.connsLock.Unlock()
+	return c.close()
+}
+
+// close releases the conn once it is no longer in the conns of the backend
+func (c *afxdpConn) close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.backend.ports.Remove(c.port)
+		close(c.closed)
+		for {
+			select {
+			case p := <-c.packets:
+				c.backend.pool.Put(p.data)
+			default:
+				return
+			}
+		}
+	})
+	return err
+}
+
+func (c *afxdpConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: c.backend.localIP.AsSlice(), Port: int(c.port)}
+}
+
+func (c *afxdpConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *afxdpConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes do not block
+func (c *afxdpConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// RelayAddressGeneratorAFXDP allocates the relay sockets of a server on an AFXDPBackend,
+// inside a port range like RelayAddressGeneratorPortRange
+type RelayAddressGeneratorAFXDP struct {
+	Backend *AFXDPBackend
+
+	// RelayAddress is the IP returned to the user when the relay is created. Defaults to
+	// the LocalIP of the backend.
+	RelayAddress net.IP
+
+	// MinPort the minimum port to allocate
+	MinPort uint16
+	// MaxPort the maximum (inclusive) port to allocate
+	MaxPort uint16
+
+	// MaxRetries the amount of tries to allocate a random port in the defined range
+	MaxRetries int
+
+	// Rand the random source of numbers
+	Rand randutil.MathRandomGenerator
+}
+
+// Validate is called on server startup and confirms the RelayAddressGenerator is properly configured
+func (r *RelayAddressGeneratorAFXDP) Validate() error {
+	if r.Rand == nil {
+		r.Rand = randutil.NewMathRandomGenerator()
+	}
+	if r.MaxRetries == 0 {
+		r.MaxRetries = 10
+	}
+
+	switch {
+	case r.Backend == nil:
+		return errInvalidAFXDPConfig
+	case r.MinPort == 0:
+		return errMinPortNotZero
+	case r.MaxPort == 0:
+		return errMaxPortNotZero
+	}
+	if r.RelayAddress == nil {
+		r.RelayAddress = r.Backend.localIP.AsSlice()
+	}
+	return nil
+}
+
+// AllocatePacketConn generates a new PacketConn to receive traffic on and the IP/Port to populate the allocation response with
+func (r *RelayAddressGeneratorAFXDP) AllocatePacketConn(_ string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	if requestedPort != 0 {
+		conn, err := r.Backend.ListenPacket(requestedPort)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, &net.UDPAddr{IP: r.RelayAddress, Port: requestedPort}, nil
+	}
+
+	for try := 0; try < r.MaxRetries; try++ {
+		port := int(r.MinPort) + r.Rand.Intn(int(r.MaxPort)+1-int(r.MinPort))
+		conn, err := r.Backend.ListenPacket(port)
+		if err != nil {
+			continue
+		}
+		return conn, &net.UDPAddr{IP: r.RelayAddress, Port: port}, nil
+	}
+
+	return nil, nil, errMaxRetriesExceeded
+}
+
+// AllocateConn generates a new Conn to receive traffic on and the IP/Port to populate the allocation response with
+func (r *RelayAddressGeneratorAFXDP) AllocateConn(string, int) (net.Conn, net.Addr, error) {
+	return nil, nil, errTODO
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/internal/afxdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAFXDPDevice receives the frames sent to rx and transmits to tx
+type fakeAFXDPDevice struct {
+	rx     chan []byte
+	tx     chan []byte
+	closed chan struct{}
+}
+
+func newFakeAFXDPDevice() *fakeAFXDPDevice {
+	return &fakeAFXDPDevice{rx: make(chan []byte), tx: make(chan []byte, 16), closed: make(chan struct{})}
+}
+
+func (d *fakeAFXDPDevice) Receive(handle func(frame []byte)) error {
+	for {
+		select {
+		case frame := <-d.rx:
+			handle(frame)
+		case <-d.closed:
+			return net.ErrClosed
+		}
+	}
+}
+
+func (d *fakeAFXDPDevice) Transmit(encode func(buf []byte) int) error {
+	buf := make([]byte, 2048)
+	d.tx <- buf[:encode(buf)]
+	return nil
+}
+
+func (d *fakeAFXDPDevice) Close() error {
+	close(d.closed)
+	return nil
+}
+
+// fakeAFXDPPorts is the set of redirected ports
+type fakeAFXDPPorts struct {
+	mutex sync.Mutex
+	ports map[uint16]bool
+}
+
+func (p *fakeAFXDPPorts) Add(port uint16) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.ports[port] = true
+	return nil
+}
+
+func (p *fakeAFXDPPorts) Remove(port uint16) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.ports, port)
+	return nil
+}
+
+func (p *fakeAFXDPPorts) Close() error { return nil }
+
+func (p *fakeAFXDPPorts) has(port uint16) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.ports[port]
+}
+
+func TestAFXDPBackend(t *testing.T) {
+	localMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	peerMAC := [6]byte{0x02, 0, 0, 0, 0, 2}
+	gatewayMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 0xfe}
+	config := AFXDPConfig{LocalIP: net.IPv4(198, 51, 100, 1), GatewayMAC: gatewayMAC}
+	peer := netip.MustParseAddrPort("203.0.113.7:6000")
+
+	_, err := newAFXDPBackend(AFXDPConfig{LocalIP: net.ParseIP("2001:db8::1")}, localMAC, nil, nil)
+	assert.ErrorIs(t, err, errInvalidAFXDPConfig)
+
+	device := newFakeAFXDPDevice()
+	ports := &fakeAFXDPPorts{ports: map[uint16]bool{}}
+	backend, err := newAFXDPBackend(config, localMAC, []afxdpDevice{device}, ports)
+	require.NoError(t, err)
+
+	_, err = backend.ListenPacket(0)
+	assert.ErrorIs(t, err, errInvalidAFXDPPort)
+	conn, err := backend.ListenPacket(3478)
+	require.NoError(t, err)
+	assert.True(t, ports.has(3478))
+	assert.Equal(t, "198.51.100.1:3478", conn.LocalAddr().String())
+	_, err = backend.ListenPacket(3478)
+	assert.ErrorIs(t, err, errAFXDPPortInUse)
+
+	// A datagram to the port, and another one to a port without a conn
+	for _, port := range []uint16{3479, 3478} {
+		frame := make([]byte, 2048)
+		device.rx <- frame[:afxdp.Encode(frame, &afxdp.Datagram{
+			SrcMAC:  peerMAC,
+			DstMAC:  [6]byte(localMAC),
+			Src:     peer,
+			Dst:     netip.AddrPortFrom(netip.MustParseAddr("198.51.100.1"), port),
+			Payload: []byte("from peer"),
+		})]
+	}
+	buf := make([]byte, 64)
+	n, from, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "from peer", string(buf[:n]))
+	assert.Equal(t, peer.String(), from.String())
+
+	// Answers go to the hardware address of the peer, other addresses to the gateway
+	for addr, mac := range map[string][6]byte{
+		peer.String():    peerMAC,
+		"192.0.2.9:5000": [6]byte(gatewayMAC),
+	} {
+		n, err = conn.WriteTo([]byte("to peer"), net.UDPAddrFromAddrPort(netip.MustParseAddrPort(addr)))
+		require.NoError(t, err)
+		assert.Equal(t, len("to peer"), n)
+
+		var d afxdp.Datagram
+		require.True(t, afxdp.Parse(<-device.tx, &d))
+		assert.Equal(t, afxdp.Datagram{
+			SrcMAC:  [6]byte(localMAC),
+			DstMAC:  mac,
+			Src:     netip.MustParseAddrPort("198.51.100.1:3478"),
+			Dst:     netip.MustParseAddrPort(addr),
+			Payload: []byte("to peer"),
+		}, d)
+	}
+	_, err = conn.WriteTo([]byte("to peer"), &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000})
+	assert.ErrorIs(t, err, errAFXDPNotIPv4)
+
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, _, err = conn.ReadFrom(buf)
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "the read should time out")
+
+	assert.NoError(t, conn.Close())
+	assert.False(t, ports.has(3478))
+	_, _, err = conn.ReadFrom(buf)
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	t.Run("RelayAddressGenerator", func(t *testing.T) {
+		generator := &RelayAddressGeneratorAFXDP{Backend: backend, MinPort: 49152, MaxPort: 49153}
+		require.NoError(t, generator.Validate())
+
+		var conns []net.PacketConn
+		for i := 0; i < 2; i++ {
+			relayConn, relayAddr, err := generator.AllocatePacketConn("udp4", 0)
+			require.NoError(t, err)
+			udpAddr, ok := relayAddr.(*net.UDPAddr)
+			require.True(t, ok)
+			assert.Equal(t, "198.51.100.1", udpAddr.IP.String())
+			assert.True(t, ports.has(uint16(udpAddr.Port)))
+			conns = append(conns, relayConn)
+		}
+		_, _, err := generator.AllocatePacketConn("udp4", 0)
+		assert.ErrorIs(t, err, errMaxRetriesExceeded, "the range should be exhausted")
+		assert.NoError(t, conns[0].Close())
+	})
+
+	// The backend closes the remaining conns
+	assert.NoError(t, backend.Close())
+	assert.Empty(t, ports.ports)
+	_, err = backend.ListenPacket(3478)
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestNewAFXDPBackend(t *testing.T) {
+	_, err := NewAFXDPBackend(AFXDPConfig{Interface: "lo"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/pion/turn/v4/internal/afxdp"
+	"github.com/pion/turn/v4/internal/xdp"
+)
+
+// NewAFXDPBackend binds an AF_XDP socket to every queue of the interface and adds them to
+// the maps of the redirect program. It requires CAP_NET_RAW and CAP_BPF, or root.
+func NewAFXDPBackend(config AFXDPConfig) (*AFXDPBackend, error) {
+	if config.Interface == "" || config.PinPath == "" || config.Queues < 0 {
+		return nil, errInvalidAFXDPConfig
+	}
+	if config.Queues == 0 {
+		config.Queues = 1
+	}
+	iface, err := net.InterfaceByName(config.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	sockets, err := xdp.OpenPinnedMap(filepath.Join(config.PinPath, afxdp.SocketsMap), 4, 4)
+	if err != nil {
+		return nil, err
+	}
+	defer sockets.Close() //nolint:errcheck
+	portsMap, err := xdp.OpenPinnedMap(filepath.Join(config.PinPath, afxdp.PortsMap), 2, 1)
+	if err != nil {
+		return nil, err
+	}
+	ports := afxdpPortsMap{portsMap}
+
+	var devices []afxdpDevice
+	closeAll := func(err error) error {
+		for _, d := range devices {
+			err = errors.Join(err, d.Close())
+		}
+		return errors.Join(err, ports.Close())
+	}
+	for queue := 0; queue < config.Queues; queue++ {
+		s, err := afxdp.NewSocket(afxdp.Config{Ifindex: iface.Index, Queue: queue, Frames: config.Frames})
+		if err != nil {
+			return nil, closeAll(err)
+		}
+		devices = append(devices, s)
+		if err := sockets.Update(nativeUint32(uint32(queue)), nativeUint32(uint32(s.FD()))); err != nil {
+			return nil, closeAll(err)
+		}
+	}
+
+	b, err := newAFXDPBackend(config, iface.HardwareAddr, devices, ports)
+	if err != nil {
+		return nil, closeAll(err)
+	}
+	return b, nil
+}
+
+// afxdpPortsMap is the pinned set of redirected ports
+type afxdpPortsMap struct {
+	m *xdp.Map
+}
+
+func (p afxdpPortsMap) Add(port uint16) error {
+	return p.m.Update(binary.BigEndian.AppendUint16(nil, port), []byte{1})
+}
+
+func (p afxdpPortsMap) Remove(port uint16) error {
+	return p.m.Delete(binary.BigEndian.AppendUint16(nil, port))
+}
+
+func (p afxdpPortsMap) Close() error {
+	return p.m.Close()
+}
+
+// nativeUint32 encodes v in the byte order of the host, like BPF maps of __u32
+func nativeUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0])) = v
+	return b
+}
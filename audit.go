@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/turn/v4/internal/server"
+)
+
+// AuditEventType is the kind of an AuditEvent
+type AuditEventType int
+
+const (
+	// AuditAuthSuccess is a request with valid credentials. Every authenticated request is
+	// recorded, not only Allocate requests.
+	AuditAuthSuccess = AuditEventType(server.AuditAuthSuccess)
+	// AuditAuthFailure is a request whose credentials were refused
+	AuditAuthFailure = AuditEventType(server.AuditAuthFailure)
+	// AuditQuotaRejected is an Allocate request refused because the server, or the guests
+	// of a listener, reached their maximum number of allocations
+	AuditQuotaRejected = AuditEventType(server.AuditQuotaRejected)
+	// AuditPermissionDenied is a peer the PermissionHandler did not permit a client to use
+	AuditPermissionDenied = AuditEventType(server.AuditPermissionDenied)
+	// AuditAdminAction is an action of an administrator, see Server.AuditAdminAction
+	AuditAdminAction = AuditPermissionDenied + 1
+)
+
+func (t AuditEventType) String() string {
+	switch t {
+	case AuditAuthSuccess:
+		return "auth_success"
+	case AuditAuthFailure:
+		return "auth_failure"
+	case AuditQuotaRejected:
+		return "quota_rejected"
+	case AuditPermissionDenied:
+		return "permission_denied"
+	case AuditAdminAction:
+		return "admin_action"
+	default:
+		return "unknown"
+	}
+}
+
+// AuditEvent is a security relevant record of a Server, see ServerConfig.AuditSink
+type AuditEvent struct {
+	Time time.Time
+	Type AuditEventType
+
+	// Method is the STUN method of the request, e.g. "Allocate". Empty for admin actions.
+	Method string
+
+	// Username of the request, or the administrator of an admin action
+	Username string
+
+	// SrcAddr is the address of the client, PeerIP the peer of a denied permission
+	SrcAddr net.Addr
+	PeerIP  net.IP
+
+	// Code is the STUN error code the request was answered with, zero if it was not
+	// answered with an error
+	Code int
+
+	// Detail tells why a request was refused, or what an administrator did
+	Detail string
+}
+
+// MarshalJSON encodes the event as a flat JSON object, leaving out empty fields
+func (e AuditEvent) MarshalJSON() ([]byte, error) {
+	record := struct {
+		Time     time.Time `json:"time"`
+		Type     string    `json:"type"`
+		Method   string    `json:"method,omitempty"`
+		Username string    `json:"username,omitempty"`
+		SrcAddr  string    `json:"src_addr,omitempty"`
+		PeerIP   string    `json:"peer_ip,omitempty"`
+		Code     int       `json:"code,omitempty"`
+		Detail   string    `json:"detail,omitempty"`
+	}{
+		Time:     e.Time,
+		Type:     e.Type.String(),
+		Method:   e.Method,
+		Username: e.Username,
+		Code:     e.Code,
+		Detail:   e.Detail,
+	}
+	if e.SrcAddr != nil {
+		record.SrcAddr = e.SrcAddr.String()
+	}
+	if e.PeerIP != nil {
+		record.PeerIP = e.PeerIP.String()
+	}
+	return json.Marshal(record)
+}
+
+// AuditSink receives the AuditEvents of a Server. Audit is called concurrently on the
+// goroutines of the server and should not block for long; failures are logged.
+type AuditSink interface {
+	Audit(event AuditEvent) error
+}
+
+// FileAuditSink is an AuditSink appending every event to a file as a line of JSON
+type FileAuditSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileAuditSink opens the file for appending, creating it if needed. Close it once the
+// server is closed.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// Audit appends the event to the file
+func (s *FileAuditSink) Audit(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file
+func (s *FileAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// AuditAdminAction records an action of an administrator of the server, e.g. of an admin
+// API built around it, with the other AuditEvents of the server. It is a no-op without an
+// AuditSink.
+func (s *Server) AuditAdminAction(admin, action string) {
+	s.recordAudit(AuditEvent{Time: time.Now(), Type: AuditAdminAction, Username: admin, Detail: action})
+}
+
+// audit records an AuditEvent of the server package, and publishes the auth failures and
+// refused quotas as Events
+func (s *Server) audit(event server.AuditEvent) {
+	switch event.Type {
+	case server.AuditAuthFailure:
+		s.events.publish(Event{Type: EventAuthFailure, Username: event.Username, SrcAddr: event.SrcAddr, Detail: event.Detail})
+	case server.AuditQuotaRejected:
+		s.events.publish(Event{Type: EventQuotaExceeded, Username: event.Username, SrcAddr: event.SrcAddr, Detail: event.Detail})
+	default:
+	}
+	if s.auditSink == nil {
+		return
+	}
+
+	s.recordAudit(AuditEvent{
+		Time:     time.Now(),
+		Type:     AuditEventType(event.Type),
+		Method:   event.Method.String(),
+		Username: event.Username,
+		SrcAddr:  event.SrcAddr,
+		PeerIP:   event.PeerIP,
+		Code:     int(event.Code),
+		Detail:   event.Detail,
+	})
+}
+
+func (s *Server) recordAudit(event AuditEvent) {
+	if s.auditSink == nil {
+		return
+	}
+	if err := s.auditSink.Audit(event); err != nil {
+		s.log.Errorf("Failed to record audit event: %s", err)
+	}
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package turn
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogAuditSink is an AuditSink sending every event to syslog as JSON, with the auth
+// facility. Refusals are logged as warnings, everything else as notices.
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogAuditSink connects to the syslog daemon at raddr over network, or to the local
+// one if network is empty, see syslog.Dial. Close it once the server is closed.
+func NewSyslogAuditSink(network, raddr, tag string) (*SyslogAuditSink, error) {
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditSink{writer: writer}, nil
+}
+
+// Audit sends the event to syslog
+func (s *SyslogAuditSink) Audit(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	switch event.Type {
+	case AuditAuthFailure, AuditQuotaRejected, AuditPermissionDenied:
+		return s.writer.Warning(string(line))
+	default:
+		return s.writer.Notice(string(line))
+	}
+}
+
+// Close closes the connection to syslog
+func (s *SyslogAuditSink) Close() error {
+	return s.writer.Close()
+}
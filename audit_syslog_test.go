@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package turn
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogAuditSink(t *testing.T) {
+	daemon, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer daemon.Close() //nolint:errcheck
+
+	sink, err := NewSyslogAuditSink("udp", daemon.LocalAddr().String(), "turn")
+	require.NoError(t, err)
+	defer sink.Close() //nolint:errcheck
+
+	read := func() string {
+		buf := make([]byte, 1500)
+		require.NoError(t, daemon.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := daemon.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	assert.NoError(t, sink.Audit(AuditEvent{Type: AuditAuthFailure, Username: "bob"}))
+	message := read()
+	assert.True(t, strings.HasPrefix(message, "<36>"), "a failure should be a warning of the auth facility: %s", message)
+	assert.Contains(t, message, `"type":"auth_failure"`)
+
+	assert.NoError(t, sink.Audit(AuditEvent{Type: AuditAuthSuccess, Username: "alice"}))
+	message = read()
+	assert.True(t, strings.HasPrefix(message, "<37>"), "a success should be a notice: %s", message)
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryAuditSink struct {
+	mutex  sync.Mutex
+	events []AuditEvent
+}
+
+func (s *memoryAuditSink) Audit(event AuditEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// take returns the events recorded since the last call, without their time
+func (s *memoryAuditSink) take() []AuditEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	events := s.events
+	s.events = nil
+	for i := range events {
+		events[i].Time = time.Time{}
+		events[i].SrcAddr = nil
+	}
+	return events
+}
+
+func TestServerAudit(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	sink := &memoryAuditSink{}
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), username != "mallory"
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+				PermissionHandler: func(_ net.Addr, peerIP net.IP) bool {
+					return peerIP.IsLoopback()
+				},
+			},
+		},
+		Realm:          "pion.ly",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		MaxAllocations: 1,
+		AuditSink:      sink,
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	newClient := func(username, password string) *Client {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			Username:       username,
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		t.Cleanup(client.Close)
+		require.NoError(t, client.Listen())
+		return client
+	}
+
+	relayConn, err := newClient("alice", "pass").Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+	assert.Equal(t, []AuditEvent{{Type: AuditAuthSuccess, Method: "Allocate", Username: "alice"}}, sink.take())
+
+	_, err = relayConn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234})
+	assert.Error(t, err)
+	events := sink.take()
+	require.Len(t, events, 2)
+	assert.Equal(t, AuditEvent{Type: AuditAuthSuccess, Method: "CreatePermission", Username: "alice"}, events[0])
+	assert.Equal(t, AuditPermissionDenied, events[1].Type)
+	assert.Equal(t, "alice", events[1].Username)
+	assert.Equal(t, "192.0.2.1", events[1].PeerIP.String())
+	assert.Equal(t, 403, events[1].Code)
+
+	_, err = newClient("bob", "pass").Allocate()
+	assert.Error(t, err)
+	events = sink.take()
+	require.Len(t, events, 2)
+	assert.Equal(t, AuditQuotaRejected, events[1].Type)
+	assert.Equal(t, "bob", events[1].Username)
+	assert.Equal(t, 508, events[1].Code)
+
+	_, err = newClient("bob", "wrong").Allocate()
+	assert.Error(t, err)
+	assert.Equal(t, []AuditEvent{{
+		Type: AuditAuthFailure, Method: "Allocate", Username: "bob", Code: 400, Detail: "integrity check failed",
+	}}, sink.take())
+
+	_, err = newClient("mallory", "pass").Allocate()
+	assert.Error(t, err)
+	assert.Equal(t, []AuditEvent{{
+		Type: AuditAuthFailure, Method: "Allocate", Username: "mallory", Code: 400, Detail: "unknown user",
+	}}, sink.take())
+
+	server.AuditAdminAction("root", "revoked alice")
+	assert.Equal(t, []AuditEvent{{Type: AuditAdminAction, Username: "root", Detail: "revoked alice"}}, sink.take())
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		require.NoError(t, err)
+		assert.NoError(t, sink.Audit(AuditEvent{
+			Time:     time.Unix(1700000000, 0).UTC(),
+			Type:     AuditAuthFailure,
+			Method:   "Allocate",
+			Username: "bob",
+			SrcAddr:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+			Code:     400,
+			Detail:   "unknown user",
+		}))
+		assert.NoError(t, sink.Close())
+	}
+
+	content, err := os.ReadFile(path) //nolint:gosec
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	require.Len(t, lines, 2, "the file should be appended to")
+	assert.JSONEq(t, `{
+		"time": "2023-11-14T22:13:20Z",
+		"type": "auth_failure",
+		"method": "Allocate",
+		"username": "bob",
+		"src_addr": "127.0.0.1:5000",
+		"code": 400,
+		"detail": "unknown user"
+	}`, lines[1])
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAuthCacheTTL = time.Minute
+
+// AuthCacheConfig configures an AuthCache
+type AuthCacheConfig struct {
+	// TTL is how long an accepted key is cached. Defaults to a minute.
+	TTL time.Duration
+
+	// NegativeTTL is how long a rejected username is cached, so retries of unknown
+	// users do not reach the backend either. Defaults to 0, which does not cache
+	// rejections.
+	NegativeTTL time.Duration
+}
+
+// AuthCache caches the answers of an AuthHandler by username and realm, so an
+// expensive lookup is not repeated for the 401 challenge, the retry and every
+// refresh of a client. See NewAuthCache.
+type AuthCache struct {
+	handler     AuthHandler
+	ttl         time.Duration
+	negativeTTL time.Duration
+	cache       *authKeyCache
+}
+
+// NewAuthCache returns an AuthCache in front of handler. The source address is
+// not part of the cache key, so do not cache handlers whose answer depends on it.
+func NewAuthCache(handler AuthHandler, config AuthCacheConfig) *AuthCache {
+	if config.TTL <= 0 {
+		config.TTL = defaultAuthCacheTTL
+	}
+	return &AuthCache{
+		handler:     handler,
+		ttl:         config.TTL,
+		negativeTTL: config.NegativeTTL,
+		cache:       newAuthKeyCache(),
+	}
+}
+
+// AuthHandler returns a turn.AuthHandler answering from the cache, and from the
+// wrapped handler for users that are not cached
+func (c *AuthCache) AuthHandler() AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		if key, ok, cached := c.cache.lookup(username, realm); cached {
+			return key, ok
+		}
+
+		key, ok := c.handler(username, realm, srcAddr)
+		if ok {
+			c.cache.put(username, realm, key, c.ttl)
+		} else {
+			c.cache.putRejected(username, realm, c.negativeTTL)
+		}
+		return key, ok
+	}
+}
+
+// Invalidate drops the cached answers for username in all realms, e.g. once
+// its password changed or it was disabled
+func (c *AuthCache) Invalidate(username string) {
+	c.cache.invalidate(username)
+}
+
+// authKeyCache caches the keys of the auth handlers backed by an external
+// credential store, so not every request of a client reaches the store
+type authKeyCache struct {
+	mutex   sync.Mutex
+	entries map[string]authKeyCacheEntry
+	sweptAt time.Time
+}
+
+type authKeyCacheEntry struct {
+	key       []byte
+	rejected  bool
+	expiresAt time.Time
+}
+
+func newAuthKeyCache() *authKeyCache {
+	return &authKeyCache{entries: map[string]authKeyCacheEntry{}}
+}
+
+func authKeyCacheKey(username, realm string) string {
+	return username + "\x00" + realm
+}
+
+func (c *authKeyCache) get(username, realm string) ([]byte, bool) {
+	key, ok, _ := c.lookup(username, realm)
+	return key, ok
+}
+
+// lookup returns the cached answer for the user, cached is false if there is none
+func (c *authKeyCache) lookup(username, realm string) (key []byte, ok, cached bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cacheKey := authKeyCacheKey(username, realm)
+	entry, cached := c.entries[cacheKey]
+	if !cached {
+		return nil, false, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, cacheKey)
+		return nil, false, false
+	}
+	return entry.key, !entry.rejected, true
+}
+
+// put caches the key for ttl, a ttl that is not positive does not cache it
+func (c *authKeyCache) put(username, realm string, key []byte, ttl time.Duration) {
+	c.store(username, realm, authKeyCacheEntry{key: key}, ttl)
+}
+
+// putRejected caches that the user was rejected for ttl
+func (c *authKeyCache) putRejected(username, realm string, ttl time.Duration) {
+	c.store(username, realm, authKeyCacheEntry{rejected: true}, ttl)
+}
+
+func (c *authKeyCache) store(username, realm string, entry authKeyCacheEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Sweep the expired keys of users that did not come back, at most once per TTL
+	now := time.Now()
+	if now.Sub(c.sweptAt) > ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweptAt = now
+	}
+	entry.expiresAt = now.Add(ttl)
+	c.entries[authKeyCacheKey(username, realm)] = entry
+}
+
+func (c *authKeyCache) invalidate(username string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	prefix := username + "\x00"
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
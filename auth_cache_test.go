@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCache(t *testing.T) {
+	key := GenerateAuthKey("alice", "pion.ly", "pass")
+	lookups := map[string]int{}
+	handler := func(username, _ string, _ net.Addr) ([]byte, bool) {
+		lookups[username]++
+		if username == "alice" {
+			return key, true
+		}
+		return nil, false
+	}
+
+	t.Run("Cached", func(t *testing.T) {
+		lookups = map[string]int{}
+		cache := NewAuthCache(handler, AuthCacheConfig{NegativeTTL: time.Minute})
+		authHandler := cache.AuthHandler()
+
+		for i := 0; i < 3; i++ {
+			actualKey, ok := authHandler("alice", "pion.ly", nil)
+			assert.True(t, ok)
+			assert.Equal(t, key, actualKey)
+			_, ok = authHandler("mallory", "pion.ly", nil)
+			assert.False(t, ok)
+		}
+		assert.Equal(t, map[string]int{"alice": 1, "mallory": 1}, lookups)
+
+		// Every realm is cached separately, and all of them are invalidated
+		_, ok := authHandler("alice", "example.com", nil)
+		assert.True(t, ok)
+		cache.Invalidate("alice")
+		cache.Invalidate("mallory")
+		_, ok = authHandler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		_, ok = authHandler("alice", "example.com", nil)
+		assert.True(t, ok)
+		_, ok = authHandler("mallory", "pion.ly", nil)
+		assert.False(t, ok)
+		assert.Equal(t, map[string]int{"alice": 4, "mallory": 2}, lookups)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		lookups = map[string]int{}
+		cache := NewAuthCache(handler, AuthCacheConfig{TTL: 50 * time.Millisecond})
+		authHandler := cache.AuthHandler()
+
+		for i := 0; i < 2; i++ {
+			_, ok := authHandler("alice", "pion.ly", nil)
+			assert.True(t, ok)
+			_, ok = authHandler("mallory", "pion.ly", nil)
+			assert.False(t, ok)
+		}
+		assert.Equal(t, map[string]int{"alice": 1, "mallory": 2}, lookups, "rejections should not be cached by default")
+
+		time.Sleep(100 * time.Millisecond)
+		_, ok := authHandler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, 2, lookups["alice"])
+	})
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/turn/v4/internal/ipnet"
+)
+
+const (
+	defaultAuthDecisionTTL        = 30 * time.Second
+	defaultAuthDecisionMaxEntries = 1 << 16
+)
+
+// AuthDecisionCacheConfig configures an AuthDecisionCache
+type AuthDecisionCacheConfig struct {
+	// TTL is how long a decision to accept a request is cached. Defaults to 30 seconds.
+	TTL time.Duration
+
+	// NegativeTTL is how long a decision to reject a request is cached. Defaults to 0,
+	// which does not cache rejections.
+	NegativeTTL time.Duration
+
+	// MaxEntries bounds the decisions kept, further decisions are not cached until
+	// enough of them expired. Defaults to 65536.
+	MaxEntries int
+}
+
+// AuthDecisionCache caches whole decisions of auth handlers and of the
+// AllocationAuthorizer, by username, realm and source IP. Unlike an AuthCache it covers
+// allocation policies and quota checks, so the refreshes, permissions and channel
+// bindings of large fleets do not reach the backend either. See NewAuthDecisionCache.
+type AuthDecisionCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+
+	mutex   sync.Mutex
+	entries map[authDecisionKey]authDecision
+	sweptAt time.Time
+
+	hits, misses atomic.Uint64
+}
+
+type authDecisionKind int
+
+const (
+	authDecisionAuthenticate authDecisionKind = iota
+	authDecisionAuthorize
+)
+
+type authDecisionKey struct {
+	kind                authDecisionKind
+	username, realm, ip string
+}
+
+type authDecision struct {
+	key       []byte
+	policy    *AllocationPolicy
+	ok        bool
+	err       error
+	expiresAt time.Time
+}
+
+// NewAuthDecisionCache returns an empty AuthDecisionCache. Wrap the auth handler and
+// AllocationAuthorizer of the server with it.
+//
+// A decision is reused for every request of the username from the same IP until it
+// expires, so handlers must not decide on anything else, e.g. the method or transport
+// of a request. A cached authorization also lets a user exceed its quota by the
+// allocations it creates within TTL, so keep TTL short.
+func NewAuthDecisionCache(config AuthDecisionCacheConfig) *AuthDecisionCache {
+	if config.TTL <= 0 {
+		config.TTL = defaultAuthDecisionTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultAuthDecisionMaxEntries
+	}
+	return &AuthDecisionCache{
+		ttl:         config.TTL,
+		negativeTTL: config.NegativeTTL,
+		maxEntries:  config.MaxEntries,
+		entries:     map[authDecisionKey]authDecision{},
+	}
+}
+
+// AuthHandler returns a turn.AuthHandler caching the decisions of handler
+func (c *AuthDecisionCache) AuthHandler(handler AuthHandler) AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		decision := c.decide(authDecisionAuthenticate, username, realm, srcAddr, func() authDecision {
+			key, ok := handler(username, realm, srcAddr)
+			return authDecision{key: key, ok: ok}
+		})
+		return decision.key, decision.ok
+	}
+}
+
+// PolicyAuthHandler returns a turn.PolicyAuthHandler caching the decisions of handler,
+// with their policies
+func (c *AuthDecisionCache) PolicyAuthHandler(handler PolicyAuthHandler) PolicyAuthHandler {
+	return func(username, realm string, srcAddr net.Addr) ([]byte, *AllocationPolicy, bool) {
+		decision := c.decide(authDecisionAuthenticate, username, realm, srcAddr, func() authDecision {
+			key, policy, ok := handler(username, realm, srcAddr)
+			return authDecision{key: key, policy: policy, ok: ok}
+		})
+		return decision.key, decision.policy, decision.ok
+	}
+}
+
+// RequestAuthHandler returns a turn.RequestAuthHandler caching the decisions of handler,
+// with their policies
+func (c *AuthDecisionCache) RequestAuthHandler(handler RequestAuthHandler) RequestAuthHandler {
+	return RequestAuthHandlerFunc(func(r *AuthRequest) ([]byte, *AllocationPolicy, bool) {
+		decision := c.decide(authDecisionAuthenticate, r.Username, r.Realm, r.SrcAddr, func() authDecision {
+			key, policy, ok := handler.AuthenticateRequest(r)
+			return authDecision{key: key, policy: policy, ok: ok}
+		})
+		return decision.key, decision.policy, decision.ok
+	})
+}
+
+// AllocationAuthorizer returns a turn.AllocationAuthorizer caching the decisions of
+// authorize, e.g. of a quota check. Denials are rejections and cached for NegativeTTL.
+func (c *AuthDecisionCache) AllocationAuthorizer(authorize AllocationAuthorizer) AllocationAuthorizer {
+	return func(r *AuthRequest) error {
+		return c.decide(authDecisionAuthorize, r.Username, r.Realm, r.SrcAddr, func() authDecision {
+			err := authorize(r)
+			return authDecision{ok: err == nil, err: err}
+		}).err
+	}
+}
+
+// Invalidate drops the cached decisions for username, e.g. once its password changed,
+// it was disabled or its quota was lowered
+func (c *AuthDecisionCache) Invalidate(username string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for k := range c.entries {
+		if k.username == username {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Hits returns the number of decisions answered from the cache
+func (c *AuthDecisionCache) Hits() uint64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of decisions that had to be made by the wrapped handlers
+func (c *AuthDecisionCache) Misses() uint64 {
+	return c.misses.Load()
+}
+
+// decide returns the cached decision, or makes and caches it
+func (c *AuthDecisionCache) decide(kind authDecisionKind, username, realm string, srcAddr net.Addr,
+	makeDecision func() authDecision,
+) authDecision {
+	key := authDecisionKey{kind: kind, username: username, realm: realm, ip: authDecisionIP(srcAddr)}
+	if decision, ok := c.lookup(key); ok {
+		c.hits.Add(1)
+		return decision
+	}
+	c.misses.Add(1)
+
+	decision := makeDecision()
+	ttl := c.ttl
+	if !decision.ok {
+		ttl = c.negativeTTL
+	}
+	c.store(key, decision, ttl)
+	return decision
+}
+
+func (c *AuthDecisionCache) lookup(key authDecisionKey) (authDecision, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	decision, ok := c.entries[key]
+	if !ok {
+		return authDecision{}, false
+	}
+	if time.Now().After(decision.expiresAt) {
+		delete(c.entries, key)
+		return authDecision{}, false
+	}
+	return decision, true
+}
+
+func (c *AuthDecisionCache) store(key authDecisionKey, decision authDecision, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Sweep the expired decisions of clients that did not come back, at most once per
+	// TTL, or once per second while the cache is full
+	now := time.Now()
+	if sinceSweep := now.Sub(c.sweptAt); sinceSweep > ttl || (len(c.entries) >= c.maxEntries && sinceSweep > time.Second) {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweptAt = now
+	}
+	if len(c.entries) >= c.maxEntries {
+		return
+	}
+	decision.expiresAt = now.Add(ttl)
+	c.entries[key] = decision
+}
+
+// authDecisionIP returns the source IP decisions are cached for, the port of a client
+// changes with every NAT mapping
+func authDecisionIP(srcAddr net.Addr) string {
+	if srcAddr == nil {
+		return ""
+	}
+	if ip, _, err := ipnet.AddrIPPort(srcAddr); err == nil {
+		return ip.String()
+	}
+	return srcAddr.String()
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthDecisionCache(t *testing.T) {
+	key := GenerateAuthKey("alice", "pion.ly", "pass")
+	policy := &AllocationPolicy{Bandwidth: 1000}
+	lookups := map[string]int{}
+	handler := func(username, _ string, _ net.Addr) ([]byte, *AllocationPolicy, bool) {
+		lookups[username]++
+		if username == "alice" {
+			return key, policy, true
+		}
+		return nil, nil, false
+	}
+	addr := func(ip string, port int) net.Addr {
+		return &net.UDPAddr{IP: net.ParseIP(ip), Port: port}
+	}
+
+	t.Run("PolicyAuthHandler", func(t *testing.T) {
+		lookups = map[string]int{}
+		cache := NewAuthDecisionCache(AuthDecisionCacheConfig{NegativeTTL: time.Minute})
+		authHandler := cache.PolicyAuthHandler(handler)
+
+		// A new port of the same IP reuses the decision
+		for port := 1000; port < 1003; port++ {
+			actualKey, actualPolicy, ok := authHandler("alice", "pion.ly", addr("192.0.2.1", port))
+			assert.True(t, ok)
+			assert.Equal(t, key, actualKey)
+			assert.Equal(t, policy, actualPolicy)
+			_, _, ok = authHandler("mallory", "pion.ly", addr("192.0.2.1", port))
+			assert.False(t, ok)
+		}
+		assert.Equal(t, map[string]int{"alice": 1, "mallory": 1}, lookups)
+		assert.Equal(t, uint64(4), cache.Hits())
+		assert.Equal(t, uint64(2), cache.Misses())
+
+		// Every IP and realm is decided separately
+		_, _, ok := authHandler("alice", "pion.ly", addr("192.0.2.2", 1000))
+		assert.True(t, ok)
+		_, _, ok = authHandler("alice", "example.com", addr("192.0.2.1", 1000))
+		assert.True(t, ok)
+		assert.Equal(t, 3, lookups["alice"])
+
+		cache.Invalidate("alice")
+		_, _, ok = authHandler("alice", "pion.ly", addr("192.0.2.1", 1000))
+		assert.True(t, ok)
+		assert.Equal(t, 4, lookups["alice"])
+	})
+
+	t.Run("AllocationAuthorizer", func(t *testing.T) {
+		var checks int
+		quotaReached := false
+		cache := NewAuthDecisionCache(AuthDecisionCacheConfig{TTL: 50 * time.Millisecond})
+		authorize := cache.AllocationAuthorizer(func(*AuthRequest) error {
+			checks++
+			if quotaReached {
+				return &AuthorizationError{Code: 486}
+			}
+			return nil
+		})
+		request := &AuthRequest{Username: "alice", Realm: "pion.ly", SrcAddr: addr("192.0.2.1", 1000)}
+
+		assert.NoError(t, authorize(request))
+		quotaReached = true
+		assert.NoError(t, authorize(request), "the grant should be cached")
+		assert.Equal(t, 1, checks)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Error(t, authorize(request))
+		assert.Error(t, authorize(request))
+		assert.Equal(t, 3, checks, "denials should not be cached by default")
+	})
+
+	t.Run("MaxEntries", func(t *testing.T) {
+		lookups = map[string]int{}
+		cache := NewAuthDecisionCache(AuthDecisionCacheConfig{MaxEntries: 1})
+		authHandler := cache.AuthHandler(func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			key, _, ok := handler(username, realm, srcAddr)
+			return key, ok
+		})
+
+		for i := 0; i < 2; i++ {
+			authHandler("alice", "pion.ly", addr("192.0.2.1", 1000))
+			authHandler("alice", "pion.ly", addr("192.0.2.2", 1000))
+		}
+		assert.Equal(t, 3, lookups["alice"], "only the first decision should be cached")
+	})
+}
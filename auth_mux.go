@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// AuthMechanism is the kind of credentials a request is authenticated with
+type AuthMechanism int
+
+const (
+	// AuthMechanismLongTerm is a static username and password
+	AuthMechanismLongTerm AuthMechanism = iota
+	// AuthMechanismTURNREST is an ephemeral username of the TURN REST API, the expiry
+	// timestamp optionally followed by a colon and a user id
+	AuthMechanismTURNREST
+	// AuthMechanismToken is a username carrying a JSON Web Token, like those of
+	// GenerateJWTTURNCredentials
+	AuthMechanismToken
+)
+
+func (m AuthMechanism) String() string {
+	switch m {
+	case AuthMechanismLongTerm:
+		return "long-term"
+	case AuthMechanismTURNREST:
+		return "TURN REST"
+	case AuthMechanismToken:
+		return "token"
+	default:
+		return "unknown AuthMechanism"
+	}
+}
+
+// MultiAuthConfig configures NewMultiAuthHandler. Every handler is optional, but one is
+// required.
+type MultiAuthConfig struct {
+	// LongTerm authenticates static usernames, and every username when the handler of its
+	// mechanism is not set
+	LongTerm AuthHandler
+
+	// TURNREST authenticates ephemeral credentials, e.g. NewTURNRESTAuthHandler
+	TURNREST MultiKeyAuthHandler
+
+	// Token authenticates credentials carrying a token, e.g. NewJWTAuthHandler
+	Token AuthHandler
+
+	// OnAuthentication is called for every authentication with the mechanism that was
+	// chosen, e.g. to follow a migration. Optional.
+	OnAuthentication func(mechanism AuthMechanism, ok bool)
+
+	Log logging.LeveledLogger
+}
+
+// NewMultiAuthHandler returns a turn.MultiKeyAuthHandler that accepts several kinds of
+// credentials at once, so clients can be migrated from one to another without a flag day.
+// Set it as the ServerConfig.MultiKeyAuthHandler.
+//
+// The mechanism is chosen by the form of the USERNAME, the only attribute that carries the
+// credentials: a JSON Web Token selects Token, a decimal timestamp before an optional colon
+// TURNREST, and anything else LongTerm.
+func NewMultiAuthHandler(config MultiAuthConfig) (MultiKeyAuthHandler, error) {
+	if config.LongTerm == nil && config.TURNREST == nil && config.Token == nil {
+		return nil, errInvalidMultiAuthConfig
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	return func(username, realm string, srcAddr net.Addr) (keys [][]byte, ok bool) {
+		mechanism := authMechanismOf(username)
+		switch {
+		case mechanism == AuthMechanismToken && config.Token != nil:
+			var key []byte
+			key, ok = config.Token(username, realm, srcAddr)
+			keys = [][]byte{key}
+		case mechanism == AuthMechanismTURNREST && config.TURNREST != nil:
+			keys, ok = config.TURNREST(username, realm, srcAddr)
+		case config.LongTerm != nil:
+			mechanism = AuthMechanismLongTerm
+			var key []byte
+			key, ok = config.LongTerm(username, realm, srcAddr)
+			keys = [][]byte{key}
+		default:
+			config.Log.Debugf("No handler for the %s credentials %q", mechanism, username)
+		}
+
+		if config.OnAuthentication != nil {
+			config.OnAuthentication(mechanism, ok)
+		}
+		return keys, ok
+	}, nil
+}
+
+// CredentialExpiryOf is a CredentialExpiryHandler for the credentials of NewMultiAuthHandler:
+// TURN REST usernames expire at their timestamp, and tokens at their "exp" claim. The token
+// is not verified, that is left to authentication.
+func CredentialExpiryOf(username string) (expiry time.Time, ok bool) {
+	switch authMechanismOf(username) {
+	case AuthMechanismTURNREST:
+		timestamp, _, _ := strings.Cut(username, ":")
+		t, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(t, 0), true
+	case AuthMechanismToken:
+		var claims jwtClaims
+		if err := decodeJWTPart(strings.Split(username, ".")[1], &claims); err != nil || claims.ExpiresAt == nil {
+			return time.Time{}, false
+		}
+		return jwtTime(*claims.ExpiresAt), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// authMechanismOf tells the mechanism of the credentials by the form of the username
+func authMechanismOf(username string) AuthMechanism {
+	if parts := strings.Split(username, "."); len(parts) == 3 {
+		isToken := true
+		for _, part := range parts {
+			isToken = isToken && part != "" && strings.Trim(part, base64URLAlphabet) == ""
+		}
+		if isToken {
+			return AuthMechanismToken
+		}
+	}
+
+	timestamp, _, _ := strings.Cut(username, ":")
+	if _, err := strconv.ParseUint(timestamp, 10, 64); err == nil {
+		return AuthMechanismTURNREST
+	}
+	return AuthMechanismLongTerm
+}
+
+const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
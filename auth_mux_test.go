@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMechanismOf(t *testing.T) {
+	for username, mechanism := range map[string]AuthMechanism{
+		"alice":                    AuthMechanismLongTerm,
+		"alice.smith":              AuthMechanismLongTerm,
+		"a.b.c d":                  AuthMechanismLongTerm,
+		"..":                       AuthMechanismLongTerm,
+		"1700000000":               AuthMechanismTURNREST,
+		"1700000000:alice":         AuthMechanismTURNREST,
+		"alice:1700000000":         AuthMechanismLongTerm,
+		"eyJhbGciOi.eyJzdWIiOi.c2": AuthMechanismToken,
+	} {
+		assert.Equal(t, mechanism, authMechanismOf(username), username)
+	}
+}
+
+func TestCredentialExpiryOf(t *testing.T) {
+	expiry, ok := CredentialExpiryOf("1700000000:alice")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1700000000, 0), expiry)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	expiry, ok = CredentialExpiryOf(signJWT(t, "HS256", []byte("key"), map[string]interface{}{"exp": exp}))
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(exp, 0), expiry)
+
+	_, ok = CredentialExpiryOf(signJWT(t, "HS256", []byte("key"), map[string]interface{}{"sub": "alice"}))
+	assert.False(t, ok, "tokens without exp should not tell")
+	_, ok = CredentialExpiryOf("alice")
+	assert.False(t, ok)
+}
+
+func TestNewMultiAuthHandler(t *testing.T) {
+	_, err := NewMultiAuthHandler(MultiAuthConfig{})
+	assert.ErrorIs(t, err, errInvalidMultiAuthConfig)
+
+	turnREST, err := NewTURNRESTAuthHandler(TURNRESTAuthConfig{Secrets: []string{"rest secret"}})
+	require.NoError(t, err)
+	signingKey := []byte("signing key")
+	token, err := NewJWTAuthHandler(JWTAuthConfig{
+		SharedSecret:    "token secret",
+		VerificationKey: signingKey,
+		Audience:        "turn.example.com",
+	})
+	require.NoError(t, err)
+	longTerm := func(username, realm string, _ net.Addr) ([]byte, bool) {
+		return GenerateAuthKey(username, realm, "pass"), username == "alice"
+	}
+
+	var mechanisms []AuthMechanism
+	handler, err := NewMultiAuthHandler(MultiAuthConfig{
+		LongTerm: longTerm,
+		TURNREST: turnREST,
+		Token:    token,
+		OnAuthentication: func(mechanism AuthMechanism, ok bool) {
+			assert.True(t, ok, mechanism.String())
+			mechanisms = append(mechanisms, mechanism)
+		},
+	})
+	require.NoError(t, err)
+
+	check := func(username, password string) {
+		keys, ok := handler(username, "pion.ly", nil)
+		assert.True(t, ok, username)
+		assert.Contains(t, keys, GenerateAuthKey(username, "pion.ly", password), username)
+	}
+
+	check("alice", "pass")
+
+	restUsername, restPassword, err := GenerateLongTermTURNRESTCredentials("rest secret", "bob", time.Minute)
+	require.NoError(t, err)
+	check(restUsername, restPassword)
+
+	jwtUsername, jwtPassword, err := GenerateJWTTURNCredentials("token secret", signJWT(t, "HS256", signingKey, map[string]interface{}{
+		"sub": "carol",
+		"aud": "turn.example.com",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}))
+	require.NoError(t, err)
+	check(jwtUsername, jwtPassword)
+
+	assert.Equal(t, []AuthMechanism{AuthMechanismLongTerm, AuthMechanismTURNREST, AuthMechanismToken}, mechanisms)
+
+	t.Run("Fallback", func(t *testing.T) {
+		handler, err := NewMultiAuthHandler(MultiAuthConfig{LongTerm: longTerm})
+		require.NoError(t, err)
+		_, ok := handler(restUsername, "pion.ly", nil)
+		assert.False(t, ok, "usernames of unset mechanisms should be long-term ones")
+
+		handler, err = NewMultiAuthHandler(MultiAuthConfig{TURNREST: turnREST})
+		require.NoError(t, err)
+		_, ok = handler("alice", "pion.ly", nil)
+		assert.False(t, ok)
+	})
+}
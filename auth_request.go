@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// AddressFamily is the IP address family of a relayed transport address
+type AddressFamily int
+
+const (
+	// AddressFamilyUnspecified is used when a request does not ask for a family,
+	// which means IPv4 for an Allocate request
+	AddressFamilyUnspecified AddressFamily = iota
+	// AddressFamilyIPv4 is IPv4
+	AddressFamilyIPv4
+	// AddressFamilyIPv6 is IPv6
+	AddressFamilyIPv6
+)
+
+// AuthRequest is a request that is being authenticated, see RequestAuthHandler
+type AuthRequest struct {
+	Username string
+	Realm    string
+	SrcAddr  net.Addr
+
+	// Method of the request, e.g. "Allocate", "Refresh" or "CreatePermission"
+	Method string
+
+	// Protocol is the transport between the client and the server, "udp" or "tcp".
+	// TLS and DTLS are reported as the transport underneath.
+	Protocol string
+
+	// RequestedTransport is the REQUESTED-TRANSPORT of an Allocate request, "udp" or
+	// "tcp", and empty for other requests
+	RequestedTransport string
+
+	// RequestedLifetime is the LIFETIME the client asked for, zero if it did not
+	RequestedLifetime time.Duration
+
+	// RequestedAddressFamily is the REQUESTED-ADDRESS-FAMILY of the request
+	RequestedAddressFamily AddressFamily
+
+	// Origin is the ORIGIN of the request (RFC 7635, section 4.2), e.g. the web
+	// origin of a browser client, and empty if it has none
+	Origin string
+
+	// Message is the raw STUN message. It must not be modified, nor used once the
+	// handler returned, its buffer is reused for other messages.
+	Message []byte
+}
+
+// RequestAuthHandler authenticates requests with their full context, e.g. to only
+// grant TCP relays in one realm by not authenticating other TCP Allocate requests.
+// A nil policy selects ServerConfig.AllocationPolicy.
+type RequestAuthHandler interface {
+	AuthenticateRequest(r *AuthRequest) (key []byte, policy *AllocationPolicy, ok bool)
+}
+
+// RequestAuthHandlerFunc is a function implementing RequestAuthHandler
+type RequestAuthHandlerFunc func(r *AuthRequest) (key []byte, policy *AllocationPolicy, ok bool)
+
+// AuthenticateRequest calls f(r)
+func (f RequestAuthHandlerFunc) AuthenticateRequest(r *AuthRequest) ([]byte, *AllocationPolicy, bool) {
+	return f(r)
+}
+
+func newAuthRequest(username, realm string, srcAddr net.Addr, m *stun.Message) *AuthRequest {
+	r := &AuthRequest{
+		Username: username,
+		Realm:    realm,
+		SrcAddr:  srcAddr,
+		Method:   m.Type.Method.String(),
+		Protocol: "udp",
+		Message:  m.Raw,
+	}
+	if _, ok := srcAddr.(*net.TCPAddr); ok {
+		r.Protocol = "tcp"
+	}
+
+	var transport proto.RequestedTransport
+	if err := transport.GetFrom(m); err == nil {
+		switch transport.Protocol {
+		case proto.ProtoUDP:
+			r.RequestedTransport = "udp"
+		case proto.ProtoTCP:
+			r.RequestedTransport = "tcp"
+		}
+	}
+	var lifetime proto.Lifetime
+	if err := lifetime.GetFrom(m); err == nil {
+		r.RequestedLifetime = lifetime.Duration
+	}
+	var family proto.RequestedAddressFamily
+	if err := family.GetFrom(m); err == nil {
+		switch family {
+		case proto.RequestedFamilyIPv4:
+			r.RequestedAddressFamily = AddressFamilyIPv4
+		case proto.RequestedFamilyIPv6:
+			r.RequestedAddressFamily = AddressFamilyIPv6
+		}
+	}
+	if origin, err := m.Get(stun.AttrOrigin); err == nil {
+		r.Origin = string(origin)
+	}
+	return r
+}
+
+// internalRequestAuthHandler adapts a RequestAuthHandler to the internal server
+func internalRequestAuthHandler(h RequestAuthHandler) func(string, string, net.Addr, *stun.Message) ([]byte, *allocation.Policy, bool) {
+	if h == nil {
+		return nil
+	}
+	return func(username, realm string, srcAddr net.Addr, m *stun.Message) ([]byte, *allocation.Policy, bool) {
+		key, policy, ok := h.AuthenticateRequest(newAuthRequest(username, realm, srcAddr, m))
+		if policy == nil {
+			return key, nil, ok
+		}
+		internalPolicy := policy.toInternal()
+		return key, &internalPolicy, ok
+	}
+}
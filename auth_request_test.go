@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthRequest(t *testing.T) {
+	srcAddr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	m, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		proto.RequestedTransport{Protocol: proto.ProtoTCP},
+		proto.Lifetime{Duration: 5 * time.Minute},
+		proto.RequestedFamilyIPv6,
+		stun.RawAttribute{Type: stun.AttrOrigin, Value: []byte("https://example.com")},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, &AuthRequest{
+		Username:               "alice",
+		Realm:                  "pion.ly",
+		SrcAddr:                srcAddr,
+		Method:                 "Allocate",
+		Protocol:               "tcp",
+		RequestedTransport:     "tcp",
+		RequestedLifetime:      5 * time.Minute,
+		RequestedAddressFamily: AddressFamilyIPv6,
+		Origin:                 "https://example.com",
+		Message:                m.Raw,
+	}, newAuthRequest("alice", "pion.ly", srcAddr, m))
+
+	m, err = stun.Build(stun.TransactionID, stun.NewType(stun.MethodRefresh, stun.ClassRequest))
+	require.NoError(t, err)
+	assert.Equal(t, &AuthRequest{
+		Username: "alice",
+		Realm:    "pion.ly",
+		SrcAddr:  &net.UDPAddr{},
+		Method:   "Refresh",
+		Protocol: "udp",
+		Message:  m.Raw,
+	}, newAuthRequest("alice", "pion.ly", &net.UDPAddr{}, m))
+}
+
+func TestRequestAuthHandler(t *testing.T) {
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var requests []string
+	server, err := NewServer(ServerConfig{
+		// UDP relays only, for lifetimes of at most ten minutes
+		RequestAuthHandler: RequestAuthHandlerFunc(func(r *AuthRequest) ([]byte, *AllocationPolicy, bool) {
+			lock.Lock()
+			defer lock.Unlock()
+			requests = append(requests, r.Method+" "+r.RequestedTransport)
+			if r.Method == "Allocate" && (r.RequestedTransport != "udp" || r.Protocol != "udp") {
+				return nil, nil, false
+			}
+			return GenerateAuthKey(r.Username, r.Realm, "pass"), nil, r.RequestedLifetime <= 10*time.Minute
+		}),
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		STUNServerAddr: "127.0.0.1:3478",
+		TURNServerAddr: "127.0.0.1:3478",
+		Conn:           conn,
+		Username:       "alice",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.NoError(t, relayConn.Close())
+
+	_, err = client.AllocateTCP()
+	assert.Error(t, err, "TCP relays should be refused")
+
+	lock.Lock()
+	assert.Equal(t, "Allocate udp", requests[0])
+	assert.Contains(t, requests, "Allocate tcp")
+	lock.Unlock()
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
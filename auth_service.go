@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+const (
+	defaultAuthServicePoolSize = 4
+	defaultAuthServiceTimeout  = 2 * time.Second
+	defaultAuthServiceFailOpen = time.Hour
+)
+
+// AuthServiceRequest asks an external authentication service about a user
+type AuthServiceRequest struct {
+	Username string
+	Realm    string
+	SrcAddr  net.Addr
+}
+
+// AuthServiceResponse is the decision of an external authentication service
+type AuthServiceResponse struct {
+	Allowed bool
+	Key     []byte            // See GenerateAuthKey
+	Policy  *AllocationPolicy // Nil selects ServerConfig.AllocationPolicy
+}
+
+// AuthServiceConn is a connection to an external authentication service, usually the
+// gRPC client of authservice/auth.proto, see authservice.Dial in the
+// github.com/pion/turn/v4/authservice module. Services speaking another protocol can be
+// consulted by implementing it.
+type AuthServiceConn interface {
+	// Authenticate asks the service about a user. An error means the service
+	// could not decide, a denied user is answered with Allowed false.
+	Authenticate(ctx context.Context, req AuthServiceRequest) (AuthServiceResponse, error)
+	Close() error
+}
+
+// AuthServiceConfig configures an AuthServiceClient
+type AuthServiceConfig struct {
+	// Dial opens a connection to the service. It is called lazily for each connection
+	// of the pool, and again on the next request if it failed.
+	Dial func(ctx context.Context) (AuthServiceConn, error)
+
+	// PoolSize is the number of connections requests are spread over. Defaults to 4.
+	PoolSize int
+
+	// Timeout is the deadline of a request, including dialing. Defaults to 2 seconds.
+	Timeout time.Duration
+
+	// FailOpen accepts users with the last key the service returned for them while the
+	// service fails or does not answer in time. Users the service never accepted are
+	// still rejected, as there is no key for them. By default, users are rejected.
+	FailOpen bool
+
+	// FailOpenTTL is how long the last key of a user is kept to fail open with after
+	// the service returned it. Defaults to an hour.
+	FailOpenTTL time.Duration
+
+	Log logging.LeveledLogger
+}
+
+// AuthServiceClient authenticates users by consulting an external service,
+// see AuthHandler and PolicyAuthHandler
+type AuthServiceClient struct {
+	dial        func(ctx context.Context) (AuthServiceConn, error)
+	timeout     time.Duration
+	failOpen    bool
+	failOpenTTL time.Duration
+	log         logging.LeveledLogger
+
+	pool []authServiceSlot
+	next atomic.Uint32
+
+	mutex     sync.Mutex
+	lastKnown map[string]lastKnownAuth // Only kept when failing open
+	sweptAt   time.Time
+	closed    bool
+}
+
+type lastKnownAuth struct {
+	res       AuthServiceResponse
+	expiresAt time.Time
+}
+
+type authServiceSlot struct {
+	mutex sync.Mutex
+	conn  AuthServiceConn
+}
+
+// NewAuthServiceClient returns an AuthServiceClient. Close it once the server is closed.
+func NewAuthServiceClient(config AuthServiceConfig) (*AuthServiceClient, error) {
+	if config.Dial == nil {
+		return nil, errAuthServiceDialUnset
+	}
+	if config.PoolSize < 0 || config.Timeout < 0 || config.FailOpenTTL < 0 {
+		return nil, errInvalidAuthServiceConfig
+	}
+
+	if config.PoolSize == 0 {
+		config.PoolSize = defaultAuthServicePoolSize
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultAuthServiceTimeout
+	}
+	if config.FailOpenTTL == 0 {
+		config.FailOpenTTL = defaultAuthServiceFailOpen
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	return &AuthServiceClient{
+		dial:        config.Dial,
+		timeout:     config.Timeout,
+		failOpen:    config.FailOpen,
+		failOpenTTL: config.FailOpenTTL,
+		log:         config.Log,
+		pool:        make([]authServiceSlot, config.PoolSize),
+		lastKnown:   map[string]lastKnownAuth{},
+	}, nil
+}
+
+// AuthHandler returns a turn.AuthHandler consulting the service
+func (c *AuthServiceClient) AuthHandler() AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+		key, _, ok = c.authenticate(username, realm, srcAddr)
+		return key, ok
+	}
+}
+
+// PolicyAuthHandler returns a turn.PolicyAuthHandler consulting the service, which
+// applies the AllocationPolicy the service returns
+func (c *AuthServiceClient) PolicyAuthHandler() PolicyAuthHandler {
+	return c.authenticate
+}
+
+// Close closes the connections to the service
+func (c *AuthServiceClient) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+
+	var errs []error
+	for i := range c.pool {
+		slot := &c.pool[i]
+		slot.mutex.Lock()
+		if slot.conn != nil {
+			if err := slot.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			slot.conn = nil
+		}
+		slot.mutex.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (c *AuthServiceClient) authenticate(username, realm string, srcAddr net.Addr) ([]byte, *AllocationPolicy, bool) {
+	c.log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	user := username + "\x00" + realm
+	res, err := c.request(ctx, AuthServiceRequest{Username: username, Realm: realm, SrcAddr: srcAddr})
+	if err != nil {
+		if !c.failOpen {
+			c.log.Errorf("Authentication service failed, rejecting %q: %s", username, err)
+			return nil, nil, false
+		}
+
+		c.mutex.Lock()
+		known, ok := c.lastKnown[user]
+		if ok && time.Now().After(known.expiresAt) {
+			delete(c.lastKnown, user)
+			ok = false
+		}
+		c.mutex.Unlock()
+		if !ok {
+			c.log.Errorf("Authentication service failed and %q is unknown: %s", username, err)
+			return nil, nil, false
+		}
+		c.log.Warnf("Authentication service failed, accepting %q with its last known key: %s", username, err)
+		return known.res.Key, known.res.Policy, true
+	}
+
+	if !res.Allowed || len(res.Key) == 0 {
+		if c.failOpen {
+			c.mutex.Lock()
+			delete(c.lastKnown, user)
+			c.mutex.Unlock()
+		}
+		c.log.Debugf("Authentication service rejected %q", username)
+		return nil, nil, false
+	}
+
+	if c.failOpen {
+		c.remember(user, res)
+	}
+	return res.Key, res.Policy, true
+}
+
+// remember keeps the response to fail open with for the user, and forgets the
+// expired ones of users that did not come back, at most once per TTL
+func (c *AuthServiceClient) remember(user string, res AuthServiceResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.sweptAt) > c.failOpenTTL {
+		for k, known := range c.lastKnown {
+			if now.After(known.expiresAt) {
+				delete(c.lastKnown, k)
+			}
+		}
+		c.sweptAt = now
+	}
+	c.lastKnown[user] = lastKnownAuth{res: res, expiresAt: now.Add(c.failOpenTTL)}
+}
+
+// request sends the request over the next connection of the pool, dialing it if needed
+func (c *AuthServiceClient) request(ctx context.Context, req AuthServiceRequest) (AuthServiceResponse, error) {
+	slot := &c.pool[(c.next.Add(1)-1)%uint32(len(c.pool))]
+
+	slot.mutex.Lock()
+	conn := slot.conn
+	if conn == nil {
+		c.mutex.Lock()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			slot.mutex.Unlock()
+			return AuthServiceResponse{}, errAuthServiceClosed
+		}
+
+		var err error
+		if conn, err = c.dial(ctx); err != nil {
+			slot.mutex.Unlock()
+			return AuthServiceResponse{}, err
+		}
+		slot.conn = conn
+	}
+	slot.mutex.Unlock()
+
+	return conn.Authenticate(ctx, req)
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errAuthServiceDown = errors.New("auth service down")
+
+// fakeAuthService answers like an external authentication service, and can be
+// taken down or slowed past the deadline
+type fakeAuthService struct {
+	dials  atomic.Int32
+	down   atomic.Bool
+	stall  atomic.Bool
+	closed atomic.Int32
+}
+
+func (s *fakeAuthService) dial(context.Context) (AuthServiceConn, error) {
+	s.dials.Add(1)
+	return &fakeAuthConn{service: s}, nil
+}
+
+type fakeAuthConn struct {
+	service *fakeAuthService
+}
+
+func (c *fakeAuthConn) Authenticate(ctx context.Context, req AuthServiceRequest) (AuthServiceResponse, error) {
+	switch {
+	case c.service.down.Load():
+		return AuthServiceResponse{}, errAuthServiceDown
+	case c.service.stall.Load():
+		<-ctx.Done()
+		return AuthServiceResponse{}, ctx.Err()
+	case req.Username != "user":
+		return AuthServiceResponse{}, nil
+	}
+	return AuthServiceResponse{
+		Allowed: true,
+		Key:     GenerateAuthKey(req.Username, req.Realm, "pass"),
+		Policy:  &AllocationPolicy{Priority: PriorityPremium},
+	}, nil
+}
+
+func (c *fakeAuthConn) Close() error {
+	c.service.closed.Add(1)
+	return nil
+}
+
+func TestAuthServiceClient(t *testing.T) {
+	srcAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	key := GenerateAuthKey("user", "pion.ly", "pass")
+
+	_, err := NewAuthServiceClient(AuthServiceConfig{})
+	assert.ErrorIs(t, err, errAuthServiceDialUnset)
+	_, err = NewAuthServiceClient(AuthServiceConfig{Dial: (&fakeAuthService{}).dial, PoolSize: -1})
+	assert.ErrorIs(t, err, errInvalidAuthServiceConfig)
+
+	t.Run("Pool", func(t *testing.T) {
+		service := &fakeAuthService{}
+		client, err := NewAuthServiceClient(AuthServiceConfig{Dial: service.dial, PoolSize: 2})
+		require.NoError(t, err)
+		handler := client.PolicyAuthHandler()
+
+		for i := 0; i < 5; i++ {
+			actualKey, policy, ok := handler("user", "pion.ly", srcAddr)
+			assert.True(t, ok)
+			assert.Equal(t, key, actualKey)
+			assert.Equal(t, &AllocationPolicy{Priority: PriorityPremium}, policy)
+		}
+		assert.Equal(t, int32(2), service.dials.Load(), "connections should be reused")
+
+		_, _, ok := handler("stranger", "pion.ly", srcAddr)
+		assert.False(t, ok)
+
+		assert.NoError(t, client.Close())
+		assert.Equal(t, int32(2), service.closed.Load())
+		_, _, ok = handler("user", "pion.ly", srcAddr)
+		assert.False(t, ok)
+	})
+
+	t.Run("FailClosed", func(t *testing.T) {
+		service := &fakeAuthService{}
+		client, err := NewAuthServiceClient(AuthServiceConfig{Dial: service.dial})
+		require.NoError(t, err)
+		handler := client.AuthHandler()
+
+		_, ok := handler("user", "pion.ly", srcAddr)
+		assert.True(t, ok)
+
+		service.down.Store(true)
+		_, ok = handler("user", "pion.ly", srcAddr)
+		assert.False(t, ok)
+		assert.NoError(t, client.Close())
+	})
+
+	t.Run("FailOpen", func(t *testing.T) {
+		service := &fakeAuthService{}
+		client, err := NewAuthServiceClient(AuthServiceConfig{
+			Dial:     service.dial,
+			Timeout:  50 * time.Millisecond,
+			FailOpen: true,
+		})
+		require.NoError(t, err)
+		handler := client.AuthHandler()
+
+		_, ok := handler("user", "pion.ly", srcAddr)
+		assert.True(t, ok)
+
+		service.stall.Store(true)
+		start := time.Now()
+		actualKey, ok := handler("user", "pion.ly", srcAddr)
+		assert.True(t, ok, "the last known key should be used past the deadline")
+		assert.Equal(t, key, actualKey)
+		assert.Less(t, time.Since(start), time.Second)
+
+		_, ok = handler("user", "other.realm", srcAddr)
+		assert.False(t, ok, "unknown users should be rejected")
+		assert.NoError(t, client.Close())
+	})
+
+	t.Run("FailOpenTTL", func(t *testing.T) {
+		service := &fakeAuthService{}
+		client, err := NewAuthServiceClient(AuthServiceConfig{
+			Dial:        service.dial,
+			FailOpen:    true,
+			FailOpenTTL: 50 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		handler := client.AuthHandler()
+
+		_, ok := handler("user", "pion.ly", srcAddr)
+		assert.True(t, ok)
+		time.Sleep(100 * time.Millisecond)
+
+		// Remembering another user forgets the expired keys
+		_, ok = handler("user", "other.realm", srcAddr)
+		assert.True(t, ok)
+		client.mutex.Lock()
+		assert.Len(t, client.lastKnown, 1)
+		client.mutex.Unlock()
+
+		service.down.Store(true)
+		_, ok = handler("user", "pion.ly", srcAddr)
+		assert.False(t, ok, "expired keys should not be used")
+		_, ok = handler("user", "other.realm", srcAddr)
+		assert.True(t, ok)
+		assert.NoError(t, client.Close())
+	})
+}
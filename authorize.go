@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/pion/stun/v3"
+)
+
+// AllocationAuthorizer decides whether an Allocate request may create an allocation once its
+// credentials are verified, so policy can live apart from the key store, see
+// ServerConfig.AuthorizeAllocation. It returns nil to grant the allocation. An
+// *AuthorizationError denies it with its error code, any other error with 403 (Forbidden).
+type AllocationAuthorizer func(r *AuthRequest) error
+
+// AuthorizationError denies a request with a STUN error code, e.g. 486 (Allocation Quota
+// Reached) for a user that has too many allocations
+type AuthorizationError struct {
+	// Code is the error code, between 300 and 699
+	Code int
+
+	// Reason is the reason phrase. Optional.
+	Reason string
+}
+
+func (e *AuthorizationError) Error() string {
+	return fmt.Sprintf("not authorized: %d %s", e.Code, e.Reason)
+}
+
+// internalAllocationAuthorizer adapts an AllocationAuthorizer to the internal server
+func internalAllocationAuthorizer(a AllocationAuthorizer) func(string, string, net.Addr, *stun.Message) *stun.ErrorCodeAttribute {
+	if a == nil {
+		return nil
+	}
+	return func(username, realm string, srcAddr net.Addr, m *stun.Message) *stun.ErrorCodeAttribute {
+		err := a(newAuthRequest(username, realm, srcAddr, m))
+		if err == nil {
+			return nil
+		}
+
+		var authErr *AuthorizationError
+		if !errors.As(err, &authErr) || authErr.Code < 300 || authErr.Code > 699 {
+			return &stun.ErrorCodeAttribute{Code: stun.CodeForbidden}
+		}
+		return &stun.ErrorCodeAttribute{Code: stun.ErrorCode(authErr.Code), Reason: []byte(authErr.Reason)}
+	}
+}
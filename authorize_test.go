@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizeAllocation(t *testing.T) {
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var requests []*AuthRequest
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		AuthorizeAllocation: func(r *AuthRequest) error {
+			lock.Lock()
+			defer lock.Unlock()
+			requests = append(requests, r)
+			switch r.Username {
+			case "bob":
+				return &AuthorizationError{Code: 486, Reason: "Quota Reached"}
+			case "carol":
+				return errors.New("suspended") //nolint:goerr113
+			default:
+				return nil
+			}
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+
+	allocate := func(username, password string) error {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			Username:       username,
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	assert.NoError(t, allocate("alice", "pass"))
+	err = allocate("bob", "pass")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "486")
+	}
+	err = allocate("carol", "pass")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "403")
+	}
+	assert.Error(t, allocate("dave", "wrong"))
+
+	lock.Lock()
+	var usernames []string
+	for _, r := range requests {
+		usernames = append(usernames, r.Username)
+		assert.Equal(t, "Allocate", r.Method)
+		assert.Equal(t, "udp", r.RequestedTransport)
+		assert.Equal(t, "pion.ly", r.Realm)
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol"}, usernames, "only authentic requests should be authorized")
+	lock.Unlock()
+
+	assert.NoError(t, server.Close())
+}
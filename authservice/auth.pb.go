@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// The service a Pion TURN server consults for the keys of its users and whether
+// they may allocate, see turn.NewAuthServiceClient.
+//
+// The Go client is generated into github.com/pion/turn/v4/authservice, a module
+// of its own so pion/turn does not depend on gRPC, with
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative auth.proto
+//
+// see authservice.Dial for the turn.AuthServiceConn around it.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: auth.proto
+
+package authservice
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Priority int32
+
+const (
+	Priority_PRIORITY_STANDARD Priority = 0
+	Priority_PRIORITY_PREMIUM  Priority = 1
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "PRIORITY_STANDARD",
+		1: "PRIORITY_PREMIUM",
+	}
+	Priority_value = map[string]int32{
+		"PRIORITY_STANDARD": 0,
+		"PRIORITY_PREMIUM":  1,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_auth_proto_enumTypes[0].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_auth_proto_enumTypes[0]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{0}
+}
+
+type AuthenticateRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Username string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Realm    string                 `protobuf:"bytes,2,opt,name=realm,proto3" json:"realm,omitempty"`
+	// The transport address of the client, e.g. "192.0.2.1:50000"
+	SrcAddr       string `protobuf:"bytes,3,opt,name=src_addr,json=srcAddr,proto3" json:"src_addr,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthenticateRequest) Reset() {
+	*x = AuthenticateRequest{}
+	mi := &file_auth_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthenticateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthenticateRequest) ProtoMessage() {}
+
+func (x *AuthenticateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthenticateRequest.ProtoReflect.Descriptor instead.
+func (*AuthenticateRequest) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AuthenticateRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *AuthenticateRequest) GetRealm() string {
+	if x != nil {
+		return x.Realm
+	}
+	return ""
+}
+
+func (x *AuthenticateRequest) GetSrcAddr() string {
+	if x != nil {
+		return x.SrcAddr
+	}
+	return ""
+}
+
+type AuthenticateResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Whether the user may use the server at all
+	Allowed bool `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	// MD5(username ":" realm ":" password), see turn.GenerateAuthKey
+	Key []byte `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// Constrains the allocations of the user. The server default applies if unset.
+	Policy        *AllocationPolicy `protobuf:"bytes,3,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthenticateResponse) Reset() {
+	*x = AuthenticateResponse{}
+	mi := &file_auth_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthenticateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthenticateResponse) ProtoMessage() {}
+
+func (x *AuthenticateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthenticateResponse.ProtoReflect.Descriptor instead.
+func (*AuthenticateResponse) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AuthenticateResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *AuthenticateResponse) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *AuthenticateResponse) GetPolicy() *AllocationPolicy {
+	if x != nil {
+		return x.Policy
+	}
+	return nil
+}
+
+type AllocationPolicy struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Bits per second relayed to and from any single peer IP address, 0 is unlimited
+	PeerBandwidth int64 `protobuf:"varint,1,opt,name=peer_bandwidth,json=peerBandwidth,proto3" json:"peer_bandwidth,omitempty"`
+	// Bits per second relayed by the allocation in both directions, 0 is unlimited
+	Bandwidth     int64    `protobuf:"varint,2,opt,name=bandwidth,proto3" json:"bandwidth,omitempty"`
+	Priority      Priority `protobuf:"varint,3,opt,name=priority,proto3,enum=pion.turn.auth.v1.Priority" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AllocationPolicy) Reset() {
+	*x = AllocationPolicy{}
+	mi := &file_auth_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AllocationPolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AllocationPolicy) ProtoMessage() {}
+
+func (x *AllocationPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_auth_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AllocationPolicy.ProtoReflect.Descriptor instead.
+func (*AllocationPolicy) Descriptor() ([]byte, []int) {
+	return file_auth_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AllocationPolicy) GetPeerBandwidth() int64 {
+	if x != nil {
+		return x.PeerBandwidth
+	}
+	return 0
+}
+
+func (x *AllocationPolicy) GetBandwidth() int64 {
+	if x != nil {
+		return x.Bandwidth
+	}
+	return 0
+}
+
+func (x *AllocationPolicy) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_STANDARD
+}
+
+var File_auth_proto protoreflect.FileDescriptor
+
+const file_auth_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"auth.proto\x12\x11pion.turn.auth.v1\"b\n" +
+	"\x13AuthenticateRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x14\n" +
+	"\x05realm\x18\x02 \x01(\tR\x05realm\x12\x19\n" +
+	"\bsrc_addr\x18\x03 \x01(\tR\asrcAddr\"\x7f\n" +
+	"\x14AuthenticateResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12;\n" +
+	"\x06policy\x18\x03 \x01(\v2#.pion.turn.auth.v1.AllocationPolicyR\x06policy\"\x90\x01\n" +
+	"\x10AllocationPolicy\x12%\n" +
+	"\x0epeer_bandwidth\x18\x01 \x01(\x03R\rpeerBandwidth\x12\x1c\n" +
+	"\tbandwidth\x18\x02 \x01(\x03R\tbandwidth\x127\n" +
+	"\bpriority\x18\x03 \x01(\x0e2\x1b.pion.turn.auth.v1.PriorityR\bpriority*7\n" +
+	"\bPriority\x12\x15\n" +
+	"\x11PRIORITY_STANDARD\x10\x00\x12\x14\n" +
+	"\x10PRIORITY_PREMIUM\x10\x012k\n" +
+	"\bTURNAuth\x12_\n" +
+	"\fAuthenticate\x12&.pion.turn.auth.v1.AuthenticateRequest\x1a'.pion.turn.auth.v1.AuthenticateResponseB%Z#github.com/pion/turn/v4/authserviceb\x06proto3"
+
+var (
+	file_auth_proto_rawDescOnce sync.Once
+	file_auth_proto_rawDescData []byte
+)
+
+func file_auth_proto_rawDescGZIP() []byte {
+	file_auth_proto_rawDescOnce.Do(func() {
+		file_auth_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_auth_proto_rawDesc), len(file_auth_proto_rawDesc)))
+	})
+	return file_auth_proto_rawDescData
+}
+
+var file_auth_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_auth_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_auth_proto_goTypes = []any{
+	(Priority)(0),                // 0: pion.turn.auth.v1.Priority
+	(*AuthenticateRequest)(nil),  // 1: pion.turn.auth.v1.AuthenticateRequest
+	(*AuthenticateResponse)(nil), // 2: pion.turn.auth.v1.AuthenticateResponse
+	(*AllocationPolicy)(nil),     // 3: pion.turn.auth.v1.AllocationPolicy
+}
+var file_auth_proto_depIdxs = []int32{
+	3, // 0: pion.turn.auth.v1.AuthenticateResponse.policy:type_name -> pion.turn.auth.v1.AllocationPolicy
+	0, // 1: pion.turn.auth.v1.AllocationPolicy.priority:type_name -> pion.turn.auth.v1.Priority
+	1, // 2: pion.turn.auth.v1.TURNAuth.Authenticate:input_type -> pion.turn.auth.v1.AuthenticateRequest
+	2, // 3: pion.turn.auth.v1.TURNAuth.Authenticate:output_type -> pion.turn.auth.v1.AuthenticateResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_auth_proto_init() }
+func file_auth_proto_init() {
+	if File_auth_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_auth_proto_rawDesc), len(file_auth_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_auth_proto_goTypes,
+		DependencyIndexes: file_auth_proto_depIdxs,
+		EnumInfos:         file_auth_proto_enumTypes,
+		MessageInfos:      file_auth_proto_msgTypes,
+	}.Build()
+	File_auth_proto = out.File
+	file_auth_proto_goTypes = nil
+	file_auth_proto_depIdxs = nil
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// The service a Pion TURN server consults for the keys of its users and whether
+// they may allocate, see turn.NewAuthServiceClient.
+//
+// The Go client is generated into github.com/pion/turn/v4/authservice, a module
+// of its own so pion/turn does not depend on gRPC, with
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative auth.proto
+//
+// see authservice.Dial for the turn.AuthServiceConn around it.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: auth.proto
+
+package authservice
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TURNAuth_Authenticate_FullMethodName = "/pion.turn.auth.v1.TURNAuth/Authenticate"
+)
+
+// TURNAuthClient is the client API for TURNAuth service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TURNAuthClient interface {
+	// Authenticate is called for every authenticated request of a TURN client
+	Authenticate(ctx context.Context, in *AuthenticateRequest, opts ...grpc.CallOption) (*AuthenticateResponse, error)
+}
+
+type tURNAuthClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTURNAuthClient(cc grpc.ClientConnInterface) TURNAuthClient {
+	return &tURNAuthClient{cc}
+}
+
+func (c *tURNAuthClient) Authenticate(ctx context.Context, in *AuthenticateRequest, opts ...grpc.CallOption) (*AuthenticateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthenticateResponse)
+	err := c.cc.Invoke(ctx, TURNAuth_Authenticate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TURNAuthServer is the server API for TURNAuth service.
+// All implementations must embed UnimplementedTURNAuthServer
+// for forward compatibility.
+type TURNAuthServer interface {
+	// Authenticate is called for every authenticated request of a TURN client
+	Authenticate(context.Context, *AuthenticateRequest) (*AuthenticateResponse, error)
+	mustEmbedUnimplementedTURNAuthServer()
+}
+
+// UnimplementedTURNAuthServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTURNAuthServer struct{}
+
+func (UnimplementedTURNAuthServer) Authenticate(context.Context, *AuthenticateRequest) (*AuthenticateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Authenticate not implemented")
+}
+func (UnimplementedTURNAuthServer) mustEmbedUnimplementedTURNAuthServer() {}
+func (UnimplementedTURNAuthServer) testEmbeddedByValue()                  {}
+
+// UnsafeTURNAuthServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TURNAuthServer will
+// result in compilation errors.
+type UnsafeTURNAuthServer interface {
+	mustEmbedUnimplementedTURNAuthServer()
+}
+
+func RegisterTURNAuthServer(s grpc.ServiceRegistrar, srv TURNAuthServer) {
+	// If the following call pancis, it indicates UnimplementedTURNAuthServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TURNAuth_ServiceDesc, srv)
+}
+
+func _TURNAuth_Authenticate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthenticateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TURNAuthServer).Authenticate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TURNAuth_Authenticate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TURNAuthServer).Authenticate(ctx, req.(*AuthenticateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TURNAuth_ServiceDesc is the grpc.ServiceDesc for TURNAuth service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TURNAuth_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pion.turn.auth.v1.TURNAuth",
+	HandlerType: (*TURNAuthServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Authenticate",
+			Handler:    _TURNAuth_Authenticate_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "auth.proto",
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package authservice is the gRPC client of the external authentication service a
+// turn.AuthServiceClient consults, see auth.proto:
+//
+//	client, err := turn.NewAuthServiceClient(turn.AuthServiceConfig{
+//		Dial: authservice.Dial("auth.example.com:443", grpc.WithTransportCredentials(creds)),
+//	})
+//	...
+//	server, err := turn.NewServer(turn.ServerConfig{
+//		PolicyAuthHandler: client.PolicyAuthHandler(),
+//		...
+//	})
+package authservice
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/pion/turn/v4"
+)
+
+// Dial returns a turn.AuthServiceConfig.Dial connecting to the service at target, a
+// gRPC target such as "dns:///auth.example.com:443", with the options, which need to
+// include the transport credentials
+func Dial(target string, opts ...grpc.DialOption) func(ctx context.Context) (turn.AuthServiceConn, error) {
+	return func(context.Context) (turn.AuthServiceConn, error) {
+		cc, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return NewConn(cc), nil
+	}
+}
+
+// NewConn returns a turn.AuthServiceConn calling the service over cc, which is closed
+// with it
+func NewConn(cc *grpc.ClientConn) turn.AuthServiceConn {
+	return &conn{cc: cc, client: NewTURNAuthClient(cc)}
+}
+
+type conn struct {
+	cc     *grpc.ClientConn
+	client TURNAuthClient
+}
+
+func (c *conn) Authenticate(ctx context.Context, req turn.AuthServiceRequest) (turn.AuthServiceResponse, error) {
+	in := &AuthenticateRequest{Username: req.Username, Realm: req.Realm}
+	if req.SrcAddr != nil {
+		in.SrcAddr = req.SrcAddr.String()
+	}
+
+	out, err := c.client.Authenticate(ctx, in)
+	if err != nil {
+		return turn.AuthServiceResponse{}, err
+	}
+
+	res := turn.AuthServiceResponse{Allowed: out.GetAllowed(), Key: out.GetKey()}
+	if policy := out.GetPolicy(); policy != nil {
+		res.Policy = &turn.AllocationPolicy{
+			PeerBandwidth: policy.GetPeerBandwidth(),
+			Bandwidth:     policy.GetBandwidth(),
+			Priority:      priorityClass(policy.GetPriority()),
+		}
+	}
+	return res, nil
+}
+
+func (c *conn) Close() error {
+	return c.cc.Close()
+}
+
+func priorityClass(p Priority) turn.PriorityClass {
+	if p == Priority_PRIORITY_PREMIUM {
+		return turn.PriorityPremium
+	}
+	return turn.PriorityStandard
+}
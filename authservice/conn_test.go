@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package authservice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/pion/turn/v4"
+)
+
+type authServer struct {
+	UnimplementedTURNAuthServer
+	requests chan *AuthenticateRequest
+}
+
+func (s *authServer) Authenticate(_ context.Context, req *AuthenticateRequest) (*AuthenticateResponse, error) {
+	s.requests <- req
+	if req.GetUsername() != "alice" {
+		return &AuthenticateResponse{}, nil
+	}
+	return &AuthenticateResponse{
+		Allowed: true,
+		Key:     turn.GenerateAuthKey(req.GetUsername(), req.GetRealm(), "pass"),
+		Policy:  &AllocationPolicy{Bandwidth: 1000, Priority: Priority_PRIORITY_PREMIUM},
+	}, nil
+}
+
+func TestDial(t *testing.T) {
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	service := &authServer{requests: make(chan *AuthenticateRequest, 4)}
+	RegisterTURNAuthServer(server, service)
+	go server.Serve(listener) //nolint:errcheck
+	defer server.Stop()
+
+	client, err := turn.NewAuthServiceClient(turn.AuthServiceConfig{
+		Dial: Dial("passthrough:///bufconn",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials())),
+	})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+	handler := client.PolicyAuthHandler()
+
+	srcAddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	key, policy, ok := handler("alice", "pion.ly", srcAddr)
+	assert.True(t, ok)
+	assert.Equal(t, turn.GenerateAuthKey("alice", "pion.ly", "pass"), key)
+	assert.Equal(t, &turn.AllocationPolicy{Bandwidth: 1000, Priority: turn.PriorityPremium}, policy)
+
+	req := <-service.requests
+	assert.Equal(t, "alice", req.GetUsername())
+	assert.Equal(t, "pion.ly", req.GetRealm())
+	assert.Equal(t, "192.0.2.1:50000", req.GetSrcAddr())
+
+	_, _, ok = handler("mallory", "pion.ly", srcAddr)
+	assert.False(t, ok)
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeBitrate    = 1000000 // 1 Mbit/s
+	defaultProbeDuration   = 2 * time.Second
+	defaultProbePacketSize = 1000
+	probePacingInterval    = 5 * time.Millisecond
+	probeDrainTimeout      = 500 * time.Millisecond
+
+	// Probe packets start with the magic, the ID of the probe, their sequence
+	// number and send time, and are padded to the packet size
+	probeMagic      = 0x50524f42 // "PROB"
+	probeHeaderSize = 4 + 4 + 4 + 8
+)
+
+// BandwidthProbeConfig configures a probe of Client.ProbeBandwidth
+type BandwidthProbeConfig struct {
+	Bitrate    int           // Bits per second sent, 1 Mbit/s by default
+	Duration   time.Duration // How long probe packets are sent, 2 seconds by default
+	PacketSize int           // Size of the probe packets, 1000 bytes by default
+
+	// Peer echoes the probe packets back. By default, they are sent to the relayed
+	// address of the allocation, so they traverse the relay twice.
+	Peer net.Addr
+}
+
+// BandwidthEstimate is the result of a bandwidth probe
+type BandwidthEstimate struct {
+	Sent       int           // Probe packets sent
+	Received   int           // Probe packets received back
+	Throughput float64       // Bits per second received
+	Loss       float64       // Share of the probe packets that was lost
+	Delay      time.Duration // Average time until a probe packet was received back
+}
+
+// ProbeBandwidth sends probe packets paced at the configured bitrate through the UDP
+// allocation and estimates the throughput and loss of the relay path from those that
+// come back, e.g. to check the quality before a call. Probing needs an allocation,
+// and while it runs, other data from the peer is passed to its previous DataHandler
+// or dropped.
+func (c *Client) ProbeBandwidth(ctx context.Context, config BandwidthProbeConfig) (*BandwidthEstimate, error) {
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return nil, errNoAllocation
+	}
+	if config.Bitrate < 0 || config.Duration < 0 || (config.PacketSize != 0 && config.PacketSize < probeHeaderSize) {
+		return nil, errInvalidProbeConfig
+	}
+	if config.Bitrate == 0 {
+		config.Bitrate = defaultProbeBitrate
+	}
+	if config.Duration == 0 {
+		config.Duration = defaultProbeDuration
+	}
+	if config.PacketSize == 0 {
+		config.PacketSize = defaultProbePacketSize
+	}
+	peer := config.Peer
+	if peer == nil {
+		peer = relayedConn.LocalAddr()
+	}
+
+	probe := &bandwidthProbe{id: c.nextProbeID.Add(1)}
+	c.mutex.RLock()
+	previous := c.peerDataHandlers[peer.String()]
+	c.mutex.RUnlock()
+	c.OnDataFrom(peer, func(from net.Addr, payload []byte) {
+		if !probe.handle(payload) && previous != nil {
+			previous(from, payload)
+		}
+	})
+	defer c.OnDataFrom(peer, previous)
+
+	// Pace the packets in bursts, as timers are too coarse for high bitrates
+	ticker := time.NewTicker(probePacingInterval)
+	defer ticker.Stop()
+	packetsPerSecond := float64(config.Bitrate) / float64(8*config.PacketSize)
+	buf := make([]byte, config.PacketSize)
+	start := time.Now()
+	for elapsed := time.Duration(0); elapsed < config.Duration; elapsed = time.Since(start) {
+		for due := int(elapsed.Seconds()*packetsPerSecond) + 1; probe.sentCount() < due; {
+			probe.next(buf)
+			if _, err := relayedConn.WriteTo(buf, peer); err != nil {
+				return nil, err
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Wait for the packets still in flight
+	drain := time.NewTimer(probeDrainTimeout)
+	defer drain.Stop()
+	for !probe.complete() {
+		select {
+		case <-ticker.C:
+		case <-drain.C:
+			return probe.estimate(), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return probe.estimate(), nil
+}
+
+// bandwidthProbe counts the probe packets sent and received back
+type bandwidthProbe struct {
+	id uint32 // Read-only
+
+	mutex      sync.Mutex
+	sent       int
+	received   int
+	bytes      int
+	first      time.Time
+	last       time.Time
+	totalDelay time.Duration
+}
+
+// next encodes the next probe packet into buf
+func (p *bandwidthProbe) next(buf []byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	binary.BigEndian.PutUint32(buf[0:4], probeMagic)
+	binary.BigEndian.PutUint32(buf[4:8], p.id)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(p.sent)) //nolint:gosec
+	binary.BigEndian.PutUint64(buf[12:20], uint64(time.Now().UnixNano()))
+	p.sent++
+}
+
+// handle counts a probe packet received back, and reports whether it was one
+func (p *bandwidthProbe) handle(payload []byte) bool {
+	if len(payload) < probeHeaderSize || binary.BigEndian.Uint32(payload[0:4]) != probeMagic ||
+		binary.BigEndian.Uint32(payload[4:8]) != p.id {
+		return false
+	}
+	now := time.Now()
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(payload[12:20]))) //nolint:gosec
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.received == 0 {
+		p.first = now
+	}
+	p.last = now
+	p.received++
+	p.bytes += len(payload)
+	p.totalDelay += now.Sub(sentAt)
+	return true
+}
+
+func (p *bandwidthProbe) sentCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.sent
+}
+
+func (p *bandwidthProbe) complete() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.received >= p.sent
+}
+
+func (p *bandwidthProbe) estimate() *BandwidthEstimate {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	estimate := &BandwidthEstimate{Sent: p.sent, Received: p.received}
+	if p.sent > 0 {
+		estimate.Loss = 1 - float64(p.received)/float64(p.sent)
+		if estimate.Loss < 0 {
+			estimate.Loss = 0 // Duplicated by the path
+		}
+	}
+	if p.received > 0 {
+		estimate.Delay = p.totalDelay / time.Duration(p.received)
+	}
+	if window := p.last.Sub(p.first); window > 0 {
+		// The first packet opens the window
+		estimate.Throughput = float64(8*(p.bytes-p.bytes/p.received)) / window.Seconds()
+	}
+	return estimate
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// chainedConn is the relayed net.PacketConn of an allocation made through the
+// UDP allocation of another client
+type chainedConn struct {
+	net.PacketConn
+	next  *Client        // Client of the second server, sending through relay
+	relay net.PacketConn // UDP allocation at the first server
+}
+
+// AllocateChained allocates at the TURN server of config through the UDP allocation
+// of the client, so packets traverse both relays, and the second server only sees
+// the relayed address of the first. The UDP allocation of the client is created for
+// the returned net.PacketConn only, with a channel bound to the second server, so
+// Allocate must not have been called. Conn of the config is ignored. Every relay adds
+// its headers, so payloads must be smaller than with a single relay. Closing the
+// returned conn releases both allocations.
+func (c *Client) AllocateChained(config *ClientConfig) (net.PacketConn, error) {
+	return c.AllocateChainedContext(context.Background(), config)
+}
+
+// AllocateChainedContext is AllocateChained, giving up once the context is done
+func (c *Client) AllocateChainedContext(ctx context.Context, config *ClientConfig) (net.PacketConn, error) {
+	relay, err := c.AllocateContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, next, err := c.allocateThrough(ctx, relay, config)
+	if err != nil {
+		relay.Close() //nolint:errcheck,gosec
+		return nil, err
+	}
+
+	return &chainedConn{
+		PacketConn: conn,
+		next:       next,
+		relay:      relay,
+	}, nil
+}
+
+func (c *Client) allocateThrough(ctx context.Context, relay net.PacketConn, config *ClientConfig) (net.PacketConn, *Client, error) {
+	nextConfig := *config
+	nextConfig.Conn = relay
+	nextConfig.Redial = nil
+	next, err := NewClient(&nextConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if server := next.TURNServerAddr(); server != nil {
+		if err = c.BindChannelContext(ctx, server); err != nil {
+			next.Close()
+			return nil, nil, err
+		}
+	}
+
+	if err = next.Listen(); err != nil {
+		next.Close()
+		return nil, nil, err
+	}
+
+	conn, err := next.AllocateContext(ctx)
+	if err != nil {
+		next.Close()
+		return nil, nil, err
+	}
+	return conn, next, nil
+}
+
+// Close releases the allocations at both servers
+func (c *chainedConn) Close() error {
+	err := c.PacketConn.Close()
+	c.next.Close()
+	return errors.Join(err, c.relay.Close())
+}
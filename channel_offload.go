@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4/internal/allocation"
+)
+
+// ChannelFlow is an established channel binding of a UDP allocation: the client sends
+// ChannelData with Number from ClientAddr to ServerAddr, and the server relays its payload
+// from RelayAddr to PeerAddr, and back.
+type ChannelFlow struct {
+	ClientAddr net.Addr
+	ServerAddr net.Addr
+	RelayAddr  net.Addr
+	PeerAddr   net.Addr
+	Number     uint16
+}
+
+// ChannelOffloader relays the traffic of channel bindings outside the server, e.g. in the
+// kernel with an XDPChannelOffloader, so steady-state media never reaches the read loops.
+// Set it as the ServerConfig.ChannelOffloader.
+//
+// Channel bindings are only offloaded for UDP allocations without bandwidth limits.
+// Offloaded packets bypass the relay queues and are not counted in the traffic of the
+// allocation. As the server cannot tell how idle they are, offloaded channel bindings and
+// their permissions count as in use for ServerConfig.MaxChannelBindingsPerAllocation and
+// MaxPermissionsPerAllocation: the idlest of the ones the server relays are evicted, and
+// offloaded ones only once all are offloaded. Methods are called concurrently.
+type ChannelOffloader interface {
+	// Offload starts relaying a new channel binding. An error leaves it to the server.
+	Offload(flow ChannelFlow) error
+
+	// Remove stops relaying a flow Offload accepted, once the channel binding expires or
+	// is evicted, or its allocation is deleted
+	Remove(flow ChannelFlow) error
+}
+
+// internalChannelOffloader adapts a ChannelOffloader to the internal/allocation one
+type internalChannelOffloader struct {
+	offloader ChannelOffloader
+}
+
+func newInternalChannelOffloader(o ChannelOffloader) allocation.ChannelOffloader {
+	if o == nil {
+		return nil
+	}
+	return internalChannelOffloader{o}
+}
+
+func (o internalChannelOffloader) Offload(flow allocation.ChannelFlow) error {
+	return o.offloader.Offload(channelFlow(flow))
+}
+
+func (o internalChannelOffloader) Remove(flow allocation.ChannelFlow) error {
+	return o.offloader.Remove(channelFlow(flow))
+}
+
+func channelFlow(f allocation.ChannelFlow) ChannelFlow {
+	return ChannelFlow{
+		ClientAddr: f.ClientAddr,
+		ServerAddr: f.ServerAddr,
+		RelayAddr:  f.RelayAddr,
+		PeerAddr:   f.Peer,
+		Number:     uint16(f.Number),
+	}
+}
+
+// XDPChannelOffloaderConfig configures an XDPChannelOffloader
+type XDPChannelOffloaderConfig struct {
+	// PinPath is the directory the maps of the loaded XDP program are pinned in, e.g.
+	// /sys/fs/bpf/turn
+	PinPath string
+}
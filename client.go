@@ -4,11 +4,16 @@
 package turn
 
 import (
+	"context"
 	b64 "encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
@@ -23,6 +28,12 @@ const (
 	defaultRTO        = 200 * time.Millisecond
 	maxRtxCount       = 7              // Total 7 requests (Rc)
 	maxDataBufferSize = math.MaxUint16 // Message size limit for Chromium
+	defaultMaxRTO     = 1600 * time.Millisecond
+	minAdaptiveRTO    = 10 * time.Millisecond
+
+	maxReallocateAttempts = 5
+	maxRedirects          = 3           // 300 (Try Alternate) responses followed per Allocate
+	reallocateBackoff     = time.Second // Doubled after every failed attempt
 )
 
 //              interval [msec]
@@ -42,25 +53,154 @@ type ClientConfig struct {
 	Username       string
 	Password       string
 	Realm          string
-	Software       string
+	Software       string // SOFTWARE attribute of every request
 	RTO            time.Duration
 	Conn           net.PacketConn // Listening socket (net.PacketConn)
 	Net            transport.Net
 	LoggerFactory  logging.LoggerFactory
+
+	// AutoReallocate enables transparent recovery of the UDP allocation. When refreshing it
+	// fails, or the Conn breaks while listening, the client re-allocates and re-creates the
+	// permissions and channel bindings of the net.PacketConn returned by Allocate, which
+	// keeps working with a new relayed address.
+	AutoReallocate bool
+
+	// Redial replaces Conn after it broke, or when the server still holds the lost
+	// allocation for its 5-tuple. Optional. Client.Close must be called before closing
+	// Conn, or else a closed Conn is redialed.
+	Redial func() (net.PacketConn, error)
+
+	// OnReallocated is called with the new relayed address after a recovery, or with the
+	// error that made the client give up. Optional.
+	OnReallocated func(relayedAddr net.Addr, err error)
+
+	// OnRelayedAddressChanged is called when recovering the UDP allocation yielded another
+	// relayed address, so ICE layers can restart with fresh candidates. Optional.
+	OnRelayedAddressChanged func(oldAddr, newAddr net.Addr)
+
+	// OnAllocationLost is called when an allocation is deemed dead: refreshing it failed,
+	// and it is not recovered because AutoReallocate is off or gave up. Optional.
+	OnAllocationLost func(relayedAddr net.Addr, err error)
+
+	// Optional callbacks for the lifecycle of allocations. OnAllocationExpired is called when
+	// a refresh fails and the allocation is gone on the server. OnPermissionFailure is called
+	// for every peer whose CreatePermission request failed.
+	OnAllocationCreated   func(relayedAddr net.Addr, lifetime time.Duration)
+	OnAllocationRefreshed func(relayedAddr net.Addr, lifetime time.Duration)
+	OnAllocationExpired   func(relayedAddr net.Addr)
+	OnPermissionFailure   func(peer net.Addr, err error)
+
+	// OnServerError is called for every error response of the server, like 438 (Stale Nonce),
+	// 486 (Allocation Quota Reached) or 508 (Insufficient Capacity). The 401 (Unauthorized)
+	// challenge answering the first unauthenticated Allocate request is not reported.
+	OnServerError func(method stun.Method, code stun.ErrorCode)
+
+	// OnRedirected is called with the server an allocation was made at after following
+	// 300 (Try Alternate) responses to Allocate requests. The client keeps using that server.
+	OnRedirected func(server net.Addr)
+
+	// TURNServerAddrs are fallback TURN servers, as addresses or "turn:" URIs (e.g.
+	// "turn:turn2.abc.com:3478"). When an allocation fails at a server, the next one is
+	// tried. The server of the last successful allocation is tried first, and servers
+	// that failed are tried after those that did not.
+	// TURNServerAddr may be a URI too. The SRV records of a URI without port, like
+	// "turn:abc.com?transport=tcp", are looked up with Resolver (_turn._udp, _turn._tcp or
+	// _turns._tcp), and every target becomes a server, in order of priority and weight.
+	TURNServerAddrs []string
+	Resolver        SRVResolver // Optional, net.DefaultResolver by default
+
+	// CredentialsProvider replaces Username and Password. It is called for the realm of
+	// the server whenever it answers with 401 (Unauthorized), or with 438 (Stale Nonce) to
+	// a request of an allocation, so short-lived credentials, like those of a TURN REST
+	// API, are rotated without creating a new client or allocation. Optional.
+	CredentialsProvider func(realm string) (username, password string)
+
+	// RequestAttributes are added to every request of the client, after SOFTWARE. Some
+	// deployments use custom attributes for version gating or diagnostics. Optional.
+	RequestAttributes []stun.Setter
+
+	// Metrics receives the counters and gauges of the client, to export them. Optional.
+	Metrics ClientMetrics
+
+	// RelayAddressFamily selects the family of the relayed transport addresses, IPv4 by default.
+	RelayAddressFamily RelayAddressFamily
+
+	// OnAllocationExpiring is called ExpiryWarning before the allocation expires, which only
+	// happens if refreshing it failed or stopped. ExpiryWarning defaults to a quarter of the
+	// lifetime, which is after the refresh at half of the lifetime.
+	OnAllocationExpiring func(relayedAddr net.Addr, remaining time.Duration)
+	ExpiryWarning        time.Duration
+
+	// AllocateTimeout bounds Allocate and AllocateTCP, including the authentication round
+	// trip. Zero means the operation only ends when its transactions do.
+	AllocateTimeout time.Duration
+
+	// TransactionTimeout bounds every transaction, including its retransmissions. Zero means
+	// a transaction fails only after all retransmissions went unanswered.
+	TransactionTimeout time.Duration
+
+	// RetryBudget is how often a refresh, CreatePermission or ChannelBind request is retried
+	// after a recoverable error, like 438 (Stale Nonce). Defaults to 3.
+	RetryBudget int
+
+	// Retransmission policy, see https://datatracker.ietf.org/doc/html/rfc8489#section-6.2.1
+	// The RTO (default 200ms) is multiplied by RTOMultiplier (default 2) after every
+	// retransmission, up to MaxRTO (default 1.6s). A transaction fails when none of its
+	// MaxRequests (Rc, default 7) requests was answered. If FinalRTOMultiplier (Rm) is set,
+	// the response to the last request is waited for Rm times the RTO.
+	RTOMultiplier      float64
+	MaxRTO             time.Duration
+	MaxRequests        int
+	FinalRTOMultiplier int
+
+	// AdaptiveRTO derives the RTO from the measured round trip times, as TCP does, starting
+	// with RTO. Only transactions answered without a retransmission are measured.
+	AdaptiveRTO bool
+
+	// Keepalive and refresh schedule of allocations. If KeepaliveInterval is set, Binding
+	// requests are sent to the TURN server at that interval to keep NAT bindings open. It
+	// is zero by default, as outer layers like ICE usually send keepalives themselves.
+	// Allocations are refreshed every RefreshInterval, half of the lifetime by default, and
+	// permissions every PermissionRefreshInterval, 2 minutes by default. Every interval is
+	// shortened by a random share of up to RefreshJitter (0 to 1), so refreshes of many
+	// clients started at once spread out.
+	KeepaliveInterval         time.Duration
+	RefreshInterval           time.Duration
+	PermissionRefreshInterval time.Duration
+	RefreshJitter             float64
+
+	// OnServerUnresponsive is called when a transaction to a server was not answered, after
+	// all its retransmissions or TransactionTimeout, while the previous one was. It is not
+	// called again before the client receives a response. Optional.
+	OnServerUnresponsive func(server net.Addr)
+
+	// ReceiveQueueSize is how many packets from peers the UDP allocation queues until the
+	// application reads them, 1024 by default. Packets arriving while the queue is full are
+	// dropped and counted in ReceiveStats.
+	ReceiveQueueSize int
+
+	// CloseTimeout makes closing an allocation graceful: Close waits up to CloseTimeout for
+	// writes in flight to complete, and for the server to confirm that the allocation was
+	// freed by a Refresh with lifetime 0. By default, the Refresh is sent without waiting.
+	// CloseContext on the relayed conn does the same until its context is done.
+	CloseTimeout time.Duration
+
+	// NATTestTimeout is how long DetectNATBehavior waits for the response to each of its
+	// tests, 3 seconds by default. Some tests are expected to go unanswered.
+	NATTestTimeout time.Duration
 }
 
 // Client is a STUN server client
 type Client struct {
-	conn           net.PacketConn // Read-only
+	conn           net.PacketConn // Protected by mutex
 	net            transport.Net  // Read-only
 	stunServerAddr net.Addr       // Read-only
-	turnServerAddr net.Addr       // Read-only
+	turnServerAddr net.Addr       // Protected by mutex, changed by redirects and failover
 
-	username      stun.Username          // Read-only
-	password      string                 // Read-only
+	username      stun.Username          // Protected by mutex, rotated by credentialsProvider
+	password      string                 // Protected by mutex, rotated by credentialsProvider
 	realm         stun.Realm             // Read-only
 	integrity     stun.MessageIntegrity  // Read-only
-	software      stun.Software          // Read-only
 	trMap         *client.TransactionMap // Thread-safe
 	rto           time.Duration          // Read-only
 	relayedConn   *client.UDPConn        // Protected by mutex ***
@@ -70,8 +210,115 @@ type Client struct {
 	mutex         sync.RWMutex           // Thread-safe
 	mutexTrMap    sync.Mutex             // Thread-safe
 	log           logging.LeveledLogger  // Read-only
+
+	autoReallocate bool                                  // Read-only
+	redial         func() (net.PacketConn, error)        // Read-only
+	onReallocated  func(relayedAddr net.Addr, err error) // Read-only
+	reallocTryLock client.TryLock                        // Thread-safe
+	closed         atomic.Bool                           // Thread-safe
+
+	onRelayedAddressChanged func(oldAddr, newAddr net.Addr)       // Read-only
+	onAllocationLost        func(relayedAddr net.Addr, err error) // Read-only
+
+	onAllocationCreated   func(relayedAddr net.Addr, lifetime time.Duration) // Read-only
+	onAllocationRefreshed func(relayedAddr net.Addr, lifetime time.Duration) // Read-only
+	onAllocationExpired   func(relayedAddr net.Addr)                         // Read-only
+	onPermissionFailure   func(peer net.Addr, err error)                     // Read-only
+	onServerError         func(method stun.Method, code stun.ErrorCode)      // Read-only
+
+	onAllocationExpiring func(relayedAddr net.Addr, remaining time.Duration) // Read-only
+	onRedirected         func(server net.Addr)                               // Read-only
+	expiryWarning        time.Duration                                       // Read-only
+
+	relayAddressFamily    RelayAddressFamily // Read-only
+	additionalRelayedAddr net.Addr           // Protected by mutex
+	mappedAddr            net.Addr           // Protected by mutex
+
+	turnServers    []net.Addr           // Read-only
+	serverFailures map[string]time.Time // Protected by mutex
+
+	metrics        ClientMetrics // Read-only
+	requestSetters []stun.Setter // Read-only, SOFTWARE and RequestAttributes
+
+	credentialsProvider func(realm string) (username, password string) // Read-only
+
+	allocateTimeout    time.Duration // Read-only
+	transactionTimeout time.Duration // Read-only
+	retryBudget        int           // Read-only
+
+	rtoMultiplier      float64              // Read-only
+	maxRTO             time.Duration        // Read-only
+	maxRequests        int                  // Read-only
+	finalRTOMultiplier int                  // Read-only
+	rtoEstimator       *client.RTOEstimator // Thread-safe, only sets the RTO if adaptiveRTO
+	adaptiveRTO        bool                 // Read-only
+
+	latestRTT            atomic.Int64          // Thread-safe, in nanoseconds
+	requests             atomic.Int64          // Thread-safe
+	retransmissions      atomic.Int64          // Thread-safe
+	responses            atomic.Int64          // Thread-safe
+	timeouts             atomic.Int64          // Thread-safe
+	unresponsive         atomic.Bool           // Thread-safe
+	onServerUnresponsive func(server net.Addr) // Read-only
+
+	keepaliveInterval         time.Duration // Read-only
+	refreshInterval           time.Duration // Read-only
+	permissionRefreshInterval time.Duration // Read-only
+	refreshJitter             float64       // Read-only
+	receiveQueueSize          int           // Read-only
+	closeTimeout              time.Duration // Read-only
+	natTestTimeout            time.Duration // Read-only
+
+	dataHandler      DataHandler            // Protected by mutex
+	peerDataHandlers map[string]DataHandler // Protected by mutex
+	nextProbeID      atomic.Uint32          // Thread-safe
+}
+
+// RelayAddressFamily is the family of the relayed transport addresses requested by
+// the client, see https://datatracker.ietf.org/doc/html/rfc8656#section-7.1
+type RelayAddressFamily int
+
+// RelayAddressFamily values
+const (
+	RelayAddressFamilyIPv4 RelayAddressFamily = iota
+	RelayAddressFamilyIPv6
+	// RelayAddressFamilyDual requests an IPv4 and an additional IPv6 relayed transport
+	// address, which is returned by Client.AdditionalRelayedAddr.
+	RelayAddressFamilyDual
+)
+
+// ClientMetrics receives the counters and gauges of a Client. Its methods are
+// called concurrently from the goroutines of the client and must not block.
+type ClientMetrics interface {
+	// TransactionSent is called for every request sent, not counting retransmissions
+	TransactionSent(method stun.Method)
+	// TransactionRetransmitted is called for every retransmission of a request
+	TransactionRetransmitted(method stun.Method)
+	// AllocationFailed is called when an allocation at a server failed, with the
+	// code of its error response, or 0 if it sent none
+	AllocationFailed(code stun.ErrorCode)
+	// BytesSent and BytesReceived are called with the size of every payload relayed
+	// to and from peers through the UDP allocation
+	BytesSent(n int)
+	BytesReceived(n int)
+	// Channels is called with the number of channels of the UDP allocation whenever
+	// it changes, and with 0 when the allocation is closed
+	Channels(n int)
 }
 
+type nopClientMetrics struct{}
+
+func (nopClientMetrics) TransactionSent(stun.Method)          {}
+func (nopClientMetrics) TransactionRetransmitted(stun.Method) {}
+func (nopClientMetrics) AllocationFailed(stun.ErrorCode)      {}
+func (nopClientMetrics) BytesSent(int)                        {}
+func (nopClientMetrics) BytesReceived(int)                    {}
+func (nopClientMetrics) Channels(int)                         {}
+
+// DataHandler handles data relayed from a peer. The payload is only valid until
+// the handler returns
+type DataHandler func(peer net.Addr, payload []byte)
+
 // NewClient returns a new Client instance. listeningAddress is the address and port to listen on, default "0.0.0.0:0"
 func NewClient(config *ClientConfig) (*Client, error) {
 	loggerFactory := config.LoggerFactory
@@ -85,11 +332,61 @@ func NewClient(config *ClientConfig) (*Client, error) {
 		return nil, errNilConn
 	}
 
+	if config.AllocateTimeout < 0 || config.TransactionTimeout < 0 || config.RetryBudget < 0 ||
+		config.ExpiryWarning < 0 || config.CloseTimeout < 0 || config.NATTestTimeout < 0 {
+		return nil, errInvalidClientTimeout
+	}
+
+	if (config.RTOMultiplier != 0 && config.RTOMultiplier < 1) || config.MaxRTO < 0 ||
+		config.MaxRequests < 0 || config.FinalRTOMultiplier < 0 {
+		return nil, errInvalidRetransmission
+	}
+
+	if config.KeepaliveInterval < 0 || config.RefreshInterval < 0 || config.PermissionRefreshInterval < 0 {
+		return nil, errInvalidClientTimeout
+	}
+
+	if config.RefreshJitter < 0 || config.RefreshJitter >= 1 {
+		return nil, errInvalidRefreshJitter
+	}
+
+	if config.ReceiveQueueSize < 0 {
+		return nil, errInvalidReceiveQueueSize
+	}
+
 	rto := defaultRTO
 	if config.RTO > 0 {
 		rto = config.RTO
 	}
 
+	natTestTimeout := defaultNATTestTimeout
+	if config.NATTestTimeout > 0 {
+		natTestTimeout = config.NATTestTimeout
+	}
+
+	maxRTO := defaultMaxRTO
+	if config.MaxRTO > 0 {
+		maxRTO = config.MaxRTO
+	}
+
+	maxRequests := maxRtxCount
+	if config.MaxRequests > 0 {
+		maxRequests = config.MaxRequests
+	}
+
+	var requestSetters []stun.Setter
+	if len(config.Software) > 0 {
+		requestSetters = append(requestSetters, stun.NewSoftware(config.Software))
+	}
+	requestSetters = append(requestSetters, config.RequestAttributes...)
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = nopClientMetrics{}
+	}
+
+	rtoEstimator := client.NewRTOEstimator(rto, minAdaptiveRTO, maxRTO)
+
 	if config.Net == nil {
 		n, err := stdnet.NewNet()
 		if err != nil {
@@ -110,13 +407,26 @@ func NewClient(config *ClientConfig) (*Client, error) {
 		log.Debugf("Resolved STUN server %s to %s", config.STUNServerAddr, stunServ)
 	}
 
-	if len(config.TURNServerAddr) > 0 {
-		turnServ, err = config.Net.ResolveUDPAddr("udp4", config.TURNServerAddr)
+	if config.Resolver == nil {
+		config.Resolver = net.DefaultResolver
+	}
+	resolver := &turnResolver{net: config.Net, resolver: config.Resolver, log: log}
+
+	var turnServers []net.Addr
+	for _, addr := range append([]string{config.TURNServerAddr}, config.TURNServerAddrs...) {
+		if len(addr) == 0 {
+			continue
+		}
+		servers, err := resolver.resolve(context.Background(), addr)
 		if err != nil {
 			return nil, err
 		}
 
-		log.Debugf("Resolved TURN server %s to %s", config.TURNServerAddr, turnServ)
+		log.Debugf("Resolved TURN server %s to %s", addr, servers)
+		turnServers = append(turnServers, servers...)
+	}
+	if len(turnServers) > 0 {
+		turnServ = turnServers[0]
 	}
 
 	c := &Client{
@@ -126,11 +436,52 @@ func NewClient(config *ClientConfig) (*Client, error) {
 		username:       stun.NewUsername(config.Username),
 		password:       config.Password,
 		realm:          stun.NewRealm(config.Realm),
-		software:       stun.NewSoftware(config.Software),
 		trMap:          client.NewTransactionMap(),
 		net:            config.Net,
 		rto:            rto,
 		log:            log,
+		autoReallocate: config.AutoReallocate,
+		redial:         config.Redial,
+		onReallocated:  config.OnReallocated,
+
+		onRelayedAddressChanged: config.OnRelayedAddressChanged,
+		onAllocationLost:        config.OnAllocationLost,
+
+		onAllocationCreated:   config.OnAllocationCreated,
+		onAllocationRefreshed: config.OnAllocationRefreshed,
+		onAllocationExpired:   config.OnAllocationExpired,
+		onPermissionFailure:   config.OnPermissionFailure,
+		onServerError:         config.OnServerError,
+		onAllocationExpiring:  config.OnAllocationExpiring,
+		expiryWarning:         config.ExpiryWarning,
+		onRedirected:          config.OnRedirected,
+		relayAddressFamily:    config.RelayAddressFamily,
+		turnServers:           turnServers,
+		serverFailures:        map[string]time.Time{},
+		metrics:               metrics,
+		requestSetters:        requestSetters,
+		credentialsProvider:   config.CredentialsProvider,
+
+		allocateTimeout:    config.AllocateTimeout,
+		transactionTimeout: config.TransactionTimeout,
+		retryBudget:        config.RetryBudget,
+
+		rtoMultiplier:      config.RTOMultiplier,
+		maxRTO:             maxRTO,
+		maxRequests:        maxRequests,
+		finalRTOMultiplier: config.FinalRTOMultiplier,
+		rtoEstimator:       rtoEstimator,
+		adaptiveRTO:        config.AdaptiveRTO,
+
+		onServerUnresponsive: config.OnServerUnresponsive,
+
+		keepaliveInterval:         config.KeepaliveInterval,
+		refreshInterval:           config.RefreshInterval,
+		permissionRefreshInterval: config.PermissionRefreshInterval,
+		refreshJitter:             config.RefreshJitter,
+		receiveQueueSize:          config.ReceiveQueueSize,
+		closeTimeout:              config.CloseTimeout,
+		natTestTimeout:            natTestTimeout,
 	}
 
 	return c, nil
@@ -138,6 +489,9 @@ func NewClient(config *ClientConfig) (*Client, error) {
 
 // TURNServerAddr return the TURN server address
 func (c *Client) TURNServerAddr() net.Addr {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
 	return c.turnServerAddr
 }
 
@@ -148,7 +502,23 @@ func (c *Client) STUNServerAddr() net.Addr {
 
 // Username returns username
 func (c *Client) Username() stun.Username {
-	return c.username
+	username, _ := c.credentials()
+	return username
+}
+
+func (c *Client) credentials() (stun.Username, string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.username, c.password
+}
+
+func (c *Client) setCredentials(username, password string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.username = stun.NewUsername(username)
+	c.password = password
 }
 
 // Realm return realm
@@ -158,7 +528,46 @@ func (c *Client) Realm() stun.Realm {
 
 // WriteTo sends data to the specified destination using the base socket.
 func (c *Client) WriteTo(data []byte, to net.Addr) (int, error) {
-	return c.conn.WriteTo(data, to)
+	return c.packetConn().WriteTo(data, to)
+}
+
+// WriteBuffersTo sends a packet gathered from bufs to the given address. If the
+// Conn supports vectored writes, like a STUNConn over TCP, the buffers are written
+// at once. Otherwise they are joined in a pooled buffer first, as the standard
+// library has no vectored WriteTo for UDP sockets.
+func (c *Client) WriteBuffersTo(bufs net.Buffers, to net.Addr) (int, error) {
+	conn := c.packetConn()
+	if bw, ok := conn.(client.BuffersWriter); ok {
+		return bw.WriteBuffersTo(bufs, to)
+	}
+
+	buf := getWriteBuffer()
+	defer putWriteBuffer(buf)
+	for _, b := range bufs {
+		*buf = append(*buf, b...)
+	}
+	return conn.WriteTo(*buf, to)
+}
+
+// writeBuffers are reused to join vectored writes to a Conn that doesn't support them
+var writeBuffers = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any {
+		buf := make([]byte, 0, 1500)
+		return &buf
+	},
+}
+
+func getWriteBuffer() *[]byte {
+	buf, _ := writeBuffers.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putWriteBuffer(buf *[]byte) {
+	// Don't keep buffers of oversized packets around
+	if cap(*buf) <= maxDataBufferSize {
+		writeBuffers.Put(buf)
+	}
 }
 
 // Listen will have this client start listening on the conn provided via the config.
@@ -172,8 +581,18 @@ func (c *Client) Listen() error {
 	go func() {
 		buf := make([]byte, maxDataBufferSize)
 		for {
-			n, from, err := c.conn.ReadFrom(buf)
+			conn := c.packetConn()
+			n, from, err := conn.ReadFrom(buf)
 			if err != nil {
+				if c.redial != nil && !c.closed.Load() {
+					var replaced bool
+					if replaced, err = c.replaceConn(conn); err == nil {
+						if replaced && c.autoReallocate {
+							go c.reallocate(errConnBroken)
+						}
+						continue
+					}
+				}
 				c.log.Debugf("Failed to read: %s. Exiting loop", err)
 				break
 			}
@@ -193,6 +612,8 @@ func (c *Client) Listen() error {
 
 // Close closes this client
 func (c *Client) Close() {
+	c.closed.Store(true)
+
 	c.mutexTrMap.Lock()
 	defer c.mutexTrMap.Unlock()
 
@@ -203,16 +624,17 @@ func (c *Client) Close() {
 
 // SendBindingRequestTo sends a new STUN request to the given transport address
 func (c *Client) SendBindingRequestTo(to net.Addr) (net.Addr, error) {
-	attrs := []stun.Setter{stun.TransactionID, stun.BindingRequest}
-	if len(c.software) > 0 {
-		attrs = append(attrs, c.software)
-	}
+	return c.SendBindingRequestToContext(context.Background(), to)
+}
 
+// SendBindingRequestToContext is SendBindingRequestTo, giving up once the context is done
+func (c *Client) SendBindingRequestToContext(ctx context.Context, to net.Addr) (net.Addr, error) {
+	attrs := append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, c.requestSetters...)
 	msg, err := stun.Build(attrs...)
 	if err != nil {
 		return nil, err
 	}
-	trRes, err := c.PerformTransaction(msg, to, false)
+	trRes, err := c.PerformTransactionContext(ctx, msg, to, false)
 	if err != nil {
 		return nil, err
 	}
@@ -230,88 +652,411 @@ func (c *Client) SendBindingRequestTo(to net.Addr) (net.Addr, error) {
 
 // SendBindingRequest sends a new STUN request to the STUN server
 func (c *Client) SendBindingRequest() (net.Addr, error) {
+	return c.SendBindingRequestContext(context.Background())
+}
+
+// SendBindingRequestContext is SendBindingRequest, giving up once the context is done
+func (c *Client) SendBindingRequestContext(ctx context.Context) (net.Addr, error) {
 	if c.stunServerAddr == nil {
 		return nil, errSTUNServerAddressNotSet
 	}
-	return c.SendBindingRequestTo(c.stunServerAddr)
+	return c.SendBindingRequestToContext(ctx, c.stunServerAddr)
 }
 
-func (c *Client) sendAllocateRequest(protocol proto.Protocol) (proto.RelayedAddress, proto.Lifetime, stun.Nonce, error) {
+// sendAllocateRequest allocates at the TURN server, following 300 (Try Alternate)
+// responses to other servers. After a redirect the client keeps using the server
+// the allocation was made at.
+func (c *Client) sendAllocateRequest(ctx context.Context, protocol proto.Protocol, opts allocateOptions) (proto.RelayedAddress,
+	proto.Lifetime, stun.Nonce, error,
+) {
+	servers := c.rankTURNServers()
+	if len(servers) == 0 {
+		return proto.RelayedAddress{}, proto.Lifetime{}, nil, errTURNServerAddressNotSet
+	}
+
+	mapped := mappedAddress{protocol: protocol}
+	opts.getters = append([]stun.Getter{&mapped}, opts.getters...)
+
 	var relayed proto.RelayedAddress
 	var lifetime proto.Lifetime
 	var nonce stun.Nonce
+	var err error
+	for i, server := range servers {
+		var final net.Addr
+		relayed, lifetime, nonce, final, err = c.allocateWithRedirects(ctx, server, protocol, opts)
+		if err == nil {
+			c.setServerHealthy(server, final)
+			c.setMappedAddress(mapped.addr)
+			if i > 0 {
+				c.log.Infof("Failed over to TURN server %s", final)
+			}
+			return relayed, lifetime, nonce, nil
+		}
+		var code stun.ErrorCode
+		var allocErr *allocateError
+		if errors.As(err, &allocErr) {
+			code = allocErr.code.Code
+		}
+		c.metrics.AllocationFailed(code)
+		if ctx.Err() != nil {
+			break
+		}
+
+		c.setServerFailed(server)
+		if i < len(servers)-1 {
+			c.log.Warnf("Failed to allocate at TURN server %s: %s", server, err)
+		}
+	}
+	return relayed, lifetime, nonce, err
+}
+
+// rankTURNServers orders the TURN servers to try: the current one first, then the
+// configured ones, where those that never failed come before the others and
+// failed servers are ordered by the time of their last failure
+func (c *Client) rankTURNServers() []net.Addr {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	msg, err := stun.Build(
+	var servers []net.Addr
+	if c.turnServerAddr != nil {
+		servers = append(servers, c.turnServerAddr)
+	}
+	for _, server := range c.turnServers {
+		if c.turnServerAddr == nil || server.String() != c.turnServerAddr.String() {
+			servers = append(servers, server)
+		}
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		failedI, okI := c.serverFailures[servers[i].String()]
+		failedJ, okJ := c.serverFailures[servers[j].String()]
+		if okI != okJ {
+			return okJ
+		}
+		return okI && failedI.Before(failedJ)
+	})
+	return servers
+}
+
+// setServerHealthy makes the server that allocated, possibly after redirects, the current one
+func (c *Client) setServerHealthy(server, final net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.serverFailures, server.String())
+	delete(c.serverFailures, final.String())
+	c.turnServerAddr = final
+}
+
+func (c *Client) setServerFailed(server net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.serverFailures[server.String()] = time.Now()
+}
+
+// allocateWithRedirects allocates at the server, following 300 (Try Alternate)
+// responses, and returns the server the allocation was made at
+func (c *Client) allocateWithRedirects(ctx context.Context, server net.Addr, protocol proto.Protocol,
+	opts allocateOptions,
+) (proto.RelayedAddress, proto.Lifetime, stun.Nonce, net.Addr, error) {
+	var additional additionalRelayedAddress
+	switch c.relayAddressFamily {
+	case RelayAddressFamilyIPv6:
+		opts.setters = append([]stun.Setter{proto.RequestedFamilyIPv6}, opts.setters...)
+	case RelayAddressFamilyDual:
+		opts.setters = append([]stun.Setter{proto.AdditionalAddressFamily(proto.RequestedFamilyIPv6)}, opts.setters...)
+		opts.getters = append([]stun.Getter{&additional}, opts.getters...)
+	}
+	visited := map[string]bool{server.String(): true}
+	for redirects := 0; ; redirects++ {
+		relayed, lifetime, nonce, alternate, err := c.allocateAt(ctx, server, protocol, opts)
+		if alternate == nil {
+			if err == nil && c.relayAddressFamily == RelayAddressFamilyDual {
+				if additional.addr == nil {
+					c.log.Warnf("No additional relayed address allocated: %s", additional.errorCode)
+				}
+				c.setAdditionalRelayedAddr(additional.addr)
+			}
+			if err == nil && redirects > 0 {
+				c.log.Infof("Redirected to TURN server %s", server)
+				if c.onRedirected != nil {
+					c.onRedirected(server)
+				}
+			}
+			return relayed, lifetime, nonce, server, err
+		}
+
+		if redirects == maxRedirects || visited[alternate.String()] {
+			return relayed, lifetime, nonce, nil, fmt.Errorf("%w: %s", errRedirectLoop, alternate)
+		}
+		c.log.Debugf("TURN server %s redirected to %s", server, alternate)
+		visited[alternate.String()] = true
+		server = alternate
+	}
+}
+
+// allocateOptions are the optional attributes of Allocate requests, and those
+// read from the success response
+type allocateOptions struct {
+	setters []stun.Setter
+	getters []stun.Getter
+}
+
+// allocateAt sends the Allocate requests to the server. If the server redirects,
+// it returns the alternate server with errTryAlternate
+func (c *Client) allocateAt(ctx context.Context, server net.Addr, protocol proto.Protocol, opts allocateOptions) (proto.RelayedAddress,
+	proto.Lifetime, stun.Nonce, net.Addr, error,
+) {
+	var relayed proto.RelayedAddress
+	var lifetime proto.Lifetime
+	var nonce stun.Nonce
+
+	setters := append([]stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
 		proto.RequestedTransport{Protocol: protocol},
-		stun.Fingerprint,
-	)
+	}, opts.setters...)
+	setters = append(setters, c.requestSetters...)
+	msg, err := stun.Build(append(setters, stun.Fingerprint)...)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return relayed, lifetime, nonce, nil, err
 	}
 
-	trRes, err := c.PerformTransaction(msg, c.turnServerAddr, false)
+	// The 401 challenge is expected, don't report it
+	trRes, err := c.performTransaction(ctx, msg, server, false, false)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return relayed, lifetime, nonce, nil, err
 	}
 
 	res := trRes.Msg
+	if alternate := alternateServer(res); alternate != nil {
+		return relayed, lifetime, nonce, alternate, errTryAlternate
+	}
+
+	// A server granting guest allocations does not challenge
+	if res.Type.Class == stun.ClassSuccessResponse {
+		c.log.Debugf("Allocated without credentials at %s", server)
+		err = readAllocateResponse(res, &relayed, &lifetime, opts.getters)
+		return relayed, lifetime, nonce, nil, err
+	}
 
 	// Anonymous allocate failed, trying to authenticate.
 	if err = nonce.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+		var code stun.ErrorCodeAttribute
+		if res.Type.Class == stun.ClassErrorResponse && code.GetFrom(res) == nil {
+			return relayed, lifetime, nonce, nil, &allocateError{msgType: res.Type, code: code}
+		}
+		return relayed, lifetime, nonce, nil, err
 	}
 	if err = c.realm.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+		return relayed, lifetime, nonce, nil, err
 	}
 	c.realm = append([]byte(nil), c.realm...)
+	if c.credentialsProvider != nil {
+		c.setCredentials(c.credentialsProvider(c.realm.String()))
+	}
+	username, password := c.credentials()
 	c.integrity = stun.NewLongTermIntegrity(
-		c.username.String(), c.realm.String(), c.password,
+		username.String(), c.realm.String(), password,
 	)
 	// Trying to authorize.
-	msg, err = stun.Build(
-		stun.TransactionID,
-		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
-		proto.RequestedTransport{Protocol: protocol},
-		&c.username,
+	msg, err = stun.Build(append(setters,
+		&username,
 		&c.realm,
 		&nonce,
 		&c.integrity,
 		stun.Fingerprint,
-	)
+	)...)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return relayed, lifetime, nonce, nil, err
 	}
 
-	trRes, err = c.PerformTransaction(msg, c.turnServerAddr, false)
+	trRes, err = c.PerformTransactionContext(ctx, msg, server, false)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return relayed, lifetime, nonce, nil, err
 	}
 	res = trRes.Msg
 
+	if alternate := alternateServer(res); alternate != nil {
+		return relayed, lifetime, nonce, alternate, errTryAlternate
+	}
 	if res.Type.Class == stun.ClassErrorResponse {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
-			return relayed, lifetime, nonce, fmt.Errorf("%s (error %s)", res.Type, code) //nolint:goerr113
+			return relayed, lifetime, nonce, nil, &allocateError{msgType: res.Type, code: code}
 		}
-		return relayed, lifetime, nonce, fmt.Errorf("%s", res.Type) //nolint:goerr113
+		return relayed, lifetime, nonce, nil, fmt.Errorf("%s", res.Type) //nolint:goerr113
 	}
 
+	err = readAllocateResponse(res, &relayed, &lifetime, opts.getters)
+	return relayed, lifetime, nonce, nil, err
+}
+
+// readAllocateResponse gets the relayed address, lifetime and the optional
+// attributes from an Allocate success response
+func readAllocateResponse(res *stun.Message, relayed *proto.RelayedAddress, lifetime *proto.Lifetime, getters []stun.Getter) error {
 	// Getting relayed addresses from response.
 	if err := relayed.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+		return err
 	}
 
 	// Getting lifetime from response
 	if err := lifetime.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+		return err
+	}
+
+	for _, getter := range getters {
+		if err := getter.GetFrom(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mappedAddress gets the optional XOR-MAPPED-ADDRESS of an Allocate response
+type mappedAddress struct {
+	protocol proto.Protocol
+	addr     net.Addr
+}
+
+func (a *mappedAddress) GetFrom(m *stun.Message) error {
+	a.addr = nil
+	var mapped stun.XORMappedAddress
+	if err := mapped.GetFrom(m); err != nil {
+		if errors.Is(err, stun.ErrAttributeNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if a.protocol == proto.ProtoTCP {
+		a.addr = &net.TCPAddr{IP: mapped.IP, Port: mapped.Port}
+	} else {
+		a.addr = &net.UDPAddr{IP: mapped.IP, Port: mapped.Port}
+	}
+	return nil
+}
+
+// allocateError is an error response to an Allocate request
+type allocateError struct {
+	msgType stun.MessageType
+	code    stun.ErrorCodeAttribute
+}
+
+func (e *allocateError) Error() string {
+	return fmt.Sprintf("%s (error %s)", e.msgType, e.code)
+}
+
+// additionalRelayedAddress gets the second XOR-RELAYED-ADDRESS of a response to
+// an Allocate request with ADDITIONAL-ADDRESS-FAMILY, or the ADDRESS-ERROR-CODE
+// explaining its absence
+type additionalRelayedAddress struct {
+	addr      net.Addr
+	errorCode proto.AddressErrorCode
+}
+
+func (a *additionalRelayedAddress) GetFrom(m *stun.Message) error {
+	a.addr = nil
+	n := 0
+	if err := m.ForEach(stun.AttrXORRelayedAddress, func(m *stun.Message) error {
+		if n++; n != 2 {
+			return nil
+		}
+		var relayed proto.RelayedAddress
+		if err := relayed.GetFrom(m); err != nil {
+			return err
+		}
+		a.addr = &net.UDPAddr{
+			IP:   relayed.IP,
+			Port: relayed.Port,
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if a.addr == nil {
+		_ = a.errorCode.GetFrom(m) // Optional
+	}
+	return nil
+}
+
+// alternateServer returns the ALTERNATE-SERVER of a 300 (Try Alternate) response
+func alternateServer(res *stun.Message) net.Addr {
+	var code stun.ErrorCodeAttribute
+	if res.Type.Class != stun.ClassErrorResponse || code.GetFrom(res) != nil || code.Code != stun.CodeTryAlternate {
+		return nil
+	}
+
+	var alternate stun.AlternateServer
+	if err := alternate.GetFrom(res); err != nil {
+		return nil
+	}
+	return &net.UDPAddr{
+		IP:   alternate.IP,
+		Port: alternate.Port,
 	}
-	return relayed, lifetime, nonce, nil
 }
 
 // Allocate sends a TURN allocation request to the given transport address
 func (c *Client) Allocate() (net.PacketConn, error) {
+	return c.AllocateContext(context.Background())
+}
+
+// AllocateContext is Allocate, giving up once the context is done
+func (c *Client) AllocateContext(ctx context.Context) (net.PacketConn, error) {
+	return c.allocateUDP(ctx, allocateOptions{})
+}
+
+// AllocateEvenPort allocates a relayed address with an even port. If reserve is set, the
+// server reserves the next higher port and returns the RESERVATION-TOKEN, which another
+// Client passes to AllocateReserved. See AllocateRTPPair.
+func (c *Client) AllocateEvenPort(reserve bool) (net.PacketConn, []byte, error) {
+	var token proto.ReservationToken
+	opts := allocateOptions{
+		setters: []stun.Setter{proto.EvenPort{ReservePort: reserve}},
+	}
+	if reserve {
+		opts.getters = []stun.Getter{&token}
+	}
+
+	relayedConn, err := c.allocateUDP(context.Background(), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return relayedConn, token, nil
+}
+
+// AllocateReserved allocates the relayed address reserved by AllocateEvenPort of another
+// Client. Allocations are bound to the transport address of the Client, so a single Client
+// cannot allocate both.
+func (c *Client) AllocateReserved(token []byte) (net.PacketConn, error) {
+	return c.allocateUDP(context.Background(), allocateOptions{
+		setters: []stun.Setter{proto.ReservationToken(token)},
+	})
+}
+
+// AllocateRTPPair allocates relayed addresses on adjacent ports for RTP and RTCP, as needed
+// by RTP stacks that don't multiplex RTCP: an even port for RTP at this Client and the next
+// higher one for RTCP at rtcpClient, which must use another Conn to the same server.
+func (c *Client) AllocateRTPPair(rtcpClient *Client) (rtp, rtcp net.PacketConn, err error) {
+	rtp, token, err := c.AllocateEvenPort(true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rtcp, err = rtcpClient.AllocateReserved(token); err != nil {
+		rtp.Close() //nolint:errcheck,gosec
+		return nil, nil, err
+	}
+	return rtp, rtcp, nil
+}
+
+func (c *Client) allocateUDP(ctx context.Context, opts allocateOptions) (net.PacketConn, error) {
+	ctx, cancel := c.withAllocateTimeout(ctx)
+	defer cancel()
+
 	if err := c.allocTryLock.Lock(); err != nil {
 		return nil, fmt.Errorf("%w: %s", errOneAllocateOnly, err.Error())
 	}
@@ -322,7 +1067,7 @@ func (c *Client) Allocate() (net.PacketConn, error) {
 		return nil, fmt.Errorf("%w: %s", errAlreadyAllocated, relayedConn.LocalAddr().String())
 	}
 
-	relayed, lifetime, nonce, err := c.sendAllocateRequest(proto.ProtoUDP)
+	relayed, lifetime, nonce, err := c.sendAllocateRequest(ctx, proto.ProtoUDP, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -332,25 +1077,66 @@ func (c *Client) Allocate() (net.PacketConn, error) {
 		Port: relayed.Port,
 	}
 
+	onRefreshFailed := func(err error) {
+		if c.autoReallocate {
+			go c.reallocate(err)
+		} else {
+			c.allocationLost(relayedConn.LocalAddr(), err)
+		}
+	}
+
 	relayedConn = client.NewUDPConn(&client.AllocationConfig{
 		Client:      c,
 		RelayedAddr: relayedAddr,
-		ServerAddr:  c.turnServerAddr,
+		ServerAddr:  c.TURNServerAddr(),
 		Realm:       c.realm,
-		Username:    c.username,
+		Username:    c.Username(),
 		Integrity:   c.integrity,
 		Nonce:       nonce,
 		Lifetime:    lifetime.Duration,
 		Net:         c.net,
 		Log:         c.log,
+		MaxRetries:  c.retryBudget,
+
+		OnRefreshFailed:     onRefreshFailed,
+		OnRefreshed:         c.onAllocationRefreshed,
+		OnExpired:           c.onAllocationExpired,
+		OnPermissionFailure: c.onPermissionFailure,
+		OnExpiring:          c.onAllocationExpiring,
+		ExpiryWarning:       c.expiryWarning,
+		OnData:              c.dispatchData,
+		OnSent:              c.metrics.BytesSent,
+		OnReceived:          c.metrics.BytesReceived,
+		OnChannels:          c.metrics.Channels,
+
+		RefreshInterval:           c.refreshInterval,
+		PermissionRefreshInterval: c.permissionRefreshInterval,
+		KeepaliveInterval:         c.keepaliveInterval,
+		RefreshJitter:             c.refreshJitter,
+		ReadQueueSize:             c.receiveQueueSize,
+		CloseTimeout:              c.closeTimeout,
+		Setters:                   c.requestSetters,
+		CredentialsProvider:       c.credentialsProvider,
 	})
 	c.setRelayedUDPConn(relayedConn)
 
+	if c.onAllocationCreated != nil {
+		c.onAllocationCreated(relayedAddr, lifetime.Duration)
+	}
+
 	return relayedConn, nil
 }
 
 // AllocateTCP creates a new TCP allocation at the TURN server.
 func (c *Client) AllocateTCP() (*client.TCPAllocation, error) {
+	return c.AllocateTCPContext(context.Background())
+}
+
+// AllocateTCPContext is AllocateTCP, giving up once the context is done
+func (c *Client) AllocateTCPContext(ctx context.Context) (*client.TCPAllocation, error) {
+	ctx, cancel := c.withAllocateTimeout(ctx)
+	defer cancel()
+
 	if err := c.allocTryLock.Lock(); err != nil {
 		return nil, fmt.Errorf("%w: %s", errOneAllocateOnly, err.Error())
 	}
@@ -361,7 +1147,7 @@ func (c *Client) AllocateTCP() (*client.TCPAllocation, error) {
 		return nil, fmt.Errorf("%w: %s", errAlreadyAllocated, allocation.Addr())
 	}
 
-	relayed, lifetime, nonce, err := c.sendAllocateRequest(proto.ProtoTCP)
+	relayed, lifetime, nonce, err := c.sendAllocateRequest(ctx, proto.ProtoTCP, allocateOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -374,62 +1160,139 @@ func (c *Client) AllocateTCP() (*client.TCPAllocation, error) {
 	allocation = client.NewTCPAllocation(&client.AllocationConfig{
 		Client:      c,
 		RelayedAddr: relayedAddr,
-		ServerAddr:  c.turnServerAddr,
+		ServerAddr:  c.TURNServerAddr(),
 		Realm:       c.realm,
-		Username:    c.username,
+		Username:    c.Username(),
 		Integrity:   c.integrity,
 		Nonce:       nonce,
 		Lifetime:    lifetime.Duration,
 		Net:         c.net,
 		Log:         c.log,
+		MaxRetries:  c.retryBudget,
+
+		OnRefreshFailed: func(err error) {
+			c.allocationLost(relayedAddr, err)
+		},
+		OnRefreshed:         c.onAllocationRefreshed,
+		OnExpired:           c.onAllocationExpired,
+		OnPermissionFailure: c.onPermissionFailure,
+		OnExpiring:          c.onAllocationExpiring,
+		ExpiryWarning:       c.expiryWarning,
+
+		RefreshInterval:           c.refreshInterval,
+		PermissionRefreshInterval: c.permissionRefreshInterval,
+		KeepaliveInterval:         c.keepaliveInterval,
+		RefreshJitter:             c.refreshJitter,
+		CloseTimeout:              c.closeTimeout,
+		Setters:                   c.requestSetters,
+		CredentialsProvider:       c.credentialsProvider,
 	})
 
 	c.setTCPAllocation(allocation)
 
+	if c.onAllocationCreated != nil {
+		c.onAllocationCreated(relayedAddr, lifetime.Duration)
+	}
+
 	return allocation, nil
 }
 
 // CreatePermission Issues a CreatePermission request for the supplied addresses
 // as described in https://datatracker.ietf.org/doc/html/rfc5766#section-9
+// All addresses are sent in one request, which the server grants or denies as a
+// whole. Writing to the permitted peers needs no further round trip.
 func (c *Client) CreatePermission(addrs ...net.Addr) error {
+	return c.CreatePermissionContext(context.Background(), addrs...)
+}
+
+// CreatePermissionContext is CreatePermission, giving up once the context is done
+func (c *Client) CreatePermissionContext(ctx context.Context, addrs ...net.Addr) error {
 	if conn := c.relayedUDPConn(); conn != nil {
-		if err := conn.CreatePermissions(addrs...); err != nil {
+		if err := conn.Permit(ctx, addrs...); err != nil {
 			return err
 		}
 	}
 
 	if allocation := c.getTCPAllocation(); allocation != nil {
-		if err := allocation.CreatePermissions(addrs...); err != nil {
+		if err := allocation.Permit(ctx, addrs...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// BindChannel binds a channel to the peer of the UDP allocation and waits
+// for the server to confirm. Without it the channel is bound in the
+// background by the first write to the peer.
+func (c *Client) BindChannel(peer net.Addr) error {
+	return c.BindChannelContext(context.Background(), peer)
+}
+
+// BindChannelContext is BindChannel, giving up once the context is done
+func (c *Client) BindChannelContext(ctx context.Context, peer net.Addr) error {
+	conn := c.relayedUDPConn()
+	if conn == nil {
+		return errNoAllocation
+	}
+	return conn.BindChannelContext(ctx, peer)
+}
+
 // PerformTransaction performs STUN transaction
 func (c *Client) PerformTransaction(msg *stun.Message, to net.Addr, ignoreResult bool) (client.TransactionResult,
 	error,
 ) {
+	return c.performTransaction(context.Background(), msg, to, ignoreResult, true)
+}
+
+// PerformTransactionContext performs STUN transaction, giving up once the
+// context is done. The retransmissions are stopped then.
+func (c *Client) PerformTransactionContext(ctx context.Context, msg *stun.Message, to net.Addr, ignoreResult bool) (client.TransactionResult,
+	error,
+) {
+	return c.performTransaction(ctx, msg, to, ignoreResult, true)
+}
+
+func (c *Client) performTransaction(ctx context.Context, msg *stun.Message, to net.Addr, ignoreResult, reportErrors bool) (client.TransactionResult,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return client.TransactionResult{}, err
+	}
+
+	if c.transactionTimeout > 0 && !ignoreResult {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.transactionTimeout)
+		defer cancel()
+	}
+
 	trKey := b64.StdEncoding.EncodeToString(msg.TransactionID[:])
 
 	raw := make([]byte, len(msg.Raw))
 	copy(raw, msg.Raw)
 
+	rto := c.currentRTO()
 	tr := client.NewTransaction(&client.TransactionConfig{
 		Key:          trKey,
 		Raw:          raw,
 		To:           to,
-		Interval:     c.rto,
+		Interval:     rto,
 		IgnoreResult: ignoreResult,
+
+		Multiplier:    c.rtoMultiplier,
+		MaxInterval:   c.maxRTO,
+		FinalInterval: time.Duration(c.finalRTOMultiplier) * rto,
+		MaxRequests:   c.maxRequests,
 	})
 
 	c.trMap.Insert(trKey, tr)
 
 	c.log.Tracef("Start %s transaction %s to %s", msg.Type, trKey, tr.To)
-	_, err := c.conn.WriteTo(tr.Raw, to)
+	_, err := c.packetConn().WriteTo(tr.Raw, to)
 	if err != nil {
 		return client.TransactionResult{}, err
 	}
+	c.metrics.TransactionSent(msg.Type.Method)
+	c.requests.Add(1)
 
 	tr.StartRtxTimer(c.onRtxTimeout)
 
@@ -438,13 +1301,260 @@ func (c *Client) PerformTransaction(msg *stun.Message, to net.Addr, ignoreResult
 		return client.TransactionResult{}, nil
 	}
 
-	res := tr.WaitForResult()
+	res := tr.WaitForResultContext(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(res.Err, ctxErr) {
+		c.mutexTrMap.Lock()
+		c.trMap.Delete(trKey)
+		c.mutexTrMap.Unlock()
+		tr.StopRtxTimer()
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			c.transactionTimedOut(to)
+		}
+	}
 	if res.Err != nil {
 		return res, res.Err
 	}
+
+	if reportErrors && c.onServerError != nil && res.Msg.Type.Class == stun.ClassErrorResponse {
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(res.Msg); err == nil {
+			c.onServerError(res.Msg.Type.Method, code.Code)
+		}
+	}
 	return res, nil
 }
 
+// currentRTO returns the initial retransmission timeout of a new transaction
+func (c *Client) currentRTO() time.Duration {
+	if c.adaptiveRTO {
+		return c.rtoEstimator.RTO()
+	}
+	return c.rto
+}
+
+// RTTStats are the round trip time and loss statistics of the transactions of a Client
+type RTTStats struct {
+	// Round trip times of the transactions answered without a retransmission, see
+	// https://datatracker.ietf.org/doc/html/rfc6298#section-2
+	LatestRTT    time.Duration
+	SmoothedRTT  time.Duration
+	RTTVariation time.Duration
+
+	Requests        int64 // Requests sent, including retransmissions
+	Retransmissions int64
+	Responses       int64
+	Timeouts        int64 // Transactions that were never answered
+}
+
+// LossRate returns the share of requests that were not answered, including
+// those still waiting for a response
+func (s RTTStats) LossRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Requests-s.Responses) / float64(s.Requests)
+}
+
+// RTTStats returns the round trip time and loss statistics of the transactions
+// of the client, like the refreshes of the allocation and channel bindings
+func (c *Client) RTTStats() RTTStats {
+	srtt, rttvar := c.rtoEstimator.SmoothedRTT()
+	return RTTStats{
+		LatestRTT:       time.Duration(c.latestRTT.Load()),
+		SmoothedRTT:     srtt,
+		RTTVariation:    rttvar,
+		Requests:        c.requests.Load(),
+		Retransmissions: c.retransmissions.Load(),
+		Responses:       c.responses.Load(),
+		Timeouts:        c.timeouts.Load(),
+	}
+}
+
+// ReceiveStats are the statistics of the queue of packets received from peers through
+// the UDP allocation of a Client, until the application reads them
+type ReceiveStats struct {
+	Queued    int    // Packets waiting to be read
+	Capacity  int    // Size of the queue, see ClientConfig.ReceiveQueueSize
+	Dropped   uint64 // Packets dropped because the queue was full
+	Overflows uint64 // How often the queue ran full, each time dropping one or more packets
+}
+
+// ReceiveStats returns the receive queue statistics of the UDP allocation, or zero
+// stats if there is none
+func (c *Client) ReceiveStats() ReceiveStats {
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return ReceiveStats{}
+	}
+
+	var stats ReceiveStats
+	stats.Queued, stats.Capacity, stats.Dropped, stats.Overflows = relayedConn.ReceiveStats()
+	return stats
+}
+
+// Permission is a permission of an allocation of a Client, see Client.Permissions
+type Permission struct {
+	Peer      net.Addr  // Address the permission was created for, it covers all ports of its IP
+	Permitted bool      // The server confirmed the permission
+	ExpiresAt time.Time // When the server drops the permission unless it is refreshed
+}
+
+// ChannelBinding is a channel binding of the UDP allocation of a Client, see
+// Client.ChannelBindings
+type ChannelBinding struct {
+	Number    uint16
+	Peer      net.Addr
+	Bound     bool      // The server confirmed the binding, data is sent in Send indications before
+	ExpiresAt time.Time // When the server drops the binding unless it is refreshed
+}
+
+// Permissions returns the current permissions of the allocation, ordered by peer
+// address, e.g. to debug unreachable peers. Permissions still in use are refreshed
+// before they expire.
+func (c *Client) Permissions() []Permission {
+	var infos []client.PermissionInfo
+	if relayedConn := c.relayedUDPConn(); relayedConn != nil {
+		infos = relayedConn.Permissions()
+	} else if allocation := c.getTCPAllocation(); allocation != nil {
+		infos = allocation.Permissions()
+	}
+
+	var perms []Permission
+	for _, info := range infos {
+		perms = append(perms, Permission(info))
+	}
+	return perms
+}
+
+// ChannelBindings returns the current channel bindings of the UDP allocation,
+// ordered by channel number. Channels still in use are refreshed before they expire.
+func (c *Client) ChannelBindings() []ChannelBinding {
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return nil
+	}
+
+	var bindings []ChannelBinding
+	for _, info := range relayedConn.Channels() {
+		bindings = append(bindings, ChannelBinding(info))
+	}
+	return bindings
+}
+
+// transactionTimedOut counts a transaction that was never answered, and reports
+// the server as unresponsive if it answered the previous transaction
+func (c *Client) transactionTimedOut(to net.Addr) {
+	c.timeouts.Add(1)
+	if c.unresponsive.CompareAndSwap(false, true) {
+		c.log.Warnf("Server %s stopped responding", to)
+		if c.onServerUnresponsive != nil {
+			go c.onServerUnresponsive(to)
+		}
+	}
+}
+
+func (c *Client) withAllocateTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.allocateTimeout > 0 {
+		return context.WithTimeout(ctx, c.allocateTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// AdditionalRelayedAddr returns the IPv6 relayed transport address of an allocation
+// requested with RelayAddressFamilyDual, or nil if the server did not allocate one.
+func (c *Client) AdditionalRelayedAddr() net.Addr {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.additionalRelayedAddr
+}
+
+func (c *Client) setAdditionalRelayedAddr(addr net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.additionalRelayedAddr = addr
+}
+
+// MappedAddress returns the server reflexive address of the client, from the
+// XOR-MAPPED-ADDRESS of the last successful Allocate response, which spares a
+// Binding request. It is nil before an allocation, or if the server did not send it.
+func (c *Client) MappedAddress() net.Addr {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.mappedAddr
+}
+
+func (c *Client) setMappedAddress(addr net.Addr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.mappedAddr = addr
+}
+
+// AllocationLifetime returns the remaining lifetime of the allocation, which is
+// extended by every refresh. It returns false if there is no allocation.
+func (c *Client) AllocationLifetime() (time.Duration, bool) {
+	var expiresAt time.Time
+	if conn := c.relayedUDPConn(); conn != nil {
+		expiresAt = conn.ExpiresAt()
+	} else if allocation := c.getTCPAllocation(); allocation != nil {
+		expiresAt = allocation.ExpiresAt()
+	} else {
+		return 0, false
+	}
+
+	remaining := time.Until(expiresAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// OnData registers the handler of data relayed by the UDP allocation. Data handled by
+// a DataHandler is not queued for ReadFrom of the net.PacketConn returned by Allocate.
+// The handler runs on the goroutine calling HandleInbound, usually the one of Listen,
+// and must not block. A nil handler unregisters it.
+func (c *Client) OnData(handler DataHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.dataHandler = handler
+}
+
+// OnDataFrom registers the handler of data relayed from the peer, which takes
+// precedence over the one of OnData. A nil handler unregisters it.
+func (c *Client) OnDataFrom(peer net.Addr, handler DataHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if handler == nil {
+		delete(c.peerDataHandlers, peer.String())
+		return
+	}
+	if c.peerDataHandlers == nil {
+		c.peerDataHandlers = map[string]DataHandler{}
+	}
+	c.peerDataHandlers[peer.String()] = handler
+}
+
+// dispatchData calls the DataHandler of the peer and reports whether there was one
+func (c *Client) dispatchData(from net.Addr, data []byte) bool {
+	c.mutex.RLock()
+	handler, ok := c.peerDataHandlers[from.String()]
+	if !ok {
+		handler = c.dataHandler
+	}
+	c.mutex.RUnlock()
+
+	if handler == nil {
+		return false
+	}
+	handler(from, data)
+	return true
+}
+
 // OnDeallocated is called when de-allocation of relay address has been complete.
 // (Called by UDPConn)
 func (c *Client) OnDeallocated(net.Addr) {
@@ -584,6 +1694,14 @@ func (c *Client) handleSTUNMessage(data []byte, from net.Addr) error {
 	c.trMap.Delete(trKey)
 	c.mutexTrMap.Unlock()
 
+	c.responses.Add(1)
+	c.unresponsive.Store(false)
+	if tr.Retries() == 0 {
+		rtt := tr.Elapsed()
+		c.latestRTT.Store(int64(rtt))
+		c.rtoEstimator.Update(rtt)
+	}
+
 	if !tr.WriteResult(client.TransactionResult{
 		Msg:     msg,
 		From:    from,
@@ -596,11 +1714,9 @@ func (c *Client) handleSTUNMessage(data []byte, from net.Addr) error {
 }
 
 func (c *Client) handleChannelData(data []byte) error {
-	chData := &proto.ChannelData{
-		Raw: make([]byte, len(data)),
-	}
-	copy(chData.Raw, data)
-	if err := chData.Decode(); err != nil {
+	// HandleInbound of the relayed conn copies what it keeps
+	chData, err := proto.DecodeChannelData(data)
+	if err != nil {
 		return err
 	}
 
@@ -630,9 +1746,10 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 		return // Already gone
 	}
 
-	if nRtx == maxRtxCount {
+	if nRtx == c.maxRequests {
 		// All retransmissions failed
 		c.trMap.Delete(trKey)
+		c.transactionTimedOut(tr.To)
 		if !tr.WriteResult(client.TransactionResult{
 			Err: fmt.Errorf("%w %s", errAllRetransmissionsFailed, trKey),
 		}) {
@@ -643,7 +1760,7 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 
 	c.log.Tracef("Retransmitting transaction %s to %s (nRtx=%d)",
 		trKey, tr.To.String(), nRtx)
-	_, err := c.conn.WriteTo(tr.Raw, tr.To)
+	_, err := c.packetConn().WriteTo(tr.Raw, tr.To)
 	if err != nil {
 		c.trMap.Delete(trKey)
 		if !tr.WriteResult(client.TransactionResult{
@@ -653,9 +1770,120 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 		}
 		return
 	}
+	c.metrics.TransactionRetransmitted(rawMethod(tr.Raw))
+	c.requests.Add(1)
+	c.retransmissions.Add(1)
 	tr.StartRtxTimer(c.onRtxTimeout)
 }
 
+// rawMethod returns the method of an encoded STUN message
+func rawMethod(raw []byte) stun.Method {
+	var t stun.MessageType
+	if len(raw) >= 2 {
+		t.ReadValue(binary.BigEndian.Uint16(raw))
+	}
+	return t.Method
+}
+
+// reallocate replaces the lost UDP allocation with a new one, keeping the
+// net.PacketConn returned by Allocate usable
+func (c *Client) reallocate(cause error) {
+	if err := c.reallocTryLock.Lock(); err != nil {
+		return // Already in progress
+	}
+	defer c.reallocTryLock.Unlock()
+
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return
+	}
+
+	oldAddr := relayedConn.LocalAddr()
+	c.log.Warnf("Allocation %s lost: %s. Reallocating", oldAddr, cause)
+
+	var err error
+	for i := 0; i < maxReallocateAttempts; i++ {
+		if i > 0 {
+			time.Sleep(reallocateBackoff << (i - 1))
+		}
+		if c.closed.Load() {
+			return
+		}
+
+		var relayed proto.RelayedAddress
+		var lifetime proto.Lifetime
+		var nonce stun.Nonce
+		if relayed, lifetime, nonce, err = c.sendAllocateRequest(context.Background(), proto.ProtoUDP, allocateOptions{}); err != nil {
+			c.log.Debugf("Failed to reallocate: %s", err)
+
+			// The server may still hold the old allocation for our 5-tuple
+			if c.redial != nil {
+				if _, redialErr := c.replaceConn(c.packetConn()); redialErr != nil {
+					c.log.Debugf("Failed to redial: %s", redialErr)
+				}
+			}
+			continue
+		}
+
+		relayedAddr := &net.UDPAddr{
+			IP:   relayed.IP,
+			Port: relayed.Port,
+		}
+		relayedConn.Reallocate(c.TURNServerAddr(), relayedAddr, nonce, lifetime.Duration)
+		c.log.Infof("Reallocated relayed address %s", relayedAddr)
+
+		if c.onAllocationCreated != nil {
+			c.onAllocationCreated(relayedAddr, lifetime.Duration)
+		}
+
+		if c.onReallocated != nil {
+			c.onReallocated(relayedAddr, nil)
+		}
+		if c.onRelayedAddressChanged != nil && relayedAddr.String() != oldAddr.String() {
+			c.onRelayedAddressChanged(oldAddr, relayedAddr)
+		}
+		return
+	}
+
+	c.log.Errorf("Failed to reallocate: %s", err)
+	if c.onReallocated != nil {
+		c.onReallocated(nil, err)
+	}
+	c.allocationLost(oldAddr, err)
+}
+
+func (c *Client) allocationLost(relayedAddr net.Addr, err error) {
+	if c.onAllocationLost != nil && !c.closed.Load() {
+		c.onAllocationLost(relayedAddr, err)
+	}
+}
+
+// replaceConn redials the conn, unless it was already replaced
+func (c *Client) replaceConn(broken net.PacketConn) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != broken {
+		return false, nil
+	}
+
+	conn, err := c.redial()
+	if err != nil {
+		return false, err
+	}
+
+	c.conn = conn
+	_ = broken.Close()
+	return true, nil
+}
+
+func (c *Client) packetConn() net.PacketConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.conn
+}
+
 func (c *Client) setRelayedUDPConn(conn *client.UDPConn) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// ClientMuxConfig is a bag of config parameters for ClientMux.
+type ClientMuxConfig struct {
+	Conn          net.PacketConn // Listening socket shared by the clients
+	LoggerFactory logging.LoggerFactory
+}
+
+// ClientMux shares one net.PacketConn between several Clients, so an application
+// relaying many sessions does not need a socket and a reading goroutine per
+// allocation. Every Client has its own transactions, credentials and allocations.
+// A server identifies an allocation by its 5-tuple, so each Client must use a TURN
+// server address that no other Client of the mux uses.
+type ClientMux struct {
+	conn          net.PacketConn        // Read-only
+	clients       []*Client             // Protected by mutex
+	mutex         sync.RWMutex          // Thread-safe
+	listenTryLock client.TryLock        // Thread-safe
+	log           logging.LeveledLogger // Read-only
+}
+
+// NewClientMux returns a new ClientMux reading from config.Conn once Listen is called
+func NewClientMux(config ClientMuxConfig) (*ClientMux, error) {
+	if config.Conn == nil {
+		return nil, errNilConn
+	}
+
+	loggerFactory := config.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	return &ClientMux{
+		conn: config.Conn,
+		log:  loggerFactory.NewLogger("turnc"),
+	}, nil
+}
+
+// NewClient returns a new Client sending through the connection of the mux. Conn of
+// the config is ignored and Redial is not supported. Listen must not be called on the
+// returned Client, the mux passes it the packets of its servers instead.
+func (m *ClientMux) NewClient(config *ClientConfig) (*Client, error) {
+	if config.Redial != nil {
+		return nil, errMuxRedial
+	}
+
+	muxConfig := *config
+	muxConfig.Conn = m.conn
+	c, err := NewClient(&muxConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeClosed()
+	if server := c.TURNServerAddr(); server != nil {
+		for _, other := range m.clients {
+			if addr := other.TURNServerAddr(); addr != nil && addr.String() == server.String() {
+				return nil, fmt.Errorf("%w: %s", errMuxServerInUse, server)
+			}
+		}
+	}
+	m.clients = append(m.clients, c)
+
+	return c, nil
+}
+
+// Listen starts reading from the connection in a single goroutine, passing every
+// packet to the Client using the server it came from. It stops when reading fails,
+// usually because the connection was closed.
+func (m *ClientMux) Listen() error {
+	if err := m.listenTryLock.Lock(); err != nil {
+		return fmt.Errorf("%w: %s", errAlreadyListening, err.Error())
+	}
+
+	go func() {
+		buf := make([]byte, maxDataBufferSize)
+		for {
+			n, from, err := m.conn.ReadFrom(buf)
+			if err != nil {
+				m.log.Debugf("Failed to read: %s. Exiting loop", err)
+				break
+			}
+
+			c := m.route(buf[:n], from)
+			if c == nil {
+				m.log.Tracef("Ignoring packet from %s, which is no server of the mux", from)
+				continue
+			}
+			if _, err = c.HandleInbound(buf[:n], from); err != nil {
+				// The packet only concerned one of the clients
+				m.log.Debugf("Failed to handle inbound message from %s: %s", from, err)
+			}
+		}
+
+		m.listenTryLock.Unlock()
+	}()
+
+	return nil
+}
+
+// Close closes all clients of the mux. The connection is not closed.
+func (m *ClientMux) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, c := range m.clients {
+		c.Close()
+	}
+	m.clients = nil
+}
+
+// route returns the open Client whose TURN server sent the packet, whose address
+// may change with redirects and failover. Responses of a server several clients
+// use go to the client waiting for the transaction.
+func (m *ClientMux) route(data []byte, from net.Addr) *Client {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var trKey string
+	if stun.IsMessage(data) {
+		// The transaction ID follows the type, length and magic cookie
+		trKey = b64.StdEncoding.EncodeToString(data[8 : 8+stun.TransactionIDSize])
+	}
+
+	var turnClient, stunClient *Client
+	for _, c := range m.clients {
+		if c.closed.Load() {
+			continue
+		}
+		turnServer := c.TURNServerAddr()
+		isTURN := turnServer != nil && turnServer.String() == from.String()
+		stunServer := c.STUNServerAddr()
+		isSTUN := stunServer != nil && stunServer.String() == from.String()
+		if !isTURN && !isSTUN {
+			continue
+		}
+
+		if _, ok := c.trMap.Find(trKey); ok && trKey != "" {
+			return c
+		}
+		if isTURN {
+			turnClient = c
+		} else if stunClient == nil {
+			stunClient = c
+		}
+	}
+
+	if turnClient != nil {
+		return turnClient
+	}
+	return stunClient
+}
+
+func (m *ClientMux) removeClosed() {
+	open := m.clients[:0]
+	for _, c := range m.clients {
+		if !c.closed.Load() {
+			open = append(open, c)
+		}
+	}
+	m.clients = open
+}
@@ -7,7 +7,11 @@
 package turn
 
 import (
+	"context"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -256,3 +260,2261 @@ func TestTCPClient(t *testing.T) {
 	require.NoError(t, conn.Close())
 	require.NoError(t, server.Close())
 }
+
+// Recover a lost allocation transparently on a redialed conn
+func TestClientReallocate(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	reallocated := make(chan net.Addr, 1)
+	changed := make(chan [2]net.Addr, 1)
+	redialed := make(chan net.PacketConn, 1)
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: "127.0.0.1:3478",
+		Username:       "foo",
+		Password:       "pass",
+		AutoReallocate: true,
+		Redial: func() (net.PacketConn, error) {
+			conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+			if err == nil {
+				redialed <- conn
+			}
+			return conn, err
+		},
+		OnReallocated: func(relayedAddr net.Addr, err error) {
+			assert.NoError(t, err)
+			reallocated <- relayedAddr
+		},
+		OnRelayedAddressChanged: func(oldAddr, newAddr net.Addr) {
+			changed <- [2]net.Addr{oldAddr, newAddr}
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	oldAddr := relayConn.LocalAddr()
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, err = relayConn.WriteTo([]byte("before"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	// Breaking the conn makes the client redial and reallocate
+	require.NoError(t, conn.Close())
+
+	var newAddr net.Addr
+	select {
+	case newAddr = <-reallocated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("allocation was not recovered")
+	}
+	assert.NotEqual(t, oldAddr.String(), newAddr.String())
+	assert.Equal(t, newAddr, relayConn.LocalAddr())
+	assert.Equal(t, [2]net.Addr{oldAddr, newAddr}, <-changed)
+
+	// The permission of the peer was re-created on the new allocation
+	buf := make([]byte, 64)
+	_, err = peer.WriteTo([]byte("after"), newAddr)
+	require.NoError(t, err)
+	require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err := relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "after", string(buf[:n]))
+	assert.Equal(t, peer.LocalAddr().String(), from.String())
+
+	// Shutdown
+	client.Close()
+	assert.NoError(t, relayConn.Close())
+	assert.NoError(t, (<-redialed).Close())
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientLifecycleCallbacks(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+				PermissionHandler: func(net.Addr, net.IP) bool { return false },
+			},
+		},
+		Realm:          "pion.ly",
+		MaxAllocations: 1,
+	})
+	require.NoError(t, err)
+
+	var created net.Addr
+	var failedPeer net.Addr
+	type serverError struct {
+		method stun.Method
+		code   stun.ErrorCode
+	}
+	var serverErrors []serverError
+	newClient := func() (*Client, net.PacketConn) {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		client, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: "127.0.0.1:3478",
+			Username:       "foo",
+			Password:       "pass",
+			OnAllocationCreated: func(relayedAddr net.Addr, lifetime time.Duration) {
+				created = relayedAddr
+				assert.Equal(t, proto.DefaultLifetime, lifetime)
+			},
+			OnPermissionFailure: func(peer net.Addr, err error) {
+				failedPeer = peer
+				assert.Error(t, err)
+			},
+			OnServerError: func(method stun.Method, code stun.ErrorCode) {
+				serverErrors = append(serverErrors, serverError{method, code})
+			},
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client, conn
+	}
+
+	client, conn := newClient()
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, relayConn.LocalAddr(), created)
+	assert.Empty(t, serverErrors, "the 401 challenge of Allocate should not be reported")
+
+	remaining, ok := client.AllocationLifetime()
+	assert.True(t, ok)
+	assert.Greater(t, remaining, proto.DefaultLifetime-time.Minute)
+	assert.LessOrEqual(t, remaining, proto.DefaultLifetime)
+
+	peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}
+	_, err = relayConn.WriteTo([]byte{0x00}, peer)
+	assert.Error(t, err)
+	assert.Equal(t, peer, failedPeer)
+	assert.Equal(t, []serverError{{stun.MethodCreatePermission, stun.CodeForbidden}}, serverErrors)
+	serverErrors = nil
+
+	// The server is full
+	client2, conn2 := newClient()
+	_, err = client2.Allocate()
+	assert.Error(t, err)
+	assert.Equal(t, []serverError{{stun.MethodAllocate, stun.CodeInsufficientCapacity}}, serverErrors)
+
+	// Shutdown
+	client.Close()
+	client2.Close()
+	assert.NoError(t, relayConn.Close())
+	_, ok = client.AllocationLifetime()
+	assert.False(t, ok)
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn2.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientContext(t *testing.T) {
+	loggerFactory := logging.NewDefaultLoggerFactory()
+
+	// A server that never answers
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close() //nolint:errcheck
+
+	c, pc, ok := createListeningTestClient(t, loggerFactory)
+	require.True(t, ok)
+	defer c.Close()
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := c.SendBindingRequestToContext(ctx, silent.LocalAddr())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 0, c.trMap.Size(), "should be no transaction left")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := c.SendBindingRequestToContext(ctx, silent.LocalAddr())
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, c.trMap.Size(), "should be no transaction left")
+	})
+
+	t.Run("BindChannel without allocation", func(t *testing.T) {
+		assert.ErrorIs(t, c.BindChannelContext(context.Background(), silent.LocalAddr()), errNoAllocation)
+	})
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestClientTimeouts(t *testing.T) {
+	loggerFactory := logging.NewDefaultLoggerFactory()
+
+	// A server that never answers
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close() //nolint:errcheck
+
+	t.Run("Invalid", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = NewClient(&ClientConfig{Conn: conn, TransactionTimeout: -time.Second})
+		assert.ErrorIs(t, err, errInvalidClientTimeout)
+	})
+
+	for name, config := range map[string]ClientConfig{
+		"TransactionTimeout": {TransactionTimeout: 100 * time.Millisecond},
+		"AllocateTimeout":    {AllocateTimeout: 100 * time.Millisecond},
+	} {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+			require.NoError(t, err)
+
+			config.Conn = conn
+			config.TURNServerAddr = silent.LocalAddr().String()
+			config.LoggerFactory = loggerFactory
+			c, err := NewClient(&config)
+			require.NoError(t, err)
+			require.NoError(t, c.Listen())
+
+			start := time.Now()
+			_, err = c.Allocate()
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, 0, c.trMap.Size(), "should be no transaction left")
+
+			c.Close()
+			assert.NoError(t, conn.Close())
+		})
+	}
+}
+
+func TestClientRetransmissionPolicy(t *testing.T) {
+	loggerFactory := logging.NewDefaultLoggerFactory()
+
+	t.Run("Schedule", func(t *testing.T) {
+		// A server that never answers, counting the requests
+		silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer silent.Close() //nolint:errcheck
+
+		received := make(chan time.Time, 16)
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				if _, _, err := silent.ReadFrom(buf); err != nil {
+					return
+				}
+				received <- time.Now()
+			}
+		}()
+
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		c, err := NewClient(&ClientConfig{
+			Conn:               conn,
+			LoggerFactory:      loggerFactory,
+			RTO:                10 * time.Millisecond,
+			RTOMultiplier:      1.5,
+			MaxRequests:        3,
+			FinalRTOMultiplier: 20,
+		})
+		require.NoError(t, err)
+		require.NoError(t, c.Listen())
+		defer c.Close()
+
+		start := time.Now()
+		_, err = c.SendBindingRequestTo(silent.LocalAddr())
+		assert.ErrorIs(t, err, errAllRetransmissionsFailed)
+
+		// 10ms, 15ms, then Rm * RTO for the last request
+		assert.GreaterOrEqual(t, time.Since(start), 225*time.Millisecond)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Len(t, received, 3)
+
+		assert.NoError(t, conn.Close())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = NewClient(&ClientConfig{Conn: conn, RTOMultiplier: 0.5})
+		assert.ErrorIs(t, err, errInvalidRetransmission)
+	})
+
+	t.Run("AdaptiveRTO", func(t *testing.T) {
+		udpListener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		server, err := NewServer(ServerConfig{
+			PacketConnConfigs: []PacketConnConfig{
+				{
+					PacketConn: udpListener,
+					RelayAddressGenerator: &RelayAddressGeneratorStatic{
+						RelayAddress: net.ParseIP("127.0.0.1"),
+						Address:      "0.0.0.0",
+					},
+				},
+			},
+			LoggerFactory: loggerFactory,
+		})
+		require.NoError(t, err)
+
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		c, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			STUNServerAddr: udpListener.LocalAddr().String(),
+			LoggerFactory:  loggerFactory,
+			AdaptiveRTO:    true,
+		})
+		require.NoError(t, err)
+		require.NoError(t, c.Listen())
+
+		assert.Equal(t, defaultRTO, c.currentRTO())
+		for i := 0; i < 10; i++ {
+			_, err = c.SendBindingRequest()
+			require.NoError(t, err)
+		}
+		assert.Less(t, c.currentRTO(), defaultRTO)
+		assert.GreaterOrEqual(t, c.currentRTO(), minAdaptiveRTO)
+
+		c.Close()
+		assert.NoError(t, conn.Close())
+		assert.NoError(t, server.Close())
+	})
+}
+
+func TestClientDial(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: "127.0.0.1:3478",
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	other, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	tunnel, err := client.Dial(peer.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, peer.LocalAddr(), tunnel.RemoteAddr())
+
+	// The channel is bound, so the first write needs no round trip
+	_, err = tunnel.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	n, from, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Equal(t, tunnel.LocalAddr().String(), from.String())
+
+	// Packets of other peers are discarded
+	require.NoError(t, client.CreatePermission(other.LocalAddr()))
+	_, err = other.WriteTo([]byte("other"), from)
+	require.NoError(t, err)
+	_, err = peer.WriteTo([]byte("world"), from)
+	require.NoError(t, err)
+
+	require.NoError(t, tunnel.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err = tunnel.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+
+	// Dial allocated, so closing the tunnel releases the allocation
+	require.NoError(t, tunnel.Close())
+	assert.Nil(t, client.relayedUDPConn())
+
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, other.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientOnData(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: "127.0.0.1:3478",
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	other, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, client.CreatePermission(peer.LocalAddr(), other.LocalAddr()))
+
+	fromPeer := make(chan string, 1)
+	fromOther := make(chan string, 1)
+	client.OnDataFrom(peer.LocalAddr(), func(from net.Addr, payload []byte) {
+		assert.Equal(t, peer.LocalAddr().String(), from.String())
+		fromPeer <- string(payload)
+	})
+	client.OnData(func(_ net.Addr, payload []byte) {
+		fromOther <- string(payload)
+	})
+
+	_, err = peer.WriteTo([]byte("peer"), relayConn.LocalAddr())
+	require.NoError(t, err)
+	_, err = other.WriteTo([]byte("other"), relayConn.LocalAddr())
+	require.NoError(t, err)
+
+	for _, expect := range []struct {
+		ch      chan string
+		payload string
+	}{{fromPeer, "peer"}, {fromOther, "other"}} {
+		select {
+		case payload := <-expect.ch:
+			assert.Equal(t, expect.payload, payload)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "no data for "+expect.payload)
+		}
+	}
+
+	// Without handlers data is queued for ReadFrom again
+	client.OnData(nil)
+	client.OnDataFrom(peer.LocalAddr(), nil)
+	_, err = peer.WriteTo([]byte("queued"), relayConn.LocalAddr())
+	require.NoError(t, err)
+
+	require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1500)
+	n, _, err := relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "queued", string(buf[:n]))
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, other.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+// permissionCountingConn counts the CreatePermission requests written to it
+type permissionCountingConn struct {
+	net.PacketConn
+	requests atomic.Int32
+}
+
+func (c *permissionCountingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	msg := &stun.Message{Raw: append([]byte(nil), p...)}
+	if stun.IsMessage(p) && msg.Decode() == nil && msg.Type.Method == stun.MethodCreatePermission {
+		c.requests.Add(1)
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestClientCreatePermissionBatch(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	var allowAll atomic.Bool
+	denied := net.ParseIP("127.0.0.3")
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+				PermissionHandler: func(_ net.Addr, peer net.IP) bool {
+					return allowAll.Load() || !peer.Equal(denied)
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	udpConn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+	conn := &permissionCountingConn{PacketConn: udpConn}
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: "127.0.0.1:3478",
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peerA, err := net.ListenPacket("udp4", "127.0.0.2:0")
+	require.NoError(t, err)
+	peerB, err := net.ListenPacket("udp4", "127.0.0.3:0")
+	require.NoError(t, err)
+
+	received := make(chan string, 4)
+	client.OnData(func(_ net.Addr, payload []byte) {
+		received <- string(payload)
+	})
+
+	// Denying one peer denies the whole request
+	err = client.CreatePermission(peerA.LocalAddr(), peerB.LocalAddr())
+	assert.ErrorContains(t, err, "403")
+	_, err = peerA.WriteTo([]byte("dropped"), relayConn.LocalAddr())
+	require.NoError(t, err)
+	select {
+	case payload := <-received:
+		assert.Fail(t, "relayed without permission: "+payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// All peers in one request, and no further request when writing to them
+	allowAll.Store(true)
+	conn.requests.Store(0)
+	require.NoError(t, client.CreatePermission(peerA.LocalAddr(), peerB.LocalAddr()))
+	assert.Equal(t, int32(1), conn.requests.Load())
+
+	for _, peer := range []net.PacketConn{peerA, peerB} {
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), conn.requests.Load())
+
+	_, err = peerB.WriteTo([]byte("relayed"), relayConn.LocalAddr())
+	require.NoError(t, err)
+	select {
+	case payload := <-received:
+		assert.Equal(t, "relayed", payload)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "not relayed")
+	}
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, peerA.Close())
+	assert.NoError(t, peerB.Close())
+	assert.NoError(t, udpConn.Close())
+	assert.NoError(t, server.Close())
+}
+
+// redirectingServer answers every request with 300 (Try Alternate)
+func redirectingServer(t *testing.T, alternate net.Addr) net.PacketConn {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	if alternate == nil {
+		alternate = conn.LocalAddr()
+	}
+	udpAddr, ok := alternate.(*net.UDPAddr)
+	require.True(t, ok)
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+			res, err := stun.Build(
+				stun.NewTransactionIDSetter(req.TransactionID),
+				stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				stun.CodeTryAlternate,
+				&stun.AlternateServer{IP: udpAddr.IP, Port: udpAddr.Port},
+			)
+			if err == nil {
+				_, _ = conn.WriteTo(res.Raw, from)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestClientTryAlternate(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	newClient := func(turnServer net.Addr, onRedirected func(net.Addr)) (*Client, net.PacketConn) {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		client, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: turnServer.String(),
+			Username:       "foo",
+			Password:       "pass",
+			OnRedirected:   onRedirected,
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client, conn
+	}
+
+	t.Run("Redirect", func(t *testing.T) {
+		// Redirected twice before reaching the server
+		second := redirectingServer(t, udpListener.LocalAddr())
+		defer second.Close() //nolint:errcheck
+		first := redirectingServer(t, second.LocalAddr())
+		defer first.Close() //nolint:errcheck
+
+		var redirectedTo net.Addr
+		client, conn := newClient(first.LocalAddr(), func(server net.Addr) {
+			redirectedTo = server
+		})
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		assert.Equal(t, udpListener.LocalAddr().String(), redirectedTo.String())
+		assert.Equal(t, udpListener.LocalAddr().String(), client.TURNServerAddr().String())
+
+		// The allocation is refreshed and used at the final server
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		require.NoError(t, client.CreatePermission(peer.LocalAddr()))
+
+		assert.NoError(t, relayConn.Close())
+		client.Close()
+		assert.NoError(t, peer.Close())
+		assert.NoError(t, conn.Close())
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		loop := redirectingServer(t, nil)
+		defer loop.Close() //nolint:errcheck
+
+		client, conn := newClient(loop.LocalAddr(), func(net.Addr) {
+			assert.Fail(t, "should not be redirected")
+		})
+
+		_, err := client.Allocate()
+		assert.ErrorIs(t, err, errRedirectLoop)
+		assert.Equal(t, loop.LocalAddr().String(), client.TURNServerAddr().String())
+
+		client.Close()
+		assert.NoError(t, conn.Close())
+	})
+
+	assert.NoError(t, server.Close())
+}
+
+func TestClientAllocateRTPPair(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	newClient := func() (*Client, net.PacketConn) {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		client, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: "127.0.0.1:3478",
+			Username:       "foo",
+			Password:       "pass",
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client, conn
+	}
+
+	rtpClient, rtpConn := newClient()
+	rtcpClient, rtcpConn := newClient()
+
+	rtp, rtcp, err := rtpClient.AllocateRTPPair(rtcpClient)
+	require.NoError(t, err)
+
+	rtpAddr, ok := rtp.LocalAddr().(*net.UDPAddr)
+	require.True(t, ok)
+	rtcpAddr, ok := rtcp.LocalAddr().(*net.UDPAddr)
+	require.True(t, ok)
+	assert.Equal(t, 0, rtpAddr.Port%2, "RTP port should be even")
+	assert.Equal(t, rtpAddr.Port+1, rtcpAddr.Port)
+
+	// An unknown token is rejected
+	otherClient, otherConn := newClient()
+	_, err = otherClient.AllocateReserved([]byte("unknown!"))
+	assert.ErrorContains(t, err, "508")
+
+	assert.NoError(t, rtp.Close())
+	assert.NoError(t, rtcp.Close())
+	for _, c := range []*Client{rtpClient, rtcpClient, otherClient} {
+		c.Close()
+	}
+	for _, conn := range []net.PacketConn{rtpConn, rtcpConn, otherConn} {
+		assert.NoError(t, conn.Close())
+	}
+	assert.NoError(t, server.Close())
+}
+
+// dualFamilyServer authenticates the first Allocate request and then allocates
+// an IPv4 relayed address, plus an IPv6 one if ADDITIONAL-ADDRESS-FAMILY is requested.
+// Allocate requests are sent on the returned channel.
+func dualFamilyServer(t *testing.T) (net.PacketConn, chan *stun.Message) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	requests := make(chan *stun.Message, 4)
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+
+			setters := []stun.Setter{
+				stun.NewTransactionIDSetter(req.TransactionID),
+				stun.NewType(req.Type.Method, stun.ClassSuccessResponse),
+			}
+			switch {
+			case req.Type.Method != stun.MethodAllocate:
+			case !req.Contains(stun.AttrMessageIntegrity):
+				setters = append(setters[:1],
+					stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
+					stun.CodeUnauthorized,
+					stun.NewNonce("nonce"),
+					stun.NewRealm("pion.ly"),
+				)
+			default:
+				requests <- req
+				setters = append(setters,
+					&proto.RelayedAddress{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+					proto.Lifetime{Duration: time.Minute},
+				)
+				if req.Contains(proto.AttrAdditionalAddressFamily) {
+					setters = append(setters, &proto.RelayedAddress{IP: net.ParseIP("::1"), Port: 5001})
+				}
+			}
+
+			if res, err := stun.Build(setters...); err == nil {
+				_, _ = conn.WriteTo(res.Raw, from)
+			}
+		}
+	}()
+	return conn, requests
+}
+
+func TestClientRelayAddressFamily(t *testing.T) {
+	allocate := func(family RelayAddressFamily) (*Client, *stun.Message) {
+		server, requests := dualFamilyServer(t)
+		defer server.Close() //nolint:errcheck
+
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			Conn:               conn,
+			TURNServerAddr:     server.LocalAddr().String(),
+			Username:           "foo",
+			Password:           "pass",
+			RelayAddressFamily: family,
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		defer client.Close()
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:5000", relayConn.LocalAddr().String())
+		assert.NoError(t, relayConn.Close())
+		return client, <-requests
+	}
+
+	t.Run("IPv6", func(t *testing.T) {
+		client, req := allocate(RelayAddressFamilyIPv6)
+
+		var family proto.RequestedAddressFamily
+		require.NoError(t, family.GetFrom(req))
+		assert.Equal(t, proto.RequestedFamilyIPv6, family)
+		assert.False(t, req.Contains(proto.AttrAdditionalAddressFamily))
+		assert.Nil(t, client.AdditionalRelayedAddr())
+	})
+
+	t.Run("Dual", func(t *testing.T) {
+		client, req := allocate(RelayAddressFamilyDual)
+
+		var additional proto.AdditionalAddressFamily
+		require.NoError(t, additional.GetFrom(req))
+		assert.False(t, req.Contains(stun.AttrRequestedAddressFamily))
+		require.NotNil(t, client.AdditionalRelayedAddr())
+		assert.Equal(t, "[::1]:5001", client.AdditionalRelayedAddr().String())
+	})
+}
+
+// rejectingServer answers every request with 508 (Insufficient Capacity) and counts them
+func rejectingServer(t *testing.T) (net.PacketConn, *atomic.Int32) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	var requests atomic.Int32
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+			requests.Add(1)
+			res, err := stun.Build(
+				stun.NewTransactionIDSetter(req.TransactionID),
+				stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				stun.CodeInsufficientCapacity,
+			)
+			if err == nil {
+				_, _ = conn.WriteTo(res.Raw, from)
+			}
+		}
+	}()
+	return conn, &requests
+}
+
+func TestClientFailover(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	rejecting, requests := rejectingServer(t)
+	defer rejecting.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	_, err = NewClient(&ClientConfig{
+		Conn:            conn,
+		TURNServerAddrs: []string{"turn:127.0.0.1:badport"},
+	})
+	assert.Error(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:               conn,
+		TURNServerAddrs:    []string{rejecting.LocalAddr().String(), "turn:127.0.0.1:3478?transport=udp"},
+		Username:           "foo",
+		Password:           "pass",
+		TransactionTimeout: 500 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	assert.Equal(t, rejecting.LocalAddr().String(), client.TURNServerAddr().String())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, udpListener.LocalAddr().String(), client.TURNServerAddr().String())
+	assert.Equal(t, int32(1), requests.Load())
+
+	// The working server is preferred for the next allocation
+	assert.NoError(t, relayConn.Close())
+	relayConn, err = client.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Failed servers are tried last
+	assert.NoError(t, relayConn.Close())
+	assert.NoError(t, server.Close())
+	_, err = client.AllocateContext(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+}
+
+type countingMetrics struct {
+	mutex            sync.Mutex
+	sent             map[stun.Method]int
+	retransmitted    map[stun.Method]int
+	allocationErrors []stun.ErrorCode
+	bytesSent        int
+	bytesReceived    int
+	channels         []int
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		sent:          map[stun.Method]int{},
+		retransmitted: map[stun.Method]int{},
+	}
+}
+
+func (m *countingMetrics) TransactionSent(method stun.Method) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sent[method]++
+}
+
+func (m *countingMetrics) TransactionRetransmitted(method stun.Method) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retransmitted[method]++
+}
+
+func (m *countingMetrics) AllocationFailed(code stun.ErrorCode) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.allocationErrors = append(m.allocationErrors, code)
+}
+
+func (m *countingMetrics) BytesSent(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bytesSent += n
+}
+
+func (m *countingMetrics) BytesReceived(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bytesReceived += n
+}
+
+func (m *countingMetrics) Channels(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.channels = append(m.channels, n)
+}
+
+func TestClientMetrics(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	rejecting, _ := rejectingServer(t)
+	defer rejecting.Close() //nolint:errcheck
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	metrics := newCountingMetrics()
+	client, err := NewClient(&ClientConfig{
+		Conn:            conn,
+		TURNServerAddr:  silent.LocalAddr().String(),
+		TURNServerAddrs: []string{rejecting.LocalAddr().String(), udpListener.LocalAddr().String()},
+		Username:        "foo",
+		Password:        "pass",
+		RTO:             10 * time.Millisecond,
+		MaxRequests:     2,
+		Metrics:         metrics,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, err = relayConn.WriteTo([]byte("Hello"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	n, from, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", string(buf[:n]))
+	_, err = peer.WriteTo([]byte("World!"), from)
+	require.NoError(t, err)
+	_, _, err = relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	assert.NoError(t, relayConn.Close())
+
+	metrics.mutex.Lock()
+	assert.Equal(t, 1, metrics.retransmitted[stun.MethodAllocate]) // Silent server
+	assert.Equal(t, []stun.ErrorCode{0, stun.CodeInsufficientCapacity}, metrics.allocationErrors)
+	assert.Equal(t, 4, metrics.sent[stun.MethodAllocate])
+	assert.Equal(t, 5, metrics.bytesSent)
+	assert.Equal(t, 6, metrics.bytesReceived)
+	assert.Equal(t, 1, metrics.channels[0])
+	assert.Equal(t, 0, metrics.channels[len(metrics.channels)-1])
+	metrics.mutex.Unlock()
+
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientRTTStats(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	unresponsive := make(chan net.Addr, 2)
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+		RTO:            50 * time.Millisecond,
+		MaxRequests:    3,
+		OnServerUnresponsive: func(server net.Addr) {
+			unresponsive <- server
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	assert.Zero(t, client.RTTStats().LossRate())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	stats := client.RTTStats()
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(2), stats.Responses)
+	assert.Greater(t, stats.LatestRTT, time.Duration(0))
+	assert.Greater(t, stats.SmoothedRTT, time.Duration(0))
+	assert.Zero(t, stats.LossRate())
+
+	// The server stops responding
+	assert.NoError(t, server.Close())
+	peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+	assert.Error(t, client.CreatePermission(peer))
+	assert.Error(t, client.CreatePermission(peer))
+
+	select {
+	case addr := <-unresponsive:
+		assert.Equal(t, udpListener.LocalAddr().String(), addr.String())
+	case <-time.After(time.Second):
+		assert.Fail(t, "server not reported unresponsive")
+	}
+	assert.Empty(t, unresponsive, "reported once")
+
+	stats = client.RTTStats()
+	assert.Equal(t, int64(2), stats.Timeouts)
+	assert.Equal(t, int64(4), stats.Retransmissions)
+	assert.Equal(t, int64(8), stats.Requests)
+	assert.Equal(t, 0.75, stats.LossRate())
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+}
+
+func TestClientKeepalive(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	_, err = NewClient(&ClientConfig{Conn: conn, KeepaliveInterval: -time.Second})
+	assert.ErrorIs(t, err, errInvalidClientTimeout)
+	_, err = NewClient(&ClientConfig{Conn: conn, RefreshJitter: 1})
+	assert.ErrorIs(t, err, errInvalidRefreshJitter)
+
+	metrics := newCountingMetrics()
+	client, err := NewClient(&ClientConfig{
+		Conn:              conn,
+		TURNServerAddr:    udpListener.LocalAddr().String(),
+		Username:          "foo",
+		Password:          "pass",
+		Metrics:           metrics,
+		KeepaliveInterval: 50 * time.Millisecond,
+		RefreshInterval:   100 * time.Millisecond,
+		RefreshJitter:     0.2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+
+	metrics.mutex.Lock()
+	assert.GreaterOrEqual(t, metrics.sent[stun.MethodBinding], 5)
+	assert.GreaterOrEqual(t, metrics.sent[stun.MethodRefresh], 3)
+	metrics.mutex.Unlock()
+
+	// Keepalives are answered
+	assert.Zero(t, client.RTTStats().Timeouts)
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientAllocationLost(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	lost := make(chan net.Addr, 1)
+	client, err := NewClient(&ClientConfig{
+		Conn:            conn,
+		TURNServerAddr:  udpListener.LocalAddr().String(),
+		Username:        "foo",
+		Password:        "pass",
+		RTO:             20 * time.Millisecond,
+		MaxRequests:     2,
+		RefreshInterval: 100 * time.Millisecond,
+		OnAllocationLost: func(relayedAddr net.Addr, err error) {
+			assert.Error(t, err)
+			lost <- relayedAddr
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	// Without a server, the next refresh times out
+	require.NoError(t, server.Close())
+
+	select {
+	case relayedAddr := <-lost:
+		assert.Equal(t, relayConn.LocalAddr(), relayedAddr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("allocation loss was not reported")
+	}
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+}
+
+// requestRecordingConn records the requests written to it
+type requestRecordingConn struct {
+	net.PacketConn
+	mutex    sync.Mutex
+	requests []*stun.Message
+}
+
+func (c *requestRecordingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	msg := &stun.Message{Raw: append([]byte(nil), p...)}
+	if stun.IsMessage(p) && msg.Decode() == nil && msg.Type.Class == stun.ClassRequest {
+		c.mutex.Lock()
+		c.requests = append(c.requests, msg)
+		c.mutex.Unlock()
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestClientRequestAttributes(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	udpConn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+	conn := &requestRecordingConn{PacketConn: udpConn}
+
+	custom := stun.RawAttribute{Type: 0x8f00, Value: []byte("build-42")}
+	client, err := NewClient(&ClientConfig{
+		Conn:              conn,
+		STUNServerAddr:    udpListener.LocalAddr().String(),
+		TURNServerAddr:    udpListener.LocalAddr().String(),
+		Username:          "foo",
+		Password:          "pass",
+		Software:          "pion/test",
+		RequestAttributes: []stun.Setter{custom},
+		KeepaliveInterval: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	_, err = client.SendBindingRequest()
+	require.NoError(t, err)
+
+	// The server accepts the authenticated requests
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+	require.NoError(t, client.CreatePermission(peer))
+	require.NoError(t, client.BindChannel(peer))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, relayConn.Close())
+
+	conn.mutex.Lock()
+	methods := map[stun.Method]bool{}
+	for _, req := range conn.requests {
+		methods[req.Type.Method] = true
+
+		var software stun.Software
+		assert.NoError(t, software.GetFrom(req), req.Type)
+		assert.Equal(t, "pion/test", software.String())
+
+		attr, ok := req.Attributes.Get(custom.Type)
+		assert.True(t, ok, req.Type)
+		assert.Equal(t, custom.Value, attr.Value)
+	}
+	conn.mutex.Unlock()
+	for _, method := range []stun.Method{
+		stun.MethodBinding, stun.MethodAllocate, stun.MethodCreatePermission,
+		stun.MethodChannelBind, stun.MethodRefresh,
+	} {
+		assert.True(t, methods[method], method)
+	}
+
+	client.Close()
+	assert.NoError(t, udpConn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientCredentialsProvider(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			if username != "1700000000:alice" {
+				return nil, false
+			}
+			return GenerateAuthKey(username, realm, "secret"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	var realms []string
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "ignored",
+		Password:       "ignored",
+		CredentialsProvider: func(realm string) (string, string) {
+			realms = append(realms, realm)
+			return "1700000000:alice", "secret"
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pion.ly"}, realms)
+	assert.Equal(t, "1700000000:alice", client.Username().String())
+
+	// Requests of the allocation use the provided credentials
+	require.NoError(t, client.CreatePermission(&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}))
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientMux(t *testing.T) {
+	var listeners []net.PacketConn
+	var configs []PacketConnConfig
+	for _, addr := range []string{"127.0.0.1:3478", "127.0.0.1:3479"} {
+		udpListener, err := net.ListenPacket("udp4", addr)
+		require.NoError(t, err)
+		listeners = append(listeners, udpListener)
+		configs = append(configs, PacketConnConfig{
+			PacketConn: udpListener,
+			RelayAddressGenerator: &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "0.0.0.0",
+			},
+		})
+	}
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, username+"-pass"), true
+		},
+		PacketConnConfigs: configs,
+		Realm:             "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	_, err = NewClientMux(ClientMuxConfig{})
+	assert.ErrorIs(t, err, errNilConn)
+
+	mux, err := NewClientMux(ClientMuxConfig{Conn: conn})
+	require.NoError(t, err)
+	require.NoError(t, mux.Listen())
+
+	var clients []*Client
+	var relayConns []net.PacketConn
+	for i, listener := range listeners {
+		username := "user" + strconv.Itoa(i)
+		client, err := mux.NewClient(&ClientConfig{
+			STUNServerAddr: listeners[0].LocalAddr().String(),
+			TURNServerAddr: listener.LocalAddr().String(),
+			Username:       username,
+			Password:       username + "-pass",
+		})
+		require.NoError(t, err)
+		clients = append(clients, client)
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		relayConns = append(relayConns, relayConn)
+	}
+	assert.NotEqual(t, relayConns[0].LocalAddr().String(), relayConns[1].LocalAddr().String())
+
+	// One allocation per server
+	_, err = mux.NewClient(&ClientConfig{TURNServerAddr: listeners[1].LocalAddr().String()})
+	assert.ErrorIs(t, err, errMuxServerInUse)
+	_, err = mux.NewClient(&ClientConfig{Redial: func() (net.PacketConn, error) { return nil, net.ErrClosed }})
+	assert.ErrorIs(t, err, errMuxRedial)
+
+	// Both clients get the responses of the shared STUN server
+	for _, client := range clients {
+		mapped, err := client.SendBindingRequest()
+		require.NoError(t, err)
+		assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, mapped.(*net.UDPAddr).Port) //nolint:forcetypeassert
+	}
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	for i, relayConn := range relayConns {
+		_, err = relayConn.WriteTo([]byte{byte(i)}, peer.LocalAddr())
+		require.NoError(t, err)
+
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{byte(i)}, buf[:n])
+		assert.Equal(t, relayConn.LocalAddr().String(), from.String())
+
+		_, err = peer.WriteTo([]byte("echo"), from)
+		require.NoError(t, err)
+		n, _, err = relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "echo", string(buf[:n]))
+	}
+
+	for _, relayConn := range relayConns {
+		assert.NoError(t, relayConn.Close())
+	}
+	mux.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientAllocateChained(t *testing.T) {
+	var listeners []net.PacketConn
+	var configs []PacketConnConfig
+	for _, addr := range []string{"127.0.0.1:3478", "127.0.0.1:3479"} {
+		udpListener, err := net.ListenPacket("udp4", addr)
+		require.NoError(t, err)
+		listeners = append(listeners, udpListener)
+		configs = append(configs, PacketConnConfig{
+			PacketConn: udpListener,
+			RelayAddressGenerator: &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "0.0.0.0",
+			},
+		})
+	}
+
+	var relayAddr atomic.Value
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+			if username == "second" {
+				relayAddr.Store(srcAddr.String())
+			}
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: configs,
+		Realm:             "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: listeners[0].LocalAddr().String(),
+		Username:       "first",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	chainedConn, err := client.AllocateChained(&ClientConfig{
+		TURNServerAddr: listeners[1].LocalAddr().String(),
+		Username:       "second",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+
+	// The second server is reached through the relay of the first
+	firstRelay := client.relayedUDPConn()
+	require.NotNil(t, firstRelay)
+	assert.Equal(t, firstRelay.LocalAddr().String(), relayAddr.Load())
+	assert.NotEqual(t, firstRelay.LocalAddr().String(), chainedConn.LocalAddr().String())
+	_, err = client.Allocate()
+	assert.ErrorIs(t, err, errAlreadyAllocated)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, err = chainedConn.WriteTo([]byte("Hello"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	n, from, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", string(buf[:n]))
+	assert.Equal(t, chainedConn.LocalAddr().String(), from.String())
+
+	_, err = peer.WriteTo([]byte("World"), from)
+	require.NoError(t, err)
+	n, from, err = chainedConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "World", string(buf[:n]))
+	assert.Equal(t, peer.LocalAddr().String(), from.String())
+
+	// Both allocations are released
+	assert.NoError(t, chainedConn.Close())
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.NoError(t, relayConn.Close())
+
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientMappedAddress(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		STUNServerAddr: udpListener.LocalAddr().String(),
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	assert.Nil(t, client.MappedAddress())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	require.NotNil(t, client.MappedAddress())
+	assert.Equal(t, conn.LocalAddr().String(), client.MappedAddress().String())
+
+	mapped, err := client.SendBindingRequest()
+	require.NoError(t, err)
+	assert.Equal(t, mapped.String(), client.MappedAddress().String())
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientReceiveStats(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	_, err = NewClient(&ClientConfig{Conn: conn, ReceiveQueueSize: -1})
+	assert.ErrorIs(t, err, errInvalidReceiveQueueSize)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:             conn,
+		TURNServerAddr:   udpListener.LocalAddr().String(),
+		Username:         "foo",
+		Password:         "pass",
+		ReceiveQueueSize: 4,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	assert.Equal(t, ReceiveStats{}, client.ReceiveStats())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, err = relayConn.WriteTo([]byte("permit"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	// The application does not read while the peer sends
+	for i := 0; i < 10; i++ {
+		_, err = peer.WriteTo([]byte("data"), relayConn.LocalAddr())
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		stats := client.ReceiveStats()
+		return stats.Queued+int(stats.Dropped) == 10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := client.ReceiveStats()
+	assert.Equal(t, 4, stats.Queued)
+	assert.Equal(t, 4, stats.Capacity)
+	assert.Equal(t, uint64(6), stats.Dropped)
+	assert.Equal(t, uint64(1), stats.Overflows)
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientBindingIntrospection(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	assert.Nil(t, client.Permissions())
+	assert.Nil(t, client.ChannelBindings())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	now := time.Now()
+	_, err = relayConn.WriteTo([]byte("permit"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	perms := client.Permissions()
+	require.Len(t, perms, 1)
+	assert.Equal(t, peer.LocalAddr().String(), perms[0].Peer.String())
+	assert.True(t, perms[0].Permitted)
+	assert.WithinDuration(t, now.Add(5*time.Minute), perms[0].ExpiresAt, 5*time.Second)
+
+	// The channel is bound in the background after the first write
+	assert.Eventually(t, func() bool {
+		bindings := client.ChannelBindings()
+		return len(bindings) == 1 && bindings[0].Bound
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bindings := client.ChannelBindings()
+	assert.GreaterOrEqual(t, bindings[0].Number, uint16(proto.MinChannelNumber))
+	assert.Equal(t, peer.LocalAddr().String(), bindings[0].Peer.String())
+	assert.WithinDuration(t, now.Add(10*time.Minute), bindings[0].ExpiresAt, 5*time.Second)
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestClientWriteToBuffers(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			config := ServerConfig{
+				AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+					return GenerateAuthKey(username, realm, "pass"), true
+				},
+				Realm: "pion.ly",
+			}
+			relayAddressGenerator := &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "0.0.0.0",
+			}
+
+			var conn net.PacketConn
+			var serverAddr string
+			if network == "udp" {
+				udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+				require.NoError(t, err)
+				config.PacketConnConfigs = []PacketConnConfig{
+					{PacketConn: udpListener, RelayAddressGenerator: relayAddressGenerator},
+				}
+				serverAddr = udpListener.LocalAddr().String()
+
+				conn, err = net.ListenPacket("udp4", "0.0.0.0:0")
+				require.NoError(t, err)
+			} else {
+				tcpListener, err := net.Listen("tcp4", "127.0.0.1:13478")
+				require.NoError(t, err)
+				config.ListenerConfigs = []ListenerConfig{
+					{Listener: tcpListener, RelayAddressGenerator: relayAddressGenerator},
+				}
+				serverAddr = tcpListener.Addr().String()
+
+				tcpConn, err := net.Dial("tcp", serverAddr)
+				require.NoError(t, err)
+				conn = NewSTUNConn(tcpConn)
+			}
+
+			server, err := NewServer(config)
+			require.NoError(t, err)
+
+			client, err := NewClient(&ClientConfig{
+				Conn:           conn,
+				TURNServerAddr: serverAddr,
+				Username:       "foo",
+				Password:       "pass",
+			})
+			require.NoError(t, err)
+			require.NoError(t, client.Listen())
+
+			relayConn, err := client.Allocate()
+			require.NoError(t, err)
+			writer, ok := relayConn.(interface {
+				WriteToBuffers(bufs net.Buffers, addr net.Addr) (int, error)
+			})
+			require.True(t, ok)
+
+			peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			// The first packet is sent in a Send indication, the second as ChannelData
+			// once the channel is bound
+			buf := make([]byte, 64)
+			for i := 0; i < 2; i++ {
+				n, err := writer.WriteToBuffers(net.Buffers{[]byte("Hel"), []byte("lo")}, peer.LocalAddr())
+				require.NoError(t, err)
+				assert.Equal(t, 5, n)
+
+				require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+				n, _, err = peer.ReadFrom(buf)
+				require.NoError(t, err)
+				assert.Equal(t, "Hello", string(buf[:n]))
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			assert.NoError(t, relayConn.Close())
+			client.Close()
+			assert.NoError(t, peer.Close())
+			assert.NoError(t, conn.Close())
+			assert.NoError(t, server.Close())
+		})
+	}
+}
+
+func TestClientCloseTimeout(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	_, err = NewClient(&ClientConfig{Conn: conn, CloseTimeout: -time.Second})
+	assert.ErrorIs(t, err, errInvalidClientTimeout)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+		CloseTimeout:   time.Second,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	// The server freed the allocation once Close returns
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.AllocationCount())
+	assert.NoError(t, relayConn.Close())
+	assert.Equal(t, 0, server.AllocationCount())
+
+	// Without a server, CloseContext gives up once the context is done
+	relayConn, err = client.Allocate()
+	require.NoError(t, err)
+	require.NoError(t, server.Close())
+
+	closer, ok := relayConn.(interface {
+		CloseContext(ctx context.Context) error
+	})
+	require.True(t, ok)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, closer.CloseContext(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+}
+
+// natServer is a STUN server supporting the NAT behavior discovery of RFC 5780 on
+// 127.0.0.1 and 127.0.0.2, which also simulates the mapping and filtering of a NAT
+// of the client
+func natServer(t *testing.T, mapping, filtering NATBehavior) (*net.UDPAddr, func()) {
+	var conns [2][2]net.PacketConn // By IP and port
+	ips := []string{"127.0.0.1", "127.0.0.2"}
+	for i, port := range []string{"0", "0"} {
+		conn, err := net.ListenPacket("udp4", net.JoinHostPort(ips[0], port))
+		require.NoError(t, err)
+		conns[0][i] = conn
+	}
+	for i := range conns[1] {
+		_, port, err := net.SplitHostPort(conns[0][i].LocalAddr().String())
+		require.NoError(t, err)
+		conn, err := net.ListenPacket("udp4", net.JoinHostPort(ips[1], port))
+		require.NoError(t, err)
+		conns[1][i] = conn
+	}
+
+	var mutex sync.Mutex
+	sentTo := map[string]bool{} // Server addresses the client sent to, opening the NAT for them
+	passes := func(from net.Addr) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch filtering {
+		case NATBehaviorAddressDependent:
+			fromIP := from.(*net.UDPAddr).IP //nolint:forcetypeassert
+			for _, conns := range conns {
+				for _, conn := range conns {
+					addr := conn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+					if sentTo[addr.String()] && addr.IP.Equal(fromIP) {
+						return true
+					}
+				}
+			}
+			return false
+		case NATBehaviorAddressAndPortDependent:
+			return sentTo[from.String()]
+		default:
+			return true
+		}
+	}
+
+	other := conns[1][1].LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+	for ip := range conns {
+		for port := range conns[ip] {
+			ip, port, conn := ip, port, conns[ip][port]
+			go func() {
+				buf := make([]byte, 1500)
+				for {
+					n, from, err := conn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+					if req.Decode() != nil {
+						continue
+					}
+					mutex.Lock()
+					sentTo[conn.LocalAddr().String()] = true
+					mutex.Unlock()
+
+					mapped := *from.(*net.UDPAddr) //nolint:forcetypeassert
+					switch mapping {
+					case NATBehaviorAddressDependent:
+						mapped.Port += ip
+					case NATBehaviorAddressAndPortDependent:
+						mapped.Port += ip + 2*port
+					}
+
+					respIP, respPort := ip, port
+					var change proto.ChangeRequest
+					if change.GetFrom(req) == nil {
+						if change.ChangeIP {
+							respIP ^= 1
+						}
+						if change.ChangePort {
+							respPort ^= 1
+						}
+					}
+					respConn := conns[respIP][respPort]
+					if !passes(respConn.LocalAddr()) {
+						continue
+					}
+
+					res, err := stun.Build(
+						stun.NewTransactionIDSetter(req.TransactionID),
+						stun.BindingSuccess,
+						&stun.XORMappedAddress{IP: mapped.IP, Port: mapped.Port},
+						&stun.OtherAddress{IP: other.IP, Port: other.Port},
+					)
+					if err == nil {
+						_, _ = respConn.WriteTo(res.Raw, from)
+					}
+				}
+			}()
+		}
+	}
+
+	return conns[0][0].LocalAddr().(*net.UDPAddr), func() { //nolint:forcetypeassert
+		for _, conns := range conns {
+			for _, conn := range conns {
+				assert.NoError(t, conn.Close())
+			}
+		}
+	}
+}
+
+func TestClientDetectNATBehavior(t *testing.T) {
+	for _, tc := range []struct {
+		mapping, filtering NATBehavior
+		noNAT              bool
+	}{
+		{NATBehaviorEndpointIndependent, NATBehaviorEndpointIndependent, true},
+		{NATBehaviorEndpointIndependent, NATBehaviorAddressDependent, false},
+		{NATBehaviorAddressDependent, NATBehaviorAddressAndPortDependent, false},
+		{NATBehaviorAddressAndPortDependent, NATBehaviorEndpointIndependent, false},
+	} {
+		tc := tc
+		t.Run(tc.mapping.String()+"/"+tc.filtering.String(), func(t *testing.T) {
+			server, closeServer := natServer(t, tc.mapping, tc.filtering)
+			defer closeServer()
+
+			localAddr := "0.0.0.0:0"
+			if tc.noNAT {
+				localAddr = "127.0.0.1:0"
+			}
+			conn, err := net.ListenPacket("udp4", localAddr)
+			require.NoError(t, err)
+
+			client, err := NewClient(&ClientConfig{
+				Conn:           conn,
+				STUNServerAddr: server.String(),
+				NATTestTimeout: 100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			require.NoError(t, client.Listen())
+
+			discovery, err := client.DetectNATBehavior()
+			require.NoError(t, err)
+			assert.Equal(t, tc.mapping, discovery.MappingBehavior)
+			assert.Equal(t, tc.filtering, discovery.FilteringBehavior)
+			assert.Equal(t, tc.noNAT, discovery.NoNAT)
+			assert.Equal(t, tc.mapping != NATBehaviorEndpointIndependent, discovery.RelayRequired())
+
+			// Unanswered tests are not timeouts of the server
+			assert.Zero(t, client.RTTStats().Timeouts)
+
+			client.Close()
+			assert.NoError(t, conn.Close())
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		server, _ := rejectingServer(t)
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+
+		client, err := NewClient(&ClientConfig{Conn: conn})
+		require.NoError(t, err)
+		_, err = client.DetectNATBehavior()
+		assert.ErrorIs(t, err, errSTUNServerAddressNotSet)
+
+		client, err = NewClient(&ClientConfig{
+			Conn:           conn,
+			STUNServerAddr: server.LocalAddr().String(),
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		_, err = client.DetectNATBehavior()
+		assert.ErrorIs(t, err, errNATDiscoveryUnsupported)
+
+		client.Close()
+		assert.NoError(t, conn.Close())
+		assert.NoError(t, server.Close())
+	})
+}
+
+func TestClientProbeBandwidth(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	_, err = client.ProbeBandwidth(context.Background(), BandwidthProbeConfig{})
+	assert.ErrorIs(t, err, errNoAllocation)
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	_, err = client.ProbeBandwidth(context.Background(), BandwidthProbeConfig{PacketSize: 10})
+	assert.ErrorIs(t, err, errInvalidProbeConfig)
+
+	// The probe packets loop through the relayed address
+	estimate, err := client.ProbeBandwidth(context.Background(), BandwidthProbeConfig{
+		Bitrate:    400000,
+		Duration:   300 * time.Millisecond,
+		PacketSize: 500,
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 30, estimate.Sent, 2)
+	assert.Equal(t, estimate.Sent, estimate.Received)
+	assert.Zero(t, estimate.Loss)
+	assert.Greater(t, estimate.Throughput, 0.0)
+	assert.Greater(t, estimate.Delay, time.Duration(0))
+
+	// No probe packet is left for the application
+	require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = relayConn.ReadFrom(make([]byte, 1500))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
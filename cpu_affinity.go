@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+// setThreadAffinity is only supported on Linux
+func setThreadAffinity(int) error {
+	return errCPUAffinityUnsupported
+}
@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import "golang.org/x/sys/unix"
+
+// setThreadAffinity runs the calling OS thread only on cpu, with
+// sched_setaffinity(2). The goroutine must be locked to the thread.
+func setThreadAffinity(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPacketConnCPUs(t *testing.T) {
+	_, err := NewServer(ServerConfig{PacketConnConfigs: []PacketConnConfig{{PacketConn: &net.UDPConn{}, CPUs: []int{-1}}}})
+	assert.ErrorIs(t, err, errInvalidCPU)
+
+	var allowed unix.CPUSet
+	require.NoError(t, unix.SchedGetaffinity(0, &allowed))
+	cpu := 0
+	for !allowed.IsSet(cpu) {
+		cpu++
+	}
+
+	t.Run("setThreadAffinity", func(t *testing.T) {
+		done := make(chan unix.CPUSet)
+		go func() {
+			runtime.LockOSThread() // The thread exits with the goroutine
+			var set unix.CPUSet
+			assert.NoError(t, setThreadAffinity(cpu))
+			assert.NoError(t, unix.SchedGetaffinity(0, &set))
+			done <- set
+		}()
+		set := <-done
+		assert.Equal(t, 1, set.Count())
+		assert.True(t, set.IsSet(cpu))
+	})
+
+	t.Run("pinned readers serve requests", func(t *testing.T) {
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		server, err := NewServer(ServerConfig{
+			PacketConnConfigs: []PacketConnConfig{{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+				CPUs: []int{cpu},
+			}},
+			PacketConnReaders: 2,
+			LoggerFactory:     logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		request, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+		require.NoError(t, err)
+		_, err = conn.WriteTo(request.Raw, serverConn.LocalAddr())
+		require.NoError(t, err)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = conn.ReadFrom(make([]byte, 1500))
+		assert.NoError(t, err)
+	})
+}
@@ -23,10 +23,96 @@ var (
 	errAllRetransmissionsFailed      = errors.New("all retransmissions failed for")
 	errChannelBindNotFound           = errors.New("no binding found for channel")
 	errSTUNServerAddressNotSet       = errors.New("STUN server address is not set for the client")
+	errTURNServerAddressNotSet       = errors.New("TURN server address is not set for the client")
 	errOneAllocateOnly               = errors.New("only one Allocate() caller is allowed")
 	errAlreadyAllocated              = errors.New("already allocated")
 	errNonSTUNMessage                = errors.New("non-STUN message from STUN server")
 	errFailedToDecodeSTUN            = errors.New("failed to decode STUN message")
 	errUnexpectedSTUNRequestMessage  = errors.New("unexpected STUN request message")
 	errRelayAddressGeneratorNil      = errors.New("RelayAddressGenerator is nil")
+	errInvalidRelayQueueSize         = errors.New("RelayQueueSize must not be negative")
+	errInvalidTableLimit             = errors.New("permission and channel binding limits must not be negative")
+	errInvalidEgressBandwidth        = errors.New("egress bandwidth must not be negative")
+	errInvalidAllocationLimit        = errors.New("ReservedAllocations must be between 0 and MaxAllocations")
+	errInvalidTimerResolution        = errors.New("TimerResolution must not be negative")
+	errInvalidLockoutConfig          = errors.New("LockoutConfig values must not be negative")
+	errInvalidChallengeRateLimit     = errors.New("ChallengeRateLimit must not be negative")
+	errInvalidGuestConfig            = errors.New("GuestConfig values must not be negative")
+	errInvalidMultiAuthConfig        = errors.New("MultiAuthConfig requires a handler")
+	errNoCredentialExpiry            = errors.New("StopAtCredentialExpiry requires CredentialExpiry")
+	errInvalidNonceMaxUses           = errors.New("NonceMaxUses must not be negative")
+	errInvalidNonceKey               = errors.New("NonceKey must be at least 32 bytes")
+	errFairQueueingWithoutRelayQueue = errors.New("fair queueing requires a relay queue size")
+	errInvalidMemoryBudget           = errors.New("MemoryBudgetConfig values must not be negative")
+	errMemoryBudgetWithoutRelayQueue = errors.New("a memory budget requires a relay queue size")
+	errConnBroken                    = errors.New("connection to the TURN server broke")
+	errNoAllocation                  = errors.New("no allocation")
+	errInvalidClientTimeout          = errors.New("timeouts and retry budget must not be negative")
+	errInvalidRetransmission         = errors.New("invalid retransmission policy")
+	errInvalidRefreshJitter          = errors.New("refresh jitter must be between 0 and 1")
+	errInvalidReceiveQueueSize       = errors.New("receive queue size must not be negative")
+	errMuxRedial                     = errors.New("clients of a mux can not redial")
+	errMuxServerInUse                = errors.New("another client of the mux uses the TURN server")
+	errTryAlternate                  = errors.New("try alternate server")
+	errRedirectLoop                  = errors.New("too many redirects to alternate servers")
+	errNATDiscoveryUnsupported       = errors.New("STUN server does not support NAT behavior discovery")
+	errNATTestNoResponse             = errors.New("no response to NAT behavior test")
+	errTURNServiceUnavailable        = errors.New("no TURN service available at the host")
+	errInvalidProbeConfig            = errors.New("invalid bandwidth probe config")
+	errWebhookNotHTTPS               = errors.New("webhook URL must be an https URL")
+	errInvalidWebhookResponse        = errors.New("invalid webhook response")
+	errAuthServiceDialUnset          = errors.New("AuthServiceConfig must have a Dial function")
+	errInvalidAuthServiceConfig      = errors.New("auth service pool size and timeout must not be negative")
+	errAuthServiceClosed             = errors.New("auth service client is closed")
+	errInvalidLDAPConfig             = errors.New("LDAPAuthConfig needs an ldap:// or ldaps:// URL, a BaseDN and a key or password attribute")
+	errLDAPNoUniqueEntry             = errors.New("no unique LDAP entry for the user")
+	errInvalidJWTConfig              = errors.New("JWTAuthConfig needs a SharedSecret, an Audience and an HMAC secret, RSA or P-256 VerificationKey")
+	errJWTMalformed                  = errors.New("malformed token")
+	errJWTAlgorithm                  = errors.New("token signed with an unexpected algorithm")
+	errJWTSignature                  = errors.New("invalid token signature")
+	errJWTExpired                    = errors.New("token expired")
+	errJWTNotYetValid                = errors.New("token not valid yet")
+	errJWTIssuer                     = errors.New("token from an unexpected issuer")
+	errJWTAudience                   = errors.New("token for another audience")
+	errInvalidSQLStoreConfig         = errors.New("SQLCredentialStoreConfig needs a DB, a Query and a valid Format")
+	errInvalidRADIUSConfig           = errors.New("RADIUSConfig needs an Addr and a Secret")
+	errNoTURNRESTSecret              = errors.New("TURNRESTAuthConfig needs at least one non-empty secret")
+	errInvalidSecretStoreConfig      = errors.New("SecretCredentialStoreConfig needs a Dir and a PollInterval that is not negative")
+	errInvalidSecretManagerConfig    = errors.New("SecretManagerStoreConfig needs a Source, and its durations must not be negative")
+	errInvalidPasswordAlgorithm      = errors.New("PasswordAlgorithms may only contain MD5 and SHA-256")
+	errNoSHA256AuthHandler           = errors.New("the SHA-256 password algorithm requires a SHA256AuthHandler")
+	errSecretManagerStatus           = errors.New("unexpected secret manager response")
+	errInvalidSecret                 = errors.New("invalid secret")
+
+	errInvalidReadBatchSize               = errors.New("ReadBatchSize must not be negative")
+	errIntegrityCalculatorWithAuthHandler = errors.New("an IntegrityCalculator replaces the AuthHandlers, they must not be set with it")
+	errConflictingAuthHandlers            = errors.New("only one of AuthHandler, PolicyAuthHandler, MultiKeyAuthHandler and RequestAuthHandler may be set")
+	errInvalidXDPConfig                   = errors.New("XDPChannelOffloaderConfig requires a PinPath")
+	errXDPUnsupported                     = errors.New("XDP offload is only supported on Linux")
+
+	errInvalidAFXDPConfig = errors.New("AFXDPConfig requires an Interface, an IPv4 LocalIP and a PinPath")
+	errInvalidAFXDPPort   = errors.New("AF_XDP ports must be between 1 and 65535")
+	errAFXDPPortInUse     = errors.New("AF_XDP port is already in use")
+	errAFXDPNotUDP        = errors.New("AF_XDP PacketConns only write to UDP addresses")
+	errAFXDPNotIPv4       = errors.New("AF_XDP PacketConns only write to IPv4 addresses")
+	errAFXDPNoRoute       = errors.New("no hardware address for the destination and no GatewayMAC")
+	errAFXDPUnsupported   = errors.New("AF_XDP is only supported on Linux")
+
+	errInvalidIOEngine    = errors.New("unknown IOEngine")
+	errIOURingUnsupported = errors.New("io_uring is only supported on Linux")
+	errEpollUnsupported   = errors.New("the epoll IOEngine is only supported on Linux")
+
+	errInvalidPacketConnReaders = errors.New("PacketConnReaders must not be negative")
+	errInvalidCPU               = errors.New("CPUs must not be negative")
+	errCPUAffinityUnsupported   = errors.New("CPU affinity is only supported on Linux")
+	errInvalidRequestWorkers    = errors.New("RequestWorkers and RequestQueueSize must not be negative")
+
+	errInvalidStreamWriteQueueSize = errors.New("StreamWriteQueueSize must not be negative")
+
+	errInvalidLogRateLimit = errors.New("LogRateLimit must not be negative")
+
+	errInvalidSocketBufferConfig = errors.New("SocketBufferConfig values must not be negative, nor MaxReadBuffer below ReadBuffer")
+	errSocketStatsUnsupported    = errors.New("socket stats are only supported for UDP sockets on Linux")
+
+	errExpvarPrefixInUse = errors.New("ExpvarPrefix is in use by another server or expvar")
 )
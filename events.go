@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the kind of an Event
+type EventType int
+
+const (
+	// EventAllocationCreated is an allocation that started relaying
+	EventAllocationCreated EventType = iota + 1
+	// EventAllocationDeleted is an allocation that was closed, on expiry, refresh with a
+	// lifetime of zero or failure of its relay socket
+	EventAllocationDeleted
+	// EventPermissionAdded is a permission installed for a new peer of an allocation.
+	// Refreshes of existing permissions are not events.
+	EventPermissionAdded
+	// EventQuotaExceeded is an Allocate request refused because the server, or the guests
+	// of a listener, reached their maximum number of allocations
+	EventQuotaExceeded
+	// EventAuthFailure is a request whose credentials were refused
+	EventAuthFailure
+	// EventListenerError is a PacketConn or Listener of the server that stopped on an
+	// error other than being closed, or a connection it failed to accept
+	EventListenerError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAllocationCreated:
+		return "allocation_created"
+	case EventAllocationDeleted:
+		return "allocation_deleted"
+	case EventPermissionAdded:
+		return "permission_added"
+	case EventQuotaExceeded:
+		return "quota_exceeded"
+	case EventAuthFailure:
+		return "auth_failure"
+	case EventListenerError:
+		return "listener_error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is something that happened in a Server, see Server.Subscribe. Only the fields of
+// its type are set.
+type Event struct {
+	Time time.Time
+	Type EventType
+
+	// Allocation of allocation and permission events
+	Allocation ServerAllocation
+
+	// Username and SrcAddr of the client of the request of auth failures and exceeded
+	// quotas, for allocation and permission events see Allocation
+	Username string
+	SrcAddr  net.Addr
+
+	// PeerIP is the peer of an added permission
+	PeerIP net.IP
+
+	// Listener is the local address of the PacketConn or Listener of a listener error
+	Listener net.Addr
+
+	// Err is the error of a listener error
+	Err error
+
+	// Detail tells why a request was refused
+	Detail string
+}
+
+// Subscription receives the Events of a Server, see Server.Subscribe
+type Subscription struct {
+	hub     *eventHub
+	events  chan Event
+	dropped atomic.Uint64
+}
+
+// Events returns the channel the events are delivered on. It is closed once the
+// subscription or the server is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the channel was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the delivery of events and closes the channel. Events still buffered
+// can be read after.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// eventHub delivers the events of a Server to its subscriptions
+type eventHub struct {
+	active atomic.Bool // Whether there are subscriptions, so events are only built for them
+
+	lock          sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+func (h *eventHub) subscribe(buffer int) *Subscription {
+	s := &Subscription{hub: h, events: make(chan Event, buffer)}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		close(s.events)
+		return s
+	}
+	if h.subscriptions == nil {
+		h.subscriptions = map[*Subscription]struct{}{}
+	}
+	h.subscriptions[s] = struct{}{}
+	h.active.Store(true)
+	return s
+}
+
+func (h *eventHub) unsubscribe(s *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.subscriptions[s]; !ok {
+		return
+	}
+	delete(h.subscriptions, s)
+	close(s.events)
+	h.active.Store(len(h.subscriptions) > 0)
+}
+
+// enabled returns whether events are delivered to anyone, which is only an
+// atomic load
+func (h *eventHub) enabled() bool {
+	return h.active.Load()
+}
+
+// publish delivers the event to every subscription without blocking, dropping it
+// for the subscriptions whose channel is full
+func (h *eventHub) publish(event Event) {
+	if !h.enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for s := range h.subscriptions {
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func (h *eventHub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for s := range h.subscriptions {
+		close(s.events)
+	}
+	h.subscriptions = nil
+	h.closed = true
+	h.active.Store(false)
+}
+
+// publishListenerError publishes the error a listener stopped or failed to accept on,
+// unless it was closed
+func (s *Server) publishListenerError(listener net.Addr, err error) {
+	if !s.events.enabled() || errors.Is(err, net.ErrClosed) {
+		return
+	}
+	s.events.publish(Event{Type: EventListenerError, Listener: listener, Err: err})
+}
+
+// Subscribe returns a Subscription to the events of the server, delivered on a channel
+// buffering up to buffer events. The goroutines of the server never wait for subscribers:
+// events that do not fit in the buffer are dropped and counted, see Subscription.Dropped.
+// Close the subscription once done with it; closing the server closes all of them.
+func (s *Server) Subscribe(buffer int) *Subscription {
+	return s.events.subscribe(buffer)
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent returns the next event of the subscription
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.Events():
+		require.True(t, ok, "subscription closed")
+		assert.False(t, event.Time.IsZero())
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "no event")
+		return Event{}
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.MaxAllocations = 1
+	})
+
+	sub := server.Subscribe(16)
+
+	newClient := func(username, password string) *Client {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: serverAddr.String(),
+			Conn:           conn,
+			Username:       username,
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		t.Cleanup(client.Close)
+		require.NoError(t, client.Listen())
+		return client
+	}
+
+	relayConn, err := newClient("alice", "pass").Allocate()
+	require.NoError(t, err)
+	created := nextEvent(t, sub)
+	assert.Equal(t, EventAllocationCreated, created.Type)
+	assert.Equal(t, "alice", created.Allocation.Username())
+	assert.Equal(t, relayConn.LocalAddr().String(), created.Allocation.RelayAddr().String())
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	require.NoError(t, err)
+	added := nextEvent(t, sub)
+	assert.Equal(t, EventPermissionAdded, added.Type)
+	assert.Equal(t, created.Allocation, added.Allocation)
+	assert.Equal(t, "127.0.0.1", added.PeerIP.String())
+
+	_, err = newClient("bob", "pass").Allocate()
+	assert.Error(t, err)
+	quota := nextEvent(t, sub)
+	assert.Equal(t, EventQuotaExceeded, quota.Type)
+	assert.Equal(t, "bob", quota.Username)
+	assert.NotNil(t, quota.SrcAddr)
+
+	_, err = newClient("bob", "wrong").Allocate()
+	assert.Error(t, err)
+	failure := nextEvent(t, sub)
+	assert.Equal(t, EventAuthFailure, failure.Type)
+	assert.Equal(t, "bob", failure.Username)
+	assert.Equal(t, "integrity check failed", failure.Detail)
+
+	require.NoError(t, relayConn.Close())
+	deleted := nextEvent(t, sub)
+	assert.Equal(t, EventAllocationDeleted, deleted.Type)
+	assert.Equal(t, created.Allocation, deleted.Allocation)
+	assert.Equal(t, uint64(0), sub.Dropped())
+
+	// Closing the server closes the subscriptions, and only reports listener errors
+	// other than being closed
+	require.NoError(t, server.Close())
+	for event := range sub.Events() {
+		assert.NotEqual(t, EventListenerError, event.Type)
+	}
+	_, ok := <-server.Subscribe(1).Events()
+	assert.False(t, ok)
+}
+
+// failingPacketConn fails to read with err
+type failingPacketConn struct {
+	net.PacketConn
+	err error
+}
+
+func (c *failingPacketConn) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, c.err
+}
+
+func TestServerListenerErrorEvent(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	errRead := errors.New("read failed")
+	failing := &failingPacketConn{PacketConn: conn, err: errRead}
+	server, err := NewServer(ServerConfig{
+		PacketConnConfigs: []PacketConnConfig{{PacketConn: failing}},
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	// The reader may fail before the subscription, so another one is started after
+	sub := server.Subscribe(1)
+	defer sub.Close()
+	go server.readLoop(failing, server.allocationManagers[0], nil, "", false)
+
+	event := nextEvent(t, sub)
+	assert.Equal(t, EventListenerError, event.Type)
+	assert.Equal(t, conn.LocalAddr(), event.Listener)
+	assert.ErrorIs(t, event.Err, errRead)
+}
+
+func TestSubscriptionDropsEvents(t *testing.T) {
+	hub := &eventHub{}
+	hub.publish(Event{Type: EventAuthFailure}) // Nobody subscribed
+
+	sub := hub.subscribe(1)
+	other := hub.subscribe(2)
+	for i := 0; i < 3; i++ {
+		hub.publish(Event{Type: EventAuthFailure})
+	}
+	assert.Equal(t, uint64(2), sub.Dropped())
+	assert.Equal(t, uint64(1), other.Dropped())
+
+	sub.Close()
+	sub.Close()
+	assert.True(t, hub.enabled())
+	assert.Len(t, sub.Events(), 1, "buffered events can be read after closing")
+
+	other.Close()
+	assert.False(t, hub.enabled())
+	hub.publish(Event{Type: EventAuthFailure})
+	assert.Len(t, other.Events(), 2)
+}
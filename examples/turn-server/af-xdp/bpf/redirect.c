@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// redirect hands the UDP datagrams to the ports a turn.AFXDPBackend listens
+// on to its AF_XDP socket of the queue they arrived on. Everything else is
+// passed to the stack.
+
+#include <linux/bpf.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/udp.h>
+#include <bpf/bpf_endian.h>
+#include <bpf/bpf_helpers.h>
+
+#define MAX_QUEUES 64
+#define MAX_PORTS 65536
+
+// The AF_XDP socket of every queue
+struct {
+	__uint(type, BPF_MAP_TYPE_XSKMAP);
+	__uint(max_entries, MAX_QUEUES);
+	__type(key, __u32);
+	__type(value, __u32);
+} turn_xsks SEC(".maps");
+
+// The ports of the backend, in network byte order
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_PORTS);
+	__type(key, __be16);
+	__type(value, __u8);
+} turn_ports SEC(".maps");
+
+struct headers {
+	struct ethhdr eth;
+	struct iphdr ip;
+	struct udphdr udp;
+} __attribute__((packed));
+
+SEC("xdp")
+int turn_redirect(struct xdp_md *ctx)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct headers *h = data;
+
+	if ((void *)(h + 1) > data_end)
+		return XDP_PASS;
+	if (h->eth.h_proto != bpf_htons(ETH_P_IP) || h->ip.ihl != 5 || h->ip.protocol != IPPROTO_UDP)
+		return XDP_PASS;
+	if (h->ip.frag_off & bpf_htons(0x3fff)) // Fragments go through the stack
+		return XDP_PASS;
+
+	__be16 port = h->udp.dest;
+	if (!bpf_map_lookup_elem(&turn_ports, &port))
+		return XDP_PASS;
+	return bpf_redirect_map(&turn_xsks, ctx->rx_queue_index, XDP_PASS);
+}
+
+char LICENSE[] SEC("license") = "Dual MIT/GPL";
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package main implements a TURN server that sends and receives with AF_XDP sockets
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	"github.com/pion/turn/v4"
+)
+
+func main() {
+	publicIP := flag.String("public-ip", "", "IP Address that TURN can be contacted by, owned by this host.")
+	port := flag.Int("port", 3478, "Listening port.")
+	users := flag.String("users", "", "List of username and password (e.g. \"user=pass,user=pass\")")
+	realm := flag.String("realm", "pion.ly", "Realm (defaults to \"pion.ly\")")
+	iface := flag.String("interface", "eth0", "Interface the redirect program is attached to.")
+	queues := flag.Int("queues", 1, "Number of RX queues of the interface.")
+	gateway := flag.String("gateway-mac", "", "Hardware address of the default router.")
+	pinPath := flag.String("pin-path", "/sys/fs/bpf/turn", "Directory the maps of the redirect program are pinned in.")
+	minPort := flag.Int("min-port", 49152, "Minimum relay port.")
+	maxPort := flag.Int("max-port", 65535, "Maximum relay port.")
+	flag.Parse()
+
+	if len(*publicIP) == 0 {
+		log.Fatalf("'public-ip' is required")
+	} else if len(*users) == 0 {
+		log.Fatalf("'users' is required")
+	}
+
+	var gatewayMAC net.HardwareAddr
+	if *gateway != "" {
+		var err error
+		if gatewayMAC, err = net.ParseMAC(*gateway); err != nil {
+			log.Fatalf("Invalid 'gateway-mac': %s", err)
+		}
+	}
+
+	backend, err := turn.NewAFXDPBackend(turn.AFXDPConfig{
+		Interface:  *iface,
+		Queues:     *queues,
+		LocalIP:    net.ParseIP(*publicIP),
+		GatewayMAC: gatewayMAC,
+		PinPath:    *pinPath,
+	})
+	if err != nil {
+		log.Panicf("Failed to create the AF_XDP backend: %s", err)
+	}
+
+	udpListener, err := backend.ListenPacket(*port)
+	if err != nil {
+		log.Panicf("Failed to create TURN server listener: %s", err)
+	}
+
+	usersMap := map[string][]byte{}
+	for _, kv := range regexp.MustCompile(`(\w+)=(\w+)`).FindAllStringSubmatch(*users, -1) {
+		usersMap[kv[1]] = turn.GenerateAuthKey(kv[1], *realm, kv[2])
+	}
+
+	s, err := turn.NewServer(turn.ServerConfig{
+		Realm: *realm,
+		AuthHandler: func(username string, realm string, srcAddr net.Addr) ([]byte, bool) { // nolint: revive
+			if key, ok := usersMap[username]; ok {
+				return key, true
+			}
+			return nil, false
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				// The relay sockets bypass the kernel as well
+				RelayAddressGenerator: &turn.RelayAddressGeneratorAFXDP{
+					Backend: backend,
+					MinPort: uint16(*minPort),
+					MaxPort: uint16(*maxPort),
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// Block until user sends SIGINT or SIGTERM
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	if err = s.Close(); err != nil {
+		log.Panic(err)
+	}
+	if err = backend.Close(); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !wasm
+
+// Package main creates a large number of concurrent allocations on a TURN server running
+// in the same process, and reports the goroutines and heap every allocation costs
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof" //nolint:gosec
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+)
+
+const (
+	realm    = "pion.ly"
+	username = "stress"
+	password = "stress"
+)
+
+var errTCPRelayUnsupported = errors.New("TCP relays are not supported")
+
+// loopbackRelays spreads the relay sockets over several loopback IPs, as a single IP
+// runs out of ephemeral ports long before 100k allocations
+type loopbackRelays struct {
+	ips  []net.IP
+	next atomic.Uint32
+}
+
+func (g *loopbackRelays) Validate() error { return nil }
+
+func (g *loopbackRelays) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	ip := g.ips[int(g.next.Add(1))%len(g.ips)]
+	conn, err := net.ListenPacket(network, net.JoinHostPort(ip.String(), strconv.Itoa(requestedPort)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, conn.LocalAddr(), nil
+}
+
+func (g *loopbackRelays) AllocateConn(string, int) (net.Conn, net.Addr, error) {
+	return nil, nil, errTCPRelayUnsupported
+}
+
+func loopbackIPs(third byte, n int) []net.IP {
+	ips := make([]net.IP, n)
+	for i := range ips {
+		ips[i] = net.IPv4(127, 0, third, byte(i+1))
+	}
+	return ips
+}
+
+func main() {
+	allocations := flag.Int("allocations", 100000, "Number of allocations to create")
+	relayIPs := flag.Int("relay-ips", 8, "Number of loopback IPs 127.0.1.x the relay sockets are spread over")
+	clientIPs := flag.Int("client-ips", 8, "Number of loopback IPs 127.0.2.x the clients are spread over")
+	concurrency := flag.Int("concurrency", 256, "Number of allocations created at the same time")
+	readers := flag.Int("readers", runtime.NumCPU(), "Number of goroutines reading the listener")
+	timerResolution := flag.Duration("timer-resolution", time.Second, "Resolution of the lifetime timers, 0 for a runtime timer each")
+	sharedReaders := flag.Bool("shared-relay-readers", false, "Read the relay sockets from an epoll loop per CPU instead of a goroutine each, Linux only")
+	labels := flag.Bool("labels", true, "Label the goroutines of every allocation with pprof labels")
+	pprofAddr := flag.String("pprof", "", "Address to serve net/http/pprof on, e.g. localhost:6060")
+	hold := flag.Bool("hold", false, "Keep the allocations until interrupted, e.g. to take profiles")
+	flag.Parse()
+
+	if *relayIPs < 1 || *relayIPs > 254 || *clientIPs < 1 || *clientIPs > 254 {
+		log.Fatalf("'relay-ips' and 'client-ips' must be between 1 and 254")
+	}
+	if *pprofAddr != "" {
+		go func() {
+			log.Println(http.ListenAndServe(*pprofAddr, nil)) //nolint:gosec
+		}()
+	}
+
+	// Every allocation holds a relay socket and its client a socket, see ulimit -n
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:3478")
+	if err != nil {
+		log.Fatalf("Failed to create TURN server listener: %s", err)
+	}
+	key := turn.GenerateAuthKey(username, realm, password)
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.DefaultLogLevel = logging.LogLevelError
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(string, string, net.Addr) ([]byte, bool) {
+			return key, true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            serverConn,
+			RelayAddressGenerator: &loopbackRelays{ips: loopbackIPs(1, *relayIPs)},
+		}},
+		PacketConnReaders:  *readers,
+		TimerResolution:    *timerResolution,
+		CacheSessionKeys:   true,
+		SharedRelayReaders: *sharedReaders,
+		ProfilerLabels:     *labels,
+		LoggerFactory:      loggerFactory,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	goroutines, heap := usage()
+	start := time.Now()
+	clients, failed := allocate(serverConn.LocalAddr(), loopbackIPs(2, *clientIPs), *allocations, *concurrency)
+	elapsed := time.Since(start)
+	allocatedGoroutines, allocatedHeap := usage()
+
+	created := server.AllocationCount()
+	fmt.Printf("Created %d allocations in %s, %d failed\n", created, elapsed.Round(time.Millisecond), failed)
+	if created > 0 {
+		// The sockets of the clients are included, they run in the same process
+		fmt.Printf("Goroutines: %d, %.2f per allocation\n", allocatedGoroutines, float64(allocatedGoroutines-goroutines)/float64(created))
+		fmt.Printf("Heap in use: %d MiB, %d bytes per allocation\n", allocatedHeap>>20, (int64(allocatedHeap)-int64(heap))/int64(created))
+	}
+
+	if *hold {
+		fmt.Println("Holding the allocations, interrupt to stop")
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+	}
+
+	if err = server.Close(); err != nil {
+		log.Printf("Failed to close TURN server: %s", err)
+	}
+	for _, conn := range clients {
+		_ = conn.Close()
+	}
+}
+
+// usage returns the goroutines and the bytes of the heap in use once collected
+func usage() (int, uint64) {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return runtime.NumGoroutine(), stats.HeapInuse
+}
+
+// allocate creates n allocations, each from a socket of its own, with concurrency
+// of them at a time. The sockets are returned open so the allocations stay distinct.
+func allocate(server net.Addr, ips []net.IP, n, concurrency int) ([]net.PacketConn, int) {
+	var lock sync.Mutex
+	clients := make([]net.PacketConn, 0, n)
+	var failed atomic.Int64
+	var next atomic.Int64
+
+	var workers sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			buf := make([]byte, 1500)
+			for i := next.Add(1) - 1; i < int64(n); i = next.Add(1) - 1 {
+				conn, err := net.ListenPacket("udp4", net.JoinHostPort(ips[int(i)%len(ips)].String(), "0"))
+				if err != nil {
+					log.Printf("Failed to create client socket: %s", err)
+					failed.Add(1)
+					continue
+				}
+				if err = allocateFrom(conn, server, buf); err != nil {
+					log.Printf("Failed to allocate from %s: %s", conn.LocalAddr(), err)
+					failed.Add(1)
+					_ = conn.Close()
+					continue
+				}
+				lock.Lock()
+				clients = append(clients, conn)
+				lock.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	return clients, int(failed.Load())
+}
+
+// allocateFrom sends an Allocate request, and sends it again with the credentials once
+// challenged
+func allocateFrom(conn net.PacketConn, server net.Addr, buf []byte) error {
+	requestedTransport := stun.RawAttribute{Type: stun.AttrRequestedTransport, Value: []byte{17, 0, 0, 0}} // UDP
+
+	res, err := roundTrip(conn, server, buf, requestedTransport, stun.Fingerprint)
+	if err != nil {
+		return err
+	}
+	var nonce stun.Nonce
+	if err = nonce.GetFrom(res); err != nil {
+		return err
+	}
+
+	res, err = roundTrip(conn, server, buf, requestedTransport,
+		stun.NewUsername(username), stun.NewRealm(realm), nonce,
+		stun.NewLongTermIntegrity(username, realm, password), stun.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if res.Type.Class != stun.ClassSuccessResponse {
+		var code stun.ErrorCodeAttribute
+		_ = code.GetFrom(res)
+		return fmt.Errorf("allocate failed: %s", code) //nolint:goerr113
+	}
+	return nil
+}
+
+// roundTrip sends an Allocate request with attrs until it is answered
+func roundTrip(conn net.PacketConn, server net.Addr, buf []byte, attrs ...stun.Setter) (*stun.Message, error) {
+	req, err := stun.Build(append([]stun.Setter{stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest)}, attrs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if _, err = conn.WriteTo(req.Raw, server); err != nil {
+			return nil, err
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			return nil, err
+		}
+		n, _, err := conn.ReadFrom(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && attempt < 5 {
+			continue // Retransmitted with the same transaction ID
+		} else if err != nil {
+			return nil, err
+		}
+
+		res := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+		if err = res.Decode(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// channeldata relays the channel bindings a turn.XDPChannelOffloader adds to
+// its maps in the driver: ChannelData from clients leaves as UDP datagrams to
+// their peers, and datagrams from peers leave as ChannelData to the clients.
+// Everything else, STUN messages included, is passed to the server.
+
+#include <linux/bpf.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/udp.h>
+#include <bpf/bpf_endian.h>
+#include <bpf/bpf_helpers.h>
+
+#define MAX_FLOWS 65536
+#define MAX_IP_LEN 1500
+#define TTL 64
+
+// The layouts of internal/xdp, in network byte order
+struct client_side {
+	__be32 client_ip;
+	__be32 server_ip;
+	__be16 client_port;
+	__be16 server_port;
+	__be16 number;
+	__u16 pad;
+};
+
+struct peer_side {
+	__be32 peer_ip;
+	__be32 relay_ip;
+	__be16 peer_port;
+	__be16 relay_port;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_FLOWS);
+	__type(key, struct client_side);
+	__type(value, struct peer_side);
+} turn_channels SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, MAX_FLOWS);
+	__type(key, struct peer_side);
+	__type(value, struct client_side);
+} turn_peers SEC(".maps");
+
+struct headers {
+	struct ethhdr eth;
+	struct iphdr ip;
+	struct udphdr udp;
+} __attribute__((packed));
+
+struct channel_header {
+	__be16 number;
+	__be16 length;
+};
+
+static __always_inline __u16 ip_checksum(struct iphdr *ip)
+{
+	__u16 *words = (__u16 *)ip;
+	__u32 sum = 0;
+
+	ip->check = 0;
+#pragma unroll
+	for (int i = 0; i < (int)sizeof(*ip) / 2; i++)
+		sum += words[i];
+	sum = (sum & 0xffff) + (sum >> 16);
+	sum = (sum & 0xffff) + (sum >> 16);
+	return ~sum;
+}
+
+// rewrite writes the headers of the relayed datagram at the start of the
+// packet, after its head was adjusted, and sends it back to the router it
+// came from
+static __always_inline struct headers *rewrite(struct xdp_md *ctx, const struct headers *orig, __u16 udp_len,
+					       __be32 saddr, __be32 daddr, __be16 sport, __be16 dport)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct headers *h = data;
+
+	if ((void *)(h + 1) > data_end)
+		return NULL;
+
+	*h = *orig;
+	__builtin_memcpy(h->eth.h_dest, orig->eth.h_source, ETH_ALEN);
+	__builtin_memcpy(h->eth.h_source, orig->eth.h_dest, ETH_ALEN);
+
+	h->ip.saddr = saddr;
+	h->ip.daddr = daddr;
+	h->ip.ttl = TTL;
+	h->ip.tot_len = bpf_htons(sizeof(struct iphdr) + udp_len);
+	h->ip.check = ip_checksum(&h->ip);
+
+	// A zero checksum is not computed, which UDP over IPv4 allows
+	h->udp.source = sport;
+	h->udp.dest = dport;
+	h->udp.len = bpf_htons(udp_len);
+	h->udp.check = 0;
+	return h;
+}
+
+// to_client prepends the channel header to a datagram from a peer
+static __always_inline int to_client(struct xdp_md *ctx, const struct headers *orig, const struct client_side *c)
+{
+	__u16 length = bpf_ntohs(orig->udp.len) - sizeof(struct udphdr);
+	__u16 udp_len = sizeof(struct udphdr) + sizeof(struct channel_header) + length;
+
+	if (bpf_ntohs(orig->udp.len) < sizeof(struct udphdr) || sizeof(struct iphdr) + udp_len > MAX_IP_LEN)
+		return XDP_PASS;
+	if (bpf_xdp_adjust_head(ctx, -(int)sizeof(struct channel_header)))
+		return XDP_PASS;
+
+	struct headers *h = rewrite(ctx, orig, udp_len, c->server_ip, c->client_ip, c->server_port, c->client_port);
+	if (!h)
+		return XDP_ABORTED;
+	struct channel_header *ch = (void *)(h + 1);
+	if ((void *)(ch + 1) > (void *)(long)ctx->data_end)
+		return XDP_ABORTED;
+	ch->number = c->number;
+	ch->length = bpf_htons(length);
+	return XDP_TX;
+}
+
+// to_peer strips the channel header of ChannelData from a client. Padding
+// after the data stays behind the IP datagram, where receivers ignore it.
+static __always_inline int to_peer(struct xdp_md *ctx, const struct headers *orig, const struct channel_header *ch,
+				   const struct peer_side *p)
+{
+	__u16 length = bpf_ntohs(ch->length);
+
+	if (sizeof(struct udphdr) + sizeof(struct channel_header) + length > bpf_ntohs(orig->udp.len))
+		return XDP_PASS;
+	if (bpf_xdp_adjust_head(ctx, sizeof(struct channel_header)))
+		return XDP_PASS;
+
+	if (!rewrite(ctx, orig, sizeof(struct udphdr) + length, p->relay_ip, p->peer_ip, p->relay_port, p->peer_port))
+		return XDP_ABORTED;
+	return XDP_TX;
+}
+
+SEC("xdp")
+int turn_channeldata(struct xdp_md *ctx)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct headers *h = data;
+
+	if ((void *)(h + 1) > data_end)
+		return XDP_PASS;
+	if (h->eth.h_proto != bpf_htons(ETH_P_IP) || h->ip.ihl != 5 || h->ip.protocol != IPPROTO_UDP)
+		return XDP_PASS;
+	if (h->ip.frag_off & bpf_htons(0x3fff)) // Fragments go through the stack
+		return XDP_PASS;
+
+	struct headers orig = *h;
+
+	struct peer_side peer = {
+		.peer_ip = h->ip.saddr,
+		.relay_ip = h->ip.daddr,
+		.peer_port = h->udp.source,
+		.relay_port = h->udp.dest,
+	};
+	struct client_side *c = bpf_map_lookup_elem(&turn_peers, &peer);
+	if (c)
+		return to_client(ctx, &orig, c);
+
+	struct channel_header *ch = (void *)(h + 1);
+	if ((void *)(ch + 1) > data_end)
+		return XDP_PASS;
+	struct client_side client = {
+		.client_ip = h->ip.saddr,
+		.server_ip = h->ip.daddr,
+		.client_port = h->udp.source,
+		.server_port = h->udp.dest,
+		.number = ch->number,
+	};
+	struct peer_side *p = bpf_map_lookup_elem(&turn_channels, &client);
+	if (p) {
+		struct channel_header header = *ch;
+		return to_peer(ctx, &orig, &header, p);
+	}
+	return XDP_PASS;
+}
+
+char LICENSE[] SEC("license") = "Dual MIT/GPL";
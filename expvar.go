@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// expvarStats are the counters of a server published under ServerConfig.ExpvarPrefix
+type expvarStats struct {
+	Allocations int `json:"allocations"`
+	PortsInUse  int `json:"ports_in_use"`
+
+	// Relayed by all allocations so far, current and deleted
+	PacketsToPeer   uint64 `json:"packets_to_peer"`
+	PacketsFromPeer uint64 `json:"packets_from_peer"`
+	BytesToPeer     uint64 `json:"bytes_to_peer"`
+	BytesFromPeer   uint64 `json:"bytes_from_peer"`
+
+	RelayGoroutines   int64 `json:"relay_goroutines"`
+	RelayQueueDepth   int   `json:"relay_queue_depth"`
+	RequestQueueDepth int   `json:"request_queue_depth"`
+
+	RelayQueueDropped   uint64 `json:"relay_queue_dropped"`
+	RequestsDropped     uint64 `json:"requests_dropped"`
+	StreamWritesDropped uint64 `json:"stream_writes_dropped"`
+}
+
+func (s *Server) expvarStats() expvarStats {
+	stats := expvarStats{
+		RelayQueueDropped:   s.RelayQueueDropped(),
+		RequestsDropped:     s.RequestsDropped(),
+		StreamWritesDropped: s.StreamWritesDropped(),
+	}
+	for _, am := range s.allocationManagers {
+		stats.Allocations += am.AllocationCount()
+		stats.PortsInUse += am.PortsInUse()
+		traffic := am.Traffic()
+		stats.PacketsToPeer += traffic.PacketsToPeer
+		stats.PacketsFromPeer += traffic.PacketsFromPeer
+		stats.BytesToPeer += traffic.BytesToPeer
+		stats.BytesFromPeer += traffic.BytesFromPeer
+		stats.RelayGoroutines += am.RelayLoops()
+		stats.RelayQueueDepth += am.RelayQueueLen()
+	}
+	if s.requestPool != nil {
+		stats.RequestQueueDepth = len(s.requestPool.jobs)
+	}
+	return stats
+}
+
+// expvarServer is the server whose counters are published under a prefix. Variables of
+// expvar cannot be removed, so a prefix is published once and taken over by the next
+// server using it once the previous one is closed.
+type expvarServer struct {
+	server atomic.Pointer[Server]
+}
+
+//nolint:gochecknoglobals
+var (
+	expvarLock    sync.Mutex
+	expvarServers = map[string]*expvarServer{}
+)
+
+// checkExpvarPrefix returns an error if the prefix is published by a server still
+// running, or by something else than a server
+func checkExpvarPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+	if published, ok := expvarServers[prefix]; ok {
+		if published.server.Load() != nil {
+			return fmt.Errorf("%w: %s", errExpvarPrefixInUse, prefix)
+		}
+		return nil
+	}
+	if expvar.Get(prefix) != nil {
+		return fmt.Errorf("%w: %s", errExpvarPrefixInUse, prefix)
+	}
+	return nil
+}
+
+// publishExpvar publishes the counters of the server under the prefix, see
+// ServerConfig.ExpvarPrefix
+func (s *Server) publishExpvar(prefix string) {
+	if prefix == "" {
+		return
+	}
+
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+	published, ok := expvarServers[prefix]
+	if !ok {
+		if expvar.Get(prefix) != nil {
+			s.log.Warnf("Not publishing the counters of the server: expvar %s is in use", prefix)
+			return
+		}
+		published = &expvarServer{}
+		expvarServers[prefix] = published
+		expvar.Publish(prefix, expvar.Func(func() any {
+			if server := published.server.Load(); server != nil {
+				return server.expvarStats()
+			}
+			return nil
+		}))
+	}
+	if !published.server.CompareAndSwap(nil, s) {
+		s.log.Warnf("Not publishing the counters of the server: expvar %s is in use", prefix)
+		return
+	}
+	s.expvar = published
+}
+
+// unpublishExpvar stops publishing the counters of the server, the prefix then
+// reads null until another server takes it over
+func (s *Server) unpublishExpvar() {
+	if s.expvar != nil {
+		s.expvar.server.CompareAndSwap(s, nil)
+	}
+}
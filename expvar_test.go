@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerExpvar(t *testing.T) {
+	const prefix = "turn_test_server"
+
+	newServer := func() (*Server, net.PacketConn, error) {
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		server, err := NewServer(ServerConfig{
+			AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateAuthKey(username, realm, "pass"), true
+			},
+			PacketConnConfigs: []PacketConnConfig{{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			}},
+			Realm:         "pion.ly",
+			LoggerFactory: logging.NewDefaultLoggerFactory(),
+			ExpvarPrefix:  prefix,
+		})
+		if err != nil {
+			_ = serverConn.Close()
+		}
+		return server, serverConn, err
+	}
+	stats := func() (stats *expvarStats) {
+		require.NoError(t, json.Unmarshal([]byte(expvar.Get(prefix).String()), &stats))
+		return stats
+	}
+
+	server, serverConn, err := newServer()
+	require.NoError(t, err)
+	assert.Equal(t, &expvarStats{}, stats())
+
+	// The prefix is used by one server at a time
+	_, _, err = newServer()
+	assert.ErrorIs(t, err, errExpvarPrefixInUse)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err = peer.ReadFrom(buf)
+	require.NoError(t, err)
+
+	published := stats()
+	assert.Equal(t, 1, published.Allocations)
+	assert.Equal(t, 1, published.PortsInUse)
+	assert.Equal(t, uint64(1), published.PacketsToPeer)
+	assert.Equal(t, uint64(5), published.BytesToPeer)
+	assert.Equal(t, int64(1), published.RelayGoroutines)
+
+	// A closed server reads null until another one takes the prefix over
+	require.NoError(t, relayConn.Close())
+	require.NoError(t, server.Close())
+	assert.Equal(t, "null", expvar.Get(prefix).String())
+	server, _, err = newServer()
+	require.NoError(t, err)
+	assert.Equal(t, &expvarStats{}, stats())
+	require.NoError(t, server.Close())
+}
+
+func TestServerExpvarPrefixInUse(t *testing.T) {
+	if expvar.Get("turn_test_taken") == nil {
+		expvar.NewInt("turn_test_taken")
+	}
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer serverConn.Close() //nolint:errcheck
+	_, err = NewServer(ServerConfig{
+		PacketConnConfigs: []PacketConnConfig{{PacketConn: serverConn}},
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+		ExpvarPrefix:      "turn_test_taken",
+	})
+	assert.ErrorIs(t, err, errExpvarPrefixInUse)
+}
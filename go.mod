@@ -8,6 +8,7 @@ require (
 	github.com/pion/stun/v3 v3.0.0
 	github.com/pion/transport/v3 v3.0.7
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/net v0.27.0
 	golang.org/x/sys v0.26.0
 )
 
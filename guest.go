@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/turn/v4/internal/server"
+)
+
+const defaultGuestMaxLifetime = 5 * time.Minute
+
+// GuestConfig makes a listener grant allocations to clients without credentials, e.g. for
+// public demos or behind a captive portal, see PacketConnConfig.Guest.
+//
+// Every allocation of the listener is a guest allocation: requests are not authenticated,
+// and responses carry no MESSAGE-INTEGRITY. Serve authenticated clients on another
+// listener, as a client with credentials does not send them until it is challenged.
+type GuestConfig struct {
+	// Policy constrains the traffic of every guest allocation
+	Policy AllocationPolicy
+
+	// MaxLifetime caps the total lifetime of a guest allocation, it is not extended by
+	// refreshes past it. Defaults to 5 minutes.
+	MaxLifetime time.Duration
+
+	// MaxAllocations limits the guest allocations of the listener. Further Allocate requests
+	// are rejected with 508 (Insufficient Capacity). Defaults to 0, which means unlimited.
+	MaxAllocations int
+}
+
+func (c *GuestConfig) validate() error {
+	if c.MaxLifetime < 0 || c.MaxAllocations < 0 {
+		return errInvalidGuestConfig
+	}
+	return nil
+}
+
+func (c *GuestConfig) toInternal() *server.Guest {
+	if c == nil {
+		return nil
+	}
+	guest := &server.Guest{
+		Policy:         c.Policy.toInternal(),
+		MaxLifetime:    c.MaxLifetime,
+		MaxAllocations: c.MaxAllocations,
+	}
+	guest.Policy.Guest = true
+	if guest.MaxLifetime == 0 {
+		guest.MaxLifetime = defaultGuestMaxLifetime
+	}
+	return guest
+}
+
+// GuestPermissionHandler is the PermissionHandler of guest listeners without one. It only
+// grants permissions to public unicast peers, so guests can not reach the loopback, private
+// or link-local networks of the server.
+func GuestPermissionHandler(_ net.Addr, peerIP net.IP) (ok bool) {
+	return peerIP.IsGlobalUnicast() && !peerIP.IsPrivate()
+}
+
+// GuestAllocationCount returns the number of active guest allocations, which are also
+// counted by AllocationCount
+func (s *Server) GuestAllocationCount() int {
+	allocs := 0
+	for _, am := range s.guestAllocationManagers {
+		allocs += am.AllocationCount()
+	}
+	return allocs
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestPermissionHandler(t *testing.T) {
+	for ip, ok := range map[string]bool{
+		"198.51.100.1": true,
+		"2001:db8::1":  true,
+		"127.0.0.1":    false,
+		"10.0.0.1":     false,
+		"192.168.1.1":  false,
+		"169.254.0.1":  false,
+		"fd00::1":      false,
+		"::1":          false,
+		"0.0.0.0":      false,
+		"224.0.0.1":    false,
+	} {
+		assert.Equal(t, ok, GuestPermissionHandler(nil, net.ParseIP(ip)), ip)
+	}
+}
+
+func TestGuestAllocations(t *testing.T) {
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+
+	_, err = NewServer(ServerConfig{PacketConnConfigs: []PacketConnConfig{
+		{PacketConn: serverListener, Guest: &GuestConfig{MaxAllocations: -1}},
+	}})
+	assert.ErrorIs(t, err, errInvalidGuestConfig)
+
+	var lock sync.Mutex
+	var guests []bool
+	server, err := NewServer(ServerConfig{
+		// No AuthHandler, the guest listener needs none
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+				Guest: &GuestConfig{
+					Policy:         AllocationPolicy{Bandwidth: 64000},
+					MaxLifetime:    30 * time.Second,
+					MaxAllocations: 1,
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+		OnAllocationCreated: func(a ServerAllocation) {
+			lock.Lock()
+			defer lock.Unlock()
+			guests = append(guests, a.Guest())
+		},
+	})
+	require.NoError(t, err)
+
+	newClient := func(lifetime *time.Duration) *Client {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+			OnAllocationCreated: func(_ net.Addr, l time.Duration) {
+				*lifetime = l
+			},
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client
+	}
+
+	var lifetime time.Duration
+	client := newClient(&lifetime)
+	relayConn, err := client.Allocate()
+	require.NoError(t, err, "guests should allocate without credentials")
+	assert.LessOrEqual(t, lifetime, 30*time.Second, "the lifetime should be capped")
+	assert.Greater(t, lifetime, 20*time.Second)
+	assert.Equal(t, 1, server.GuestAllocationCount())
+	assert.Equal(t, 1, server.AllocationCount())
+
+	other := newClient(&lifetime)
+	_, err = other.Allocate()
+	assert.Error(t, err, "the guest allocations of the listener should be limited")
+
+	lock.Lock()
+	assert.Equal(t, []bool{true}, guests)
+	lock.Unlock()
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	other.Close()
+	assert.NoError(t, server.Close())
+}
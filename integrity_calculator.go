@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"github.com/pion/turn/v4/internal/server"
+)
+
+// IntegrityCalculator computes and verifies the HMACs of MESSAGE-INTEGRITY and
+// MESSAGE-INTEGRITY-SHA256 with the long-term keys of users, so the keys can stay inside
+// an HSM or a cloud KMS that only performs MAC operations for the server. Set it as the
+// ServerConfig.IntegrityCalculator.
+//
+// Its methods are called concurrently on the read loops of the server, once per request
+// and response, so a remote calculator adds its latency to every authenticated request.
+type IntegrityCalculator interface {
+	// ComputeMAC returns the HMAC of message with the key of the credentials, to sign a
+	// response. It is only called for credentials VerifyMAC accepted.
+	ComputeMAC(credentials IntegrityCredentials, message []byte) ([]byte, error)
+
+	// VerifyMAC tells if mac is the HMAC of message with the key of the credentials. Unknown
+	// users are not authentic; an error, e.g. an unreachable KMS, is answered with 500
+	// (Server Error) and does not count as a failed attempt of the user.
+	VerifyMAC(credentials IntegrityCredentials, message, mac []byte) (bool, error)
+}
+
+// IntegrityCredentials select the key and the HMAC of an IntegrityCalculator operation
+type IntegrityCredentials struct {
+	Username string
+	Realm    string
+
+	// PasswordAlgorithm is the algorithm the key is derived with, see GenerateAuthKey and
+	// GenerateSHA256AuthKey
+	PasswordAlgorithm PasswordAlgorithm
+
+	// SHA256 selects the HMAC-SHA256 of MESSAGE-INTEGRITY-SHA256 over the HMAC-SHA1 of
+	// MESSAGE-INTEGRITY
+	SHA256 bool
+}
+
+// internalIntegrityCalculator adapts an IntegrityCalculator to the internal/server one
+type internalIntegrityCalculator struct {
+	calculator IntegrityCalculator
+}
+
+func newInternalIntegrityCalculator(c IntegrityCalculator) server.IntegrityCalculator {
+	if c == nil {
+		return nil
+	}
+	return internalIntegrityCalculator{c}
+}
+
+func (c internalIntegrityCalculator) ComputeMAC(credentials server.IntegrityCredentials, message []byte) ([]byte, error) {
+	return c.calculator.ComputeMAC(integrityCredentials(credentials), message)
+}
+
+func (c internalIntegrityCalculator) VerifyMAC(credentials server.IntegrityCredentials, message, mac []byte) (bool, error) {
+	return c.calculator.VerifyMAC(integrityCredentials(credentials), message, mac)
+}
+
+func integrityCredentials(c server.IntegrityCredentials) IntegrityCredentials {
+	return IntegrityCredentials{
+		Username:          c.Username,
+		Realm:             c.Realm,
+		PasswordAlgorithm: PasswordAlgorithm(c.PasswordAlgorithm),
+		SHA256:            c.SHA256,
+	}
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errHSMUnavailable = errors.New("hsm unavailable")
+
+// fakeHSM is an IntegrityCalculator holding the MD5 keys of its users
+type fakeHSM struct {
+	mutex    sync.Mutex
+	keys     map[string][]byte
+	computed int
+	verified int
+	down     bool
+}
+
+func (h *fakeHSM) mac(credentials IntegrityCredentials, message []byte) ([]byte, error) {
+	if h.down {
+		return nil, errHSMUnavailable
+	}
+	key, ok := h.keys[credentials.Username]
+	if !ok || credentials.PasswordAlgorithm != PasswordAlgorithmMD5 {
+		return nil, nil
+	}
+	newHash := sha1.New
+	if credentials.SHA256 {
+		newHash = sha256.New
+	}
+	mac := hmac.New(newHash, key)
+	mac.Write(message) //nolint:errcheck,gosec
+	return mac.Sum(nil), nil
+}
+
+func (h *fakeHSM) ComputeMAC(credentials IntegrityCredentials, message []byte) ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.computed++
+	return h.mac(credentials, message)
+}
+
+func (h *fakeHSM) VerifyMAC(credentials IntegrityCredentials, message, mac []byte) (bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.verified++
+	expected, err := h.mac(credentials, message)
+	return expected != nil && hmac.Equal(mac, expected), err
+}
+
+func TestIntegrityCalculator(t *testing.T) {
+	hsm := &fakeHSM{keys: map[string][]byte{"user": GenerateAuthKey("user", "pion.ly", "pass")}}
+
+	_, err := NewServer(ServerConfig{
+		IntegrityCalculator: hsm,
+		AuthHandler: func(string, string, net.Addr) ([]byte, bool) {
+			return nil, false
+		},
+		PacketConnConfigs: []PacketConnConfig{{}},
+	})
+	assert.ErrorIs(t, err, errIntegrityCalculatorWithAuthHandler)
+
+	serverConn, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		IntegrityCalculator: hsm,
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	allocate := func(password string) error {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			Username:       "user",
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	assert.NoError(t, allocate("pass"))
+	hsm.mutex.Lock()
+	assert.Positive(t, hsm.verified)
+	assert.Positive(t, hsm.computed, "the responses should be signed by the calculator")
+	hsm.mutex.Unlock()
+
+	assert.Error(t, allocate("wrong pass"))
+
+	hsm.mutex.Lock()
+	hsm.down = true
+	hsm.mutex.Unlock()
+	assert.Error(t, allocate("pass"))
+}
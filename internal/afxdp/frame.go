@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package afxdp sends and receives UDP datagrams as raw Ethernet frames on
+// AF_XDP sockets, bypassing the UDP stack of the kernel
+package afxdp
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+const (
+	// HeaderSize is the size of the Ethernet, IPv4 and UDP headers of a frame
+	HeaderSize = ethernetHeaderSize + ipv4HeaderSize + udpHeaderSize
+	// MaxPayload is the largest UDP payload a frame of a Socket carries
+	MaxPayload = frameSize - HeaderSize
+
+	frameSize = 2048
+
+	ethernetHeaderSize = 14
+	ipv4HeaderSize     = 20
+	udpHeaderSize      = 8
+
+	etherTypeIPv4 = 0x0800
+	protocolUDP   = 17
+	ttl           = 64
+	dontFragment  = 0x4000
+)
+
+// Datagram is a UDP datagram in an Ethernet frame. Payload aliases the
+// frame it was parsed from.
+type Datagram struct {
+	SrcMAC  [6]byte
+	DstMAC  [6]byte
+	Src     netip.AddrPort
+	Dst     netip.AddrPort
+	Payload []byte
+}
+
+// Parse decodes a frame carrying an unfragmented IPv4 UDP datagram with valid
+// checksums into d, and tells if it did
+func Parse(frame []byte, d *Datagram) bool {
+	if len(frame) < HeaderSize || binary.BigEndian.Uint16(frame[12:]) != etherTypeIPv4 {
+		return false
+	}
+
+	ip := frame[ethernetHeaderSize:]
+	if ip[0] != 0x45 || ip[9] != protocolUDP || binary.BigEndian.Uint16(ip[6:])&0x3fff != 0 {
+		return false // Options, other protocols and fragments
+	}
+	totalLen := int(binary.BigEndian.Uint16(ip[2:]))
+	if totalLen < ipv4HeaderSize+udpHeaderSize || totalLen > len(ip) || fold(checksum(0, ip[:ipv4HeaderSize])) != 0 {
+		return false
+	}
+
+	udp := ip[ipv4HeaderSize:totalLen]
+	udpLen := int(binary.BigEndian.Uint16(udp[4:]))
+	if udpLen < udpHeaderSize || udpLen > len(udp) {
+		return false
+	}
+	udp = udp[:udpLen]
+	if binary.BigEndian.Uint16(udp[6:]) != 0 && fold(checksum(pseudoHeader(ip[12:16], ip[16:20], udpLen), udp)) != 0 {
+		return false
+	}
+
+	copy(d.DstMAC[:], frame[0:6])
+	copy(d.SrcMAC[:], frame[6:12])
+	d.Src = netip.AddrPortFrom(netip.AddrFrom4([4]byte(ip[12:16])), binary.BigEndian.Uint16(udp[0:]))
+	d.Dst = netip.AddrPortFrom(netip.AddrFrom4([4]byte(ip[16:20])), binary.BigEndian.Uint16(udp[2:]))
+	d.Payload = udp[udpHeaderSize:]
+	return true
+}
+
+// Encode writes d as a frame into buf and returns its size, zero if buf is
+// too small or an address is not IPv4
+func Encode(buf []byte, d *Datagram) int {
+	size := HeaderSize + len(d.Payload)
+	if size > len(buf) || !d.Src.Addr().Is4() || !d.Dst.Addr().Is4() {
+		return 0
+	}
+
+	copy(buf[0:6], d.DstMAC[:])
+	copy(buf[6:12], d.SrcMAC[:])
+	binary.BigEndian.PutUint16(buf[12:], etherTypeIPv4)
+
+	ip := buf[ethernetHeaderSize:size]
+	src, dst := d.Src.Addr().As4(), d.Dst.Addr().As4()
+	ip[0], ip[1] = 0x45, 0
+	binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)))
+	binary.BigEndian.PutUint32(ip[4:], dontFragment)
+	ip[8], ip[9] = ttl, protocolUDP
+	binary.BigEndian.PutUint16(ip[10:], 0)
+	copy(ip[12:16], src[:])
+	copy(ip[16:20], dst[:])
+	binary.BigEndian.PutUint16(ip[10:], fold(checksum(0, ip[:ipv4HeaderSize])))
+
+	udp := ip[ipv4HeaderSize:]
+	binary.BigEndian.PutUint16(udp[0:], d.Src.Port())
+	binary.BigEndian.PutUint16(udp[2:], d.Dst.Port())
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	binary.BigEndian.PutUint16(udp[6:], 0)
+	copy(udp[udpHeaderSize:], d.Payload)
+	sum := fold(checksum(pseudoHeader(src[:], dst[:], len(udp)), udp))
+	if sum == 0 {
+		sum = 0xffff // Zero means no checksum
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+	return size
+}
+
+// pseudoHeader returns the sum of the IPv4 pseudo header of a UDP checksum
+func pseudoHeader(src, dst []byte, udpLen int) uint32 {
+	return checksum(checksum(uint32(protocolUDP+udpLen), src), dst)
+}
+
+// checksum adds the 16 bit words of b to sum
+func checksum(sum uint32, b []byte) uint32 {
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+// fold returns the ones' complement of the ones' complement sum
+func fold(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package afxdp
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame(t *testing.T) {
+	d := Datagram{
+		SrcMAC:  [6]byte{0x02, 0, 0, 0, 0, 1},
+		DstMAC:  [6]byte{0x02, 0, 0, 0, 0, 2},
+		Src:     netip.MustParseAddrPort("198.51.100.1:3478"),
+		Dst:     netip.MustParseAddrPort("203.0.113.7:6000"),
+		Payload: []byte("odd payload"),
+	}
+	frame := make([]byte, 128)
+	n := Encode(frame, &d)
+	assert.Equal(t, HeaderSize+len(d.Payload), n)
+	frame = frame[:n]
+
+	var parsed Datagram
+	assert.True(t, Parse(frame, &parsed))
+	assert.Equal(t, d, parsed)
+
+	// Frames may carry padding after the IP datagram
+	assert.True(t, Parse(append(frame, 0, 0, 0), &parsed))
+	assert.Equal(t, d.Payload, parsed.Payload)
+
+	// Without a UDP checksum
+	frame[40], frame[41] = 0, 0
+	assert.True(t, Parse(frame, &parsed))
+
+	for name, corrupt := range map[string]func(f []byte){
+		"IPChecksum":  func(f []byte) { f[22]++ },
+		"UDPChecksum": func(f []byte) { f[50]++ },
+		"IPv6":        func(f []byte) { f[12], f[13] = 0x86, 0xdd },
+		"Fragment":    func(f []byte) { f[20] |= 0x20 },
+		"Truncated":   func(f []byte) { f[17] = 0xff },
+	} {
+		f := make([]byte, 128)
+		f = f[:Encode(f, &d)]
+		corrupt(f)
+		assert.False(t, Parse(f, &parsed), name)
+	}
+
+	assert.Zero(t, Encode(make([]byte, HeaderSize), &d), "the payload should not fit")
+	d.Dst = netip.MustParseAddrPort("[2001:db8::1]:6000")
+	assert.Zero(t, Encode(make([]byte, 128), &d))
+}
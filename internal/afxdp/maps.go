@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package afxdp
+
+const (
+	// SocketsMap is the pinned XSKMAP from the RX queue to its socket
+	SocketsMap = "turn_xsks"
+	// PortsMap is the pinned set of UDP ports, in network byte order, that are
+	// redirected to the sockets
+	PortsMap = "turn_ports"
+)
@@ -0,0 +1,286 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package afxdp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultFrames = 4096
+
+	// pollTimeout bounds how long Receive takes to notice Close, in milliseconds
+	pollTimeout = 100
+)
+
+var (
+	errInvalidFrames = errors.New("Frames must be a power of two")
+	errTxRingFull    = errors.New("no free frame to transmit")
+	errFrameTooLarge = errors.New("datagram does not fit a frame")
+)
+
+// Config configures a Socket
+type Config struct {
+	// Ifindex and Queue select the RX queue of the interface the socket is bound to
+	Ifindex int
+	Queue   int
+
+	// Frames is the number of frames of the UMEM, half for either direction. It
+	// must be a power of two and defaults to 4096.
+	Frames int
+}
+
+// Socket is an AF_XDP socket with its own UMEM. The frames the XDP program
+// redirects to its queue are received, frames are transmitted on the same queue.
+type Socket struct {
+	fd   int
+	umem []byte
+
+	fill       ring
+	completion ring
+	rx         ring
+	tx         ring
+
+	txLock sync.Mutex
+	freeTx []uint64 // Addresses of the tx frames not in use
+
+	closed atomic.Bool
+	rxLock sync.Mutex // Held by Receive
+}
+
+// ring is a single producer single consumer ring shared with the kernel
+type ring struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	flags    *uint32
+	descs    unsafe.Pointer
+	mask     uint32
+}
+
+// NewSocket creates a socket bound to a queue of an interface. It requires
+// CAP_NET_RAW and CAP_BPF, or root.
+func NewSocket(config Config) (*Socket, error) {
+	if config.Frames == 0 {
+		config.Frames = defaultFrames
+	}
+	if config.Frames < 2 || config.Frames&(config.Frames-1) != 0 {
+		return nil, errInvalidFrames
+	}
+	ringSize := config.Frames / 2
+
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{fd: fd}
+	if err := s.setup(config, ringSize); err != nil {
+		_ = s.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Socket) setup(config Config, ringSize int) (err error) {
+	s.umem, err = unix.Mmap(-1, 0, config.Frames*frameSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	reg := unix.XDPUmemReg{Addr: uint64(uintptr(unsafe.Pointer(&s.umem[0]))), Len: uint64(len(s.umem)), Size: frameSize}
+	if err := sockopt(unix.SYS_SETSOCKOPT, s.fd, unix.XDP_UMEM_REG, unsafe.Pointer(&reg), unsafe.Sizeof(reg)); err != nil {
+		return err
+	}
+	for _, opt := range []int{unix.XDP_UMEM_FILL_RING, unix.XDP_UMEM_COMPLETION_RING, unix.XDP_RX_RING, unix.XDP_TX_RING} {
+		if err := unix.SetsockoptInt(s.fd, unix.SOL_XDP, opt, ringSize); err != nil {
+			return err
+		}
+	}
+
+	var off unix.XDPMmapOffsets
+	if err := sockopt(unix.SYS_GETSOCKOPT, s.fd, unix.XDP_MMAP_OFFSETS, unsafe.Pointer(&off), unsafe.Sizeof(off)); err != nil {
+		return err
+	}
+	addrSize, descSize := uint64(unsafe.Sizeof(uint64(0))), uint64(unsafe.Sizeof(unix.XDPDesc{}))
+	if err := s.fill.mmap(s.fd, off.Fr, unix.XDP_UMEM_PGOFF_FILL_RING, ringSize, addrSize); err != nil {
+		return err
+	}
+	if err := s.completion.mmap(s.fd, off.Cr, unix.XDP_UMEM_PGOFF_COMPLETION_RING, ringSize, addrSize); err != nil {
+		return err
+	}
+	if err := s.rx.mmap(s.fd, off.Rx, unix.XDP_PGOFF_RX_RING, ringSize, descSize); err != nil {
+		return err
+	}
+	if err := s.tx.mmap(s.fd, off.Tx, unix.XDP_PGOFF_TX_RING, ringSize, descSize); err != nil {
+		return err
+	}
+
+	// The first half of the frames is given to the kernel to receive into,
+	// the second half is transmitted from
+	for i := 0; i < ringSize; i++ {
+		*s.fill.addr(uint32(i)) = uint64(i * frameSize)
+		s.freeTx = append(s.freeTx, uint64((ringSize+i)*frameSize))
+	}
+	atomic.StoreUint32(s.fill.producer, uint32(ringSize))
+
+	return unix.Bind(s.fd, &unix.SockaddrXDP{
+		Flags:   unix.XDP_USE_NEED_WAKEUP,
+		Ifindex: uint32(config.Ifindex),
+		QueueID: uint32(config.Queue),
+	})
+}
+
+// FD returns the descriptor to add to the XSKMAP of the XDP program
+func (s *Socket) FD() int {
+	return s.fd
+}
+
+// Receive calls handle with every received frame until the socket is closed.
+// The frame is only valid until handle returns. Receive must not be called
+// concurrently.
+func (s *Socket) Receive(handle func(frame []byte)) error {
+	s.rxLock.Lock()
+	defer s.rxLock.Unlock()
+
+	fds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+	for !s.closed.Load() {
+		consumer := atomic.LoadUint32(s.rx.consumer)
+		n := atomic.LoadUint32(s.rx.producer) - consumer
+		if n == 0 {
+			if _, err := unix.Poll(fds, pollTimeout); err != nil && !errors.Is(err, unix.EINTR) {
+				return err
+			}
+			continue
+		}
+
+		// Every received frame goes straight back to the fill ring, which
+		// always has room as the kernel holds the other receive frames
+		producer := atomic.LoadUint32(s.fill.producer)
+		for i := uint32(0); i < n; i++ {
+			desc := s.rx.desc(consumer + i)
+			handle(s.umem[desc.Addr : desc.Addr+uint64(desc.Len)])
+			*s.fill.addr(producer + i) = desc.Addr &^ (frameSize - 1)
+		}
+		atomic.StoreUint32(s.rx.consumer, consumer+n)
+		atomic.StoreUint32(s.fill.producer, producer+n)
+	}
+	return net.ErrClosed
+}
+
+// Transmit sends the frame encode writes into a free frame buffer. encode
+// returns the size of the frame, zero if it does not fit.
+func (s *Socket) Transmit(encode func(buf []byte) int) error {
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	if s.closed.Load() {
+		return net.ErrClosed
+	}
+
+	s.reclaim()
+	if len(s.freeTx) == 0 {
+		s.wakeup()
+		if s.reclaim(); len(s.freeTx) == 0 {
+			return errTxRingFull
+		}
+	}
+	addr := s.freeTx[len(s.freeTx)-1]
+	n := encode(s.umem[addr : addr+frameSize])
+	if n == 0 {
+		return errFrameTooLarge
+	}
+	s.freeTx = s.freeTx[:len(s.freeTx)-1]
+
+	// The tx ring has room for every tx frame
+	producer := atomic.LoadUint32(s.tx.producer)
+	*s.tx.desc(producer) = unix.XDPDesc{Addr: addr, Len: uint32(n)}
+	atomic.StoreUint32(s.tx.producer, producer+1)
+	if atomic.LoadUint32(s.tx.flags)&unix.XDP_RING_NEED_WAKEUP != 0 {
+		s.wakeup()
+	}
+	return nil
+}
+
+// reclaim takes the frames the kernel completed back
+func (s *Socket) reclaim() {
+	consumer := atomic.LoadUint32(s.completion.consumer)
+	n := atomic.LoadUint32(s.completion.producer) - consumer
+	for i := uint32(0); i < n; i++ {
+		s.freeTx = append(s.freeTx, *s.completion.addr(consumer + i))
+	}
+	atomic.StoreUint32(s.completion.consumer, consumer+n)
+}
+
+// wakeup makes the kernel process the tx ring. Errors like EAGAIN only mean the
+// kernel is busy, the frames are sent later.
+func (s *Socket) wakeup() {
+	_ = unix.Sendto(s.fd, nil, unix.MSG_DONTWAIT, nil)
+}
+
+// Close closes the socket once Receive returned
+func (s *Socket) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	s.rxLock.Lock()
+	defer s.rxLock.Unlock()
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	return s.release()
+}
+
+func (s *Socket) release() error {
+	for _, r := range []*ring{&s.fill, &s.completion, &s.rx, &s.tx} {
+		if r.mem != nil {
+			_ = unix.Munmap(r.mem)
+		}
+	}
+	if s.umem != nil {
+		_ = unix.Munmap(s.umem)
+	}
+	return unix.Close(s.fd)
+}
+
+func (r *ring) mmap(fd int, off unix.XDPRingOffset, pgoff int64, size int, entrySize uint64) (err error) {
+	r.mem, err = unix.Mmap(fd, pgoff, int(off.Desc+uint64(size)*entrySize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	r.producer = (*uint32)(unsafe.Pointer(&r.mem[off.Producer]))
+	r.consumer = (*uint32)(unsafe.Pointer(&r.mem[off.Consumer]))
+	r.flags = (*uint32)(unsafe.Pointer(&r.mem[off.Flags]))
+	r.descs = unsafe.Pointer(&r.mem[off.Desc])
+	r.mask = uint32(size - 1)
+	return nil
+}
+
+// addr returns an entry of the fill or completion ring
+func (r *ring) addr(i uint32) *uint64 {
+	return (*uint64)(unsafe.Add(r.descs, uintptr(i&r.mask)*unsafe.Sizeof(uint64(0))))
+}
+
+// desc returns an entry of the rx or tx ring
+func (r *ring) desc(i uint32) *unix.XDPDesc {
+	return (*unix.XDPDesc)(unsafe.Add(r.descs, uintptr(i&r.mask)*unsafe.Sizeof(unix.XDPDesc{})))
+}
+
+func sockopt(trap uintptr, fd, opt int, value unsafe.Pointer, size uintptr) error {
+	length := uint32(size)
+	lengthArg := uintptr(size)
+	if trap == unix.SYS_GETSOCKOPT {
+		lengthArg = uintptr(unsafe.Pointer(&length))
+	}
+	_, _, errno := unix.Syscall6(trap, uintptr(fd), unix.SOL_XDP, uintptr(opt), uintptr(value), lengthArg, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
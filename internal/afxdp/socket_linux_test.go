@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package afxdp
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocket(t *testing.T) {
+	_, err := NewSocket(Config{Frames: 3})
+	assert.ErrorIs(t, err, errInvalidFrames)
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	s, err := NewSocket(Config{Ifindex: lo.Index, Frames: 8})
+	if err != nil {
+		t.Skipf("AF_XDP sockets are not available: %v", err)
+	}
+
+	// The kernel does not route what lo receives without its own stack, so
+	// only the transmission itself can be checked: more datagrams than tx
+	// frames need the completed frames back
+	d := Datagram{
+		Src: netip.MustParseAddrPort("127.0.0.1:3478"),
+		Dst: netip.MustParseAddrPort("127.0.0.1:9"),
+	}
+	for i := 0; i < 16; i++ {
+		d.Payload = []byte{byte(i)}
+		require.NoError(t, s.Transmit(func(b []byte) int { return Encode(b, &d) }))
+	}
+	d.Payload = make([]byte, MaxPayload+1)
+	assert.ErrorIs(t, s.Transmit(func(b []byte) int { return Encode(b, &d) }), errFrameTooLarge)
+
+	received := make(chan error)
+	go func() {
+		received <- s.Receive(func([]byte) {})
+	}()
+	assert.NoError(t, s.Close())
+	assert.ErrorIs(t, <-received, net.ErrClosed)
+	assert.ErrorIs(t, s.Transmit(func([]byte) int { return 0 }), net.ErrClosed)
+	assert.NoError(t, s.Close())
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"sync"
+)
+
+// Priority classes of allocations. Higher values are more important
+const (
+	PriorityStandard = 0
+	PriorityPremium  = 1
+)
+
+// Admission limits the number of allocations across all managers of a
+// server. Reserved capacity is kept free for allocations above
+// PriorityStandard, so they can still be created when the server is full.
+// Prioritized allocations use the reserved capacity first.
+type Admission struct {
+	max      int
+	reserved int
+
+	mutex       sync.Mutex
+	count       int
+	prioritized int
+}
+
+// NewAdmission creates an Admission for at most max allocations, of which
+// reserved are kept for prioritized ones
+func NewAdmission(max, reserved int) *Admission {
+	return &Admission{max: max, reserved: reserved}
+}
+
+// admit takes a slot for an allocation of the priority, if one is available
+func (a *Admission) admit(priority int) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	limit := a.max
+	if priority <= PriorityStandard && a.prioritized < a.reserved {
+		limit -= a.reserved - a.prioritized
+	}
+	if a.count >= limit {
+		return false
+	}
+
+	a.count++
+	if priority > PriorityStandard {
+		a.prioritized++
+	}
+	return true
+}
+
+// release returns the slot of an allocation of the priority
+func (a *Admission) release(priority int) {
+	a.mutex.Lock()
+	a.count--
+	if priority > PriorityStandard {
+		a.prioritized--
+	}
+	a.mutex.Unlock()
+}
+
+// priorityWeight scales the FairQueue quantum of an allocation
+func priorityWeight(priority int) int {
+	if priority <= PriorityStandard {
+		return 1
+	}
+	return 4
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmission(t *testing.T) {
+	turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	m, err := newTestManager()
+	assert.NoError(t, err)
+	m.admission = NewAdmission(2, 1)
+
+	create := func(priority int) (*FiveTuple, error) {
+		fiveTuple := randomFiveTuple()
+		_, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{Priority: priority})
+		return fiveTuple, err
+	}
+
+	standard, err := create(PriorityStandard)
+	assert.NoError(t, err)
+	_, err = create(PriorityStandard)
+	assert.ErrorIs(t, err, ErrInsufficientCapacity, "reserved capacity must not be granted to standard allocations")
+
+	_, err = create(PriorityPremium)
+	assert.NoError(t, err)
+	_, err = create(PriorityPremium)
+	assert.ErrorIs(t, err, ErrInsufficientCapacity)
+
+	m.DeleteAllocation(standard)
+	_, err = create(PriorityStandard)
+	assert.NoError(t, err, "deleted allocations must release their slot")
+
+	m.admission = NewAdmission(2, 1)
+	_, err = create(PriorityPremium)
+	assert.NoError(t, err)
+	_, err = create(PriorityStandard)
+	assert.NoError(t, err, "prioritized allocations should use the reserved capacity first")
+
+	assert.NoError(t, m.Close())
+	assert.NoError(t, turnSocket.Close())
+}
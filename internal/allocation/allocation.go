@@ -5,7 +5,10 @@
 package allocation
 
 import (
+	"context"
 	"net"
+	"net/netip"
+	"runtime/pprof"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,8 +16,10 @@ import (
 	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
 
+	"github.com/pion/turn/v4/internal/fastlog"
 	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/ratelimit"
 )
 
 type allocationResponse struct {
@@ -22,6 +27,12 @@ type allocationResponse struct {
 	responseAttrs []stun.Setter
 }
 
+// relayConnection is the peer the RelaySocket is connect()ed to
+type relayConnection struct {
+	addr *net.UDPAddr
+	key  netip.AddrPort
+}
+
 // Allocation is tied to a FiveTuple and relays traffic
 // use CreateAllocation and GetAllocation to operate
 type Allocation struct {
@@ -31,14 +42,67 @@ type Allocation struct {
 	RelaySocket         net.PacketConn
 	fiveTuple           *FiveTuple
 	permissionsLock     sync.RWMutex
-	permissions         map[string]*Permission
-	channelBindingsLock sync.RWMutex
-	channelBindings     []*ChannelBind
-	lifetimeTimer       *time.Timer
+	permissions         map[netip.Addr]*Permission
+	channelBindingsLock sync.Mutex // Serializes the changes of channels
+	channels            atomic.Pointer[channelTable]
+	lifetimeTimer       lifetimeTimer
+	timers              *TimerWheel // Of the lifetime timers, runtime timers if nil
 	closed              chan interface{}
 	log                 logging.LeveledLogger
 	username            stun.Username
 
+	// socket is the state of the optional uses of the RelaySocket, nil if
+	// the Manager enables none
+	socket *relaySocketState
+
+	// indicationBatchSize is the most Data indications the packetHandler writes
+	// to the client at once, see indicationBatch. Batching is off below two
+	indicationBatchSize int
+
+	// relayQueue buffers writes towards peers when enabled by the Manager.
+	// It is drained by the FairQueue of flow if set, by its own goroutine
+	// while packets are queued otherwise
+	relayQueue *relayQueue
+	flow       *flow
+
+	// relayLoops counts the goroutines relaying for the allocations of the
+	// Manager, nil if not created by one
+	relayLoops *atomic.Int64
+
+	// profilerLabels label the goroutines of the allocation, nil if disabled
+	profilerLabels context.Context
+
+	// When the permission or channel binding tables are full the entry
+	// idle for longest is evicted to make room for a new one
+	maxPermissions     int
+	maxChannelBindings int
+	onEviction         func(clientAddr, relayAddr, peer net.Addr, number proto.ChannelNumber)
+
+	onPermissionAdded func(a *Allocation, peer net.Addr)
+
+	offloader ChannelOffloader
+
+	policy           Policy
+	limiter          *ratelimit.TokenBucket
+	egress           *ratelimit.Share
+	bandwidthDropped atomic.Uint64
+	admission        *Admission
+	memoryBudget     *MemoryBudget
+
+	createdAt time.Time
+
+	// When the credentials of the allocation expire in UnixNano, zero if unknown
+	credentialExpiry atomic.Int64
+
+	// The key requests were last authenticated with, see SessionKey
+	sessionKey atomic.Pointer[sessionKey]
+
+	// Payload relayed in both directions, see Traffic
+	bytesToPeer     atomic.Uint64
+	bytesFromPeer   atomic.Uint64
+	packetsToPeer   atomic.Uint64
+	packetsFromPeer atomic.Uint64
+
 	// Some clients (Firefox or others using resiprocate's nICE lib) may retry allocation
 	// with same 5 tuple when received 413, for compatible with these clients,
 	// cache for response lost and client retry to implement 'stateless stack approach'
@@ -46,18 +110,100 @@ type Allocation struct {
 	responseCache atomic.Value // *allocationResponse
 }
 
+// relaySocketState is the state of the RelaySocket of an allocation whose Manager
+// connects relay sockets or offloads UDP segmentation
+type relaySocketState struct {
+	// When connect is set the RelaySocket is connect()ed to the peer while
+	// that peer is the only one the allocation talks to. Writes on the
+	// connected path hold connectLock for reading, so the association does
+	// not change under them.
+	connect       bool
+	connectLock   sync.RWMutex
+	connectedPeer atomic.Pointer[relayConnection] // nil while not connected
+
+	// When udpOffload is set queued packets are written with GSO and the
+	// RelaySocket is read with GRO, if the kernel supports them. gro is only
+	// used by the packetHandler, for the groConn it was created for.
+	udpOffload bool
+	gro        *groReader
+	groConn    net.PacketConn
+}
+
 // NewAllocation creates a new instance of NewAllocation.
 func NewAllocation(turnSocket net.PacketConn, fiveTuple *FiveTuple, log logging.LeveledLogger, username stun.Username) *Allocation {
 	return &Allocation{
 		TurnSocket:  turnSocket,
 		fiveTuple:   fiveTuple,
-		permissions: make(map[string]*Permission, 64),
+		permissions: map[netip.Addr]*Permission{},
 		closed:      make(chan interface{}),
 		log:         log,
 		username:    username,
+		createdAt:   time.Now(),
+	}
+}
+
+// Traffic is the payload relayed by an allocation
+type Traffic struct {
+	BytesToPeer     uint64
+	BytesFromPeer   uint64
+	PacketsToPeer   uint64
+	PacketsFromPeer uint64
+}
+
+func (t *Traffic) add(other Traffic) {
+	t.BytesToPeer += other.BytesToPeer
+	t.BytesFromPeer += other.BytesFromPeer
+	t.PacketsToPeer += other.PacketsToPeer
+	t.PacketsFromPeer += other.PacketsFromPeer
+}
+
+// Traffic returns the payload relayed by the allocation so far. Packets
+// dropped by bandwidth limits are not counted.
+func (a *Allocation) Traffic() Traffic {
+	return Traffic{
+		BytesToPeer:     a.bytesToPeer.Load(),
+		BytesFromPeer:   a.bytesFromPeer.Load(),
+		PacketsToPeer:   a.packetsToPeer.Load(),
+		PacketsFromPeer: a.packetsFromPeer.Load(),
 	}
 }
 
+// FiveTuple returns the 5-tuple of the client the allocation belongs to
+func (a *Allocation) FiveTuple() *FiveTuple {
+	return a.fiveTuple
+}
+
+// Username returns the username the allocation was created with
+func (a *Allocation) Username() string {
+	return string(a.username)
+}
+
+// Log returns the logger of the allocation, which adds its username, realm,
+// client and relay addresses to every line
+func (a *Allocation) Log() logging.LeveledLogger {
+	return a.log
+}
+
+// CreatedAt returns when the allocation was created
+func (a *Allocation) CreatedAt() time.Time {
+	return a.createdAt
+}
+
+// CredentialExpiry returns when the credentials the allocation was last
+// authenticated with expire, the zero time if unknown
+func (a *Allocation) CredentialExpiry() time.Time {
+	if expiry := a.credentialExpiry.Load(); expiry != 0 {
+		return time.Unix(0, expiry)
+	}
+	return time.Time{}
+}
+
+// SetCredentialExpiry records the expiry of the credentials the allocation
+// was refreshed with
+func (a *Allocation) SetCredentialExpiry(expiry time.Time) {
+	a.credentialExpiry.Store(expiry.UnixNano())
+}
+
 // GetPermission gets the Permission from the allocation
 func (a *Allocation) GetPermission(addr net.Addr) *Permission {
 	a.permissionsLock.RLock()
@@ -66,32 +212,77 @@ func (a *Allocation) GetPermission(addr net.Addr) *Permission {
 	return a.permissions[ipnet.FingerprintAddr(addr)]
 }
 
+// permission gets the Permission of the peer with the fingerprint key
+func (a *Allocation) permission(key netip.Addr) *Permission {
+	a.permissionsLock.RLock()
+	defer a.permissionsLock.RUnlock()
+
+	return a.permissions[key]
+}
+
 // AddPermission adds a new permission to the allocation
 func (a *Allocation) AddPermission(p *Permission) {
-	fingerprint := ipnet.FingerprintAddr(p.Addr)
+	if a.addPermission(p) {
+		a.updateConnectedPeer()
+	}
+}
+
+// addPermission adds or refreshes the permission and returns whether it is new,
+// without updating the connected peer
+func (a *Allocation) addPermission(p *Permission) bool {
+	p.key = ipnet.FingerprintAddr(p.Addr)
 
 	a.permissionsLock.RLock()
-	existedPermission, ok := a.permissions[fingerprint]
+	existedPermission, ok := a.permissions[p.key]
 	a.permissionsLock.RUnlock()
 
 	if ok {
 		existedPermission.refresh(permissionTimeout)
-		return
+		return false
 	}
 
 	p.allocation = a
+	p.limiters = a.newPeerLimiters()
+	var evicted *Permission
 	a.permissionsLock.Lock()
-	a.permissions[fingerprint] = p
+	if a.maxPermissions > 0 && len(a.permissions) >= a.maxPermissions {
+		if evicted = a.idlestPermission(); evicted != nil {
+			delete(a.permissions, evicted.key)
+		}
+	}
+	a.permissions[p.key] = p
 	a.permissionsLock.Unlock()
 
 	p.start(permissionTimeout)
+	if evicted != nil {
+		a.evictPermission(evicted)
+	}
+	if a.onPermissionAdded != nil {
+		a.onPermissionAdded(a, p.Addr)
+	}
+	return true
 }
 
 // RemovePermission removes the net.Addr's fingerprint from the allocation's permissions
 func (a *Allocation) RemovePermission(addr net.Addr) {
 	a.permissionsLock.Lock()
-	defer a.permissionsLock.Unlock()
 	delete(a.permissions, ipnet.FingerprintAddr(addr))
+	a.permissionsLock.Unlock()
+
+	a.updateConnectedPeer()
+}
+
+// PermissionCount returns the number of permissions of the allocation
+func (a *Allocation) PermissionCount() int {
+	a.permissionsLock.RLock()
+	defer a.permissionsLock.RUnlock()
+
+	return len(a.permissions)
+}
+
+// ChannelBindCount returns the number of channels bound on the allocation
+func (a *Allocation) ChannelBindCount() int {
+	return len(a.channelTable().list)
 }
 
 // AddChannelBind adds a new ChannelBind to the allocation, it also updates the
@@ -100,22 +291,39 @@ func (a *Allocation) AddChannelBind(c *ChannelBind, lifetime time.Duration) erro
 	// Check that this channel id isn't bound to another transport address, and
 	// that this transport address isn't bound to another channel number.
 	channelByNumber := a.GetChannelByNumber(c.Number)
+	c.peer, _ = peerKey(c.Peer)
 
-	if channelByNumber != a.GetChannelByAddr(c.Peer) {
+	if channelByNumber != a.channelByPeer(c.peer) {
 		return errSameChannelDifferentPeer
 	}
 
 	// Add or refresh this channel.
 	if channelByNumber == nil {
+		var evicted *ChannelBind
 		a.channelBindingsLock.Lock()
-		defer a.channelBindingsLock.Unlock()
-
+		table := a.channelTable()
+		list := table.list
+		if a.maxChannelBindings > 0 && len(list) >= a.maxChannelBindings {
+			evicted = table.idlest()
+			list, _ = table.without(func(c *ChannelBind) bool { return c == evicted })
+		}
 		c.allocation = a
-		a.channelBindings = append(a.channelBindings, c)
 		c.start(lifetime)
+		// The capacity limit makes append copy the published list
+		a.channels.Store(newChannelTable(append(list[:len(list):len(list)], c)))
+		a.channelBindingsLock.Unlock()
+
+		if evicted != nil {
+			evicted.lifetimeTimer.Stop()
+			a.removeOffload(evicted)
+			a.notifyEviction(evicted.Peer, evicted.Number)
+		}
 
-		// Channel binds also refresh permissions.
-		a.AddPermission(NewPermission(c.Peer, a.log))
+		// Channel binds also refresh permissions. The new channel may change
+		// the connected peer even if the permission existed.
+		a.addPermission(NewPermission(c.Peer, a.log))
+		a.updateConnectedPeer()
+		a.offloadChannel(c)
 	} else {
 		channelByNumber.refresh(lifetime)
 
@@ -129,46 +337,174 @@ func (a *Allocation) AddChannelBind(c *ChannelBind, lifetime time.Duration) erro
 // RemoveChannelBind removes the ChannelBind from this allocation by id
 func (a *Allocation) RemoveChannelBind(number proto.ChannelNumber) bool {
 	a.channelBindingsLock.Lock()
-	defer a.channelBindingsLock.Unlock()
+	table := a.channelTable()
+	removed := table.byNumber[number]
+	if removed != nil {
+		list, _ := table.without(func(c *ChannelBind) bool { return c == removed })
+		a.channels.Store(newChannelTable(list))
+	}
+	a.channelBindingsLock.Unlock()
 
-	for i := len(a.channelBindings) - 1; i >= 0; i-- {
-		if a.channelBindings[i].Number == number {
-			a.channelBindings = append(a.channelBindings[:i], a.channelBindings[i+1:]...)
-			return true
-		}
+	if removed != nil {
+		a.removeOffload(removed)
+		a.updateConnectedPeer()
 	}
 
-	return false
+	return removed != nil
 }
 
 // GetChannelByNumber gets the ChannelBind from this allocation by id
 func (a *Allocation) GetChannelByNumber(number proto.ChannelNumber) *ChannelBind {
-	a.channelBindingsLock.RLock()
-	defer a.channelBindingsLock.RUnlock()
-	for _, cb := range a.channelBindings {
-		if cb.Number == number {
-			return cb
-		}
-	}
-	return nil
+	return a.channelTable().byNumber[number]
 }
 
 // GetChannelByAddr gets the ChannelBind from this allocation by net.Addr
 func (a *Allocation) GetChannelByAddr(addr net.Addr) *ChannelBind {
-	a.channelBindingsLock.RLock()
-	defer a.channelBindingsLock.RUnlock()
-	for _, cb := range a.channelBindings {
-		if ipnet.AddrEqual(cb.Peer, addr) {
-			return cb
+	peer, ok := peerKey(addr)
+	if !ok {
+		return nil
+	}
+	return a.channelByPeer(peer)
+}
+
+// channelByPeer gets the ChannelBind of the peer with the key of peerKey
+func (a *Allocation) channelByPeer(peer netip.AddrPort) *ChannelBind {
+	if !peer.IsValid() {
+		return nil
+	}
+	return a.channelTable().byPeer[peer]
+}
+
+// WriteToPeer relays p to the peer through the RelaySocket. If the allocation
+// has a relay queue the packet is enqueued and the call never blocks. Packets
+// exceeding the bandwidth limits of the Policy are silently dropped.
+func (a *Allocation) WriteToPeer(p []byte, peer net.Addr) (int, error) {
+	if a.limited() && !a.allowTraffic(a.peerPermission(ipnet.FingerprintAddr(peer)), toPeer, len(p)) {
+		return len(p), nil
+	}
+	a.bytesToPeer.Add(uint64(len(p)))
+	a.packetsToPeer.Add(1)
+
+	if a.relayQueue != nil {
+		a.relayQueue.push(p, peer)
+		if a.flow != nil {
+			a.flow.activate()
+		} else {
+			a.wakeRelayQueueWriter()
+		}
+		return len(p), nil
+	}
+
+	return a.writeToPeer(p, peer, ipnet.FingerprintAddrPort(peer))
+}
+
+// writeToPeer writes p to the peer with the fingerprint key, using the
+// cheaper write(2) path if the socket is connected to that peer.
+func (a *Allocation) writeToPeer(p []byte, peer net.Addr, key netip.AddrPort) (int, error) {
+	if key.IsValid() && a.connectedKey() == key {
+		a.socket.connectLock.RLock()
+		defer a.socket.connectLock.RUnlock()
+		// The peer may have been disconnected since
+		if conn, ok := a.RelaySocket.(net.Conn); ok && a.connectedKey() == key {
+			return conn.Write(p)
 		}
 	}
+
+	return a.RelaySocket.WriteTo(p, peer)
+}
+
+// ConnectedPeer returns the peer the RelaySocket is currently connected to, or nil
+func (a *Allocation) ConnectedPeer() net.Addr {
+	if a.socket == nil {
+		return nil
+	}
+	if connected := a.socket.connectedPeer.Load(); connected != nil {
+		return connected.addr
+	}
 	return nil
 }
 
+// connectedKey returns the fingerprint of the peer the RelaySocket is
+// connected to, the zero AddrPort if none
+func (a *Allocation) connectedKey() netip.AddrPort {
+	if a.socket == nil {
+		return netip.AddrPort{}
+	}
+	if connected := a.socket.connectedPeer.Load(); connected != nil {
+		return connected.key
+	}
+	return netip.AddrPort{}
+}
+
+// updateConnectedPeer connects the RelaySocket to the peer when it holds the
+// only permission of the allocation, and disconnects it as soon as that no
+// longer holds. The socket is connected to the peer of the channel binding on
+// the permitted IP if there is exactly one, to the address the permission was
+// created for otherwise.
+func (a *Allocation) updateConnectedPeer() {
+	s := a.socket
+	if s == nil || !s.connect {
+		return
+	}
+
+	s.connectLock.Lock()
+	defer s.connectLock.Unlock()
+
+	var peer *relayConnection
+	a.permissionsLock.RLock()
+	if len(a.permissions) == 1 {
+		for _, p := range a.permissions {
+			if addr, ok := p.Addr.(*net.UDPAddr); ok {
+				peer = &relayConnection{addr: addr, key: ipnet.FingerprintAddrPort(addr)}
+			}
+		}
+	}
+	a.permissionsLock.RUnlock()
+
+	if list := a.channelTable().list; peer != nil && len(list) == 1 && list[0].peer.Addr() == peer.key.Addr() {
+		if addr, ok := list[0].Peer.(*net.UDPAddr); ok {
+			peer = &relayConnection{addr: addr, key: list[0].peer}
+		}
+	}
+	if peer != nil && !peer.key.IsValid() {
+		peer = nil
+	}
+
+	current := s.connectedPeer.Load()
+	switch {
+	case peer == nil && current == nil:
+		return
+	case peer != nil && current != nil && peer.key == current.key:
+		return
+	case peer == nil:
+		// Publish the change before disconnecting so no writer relies on the association
+		s.connectedPeer.Store(nil)
+		if err := disconnectPacketConn(a.RelaySocket); err != nil {
+			fastlog.Warnw(a.log, "Failed to disconnect relay socket", "err", err)
+		}
+	default:
+		s.connectedPeer.Store(nil)
+		if err := connectPacketConn(a.RelaySocket, peer.addr); err != nil {
+			fastlog.Debugw(a.log, "Failed to connect relay socket", "peer", peer.addr, "err", err)
+			return
+		}
+		s.connectedPeer.Store(peer)
+		fastlog.Debugw(a.log, "Connected relay socket", "peer", peer.addr)
+	}
+}
+
+// afterFunc starts a lifetime timer of the allocation
+func (a *Allocation) afterFunc(d time.Duration, f func()) lifetimeTimer {
+	if a.timers != nil {
+		return a.timers.AfterFunc(d, f)
+	}
+	return time.AfterFunc(d, f)
+}
+
 // Refresh updates the allocations lifetime
 func (a *Allocation) Refresh(lifetime time.Duration) {
 	if !a.lifetimeTimer.Reset(lifetime) {
-		a.log.Errorf("Failed to reset allocation timer for %v", a.fiveTuple)
+		fastlog.Errorw(a.log, "Failed to reset allocation timer")
 	}
 }
 
@@ -205,11 +541,23 @@ func (a *Allocation) Close() error {
 	}
 	a.permissionsLock.RUnlock()
 
-	a.channelBindingsLock.RLock()
-	for _, c := range a.channelBindings {
+	for _, c := range a.channelTable().list {
 		c.lifetimeTimer.Stop()
+		a.removeOffload(c)
+	}
+
+	if a.egress != nil {
+		a.egress.Leave()
+	}
+	if a.admission != nil {
+		a.admission.release(a.policy.Priority)
+	}
+	if a.memoryBudget != nil {
+		a.memoryBudget.leave()
+	}
+	if a.relayQueue != nil {
+		a.relayQueue.close()
 	}
-	a.channelBindingsLock.RUnlock()
 
 	return a.RelaySocket.Close()
 }
@@ -237,53 +585,133 @@ func (a *Allocation) Close() error {
 const rtpMTU = 1600
 
 func (a *Allocation) packetHandler(m *Manager) {
-	buffer := make([]byte, rtpMTU)
+	if a.profilerLabels != nil {
+		pprof.SetGoroutineLabels(a.profilerLabels)
+	}
+	if a.relayLoops != nil {
+		a.relayLoops.Add(1)
+		defer a.relayLoops.Add(-1)
+	}
 
+	scratch := newRelayScratch()
+	var batch *indicationBatch
+	if a.indicationBatchSize > 1 {
+		batch = newIndicationBatch(a.indicationBatchSize)
+	}
 	for {
-		n, srcAddr, err := a.RelaySocket.ReadFrom(buffer)
+		if batch != nil {
+			scratch = batch.scratch()
+		}
+		n, srcAddr, err := a.readFromPeer(scratch.payload())
 		if err != nil {
 			m.DeleteAllocation(a.fiveTuple)
 			return
 		}
+		a.relayToClient(scratch, n, ipnet.FingerprintAddrPort(srcAddr), batch)
+		if batch != nil && (batch.full() || !a.buffered()) {
+			a.flushIndications(batch)
+		}
+	}
+}
 
-		a.log.Debugf("Relay socket %s received %d bytes from %s",
-			a.RelaySocket.LocalAddr(),
-			n,
-			srcAddr)
+// relayScratch is the memory relaying a datagram to the client takes
+type relayScratch struct {
+	// Datagrams are read behind room for the prefix of a Data indication,
+	// which is larger than the header of ChannelData, and the padding fits
+	// behind them, so both are relayed in place
+	buffer []byte
+}
 
-		if channel := a.GetChannelByAddr(srcAddr); channel != nil {
-			channelData := &proto.ChannelData{
-				Data:   buffer[:n],
-				Number: channel.Number,
-			}
-			channelData.Encode()
+func newRelayScratch() *relayScratch {
+	return &relayScratch{
+		buffer: make([]byte, proto.MaxDataIndicationPrefixSize+rtpMTU+proto.ChannelDataHeaderSize),
+	}
+}
 
-			if _, err = a.TurnSocket.WriteTo(channelData.Raw, a.fiveTuple.SrcAddr); err != nil {
-				a.log.Errorf("Failed to send ChannelData from allocation %v %v", srcAddr, err)
-			}
-		} else if p := a.GetPermission(srcAddr); p != nil {
-			udpAddr, ok := srcAddr.(*net.UDPAddr)
-			if !ok {
-				a.log.Errorf("Failed to send DataIndication from allocation %v %v", srcAddr, err)
-				return
-			}
+// payload is where a datagram from a peer is read to
+func (s *relayScratch) payload() []byte {
+	return s.buffer[proto.MaxDataIndicationPrefixSize : proto.MaxDataIndicationPrefixSize+rtpMTU]
+}
 
-			peerAddressAttr := proto.PeerAddress{IP: udpAddr.IP, Port: udpAddr.Port}
-			dataAttr := proto.Data(buffer[:n])
+// prefixed returns the buffer from size bytes in front of the payload
+func (s *relayScratch) prefixed(size int) []byte {
+	return s.buffer[proto.MaxDataIndicationPrefixSize-size:]
+}
 
-			msg, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodData, stun.ClassIndication), peerAddressAttr, dataAttr)
-			if err != nil {
-				a.log.Errorf("Failed to send DataIndication from allocation %v %v", srcAddr, err)
-				return
-			}
-			a.log.Debugf("Relaying message from %s to client at %s",
-				srcAddr,
-				a.fiveTuple.SrcAddr)
-			if _, err = a.TurnSocket.WriteTo(msg.Raw, a.fiveTuple.SrcAddr); err != nil {
-				a.log.Errorf("Failed to send DataIndication from allocation %v %v", srcAddr, err)
-			}
+// relayToClient relays the datagram of n bytes in the payload of scratch from
+// peer to the client. Data indications are added to batch if not nil, which
+// is flushed before ChannelData to keep the order.
+func (a *Allocation) relayToClient(scratch *relayScratch, n int, peer netip.AddrPort, batch *indicationBatch) {
+	if fastlog.Enabled(a.log, logging.LogLevelDebug) {
+		fastlog.Debugw(a.log, "Relay socket received datagram", "peer", peer, "bytes", n)
+	}
+
+	if channel := a.channelByPeer(peer); channel != nil {
+		channel.Touch()
+		if a.limited() && !a.allowTraffic(a.peerPermission(peer.Addr()), fromPeer, n) {
+			return
+		}
+
+		if batch != nil {
+			a.flushIndications(batch)
+		}
+		channelData := proto.EncodeChannelDataPrefix(scratch.prefixed(proto.ChannelDataHeaderSize), channel.Number, n)
+		if _, err := a.TurnSocket.WriteTo(channelData, a.fiveTuple.SrcAddr); err != nil {
+			fastlog.Errorw(a.log, "Failed to send ChannelData", "peer", peer, "err", err)
 		} else {
-			a.log.Infof("No Permission or Channel exists for %v on allocation %v", srcAddr, a.RelayAddr)
+			a.relayedFromPeer(n)
+		}
+	} else if p := a.permission(peer.Addr()); p != nil {
+		p.Touch()
+		if !a.allowTraffic(p, fromPeer, n) {
+			return
+		}
+
+		msg := proto.EncodeDataIndicationPrefix(scratch.prefixed(proto.DataIndicationPrefixSize(peer.Addr())),
+			stun.NewTransactionID(), peer, n)
+		if fastlog.Enabled(a.log, logging.LogLevelDebug) {
+			fastlog.Debugw(a.log, "Relaying DataIndication", "peer", peer)
+		}
+		if batch != nil {
+			batch.add(msg, n)
+			return
+		}
+		if _, err := a.TurnSocket.WriteTo(msg, a.fiveTuple.SrcAddr); err != nil {
+			fastlog.Errorw(a.log, "Failed to send DataIndication", "peer", peer, "err", err)
+		} else {
+			a.relayedFromPeer(n)
+		}
+	} else {
+		if fastlog.Enabled(a.log, logging.LogLevelInfo) {
+			fastlog.Infow(a.log, "No permission or channel for peer", "peer", peer)
 		}
 	}
 }
+
+// readFromPeer reads the next datagram of the RelaySocket, with receive
+// offload if enabled
+func (a *Allocation) readFromPeer(p []byte) (int, net.Addr, error) {
+	conn := a.RelaySocket
+	if !a.udpOffload() {
+		return conn.ReadFrom(p)
+	}
+
+	s := a.socket
+	if s.groConn != conn {
+		s.groConn, s.gro = conn, newGROReader(conn)
+	}
+	if s.gro == nil {
+		return conn.ReadFrom(p)
+	}
+	return s.gro.ReadFrom(p)
+}
+
+// udpOffload tells if the RelaySocket is written with GSO and read with GRO
+func (a *Allocation) udpOffload() bool {
+	return a.socket != nil && a.socket.udpOffload
+}
+
+func (a *Allocation) relayedFromPeer(n int) {
+	a.bytesFromPeer.Add(uint64(n))
+	a.packetsFromPeer.Add(1)
+}
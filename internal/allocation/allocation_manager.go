@@ -4,14 +4,22 @@
 package allocation
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/ratelimit"
 )
 
 // ManagerConfig a bag of config params for Manager.
@@ -20,6 +28,79 @@ type ManagerConfig struct {
 	AllocatePacketConn func(network string, requestedPort int) (net.PacketConn, net.Addr, error)
 	AllocateConn       func(network string, requestedPort int) (net.Conn, net.Addr, error)
 	PermissionHandler  func(sourceAddr net.Addr, peerIP net.IP) bool
+
+	// ConnectRelaySockets connects the relay socket of an allocation to its
+	// peer while the allocation exchanges traffic with a single peer only
+	ConnectRelaySockets bool
+
+	// UDPOffload writes queued packets with UDP segmentation offload and
+	// reads relay sockets with receive offload, where the kernel supports them
+	UDPOffload bool
+
+	// SharedRelayReaders relays the datagrams of relay sockets that are read by
+	// a reader shared with other relay sockets from that reader, instead of a
+	// goroutine per allocation reading its relay socket
+	SharedRelayReaders bool
+
+	// DataIndicationBatch is the most Data indications an allocation writes to
+	// its client at once while more datagrams of its relay socket are ready.
+	// Zero or one writes them one at a time
+	DataIndicationBatch int
+
+	// RelayQueueSize is the number of packets each allocation may buffer for
+	// writing to peers. Zero disables the queue and writes synchronously
+	RelayQueueSize       int
+	RelayQueueDropPolicy DropPolicy
+
+	// FairQueue drains the relay queues instead of a goroutine per
+	// allocation. It may be shared by several managers. Optional
+	FairQueue *FairQueue
+
+	// BufferPool holds the copies of queued packets until they are written.
+	// It may be shared by several managers. Optional
+	BufferPool *bufpool.Pool
+
+	// MaxPermissions and MaxChannelBindings limit the per-allocation tables.
+	// When a table is full the entry idle for longest is evicted and
+	// EvictionHandler is called. Zero means unlimited
+	MaxPermissions     int
+	MaxChannelBindings int
+	EvictionHandler    func(clientAddr, relayAddr, peer net.Addr, number proto.ChannelNumber)
+
+	// ChannelOffloader relays the channel bindings of UDP allocations
+	// without bandwidth limits, e.g. in the kernel. Optional
+	ChannelOffloader ChannelOffloader
+
+	// EgressLimiter is shared by the allocations of all managers of a server
+	// to cap the relayed bandwidth. Optional
+	EgressLimiter *ratelimit.SharedBucket
+
+	// Admission limits the number of allocations of all managers of a
+	// server by priority. Optional
+	Admission *Admission
+
+	// MemoryBudget bounds the bytes buffered in the relay queues of the
+	// allocations of all managers of a server. Optional
+	MemoryBudget *MemoryBudget
+
+	// ProfilerLabels labels the goroutines of every allocation with its
+	// username and realm, e.g. for goroutine and CPU profiles. It can be
+	// changed later with SetProfilerLabels
+	ProfilerLabels bool
+
+	// TimerWheel fires the lifetime timers of allocations, permissions and
+	// channel bindings, instead of a runtime timer each. It may be shared by
+	// several managers. Optional
+	TimerWheel *TimerWheel
+
+	// OnAllocationCreated and OnAllocationDeleted are called when an
+	// allocation starts relaying and once it is closed. Optional
+	OnAllocationCreated func(a *Allocation)
+	OnAllocationDeleted func(a *Allocation)
+
+	// OnPermissionAdded is called when a permission is installed for a new
+	// peer, not when one is refreshed. Optional
+	OnPermissionAdded func(a *Allocation, peer net.Addr)
 }
 
 type reservation struct {
@@ -34,10 +115,41 @@ type Manager struct {
 
 	allocations  map[FiveTupleFingerprint]*Allocation
 	reservations []*reservation
+	creating     map[FiveTupleFingerprint]struct{} // Five-tuples being allocated by concurrent readers
+	deleted      Traffic                           // Relayed by the deleted allocations
+
+	relayLoops atomic.Int64 // Goroutines relaying for the allocations
 
 	allocatePacketConn func(network string, requestedPort int) (net.PacketConn, net.Addr, error)
 	allocateConn       func(network string, requestedPort int) (net.Conn, net.Addr, error)
 	permissionHandler  func(sourceAddr net.Addr, peerIP net.IP) bool
+
+	connectRelaySockets  bool
+	udpOffload           bool
+	sharedRelayReaders   bool
+	dataIndicationBatch  int
+	relayQueueSize       int
+	relayQueueDropPolicy DropPolicy
+	relayQueueDropped    atomic.Uint64
+	fairQueue            *FairQueue
+	bufferPool           *bufpool.Pool
+
+	maxPermissions     int
+	maxChannelBindings int
+	evictionHandler    func(clientAddr, relayAddr, peer net.Addr, number proto.ChannelNumber)
+
+	channelOffloader ChannelOffloader
+
+	egressLimiter *ratelimit.SharedBucket
+	admission     *Admission
+	memoryBudget  *MemoryBudget
+	timers        *TimerWheel
+
+	profilerLabels atomic.Bool
+
+	onAllocationCreated func(a *Allocation)
+	onAllocationDeleted func(a *Allocation)
+	onPermissionAdded   func(a *Allocation, peer net.Addr)
 }
 
 // NewManager creates a new instance of Manager.
@@ -51,13 +163,46 @@ func NewManager(config ManagerConfig) (*Manager, error) {
 		return nil, errLeveledLoggerMustBeSet
 	}
 
-	return &Manager{
+	m := &Manager{
 		log:                config.LeveledLogger,
 		allocations:        make(map[FiveTupleFingerprint]*Allocation, 64),
+		creating:           map[FiveTupleFingerprint]struct{}{},
 		allocatePacketConn: config.AllocatePacketConn,
 		allocateConn:       config.AllocateConn,
 		permissionHandler:  config.PermissionHandler,
-	}, nil
+
+		connectRelaySockets:  config.ConnectRelaySockets,
+		udpOffload:           config.UDPOffload,
+		sharedRelayReaders:   config.SharedRelayReaders,
+		dataIndicationBatch:  config.DataIndicationBatch,
+		relayQueueSize:       config.RelayQueueSize,
+		relayQueueDropPolicy: config.RelayQueueDropPolicy,
+		fairQueue:            config.FairQueue,
+		bufferPool:           config.BufferPool,
+
+		maxPermissions:     config.MaxPermissions,
+		maxChannelBindings: config.MaxChannelBindings,
+		evictionHandler:    config.EvictionHandler,
+
+		channelOffloader: config.ChannelOffloader,
+
+		egressLimiter: config.EgressLimiter,
+		admission:     config.Admission,
+		memoryBudget:  config.MemoryBudget,
+		timers:        config.TimerWheel,
+
+		onAllocationCreated: config.OnAllocationCreated,
+		onAllocationDeleted: config.OnAllocationDeleted,
+		onPermissionAdded:   config.OnPermissionAdded,
+	}
+	m.profilerLabels.Store(config.ProfilerLabels)
+	return m, nil
+}
+
+// SetProfilerLabels turns the labels of the goroutines of allocations created
+// from now on on or off, see ManagerConfig.ProfilerLabels
+func (m *Manager) SetProfilerLabels(enabled bool) {
+	m.profilerLabels.Store(enabled)
 }
 
 // GetAllocation fetches the allocation matching the passed FiveTuple
@@ -74,21 +219,78 @@ func (m *Manager) AllocationCount() int {
 	return len(m.allocations)
 }
 
+// RelayQueueDropped returns the number of packets discarded by the relay
+// queues of all allocations this manager has created
+func (m *Manager) RelayQueueDropped() uint64 {
+	return m.relayQueueDropped.Load()
+}
+
+// PortsInUse returns the number of relay ports held by allocations or reserved
+// for one, see CreateReservation
+func (m *Manager) PortsInUse() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.allocations) + len(m.reservations)
+}
+
+// Traffic returns the payload relayed by all allocations this manager has
+// created, current and deleted
+func (m *Manager) Traffic() Traffic {
+	m.lock.RLock()
+	total := m.deleted
+	allocations := make([]*Allocation, 0, len(m.allocations))
+	for _, a := range m.allocations {
+		allocations = append(allocations, a)
+	}
+	m.lock.RUnlock()
+
+	for _, a := range allocations {
+		total.add(a.Traffic())
+	}
+	return total
+}
+
+// RelayLoops returns the number of goroutines relaying for the allocations:
+// the readers of their relay sockets and the writers of their relay queues.
+// Relay sockets read by shared readers are not counted.
+func (m *Manager) RelayLoops() int64 {
+	return m.relayLoops.Load()
+}
+
+// RelayQueueLen returns the number of packets waiting in the relay queues of
+// all allocations
+func (m *Manager) RelayQueueLen() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	n := 0
+	for _, a := range m.allocations {
+		n += a.RelayQueueLen()
+	}
+	return n
+}
+
 // Close closes the manager and closes all allocations it manages
 func (m *Manager) Close() error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	for _, a := range m.allocations {
+	for fingerprint, a := range m.allocations {
 		if err := a.Close(); err != nil {
 			return err
 		}
+		// Removed, so the packet handler does not delete it again
+		delete(m.allocations, fingerprint)
+		m.deleted.add(a.Traffic())
+		if m.onAllocationDeleted != nil {
+			m.onAllocationDeleted(a)
+		}
 	}
 	return nil
 }
 
 // CreateAllocation creates a new allocation and starts relaying
-func (m *Manager) CreateAllocation(fiveTuple *FiveTuple, turnSocket net.PacketConn, requestedPort int, lifetime time.Duration, username stun.Username) (*Allocation, error) {
+func (m *Manager) CreateAllocation(fiveTuple *FiveTuple, turnSocket net.PacketConn, requestedPort int, lifetime time.Duration, username stun.Username, policy Policy) (*Allocation, error) {
 	switch {
 	case fiveTuple == nil:
 		return nil, errNilFiveTuple
@@ -102,30 +304,94 @@ func (m *Manager) CreateAllocation(fiveTuple *FiveTuple, turnSocket net.PacketCo
 		return nil, errLifetimeZero
 	}
 
-	if a := m.GetAllocation(fiveTuple); a != nil {
+	// The five-tuple is claimed until the allocation is added, so retransmissions
+	// handled by another reader of the listener are rejected as duplicates
+	fingerprint := fiveTuple.Fingerprint()
+	m.lock.Lock()
+	if _, creating := m.creating[fingerprint]; creating || m.allocations[fingerprint] != nil {
+		m.lock.Unlock()
 		return nil, fmt.Errorf("%w: %v", errDupeFiveTuple, fiveTuple)
 	}
+	m.creating[fingerprint] = struct{}{}
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		delete(m.creating, fingerprint)
+		m.lock.Unlock()
+	}()
+
+	if m.admission != nil && !m.admission.admit(policy.Priority) {
+		return nil, ErrInsufficientCapacity
+	}
+	if m.memoryBudget != nil && !m.memoryBudget.admit() {
+		if m.admission != nil {
+			m.admission.release(policy.Priority)
+		}
+		return nil, ErrInsufficientCapacity
+	}
+
 	a := NewAllocation(turnSocket, fiveTuple, m.log, username)
+	if m.connectRelaySockets || m.udpOffload {
+		a.socket = &relaySocketState{connect: m.connectRelaySockets, udpOffload: m.udpOffload}
+	}
+	a.indicationBatchSize = m.dataIndicationBatch
+	a.maxPermissions = m.maxPermissions
+	a.maxChannelBindings = m.maxChannelBindings
+	a.onEviction = m.evictionHandler
+	a.onPermissionAdded = m.onPermissionAdded
+	a.relayLoops = &m.relayLoops
+	a.offloader = m.channelOffloader
+	a.applyPolicy(policy)
+	if m.egressLimiter != nil {
+		a.egress = m.egressLimiter.Join()
+	}
+	if m.relayQueueSize > 0 {
+		a.relayQueue = newRelayQueue(m.relayQueueSize, m.relayQueueDropPolicy, &m.relayQueueDropped, m.bufferPool, m.memoryBudget)
+		if m.fairQueue != nil {
+			a.flow = m.fairQueue.newFlow(a)
+		}
+	}
 
 	conn, relayAddr, err := m.allocatePacketConn("udp4", requestedPort)
 	if err != nil {
+		if a.egress != nil {
+			a.egress.Leave()
+		}
+		if m.admission != nil {
+			m.admission.release(policy.Priority)
+		}
+		if m.memoryBudget != nil {
+			m.memoryBudget.leave()
+		}
 		return nil, err
 	}
 
 	a.RelaySocket = conn
+	a.admission = m.admission
+	a.memoryBudget = m.memoryBudget
 	a.RelayAddr = relayAddr
 
-	m.log.Debugf("Listening on relay address: %s", a.RelayAddr)
+	a.log = fastlog.With(m.log, "username", a.Username(), "realm", policy.Realm, "src", fiveTuple.SrcAddr, "allocation", relayAddr)
+	fastlog.Debugw(a.log, "Listening on relay address")
 
-	a.lifetimeTimer = time.AfterFunc(lifetime, func() {
+	a.timers = m.timers
+	a.lifetimeTimer = a.afterFunc(lifetime, func() {
 		m.DeleteAllocation(a.fiveTuple)
 	})
 
 	m.lock.Lock()
-	m.allocations[fiveTuple.Fingerprint()] = a
+	m.allocations[fingerprint] = a
 	m.lock.Unlock()
 
-	go a.packetHandler(m)
+	if m.profilerLabels.Load() {
+		a.profilerLabels = pprof.WithLabels(context.Background(), pprof.Labels("username", a.username.String(), "realm", policy.Realm))
+	}
+	if !m.sharedRelayReaders || !a.dispatch(m) {
+		go a.packetHandler(m)
+	}
+	if m.onAllocationCreated != nil {
+		m.onAllocationCreated(a)
+	}
 	return a, nil
 }
 
@@ -142,11 +408,17 @@ func (m *Manager) DeleteAllocation(fiveTuple *FiveTuple) {
 		return
 	}
 
-	if err := allocation.Close(); err != nil {
-		if errors.Is(err, net.ErrClosed) {
-			return
-		}
-		m.log.Errorf("Failed to close allocation: %v", err)
+	err := allocation.Close()
+	m.lock.Lock()
+	m.deleted.add(allocation.Traffic())
+	m.lock.Unlock()
+	if m.onAllocationDeleted != nil {
+		m.onAllocationDeleted(allocation)
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		fastlog.Errorw(allocation.log, "Failed to close allocation", "err", err)
+	} else {
+		fastlog.Debugw(allocation.log, "Deleted allocation")
 	}
 }
 
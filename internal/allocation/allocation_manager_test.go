@@ -7,14 +7,20 @@
 package allocation
 
 import (
+	"bytes"
 	"io"
 	"math/rand"
 	"net"
+	"net/netip"
+	"runtime/pprof"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
 	"github.com/pion/turn/v4/internal/proto"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,9 +33,15 @@ func TestManager(t *testing.T) {
 		{"CreateInvalidAllocation", subTestCreateInvalidAllocation},
 		{"CreateAllocation", subTestCreateAllocation},
 		{"CreateAllocationDuplicateFiveTuple", subTestCreateAllocationDuplicateFiveTuple},
+		{"CreateAllocationConcurrently", subTestCreateAllocationConcurrently},
 		{"DeleteAllocation", subTestDeleteAllocation},
 		{"AllocationTimeout", subTestAllocationTimeout},
 		{"Close", subTestManagerClose},
+		{"AllocationHooks", subTestAllocationHooks},
+		{"Counters", subTestManagerCounters},
+		{"ProfilerLabels", subTestProfilerLabels},
+		{"SharedRelayReaders", subTestSharedRelayReaders},
+		{"AllocationLogger", subTestAllocationLogger},
 		{"GetRandomEvenPort", subTestGetRandomEvenPort},
 	}
 
@@ -52,13 +64,13 @@ func subTestCreateInvalidAllocation(t *testing.T, turnSocket net.PacketConn) {
 	m, err := newTestManager()
 	assert.NoError(t, err)
 
-	if a, err := m.CreateAllocation(nil, turnSocket, 0, proto.DefaultLifetime); a != nil || err == nil {
+	if a, err := m.CreateAllocation(nil, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); a != nil || err == nil {
 		t.Errorf("Illegally created allocation with nil FiveTuple")
 	}
-	if a, err := m.CreateAllocation(randomFiveTuple(), nil, 0, proto.DefaultLifetime); a != nil || err == nil {
+	if a, err := m.CreateAllocation(randomFiveTuple(), nil, 0, proto.DefaultLifetime, nil, Policy{}); a != nil || err == nil {
 		t.Errorf("Illegally created allocation with nil turnSocket")
 	}
-	if a, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, 0); a != nil || err == nil {
+	if a, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, 0, nil, Policy{}); a != nil || err == nil {
 		t.Errorf("Illegally created allocation with 0 lifetime")
 	}
 }
@@ -69,7 +81,7 @@ func subTestCreateAllocation(t *testing.T, turnSocket net.PacketConn) {
 	assert.NoError(t, err)
 
 	fiveTuple := randomFiveTuple()
-	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime); a == nil || err != nil {
+	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); a == nil || err != nil {
 		t.Errorf("Failed to create allocation %v %v", a, err)
 	}
 
@@ -84,21 +96,46 @@ func subTestCreateAllocationDuplicateFiveTuple(t *testing.T, turnSocket net.Pack
 	assert.NoError(t, err)
 
 	fiveTuple := randomFiveTuple()
-	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime); a == nil || err != nil {
+	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); a == nil || err != nil {
 		t.Errorf("Failed to create allocation %v %v", a, err)
 	}
 
-	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime); a != nil || err == nil {
+	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); a != nil || err == nil {
 		t.Errorf("Was able to create allocation with same FiveTuple twice")
 	}
 }
 
+// Test that concurrent requests for a FiveTuple create a single allocation
+func subTestCreateAllocationConcurrently(t *testing.T, turnSocket net.PacketConn) {
+	m, err := newTestManager()
+	assert.NoError(t, err)
+
+	fiveTuple := randomFiveTuple()
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); err == nil {
+				created.Add(1)
+			} else {
+				assert.ErrorIs(t, err, errDupeFiveTuple)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+	assert.Equal(t, 1, m.AllocationCount())
+	assert.NoError(t, m.Close())
+}
+
 func subTestDeleteAllocation(t *testing.T, turnSocket net.PacketConn) {
 	m, err := newTestManager()
 	assert.NoError(t, err)
 
 	fiveTuple := randomFiveTuple()
-	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime); a == nil || err != nil {
+	if a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{}); a == nil || err != nil {
 		t.Errorf("Failed to create allocation %v %v", a, err)
 	}
 
@@ -123,7 +160,7 @@ func subTestAllocationTimeout(t *testing.T, turnSocket net.PacketConn) {
 	for index := range allocations {
 		fiveTuple := randomFiveTuple()
 
-		a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, lifetime)
+		a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, lifetime, nil, Policy{})
 		if err != nil {
 			t.Errorf("Failed to create allocation with %v", fiveTuple)
 		}
@@ -147,9 +184,9 @@ func subTestManagerClose(t *testing.T, turnSocket net.PacketConn) {
 
 	allocations := make([]*Allocation, 2)
 
-	a1, _ := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, time.Second)
+	a1, _ := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, time.Second, nil, Policy{})
 	allocations[0] = a1
-	a2, _ := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, time.Minute)
+	a2, _ := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, time.Minute, nil, Policy{})
 	allocations[1] = a2
 
 	// Make a1 timeout
@@ -166,6 +203,202 @@ func subTestManagerClose(t *testing.T, turnSocket net.PacketConn) {
 	}
 }
 
+// Test that every created allocation is reported deleted exactly once
+func subTestAllocationHooks(t *testing.T, turnSocket net.PacketConn) {
+	m, err := newTestManager()
+	assert.NoError(t, err)
+
+	var created, deleted []*Allocation
+	m.onAllocationCreated = func(a *Allocation) { created = append(created, a) }
+	m.onAllocationDeleted = func(a *Allocation) {
+		assert.True(t, isClose(a.RelaySocket), "a deleted allocation should be closed")
+		deleted = append(deleted, a)
+	}
+
+	fiveTuple := randomFiveTuple()
+	a1, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	a2, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Allocation{a1, a2}, created)
+	assert.Equal(t, "", a1.Username())
+	assert.Equal(t, fiveTuple, a1.FiveTuple())
+	assert.Equal(t, Traffic{}, a1.Traffic())
+
+	m.DeleteAllocation(fiveTuple)
+	m.DeleteAllocation(fiveTuple)
+	assert.Equal(t, []*Allocation{a1}, deleted)
+
+	assert.NoError(t, m.Close())
+	assert.Equal(t, []*Allocation{a1, a2}, deleted)
+}
+
+// Test the counters of the manager across the allocations it created
+func subTestManagerCounters(t *testing.T, turnSocket net.PacketConn) {
+	m, err := newTestManager()
+	assert.NoError(t, err)
+
+	fiveTuple := randomFiveTuple()
+	a1, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	a2, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	m.CreateReservation("token", 5000)
+	assert.Equal(t, 3, m.PortsInUse())
+	assert.Eventually(t, func() bool { return m.RelayLoops() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, m.RelayQueueLen())
+
+	a1.packetsToPeer.Add(2)
+	a1.bytesToPeer.Add(10)
+	a2.packetsFromPeer.Add(1)
+	assert.Equal(t, Traffic{BytesToPeer: 10, PacketsToPeer: 2, PacketsFromPeer: 1}, m.Traffic())
+
+	// Deleted allocations stop relaying, their traffic is kept
+	m.DeleteAllocation(fiveTuple)
+	assert.Equal(t, 2, m.PortsInUse())
+	assert.Eventually(t, func() bool { return m.RelayLoops() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, Traffic{BytesToPeer: 10, PacketsToPeer: 2, PacketsFromPeer: 1}, m.Traffic())
+
+	assert.NoError(t, m.Close())
+	assert.Equal(t, Traffic{BytesToPeer: 10, PacketsToPeer: 2, PacketsFromPeer: 1}, m.Traffic())
+	assert.Eventually(t, func() bool { return m.RelayLoops() == 0 }, time.Second, time.Millisecond)
+}
+
+// Test that the goroutines of allocations are labeled with their credentials
+func subTestProfilerLabels(t *testing.T, turnSocket net.PacketConn) {
+	m, err := newTestManager()
+	assert.NoError(t, err)
+	m.SetProfilerLabels(true)
+	m.relayQueueSize = 8
+
+	a, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, proto.DefaultLifetime, stun.Username("alice"), Policy{Realm: "pion.ly"})
+	assert.NoError(t, err)
+	_, err = a.WriteToPeer([]byte("hello"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9})
+	assert.NoError(t, err)
+
+	goroutines := func() string {
+		var profile bytes.Buffer
+		assert.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+		return profile.String()
+	}
+	assert.Eventually(t, func() bool {
+		profile := goroutines()
+		return strings.Contains(profile, `"username":"alice"`) && strings.Contains(profile, `"realm":"pion.ly"`) &&
+			strings.Contains(profile, "relayQueueWriter")
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, m.Close())
+}
+
+// dispatchingConn is a relay socket with a reader of its own
+type dispatchingConn struct {
+	net.PacketConn
+	handler func(p []byte, from netip.AddrPort)
+	failed  func()
+}
+
+func (c *dispatchingConn) Dispatch(handler func(p []byte, from netip.AddrPort), failed func()) {
+	c.handler, c.failed = handler, failed
+}
+
+// Test that relay sockets read by shared readers relay from them
+func subTestSharedRelayReaders(t *testing.T, turnSocket net.PacketConn) {
+	m, err := newTestManager()
+	assert.NoError(t, err)
+	m.sharedRelayReaders = true
+	relaySocket := &dispatchingConn{}
+	m.allocatePacketConn = func(string, int) (net.PacketConn, net.Addr, error) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		relaySocket.PacketConn = conn
+		return relaySocket, conn.LocalAddr(), err
+	}
+
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+	fiveTuple := &FiveTuple{SrcAddr: client.LocalAddr(), DstAddr: turnSocket.LocalAddr()}
+	a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	assert.NotNil(t, relaySocket.handler, "the relay socket should be dispatching")
+
+	peer := netip.MustParseAddrPort("127.0.0.1:9")
+	relaySocket.handler([]byte("no permission"), peer)
+	a.AddPermission(NewPermission(net.UDPAddrFromAddrPort(peer), m.log))
+	relaySocket.handler([]byte("hello"), peer)
+
+	buf := make([]byte, 1500)
+	assert.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := client.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := &stun.Message{Raw: buf[:n]}
+	assert.NoError(t, msg.Decode())
+	var data proto.Data
+	assert.NoError(t, data.GetFrom(msg))
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, Traffic{BytesFromPeer: 5, PacketsFromPeer: 1}, a.Traffic())
+
+	// A failed reader deletes the allocation
+	relaySocket.failed()
+	assert.Nil(t, m.GetAllocation(fiveTuple))
+	assert.NoError(t, m.Close())
+}
+
+// lockedBuffer is the output of the loggers of the goroutines of a manager
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.String()
+}
+
+func subTestAllocationLogger(t *testing.T, turnSocket net.PacketConn) {
+	out := &lockedBuffer{}
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.Writer = out
+	loggerFactory.DefaultLogLevel = logging.LogLevelDebug
+	m, err := NewManager(ManagerConfig{
+		LeveledLogger: loggerFactory.NewLogger("test"),
+		AllocatePacketConn: func(string, int) (net.PacketConn, net.Addr, error) {
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if err != nil {
+				return nil, nil, err
+			}
+			return conn, conn.LocalAddr(), nil
+		},
+		AllocateConn: func(string, int) (net.Conn, net.Addr, error) { return nil, nil, nil },
+	})
+	assert.NoError(t, err)
+
+	fiveTuple := randomFiveTuple()
+	a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, stun.NewUsername("alice"), Policy{Realm: "pion.ly"})
+	assert.NoError(t, err)
+
+	// Every line of the allocation is scoped to it
+	scope := "username=alice realm=pion.ly src=" + fiveTuple.SrcAddr.String() + " allocation=" + a.RelayAddr.String()
+	assert.Contains(t, out.String(), "Listening on relay address "+scope)
+
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer, a.Log()), proto.DefaultLifetime))
+	a.notifyEviction(peer, proto.MinChannelNumber)
+	assert.Contains(t, out.String(), "Evicted idle channel binding "+scope+" channel=16384 peer=127.0.0.1:5000")
+
+	m.DeleteAllocation(fiveTuple)
+	assert.Contains(t, out.String(), "Deleted allocation "+scope)
+	assert.NoError(t, m.Close())
+}
+
 func randomFiveTuple() *FiveTuple {
 	// nolint
 	return &FiveTuple{
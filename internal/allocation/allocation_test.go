@@ -30,7 +30,9 @@ func TestAllocation(t *testing.T) {
 		{"AddChannelBind", subTestAddChannelBind},
 		{"GetChannelByNumber", subTestGetChannelByNumber},
 		{"GetChannelByAddr", subTestGetChannelByAddr},
+		{"PeerLookupAllocs", subTestPeerLookupAllocs},
 		{"RemoveChannelBind", subTestRemoveChannelBind},
+		{"ChannelBindConcurrently", subTestChannelBindConcurrently},
 		{"Refresh", subTestAllocationRefresh},
 		{"Close", subTestAllocationClose},
 		{"packetHandler", subTestPacketHandler},
@@ -46,7 +48,7 @@ func TestAllocation(t *testing.T) {
 }
 
 func subTestGetPermission(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -88,7 +90,7 @@ func subTestGetPermission(t *testing.T) {
 }
 
 func subTestAddPermission(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -104,10 +106,18 @@ func subTestAddPermission(t *testing.T) {
 
 	foundPermission := a.GetPermission(p.Addr)
 	assert.Equal(t, p, foundPermission)
+
+	// Only new peers are reported, not refreshes
+	var added []net.Addr
+	a.onPermissionAdded = func(_ *Allocation, peer net.Addr) { added = append(added, peer) }
+	a.AddPermission(&Permission{Addr: addr})
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 3478}
+	a.AddPermission(&Permission{Addr: other})
+	assert.Equal(t, []net.Addr{other}, added)
 }
 
 func subTestRemovePermission(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -130,7 +140,7 @@ func subTestRemovePermission(t *testing.T) {
 }
 
 func subTestAddChannelBind(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -154,7 +164,7 @@ func subTestAddChannelBind(t *testing.T) {
 }
 
 func subTestGetChannelByNumber(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -173,7 +183,7 @@ func subTestGetChannelByNumber(t *testing.T) {
 }
 
 func subTestGetChannelByAddr(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -192,8 +202,26 @@ func subTestGetChannelByAddr(t *testing.T) {
 	assert.Nil(t, notExistChannel, "should be nil for not existed channel.")
 }
 
+func subTestPeerLookupAllocs(t *testing.T) {
+	a := NewAllocation(nil, nil, nil, nil)
+
+	peer := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 3478}
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer, nil), proto.DefaultLifetime))
+
+	// Datagrams from IPv4-mapped addresses belong to the IPv4 peer
+	mapped := &net.UDPAddr{IP: peer.IP.To16(), Port: peer.Port}
+	assert.NotNil(t, a.channelByPeer(ipnet.FingerprintAddrPort(mapped)))
+	assert.NotNil(t, a.permission(ipnet.FingerprintAddr(mapped)))
+
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		key := ipnet.FingerprintAddrPort(peer)
+		_ = a.channelByPeer(key)
+		_ = a.permission(key.Addr())
+	}), "looking peers up should not allocate")
+}
+
 func subTestRemoveChannelBind(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:3478")
 	if err != nil {
@@ -213,8 +241,45 @@ func subTestRemoveChannelBind(t *testing.T) {
 	assert.Nil(t, channelByAddr)
 }
 
+func subTestChannelBindConcurrently(t *testing.T) {
+	a := NewAllocation(nil, nil, nil, nil)
+
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+	c := NewChannelBind(proto.MinChannelNumber, peer, nil)
+	assert.NoError(t, a.AddChannelBind(c, proto.DefaultLifetime))
+
+	// The data path looks up channels while others are bound and removed
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			assert.Equal(t, c, a.GetChannelByNumber(c.Number))
+			assert.Equal(t, c, a.GetChannelByAddr(peer))
+		}
+	}()
+	for i := 1; i < 64; i++ {
+		number := proto.MinChannelNumber + proto.ChannelNumber(i)
+		other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478 + i}
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(number, other, nil), proto.DefaultLifetime))
+		assert.True(t, a.RemoveChannelBind(number))
+	}
+	close(done)
+	wg.Wait()
+
+	mapped := &net.UDPAddr{IP: net.ParseIP("::ffff:127.0.0.1"), Port: 3478}
+	assert.Equal(t, c, a.GetChannelByAddr(mapped), "IPv4-mapped peers should match")
+	assert.Nil(t, a.GetChannelByAddr(&net.TCPAddr{IP: peer.IP, Port: peer.Port}))
+}
+
 func subTestAllocationRefresh(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -236,7 +301,7 @@ func subTestAllocationClose(t *testing.T) {
 		panic(err)
 	}
 
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 	a.RelaySocket = l
 	// Add mock lifetimeTimer
 	a.lifetimeTimer = time.AfterFunc(proto.DefaultLifetime, func() {})
@@ -292,7 +357,7 @@ func subTestPacketHandler(t *testing.T) {
 	a, err := m.CreateAllocation(&FiveTuple{
 		SrcAddr: clientListener.LocalAddr(),
 		DstAddr: turnSocket.LocalAddr(),
-	}, turnSocket, 0, proto.DefaultLifetime)
+	}, turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
 
 	assert.Nil(t, err, "should succeed")
 
@@ -357,7 +422,7 @@ func subTestPacketHandler(t *testing.T) {
 }
 
 func subTestResponseCache(t *testing.T) {
-	a := NewAllocation(nil, nil, nil)
+	a := NewAllocation(nil, nil, nil, nil)
 	transactionID := [stun.TransactionIDSize]byte{1, 2, 3}
 	responseAttrs := []stun.Setter{
 		&proto.Lifetime{
@@ -5,9 +5,12 @@ package allocation
 
 import (
 	"net"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/fastlog"
 	"github.com/pion/turn/v4/internal/proto"
 )
 
@@ -17,9 +20,14 @@ type ChannelBind struct {
 	Peer   net.Addr
 	Number proto.ChannelNumber
 
+	peer netip.AddrPort // Key of Peer, set once added to the allocation
+
 	allocation    *Allocation
-	lifetimeTimer *time.Timer
+	lifetimeTimer lifetimeTimer
+	lastUsed      atomic.Int64 // UnixNano of the last relayed packet
 	log           logging.LeveledLogger
+
+	offloaded atomic.Bool // Relayed by the ChannelOffloader of the allocation
 }
 
 // NewChannelBind creates a new ChannelBind
@@ -32,15 +40,21 @@ func NewChannelBind(number proto.ChannelNumber, peer net.Addr, log logging.Level
 }
 
 func (c *ChannelBind) start(lifetime time.Duration) {
-	c.lifetimeTimer = time.AfterFunc(lifetime, func() {
+	c.Touch()
+	c.lifetimeTimer = c.allocation.afterFunc(lifetime, func() {
 		if !c.allocation.RemoveChannelBind(c.Number) {
-			c.log.Errorf("Failed to remove ChannelBind for %v %x %v", c.Number, c.Peer, c.allocation.fiveTuple)
+			fastlog.Errorw(c.log, "Failed to remove channel binding", "channel", int(c.Number), "peer", c.Peer)
 		}
 	})
 }
 
 func (c *ChannelBind) refresh(lifetime time.Duration) {
 	if !c.lifetimeTimer.Reset(lifetime) {
-		c.log.Errorf("Failed to reset ChannelBind timer for %v %x %v", c.Number, c.Peer, c.allocation.fiveTuple)
+		fastlog.Errorw(c.log, "Failed to reset channel binding timer", "channel", int(c.Number), "peer", c.Peer)
 	}
 }
+
+// Touch records that the channel was just used to relay a packet
+func (c *ChannelBind) Touch() {
+	c.lastUsed.Store(time.Now().UnixNano())
+}
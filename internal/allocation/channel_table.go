@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// emptyChannelTable is the table of allocations without channel bindings
+var emptyChannelTable = newChannelTable(nil) //nolint:gochecknoglobals
+
+// channelTable is an immutable snapshot of the channel bindings of an
+// allocation, indexed by number and by peer. Changes copy the table under
+// channelBindingsLock and publish the copy, so the data path looks channels
+// up per packet without contending with ChannelBind requests.
+type channelTable struct {
+	list     []*ChannelBind
+	byNumber map[proto.ChannelNumber]*ChannelBind
+	byPeer   map[netip.AddrPort]*ChannelBind
+}
+
+func newChannelTable(list []*ChannelBind) *channelTable {
+	t := &channelTable{
+		list:     list,
+		byNumber: make(map[proto.ChannelNumber]*ChannelBind, len(list)),
+		byPeer:   make(map[netip.AddrPort]*ChannelBind, len(list)),
+	}
+	for _, c := range list {
+		t.byNumber[c.Number] = c
+		if c.peer.IsValid() {
+			t.byPeer[c.peer] = c
+		}
+	}
+	return t
+}
+
+// peerKey returns the key of a UDP address like ipnet.AddrEqual compares them,
+// IPv4-mapped addresses equal to their IPv4 address. Channels are only bound
+// to UDP peers.
+func peerKey(addr net.Addr) (netip.AddrPort, bool) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	ip, ok := netip.AddrFromSlice(udpAddr.IP)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(udpAddr.Port)), true
+}
+
+// without returns a copy of the bindings without those remove matches, and
+// the removed ones. The list of the table is never modified in place.
+func (t *channelTable) without(remove func(c *ChannelBind) bool) (kept, removed []*ChannelBind) {
+	kept = make([]*ChannelBind, 0, len(t.list))
+	for _, c := range t.list {
+		if remove(c) {
+			removed = append(removed, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	return kept, removed
+}
+
+// channelTable returns the current channel bindings
+func (a *Allocation) channelTable() *channelTable {
+	if t := a.channels.Load(); t != nil {
+		return t
+	}
+	return emptyChannelTable
+}
@@ -19,4 +19,11 @@ var (
 	errFailedToCastUDPAddr         = errors.New("failed to cast net.Addr to *net.UDPAddr")
 	errFailedToAllocateEvenPort    = errors.New("failed to allocate an even port")
 	errAdminProhibited             = errors.New("permission request administratively prohibited")
+	errConnectUnsupported          = errors.New("relay socket does not support connect")
+	errBatchWriteUnsupported       = errors.New("relay socket does not support batched writes")
+	errOffloadUnsupported          = errors.New("relay socket does not support UDP offload")
 )
+
+// ErrInsufficientCapacity is returned by Manager.CreateAllocation when the Admission
+// limit is reached
+var ErrInsufficientCapacity = errors.New("maximum number of allocations reached")
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"math"
+	"net"
+	"net/netip"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// lastUse returns when the channel binding relayed a packet. The allocation
+// does not see the packets of offloaded channels, so they count as in use and
+// are only evicted once every channel binding is offloaded.
+func (c *ChannelBind) lastUse() int64 {
+	if c.offloaded.Load() {
+		return math.MaxInt64
+	}
+	return c.lastUsed.Load()
+}
+
+// idlestPermission returns the permission that relayed a packet least recently.
+// Traffic over a channel bound to a permitted IP counts as use of that
+// permission. The caller must hold permissionsLock.
+func (a *Allocation) idlestPermission() *Permission {
+	channelUse := map[netip.Addr]int64{}
+	for _, c := range a.channelTable().list {
+		fingerprint := c.peer.Addr()
+		if used := c.lastUse(); used > channelUse[fingerprint] {
+			channelUse[fingerprint] = used
+		}
+	}
+
+	var idlest *Permission
+	var idlestUse int64
+	for fingerprint, p := range a.permissions {
+		used := p.lastUsed.Load()
+		if c := channelUse[fingerprint]; c > used {
+			used = c
+		}
+		if idlest == nil || used < idlestUse {
+			idlest, idlestUse = p, used
+		}
+	}
+
+	return idlest
+}
+
+// idlest returns the channel binding that relayed a packet least recently, of
+// equally used ones the oldest
+func (t *channelTable) idlest() *ChannelBind {
+	var idlest *ChannelBind
+	var idlestUse int64
+	for _, c := range t.list {
+		if used := c.lastUse(); idlest == nil || used < idlestUse {
+			idlest, idlestUse = c, used
+		}
+	}
+	return idlest
+}
+
+// evictPermission tears down an already unlinked permission together with the
+// channel bindings that depend on it.
+func (a *Allocation) evictPermission(p *Permission) {
+	p.lifetimeTimer.Stop()
+	a.notifyEviction(p.Addr, 0)
+
+	a.channelBindingsLock.Lock()
+	list, evicted := a.channelTable().without(func(c *ChannelBind) bool {
+		return c.peer.Addr() == p.key
+	})
+	if len(evicted) > 0 {
+		a.channels.Store(newChannelTable(list))
+	}
+	a.channelBindingsLock.Unlock()
+
+	for _, c := range evicted {
+		c.lifetimeTimer.Stop()
+		a.removeOffload(c)
+		a.notifyEviction(c.Peer, c.Number)
+	}
+}
+
+func (a *Allocation) notifyEviction(peer net.Addr, number proto.ChannelNumber) {
+	if number == 0 {
+		fastlog.Debugw(a.log, "Evicted idle permission", "peer", peer)
+	} else {
+		fastlog.Debugw(a.log, "Evicted idle channel binding", "channel", int(number), "peer", peer)
+	}
+
+	if a.onEviction != nil {
+		var clientAddr net.Addr
+		if a.fiveTuple != nil {
+			clientAddr = a.fiveTuple.SrcAddr
+		}
+		a.onEviction(clientAddr, a.RelayAddr, peer, number)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+type evictionRecord struct {
+	peer   string
+	number proto.ChannelNumber
+}
+
+func newEvictionTestAllocation(maxPermissions, maxChannelBindings int) (*Allocation, *[]evictionRecord) {
+	evicted := &[]evictionRecord{}
+
+	a := NewAllocation(nil, nil, logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+	a.maxPermissions = maxPermissions
+	a.maxChannelBindings = maxChannelBindings
+	a.onEviction = func(_, _, peer net.Addr, number proto.ChannelNumber) {
+		*evicted = append(*evicted, evictionRecord{peer.String(), number})
+	}
+
+	return a, evicted
+}
+
+func TestEvictIdlePermission(t *testing.T) {
+	a, evicted := newEvictionTestAllocation(2, 0)
+
+	peer1 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	peer2 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	peer3 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5000}
+
+	a.AddPermission(NewPermission(peer1, a.log))
+	a.AddPermission(NewPermission(peer2, a.log))
+
+	// peer1 carries traffic, so peer2 is the idlest
+	time.Sleep(time.Millisecond)
+	a.GetPermission(peer1).Touch()
+
+	a.AddPermission(NewPermission(peer3, a.log))
+
+	assert.NotNil(t, a.GetPermission(peer1))
+	assert.Nil(t, a.GetPermission(peer2))
+	assert.NotNil(t, a.GetPermission(peer3))
+	assert.Equal(t, []evictionRecord{{peer2.String(), 0}}, *evicted)
+}
+
+func TestEvictPermissionRemovesChannels(t *testing.T) {
+	a, evicted := newEvictionTestAllocation(1, 0)
+
+	peer1 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	peer2 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), proto.DefaultLifetime))
+	a.AddPermission(NewPermission(peer2, a.log))
+
+	assert.Nil(t, a.GetPermission(peer1))
+	assert.Nil(t, a.GetChannelByNumber(proto.MinChannelNumber))
+	assert.Equal(t, []evictionRecord{{peer1.String(), 0}, {peer1.String(), proto.MinChannelNumber}}, *evicted)
+}
+
+func TestEvictIdleChannelBind(t *testing.T) {
+	a, evicted := newEvictionTestAllocation(0, 2)
+
+	peer1 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	peer2 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	peer3 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5000}
+
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), proto.DefaultLifetime))
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber+1, peer2, a.log), proto.DefaultLifetime))
+
+	time.Sleep(time.Millisecond)
+	a.GetChannelByNumber(proto.MinChannelNumber + 1).Touch()
+
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber+2, peer3, a.log), proto.DefaultLifetime))
+
+	assert.Nil(t, a.GetChannelByNumber(proto.MinChannelNumber))
+	assert.NotNil(t, a.GetChannelByNumber(proto.MinChannelNumber+1))
+	assert.NotNil(t, a.GetChannelByNumber(proto.MinChannelNumber+2))
+	assert.Equal(t, []evictionRecord{{peer1.String(), proto.MinChannelNumber}}, *evicted)
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"sync"
+)
+
+// FairQueue writes the relay queues of many allocations in deficit round
+// robin order, so allocations sending a few small packets keep a low latency
+// while others saturate the egress path. Prioritized allocations get a larger
+// quantum. A single goroutine does all writes.
+type FairQueue struct {
+	quantum int
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	active []*flow
+	closed bool
+
+	batch []queuedPacket // Of the writer, written per flow
+}
+
+// flow is the state an allocation has in the FairQueue
+type flow struct {
+	queue      *FairQueue
+	allocation *Allocation
+	head       *queuedPacket // Dequeued but not yet written for lack of deficit
+	deficit    int
+	active     bool
+}
+
+// NewFairQueue creates a FairQueue and starts its writer. It must be stopped
+// with Close.
+func NewFairQueue() *FairQueue {
+	q := newFairQueue(rtpMTU)
+	go q.writer()
+	return q
+}
+
+func newFairQueue(quantum int) *FairQueue {
+	q := &FairQueue{quantum: quantum, batch: make([]queuedPacket, 0, relayBatchSize)}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Close stops the writer. Queued packets are discarded
+func (q *FairQueue) Close() {
+	q.mutex.Lock()
+	q.closed = true
+	q.active = nil
+	q.mutex.Unlock()
+
+	q.cond.Broadcast()
+}
+
+func (q *FairQueue) newFlow(a *Allocation) *flow {
+	return &flow{queue: q, allocation: a}
+}
+
+// activate schedules the flow after a packet was pushed to its relay queue
+func (f *flow) activate() {
+	q := f.queue
+
+	q.mutex.Lock()
+	if f.active || q.closed {
+		q.mutex.Unlock()
+		return
+	}
+	f.active = true
+	q.active = append(q.active, f)
+	q.mutex.Unlock()
+
+	q.cond.Signal()
+}
+
+// next blocks until a flow has packets and removes it from the round, or
+// returns nil once the FairQueue is closed
+func (q *FairQueue) next() *flow {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.active) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil
+	}
+
+	f := q.active[0]
+	q.active[0] = nil
+	q.active = q.active[1:]
+	return f
+}
+
+// requeue puts the flow at the end of the round if it still has packets
+func (q *FairQueue) requeue(f *flow) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	select {
+	case <-f.allocation.closed:
+		f.active = false
+		if f.head != nil {
+			f.allocation.relayQueue.release(*f.head)
+			f.head = nil
+		}
+		return
+	default:
+	}
+
+	if q.closed || (f.head == nil && len(f.allocation.relayQueue.packets) == 0) {
+		f.active = false
+		f.deficit = 0
+		return
+	}
+	q.active = append(q.active, f)
+}
+
+// serve writes packets of the flow until its deficit is used up, in batches
+func (q *FairQueue) serve(f *flow) {
+	f.deficit += q.quantum * priorityWeight(f.allocation.policy.Priority)
+
+	a := f.allocation
+	batch := q.batch[:0]
+	for {
+		if len(batch) == cap(batch) {
+			a.relayQueue.writeBatch(a, batch)
+			batch = batch[:0]
+		}
+
+		if f.head == nil {
+			select {
+			case p := <-a.relayQueue.packets:
+				f.head = &p
+			default:
+				a.relayQueue.writeBatch(a, batch)
+				return
+			}
+		}
+
+		if len(*f.head.data) > f.deficit {
+			a.relayQueue.writeBatch(a, batch)
+			return
+		}
+		f.deficit -= len(*f.head.data)
+
+		batch = append(batch, *f.head)
+		f.head = nil
+	}
+}
+
+func (q *FairQueue) writer() {
+	for {
+		f := q.next()
+		if f == nil {
+			return
+		}
+
+		q.serve(f)
+		q.requeue(f)
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingConn records the order of writes of several relay sockets
+type recordingConn struct {
+	net.PacketConn
+	name   string
+	mutex  *sync.Mutex
+	writes *[]string
+}
+
+func (c *recordingConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.writes = append(*c.writes, c.name)
+	return len(p), nil
+}
+
+func TestFairQueue(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	var mutex sync.Mutex
+	var writes []string
+
+	q := newFairQueue(1000)
+	newFlowAllocation := func(name string) *Allocation {
+		a := NewAllocation(nil, nil, log, nil)
+		a.RelaySocket = &recordingConn{name: name, mutex: &mutex, writes: &writes}
+		a.relayQueue = newRelayQueue(16, DropTail, nil, nil, nil)
+		a.flow = q.newFlow(a)
+		return a
+	}
+	bulk, interactive := newFlowAllocation("bulk"), newFlowAllocation("interactive")
+
+	for i := 0; i < 8; i++ {
+		_, err := bulk.WriteToPeer(make([]byte, 1000), peer)
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := interactive.WriteToPeer(make([]byte, 100), peer)
+		assert.NoError(t, err)
+	}
+
+	for len(q.active) > 0 {
+		f := q.next()
+		q.serve(f)
+		q.requeue(f)
+	}
+
+	// A quantum of 1000 bytes admits one bulk packet or both interactive ones
+	assert.Equal(t, []string{
+		"bulk", "interactive", "interactive", "bulk", "bulk", "bulk", "bulk", "bulk", "bulk", "bulk",
+	}, writes)
+	assert.False(t, bulk.flow.active)
+	assert.Equal(t, 0, bulk.flow.deficit, "idle flows must not keep their deficit")
+
+	q.Close()
+	assert.Nil(t, q.next())
+}
@@ -5,6 +5,9 @@ package allocation
 
 import (
 	"net"
+	"net/netip"
+
+	"github.com/pion/turn/v4/internal/ipnet"
 )
 
 // Protocol is an enum for relay protocol
@@ -34,30 +37,15 @@ func (f *FiveTuple) Equal(b *FiveTuple) bool {
 
 // FiveTupleFingerprint is a comparable representation of a FiveTuple
 type FiveTupleFingerprint struct {
-	srcIP, dstIP     [16]byte
-	srcPort, dstPort uint16
-	protocol         Protocol
+	src, dst netip.AddrPort
+	protocol Protocol
 }
 
 // Fingerprint is the identity of a FiveTuple
-func (f *FiveTuple) Fingerprint() (fp FiveTupleFingerprint) {
-	srcIP, srcPort := netAddrIPAndPort(f.SrcAddr)
-	copy(fp.srcIP[:], srcIP)
-	fp.srcPort = srcPort
-	dstIP, dstPort := netAddrIPAndPort(f.DstAddr)
-	copy(fp.dstIP[:], dstIP)
-	fp.dstPort = dstPort
-	fp.protocol = f.Protocol
-	return
-}
-
-func netAddrIPAndPort(addr net.Addr) (net.IP, uint16) {
-	switch a := addr.(type) {
-	case *net.UDPAddr:
-		return a.IP.To16(), uint16(a.Port)
-	case *net.TCPAddr:
-		return a.IP.To16(), uint16(a.Port)
-	default:
-		return nil, 0
+func (f *FiveTuple) Fingerprint() FiveTupleFingerprint {
+	return FiveTupleFingerprint{
+		src:      ipnet.FingerprintAddrPort(f.SrcAddr),
+		dst:      ipnet.FingerprintAddrPort(f.DstAddr),
+		protocol: f.Protocol,
 	}
 }
@@ -28,6 +28,9 @@ func TestFiveTupleEqual(t *testing.T) {
 	dstAddr1, _ := net.ResolveUDPAddr("udp", "0.0.0.0:3480")
 	dstAddr2, _ := net.ResolveUDPAddr("udp", "0.0.0.0:3481")
 
+	srcAddr1Mapped := &net.UDPAddr{IP: net.IPv4zero.To16(), Port: 3478}
+	srcAddr1Short := &net.UDPAddr{IP: net.IPv4zero.To4(), Port: 3478}
+
 	tt := []struct {
 		name   string
 		expect bool
@@ -58,6 +61,12 @@ func TestFiveTupleEqual(t *testing.T) {
 			&FiveTuple{UDP, srcAddr1, dstAddr1},
 			&FiveTuple{UDP, srcAddr1, dstAddr2},
 		},
+		{
+			"IPv4MappedSrcAddr",
+			true,
+			&FiveTuple{UDP, srcAddr1Mapped, dstAddr1},
+			&FiveTuple{UDP, srcAddr1Short, dstAddr1},
+		},
 	}
 
 	for _, tc := range tt {
@@ -74,3 +83,18 @@ func TestFiveTupleEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestFiveTupleFingerprintAllocs(t *testing.T) {
+	fiveTuple := &FiveTuple{
+		UDP,
+		&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 3478},
+		&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3479},
+	}
+	fingerprints := map[FiveTupleFingerprint]bool{fiveTuple.Fingerprint(): true}
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		_ = fingerprints[fiveTuple.Fingerprint()]
+	}); allocs != 0 {
+		t.Errorf("Fingerprint lookups should not allocate, but %v allocations", allocs)
+	}
+}
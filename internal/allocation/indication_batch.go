@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net/netip"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+)
+
+// indicationBatch collects the Data indications relayed to the client while
+// more datagrams of the relay socket are ready, and writes them together:
+// with sendmmsg(2) to UDP clients, where supported, and as a single write to
+// TCP and TLS clients, whose stream frames the messages anyway. A batch never
+// waits to fill, it is written once the relay socket has nothing buffered, so
+// a lone datagram is relayed as without batching.
+type indicationBatch struct {
+	scratches []*relayScratch
+	messages  [][]byte // Encoded in scratches[:len(messages)]
+	lengths   []int    // Of the data of the messages
+
+	writer  *batchWriter // Of the TurnSocket, nil without batched writes
+	packets []queuedPacket
+	joined  []byte // The messages to stream clients
+}
+
+func newIndicationBatch(size int) *indicationBatch {
+	b := &indicationBatch{
+		scratches: make([]*relayScratch, size),
+		messages:  make([][]byte, 0, size),
+		lengths:   make([]int, 0, size),
+	}
+	for i := range b.scratches {
+		b.scratches[i] = newRelayScratch()
+	}
+	return b
+}
+
+// scratch returns the scratch the next datagram is read to, which no message
+// of the batch is encoded in
+func (b *indicationBatch) scratch() *relayScratch {
+	return b.scratches[len(b.messages)]
+}
+
+// add adds a message carrying n bytes of data, encoded in the scratch
+func (b *indicationBatch) add(msg []byte, n int) {
+	b.messages = append(b.messages, msg)
+	b.lengths = append(b.lengths, n)
+}
+
+func (b *indicationBatch) full() bool {
+	return len(b.messages) == len(b.scratches)
+}
+
+// flushIndications writes the batched Data indications to the client, in order
+func (a *Allocation) flushIndications(b *indicationBatch) {
+	if len(b.messages) == 0 {
+		return
+	}
+	defer func() {
+		b.messages, b.lengths = b.messages[:0], b.lengths[:0]
+	}()
+
+	client := a.fiveTuple.SrcAddr
+	switch {
+	case len(b.messages) == 1:
+	case a.fiveTuple.Protocol != UDP:
+		b.joined = b.joined[:0]
+		for _, msg := range b.messages {
+			b.joined = append(b.joined, msg...)
+		}
+		if _, err := a.TurnSocket.WriteTo(b.joined, client); err != nil {
+			fastlog.Errorw(a.log, "Failed to send DataIndication", "err", err)
+			return
+		}
+		for _, n := range b.lengths {
+			a.relayedFromPeer(n)
+		}
+		return
+	default:
+		if b.writer == nil || b.writer.conn != a.TurnSocket {
+			b.writer = newBatchWriter(a.TurnSocket, false)
+		}
+		if b.writer == nil {
+			break
+		}
+
+		b.packets = b.packets[:0]
+		for i := range b.messages {
+			b.packets = append(b.packets, queuedPacket{data: &b.messages[i], peer: client})
+		}
+		for sent := 0; sent < len(b.packets); {
+			n, err := b.writer.write(b.packets[sent:], netip.AddrPort{})
+			for _, length := range b.lengths[sent : sent+n] {
+				a.relayedFromPeer(length)
+			}
+			if err != nil {
+				// The failed message is skipped, like a failed single write
+				fastlog.Errorw(a.log, "Failed to send DataIndication", "err", err)
+				n++
+			}
+			sent += n
+		}
+		for i := range b.packets {
+			b.packets[i] = queuedPacket{}
+		}
+		return
+	}
+
+	for i, msg := range b.messages {
+		if _, err := a.TurnSocket.WriteTo(msg, client); err != nil {
+			fastlog.Errorw(a.log, "Failed to send DataIndication", "err", err)
+		} else {
+			a.relayedFromPeer(b.lengths[i])
+		}
+	}
+}
+
+// bufferedReader is implemented by relay sockets that receive datagrams ahead
+// of ReadFrom
+type bufferedReader interface {
+	// Buffered returns the number of datagrams ReadFrom returns without waiting
+	Buffered() int
+}
+
+// buffered tells if the next read of the RelaySocket returns without waiting
+func (a *Allocation) buffered() bool {
+	if s := a.socket; s != nil && s.gro != nil && s.groConn == a.RelaySocket && s.gro.buffered() {
+		return true
+	}
+	r, ok := a.RelaySocket.(bufferedReader)
+	return ok && r.Buffered() > 0
+}
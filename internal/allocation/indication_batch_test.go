@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// bufferedConn is a relay socket with datagrams received ahead, which are
+// read once started is closed
+type bufferedConn struct {
+	net.PacketConn
+	started   chan struct{}
+	datagrams chan []byte
+	from      net.Addr
+}
+
+func (c *bufferedConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	<-c.started
+	d, ok := <-c.datagrams
+	if !ok {
+		return 0, nil, net.ErrClosed
+	}
+	return copy(p, d), c.from, nil
+}
+
+func (c *bufferedConn) Buffered() int {
+	return len(c.datagrams)
+}
+
+func (c *bufferedConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+}
+
+func (c *bufferedConn) Close() error {
+	return nil
+}
+
+// streamConn records the writes to a stream client
+type streamConn struct {
+	net.PacketConn
+	mutex  sync.Mutex
+	writes [][]byte
+}
+
+func (c *streamConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writes = append(c.writes, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func (c *streamConn) written() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.writes
+}
+
+// splitIndications returns the data of the Data indications joined in p
+func splitIndications(t *testing.T, p []byte) (data []string) {
+	t.Helper()
+
+	for len(p) > 0 {
+		size := 20 + int(binary.BigEndian.Uint16(p[2:4]))
+		msg := &stun.Message{Raw: p[:size]}
+		assert.NoError(t, msg.Decode())
+		var d proto.Data
+		assert.NoError(t, d.GetFrom(msg))
+		data = append(data, string(d))
+		p = p[size:]
+	}
+	return data
+}
+
+func TestIndicationBatch(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	t.Run("Stream", func(t *testing.T) {
+		relaySocket := &bufferedConn{started: make(chan struct{}), datagrams: make(chan []byte, 8), from: peer}
+		m, err := NewManager(ManagerConfig{
+			LeveledLogger: logging.NewDefaultLoggerFactory().NewLogger("test"),
+			AllocatePacketConn: func(string, int) (net.PacketConn, net.Addr, error) {
+				return relaySocket, relaySocket.LocalAddr(), nil
+			},
+			AllocateConn:        func(string, int) (net.Conn, net.Addr, error) { return nil, nil, nil },
+			DataIndicationBatch: 2,
+		})
+		assert.NoError(t, err)
+
+		client := &streamConn{}
+		fiveTuple := &FiveTuple{
+			Protocol: TCP,
+			SrcAddr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6000},
+			DstAddr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+		}
+		a, err := m.CreateAllocation(fiveTuple, client, 0, proto.DefaultLifetime, nil, Policy{})
+		assert.NoError(t, err)
+		a.AddPermission(NewPermission(peer, m.log))
+
+		// Three datagrams ready make a full batch and one of the rest
+		for _, d := range []string{"a", "bb", "ccc"} {
+			relaySocket.datagrams <- []byte(d)
+		}
+		close(relaySocket.started)
+		assert.Eventually(t, func() bool { return len(client.written()) == 2 }, time.Second, time.Millisecond)
+
+		// A lone datagram is written right away
+		relaySocket.datagrams <- []byte("dddd")
+		assert.Eventually(t, func() bool { return len(client.written()) == 3 }, time.Second, time.Millisecond)
+
+		writes := client.written()
+		assert.Equal(t, []string{"a", "bb"}, splitIndications(t, writes[0]))
+		assert.Equal(t, []string{"ccc"}, splitIndications(t, writes[1]))
+		assert.Equal(t, []string{"dddd"}, splitIndications(t, writes[2]))
+		assert.Equal(t, Traffic{BytesFromPeer: 10, PacketsFromPeer: 4}, a.Traffic())
+
+		close(relaySocket.datagrams)
+		assert.Eventually(t, func() bool { return m.GetAllocation(fiveTuple) == nil }, time.Second, time.Millisecond)
+		assert.NoError(t, m.Close())
+	})
+
+	t.Run("Datagram", func(t *testing.T) {
+		turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer turnSocket.Close() //nolint:errcheck
+		client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer client.Close() //nolint:errcheck
+
+		a := NewAllocation(turnSocket, &FiveTuple{SrcAddr: client.LocalAddr(), DstAddr: turnSocket.LocalAddr()},
+			logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+		b := newIndicationBatch(4)
+		for _, d := range []string{"a", "bb", "ccc"} {
+			scratch := b.scratch()
+			n := copy(scratch.payload(), d)
+			from := netip.MustParseAddrPort(peer.String())
+			b.add(proto.EncodeDataIndicationPrefix(scratch.prefixed(proto.DataIndicationPrefixSize(from.Addr())),
+				stun.NewTransactionID(), from, n), n)
+		}
+		a.flushIndications(b)
+		assert.Equal(t, 0, len(b.messages))
+
+		buf := make([]byte, 1500)
+		assert.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+		for _, want := range []string{"a", "bb", "ccc"} {
+			n, _, err := client.ReadFrom(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{want}, splitIndications(t, buf[:n]))
+		}
+		assert.Equal(t, Traffic{BytesFromPeer: 6, PacketsFromPeer: 3}, a.Traffic())
+	})
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"sync/atomic"
+)
+
+// Pressure is the state of a MemoryBudget, from the least to the most loaded
+type Pressure int
+
+const (
+	// PressureNormal drops only the packets of allocations over their own budget
+	PressureNormal Pressure = iota
+	// PressureHigh also drops the packets of allocations using more than their
+	// share of the total budget
+	PressureHigh
+	// PressureShedding drops every packet and refuses new allocations until
+	// the usage is back to PressureHigh
+	PressureShedding
+)
+
+// MemoryBudget bounds the bytes buffered in the relay queues of every
+// allocation and of the allocations of all managers of a server. Under
+// pressure relayed packets are dropped first, from the allocations using the
+// most; new allocations are only refused once the total budget is exhausted.
+type MemoryBudget struct {
+	perAllocation int64
+	total         int64
+
+	used        atomic.Int64
+	allocations atomic.Int64
+	shedding    atomic.Bool // Set when total is reached, cleared below highWater
+
+	dropped atomic.Uint64
+	refused atomic.Uint64
+}
+
+// NewMemoryBudget creates a MemoryBudget, zero means unlimited
+func NewMemoryBudget(perAllocation, total int64) *MemoryBudget {
+	return &MemoryBudget{perAllocation: perAllocation, total: total}
+}
+
+// highWater is the usage from which PressureHigh starts
+func (b *MemoryBudget) highWater() int64 {
+	return b.total / 4 * 3
+}
+
+// Pressure returns the current state of the budget
+func (b *MemoryBudget) Pressure() Pressure {
+	switch {
+	case b.total == 0:
+		return PressureNormal
+	case b.shedding.Load():
+		return PressureShedding
+	case b.used.Load() >= b.highWater():
+		return PressureHigh
+	default:
+		return PressureNormal
+	}
+}
+
+// Used returns the bytes buffered in the relay queues of all allocations
+func (b *MemoryBudget) Used() int64 {
+	return b.used.Load()
+}
+
+// Dropped returns the number of packets dropped for exceeding the budget
+func (b *MemoryBudget) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Refused returns the number of allocations refused while shedding
+func (b *MemoryBudget) Refused() uint64 {
+	return b.refused.Load()
+}
+
+// admit counts a new allocation, false while the budget is shedding load
+func (b *MemoryBudget) admit() bool {
+	if b.shedding.Load() {
+		b.refused.Add(1)
+		return false
+	}
+	b.allocations.Add(1)
+	return true
+}
+
+// leave uncounts an admitted allocation
+func (b *MemoryBudget) leave() {
+	b.allocations.Add(-1)
+}
+
+// reserve charges n bytes to be buffered by an allocation that buffers queued
+// bytes, false if the packet must be dropped instead
+func (b *MemoryBudget) reserve(queued int64, n int) bool {
+	size := int64(n)
+	if b.perAllocation > 0 && queued+size > b.perAllocation {
+		b.dropped.Add(1)
+		return false
+	}
+	if b.total == 0 {
+		return true
+	}
+	if b.shedding.Load() {
+		b.dropped.Add(1)
+		return false
+	}
+
+	used := b.used.Add(size)
+	switch {
+	case used > b.total:
+		b.shedding.Store(true)
+	case used < b.highWater():
+		return true
+	case queued+size <= b.total/b.allocationCount():
+		return true
+	}
+	b.used.Add(-size)
+	b.dropped.Add(1)
+	return false
+}
+
+// release returns n bytes of a reserved packet that left the queue
+func (b *MemoryBudget) release(n int) {
+	if b.total == 0 {
+		return
+	}
+	if used := b.used.Add(-int64(n)); used < b.highWater() && b.shedding.Load() {
+		b.shedding.Store(false)
+	}
+}
+
+func (b *MemoryBudget) allocationCount() int64 {
+	if count := b.allocations.Load(); count > 0 {
+		return count
+	}
+	return 1
+}
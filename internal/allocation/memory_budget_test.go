@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	packet := func(n int) []byte { return make([]byte, n) }
+
+	t.Run("PerAllocation", func(t *testing.T) {
+		b := NewMemoryBudget(10, 0)
+		q := newRelayQueue(8, DropTail, nil, nil, b)
+		q.push(packet(6), peer)
+		q.push(packet(6), peer)
+
+		assert.Len(t, q.packets, 1)
+		assert.Equal(t, int64(6), q.bytes.Load())
+		assert.Equal(t, uint64(1), b.Dropped())
+		assert.Equal(t, PressureNormal, b.Pressure())
+	})
+
+	t.Run("Total", func(t *testing.T) {
+		b := NewMemoryBudget(0, 100)
+		assert.True(t, b.admit())
+		assert.True(t, b.admit())
+		heavy := newRelayQueue(8, DropTail, nil, nil, b)
+		light := newRelayQueue(8, DropTail, nil, nil, b)
+
+		heavy.push(packet(40), peer)
+		assert.Equal(t, PressureNormal, b.Pressure())
+		heavy.push(packet(40), peer)
+		assert.Len(t, heavy.packets, 1, "over its share of the total under pressure")
+
+		light.push(packet(40), peer)
+		assert.Equal(t, PressureHigh, b.Pressure())
+		assert.Equal(t, int64(80), b.Used())
+
+		light.push(packet(30), peer)
+		assert.Equal(t, PressureShedding, b.Pressure())
+		light.push(packet(1), peer)
+		assert.Equal(t, uint64(3), b.Dropped())
+		assert.False(t, b.admit(), "new allocations are refused while shedding")
+		assert.Equal(t, uint64(1), b.Refused())
+
+		// Written packets return their bytes
+		heavy.release(<-heavy.packets)
+		assert.Equal(t, PressureNormal, b.Pressure())
+		assert.True(t, b.admit())
+
+		light.close()
+		assert.Equal(t, int64(0), b.Used(), "closed queues return their bytes")
+		assert.Equal(t, int64(0), light.bytes.Load())
+		light.push(packet(1), peer)
+		assert.Equal(t, int64(0), b.Used(), "closed queues are not refilled")
+	})
+
+	t.Run("Manager", func(t *testing.T) {
+		turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer turnSocket.Close() //nolint:errcheck
+
+		m, err := newTestManager()
+		assert.NoError(t, err)
+		m.relayQueueSize = 8
+		m.memoryBudget = NewMemoryBudget(0, 100)
+
+		a, err := m.CreateAllocation(randomFiveTuple(), turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), m.memoryBudget.allocations.Load())
+
+		m.memoryBudget.shedding.Store(true)
+		_, err = m.CreateAllocation(randomFiveTuple(), turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+		assert.ErrorIs(t, err, ErrInsufficientCapacity)
+
+		m.DeleteAllocation(a.fiveTuple)
+		assert.Equal(t, int64(0), m.memoryBudget.allocations.Load())
+		assert.NoError(t, m.Close())
+	})
+}
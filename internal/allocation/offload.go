@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// ChannelFlow is a channel binding of a UDP allocation, the four addresses
+// and the number a ChannelOffloader forwards the ChannelData with
+type ChannelFlow struct {
+	ClientAddr net.Addr
+	ServerAddr net.Addr
+	RelayAddr  net.Addr
+	Peer       net.Addr
+	Number     proto.ChannelNumber
+}
+
+// ChannelOffloader relays the traffic of channel bindings outside the
+// allocation, e.g. in the kernel. Offloaded packets are not counted, limited
+// or scheduled by the allocation, so eviction spares offloaded channels.
+type ChannelOffloader interface {
+	// Offload starts relaying the flow. An error leaves it to the allocation.
+	Offload(flow ChannelFlow) error
+	// Remove stops relaying a flow Offload accepted
+	Remove(flow ChannelFlow) error
+}
+
+// offloadChannel hands a new channel binding to the offloader, unless the
+// allocation has to see its packets
+func (a *Allocation) offloadChannel(c *ChannelBind) {
+	if a.offloader == nil || a.fiveTuple == nil || a.fiveTuple.Protocol != UDP || a.limited() {
+		return
+	}
+
+	if err := a.offloader.Offload(a.channelFlow(c)); err != nil {
+		fastlog.Debugw(a.log, "Channel binding is not offloaded", "channel", int(c.Number), "peer", c.Peer, "err", err)
+		return
+	}
+	c.offloaded.Store(true)
+}
+
+// removeOffload takes a removed channel binding back from the offloader
+func (a *Allocation) removeOffload(c *ChannelBind) {
+	if !c.offloaded.CompareAndSwap(true, false) {
+		return
+	}
+
+	if err := a.offloader.Remove(a.channelFlow(c)); err != nil {
+		fastlog.Errorw(a.log, "Failed to remove offloaded channel binding", "channel", int(c.Number), "peer", c.Peer, "err", err)
+	}
+}
+
+func (a *Allocation) channelFlow(c *ChannelBind) ChannelFlow {
+	return ChannelFlow{
+		ClientAddr: a.fiveTuple.SrcAddr,
+		ServerAddr: a.fiveTuple.DstAddr,
+		RelayAddr:  a.RelayAddr,
+		Peer:       c.Peer,
+		Number:     c.Number,
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errOffloadFull = errors.New("offload table full")
+
+// fakeOffloader records the numbers of the offloaded flows
+type fakeOffloader struct {
+	mutex   sync.Mutex
+	flows   map[proto.ChannelNumber]ChannelFlow
+	removed []proto.ChannelNumber
+	full    bool
+}
+
+func (o *fakeOffloader) Offload(flow ChannelFlow) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.full {
+		return errOffloadFull
+	}
+	o.flows[flow.Number] = flow
+	return nil
+}
+
+func (o *fakeOffloader) Remove(flow ChannelFlow) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	delete(o.flows, flow.Number)
+	o.removed = append(o.removed, flow.Number)
+	return nil
+}
+
+func TestChannelOffload(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478}
+	peer1 := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 1), Port: 6000}
+	peer2 := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 2), Port: 6000}
+
+	newAllocation := func(t *testing.T, protocol Protocol, policy Policy) (*Allocation, *fakeOffloader) {
+		t.Helper()
+		relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		offloader := &fakeOffloader{flows: map[proto.ChannelNumber]ChannelFlow{}}
+		a := NewAllocation(nil, &FiveTuple{Protocol: protocol, SrcAddr: client, DstAddr: server},
+			logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+		a.RelaySocket = relaySocket
+		a.RelayAddr = relaySocket.LocalAddr()
+		a.lifetimeTimer = time.AfterFunc(time.Hour, func() {})
+		a.offloader = offloader
+		a.applyPolicy(policy)
+		return a, offloader
+	}
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		a, offloader := newAllocation(t, UDP, Policy{})
+
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), time.Minute))
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber+1, peer2, a.log), time.Minute))
+		assert.Equal(t, ChannelFlow{
+			ClientAddr: client,
+			ServerAddr: server,
+			RelayAddr:  a.RelayAddr,
+			Peer:       peer1,
+			Number:     proto.MinChannelNumber,
+		}, offloader.flows[proto.MinChannelNumber])
+
+		// A refresh keeps the flow
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), time.Minute))
+		assert.Empty(t, offloader.removed)
+
+		assert.True(t, a.RemoveChannelBind(proto.MinChannelNumber))
+		assert.Equal(t, []proto.ChannelNumber{proto.MinChannelNumber}, offloader.removed)
+
+		assert.NoError(t, a.Close())
+		assert.Empty(t, offloader.flows)
+		assert.Equal(t, []proto.ChannelNumber{proto.MinChannelNumber, proto.MinChannelNumber + 1}, offloader.removed)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		a, offloader := newAllocation(t, UDP, Policy{})
+		offloader.full = true
+
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), time.Minute))
+		assert.True(t, a.RemoveChannelBind(proto.MinChannelNumber))
+		assert.Empty(t, offloader.removed, "a rejected flow should not be removed")
+		assert.NoError(t, a.Close())
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		peer3 := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 3), Port: 6000}
+		a, offloader := newAllocation(t, UDP, Policy{})
+		a.maxChannelBindings = 2
+		a.maxPermissions = 2
+
+		// The offloaded channel relays in the kernel and looks idle to the allocation
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), time.Minute))
+		offloader.full = true
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber+1, peer2, a.log), time.Minute))
+		assert.Len(t, offloader.flows, 1)
+		time.Sleep(time.Millisecond)
+		a.GetChannelByNumber(proto.MinChannelNumber + 1).Touch()
+
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber+2, peer3, a.log), time.Minute))
+		assert.NotNil(t, a.GetChannelByNumber(proto.MinChannelNumber), "the offloaded channel should be kept")
+		assert.Nil(t, a.GetChannelByNumber(proto.MinChannelNumber+1))
+		assert.NotNil(t, a.GetChannelByNumber(proto.MinChannelNumber+2))
+		assert.NotNil(t, a.GetPermission(peer1), "the permission of the offloaded channel should be kept")
+		assert.Nil(t, a.GetPermission(peer2))
+		assert.Empty(t, offloader.removed)
+
+		assert.NoError(t, a.Close())
+	})
+
+	for name, newTestAllocation := range map[string]func(t *testing.T) (*Allocation, *fakeOffloader){
+		"TCP":     func(t *testing.T) (*Allocation, *fakeOffloader) { return newAllocation(t, TCP, Policy{}) },
+		"Limited": func(t *testing.T) (*Allocation, *fakeOffloader) { return newAllocation(t, UDP, Policy{Bandwidth: 1e6}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, offloader := newTestAllocation(t)
+			assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1, a.log), time.Minute))
+			assert.Empty(t, offloader.flows, "the allocation should relay the channel itself")
+			assert.NoError(t, a.Close())
+		})
+	}
+}
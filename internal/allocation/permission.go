@@ -5,9 +5,14 @@ package allocation
 
 import (
 	"net"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/ratelimit"
 )
 
 const permissionTimeout = time.Duration(5) * time.Minute
@@ -17,8 +22,11 @@ const permissionTimeout = time.Duration(5) * time.Minute
 // See: https://tools.ietf.org/html/rfc5766#section-2.3
 type Permission struct {
 	Addr          net.Addr
+	key           netip.Addr // Fingerprint of Addr, set once added to the allocation
 	allocation    *Allocation
-	lifetimeTimer *time.Timer
+	lifetimeTimer lifetimeTimer
+	lastUsed      atomic.Int64 // UnixNano of the last relayed packet
+	limiters      [2]*ratelimit.TokenBucket
 	log           logging.LeveledLogger
 }
 
@@ -31,13 +39,19 @@ func NewPermission(addr net.Addr, log logging.LeveledLogger) *Permission {
 }
 
 func (p *Permission) start(lifetime time.Duration) {
-	p.lifetimeTimer = time.AfterFunc(lifetime, func() {
+	p.Touch()
+	p.lifetimeTimer = p.allocation.afterFunc(lifetime, func() {
 		p.allocation.RemovePermission(p.Addr)
 	})
 }
 
 func (p *Permission) refresh(lifetime time.Duration) {
 	if !p.lifetimeTimer.Reset(lifetime) {
-		p.log.Errorf("Failed to reset permission timer for %v %v", p.Addr, p.allocation.fiveTuple)
+		fastlog.Errorw(p.log, "Failed to reset permission timer", "peer", p.Addr)
 	}
 }
+
+// Touch records that the permission was just used to relay a packet
+func (p *Permission) Touch() {
+	p.lastUsed.Store(time.Now().UnixNano())
+}
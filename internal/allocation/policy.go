@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/pion/turn/v4/internal/ratelimit"
+)
+
+// Policy constrains how an allocation relays traffic
+type Policy struct {
+	// PeerBandwidth limits the bits per second relayed to, and separately
+	// from, every single peer IP address. Zero means unlimited
+	PeerBandwidth int64
+
+	// Bandwidth limits the bits per second relayed by the allocation in
+	// both directions combined. Zero means unlimited
+	Bandwidth int64
+
+	// Priority is the class the allocation is admitted and scheduled with,
+	// like PriorityStandard
+	Priority int
+
+	// Guest marks allocations granted without credentials
+	Guest bool
+
+	// CredentialExpiry is when the credentials the allocation is created
+	// with expire, zero if unknown
+	CredentialExpiry time.Time
+
+	// Realm is the realm the allocation is created in
+	Realm string
+}
+
+// applyPolicy sets the policy and creates the allocation wide limiter
+func (a *Allocation) applyPolicy(policy Policy) {
+	a.policy = policy
+	if !policy.CredentialExpiry.IsZero() {
+		a.SetCredentialExpiry(policy.CredentialExpiry)
+	}
+	if policy.Bandwidth > 0 {
+		a.limiter = ratelimit.NewBandwidthLimiter(policy.Bandwidth)
+	}
+}
+
+// Guest reports whether the allocation was granted without credentials
+func (a *Allocation) Guest() bool {
+	return a.policy.Guest
+}
+
+// limited reports whether any bandwidth limit applies to the allocation
+func (a *Allocation) limited() bool {
+	return a.limiter != nil || a.egress != nil || a.policy.PeerBandwidth > 0
+}
+
+// Relay directions, used to index per direction limiters
+const (
+	toPeer = iota
+	fromPeer
+)
+
+// newPeerLimiters returns the limiters of a permission according to the policy
+func (a *Allocation) newPeerLimiters() (limiters [2]*ratelimit.TokenBucket) {
+	if a.policy.PeerBandwidth > 0 {
+		limiters[toPeer] = ratelimit.NewBandwidthLimiter(a.policy.PeerBandwidth)
+		limiters[fromPeer] = ratelimit.NewBandwidthLimiter(a.policy.PeerBandwidth)
+	}
+	return limiters
+}
+
+// allowTraffic reports whether n bytes may be relayed in the direction under
+// the limits of the allocation and of the permission p, counting the packet
+// if it is dropped. The server wide egress limit is checked last, so packets
+// dropped by the allocation don't use up the budget of other allocations
+func (a *Allocation) allowTraffic(p *Permission, direction, n int) bool {
+	allowed := (a.limiter == nil || a.limiter.Allow(n)) &&
+		(p == nil || p.limiters[direction] == nil || p.limiters[direction].Allow(n)) &&
+		(a.egress == nil || a.egress.Allow(n))
+	if !allowed {
+		a.bandwidthDropped.Add(1)
+	}
+
+	return allowed
+}
+
+// peerPermission returns the permission of the peer if per peer limits apply.
+// It saves the lookup on paths that don't already hold the permission.
+func (a *Allocation) peerPermission(peer netip.Addr) *Permission {
+	if a.policy.PeerBandwidth == 0 {
+		return nil
+	}
+	return a.permission(peer)
+}
+
+// BandwidthDropped returns the number of packets dropped because they exceeded
+// a bandwidth limit of the allocation Policy
+func (a *Allocation) BandwidthDropped() uint64 {
+	return a.bandwidthDropped.Load()
+}
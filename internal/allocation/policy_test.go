@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerBandwidthPolicy(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	peer1, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	peer2 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000}
+
+	a := NewAllocation(nil, nil, log, nil)
+	a.RelaySocket = relaySocket
+	a.lifetimeTimer = time.AfterFunc(time.Hour, func() {})
+	// 8kbit/s admits a burst of two full sized datagrams, 3200 bytes
+	a.policy = Policy{PeerBandwidth: 8000}
+
+	a.AddPermission(NewPermission(peer1.LocalAddr(), log))
+	a.AddPermission(NewPermission(peer2, log))
+
+	payload := make([]byte, 1000)
+	for i := 0; i < 4; i++ {
+		n, err := a.WriteToPeer(payload, peer1.LocalAddr())
+		assert.NoError(t, err)
+		assert.Equal(t, len(payload), n)
+	}
+	assert.Equal(t, uint64(1), a.BandwidthDropped())
+
+	// Every peer has its own budget
+	_, err = a.WriteToPeer(payload, peer2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), a.BandwidthDropped())
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, peer1.Close())
+}
+
+func TestAllocationBandwidthPolicy(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	peer1 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	peer2 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000}
+
+	a := NewAllocation(nil, nil, log, nil)
+	a.RelaySocket = relaySocket
+	a.lifetimeTimer = time.AfterFunc(time.Hour, func() {})
+	a.applyPolicy(Policy{Bandwidth: 8000})
+
+	a.AddPermission(NewPermission(peer1, log))
+	a.AddPermission(NewPermission(peer2, log))
+
+	// The budget is shared by all peers of the allocation
+	payload := make([]byte, 1000)
+	for i := 0; i < 3; i++ {
+		_, err = a.WriteToPeer(payload, peer1)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(0), a.BandwidthDropped())
+
+	_, err = a.WriteToPeer(payload, peer2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), a.BandwidthDropped())
+
+	assert.NoError(t, a.Close())
+}
+
+func TestEgressLimiter(t *testing.T) {
+	turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	m, err := newTestManager()
+	assert.NoError(t, err)
+	m.egressLimiter = ratelimit.NewSharedBucket(8_000_000)
+
+	fiveTuple := randomFiveTuple()
+	a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, proto.DefaultLifetime, nil, Policy{})
+	assert.NoError(t, err)
+	assert.True(t, a.limited())
+	assert.Equal(t, 1, m.egressLimiter.Shares())
+
+	m.DeleteAllocation(fiveTuple)
+	assert.Equal(t, 0, m.egressLimiter.Shares(), "closed allocations must release their share")
+
+	assert.NoError(t, m.Close())
+	assert.NoError(t, turnSocket.Close())
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package allocation
+
+import (
+	"net"
+	"net/netip"
+)
+
+// batchWriter is only supported on Linux, queued packets are written one at
+// a time
+type batchWriter struct {
+	conn net.PacketConn
+}
+
+func newBatchWriter(net.PacketConn, bool) *batchWriter {
+	return nil
+}
+
+func (w *batchWriter) write([]queuedPacket, netip.AddrPort) (int, error) {
+	return 0, errBatchWriteUnsupported
+}
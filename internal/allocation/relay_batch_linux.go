@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"net"
+	"net/netip"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchWriter writes several queued packets per system call to the relay
+// socket it was created for, with sendmmsg(2). With gso consecutive packets
+// to the same peer are written as a single datagram the kernel segments.
+type batchWriter struct {
+	conn   net.PacketConn
+	writer interface {
+		WriteBatch(ms []ipv4.Message, flags int) (int, error)
+	}
+	gso bool
+
+	ms       []ipv4.Message
+	segments []int // Number of packets of each message
+}
+
+// newBatchWriter returns a batchWriter for UDP sockets, nil for any other conn.
+// GSO is only used if the kernel supports it.
+func newBatchWriter(conn net.PacketConn, gso bool) *batchWriter {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+
+	w := &batchWriter{conn: conn, writer: ipv4.NewPacketConn(udpConn), gso: gso && supportsGSO(conn)}
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		w.writer = ipv6.NewPacketConn(udpConn)
+	}
+	return w
+}
+
+// write writes the packets in order until one of them fails, and returns the
+// number of packets written. Packets to the connected peer are written without
+// their address, like writeToPeer does.
+func (w *batchWriter) write(ps []queuedPacket, connected netip.AddrPort) (int, error) {
+	w.ms, w.segments = w.ms[:0], w.segments[:0]
+	for i := 0; i < len(ps); {
+		segments := 1
+		if w.gso {
+			segments = gsoSegments(ps[i:])
+		}
+
+		var m ipv4.Message
+		if len(w.ms) < cap(w.ms) {
+			m = w.ms[:len(w.ms)+1][len(w.ms)] // Reuses the buffers of an earlier write
+		}
+		m.Buffers, m.OOB = m.Buffers[:0], m.OOB[:0]
+		for _, p := range ps[i : i+segments] {
+			m.Buffers = append(m.Buffers, *p.data)
+		}
+		if segments > 1 {
+			m.OOB = putSegmentSize(m.OOB, len(*ps[i].data))
+		}
+		m.Addr = ps[i].peer
+		if connected.IsValid() && connected == ps[i].key {
+			m.Addr = nil
+		}
+
+		w.ms = append(w.ms, m)
+		w.segments = append(w.segments, segments)
+		i += segments
+	}
+
+	sent, err := w.writer.WriteBatch(w.ms, 0)
+	if err != nil && sent < len(w.ms) && w.segments[sent] > 1 {
+		// E.g. EIO when the device can not checksum the segments, packets
+		// are written one at a time from now on
+		w.gso = false
+	}
+
+	n := 0
+	for i, m := range w.ms {
+		if i < sent {
+			n += w.segments[i]
+		}
+		for j := range m.Buffers {
+			m.Buffers[j] = nil // The packets are released
+		}
+		w.ms[i].Addr = nil
+	}
+	return n, err
+}
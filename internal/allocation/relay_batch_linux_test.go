@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayQueueWriteBatch(t *testing.T) {
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	peers := make([]net.PacketConn, 2)
+	for i := range peers {
+		peers[i], err = net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+	}
+
+	a := NewAllocation(nil, nil, logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+	a.RelaySocket = relaySocket
+	a.relayQueue = newRelayQueue(2*relayBatchSize, DropTail, nil, bufpool.New(64), nil)
+
+	// More packets than a batch, alternating between the peers
+	for i := 0; i < 2*relayBatchSize; i++ {
+		a.relayQueue.push([]byte(fmt.Sprint(i)), peers[i%2].LocalAddr())
+	}
+	batch := make([]queuedPacket, 0, relayBatchSize)
+	for len(a.relayQueue.packets) > 0 {
+		batch = a.relayQueue.dequeue(batch[:0])
+		assert.Len(t, batch, relayBatchSize)
+		a.relayQueue.writeBatch(a, batch)
+	}
+	assert.NotNil(t, a.relayQueue.writer, "UDP relay sockets should be written in batches")
+
+	buf := make([]byte, 64)
+	for i := 0; i < 2*relayBatchSize; i++ {
+		peer := peers[i%2]
+		assert.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), string(buf[:n]), "packets should keep their order")
+		assert.Equal(t, relaySocket.LocalAddr().String(), from.String())
+	}
+
+	assert.NoError(t, relaySocket.Close())
+	for _, peer := range peers {
+		assert.NoError(t, peer.Close())
+	}
+}
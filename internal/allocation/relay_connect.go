@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package allocation
+
+import "net"
+
+func connectPacketConn(net.PacketConn, net.Addr) error {
+	return errConnectUnsupported
+}
+
+func disconnectPacketConn(net.PacketConn) error {
+	return errConnectUnsupported
+}
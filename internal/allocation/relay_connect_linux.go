@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// connectPacketConn associates the relay socket with a single peer, so the
+// kernel drops datagrams from any other source and the relay can use plain
+// write(2) for egress to that peer.
+func connectPacketConn(conn net.PacketConn, peer net.Addr) error {
+	udpAddr, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return errFailedToCastUDPAddr
+	}
+
+	var sa unix.Sockaddr
+	if ip4 := udpAddr.IP.To4(); ip4 != nil {
+		sa4 := &unix.SockaddrInet4{Port: udpAddr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		sa6 := &unix.SockaddrInet6{Port: udpAddr.Port}
+		copy(sa6.Addr[:], udpAddr.IP.To16())
+		sa = sa6
+	}
+
+	return controlPacketConn(conn, func(fd int) error {
+		return unix.Connect(fd, sa)
+	})
+}
+
+// disconnectPacketConn dissolves the association created by connectPacketConn
+// by connecting to an AF_UNSPEC address, see connect(2).
+func disconnectPacketConn(conn net.PacketConn) error {
+	return controlPacketConn(conn, func(fd int) error {
+		rsa := unix.RawSockaddr{Family: unix.AF_UNSPEC}
+		_, _, errno := unix.Syscall(unix.SYS_CONNECT, uintptr(fd), uintptr(unsafe.Pointer(&rsa)), unsafe.Sizeof(rsa))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+func controlPacketConn(conn net.PacketConn, f func(fd int) error) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errConnectUnsupported
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var opErr error
+	if err := raw.Control(func(fd uintptr) {
+		opErr = f(int(fd))
+	}); err != nil {
+		return err
+	}
+
+	return opErr
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectedRelaySocket(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	peer1, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	peer2, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	a := NewAllocation(nil, nil, log, nil)
+	a.RelaySocket = relaySocket
+	a.socket = &relaySocketState{connect: true}
+	a.lifetimeTimer = time.AfterFunc(proto.DefaultLifetime, func() {})
+
+	// A sole channel binding connects the relay socket
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer1.LocalAddr(), log), proto.DefaultLifetime))
+	assert.Equal(t, peer1.LocalAddr().String(), a.ConnectedPeer().String())
+
+	n, err := a.WriteToPeer([]byte("connected"), peer1.LocalAddr())
+	assert.NoError(t, err)
+	assert.Equal(t, len("connected"), n)
+
+	buf := make([]byte, 64)
+	assert.NoError(t, peer1.SetReadDeadline(time.Now().Add(time.Second)))
+	n, from, err := peer1.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "connected", string(buf[:n]))
+	assert.Equal(t, relaySocket.LocalAddr().String(), from.String())
+
+	// A second permitted peer dissolves the association
+	a.AddPermission(NewPermission(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000}, log))
+	assert.Nil(t, a.ConnectedPeer())
+
+	_, err = a.WriteToPeer([]byte("unconnected"), peer2.LocalAddr())
+	assert.NoError(t, err)
+
+	assert.NoError(t, peer2.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err = peer2.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "unconnected", string(buf[:n]))
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, peer1.Close())
+	assert.NoError(t, peer2.Close())
+}
+
+func TestConnectedRelaySocketPermission(t *testing.T) {
+	log := logging.NewDefaultLoggerFactory().NewLogger("test")
+
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	a := NewAllocation(nil, nil, log, nil)
+	a.RelaySocket = relaySocket
+	a.socket = &relaySocketState{connect: true}
+	a.lifetimeTimer = time.AfterFunc(proto.DefaultLifetime, func() {})
+
+	// A sole permission connects the relay socket for Send indications
+	a.AddPermission(NewPermission(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}, log))
+	assert.Equal(t, "127.0.0.1:5000", a.ConnectedPeer().String())
+
+	// A channel binding on the permitted IP moves the association to its port
+	assert.NoError(t, a.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer.LocalAddr(), log), proto.DefaultLifetime))
+	assert.Equal(t, peer.LocalAddr().String(), a.ConnectedPeer().String())
+
+	_, err = a.WriteToPeer([]byte("connected"), peer.LocalAddr())
+	assert.NoError(t, err)
+	buf := make([]byte, 64)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "connected", string(buf[:n]))
+
+	a.RemovePermission(peer.LocalAddr())
+	assert.Nil(t, a.ConnectedPeer())
+	assert.NoError(t, a.Close())
+}
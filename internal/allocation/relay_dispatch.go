@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// packetDispatcher is a relay socket read by a reader it shares with other
+// relay sockets, which calls a handler with its datagrams instead of the
+// allocation running a goroutine of its own to read it
+type packetDispatcher interface {
+	Dispatch(handler func(p []byte, from netip.AddrPort), failed func())
+}
+
+// relayScratches are shared by the allocations of dispatching relay sockets,
+// whose datagrams are relayed one at a time per reader
+var relayScratches = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return newRelayScratch()
+	},
+}
+
+// dispatch relays the datagrams of a dispatching relay socket from its reader,
+// false if the RelaySocket has to be read by the packetHandler. Receive offload
+// needs the packetHandler.
+func (a *Allocation) dispatch(m *Manager) bool {
+	dispatcher, ok := a.RelaySocket.(packetDispatcher)
+	if !ok || a.udpOffload() {
+		return false
+	}
+
+	dispatcher.Dispatch(func(p []byte, from netip.AddrPort) {
+		scratch := relayScratches.Get().(*relayScratch) //nolint:forcetypeassert
+		n := copy(scratch.payload(), p)
+		a.relayToClient(scratch, n, from, nil)
+		relayScratches.Put(scratch)
+	}, func() {
+		m.DeleteAllocation(a.fiveTuple)
+	})
+	return true
+}
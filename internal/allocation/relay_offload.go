@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package allocation
+
+import "net"
+
+// groReader is only supported on Linux, relay sockets are read a datagram at
+// a time
+type groReader struct{}
+
+func newGROReader(net.PacketConn) *groReader {
+	return nil
+}
+
+func (r *groReader) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, errOffloadUnsupported
+}
+
+func (r *groReader) buffered() bool {
+	return false
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// gsoMaxSegments and gsoMaxSize bound a datagram written with UDP
+	// segmentation offload, see UDP_MAX_SEGMENTS in the kernel
+	gsoMaxSegments = 64
+	gsoMaxSize     = 65507
+
+	// groBufferSize holds the largest datagram coalesced by receive offload
+	groBufferSize = 65535
+)
+
+// supportsGSO tells if the kernel knows UDP_SEGMENT, which it does since 4.18
+func supportsGSO(conn net.PacketConn) bool {
+	return controlPacketConn(conn, func(fd int) error {
+		_, err := unix.GetsockoptInt(fd, unix.IPPROTO_UDP, unix.UDP_SEGMENT)
+		return err
+	}) == nil
+}
+
+// gsoSegments returns how many of the packets, at least one, can be written as
+// a single datagram with UDP segmentation offload: they go to the same peer
+// and all but the last one have the size of the first
+func gsoSegments(ps []queuedPacket) int {
+	size := len(*ps[0].data)
+	if size == 0 {
+		return 1
+	}
+
+	n, total := 1, size
+	for ; n < len(ps) && n < gsoMaxSegments; n++ {
+		next := len(*ps[n].data)
+		if next == 0 || next > size || total+next > gsoMaxSize || ps[0].key != ps[n].key {
+			break
+		}
+		total += next
+		if next < size {
+			return n + 1
+		}
+	}
+	return n
+}
+
+// putSegmentSize stores the UDP_SEGMENT control message of a datagram in oob,
+// reusing its capacity
+func putSegmentSize(oob []byte, size int) []byte {
+	space := unix.CmsgSpace(2)
+	if cap(oob) < space {
+		oob = make([]byte, space)
+	}
+	oob = oob[:space]
+	for i := range oob {
+		oob[i] = 0
+	}
+
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level, h.Type = unix.SOL_UDP, unix.UDP_SEGMENT
+	h.SetLen(unix.CmsgLen(2))
+	*(*uint16)(unsafe.Pointer(&oob[unix.CmsgLen(0)])) = uint16(size)
+	return oob
+}
+
+// groReader reads a relay socket with UDP receive offload enabled and returns
+// the datagrams the kernel coalesced one at a time
+type groReader struct {
+	conn *net.UDPConn
+	buf  []byte
+	oob  []byte
+
+	unread  []byte // Datagrams of the last read not returned yet
+	segment int
+	addr    net.Addr
+}
+
+// newGROReader enables UDP_GRO on the socket, which the kernel supports since
+// 5.0. It returns nil if it can not.
+func newGROReader(conn net.PacketConn) *groReader {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	if err := controlPacketConn(conn, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_UDP, unix.UDP_GRO, 1)
+	}); err != nil {
+		return nil
+	}
+
+	return &groReader{
+		conn: udpConn,
+		buf:  make([]byte, groBufferSize),
+		oob:  make([]byte, unix.CmsgSpace(4)),
+	}
+}
+
+// ReadFrom copies the next datagram into p, like net.PacketConn
+func (r *groReader) ReadFrom(p []byte) (int, net.Addr, error) {
+	if len(r.unread) == 0 {
+		n, oobn, _, addr, err := r.conn.ReadMsgUDP(r.buf, r.oob)
+		if err != nil {
+			return 0, nil, err
+		}
+		r.unread, r.segment, r.addr = r.buf[:n], n, addr
+		if size := groSegmentSize(r.oob[:oobn]); size > 0 {
+			r.segment = size
+		}
+	}
+
+	datagram := r.unread
+	if len(datagram) > r.segment {
+		datagram = datagram[:r.segment]
+	}
+	r.unread = r.unread[len(datagram):]
+	return copy(p, datagram), r.addr, nil
+}
+
+// buffered tells if datagrams of the last read are left to be returned
+func (r *groReader) buffered() bool {
+	return len(r.unread) > 0
+}
+
+// groSegmentSize returns the size of the datagrams the kernel coalesced, zero
+// if the read returned a single datagram
+func groSegmentSize(oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == unix.SOL_UDP && msg.Header.Type == unix.UDP_GRO && len(msg.Data) >= 4 {
+			return int(*(*int32)(unsafe.Pointer(&msg.Data[0])))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package allocation
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/ipnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGSOSegments(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5001}
+	packets := func(peers []net.Addr, size int, sizes ...int) []queuedPacket {
+		ps := make([]queuedPacket, 0, len(sizes)+1)
+		for i, size := range append([]int{size}, sizes...) {
+			data := make([]byte, size)
+			peer := peers[i%len(peers)]
+			ps = append(ps, queuedPacket{data: &data, peer: peer, key: ipnet.FingerprintAddrPort(peer)})
+		}
+		return ps
+	}
+	repeat := func(size, n int) []int {
+		sizes := make([]int, n)
+		for i := range sizes {
+			sizes[i] = size
+		}
+		return sizes
+	}
+
+	assert.Equal(t, 3, gsoSegments(packets([]net.Addr{peer}, 100, 100, 100)))
+	assert.Equal(t, 3, gsoSegments(packets([]net.Addr{peer}, 100, 100, 50, 100)), "a shorter packet should end the datagram")
+	assert.Equal(t, 1, gsoSegments(packets([]net.Addr{peer}, 100, 200)))
+	assert.Equal(t, 1, gsoSegments(packets([]net.Addr{peer, other}, 100, 100)))
+	assert.Equal(t, 1, gsoSegments(packets([]net.Addr{peer}, 0, 0)))
+	assert.Equal(t, gsoMaxSegments, gsoSegments(packets([]net.Addr{peer}, 100, repeat(100, 2*gsoMaxSegments)...)))
+	assert.Equal(t, gsoMaxSize/1400, gsoSegments(packets([]net.Addr{peer}, 1400, repeat(1400, gsoMaxSegments)...)))
+}
+
+func TestUDPOffload(t *testing.T) {
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	if !supportsGSO(relaySocket) {
+		assert.NoError(t, relaySocket.Close())
+		t.Skip("UDP segmentation offload is not supported by the kernel")
+	}
+	plainPeer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	groPeer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	reader := newGROReader(groPeer)
+	require.NotNil(t, reader)
+
+	a := NewAllocation(nil, nil, logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+	a.RelaySocket = relaySocket
+	a.socket = &relaySocketState{udpOffload: true}
+	a.relayQueue = newRelayQueue(32, DropTail, nil, bufpool.New(1500), nil)
+
+	// Equal sized packets with a shorter one at the end, to a peer reading
+	// a datagram at a time and to one reading with GRO
+	sizes := []int{1000, 1000, 1000, 1000, 1000, 400}
+	for _, peer := range []net.PacketConn{plainPeer, groPeer} {
+		for i, size := range sizes {
+			a.relayQueue.push(bytes.Repeat([]byte{byte(i)}, size), peer.LocalAddr())
+		}
+	}
+	a.relayQueue.writeBatch(a, a.relayQueue.dequeue(make([]queuedPacket, 0, relayBatchSize)))
+	assert.True(t, a.relayQueue.writer.gso)
+	assert.Equal(t, []int{len(sizes), len(sizes)}, a.relayQueue.writer.segments, "the packets should be a datagram per peer")
+
+	buf := make([]byte, 1500)
+	for _, read := range []func([]byte) (int, net.Addr, error){plainPeer.ReadFrom, reader.ReadFrom} {
+		for i, size := range sizes {
+			require.NoError(t, plainPeer.SetReadDeadline(time.Now().Add(time.Second)))
+			require.NoError(t, groPeer.SetReadDeadline(time.Now().Add(time.Second)))
+			n, from, err := read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, bytes.Repeat([]byte{byte(i)}, size), buf[:n])
+			assert.Equal(t, relaySocket.LocalAddr().String(), from.String())
+		}
+	}
+
+	for _, conn := range []net.PacketConn{relaySocket, plainPeer, groPeer} {
+		assert.NoError(t, conn.Close())
+	}
+}
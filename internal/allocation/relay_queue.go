@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+	"net/netip"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/ipnet"
+)
+
+// DropPolicy selects which packet is discarded when a relay queue is full
+type DropPolicy int
+
+const (
+	// DropTail discards the packet that is being enqueued
+	DropTail DropPolicy = iota
+	// DropHead discards the oldest queued packet to make room for the new one
+	DropHead
+)
+
+const (
+	// relayBatchSize is the number of queued packets written per system call
+	relayBatchSize = 32
+
+	// relayWriterIdleTimeout is how long the writer of a relay queue waits for
+	// packets before it exits, so idle allocations hold no goroutine for it
+	relayWriterIdleTimeout = time.Second
+)
+
+type queuedPacket struct {
+	data *[]byte // Released to the pool of the queue once written or dropped
+	peer net.Addr
+	key  netip.AddrPort // Fingerprint of peer
+}
+
+// relayQueue is a bounded queue of packets waiting to be written to peers.
+// It decouples the listener read loop from stalls of the relay socket.
+type relayQueue struct {
+	packets chan queuedPacket
+	policy  DropPolicy
+	dropped atomic.Uint64
+	total   *atomic.Uint64 // Shared by all queues of a Manager, may be nil
+	pool    *bufpool.Pool  // May be nil
+	writer  *batchWriter   // Of the relay socket, nil without batched writes
+
+	budget *MemoryBudget // May be nil
+	bytes  atomic.Int64  // Of the queued packets
+	closed atomic.Bool
+
+	writing atomic.Bool // A relayQueueWriter is running
+}
+
+func newRelayQueue(size int, policy DropPolicy, total *atomic.Uint64, pool *bufpool.Pool, budget *MemoryBudget) *relayQueue {
+	return &relayQueue{
+		packets: make(chan queuedPacket, size),
+		policy:  policy,
+		total:   total,
+		pool:    pool,
+		budget:  budget,
+	}
+}
+
+// push enqueues a copy of data, dropping according to the policy if the
+// queue is full or the packet exceeds the budget. It never blocks.
+func (q *relayQueue) push(data []byte, peer net.Addr) {
+	if q.budget != nil && !q.budget.reserve(q.bytes.Load(), len(data)) {
+		return
+	}
+	q.bytes.Add(int64(len(data)))
+	p := queuedPacket{data: q.pool.Copy(data), peer: peer, key: ipnet.FingerprintAddrPort(peer)}
+
+	for {
+		select {
+		case q.packets <- p:
+			// Packets queued while closing are not written
+			if q.closed.Load() {
+				q.drain()
+			}
+			return
+		default:
+		}
+
+		if q.policy != DropHead {
+			q.drop(p)
+			return
+		}
+
+		// Make room by discarding the oldest packet, then retry
+		select {
+		case oldest := <-q.packets:
+			q.drop(oldest)
+		default:
+		}
+	}
+}
+
+// dequeue appends queued packets to batch until it is full, without waiting
+func (q *relayQueue) dequeue(batch []queuedPacket) []queuedPacket {
+	for len(batch) < cap(batch) {
+		select {
+		case p := <-q.packets:
+			batch = append(batch, p)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch writes dequeued packets to their peers, with a single system call
+// where the relay socket supports it, and releases them
+func (q *relayQueue) writeBatch(a *Allocation, batch []queuedPacket) {
+	conn := a.RelaySocket
+	if len(batch) > 1 && (q.writer == nil || q.writer.conn != conn) {
+		q.writer = newBatchWriter(conn, a.udpOffload())
+	}
+	if len(batch) <= 1 || q.writer == nil {
+		for _, p := range batch {
+			q.write(a, p)
+		}
+		return
+	}
+
+	// The association of the socket must not change while the batch is written
+	if s := a.socket; s != nil {
+		s.connectLock.RLock()
+		defer s.connectLock.RUnlock()
+	}
+	connected := a.connectedKey()
+	for unsent := batch; len(unsent) > 0; {
+		n, err := q.writer.write(unsent, connected)
+		if err != nil {
+			// The failed packet is skipped, like a failed single write
+			fastlog.Debugw(a.log, "Failed to relay queued packet", "peer", unsent[n].peer, "err", err)
+			n++
+		}
+		unsent = unsent[n:]
+	}
+	for _, p := range batch {
+		q.release(p)
+	}
+}
+
+// write writes a dequeued packet to the peer and releases it
+func (q *relayQueue) write(a *Allocation, p queuedPacket) {
+	if n, err := a.writeToPeer(*p.data, p.peer, p.key); err != nil {
+		fastlog.Debugw(a.log, "Failed to relay queued packet", "peer", p.peer, "err", err)
+	} else if n != len(*p.data) {
+		fastlog.Debugw(a.log, "Short write relaying queued packet", "peer", p.peer, "written", n, "bytes", len(*p.data))
+	}
+	q.release(p)
+}
+
+func (q *relayQueue) drop(p queuedPacket) {
+	q.release(p)
+	q.dropped.Add(1)
+	if q.total != nil {
+		q.total.Add(1)
+	}
+}
+
+// release returns the buffer of a packet that left the queue and its bytes
+func (q *relayQueue) release(p queuedPacket) {
+	n := len(*p.data)
+	q.pool.Put(p.data)
+	q.bytes.Add(-int64(n))
+	if q.budget != nil {
+		q.budget.release(n)
+	}
+}
+
+// close discards the queued packets, which are not written once the
+// allocation is closed
+func (q *relayQueue) close() {
+	q.closed.Store(true)
+	q.drain()
+}
+
+func (q *relayQueue) drain() {
+	for {
+		select {
+		case p := <-q.packets:
+			q.release(p)
+		default:
+			return
+		}
+	}
+}
+
+// wakeRelayQueueWriter starts the writer of the relay queue unless it runs
+func (a *Allocation) wakeRelayQueueWriter() {
+	if a.relayQueue.writing.CompareAndSwap(false, true) {
+		go a.relayQueueWriter()
+	}
+}
+
+// relayQueueWriter drains the relay queue until the allocation is closed or
+// no packet was queued for relayWriterIdleTimeout
+func (a *Allocation) relayQueueWriter() {
+	if a.profilerLabels != nil {
+		pprof.SetGoroutineLabels(a.profilerLabels)
+	}
+	if a.relayLoops != nil {
+		a.relayLoops.Add(1)
+		defer a.relayLoops.Add(-1)
+	}
+
+	q := a.relayQueue
+	batch := make([]queuedPacket, 0, relayBatchSize)
+	idle := time.NewTimer(relayWriterIdleTimeout)
+	defer idle.Stop()
+	lastWrite := time.Now()
+	for {
+		select {
+		case p := <-q.packets:
+			batch = q.dequeue(append(batch[:0], p))
+			q.writeBatch(a, batch)
+			lastWrite = time.Now()
+		case <-idle.C:
+			if wait := relayWriterIdleTimeout - time.Since(lastWrite); wait > 0 {
+				idle.Reset(wait)
+				continue
+			}
+			q.writing.Store(false)
+			// A packet pushed before the flag was cleared found the writer running
+			if len(q.packets) == 0 || !q.writing.CompareAndSwap(false, true) {
+				return
+			}
+			idle.Reset(relayWriterIdleTimeout)
+		case <-a.closed:
+			return
+		}
+	}
+}
+
+// RelayQueueDropped returns the number of packets the relay queue discarded
+func (a *Allocation) RelayQueueDropped() uint64 {
+	if a.relayQueue == nil {
+		return 0
+	}
+	return a.relayQueue.dropped.Load()
+}
+
+// RelayQueueBytes returns the bytes of the packets waiting in the relay queue
+func (a *Allocation) RelayQueueBytes() int64 {
+	if a.relayQueue == nil {
+		return 0
+	}
+	return a.relayQueue.bytes.Load()
+}
+
+// RelayQueueLen returns the number of packets waiting in the relay queue
+func (a *Allocation) RelayQueueLen() int {
+	if a.relayQueue == nil {
+		return 0
+	}
+	return len(a.relayQueue.packets)
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayQueueDropPolicy(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	t.Run("DropTail", func(t *testing.T) {
+		var total atomic.Uint64
+		q := newRelayQueue(2, DropTail, &total, nil, nil)
+		q.push([]byte{1}, peer)
+		q.push([]byte{2}, peer)
+		q.push([]byte{3}, peer)
+
+		assert.Equal(t, uint64(1), q.dropped.Load())
+		assert.Equal(t, uint64(1), total.Load())
+		assert.Equal(t, []byte{1}, *(<-q.packets).data)
+		assert.Equal(t, []byte{2}, *(<-q.packets).data)
+	})
+
+	t.Run("DropHead", func(t *testing.T) {
+		q := newRelayQueue(2, DropHead, nil, nil, nil)
+		q.push([]byte{1}, peer)
+		q.push([]byte{2}, peer)
+		q.push([]byte{3}, peer)
+
+		assert.Equal(t, uint64(1), q.dropped.Load())
+		assert.Equal(t, []byte{2}, *(<-q.packets).data)
+		assert.Equal(t, []byte{3}, *(<-q.packets).data)
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		q := newRelayQueue(1, DropTail, nil, bufpool.New(16), nil)
+		buf := []byte{1}
+		q.push(buf, peer)
+		buf[0] = 2
+
+		assert.Equal(t, []byte{1}, *(<-q.packets).data)
+	})
+}
+
+func TestRelayQueueWriter(t *testing.T) {
+	relaySocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	a := NewAllocation(nil, nil, logging.NewDefaultLoggerFactory().NewLogger("test"), nil)
+	a.RelaySocket = relaySocket
+	a.relayQueue = newRelayQueue(8, DropTail, nil, nil, nil)
+	a.lifetimeTimer = time.AfterFunc(time.Hour, func() {})
+
+	n, err := a.WriteToPeer([]byte("queued"), peer.LocalAddr())
+	assert.NoError(t, err)
+	assert.Equal(t, len("queued"), n)
+
+	buf := make([]byte, 64)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err = peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "queued", string(buf[:n]))
+	assert.Equal(t, uint64(0), a.RelayQueueDropped())
+
+	// The writer exits once idle and is started again by the next packet
+	assert.Eventually(t, func() bool { return !a.relayQueue.writing.Load() }, 3*relayWriterIdleTimeout, 10*time.Millisecond)
+	_, err = a.WriteToPeer([]byte("again"), peer.LocalAddr())
+	assert.NoError(t, err)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err = peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "again", string(buf[:n]))
+
+	assert.NoError(t, a.Close())
+	assert.NoError(t, peer.Close())
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// sessionKey is the message integrity key the requests of an allocation were
+// last authenticated with
+type sessionKey struct {
+	username, realm string
+	algorithm       proto.PasswordAlgorithm
+	key             []byte
+}
+
+// SessionKey returns the key cached for the credentials, false if requests
+// with them have to be authenticated by the auth handlers
+func (a *Allocation) SessionKey(username, realm string, algorithm proto.PasswordAlgorithm) ([]byte, bool) {
+	s := a.sessionKey.Load()
+	if s == nil || s.username != username || s.realm != realm || s.algorithm != algorithm {
+		return nil, false
+	}
+	return s.key, true
+}
+
+// SetSessionKey caches the key requests with the credentials were
+// authenticated with, replacing the key of other credentials
+func (a *Allocation) SetSessionKey(username, realm string, algorithm proto.PasswordAlgorithm, key []byte) {
+	a.sessionKey.Store(&sessionKey{username: username, realm: realm, algorithm: algorithm, key: key})
+}
+
+// RevokeSessionKey drops the cached key, the next request is authenticated by
+// the auth handlers again
+func (a *Allocation) RevokeSessionKey() {
+	a.sessionKey.Store(nil)
+}
+
+// RevokeSessionKeys drops the cached keys of the allocations of the user, and
+// returns how many allocations had one
+func (m *Manager) RevokeSessionKeys(username string) (revoked int) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, a := range m.allocations {
+		if s := a.sessionKey.Load(); s != nil && s.username == username && a.sessionKey.CompareAndSwap(s, nil) {
+			revoked++
+		}
+	}
+	return revoked
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"testing"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionKey(t *testing.T) {
+	a := NewAllocation(nil, nil, nil, nil)
+	_, ok := a.SessionKey("alice", "pion.ly", proto.PasswordAlgorithmMD5)
+	assert.False(t, ok)
+
+	a.SetSessionKey("alice", "pion.ly", proto.PasswordAlgorithmMD5, []byte("key"))
+	key, ok := a.SessionKey("alice", "pion.ly", proto.PasswordAlgorithmMD5)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("key"), key)
+
+	// Other credentials are authenticated by the auth handlers
+	_, ok = a.SessionKey("bob", "pion.ly", proto.PasswordAlgorithmMD5)
+	assert.False(t, ok)
+	_, ok = a.SessionKey("alice", "example.com", proto.PasswordAlgorithmMD5)
+	assert.False(t, ok)
+	_, ok = a.SessionKey("alice", "pion.ly", proto.PasswordAlgorithmSHA256)
+	assert.False(t, ok)
+
+	a.RevokeSessionKey()
+	_, ok = a.SessionKey("alice", "pion.ly", proto.PasswordAlgorithmMD5)
+	assert.False(t, ok)
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"sync"
+	"time"
+)
+
+// lifetimeTimer expires an allocation, permission or channel binding. It is a
+// *time.Timer of time.AfterFunc or a timer of a TimerWheel.
+type lifetimeTimer interface {
+	// Reset and Stop report whether the timer was pending, like *time.Timer
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// TimerWheel fires the lifetime timers of the allocations of all managers of
+// a server in coarse ticks from a single goroutine. Thousands of allocations
+// refresh their timers within the same few seconds, which with a runtime
+// timer each costs a wakeup per expiry and heap updates per refresh.
+// Timers fire up to a tick late.
+type TimerWheel struct {
+	resolution time.Duration
+	epoch      time.Time // Ticks are counted on the monotonic clock from here
+
+	mutex   sync.Mutex
+	buckets map[int64]map[*wheelTimer]struct{} // By tick of expiry
+	cursor  int64                              // Last tick fired
+	running bool
+	closed  bool
+}
+
+// NewTimerWheel creates a TimerWheel that fires every resolution. Its
+// goroutine only runs while timers are pending.
+func NewTimerWheel(resolution time.Duration) *TimerWheel {
+	return &TimerWheel{
+		resolution: resolution,
+		epoch:      time.Now(),
+		buckets:    map[int64]map[*wheelTimer]struct{}{},
+	}
+}
+
+type wheelTimer struct {
+	wheel *TimerWheel
+	f     func()
+	tick  int64 // Zero when not pending
+}
+
+// AfterFunc calls f in its own goroutine once d elapsed, rounded up to a tick
+func (w *TimerWheel) AfterFunc(d time.Duration, f func()) lifetimeTimer {
+	t := &wheelTimer{wheel: w, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Close stops the wheel, pending timers never fire
+func (w *TimerWheel) Close() {
+	w.mutex.Lock()
+	w.closed = true
+	w.buckets = map[int64]map[*wheelTimer]struct{}{}
+	w.mutex.Unlock()
+}
+
+func (w *TimerWheel) tickOf(t time.Time) int64 {
+	return int64(t.Sub(w.epoch) / w.resolution)
+}
+
+func (t *wheelTimer) Reset(d time.Duration) bool {
+	w := t.wheel
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	pending := t.removeLocked()
+	if w.closed {
+		return pending
+	}
+	now := time.Now()
+	if !w.running {
+		// Nothing is pending, so there are no ticks to catch up on
+		w.cursor = w.tickOf(now)
+	}
+	// Rounded up, so the timer never fires early
+	t.tick = w.tickOf(now.Add(d)) + 1
+	bucket := w.buckets[t.tick]
+	if bucket == nil {
+		bucket = map[*wheelTimer]struct{}{}
+		w.buckets[t.tick] = bucket
+	}
+	bucket[t] = struct{}{}
+
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	return pending
+}
+
+func (t *wheelTimer) Stop() bool {
+	t.wheel.mutex.Lock()
+	defer t.wheel.mutex.Unlock()
+	return t.removeLocked()
+}
+
+func (t *wheelTimer) removeLocked() bool {
+	if t.tick == 0 {
+		return false
+	}
+	if bucket := t.wheel.buckets[t.tick]; bucket != nil {
+		delete(bucket, t)
+		if len(bucket) == 0 {
+			delete(t.wheel.buckets, t.tick)
+		}
+	}
+	t.tick = 0
+	return true
+}
+
+// run fires the expired timers every tick until none are pending
+func (w *TimerWheel) run() {
+	ticker := time.NewTicker(w.resolution)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		w.mutex.Lock()
+		var expired []func()
+		for current := w.tickOf(now); w.cursor < current; {
+			w.cursor++
+			for t := range w.buckets[w.cursor] {
+				t.tick = 0
+				expired = append(expired, t.f)
+			}
+			delete(w.buckets, w.cursor)
+		}
+		idle := len(w.buckets) == 0
+		if idle {
+			w.running = false
+		}
+		w.mutex.Unlock()
+
+		// The expiries of a tick run together, apart from the wheel, so slow
+		// handlers do not delay the next tick
+		if len(expired) > 0 {
+			go func() {
+				for _, f := range expired {
+					f()
+				}
+			}()
+		}
+		if idle {
+			return
+		}
+	}
+}
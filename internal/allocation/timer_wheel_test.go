@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimerWheel(t *testing.T) {
+	const resolution = 10 * time.Millisecond
+
+	t.Run("fires once a tick passed the lifetime", func(t *testing.T) {
+		w := NewTimerWheel(resolution)
+		start := time.Now()
+		fired := make(chan time.Time, 1)
+		w.AfterFunc(25*time.Millisecond, func() { fired <- time.Now() })
+
+		select {
+		case at := <-fired:
+			assert.GreaterOrEqual(t, at.Sub(start), 25*time.Millisecond, "never early")
+		case <-time.After(time.Second):
+			assert.Fail(t, "timer did not fire")
+		}
+		assert.Eventually(t, func() bool {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			return !w.running
+		}, time.Second, resolution, "the goroutine stops without pending timers")
+	})
+
+	t.Run("Reset and Stop", func(t *testing.T) {
+		w := NewTimerWheel(resolution)
+		var fired atomic.Int32
+		timer := w.AfterFunc(time.Hour, func() { fired.Add(1) })
+		stopped := w.AfterFunc(time.Hour, func() { fired.Add(10) })
+
+		assert.True(t, stopped.Stop())
+		assert.False(t, stopped.Stop())
+		assert.True(t, timer.Reset(resolution), "pending timers report so")
+		assert.Eventually(t, func() bool { return fired.Load() == 1 }, time.Second, resolution)
+		assert.False(t, timer.Reset(time.Hour), "fired timers are no longer pending")
+		assert.True(t, timer.Stop())
+
+		w.Close()
+		timer.Reset(resolution)
+		time.Sleep(5 * resolution)
+		assert.Equal(t, int32(1), fired.Load(), "closed wheels do not fire")
+	})
+
+	t.Run("expires allocations, permissions and channels", func(t *testing.T) {
+		turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer turnSocket.Close() //nolint:errcheck
+
+		m, err := newTestManager()
+		assert.NoError(t, err)
+		m.timers = NewTimerWheel(resolution)
+		defer m.timers.Close()
+
+		fiveTuple := randomFiveTuple()
+		a, err := m.CreateAllocation(fiveTuple, turnSocket, 0, 50*time.Millisecond, nil, Policy{})
+		assert.NoError(t, err)
+		peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+		assert.NoError(t, a.AddChannelBind(NewChannelBind(0x4000, peer, m.log), time.Hour))
+		assert.NotNil(t, a.GetPermission(peer))
+
+		assert.Eventually(t, func() bool { return m.GetAllocation(fiveTuple) == nil }, time.Second, resolution)
+		assert.NoError(t, m.Close())
+	})
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package bufpool pools the buffers packets are copied into while they wait
+// to be relayed, so high packet rates do not allocate a buffer for every packet
+package bufpool
+
+import "sync"
+
+// Pool is a sync.Pool of buffers of a fixed size. Buffers are returned to it
+// with Put once the packet they hold has been handled. A nil Pool allocates
+// every buffer.
+type Pool struct {
+	size int
+	pool sync.Pool
+}
+
+// New returns a Pool of buffers of size bytes
+func New(size int) *Pool {
+	p := &Pool{size: size}
+	p.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+// Copy returns a buffer holding a copy of data. Data larger than the buffers
+// of the pool is copied into a buffer of its own.
+func (p *Pool) Copy(data []byte) *[]byte {
+	if p == nil || len(data) > p.size {
+		b := append([]byte(nil), data...)
+		return &b
+	}
+	b := p.pool.Get().(*[]byte) //nolint:forcetypeassert
+	*b = (*b)[:len(data)]
+	copy(*b, data)
+	return b
+}
+
+// Put returns a buffer of Copy to the pool. The buffer must not be used
+// afterwards.
+func (p *Pool) Put(b *[]byte) {
+	if p == nil || b == nil || cap(*b) != p.size {
+		return
+	}
+	*b = (*b)[:p.size]
+	p.pool.Put(b)
+}
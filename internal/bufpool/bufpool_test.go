@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package bufpool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	pool := New(4)
+
+	b := pool.Copy([]byte{1, 2, 3})
+	assert.Equal(t, []byte{1, 2, 3}, *b)
+	assert.Equal(t, 4, cap(*b))
+	pool.Put(b)
+
+	large := pool.Copy([]byte{1, 2, 3, 4, 5})
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, *large)
+	pool.Put(large) // Discarded, it is not of the size of the pool
+
+	// A buffer from the pool holds no more than the copied data
+	for i := 0; i < 8; i++ {
+		b := pool.Copy([]byte{9})
+		assert.Equal(t, []byte{9}, *b)
+		pool.Put(b)
+	}
+
+	var nilPool *Pool
+	b = nilPool.Copy([]byte{1})
+	assert.Equal(t, []byte{1}, *b)
+	nilPool.Put(b)
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := New(1600)
+	data := make([]byte, 1200)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pool.Put(pool.Copy(data))
+	}
+}
@@ -4,9 +4,11 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -28,24 +30,244 @@ type AllocationConfig struct {
 	Lifetime    time.Duration
 	Net         transport.Net
 	Log         logging.LeveledLogger
+
+	// MaxRetries is how often an operation is retried after a recoverable error,
+	// like 438 (Stale Nonce). Defaults to 3
+	MaxRetries int
+
+	// OnRefreshFailed is called when a refresh of the allocation failed all
+	// its retransmissions, or the server no longer knows the allocation
+	OnRefreshFailed func(err error)
+
+	// Optional callbacks for the lifecycle of the allocation
+	OnRefreshed         func(relayedAddr net.Addr, lifetime time.Duration)
+	OnExpired           func(relayedAddr net.Addr)
+	OnPermissionFailure func(peer net.Addr, err error)
+
+	// OnData is offered inbound data before it is queued for ReadFrom, and
+	// returns true if it consumed it. The data is only valid during the call
+	OnData func(from net.Addr, data []byte) bool
+
+	// OnExpiring is called ExpiryWarning before the allocation expires, unless
+	// it was refreshed in the meantime. ExpiryWarning defaults to a quarter of
+	// the lifetime
+	OnExpiring    func(relayedAddr net.Addr, remaining time.Duration)
+	ExpiryWarning time.Duration
+
+	// Optional metrics of UDPConn. OnSent and OnReceived are called with the
+	// size of every payload relayed to and from peers, OnChannels with the
+	// number of channels whenever one is added or removed
+	OnSent     func(n int)
+	OnReceived func(n int)
+	OnChannels func(n int)
+
+	// Optional timer schedule. The allocation is refreshed every RefreshInterval,
+	// half of the lifetime by default, and permissions every PermissionRefreshInterval,
+	// 2 minutes by default. If KeepaliveInterval is set, a Binding request is sent
+	// to the server at that interval. Every interval is shortened by a random share
+	// of up to RefreshJitter
+	RefreshInterval           time.Duration
+	PermissionRefreshInterval time.Duration
+	KeepaliveInterval         time.Duration
+	RefreshJitter             float64
+
+	// Setters add attributes to every request, like SOFTWARE
+	Setters []stun.Setter
+
+	// CredentialsProvider is asked for new credentials when the server answers a
+	// request with 401 (Unauthorized) or 438 (Stale Nonce), before it is retried.
+	// Optional, the credentials of the allocation are kept otherwise
+	CredentialsProvider func(realm string) (username, password string)
+
+	// ReadQueueSize is how many inbound packets UDPConn queues for ReadFrom.
+	// Packets arriving while the queue is full are dropped. Defaults to 1024
+	ReadQueueSize int
+
+	// CloseTimeout bounds how long Close waits for writes in flight and for the
+	// server to confirm the deallocation. By default, Close sends the Refresh
+	// with lifetime 0 without waiting
+	CloseTimeout time.Duration
 }
 
 type allocation struct {
 	client            Client                // Read-only
-	relayedAddr       net.Addr              // Read-only
-	serverAddr        net.Addr              // Read-only
+	_relayedAddr      net.Addr              // Needs mutex x
+	_serverAddr       net.Addr              // Needs mutex x
 	permMap           *permissionMap        // Thread-safe
-	integrity         stun.MessageIntegrity // Read-only
-	username          stun.Username         // Read-only
+	_integrity        stun.MessageIntegrity // Needs mutex x
+	_username         stun.Username         // Needs mutex x
 	realm             stun.Realm            // Read-only
 	_nonce            stun.Nonce            // Needs mutex x
 	_lifetime         time.Duration         // Needs mutex x
+	_refreshedAt      time.Time             // Needs mutex x
 	net               transport.Net         // Thread-safe
 	refreshAllocTimer *PeriodicTimer        // Thread-safe
 	refreshPermsTimer *PeriodicTimer        // Thread-safe
 	readTimer         *time.Timer           // Thread-safe
 	mutex             sync.RWMutex          // Thread-safe
 	log               logging.LeveledLogger // Read-only
+	maxRetries        int                   // Read-only
+	onRefreshFailed   func(err error)       // Read-only
+
+	onRefreshed         func(relayedAddr net.Addr, lifetime time.Duration)  // Read-only
+	onExpired           func(relayedAddr net.Addr)                          // Read-only
+	onPermissionFailure func(peer net.Addr, err error)                      // Read-only
+	onData              func(from net.Addr, data []byte) bool               // Read-only
+	onExpiring          func(relayedAddr net.Addr, remaining time.Duration) // Needs mutex x
+	expiryWarning       time.Duration                                       // Read-only
+	expiryTimer         *time.Timer                                         // Needs mutex x
+
+	onSent     func(n int) // Read-only
+	onReceived func(n int) // Read-only
+	onChannels func(n int) // Read-only
+
+	refreshInterval     time.Duration  // Read-only
+	permRefreshInterval time.Duration  // Read-only
+	keepaliveInterval   time.Duration  // Read-only
+	refreshJitter       float64        // Read-only
+	keepaliveTimer      *PeriodicTimer // Thread-safe
+	setters             []stun.Setter  // Read-only
+
+	credentialsProvider func(realm string) (username, password string) // Read-only
+	closeTimeout        time.Duration                                  // Read-only
+}
+
+func (a *allocation) applyConfig(config *AllocationConfig) {
+	a.maxRetries = maxRetryAttempts
+	if config.MaxRetries > 0 {
+		a.maxRetries = config.MaxRetries
+	}
+	a.onRefreshFailed = config.OnRefreshFailed
+	a.onRefreshed = config.OnRefreshed
+	a.onExpired = config.OnExpired
+	a.onPermissionFailure = config.OnPermissionFailure
+	a.onData = config.OnData
+	a.onExpiring = config.OnExpiring
+	a.expiryWarning = config.ExpiryWarning
+	a.onSent = config.OnSent
+	a.onReceived = config.OnReceived
+	a.onChannels = config.OnChannels
+
+	a.refreshInterval = a._lifetime / 2
+	if config.RefreshInterval > 0 && config.RefreshInterval < a._lifetime {
+		a.refreshInterval = config.RefreshInterval
+	}
+	a.permRefreshInterval = permRefreshInterval
+	if config.PermissionRefreshInterval > 0 {
+		a.permRefreshInterval = config.PermissionRefreshInterval
+	}
+	a.keepaliveInterval = config.KeepaliveInterval
+	a.refreshJitter = config.RefreshJitter
+	a.setters = config.Setters
+	a.credentialsProvider = config.CredentialsProvider
+	a.closeTimeout = config.CloseTimeout
+	a.setRefreshedAt(a._refreshedAt) // Schedules the expiry warning
+}
+
+// startTimers starts refreshing the allocation and its permissions, and sending
+// keepalives if enabled
+func (a *allocation) startTimers(onRefreshPerms PeriodicTimerTimeoutHandler) {
+	a.refreshAllocTimer = NewPeriodicTimer(
+		timerIDRefreshAlloc,
+		a.onRefreshTimers,
+		a.refreshInterval,
+	)
+
+	a.refreshPermsTimer = NewPeriodicTimer(
+		timerIDRefreshPerms,
+		onRefreshPerms,
+		a.permRefreshInterval,
+	)
+
+	a.keepaliveTimer = NewPeriodicTimer(
+		timerIDKeepalive,
+		a.onRefreshTimers,
+		a.keepaliveInterval,
+	)
+
+	for _, timer := range []*PeriodicTimer{a.refreshAllocTimer, a.refreshPermsTimer, a.keepaliveTimer} {
+		timer.SetJitter(a.refreshJitter)
+	}
+
+	if a.refreshAllocTimer.Start() {
+		a.log.Debug("Started refresh allocation timer")
+	}
+	if a.refreshPermsTimer.Start() {
+		a.log.Debug("Started refresh permission timer")
+	}
+	if a.keepaliveInterval > 0 && a.keepaliveTimer.Start() {
+		a.log.Debug("Started keepalive timer")
+	}
+}
+
+func (a *allocation) stopTimers() {
+	a.refreshAllocTimer.Stop()
+	a.refreshPermsTimer.Stop()
+	a.keepaliveTimer.Stop()
+	a.stopExpiryWarning()
+}
+
+// sendKeepalive sends a Binding request to the server without waiting for the
+// response, which only matters to keep NAT bindings open
+func (a *allocation) sendKeepalive() {
+	setters := append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, a.setters...)
+	msg, err := stun.Build(append(setters, stun.Fingerprint)...)
+	if err != nil {
+		a.log.Warnf("Failed to build keepalive: %s", err)
+		return
+	}
+	if _, err := a.client.PerformTransaction(msg, a.serverAddr(), true); err != nil {
+		a.log.Debugf("Failed to send keepalive: %s", err)
+	}
+}
+
+// authenticated appends the configured attributes and the credentials of the
+// allocation to the attributes of a request
+func (a *allocation) authenticated(setters ...stun.Setter) []stun.Setter {
+	username, integrity := a.credentials()
+	setters = append(setters, a.setters...)
+	return append(setters,
+		username,
+		a.realm,
+		a.nonce(),
+		integrity,
+		stun.Fingerprint,
+	)
+}
+
+// reauthenticate takes the nonce of a 401 (Unauthorized) or 438 (Stale Nonce)
+// response and asks the CredentialsProvider for new credentials. It returns
+// false if the request should not be retried
+func (a *allocation) reauthenticate(res *stun.Message, code stun.ErrorCode) bool {
+	if code == stun.CodeUnauthorized && a.credentialsProvider == nil {
+		return false
+	}
+
+	a.setNonceFromMsg(res)
+	if a.credentialsProvider != nil {
+		username, password := a.credentialsProvider(a.realm.String())
+		a.setCredentials(
+			stun.NewUsername(username),
+			stun.NewLongTermIntegrity(username, a.realm.String(), password),
+		)
+		a.log.Debugf("Rotated credentials after %d response", code)
+	}
+	return true
+}
+
+func (a *allocation) credentials() (stun.Username, stun.MessageIntegrity) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._username, a._integrity
+}
+
+func (a *allocation) setCredentials(username stun.Username, integrity stun.MessageIntegrity) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._username = username
+	a._integrity = integrity
 }
 
 func (a *allocation) setNonceFromMsg(msg *stun.Message) {
@@ -53,29 +275,28 @@ func (a *allocation) setNonceFromMsg(msg *stun.Message) {
 	var nonce stun.Nonce
 	if err := nonce.GetFrom(msg); err == nil {
 		a.setNonce(nonce)
-		a.log.Debug("Refresh allocation: 438, got new nonce.")
+		a.log.Debug("Got new nonce.")
 	} else {
-		a.log.Warn("Refresh allocation: 438 but no nonce.")
+		a.log.Warn("Error response without nonce.")
 	}
 }
 
 func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) error {
-	msg, err := stun.Build(
+	return a.refreshAllocationContext(context.Background(), lifetime, dontWait)
+}
+
+func (a *allocation) refreshAllocationContext(ctx context.Context, lifetime time.Duration, dontWait bool) error {
+	msg, err := stun.Build(a.authenticated(
 		stun.TransactionID,
 		stun.NewType(stun.MethodRefresh, stun.ClassRequest),
 		proto.Lifetime{Duration: lifetime},
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
-		stun.Fingerprint,
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errFailedToBuildRefreshRequest, err.Error())
 	}
 
 	a.log.Debugf("Send refresh request (dontWait=%v)", dontWait)
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, dontWait)
+	trRes, err := a.client.PerformTransactionContext(ctx, msg, a.serverAddr(), dontWait)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errFailedToRefreshAllocation, err.Error())
 	}
@@ -91,11 +312,15 @@ func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) er
 	if res.Type.Class == stun.ClassErrorResponse {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
-			if code.Code == stun.CodeStaleNonce {
-				a.setNonceFromMsg(res)
-				return errTryAgain
+			switch code.Code {
+			case stun.CodeStaleNonce, stun.CodeUnauthorized:
+				if a.reauthenticate(res, code.Code) {
+					return errTryAgain
+				}
+			case stun.CodeAllocMismatch:
+				return fmt.Errorf("%w: %s", errAllocationMismatch, code)
 			}
-			return err
+			return fmt.Errorf("%s (error %s)", res.Type, code) //nolint:goerr113
 		}
 		return fmt.Errorf("%s", res.Type) //nolint:goerr113
 	}
@@ -108,9 +333,86 @@ func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) er
 
 	a.setLifetime(updatedLifetime.Duration)
 	a.log.Debugf("Updated lifetime: %d seconds", int(a.lifetime().Seconds()))
+
+	if lifetime > 0 {
+		a.setRefreshedAt(time.Now())
+
+		if a.onRefreshed != nil {
+			a.onRefreshed(a.relayedAddr(), updatedLifetime.Duration)
+		}
+	}
 	return nil
 }
 
+// PermissionInfo describes a permission of an allocation
+type PermissionInfo struct {
+	Peer      net.Addr  // Address the permission was created for, it covers all ports of its IP
+	Permitted bool      // The server confirmed the permission
+	ExpiresAt time.Time // When the server drops the permission unless it is refreshed
+}
+
+// Permissions returns the permissions of the allocation, ordered by peer address
+func (a *allocation) Permissions() []PermissionInfo {
+	perms := a.permMap.permissions()
+	infos := make([]PermissionInfo, 0, len(perms))
+	for _, perm := range perms {
+		info := PermissionInfo{Peer: perm.addr}
+		if refreshedAt := perm.refreshedAt.Load(); refreshedAt > 0 && perm.state() == permStatePermitted {
+			info.Permitted = true
+			info.ExpiresAt = time.Unix(0, refreshedAt).Add(permLifetime)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Peer.String() < infos[j].Peer.String()
+	})
+	return infos
+}
+
+// closeContext returns the context bounding a graceful Close, or nil if the
+// allocation is closed without waiting
+func (a *allocation) closeContext() (context.Context, context.CancelFunc) {
+	if a.closeTimeout <= 0 {
+		return nil, func() {}
+	}
+	return context.WithTimeout(context.Background(), a.closeTimeout)
+}
+
+// deallocate frees the allocation on the server with a Refresh of lifetime 0.
+// With a nil context the request is sent without waiting for the response,
+// otherwise the response is waited for until the context is done.
+func (a *allocation) deallocate(ctx context.Context) error {
+	if ctx == nil {
+		return a.refreshAllocation(0, true /* dontWait=true */)
+	}
+
+	var err error
+	for i := 0; i < a.maxRetries; i++ {
+		err = a.refreshAllocationContext(ctx, 0, false)
+		if !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+	if errors.Is(err, errAllocationMismatch) {
+		// The server already freed it
+		return nil
+	}
+	return err
+}
+
+// expired reports whether the allocation is gone on the server, because it
+// said so or because it was not refreshed within its lifetime
+func (a *allocation) expired(err error) bool {
+	if errors.Is(err, errAllocationMismatch) {
+		return true
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return time.Since(a._refreshedAt) >= a._lifetime
+}
+
 func (a *allocation) refreshPermissions() error {
 	addrs := a.permMap.addrs()
 	if len(addrs) == 0 {
@@ -122,6 +424,9 @@ func (a *allocation) refreshPermissions() error {
 			return errTryAgain
 		}
 		a.log.Errorf("Fail to refresh permissions: %s", err)
+		for _, addr := range addrs {
+			a.permissionFailed(addr, err)
+		}
 		return err
 	}
 	a.log.Debug("Refresh permissions successful")
@@ -131,12 +436,14 @@ func (a *allocation) refreshPermissions() error {
 func (a *allocation) onRefreshTimers(id int) {
 	a.log.Debugf("Refresh timer %d expired", id)
 	switch id {
+	case timerIDKeepalive:
+		a.sendKeepalive()
 	case timerIDRefreshAlloc:
 		var err error
 		lifetime := a.lifetime()
-		// Limit the max retries on errTryAgain to 3
+		// Limit the max retries on errTryAgain
 		// when stale nonce returns, sencond retry should succeed
-		for i := 0; i < maxRetryAttempts; i++ {
+		for i := 0; i < a.maxRetries; i++ {
 			err = a.refreshAllocation(lifetime, false)
 			if !errors.Is(err, errTryAgain) {
 				break
@@ -144,10 +451,16 @@ func (a *allocation) onRefreshTimers(id int) {
 		}
 		if err != nil {
 			a.log.Warnf("Failed to refresh allocation: %s", err)
+			if a.onExpired != nil && a.expired(err) {
+				a.onExpired(a.relayedAddr())
+			}
+			if a.onRefreshFailed != nil {
+				a.onRefreshFailed(err)
+			}
 		}
 	case timerIDRefreshPerms:
 		var err error
-		for i := 0; i < maxRetryAttempts; i++ {
+		for i := 0; i < a.maxRetries; i++ {
 			err = a.refreshPermissions()
 			if !errors.Is(err, errTryAgain) {
 				break
@@ -159,6 +472,12 @@ func (a *allocation) onRefreshTimers(id int) {
 	}
 }
 
+func (a *allocation) permissionFailed(peer net.Addr, err error) {
+	if a.onPermissionFailure != nil {
+		a.onPermissionFailure(peer, err)
+	}
+}
+
 func (a *allocation) nonce() stun.Nonce {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
@@ -174,6 +493,85 @@ func (a *allocation) setNonce(nonce stun.Nonce) {
 	a._nonce = nonce
 }
 
+func (a *allocation) relayedAddr() net.Addr {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._relayedAddr
+}
+
+func (a *allocation) setRelayedAddr(addr net.Addr) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._relayedAddr = addr
+}
+
+func (a *allocation) serverAddr() net.Addr {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._serverAddr
+}
+
+func (a *allocation) setServerAddr(addr net.Addr) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._serverAddr = addr
+}
+
+func (a *allocation) setRefreshedAt(at time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._refreshedAt = at
+
+	if a.onExpiring == nil {
+		return
+	}
+	warning := a.expiryWarning
+	if warning == 0 {
+		warning = a._lifetime / 4
+	}
+	d := time.Until(at.Add(a._lifetime)) - warning
+	if a.expiryTimer == nil {
+		a.expiryTimer = time.AfterFunc(d, a.warnExpiry)
+	} else {
+		a.expiryTimer.Reset(d)
+	}
+}
+
+func (a *allocation) warnExpiry() {
+	a.mutex.RLock()
+	onExpiring := a.onExpiring
+	relayedAddr := a._relayedAddr
+	remaining := time.Until(a._refreshedAt.Add(a._lifetime))
+	a.mutex.RUnlock()
+
+	if onExpiring != nil && remaining > 0 {
+		onExpiring(relayedAddr, remaining)
+	}
+}
+
+func (a *allocation) stopExpiryWarning() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.expiryTimer != nil {
+		a.expiryTimer.Stop()
+	}
+	a.onExpiring = nil // No rescheduling by a refresh in flight
+}
+
+// ExpiresAt returns when the allocation expires unless it is refreshed
+func (a *allocation) ExpiresAt() time.Time {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._refreshedAt.Add(a._lifetime)
+}
+
 func (a *allocation) lifetime() time.Duration {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
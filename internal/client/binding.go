@@ -36,6 +36,7 @@ type binding struct {
 	mgr          *bindingManager // Read-only
 	muBind       sync.Mutex      // Thread-safe, for ChannelBind ops
 	_refreshedAt time.Time       // Protected by mutex
+	lastUsed     atomic.Int64    // Unix nanoseconds of the last packet on the channel
 	mutex        sync.RWMutex    // Thread-safe
 }
 
@@ -61,6 +62,16 @@ func (b *binding) refreshedAt() time.Time {
 	return b._refreshedAt
 }
 
+func (b *binding) touch() {
+	b.lastUsed.Store(time.Now().UnixNano())
+}
+
+// usedSinceRefresh reports whether the channel was used since it was bound
+// or refreshed last
+func (b *binding) usedSinceRefresh() bool {
+	return b.lastUsed.Load() > b.refreshedAt().UnixNano()
+}
+
 // Thread-safe binding map
 type bindingManager struct {
 	chanMap map[uint16]*binding
@@ -103,6 +114,18 @@ func (mgr *bindingManager) create(addr net.Addr) *binding {
 	return b
 }
 
+// bindings returns all bindings
+func (mgr *bindingManager) bindings() []*binding {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	bindings := make([]*binding, 0, len(mgr.chanMap))
+	for _, b := range mgr.chanMap {
+		bindings = append(bindings, b)
+	}
+	return bindings
+}
+
 func (mgr *bindingManager) findByAddr(addr net.Addr) (*binding, bool) {
 	mgr.mutex.RLock()
 	defer mgr.mutex.RUnlock()
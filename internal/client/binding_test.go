@@ -6,6 +6,7 @@ package client
 import (
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -76,3 +77,17 @@ func TestBindingManager(t *testing.T) {
 		assert.False(t, ok, "should fail")
 	})
 }
+
+func TestBindingUsedSinceRefresh(t *testing.T) {
+	m := newBindingManager()
+	addr, _ := net.ResolveUDPAddr("udp", "127.0.0.1:1111")
+	b := m.create(addr)
+	assert.False(t, b.usedSinceRefresh())
+
+	b.touch()
+	assert.True(t, b.usedSinceRefresh())
+
+	b.setRefreshedAt(time.Now().Add(time.Second))
+	assert.False(t, b.usedSinceRefresh())
+	assert.Equal(t, []*binding{b}, m.bindings())
+}
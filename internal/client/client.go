@@ -5,6 +5,7 @@
 package client
 
 import (
+	"context"
 	"net"
 
 	"github.com/pion/stun/v3"
@@ -14,5 +15,12 @@ import (
 type Client interface {
 	WriteTo(data []byte, to net.Addr) (int, error)
 	PerformTransaction(msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error)
+	PerformTransactionContext(ctx context.Context, msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error)
 	OnDeallocated(relayedAddr net.Addr)
 }
+
+// BuffersWriter is implemented by clients that can write a packet gathered
+// from several buffers without joining them first
+type BuffersWriter interface {
+	WriteBuffersTo(bufs net.Buffers, to net.Addr) (int, error)
+}
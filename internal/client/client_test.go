@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"net"
 
 	"github.com/pion/stun/v3"
@@ -29,6 +30,10 @@ func (c *mockClient) PerformTransaction(msg *stun.Message, to net.Addr, dontWait
 	return TransactionResult{}, errFake
 }
 
+func (c *mockClient) PerformTransactionContext(_ context.Context, msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error) {
+	return c.PerformTransaction(msg, to, dontWait)
+}
+
 func (c *mockClient) OnDeallocated(relayedAddr net.Addr) {
 	if c.onDeallocated != nil {
 		c.onDeallocated(relayedAddr)
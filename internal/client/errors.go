@@ -22,6 +22,7 @@ var (
 	errFailedToGetLifetime                 = errors.New("failed to get lifetime from refresh response")
 	errInvalidTURNAddress                  = errors.New("invalid TURN server address")
 	errUnexpectedSTUNRequestMessage        = errors.New("unexpected STUN request message")
+	errAllocationMismatch                  = errors.New("allocation no longer exists on the server")
 )
 
 type timeoutError struct {
@@ -4,6 +4,7 @@
 package client
 
 import (
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -15,6 +16,7 @@ type PeriodicTimerTimeoutHandler func(timerID int)
 type PeriodicTimer struct {
 	id             int
 	interval       time.Duration
+	jitter         float64
 	timeoutHandler PeriodicTimerTimeoutHandler
 	stopFunc       func()
 	mutex          sync.RWMutex
@@ -29,6 +31,22 @@ func NewPeriodicTimer(id int, timeoutHandler PeriodicTimerTimeoutHandler, interv
 	}
 }
 
+// SetJitter shortens every interval by a random share of up to jitter, which is
+// between 0 and 1. It must be called before Start.
+func (t *PeriodicTimer) SetJitter(jitter float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.jitter = jitter
+}
+
+func (t *PeriodicTimer) nextInterval() time.Duration {
+	if t.jitter <= 0 {
+		return t.interval
+	}
+	return t.interval - time.Duration(rand.Float64()*t.jitter*float64(t.interval)) //nolint:gosec
+}
+
 // Start starts the timer.
 func (t *PeriodicTimer) Start() bool {
 	t.mutex.Lock()
@@ -45,7 +63,7 @@ func (t *PeriodicTimer) Start() bool {
 		canceling := false
 
 		for !canceling {
-			timer := time.NewTimer(t.interval)
+			timer := time.NewTimer(t.nextInterval())
 
 			select {
 			case <-timer.C:
@@ -37,6 +37,17 @@ func TestPeriodicTimer(t *testing.T) {
 		assert.Equal(t, 4, int(atomic.LoadUint64(&nCbs)), "should be called 4 times (actual: %d)", atomic.LoadUint64(&nCbs))
 	})
 
+	t.Run("jitter", func(t *testing.T) {
+		rt := NewPeriodicTimer(5, func(int) {}, 100*time.Millisecond)
+		rt.SetJitter(0.5)
+
+		for i := 0; i < 100; i++ {
+			interval := rt.nextInterval()
+			assert.LessOrEqual(t, interval, 100*time.Millisecond)
+			assert.Greater(t, interval, 50*time.Millisecond)
+		}
+	})
+
 	t.Run("stop inside handler", func(t *testing.T) {
 		timerID := 4
 		var rt *PeriodicTimer
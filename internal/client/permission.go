@@ -5,8 +5,10 @@ package client
 
 import (
 	"net"
+	"net/netip"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pion/turn/v4/internal/ipnet"
 )
@@ -19,9 +21,11 @@ const (
 )
 
 type permission struct {
-	addr  net.Addr
-	st    permState    // Thread-safe (atomic op)
-	mutex sync.RWMutex // Thread-safe
+	addr        net.Addr
+	st          permState    // Thread-safe (atomic op)
+	lastUsed    atomic.Int64 // Unix nanoseconds of the last packet to or from the peer
+	refreshedAt atomic.Int64 // Unix nanoseconds of the last confirmed CreatePermission
+	mutex       sync.RWMutex // Thread-safe
 }
 
 func (p *permission) setState(state permState) {
@@ -32,9 +36,17 @@ func (p *permission) state() permState {
 	return permState(atomic.LoadInt32((*int32)(&p.st)))
 }
 
+func (p *permission) touch() {
+	p.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (p *permission) setRefreshedAt(at time.Time) {
+	p.refreshedAt.Store(at.UnixNano())
+}
+
 // Thread-safe permission map
 type permissionMap struct {
-	permMap map[string]*permission
+	permMap map[netip.Addr]*permission
 	mutex   sync.RWMutex
 }
 
@@ -42,6 +54,7 @@ func (m *permissionMap) insert(addr net.Addr, p *permission) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	p.addr = addr
+	p.touch()
 	m.permMap[ipnet.FingerprintAddr(addr)] = p
 	return true
 }
@@ -59,6 +72,30 @@ func (m *permissionMap) delete(addr net.Addr) {
 	delete(m.permMap, ipnet.FingerprintAddr(addr))
 }
 
+// deleteIdle deletes the permissions not used since the given time, so they
+// are no longer refreshed
+func (m *permissionMap) deleteIdle(since time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, p := range m.permMap {
+		if p.lastUsed.Load() < since.UnixNano() {
+			delete(m.permMap, key)
+		}
+	}
+}
+
+func (m *permissionMap) permissions() []*permission {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	perms := make([]*permission, 0, len(m.permMap))
+	for _, p := range m.permMap {
+		perms = append(perms, p)
+	}
+	return perms
+}
+
 func (m *permissionMap) addrs() []net.Addr {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -72,6 +109,6 @@ func (m *permissionMap) addrs() []net.Addr {
 
 func newPermissionMap() *permissionMap {
 	return &permissionMap{
-		permMap: map[string]*permission{},
+		permMap: map[netip.Addr]*permission{},
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -90,4 +91,21 @@ func TestPermissionMap(t *testing.T) {
 		pm.delete(udpAddr2)
 		assert.Equal(t, 0, len(pm.permMap))
 	})
+
+	t.Run("Delete idle", func(t *testing.T) {
+		pm := newPermissionMap()
+		idleAddr, _ := net.ResolveUDPAddr("udp", "1.2.3.4:5000")
+		usedAddr, _ := net.ResolveUDPAddr("udp", "5.6.7.8:8888")
+
+		idle, used := &permission{}, &permission{}
+		pm.insert(idleAddr, idle)
+		pm.insert(usedAddr, used)
+		idle.lastUsed.Store(time.Now().Add(-time.Hour).UnixNano())
+
+		pm.deleteIdle(time.Now().Add(-permIdleTimeout))
+		_, ok := pm.find(idleAddr)
+		assert.False(t, ok, "idle permission should no longer be refreshed")
+		_, ok = pm.find(usedAddr)
+		assert.True(t, ok)
+	})
 }
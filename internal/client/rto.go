@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// RTOEstimator computes the retransmission timeout from measured round trip
+// times as described in https://datatracker.ietf.org/doc/html/rfc6298#section-2
+type RTOEstimator struct {
+	minRTO, maxRTO time.Duration // Read-only
+
+	mutex  sync.Mutex
+	rto    time.Duration
+	srtt   time.Duration
+	rttvar time.Duration
+	primed bool
+}
+
+// NewRTOEstimator creates an RTOEstimator that starts with the initial RTO
+// and keeps the RTO between minRTO and maxRTO
+func NewRTOEstimator(initial, minRTO, maxRTO time.Duration) *RTOEstimator {
+	return &RTOEstimator{
+		minRTO: minRTO,
+		maxRTO: maxRTO,
+		rto:    initial,
+	}
+}
+
+// Update feeds a round trip time measurement. Following Karn's algorithm, only
+// transactions answered without a retransmission must be measured
+func (e *RTOEstimator) Update(rtt time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.primed {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.primed = true
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+
+	e.rto = e.srtt + 4*e.rttvar
+	if e.rto < e.minRTO {
+		e.rto = e.minRTO
+	}
+	if e.rto > e.maxRTO {
+		e.rto = e.maxRTO
+	}
+}
+
+// SmoothedRTT returns the smoothed round trip time and its variation, which
+// are zero until the first measurement
+func (e *RTOEstimator) SmoothedRTT() (srtt, rttvar time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.srtt, e.rttvar
+}
+
+// RTO returns the current retransmission timeout
+func (e *RTOEstimator) RTO() time.Duration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.rto
+}
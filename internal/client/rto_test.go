@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTOEstimator(t *testing.T) {
+	e := NewRTOEstimator(500*time.Millisecond, 10*time.Millisecond, 3*time.Second)
+	assert.Equal(t, 500*time.Millisecond, e.RTO())
+	srtt, rttvar := e.SmoothedRTT()
+	assert.Zero(t, srtt)
+	assert.Zero(t, rttvar)
+
+	// First measurement: SRTT = R, RTTVAR = R/2
+	e.Update(20 * time.Millisecond)
+	assert.Equal(t, 60*time.Millisecond, e.RTO())
+	srtt, rttvar = e.SmoothedRTT()
+	assert.Equal(t, 20*time.Millisecond, srtt)
+	assert.Equal(t, 10*time.Millisecond, rttvar)
+
+	// Converges to the round trip time of a stable path
+	for i := 0; i < 100; i++ {
+		e.Update(20 * time.Millisecond)
+	}
+	assert.Equal(t, 20*time.Millisecond, e.RTO().Round(time.Millisecond))
+
+	// Clamped to the bounds
+	for i := 0; i < 100; i++ {
+		e.Update(time.Microsecond)
+	}
+	assert.Equal(t, 10*time.Millisecond, e.RTO())
+
+	e.Update(time.Minute)
+	assert.Equal(t, 3*time.Second, e.RTO())
+}
@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -40,64 +41,42 @@ func NewTCPAllocation(config *AllocationConfig) *TCPAllocation {
 		connAttemptCh: make(chan *connectionAttempt, 10),
 		acceptTimer:   time.NewTimer(time.Duration(math.MaxInt64)),
 		allocation: allocation{
-			client:      config.Client,
-			relayedAddr: config.RelayedAddr,
-			serverAddr:  config.ServerAddr,
-			username:    config.Username,
-			realm:       config.Realm,
-			permMap:     newPermissionMap(),
-			integrity:   config.Integrity,
-			_nonce:      config.Nonce,
-			_lifetime:   config.Lifetime,
-			net:         config.Net,
-			log:         config.Log,
+			client:       config.Client,
+			_relayedAddr: config.RelayedAddr,
+			_serverAddr:  config.ServerAddr,
+			_username:    config.Username,
+			realm:        config.Realm,
+			permMap:      newPermissionMap(),
+			_integrity:   config.Integrity,
+			_nonce:       config.Nonce,
+			_lifetime:    config.Lifetime,
+			_refreshedAt: time.Now(),
+			net:          config.Net,
+			log:          config.Log,
 		},
 	}
 
+	a.applyConfig(config)
 	a.log.Debugf("Initial lifetime: %d seconds", int(a.lifetime().Seconds()))
 
-	a.refreshAllocTimer = NewPeriodicTimer(
-		timerIDRefreshAlloc,
-		a.onRefreshTimers,
-		a.lifetime()/2,
-	)
-
-	a.refreshPermsTimer = NewPeriodicTimer(
-		timerIDRefreshPerms,
-		a.onRefreshTimers,
-		permRefreshInterval,
-	)
-
-	if a.refreshAllocTimer.Start() {
-		a.log.Debug("Started refreshAllocTimer")
-	}
-	if a.refreshPermsTimer.Start() {
-		a.log.Debug("Started refreshPermsTimer")
-	}
+	a.startTimers(a.onRefreshTimers)
 
 	return a
 }
 
 // Connect sends a Connect request to the turn server and returns a chosen connection ID
 func (a *TCPAllocation) Connect(peer net.Addr) (proto.ConnectionID, error) {
-	setters := []stun.Setter{
+	msg, err := stun.Build(a.authenticated(
 		stun.TransactionID,
 		stun.NewType(stun.MethodConnect, stun.ClassRequest),
 		addr2PeerAddress(peer),
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
-		stun.Fingerprint,
-	}
-
-	msg, err := stun.Build(setters...)
+	)...)
 	if err != nil {
 		return 0, err
 	}
 
 	a.log.Debugf("Send connect request (peer=%v)", peer)
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, false)
+	trRes, err := a.client.PerformTransaction(msg, a.serverAddr(), false)
 	if err != nil {
 		return 0, err
 	}
@@ -146,12 +125,12 @@ func (a *TCPAllocation) DialWithConn(conn net.Conn, network, rAddrStr string) (*
 // DialTCP acts like Dial for TCP networks.
 func (a *TCPAllocation) DialTCP(network string, lAddr, rAddr *net.TCPAddr) (*TCPConn, error) {
 	var rAddrServer *net.TCPAddr
-	if addr, ok := a.serverAddr.(*net.TCPAddr); ok {
+	if addr, ok := a.serverAddr().(*net.TCPAddr); ok {
 		rAddrServer = &net.TCPAddr{
 			IP:   addr.IP,
 			Port: addr.Port,
 		}
-	} else if addr, ok := a.serverAddr.(*net.UDPAddr); ok {
+	} else if addr, ok := a.serverAddr().(*net.UDPAddr); ok {
 		rAddrServer = &net.TCPAddr{
 			IP:   addr.IP,
 			Port: addr.Port,
@@ -184,7 +163,7 @@ func (a *TCPAllocation) DialTCPWithConn(conn net.Conn, _ string, rAddr *net.TCPA
 		a.permMap.insert(rAddr, perm)
 	}
 
-	for i := 0; i < maxRetryAttempts; i++ {
+	for i := 0; i < a.maxRetries; i++ {
 		if err = a.createPermission(perm, rAddr); !errors.Is(err, errTryAgain) {
 			break
 		}
@@ -220,16 +199,11 @@ func (a *TCPAllocation) DialTCPWithConn(conn net.Conn, _ string, rAddr *net.TCPA
 
 // BindConnection associates the provided connection
 func (a *TCPAllocation) BindConnection(dataConn *TCPConn, cid proto.ConnectionID) error {
-	msg, err := stun.Build(
+	msg, err := stun.Build(a.authenticated(
 		stun.TransactionID,
 		stun.NewType(stun.MethodConnectionBind, stun.ClassRequest),
 		cid,
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
-		stun.Fingerprint,
-	)
+	)...)
 	if err != nil {
 		return err
 	}
@@ -288,7 +262,7 @@ func (a *TCPAllocation) Accept() (net.Conn, error) {
 
 // AcceptTCP accepts the next incoming call and returns the new connection.
 func (a *TCPAllocation) AcceptTCP() (transport.TCPConn, error) {
-	addr, err := net.ResolveTCPAddr("tcp4", a.serverAddr.String())
+	addr, err := net.ResolveTCPAddr("tcp4", a.serverAddr().String())
 	if err != nil {
 		return nil, err
 	}
@@ -354,16 +328,27 @@ func (a *TCPAllocation) SetDeadline(t time.Time) error {
 // Any blocked Accept operations will be unblocked and return errors.
 // Any opened connection via Dial/Accept will be closed.
 func (a *TCPAllocation) Close() error {
-	a.refreshAllocTimer.Stop()
-	a.refreshPermsTimer.Stop()
+	ctx, cancel := a.closeContext()
+	defer cancel()
+	return a.close(ctx)
+}
+
+// CloseContext closes the allocation, and waits for the server to confirm
+// that it was freed until the context is done
+func (a *TCPAllocation) CloseContext(ctx context.Context) error {
+	return a.close(ctx)
+}
+
+func (a *TCPAllocation) close(ctx context.Context) error {
+	a.stopTimers()
 
-	a.client.OnDeallocated(a.relayedAddr)
-	return a.refreshAllocation(0, true /* dontWait=true */)
+	a.client.OnDeallocated(a.relayedAddr())
+	return a.deallocate(ctx)
 }
 
 // Addr returns the relayed address of the allocation
 func (a *TCPAllocation) Addr() net.Addr {
-	return a.relayedAddr
+	return a.relayedAddr()
 }
 
 // HandleConnectionAttempt is called by the TURN client
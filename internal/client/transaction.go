@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"net"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 
 const (
 	maxRtxInterval time.Duration = 1600 * time.Millisecond
+	rtxMultiplier                = 2
 )
 
 // TransactionResult is a bag of result values of a transaction
@@ -30,6 +32,15 @@ type TransactionConfig struct {
 	To           net.Addr
 	Interval     time.Duration
 	IgnoreResult bool // True to throw away the result of this transaction (it will not be readable using WaitForResult)
+
+	// Optional retransmission schedule. The interval is multiplied by Multiplier
+	// (default 2) after every retransmission, up to MaxInterval (default 1.6s).
+	// If FinalInterval is set, it is waited for after the request number MaxRequests
+	// instead, as Rm * RTO in https://datatracker.ietf.org/doc/html/rfc8489#section-6.2.1
+	Multiplier    float64
+	MaxInterval   time.Duration
+	FinalInterval time.Duration
+	MaxRequests   int
 }
 
 // Transaction represents a transaction
@@ -42,13 +53,29 @@ type Transaction struct {
 	timer    *time.Timer            // Thread-safe, set only by the creator, and stopper
 	resultCh chan TransactionResult // Thread-safe
 	mutex    sync.RWMutex
+
+	multiplier    float64       // Read-only
+	maxInterval   time.Duration // Read-only
+	finalInterval time.Duration // Read-only
+	maxRequests   int           // Read-only
+	createdAt     time.Time     // Read-only
 }
 
 // NewTransaction creates a new instance of Transaction
 func NewTransaction(config *TransactionConfig) *Transaction {
 	var resultCh chan TransactionResult
 	if !config.IgnoreResult {
-		resultCh = make(chan TransactionResult)
+		// Buffered so the result can be written after the waiter gave up
+		resultCh = make(chan TransactionResult, 1)
+	}
+
+	multiplier := config.Multiplier
+	if multiplier == 0 {
+		multiplier = rtxMultiplier
+	}
+	maxInterval := config.MaxInterval
+	if maxInterval == 0 {
+		maxInterval = maxRtxInterval
 	}
 
 	return &Transaction{
@@ -57,6 +84,12 @@ func NewTransaction(config *TransactionConfig) *Transaction {
 		To:       config.To,       // Read-only
 		interval: config.Interval, // Modified only by the timer thread
 		resultCh: resultCh,        // Thread-safe
+
+		multiplier:    multiplier,
+		maxInterval:   maxInterval,
+		finalInterval: config.FinalInterval,
+		maxRequests:   config.MaxRequests,
+		createdAt:     time.Now(),
 	}
 }
 
@@ -69,9 +102,14 @@ func (t *Transaction) StartRtxTimer(onTimeout func(trKey string, nRtx int)) {
 		t.mutex.Lock()
 		t.nRtx++
 		nRtx := t.nRtx
-		t.interval *= 2
-		if t.interval > maxRtxInterval {
-			t.interval = maxRtxInterval
+		if t.finalInterval > 0 && nRtx == t.maxRequests-1 {
+			// The retransmission about to be sent is the last one
+			t.interval = t.finalInterval
+		} else {
+			t.interval = time.Duration(float64(t.interval) * t.multiplier)
+			if t.interval > t.maxInterval {
+				t.interval = t.maxInterval
+			}
 		}
 		t.mutex.Unlock()
 		onTimeout(t.Key, nRtx)
@@ -101,17 +139,26 @@ func (t *Transaction) WriteResult(res TransactionResult) bool {
 
 // WaitForResult waits for the transaction result
 func (t *Transaction) WaitForResult() TransactionResult {
+	return t.WaitForResultContext(context.Background())
+}
+
+// WaitForResultContext waits for the transaction result until the context is done
+func (t *Transaction) WaitForResultContext(ctx context.Context) TransactionResult {
 	if t.resultCh == nil {
 		return TransactionResult{
 			Err: errWaitForResultOnNonResultTransaction,
 		}
 	}
 
-	result, ok := <-t.resultCh
-	if !ok {
-		result.Err = errTransactionClosed
+	select {
+	case result, ok := <-t.resultCh:
+		if !ok {
+			result.Err = errTransactionClosed
+		}
+		return result
+	case <-ctx.Done():
+		return TransactionResult{Err: ctx.Err()}
 	}
-	return result
 }
 
 // Close closes the transaction
@@ -121,6 +168,11 @@ func (t *Transaction) Close() {
 	}
 }
 
+// Elapsed returns the time since the transaction was created
+func (t *Transaction) Elapsed() time.Duration {
+	return time.Since(t.createdAt)
+}
+
 // Retries returns the number of retransmission it has made
 func (t *Transaction) Retries() int {
 	t.mutex.RLock()
@@ -5,14 +5,20 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
 )
 
@@ -20,13 +26,32 @@ const (
 	maxReadQueueSize    = 1024
 	permRefreshInterval = 120 * time.Second
 	maxRetryAttempts    = 3
+
+	// Permissions expire after 5 minutes on the server, channel bindings
+	// after 10. Only those still in use are refreshed by UDPConn.
+	permIdleTimeout        = 5 * time.Minute
+	bindingRefreshInterval = 5 * time.Minute
+	permLifetime           = 5 * time.Minute
+	bindingLifetime        = 10 * time.Minute
 )
 
 const (
 	timerIDRefreshAlloc int = iota
 	timerIDRefreshPerms
+	timerIDKeepalive
 )
 
+// channelDataHeaders are reused headers of ChannelData messages sent
+// with vectored writes
+var channelDataHeaders = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any {
+		return new([proto.ChannelDataHeaderSize]byte)
+	},
+}
+
+// channelDataPadding pads vectored ChannelData messages
+var channelDataPadding = make([]byte, 3) //nolint:gochecknoglobals
+
 type inboundData struct {
 	data []byte
 	from net.Addr
@@ -39,50 +64,46 @@ type UDPConn struct {
 	readCh     chan *inboundData // Thread-safe
 	closeCh    chan struct{}     // Thread-safe
 	allocation
+
+	dropped     atomic.Uint64 // Thread-safe
+	overflows   atomic.Uint64 // Thread-safe
+	overflowing atomic.Bool   // Thread-safe
+
+	writeMutex sync.RWMutex // Thread-safe, held shared by writes in flight
 }
 
 // NewUDPConn creates a new instance of UDPConn
 func NewUDPConn(config *AllocationConfig) *UDPConn {
+	readQueueSize := maxReadQueueSize
+	if config.ReadQueueSize > 0 {
+		readQueueSize = config.ReadQueueSize
+	}
+
 	c := &UDPConn{
 		bindingMgr: newBindingManager(),
-		readCh:     make(chan *inboundData, maxReadQueueSize),
+		readCh:     make(chan *inboundData, readQueueSize),
 		closeCh:    make(chan struct{}),
 		allocation: allocation{
-			client:      config.Client,
-			relayedAddr: config.RelayedAddr,
-			serverAddr:  config.ServerAddr,
-			readTimer:   time.NewTimer(time.Duration(math.MaxInt64)),
-			permMap:     newPermissionMap(),
-			username:    config.Username,
-			realm:       config.Realm,
-			integrity:   config.Integrity,
-			_nonce:      config.Nonce,
-			_lifetime:   config.Lifetime,
-			net:         config.Net,
-			log:         config.Log,
+			client:       config.Client,
+			_relayedAddr: config.RelayedAddr,
+			_serverAddr:  config.ServerAddr,
+			readTimer:    time.NewTimer(time.Duration(math.MaxInt64)),
+			permMap:      newPermissionMap(),
+			_username:    config.Username,
+			realm:        config.Realm,
+			_integrity:   config.Integrity,
+			_nonce:       config.Nonce,
+			_lifetime:    config.Lifetime,
+			_refreshedAt: time.Now(),
+			net:          config.Net,
+			log:          config.Log,
 		},
 	}
 
+	c.applyConfig(config)
 	c.log.Debugf("Initial lifetime: %d seconds", int(c.lifetime().Seconds()))
 
-	c.refreshAllocTimer = NewPeriodicTimer(
-		timerIDRefreshAlloc,
-		c.onRefreshTimers,
-		c.lifetime()/2,
-	)
-
-	c.refreshPermsTimer = NewPeriodicTimer(
-		timerIDRefreshPerms,
-		c.onRefreshTimers,
-		permRefreshInterval,
-	)
-
-	if c.refreshAllocTimer.Start() {
-		c.log.Debugf("Started refresh allocation timer")
-	}
-	if c.refreshPermsTimer.Start() {
-		c.log.Debugf("Started refresh permission timer")
-	}
+	c.startTimers(c.onUDPRefreshTimers)
 
 	return c
 }
@@ -134,6 +155,9 @@ func (a *allocation) createPermission(perm *permission, addr net.Addr) error {
 		// Punch a hole! (this would block a bit..)
 		if err := a.CreatePermissions(addr); err != nil {
 			a.permMap.delete(addr)
+			if !errors.Is(err, errTryAgain) {
+				a.permissionFailed(addr, err)
+			}
 			return err
 		}
 		perm.setState(permStatePermitted)
@@ -146,7 +170,33 @@ func (a *allocation) createPermission(perm *permission, addr net.Addr) error {
 // an Error with Timeout() == true after a fixed time limit;
 // see SetDeadline and SetWriteDeadline.
 // On packet-oriented connections, write timeouts are rare.
-func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) { //nolint: gocognit
+func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.writeTo(net.Buffers{p}, addr)
+}
+
+// WriteToBuffers writes a packet gathered from bufs to addr, like WriteTo does
+// with their concatenation. Once a channel to addr is bound, the ChannelData
+// header is written in front of bufs without copying them, if the client
+// supports vectored writes.
+func (c *UDPConn) WriteToBuffers(bufs net.Buffers, addr net.Addr) (int, error) {
+	return c.writeTo(bufs, addr)
+}
+
+func (c *UDPConn) writeTo(bufs net.Buffers, addr net.Addr) (int, error) { //nolint: gocognit
+	c.writeMutex.RLock()
+	defer c.writeMutex.RUnlock()
+
+	select {
+	case <-c.closeCh:
+		return 0, &net.OpError{
+			Op:   "write",
+			Net:  c.LocalAddr().Network(),
+			Addr: c.LocalAddr(),
+			Err:  errClosed,
+		}
+	default:
+	}
+
 	var err error
 	_, ok := addr.(*net.UDPAddr)
 	if !ok {
@@ -159,8 +209,9 @@ func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) { //nolint: goco
 		perm = &permission{}
 		c.permMap.insert(addr, perm)
 	}
+	perm.touch()
 
-	for i := 0; i < maxRetryAttempts; i++ {
+	for i := 0; i < c.maxRetries; i++ {
 		// c.createPermission() would block, per destination IP (, or perm),
 		// until the perm state becomes "requested". Purpose of this is to
 		// guarantee the order of packets (within the same perm).
@@ -180,7 +231,9 @@ func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) { //nolint: goco
 	b, ok := c.bindingMgr.findByAddr(addr)
 	if !ok {
 		b = c.bindingMgr.create(addr)
+		c.channelsChanged()
 	}
+	b.touch()
 
 	bindSt := b.state()
 
@@ -208,6 +261,7 @@ func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) { //nolint: goco
 		}()
 
 		// Send data using SendIndication
+		p := joinBuffers(bufs)
 		peerAddr := addr2PeerAddress(addr)
 		var msg *stun.Message
 		msg, err = stun.Build(
@@ -223,45 +277,115 @@ func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) { //nolint: goco
 
 		// Indication has no transaction (fire-and-forget)
 
-		return c.client.WriteTo(msg.Raw, c.serverAddr)
+		if _, err = c.client.WriteTo(msg.Raw, c.serverAddr()); err != nil {
+			return 0, err
+		}
+		c.sent(len(p))
+		return len(p), nil
 	}
 
 	// Binding is either ready
 
 	// Check if the binding needs a refresh
-	func() {
-		b.muBind.Lock()
-		defer b.muBind.Unlock()
-
-		if b.state() == bindingStateReady && time.Since(b.refreshedAt()) > 5*time.Minute {
-			b.setState(bindingStateRefresh)
-			go func() {
-				err = c.bind(b)
-				if err != nil {
-					c.log.Warnf("Failed to bind() for refresh: %s", err)
-					b.setState(bindingStateFailed)
-					// Keep going...
-				} else {
-					b.setRefreshedAt(time.Now())
-					b.setState(bindingStateReady)
-				}
-			}()
-		}
-	}()
+	c.refreshBinding(b)
 
 	// Send via ChannelData
-	_, err = c.sendChannelData(p, b.number)
+	n, err := c.sendChannelData(bufs, b.number)
 	if err != nil {
 		return 0, err
 	}
-	return len(p), nil
+	c.sent(n)
+	return n, nil
+}
+
+// joinBuffers returns the concatenation of bufs, without copying a single buffer
+func joinBuffers(bufs net.Buffers) []byte {
+	if len(bufs) == 1 {
+		return bufs[0]
+	}
+
+	var n int
+	for _, b := range bufs {
+		n += len(b)
+	}
+	joined := make([]byte, 0, n)
+	for _, b := range bufs {
+		joined = append(joined, b...)
+	}
+	return joined
+}
+
+func (c *UDPConn) sent(n int) {
+	if c.onSent != nil {
+		c.onSent(n)
+	}
+}
+
+func (c *UDPConn) channelsChanged() {
+	if c.onChannels != nil {
+		c.onChannels(c.bindingMgr.size())
+	}
+}
+
+// refreshBinding re-binds the channel in the background if it is ready and
+// was not refreshed for bindingRefreshInterval
+func (c *UDPConn) refreshBinding(b *binding) {
+	b.muBind.Lock()
+	defer b.muBind.Unlock()
+
+	if b.state() != bindingStateReady || time.Since(b.refreshedAt()) <= bindingRefreshInterval {
+		return
+	}
+
+	b.setState(bindingStateRefresh)
+	go func() {
+		if err := c.bind(b); err != nil {
+			c.log.Warnf("Failed to bind() for refresh: %s", err)
+			b.setState(bindingStateFailed)
+			// Keep going...
+		} else {
+			b.setRefreshedAt(time.Now())
+			b.setState(bindingStateReady)
+		}
+	}()
+}
+
+// onUDPRefreshTimers stops refreshing permissions of peers that are no longer
+// in use and refreshes channel bindings that are, so they don't expire while
+// the application only receives on them.
+func (c *UDPConn) onUDPRefreshTimers(id int) {
+	if id == timerIDRefreshPerms {
+		c.permMap.deleteIdle(time.Now().Add(-permIdleTimeout))
+	}
+
+	c.onRefreshTimers(id)
+
+	if id == timerIDRefreshPerms {
+		for _, b := range c.bindingMgr.bindings() {
+			if b.usedSinceRefresh() {
+				c.refreshBinding(b)
+			}
+		}
+	}
 }
 
 // Close closes the connection.
 // Any blocked ReadFrom or WriteTo operations will be unblocked and return errors.
 func (c *UDPConn) Close() error {
-	c.refreshAllocTimer.Stop()
-	c.refreshPermsTimer.Stop()
+	ctx, cancel := c.closeContext()
+	defer cancel()
+	return c.close(ctx)
+}
+
+// CloseContext closes the connection gracefully: until the context is done, it
+// waits for writes in flight to complete, then frees the allocation and waits
+// for the server to confirm.
+func (c *UDPConn) CloseContext(ctx context.Context) error {
+	return c.close(ctx)
+}
+
+func (c *UDPConn) close(ctx context.Context) error {
+	c.stopTimers()
 
 	select {
 	case <-c.closeCh:
@@ -270,13 +394,36 @@ func (c *UDPConn) Close() error {
 		close(c.closeCh)
 	}
 
-	c.client.OnDeallocated(c.relayedAddr)
-	return c.refreshAllocation(0, true /* dontWait=true */)
+	if ctx != nil {
+		c.flush(ctx)
+	}
+
+	c.client.OnDeallocated(c.relayedAddr())
+	if c.onChannels != nil {
+		c.onChannels(0)
+	}
+	return c.deallocate(ctx)
+}
+
+// flush waits for writes in flight to complete, until the context is done
+func (c *UDPConn) flush(ctx context.Context) {
+	flushed := make(chan struct{})
+	go func() {
+		c.writeMutex.Lock()
+		close(flushed)
+		c.writeMutex.Unlock()
+	}()
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		c.log.Warnf("Closing %s with writes in flight", c.relayedAddr())
+	}
 }
 
 // LocalAddr returns the local network address.
 func (c *UDPConn) LocalAddr() net.Addr {
-	return c.relayedAddr
+	return c.relayedAddr()
 }
 
 // SetDeadline sets the read and write deadlines associated
@@ -339,6 +486,11 @@ func addr2PeerAddress(addr net.Addr) proto.PeerAddress {
 // CreatePermissions Issues a CreatePermission request for the supplied addresses
 // as described in https://datatracker.ietf.org/doc/html/rfc5766#section-9
 func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
+	return a.CreatePermissionsContext(context.Background(), addrs...)
+}
+
+// CreatePermissionsContext is CreatePermissions, giving up once the context is done
+func (a *allocation) CreatePermissionsContext(ctx context.Context, addrs ...net.Addr) error {
 	setters := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodCreatePermission, stun.ClassRequest),
@@ -348,19 +500,12 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 		setters = append(setters, addr2PeerAddress(addr))
 	}
 
-	setters = append(setters,
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
-		stun.Fingerprint)
-
-	msg, err := stun.Build(setters...)
+	msg, err := stun.Build(a.authenticated(setters...)...)
 	if err != nil {
 		return err
 	}
 
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, false)
+	trRes, err := a.client.PerformTransactionContext(ctx, msg, a.serverAddr(), false)
 	if err != nil {
 		return err
 	}
@@ -370,8 +515,8 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 	if res.Type.Class == stun.ClassErrorResponse {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
-			if code.Code == stun.CodeStaleNonce {
-				a.setNonceFromMsg(res)
+			if (code.Code == stun.CodeStaleNonce || code.Code == stun.CodeUnauthorized) &&
+				a.reauthenticate(res, code.Code) {
 				return errTryAgain
 			}
 			return fmt.Errorf("%s (error %s)", res.Type, code) //nolint:goerr113
@@ -379,22 +524,124 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 		return fmt.Errorf("%s", res.Type) //nolint:goerr113
 	}
 
+	now := time.Now()
+	for _, addr := range addrs {
+		if perm, ok := a.permMap.find(addr); ok {
+			perm.setRefreshedAt(now)
+		}
+	}
+	return nil
+}
+
+// Permit creates the permissions for all addresses in a single CreatePermission
+// transaction, and records them so that writing to the peers needs no further
+// round trip. Addresses with the same IP share a permission
+func (a *allocation) Permit(ctx context.Context, addrs ...net.Addr) error {
+	unique := make([]net.Addr, 0, len(addrs))
+	seen := map[netip.Addr]bool{}
+	for _, addr := range addrs {
+		if fingerprint := ipnet.FingerprintAddr(addr); !seen[fingerprint] {
+			seen[fingerprint] = true
+			unique = append(unique, addr)
+		}
+	}
+
+	var err error
+	for i := 0; i < a.maxRetries; i++ {
+		if err = a.CreatePermissionsContext(ctx, unique...); !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+	if err != nil {
+		for _, addr := range unique {
+			a.permissionFailed(addr, err)
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, addr := range unique {
+		perm, ok := a.permMap.find(addr)
+		if !ok {
+			perm = &permission{}
+			a.permMap.insert(addr, perm)
+		}
+		perm.setRefreshedAt(now)
+		perm.setState(permStatePermitted)
+	}
 	return nil
 }
 
 // HandleInbound passes inbound data in UDPConn
 func (c *UDPConn) HandleInbound(data []byte, from net.Addr) {
+	if perm, ok := c.permMap.find(from); ok {
+		perm.touch()
+	}
+	if b, ok := c.bindingMgr.findByAddr(from); ok {
+		b.touch()
+	}
+	if c.onReceived != nil {
+		c.onReceived(len(data))
+	}
+
+	if c.onData != nil && c.onData(from, data) {
+		return
+	}
+
 	// Copy data
 	copied := make([]byte, len(data))
 	copy(copied, data)
 
 	select {
 	case c.readCh <- &inboundData{data: copied, from: from}:
+		c.overflowing.Store(false)
 	default:
-		c.log.Warnf("Receive buffer full")
+		c.dropped.Add(1)
+		// Only warn once until the application catches up
+		if c.overflowing.CompareAndSwap(false, true) {
+			c.overflows.Add(1)
+			c.log.Warnf("Receive buffer full, dropping packets")
+		}
 	}
 }
 
+// ReceiveStats returns the number of packets queued for ReadFrom and the queue
+// capacity, how many packets were dropped because the queue was full, and how
+// often it ran over
+func (c *UDPConn) ReceiveStats() (queued, capacity int, dropped, overflows uint64) {
+	return len(c.readCh), cap(c.readCh), c.dropped.Load(), c.overflows.Load()
+}
+
+// ChannelInfo describes a channel binding of a UDPConn
+type ChannelInfo struct {
+	Number    uint16
+	Peer      net.Addr
+	Bound     bool      // The server confirmed the binding
+	ExpiresAt time.Time // When the server drops the binding unless it is refreshed
+}
+
+// Channels returns the channel bindings of the UDPConn, ordered by number
+func (c *UDPConn) Channels() []ChannelInfo {
+	bindings := c.bindingMgr.bindings()
+	channels := make([]ChannelInfo, 0, len(bindings))
+	for _, b := range bindings {
+		st := b.state()
+		info := ChannelInfo{
+			Number: b.number,
+			Peer:   b.addr,
+			Bound:  st == bindingStateReady || st == bindingStateRefresh,
+		}
+		if info.Bound {
+			info.ExpiresAt = b.refreshedAt().Add(bindingLifetime)
+		}
+		channels = append(channels, info)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Number < channels[j].Number
+	})
+	return channels
+}
+
 // FindAddrByChannelNumber returns a peer address associated with the
 // channel number on this UDPConn
 func (c *UDPConn) FindAddrByChannelNumber(chNum uint16) (net.Addr, bool) {
@@ -405,33 +652,126 @@ func (c *UDPConn) FindAddrByChannelNumber(chNum uint16) (net.Addr, bool) {
 	return b.addr, true
 }
 
+// Reallocate moves the UDPConn to a new allocation, possibly on another
+// server, after the previous one was lost, and re-creates its permissions and
+// channel bindings there. Peers whose permission or binding fails are set up
+// again by the next WriteTo.
+func (c *UDPConn) Reallocate(serverAddr, relayedAddr net.Addr, nonce stun.Nonce, lifetime time.Duration) {
+	c.setServerAddr(serverAddr)
+	c.setRelayedAddr(relayedAddr)
+	c.setNonce(nonce)
+	c.setLifetime(lifetime)
+	c.setRefreshedAt(time.Now())
+
+	perms := c.permMap.permissions()
+	for _, perm := range perms {
+		perm.setState(permStateIdle)
+	}
+	if len(perms) > 0 {
+		var err error
+		for i := 0; i < c.maxRetries; i++ {
+			if err = c.refreshPermissions(); !errors.Is(err, errTryAgain) {
+				break
+			}
+		}
+		if err == nil {
+			for _, perm := range perms {
+				perm.setState(permStatePermitted)
+			}
+		}
+	}
+
+	for _, b := range c.bindingMgr.bindings() {
+		b.muBind.Lock()
+		if err := c.bind(b); err != nil {
+			c.log.Warnf("Failed to re-bind channel %d after reallocation: %s", b.number, err)
+			b.setState(bindingStateIdle)
+		} else {
+			b.setRefreshedAt(time.Now())
+			b.setState(bindingStateReady)
+		}
+		b.muBind.Unlock()
+	}
+}
+
+// BindChannelContext binds a channel to the peer and waits for the server to
+// confirm, instead of binding in the background on the first WriteTo
+func (c *UDPConn) BindChannelContext(ctx context.Context, addr net.Addr) error {
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		return errUDPAddrCast
+	}
+
+	b, ok := c.bindingMgr.findByAddr(addr)
+	if !ok {
+		b = c.bindingMgr.create(addr)
+		c.channelsChanged()
+	}
+
+	b.muBind.Lock()
+	defer b.muBind.Unlock()
+
+	if b.state() == bindingStateReady {
+		return nil
+	}
+
+	b.setState(bindingStateRequest)
+	if err := c.bindContext(ctx, b); err != nil {
+		b.setState(bindingStateFailed)
+		return err
+	}
+	b.setRefreshedAt(time.Now())
+	b.setState(bindingStateReady)
+
+	// The ChannelBind installed the permission as well
+	if _, ok := c.permMap.find(addr); !ok {
+		perm := &permission{}
+		perm.setRefreshedAt(time.Now())
+		perm.setState(permStatePermitted)
+		c.permMap.insert(addr, perm)
+	}
+	return nil
+}
+
 func (c *UDPConn) bind(b *binding) error {
-	setters := []stun.Setter{
+	return c.bindContext(context.Background(), b)
+}
+
+func (c *UDPConn) bindContext(ctx context.Context, b *binding) error {
+	for i := 1; ; i++ {
+		if err := c.bindOnce(ctx, b); !errors.Is(err, errTryAgain) || i >= c.maxRetries {
+			return err
+		}
+	}
+}
+
+func (c *UDPConn) bindOnce(ctx context.Context, b *binding) error {
+	msg, err := stun.Build(c.authenticated(
 		stun.TransactionID,
 		stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
 		addr2PeerAddress(b.addr),
 		proto.ChannelNumber(b.number),
-		c.username,
-		c.realm,
-		c.nonce(),
-		c.integrity,
-		stun.Fingerprint,
-	}
-
-	msg, err := stun.Build(setters...)
+	)...)
 	if err != nil {
 		return err
 	}
 
-	trRes, err := c.client.PerformTransaction(msg, c.serverAddr, false)
+	trRes, err := c.client.PerformTransactionContext(ctx, msg, c.serverAddr(), false)
 	if err != nil {
-		c.bindingMgr.deleteByAddr(b.addr)
+		if c.bindingMgr.deleteByAddr(b.addr) {
+			c.channelsChanged()
+		}
 		return err
 	}
 
 	res := trRes.Msg
 
 	if res.Type != stun.NewType(stun.MethodChannelBind, stun.ClassSuccessResponse) {
+		var code stun.ErrorCodeAttribute
+		if res.Type.Class == stun.ClassErrorResponse && code.GetFrom(res) == nil &&
+			(code.Code == stun.CodeStaleNonce || code.Code == stun.CodeUnauthorized) &&
+			c.reauthenticate(res, code.Code) {
+			return errTryAgain
+		}
 		return fmt.Errorf("unexpected response type %s", res.Type) //nolint:goerr113
 	}
 
@@ -441,15 +781,39 @@ func (c *UDPConn) bind(b *binding) error {
 	return nil
 }
 
-func (c *UDPConn) sendChannelData(data []byte, chNum uint16) (int, error) {
-	chData := &proto.ChannelData{
-		Data:   data,
-		Number: proto.ChannelNumber(chNum),
+func (c *UDPConn) sendChannelData(bufs net.Buffers, chNum uint16) (int, error) {
+	bw, ok := c.client.(BuffersWriter)
+	if !ok {
+		data := joinBuffers(bufs)
+		chData := &proto.ChannelData{
+			Data:   data,
+			Number: proto.ChannelNumber(chNum),
+		}
+		chData.Encode()
+		if _, err := c.client.WriteTo(chData.Raw, c.serverAddr()); err != nil {
+			return 0, err
+		}
+		return len(data), nil
 	}
-	chData.Encode()
-	_, err := c.client.WriteTo(chData.Raw, c.serverAddr)
-	if err != nil {
+
+	var n int
+	for _, b := range bufs {
+		n += len(b)
+	}
+
+	header, _ := channelDataHeaders.Get().(*[proto.ChannelDataHeaderSize]byte)
+	defer channelDataHeaders.Put(header)
+	proto.EncodeChannelDataHeader(header[:], proto.ChannelNumber(chNum), n)
+
+	// The writer consumes the slice, but not the buffers
+	msg := make(net.Buffers, 0, len(bufs)+2)
+	msg = append(msg, header[:])
+	msg = append(msg, bufs...)
+	if padding := proto.ChannelDataPadding(n); padding > 0 {
+		msg = append(msg, channelDataPadding[:padding])
+	}
+	if _, err := bw.WriteBuffersTo(msg, c.serverAddr()); err != nil {
 		return 0, err
 	}
-	return len(data), nil
+	return n, nil
 }
@@ -4,10 +4,16 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,6 +44,39 @@ func TestUDPConn(t *testing.T) {
 		assert.Equal(t, 0, len(bm.addrMap), "should be 0")
 	})
 
+	t.Run("bind() with a stale nonce", func(t *testing.T) {
+		var nonces []string
+		client := &mockClient{
+			performTransaction: func(msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				var nonce stun.Nonce
+				_ = nonce.GetFrom(msg)
+				nonces = append(nonces, nonce.String())
+				if len(nonces) == 1 {
+					res, err := stun.Build(msg, stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse),
+						&stun.ErrorCodeAttribute{Code: stun.CodeStaleNonce}, stun.NewNonce("fresh"))
+					return TransactionResult{Msg: res}, err
+				}
+				res, err := stun.Build(msg, stun.NewType(stun.MethodChannelBind, stun.ClassSuccessResponse))
+				return TransactionResult{Msg: res}, err
+			},
+		}
+
+		bm := newBindingManager()
+		b := bm.create(&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+		conn := UDPConn{
+			allocation: allocation{
+				client:     client,
+				log:        logging.NewDefaultLoggerFactory().NewLogger("test"),
+				_nonce:     stun.NewNonce("stale"),
+				maxRetries: maxRetryAttempts,
+			},
+			bindingMgr: bm,
+		}
+
+		assert.NoError(t, conn.bind(b))
+		assert.Equal(t, []string{"stale", "fresh"}, nonces)
+	})
+
 	t.Run("WriteTo()", func(t *testing.T) {
 		client := &mockClient{
 			performTransaction: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
@@ -75,4 +114,294 @@ func TestUDPConn(t *testing.T) {
 		assert.NoError(t, err, "should fail")
 		assert.Equal(t, len(buf), n)
 	})
+
+	t.Run("OnExpiring", func(t *testing.T) {
+		client := &mockClient{
+			performTransaction: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
+				return TransactionResult{}, errFake // Refreshes fail
+			},
+		}
+
+		relayedAddr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+		expiring := make(chan time.Duration, 1)
+		conn := NewUDPConn(&AllocationConfig{
+			Client:      client,
+			RelayedAddr: relayedAddr,
+			Lifetime:    400 * time.Millisecond,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+			OnExpiring: func(addr net.Addr, remaining time.Duration) {
+				assert.Equal(t, relayedAddr, addr)
+				expiring <- remaining
+			},
+		})
+		assert.Greater(t, time.Until(conn.ExpiresAt()), 300*time.Millisecond)
+
+		select {
+		case remaining := <-expiring:
+			assert.LessOrEqual(t, remaining, 100*time.Millisecond)
+			assert.Greater(t, remaining, time.Duration(0))
+		case <-time.After(time.Second):
+			assert.Fail(t, "no expiry warning")
+		}
+
+		assert.Error(t, conn.Close())
+	})
+
+	t.Run("CredentialsProvider", func(t *testing.T) {
+		var usernames []string
+		client := &mockClient{
+			performTransaction: func(msg *stun.Message, _ net.Addr, dontWait bool) (TransactionResult, error) {
+				if dontWait {
+					return TransactionResult{}, nil
+				}
+				var username stun.Username
+				assert.NoError(t, username.GetFrom(msg))
+				usernames = append(usernames, username.String())
+
+				if len(usernames) == 1 {
+					// The credentials expired
+					res, err := stun.Build(
+						stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse),
+						stun.CodeUnauthorized,
+						stun.NewNonce("nonce2"),
+						stun.NewRealm("pion.ly"),
+					)
+					return TransactionResult{Msg: res}, err
+				}
+
+				integrity := stun.NewLongTermIntegrity("rotated", "pion.ly", "pass2")
+				assert.NoError(t, integrity.Check(msg))
+				var nonce stun.Nonce
+				assert.NoError(t, nonce.GetFrom(msg))
+				assert.Equal(t, "nonce2", nonce.String())
+
+				res, err := stun.Build(stun.NewType(stun.MethodCreatePermission, stun.ClassSuccessResponse))
+				return TransactionResult{Msg: res}, err
+			},
+		}
+
+		conn := NewUDPConn(&AllocationConfig{
+			Client:      client,
+			RelayedAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+			Username:    stun.NewUsername("expired"),
+			Realm:       stun.NewRealm("pion.ly"),
+			Integrity:   stun.NewLongTermIntegrity("expired", "pion.ly", "pass1"),
+			Nonce:       stun.NewNonce("nonce1"),
+			Lifetime:    time.Minute,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+			CredentialsProvider: func(realm string) (string, string) {
+				assert.Equal(t, "pion.ly", realm)
+				return "rotated", "pass2"
+			},
+		})
+
+		peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+		assert.NoError(t, conn.Permit(context.Background(), peer))
+		assert.Equal(t, []string{"expired", "rotated"}, usernames)
+
+		assert.NoError(t, conn.Close())
+	})
+
+	t.Run("ReadQueueSize", func(t *testing.T) {
+		client := &mockClient{
+			performTransaction: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
+				return TransactionResult{}, nil
+			},
+		}
+
+		conn := NewUDPConn(&AllocationConfig{
+			Client:        client,
+			RelayedAddr:   &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+			Lifetime:      time.Minute,
+			Log:           logging.NewDefaultLoggerFactory().NewLogger("test"),
+			ReadQueueSize: 2,
+		})
+
+		peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+		for i := 0; i < 5; i++ {
+			conn.HandleInbound([]byte("data"), peer)
+		}
+		queued, capacity, dropped, overflows := conn.ReceiveStats()
+		assert.Equal(t, 2, queued)
+		assert.Equal(t, 2, capacity)
+		assert.Equal(t, uint64(3), dropped)
+		assert.Equal(t, uint64(1), overflows)
+
+		// Reading makes room, the next overflow is counted again
+		buf := make([]byte, 16)
+		_, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		conn.HandleInbound([]byte("data"), peer)
+		conn.HandleInbound([]byte("data"), peer)
+		queued, _, dropped, overflows = conn.ReceiveStats()
+		assert.Equal(t, 2, queued)
+		assert.Equal(t, uint64(4), dropped)
+		assert.Equal(t, uint64(2), overflows)
+
+		assert.NoError(t, conn.Close())
+	})
+	t.Run("WriteToBuffers()", func(t *testing.T) {
+		addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+		bufs := net.Buffers{[]byte("Hel"), []byte("lo")}
+		expected := &proto.ChannelData{Data: []byte("Hello"), Number: proto.MinChannelNumber}
+		expected.Encode()
+
+		var written []byte
+		mock := &mockClient{
+			writeTo: func(data []byte, _ net.Addr) (int, error) {
+				written = append([]byte{}, data...)
+				return len(data), nil
+			},
+		}
+		var gathered net.Buffers
+		vectored := &buffersClient{
+			mockClient: mock,
+			writeBuffersTo: func(bufs net.Buffers, _ net.Addr) (int, error) {
+				gathered = append(net.Buffers{}, bufs...)
+				return len(bytes.Join(bufs, nil)), nil
+			},
+		}
+
+		for _, client := range []Client{mock, vectored} {
+			pm := newPermissionMap()
+			assert.True(t, pm.insert(addr, &permission{st: permStatePermitted}))
+			bm := newBindingManager()
+			bm.create(addr).setState(bindingStateReady)
+
+			conn := UDPConn{
+				allocation: allocation{
+					client:  client,
+					permMap: pm,
+				},
+				bindingMgr: bm,
+			}
+			n, err := conn.WriteToBuffers(bufs, addr)
+			assert.NoError(t, err)
+			assert.Equal(t, 5, n)
+		}
+
+		// Both write the same ChannelData, the vectored one without copying the payload
+		assert.Equal(t, expected.Raw, written)
+		assert.Equal(t, expected.Raw, bytes.Join(gathered, nil))
+		assert.Len(t, gathered, 4)
+		assert.Same(t, &bufs[0][0], &gathered[1][0])
+	})
+}
+
+func TestUDPConnIntrospection(t *testing.T) {
+	client := &mockClient{
+		performTransaction: func(msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			res, err := stun.Build(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse))
+			return TransactionResult{Msg: res}, err
+		},
+	}
+	conn := NewUDPConn(&AllocationConfig{
+		Client:      client,
+		RelayedAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+		Lifetime:    time.Minute,
+		Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+	})
+
+	peer1 := &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: 1234}
+	peer2 := &net.UDPAddr{IP: net.ParseIP("127.0.0.3"), Port: 1234}
+	now := time.Now()
+	assert.NoError(t, conn.Permit(context.Background(), peer2, peer1))
+	assert.NoError(t, conn.BindChannelContext(context.Background(), peer1))
+
+	perms := conn.Permissions()
+	assert.Len(t, perms, 2)
+	for i, peer := range []net.Addr{peer1, peer2} {
+		assert.Equal(t, peer, perms[i].Peer)
+		assert.True(t, perms[i].Permitted)
+		assert.WithinDuration(t, now.Add(permLifetime), perms[i].ExpiresAt, time.Second)
+	}
+
+	channels := conn.Channels()
+	assert.Len(t, channels, 1)
+	assert.Equal(t, minChannelNumber, channels[0].Number)
+	assert.Equal(t, peer1.String(), channels[0].Peer.String())
+	assert.True(t, channels[0].Bound)
+	assert.WithinDuration(t, now.Add(bindingLifetime), channels[0].ExpiresAt, time.Second)
+
+	assert.NoError(t, conn.Close())
+}
+
+func TestUDPConnCloseContext(t *testing.T) {
+	var events []string
+	var mutex sync.Mutex
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+
+	permitting := make(chan struct{})
+	permit := make(chan struct{})
+	client := &mockClient{
+		performTransaction: func(msg *stun.Message, _ net.Addr, dontWait bool) (TransactionResult, error) {
+			assert.False(t, dontWait)
+			if msg.Type.Method != stun.MethodChannelBind { // Bound in the background
+				record(msg.Type.Method.String())
+			}
+			switch msg.Type.Method {
+			case stun.MethodCreatePermission:
+				close(permitting)
+				<-permit
+			case stun.MethodRefresh:
+				var lifetime proto.Lifetime
+				assert.NoError(t, lifetime.GetFrom(msg))
+				assert.Zero(t, lifetime.Duration)
+			}
+			res, err := stun.Build(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse), proto.Lifetime{})
+			return TransactionResult{Msg: res}, err
+		},
+		writeTo: func(data []byte, _ net.Addr) (int, error) {
+			record("write")
+			return len(data), nil
+		},
+	}
+
+	conn := NewUDPConn(&AllocationConfig{
+		Client:       client,
+		RelayedAddr:  &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+		Lifetime:     time.Minute,
+		Log:          logging.NewDefaultLoggerFactory().NewLogger("test"),
+		CloseTimeout: time.Second,
+	})
+
+	peer := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.WriteTo([]byte("data"), peer)
+		written <- err
+	}()
+	<-permitting
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- conn.Close()
+	}()
+
+	// Close waits for the write in flight before deallocating
+	time.Sleep(50 * time.Millisecond)
+	close(permit)
+	assert.NoError(t, <-written)
+	assert.NoError(t, <-closed)
+
+	mutex.Lock()
+	assert.Equal(t, []string{"CreatePermission", "write", "Refresh"}, events)
+	mutex.Unlock()
+
+	// Writes after Close fail
+	_, err := conn.WriteTo([]byte("data"), peer)
+	assert.ErrorIs(t, err, errClosed)
+}
+
+type buffersClient struct {
+	*mockClient
+	writeBuffersTo func(bufs net.Buffers, to net.Addr) (int, error)
+}
+
+func (c *buffersClient) WriteBuffersTo(bufs net.Buffers, to net.Addr) (int, error) {
+	return c.writeBuffersTo(bufs, to)
 }
@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package epoll
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pion/transport/v3/deadline"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/ipnet"
+	"golang.org/x/sys/unix"
+)
+
+const defaultQueueSize = 256
+
+var errNotUDP = errors.New("address is not a UDP address")
+
+type datagram struct {
+	data *[]byte
+	from netip.AddrPort
+}
+
+// Conn is a net.PacketConn whose UDP socket is read by a Loop instead of the
+// Go runtime. Datagrams are received ahead into a queue, the datagrams that
+// arrive while it is full are dropped.
+type Conn struct {
+	loop *Loop
+	conn *net.UDPConn
+	fd   int
+	ipv4 bool // Family of the socket
+	pool *bufpool.Pool
+
+	lock   sync.Mutex // Held by the loop while it drains the socket, guards closed and the handlers
+	closed bool
+
+	handler func(p []byte, from netip.AddrPort)
+	failed  func()
+
+	datagrams    chan datagram
+	closeCh      chan struct{}
+	closeOnce    sync.Once
+	readDeadline *deadline.Deadline
+
+	addrs sync.Pool
+}
+
+// NewConn reads conn from the loop from now on, and closes it with the Conn.
+// Datagrams larger than the buffer of the loop are dropped.
+func NewConn(loop *Loop, conn *net.UDPConn) (*Conn, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	// The descriptor stays valid until conn is closed, after it is removed from the loop
+	fd, domain := -1, 0
+	if err := raw.Control(func(s uintptr) {
+		fd = int(s)
+		domain, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+	}); err != nil {
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		loop:         loop,
+		conn:         conn,
+		fd:           fd,
+		ipv4:         domain == unix.AF_INET,
+		pool:         bufpool.New(len(loop.buf)),
+		datagrams:    make(chan datagram, defaultQueueSize),
+		closeCh:      make(chan struct{}),
+		readDeadline: deadline.New(),
+	}
+	c.addrs.New = func() interface{} {
+		return &unix.RawSockaddrAny{}
+	}
+	if err := loop.add(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dispatch calls handler from the loop with every datagram received from now
+// on, instead of queueing them for ReadFrom. p is only valid during the call,
+// which holds up the other sockets of the loop. failed is called once the loop
+// stops, reads fail like with ReadFrom then.
+func (c *Conn) Dispatch(handler func(p []byte, from netip.AddrPort), failed func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handler, c.failed = handler, failed
+}
+
+// drain is called by the loop to read the datagrams of the ready socket
+func (c *Conn) drain(buf []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var from unix.RawSockaddrAny
+	for i := 0; i < drainLimit && !c.closed; i++ {
+		fromLen := uint32(unix.SizeofSockaddrAny)
+		// MSG_TRUNC returns the length of truncated datagrams, which are dropped
+		n, _, errno := unix.Syscall6(unix.SYS_RECVFROM, uintptr(c.fd), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+			unix.MSG_TRUNC, uintptr(unsafe.Pointer(&from)), uintptr(unsafe.Pointer(&fromLen)))
+		switch {
+		case errno == unix.EINTR:
+			continue
+		case errno != 0: // EAGAIN once drained
+			return
+		case int(n) > len(buf):
+			continue
+		}
+
+		if addr, ok := ipnet.SockaddrAddrPort(&from); !ok {
+			continue
+		} else if c.handler != nil {
+			c.handler(buf[:n], addr)
+		} else {
+			select {
+			case c.datagrams <- datagram{data: c.pool.Copy(buf[:n]), from: addr}:
+			default: // Dropped like by a full socket buffer
+			}
+		}
+	}
+}
+
+// stopped is called by the loop once it stops
+func (c *Conn) stopped() {
+	c.lock.Lock()
+	failed := c.failed
+	if c.closed {
+		failed = nil
+	}
+	c.lock.Unlock()
+	if failed != nil {
+		failed()
+	}
+}
+
+// ReadFrom reads a datagram received ahead
+func (c *Conn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closeCh:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	default:
+	}
+	select {
+	case d := <-c.datagrams:
+		return c.copyDatagram(p, d)
+	default:
+	}
+
+	select {
+	case d := <-c.datagrams:
+		return c.copyDatagram(p, d)
+	case <-c.closeCh:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	case <-c.loop.closing:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	case <-c.readDeadline.Done():
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// Buffered returns the number of datagrams received ahead, which ReadFrom
+// returns without waiting
+func (c *Conn) Buffered() int {
+	return len(c.datagrams)
+}
+
+func (c *Conn) copyDatagram(p []byte, d datagram) (int, net.Addr, error) {
+	n := copy(p, *d.data)
+	c.pool.Put(d.data)
+	return n, net.UDPAddrFromAddrPort(d.from), nil
+}
+
+// WriteTo sends a datagram right away, or through the Go runtime once the
+// send buffer of the socket is full
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: errNotUDP}
+	}
+	select {
+	case <-c.closeCh:
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: net.ErrClosed}
+	default:
+	}
+
+	sa := c.addrs.Get().(*unix.RawSockaddrAny) //nolint:forcetypeassert
+	defer c.addrs.Put(sa)
+	saLen := ipnet.PutSockaddr(sa, udpAddr.AddrPort(), c.ipv4)
+	var base unsafe.Pointer
+	if len(p) > 0 {
+		base = unsafe.Pointer(&p[0])
+	}
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_SENDTO, uintptr(c.fd), uintptr(base), uintptr(len(p)), 0, uintptr(unsafe.Pointer(sa)), uintptr(saLen))
+		switch errno {
+		case 0:
+			return len(p), nil
+		case unix.EINTR:
+			continue
+		case unix.EAGAIN:
+			return c.conn.WriteTo(p, addr)
+		default:
+			return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: os.NewSyscallError("sendto", errno)}
+		}
+	}
+}
+
+// Close removes the socket from the loop and closes it
+func (c *Conn) Close() error {
+	c.lock.Lock() // Waits for the loop to finish draining the socket
+	if c.closed {
+		c.lock.Unlock()
+		return c.conn.Close()
+	}
+	c.closed = true
+	c.lock.Unlock()
+
+	c.loop.remove(c)
+	c.closeOnce.Do(func() { close(c.closeCh) })
+	return c.conn.Close()
+}
+
+// LocalAddr returns the address of the socket
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// SetDeadline sets the read deadline, writes do not time out
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of ReadFrom
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes do not time out
+func (c *Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
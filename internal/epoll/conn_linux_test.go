@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package epoll
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn(t *testing.T) {
+	loop, err := NewLoop(64)
+	require.NoError(t, err)
+
+	for _, network := range []string{"udp4", "udp6"} {
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "udp6" {
+				addr = "[::1]:0"
+			}
+			udpConn, err := net.ListenUDP(network, net.UDPAddrFromAddrPort(netip.MustParseAddrPort(addr)))
+			if err != nil {
+				t.Skipf("%s is unavailable: %s", network, err)
+			}
+			peer, err := net.ListenPacket(network, addr)
+			require.NoError(t, err)
+			defer peer.Close() //nolint:errcheck
+
+			conn, err := NewConn(loop, udpConn)
+			require.NoError(t, err)
+
+			// More datagrams than a round of the loop drains, in order
+			for i := 0; i < 2*drainLimit; i++ {
+				_, err = peer.WriteTo([]byte(fmt.Sprintf("datagram %d", i)), conn.LocalAddr())
+				require.NoError(t, err)
+				if i == drainLimit/2 {
+					// Too large for the buffer of the loop, dropped
+					_, err = peer.WriteTo(make([]byte, 65), conn.LocalAddr())
+					require.NoError(t, err)
+				}
+			}
+			buf := make([]byte, 128)
+			for i := 0; i < 2*drainLimit; i++ {
+				n, from, err := conn.ReadFrom(buf)
+				require.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("datagram %d", i), string(buf[:n]))
+				assert.Equal(t, peer.LocalAddr().String(), from.String())
+			}
+
+			n, err := conn.WriteTo([]byte("reply"), peer.LocalAddr())
+			require.NoError(t, err)
+			assert.Equal(t, 5, n)
+			n, from, err := peer.ReadFrom(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "reply", string(buf[:n]))
+			assert.Equal(t, conn.LocalAddr().String(), from.String())
+
+			assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+			_, _, err = conn.ReadFrom(buf)
+			var netErr net.Error
+			assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "the read should time out")
+
+			assert.NoError(t, conn.Close())
+			_, _, err = conn.ReadFrom(buf)
+			assert.ErrorIs(t, err, net.ErrClosed)
+			_, err = conn.WriteTo([]byte("late"), peer.LocalAddr())
+			assert.ErrorIs(t, err, net.ErrClosed)
+		})
+	}
+
+	t.Run("LoopClosed", func(t *testing.T) {
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		conn, err := NewConn(loop, udpConn)
+		require.NoError(t, err)
+
+		assert.NoError(t, loop.Close())
+		_, _, err = conn.ReadFrom(make([]byte, 64))
+		assert.ErrorIs(t, err, net.ErrClosed)
+		assert.NoError(t, conn.Close())
+
+		udpConn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer udpConn.Close() //nolint:errcheck
+		_, err = NewConn(loop, udpConn)
+		assert.ErrorIs(t, err, errClosed)
+	})
+}
+
+func TestLoopSockets(t *testing.T) {
+	loop, err := NewLoop(64)
+	require.NoError(t, err)
+	defer loop.Close() //nolint:errcheck
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	// The sockets of a loop are drained in the same rounds
+	conns := make([]*Conn, 4)
+	for i := range conns {
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		conns[i], err = NewConn(loop, udpConn)
+		require.NoError(t, err)
+		defer conns[i].Close() //nolint:errcheck
+	}
+	for i, conn := range conns {
+		_, err = peer.WriteTo([]byte(fmt.Sprintf("to %d", i)), conn.LocalAddr())
+		require.NoError(t, err)
+	}
+	buf := make([]byte, 64)
+	for i, conn := range conns {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("to %d", i), string(buf[:n]))
+	}
+	loop.lock.Lock()
+	assert.Len(t, loop.conns, len(conns))
+	loop.lock.Unlock()
+
+	assert.NoError(t, conns[0].Close())
+	loop.lock.Lock()
+	assert.Len(t, loop.conns, len(conns)-1)
+	loop.lock.Unlock()
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+// Package epoll reads the sockets of the server from event loops, each an
+// epoll(7) instance waited on by a single OS thread. A loop drains the
+// datagrams of every ready socket before it waits again, instead of a
+// goroutine blocking in the read of each socket.
+package epoll
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// events is the number of ready sockets a loop takes per epoll_wait
+	events = 128
+
+	// drainLimit is the number of datagrams read from a socket per round of a
+	// loop, so a flooded socket does not starve the others
+	drainLimit = 64
+)
+
+var errClosed = errors.New("loop closed")
+
+// Loop is an epoll instance with an OS thread of its own draining its sockets
+type Loop struct {
+	fd   int
+	wake int // eventfd interrupting the wait on Close
+	buf  []byte
+
+	lock   sync.Mutex // Guards conns and closed
+	conns  map[int32]*Conn
+	closed bool
+
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLoop creates a loop reading datagrams of up to bufferSize bytes
+func NewLoop(bufferSize int) (*Loop, error) {
+	fd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wake, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	if err = unix.EpollCtl(fd, unix.EPOLL_CTL_ADD, wake, &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wake)}); err != nil {
+		_ = unix.Close(wake)
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	l := &Loop{
+		fd:      fd,
+		wake:    wake,
+		buf:     make([]byte, bufferSize),
+		conns:   map[int32]*Conn{},
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Close stops the loop. Conns of the loop fail from then on.
+func (l *Loop) Close() (err error) {
+	l.lock.Lock()
+	l.closed = true
+	l.lock.Unlock()
+
+	// Any counter other than 0 wakes the loop, whatever the byte order
+	if _, err = unix.Write(l.wake, []byte{1, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	<-l.done
+	l.closeOnce.Do(func() {
+		err = errors.Join(unix.Close(l.fd), unix.Close(l.wake))
+	})
+	return err
+}
+
+// add registers c for the readiness of its socket
+func (l *Loop) add(c *Conn) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return errClosed
+	}
+	if err := unix.EpollCtl(l.fd, unix.EPOLL_CTL_ADD, c.fd, &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(c.fd)}); err != nil {
+		return err
+	}
+	l.conns[int32(c.fd)] = c
+	return nil
+}
+
+// remove unregisters c before its socket is closed
+func (l *Loop) remove(c *Conn) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed { // The epoll instance may be gone
+		return
+	}
+	_ = unix.EpollCtl(l.fd, unix.EPOLL_CTL_DEL, c.fd, nil)
+	delete(l.conns, int32(c.fd))
+}
+
+// stopped fails the conns of the loop
+func (l *Loop) stopped() {
+	l.lock.Lock()
+	l.closed = true
+	conns := make([]*Conn, 0, len(l.conns))
+	for _, c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.lock.Unlock()
+
+	close(l.closing)
+	for _, c := range conns {
+		c.stopped()
+	}
+}
+
+// run waits for ready sockets and drains them until the loop is closed
+func (l *Loop) run() {
+	runtime.LockOSThread()
+	defer close(l.done)
+	defer l.stopped()
+
+	ready := make([]unix.EpollEvent, events)
+	for {
+		n, err := unix.EpollWait(l.fd, ready, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		} else if err != nil {
+			return
+		}
+
+		for _, event := range ready[:n] {
+			if event.Fd == int32(l.wake) {
+				l.lock.Lock()
+				closed := l.closed
+				l.lock.Unlock()
+				if closed {
+					return
+				}
+				continue
+			}
+
+			l.lock.Lock()
+			c := l.conns[event.Fd]
+			l.lock.Unlock()
+			// An event of a socket removed meanwhile may find the next socket
+			// with its descriptor, which then has nothing to read
+			if c != nil {
+				c.drain(l.buf)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package fastlog keeps the logging of the data path from costing more than
+// relaying the packets: the levels a logger does not log are known, so their
+// arguments need not be formatted, and the lines of every level can be
+// limited per second.
+package fastlog
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// Logger is a logging.LeveledLogger that drops the levels it does not log
+// and the lines beyond its rate limit without calling the wrapped logger
+type Logger struct {
+	logging.LeveledLogger
+	level  logging.LogLevel // Most verbose level logged
+	limit  int64
+	levels [logging.LogLevelTrace + 1]window
+	now    func() time.Time
+}
+
+// window counts the lines of a level in the current second
+type window struct {
+	second  atomic.Int64
+	lines   atomic.Int64
+	dropped atomic.Uint64
+}
+
+// New returns the logger of factory for scope, with at most limit lines per
+// second and level, unlimited if it is 0. The level of the logger is known
+// for a logging.DefaultLoggerFactory, other loggers are given every line
+// within the limit.
+func New(factory logging.LoggerFactory, scope string, limit int) *Logger {
+	level := logging.LogLevelTrace
+	if f, ok := factory.(*logging.DefaultLoggerFactory); ok {
+		level = f.DefaultLogLevel
+		if scopeLevel, ok := f.ScopeLevels[scope]; ok {
+			level = scopeLevel
+		}
+	}
+	return &Logger{LeveledLogger: factory.NewLogger(scope), level: level, limit: int64(limit), now: time.Now}
+}
+
+// Enabled reports if log would log a line of level now. Callers check it
+// before they compute the arguments of lines logged per packet. Loggers
+// other than a Logger, or a logger of With, log every level.
+func Enabled(log logging.LeveledLogger, level logging.LogLevel) bool {
+	if l, ok := log.(levelLogger); ok {
+		return l.Enabled(level)
+	}
+	return true
+}
+
+// levelLogger is a logger knowing the levels it logs
+type levelLogger interface {
+	Enabled(level logging.LogLevel) bool
+}
+
+// Enabled reports if a line of level would be logged now
+func (l *Logger) Enabled(level logging.LogLevel) bool {
+	if level > l.level || level <= logging.LogLevelDisabled {
+		return false
+	}
+	if l.limit == 0 {
+		return true
+	}
+	w := &l.levels[level]
+	return w.second.Load() != l.now().Unix() || w.lines.Load() < l.limit
+}
+
+// allow counts a line of level and reports if it is logged
+func (l *Logger) allow(level logging.LogLevel) bool {
+	if level > l.level {
+		return false
+	}
+	if l.limit == 0 {
+		return true
+	}
+
+	w := &l.levels[level]
+	now := l.now().Unix()
+	if second := w.second.Load(); second != now && w.second.CompareAndSwap(second, now) {
+		w.lines.Store(0)
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			l.LeveledLogger.Warnf("Dropped %d %s lines beyond the log rate limit", dropped, level)
+		}
+	}
+	if w.lines.Add(1) > l.limit {
+		w.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+// Trace logs msg at trace level within the limit
+func (l *Logger) Trace(msg string) {
+	if l.allow(logging.LogLevelTrace) {
+		l.LeveledLogger.Trace(msg)
+	}
+}
+
+// Tracef logs at trace level within the limit
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	if l.allow(logging.LogLevelTrace) {
+		l.LeveledLogger.Tracef(format, args...)
+	}
+}
+
+// Debug logs msg at debug level within the limit
+func (l *Logger) Debug(msg string) {
+	if l.allow(logging.LogLevelDebug) {
+		l.LeveledLogger.Debug(msg)
+	}
+}
+
+// Debugf logs at debug level within the limit
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.allow(logging.LogLevelDebug) {
+		l.LeveledLogger.Debugf(format, args...)
+	}
+}
+
+// Info logs msg at info level within the limit
+func (l *Logger) Info(msg string) {
+	if l.allow(logging.LogLevelInfo) {
+		l.LeveledLogger.Info(msg)
+	}
+}
+
+// Infof logs at info level within the limit
+func (l *Logger) Infof(format string, args ...interface{}) {
+	if l.allow(logging.LogLevelInfo) {
+		l.LeveledLogger.Infof(format, args...)
+	}
+}
+
+// Warn logs msg at warning level within the limit
+func (l *Logger) Warn(msg string) {
+	if l.allow(logging.LogLevelWarn) {
+		l.LeveledLogger.Warn(msg)
+	}
+}
+
+// Warnf logs at warning level within the limit
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	if l.allow(logging.LogLevelWarn) {
+		l.LeveledLogger.Warnf(format, args...)
+	}
+}
+
+// Error logs msg at error level within the limit
+func (l *Logger) Error(msg string) {
+	if l.allow(logging.LogLevelError) {
+		l.LeveledLogger.Error(msg)
+	}
+}
+
+// Errorf logs at error level within the limit
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	if l.allow(logging.LogLevelError) {
+		l.LeveledLogger.Errorf(format, args...)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package fastlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	factory := logging.NewDefaultLoggerFactory()
+	factory.Writer = &out
+	factory.DefaultLogLevel = logging.LogLevelError
+	factory.ScopeLevels["turn"] = logging.LogLevelInfo
+
+	t.Run("Levels", func(t *testing.T) {
+		log := New(factory, "turn", 0)
+		assert.True(t, Enabled(log, logging.LogLevelInfo))
+		assert.False(t, Enabled(log, logging.LogLevelDebug))
+		assert.False(t, Enabled(New(factory, "other", 0), logging.LogLevelInfo))
+		assert.True(t, Enabled(factory.NewLogger("turn"), logging.LogLevelTrace), "unknown loggers log every level")
+
+		out.Reset()
+		log.Debugf("debug %d", 1)
+		log.Infof("info %d", 1)
+		assert.NotContains(t, out.String(), "debug")
+		assert.Contains(t, out.String(), "info 1")
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		log := New(factory, "turn", 2)
+		log.now = func() time.Time { return now }
+
+		out.Reset()
+		for i := 0; i < 5; i++ {
+			log.Infof("line %d", i)
+		}
+		assert.Equal(t, 2, strings.Count(out.String(), "line"))
+		assert.False(t, log.Enabled(logging.LogLevelInfo))
+		assert.True(t, log.Enabled(logging.LogLevelError), "every level is limited on its own")
+
+		now = now.Add(time.Second)
+		assert.True(t, log.Enabled(logging.LogLevelInfo))
+		out.Reset()
+		log.Info("next second")
+		assert.Contains(t, out.String(), "Dropped 3 Info lines")
+		assert.Contains(t, out.String(), "next second")
+	})
+}
+
+// fieldLogger records the fields of the lines logged
+type fieldLogger struct {
+	logging.LeveledLogger
+	fields [][]interface{}
+}
+
+func (l *fieldLogger) Logw(_ logging.LogLevel, msg string, keysAndValues ...interface{}) {
+	l.fields = append(l.fields, append([]interface{}{msg}, keysAndValues...))
+}
+
+func TestLogw(t *testing.T) {
+	var out bytes.Buffer
+	factory := logging.NewDefaultLoggerFactory()
+	factory.Writer = &out
+	factory.DefaultLogLevel = logging.LogLevelInfo
+
+	t.Run("Formatted", func(t *testing.T) {
+		out.Reset()
+		log := New(factory, "turn", 0)
+		Infow(log, "Refusing 100% of credentials", "username", "user", "realm", "pion.ly", "code", 401)
+		Debugw(log, "Not logged", "username", "user")
+		Warnw(factory.NewLogger("turn"), "Odd", "src")
+		assert.Contains(t, out.String(), "Refusing 100% of credentials username=user realm=pion.ly code=401")
+		assert.NotContains(t, out.String(), "Not logged")
+		assert.Contains(t, out.String(), "Odd !BADKEY=src")
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		fields := &fieldLogger{LeveledLogger: factory.NewLogger("turn")}
+		log := &Logger{LeveledLogger: fields, level: logging.LogLevelInfo, now: time.Now}
+		Errorw(log, "Failed", "err", "closed")
+		Debugw(log, "Not logged")
+		assert.Equal(t, [][]interface{}{{"Failed", "err", "closed"}}, fields.fields)
+	})
+}
+
+func TestWith(t *testing.T) {
+	var out bytes.Buffer
+	factory := logging.NewDefaultLoggerFactory()
+	factory.Writer = &out
+	factory.DefaultLogLevel = logging.LogLevelInfo
+
+	t.Run("Formatted", func(t *testing.T) {
+		out.Reset()
+		log := With(New(factory, "turn", 0), "username", "alice")
+		assert.False(t, Enabled(log, logging.LogLevelDebug), "the levels of the parent should be logged")
+		assert.True(t, Enabled(log, logging.LogLevelInfo))
+
+		Infow(log, "Adding permission", "peer", "192.0.2.1")
+		log.Warnf("Refreshed %d%%", 50)
+		log.Debug("not logged")
+		Infow(With(log, "realm", "pion.ly"), "Nested")
+		assert.Contains(t, out.String(), "Adding permission username=alice peer=192.0.2.1")
+		assert.Contains(t, out.String(), "Refreshed 50% username=alice")
+		assert.Contains(t, out.String(), "Nested username=alice realm=pion.ly")
+		assert.NotContains(t, out.String(), "not logged")
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		fields := &fieldLogger{LeveledLogger: factory.NewLogger("turn")}
+		log := With(fields, "username", "alice")
+		Infow(With(log, "realm", "pion.ly"), "Deleted allocation")
+		log.Info("Created allocation")
+		assert.Equal(t, [][]interface{}{
+			{"Deleted allocation", "username", "alice", "realm", "pion.ly"},
+			{"Created allocation", "username", "alice"},
+		}, fields.fields)
+	})
+}
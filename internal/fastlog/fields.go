@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package fastlog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pion/logging"
+)
+
+// FieldLogger is a logger of lines with key/value fields, such as the
+// log/slog adapter of package turn, which keeps the fields apart instead of
+// formatting them into the line
+type FieldLogger interface {
+	// Logw logs msg at level with the fields of alternating keys and values
+	Logw(level logging.LogLevel, msg string, keysAndValues ...interface{})
+}
+
+// Logw logs msg at level with the fields of alternating keys and values.
+// Loggers other than a FieldLogger are given the fields appended to msg as
+// key=value pairs, formatted by the logger only at the levels it logs.
+func Logw(log logging.LeveledLogger, level logging.LogLevel, msg string, keysAndValues ...interface{}) {
+	if l, ok := log.(FieldLogger); ok {
+		l.Logw(level, msg, keysAndValues...)
+		return
+	}
+
+	format := fieldsFormat(msg, len(keysAndValues))
+	switch level {
+	case logging.LogLevelError:
+		log.Errorf(format, keysAndValues...)
+	case logging.LogLevelWarn:
+		log.Warnf(format, keysAndValues...)
+	case logging.LogLevelInfo:
+		log.Infof(format, keysAndValues...)
+	case logging.LogLevelDebug:
+		log.Debugf(format, keysAndValues...)
+	case logging.LogLevelTrace:
+		log.Tracef(format, keysAndValues...)
+	default:
+	}
+}
+
+// Tracew logs msg at trace level with fields, see Logw
+func Tracew(log logging.LeveledLogger, msg string, keysAndValues ...interface{}) {
+	Logw(log, logging.LogLevelTrace, msg, keysAndValues...)
+}
+
+// Debugw logs msg at debug level with fields, see Logw
+func Debugw(log logging.LeveledLogger, msg string, keysAndValues ...interface{}) {
+	Logw(log, logging.LogLevelDebug, msg, keysAndValues...)
+}
+
+// Infow logs msg at info level with fields, see Logw
+func Infow(log logging.LeveledLogger, msg string, keysAndValues ...interface{}) {
+	Logw(log, logging.LogLevelInfo, msg, keysAndValues...)
+}
+
+// Warnw logs msg at warning level with fields, see Logw
+func Warnw(log logging.LeveledLogger, msg string, keysAndValues ...interface{}) {
+	Logw(log, logging.LogLevelWarn, msg, keysAndValues...)
+}
+
+// Errorw logs msg at error level with fields, see Logw
+func Errorw(log logging.LeveledLogger, msg string, keysAndValues ...interface{}) {
+	Logw(log, logging.LogLevelError, msg, keysAndValues...)
+}
+
+// Logw logs msg at level with fields within the limit, see the function Logw
+func (l *Logger) Logw(level logging.LogLevel, msg string, keysAndValues ...interface{}) {
+	if l.allow(level) {
+		Logw(l.LeveledLogger, level, msg, keysAndValues...)
+	}
+}
+
+type formatKey struct {
+	msg    string
+	fields int
+}
+
+// maxFormats bounds formats, messages formatted by the printf-like methods of
+// the loggers of With are not constants
+const maxFormats = 1024
+
+// formats caches the format of the lines by message and number of fields
+var formats struct {
+	sync.RWMutex
+	m map[formatKey]string
+}
+
+// fieldsFormat returns the format of msg followed by fields key=value pairs,
+// msg escaped. A value missing its key is keyed !BADKEY like log/slog does.
+func fieldsFormat(msg string, fields int) string {
+	key := formatKey{msg: msg, fields: fields}
+	formats.RLock()
+	format, ok := formats.m[key]
+	formats.RUnlock()
+	if ok {
+		return format
+	}
+
+	format = strings.ReplaceAll(msg, "%", "%%") + strings.Repeat(" %v=%v", fields/2)
+	if fields%2 == 1 {
+		format += " !BADKEY=%v"
+	}
+	formats.Lock()
+	if formats.m == nil {
+		formats.m = map[formatKey]string{}
+	}
+	if len(formats.m) < maxFormats {
+		formats.m[key] = format
+	}
+	formats.Unlock()
+	return format
+}
+
+// fieldsLogger is a logger adding its fields to every line, see With
+type fieldsLogger struct {
+	log    logging.LeveledLogger
+	fields []interface{}
+}
+
+// With returns a logger adding the fields of alternating keys and values to
+// every line logged with log, such as the username and addresses of an
+// allocation. It logs the levels log logs, see Enabled.
+func With(log logging.LeveledLogger, keysAndValues ...interface{}) logging.LeveledLogger {
+	if l, ok := log.(*fieldsLogger); ok {
+		return &fieldsLogger{log: l.log, fields: append(l.fields[:len(l.fields):len(l.fields)], keysAndValues...)}
+	}
+	return &fieldsLogger{log: log, fields: keysAndValues}
+}
+
+// Enabled reports if the logger of the fields logs a line of level now
+func (l *fieldsLogger) Enabled(level logging.LogLevel) bool {
+	return Enabled(l.log, level)
+}
+
+// Logw logs msg with the fields of the logger followed by keysAndValues
+func (l *fieldsLogger) Logw(level logging.LogLevel, msg string, keysAndValues ...interface{}) {
+	if Enabled(l.log, level) {
+		Logw(l.log, level, msg, append(l.fields[:len(l.fields):len(l.fields)], keysAndValues...)...)
+	}
+}
+
+func (l *fieldsLogger) logf(level logging.LogLevel, format string, args []interface{}) {
+	if Enabled(l.log, level) {
+		Logw(l.log, level, fmt.Sprintf(format, args...), l.fields...)
+	}
+}
+
+func (l *fieldsLogger) Trace(msg string) { l.Logw(logging.LogLevelTrace, msg) }
+func (l *fieldsLogger) Tracef(format string, args ...interface{}) {
+	l.logf(logging.LogLevelTrace, format, args)
+}
+
+func (l *fieldsLogger) Debug(msg string) { l.Logw(logging.LogLevelDebug, msg) }
+func (l *fieldsLogger) Debugf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelDebug, format, args)
+}
+
+func (l *fieldsLogger) Info(msg string) { l.Logw(logging.LogLevelInfo, msg) }
+func (l *fieldsLogger) Infof(format string, args ...interface{}) {
+	l.logf(logging.LogLevelInfo, format, args)
+}
+
+func (l *fieldsLogger) Warn(msg string) { l.Logw(logging.LogLevelWarn, msg) }
+func (l *fieldsLogger) Warnf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelWarn, format, args)
+}
+
+func (l *fieldsLogger) Error(msg string) { l.Logw(logging.LogLevelError, msg) }
+func (l *fieldsLogger) Errorf(format string, args ...interface{}) {
+	l.logf(logging.LogLevelError, format, args)
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package ipnet
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SockaddrAddrPort decodes the address a datagram was received from, IPv4
+// addresses mapped on IPv6 sockets are unmapped
+func SockaddrAddrPort(sa *unix.RawSockaddrAny) (netip.AddrPort, bool) {
+	switch sa.Addr.Family {
+	case unix.AF_INET:
+		sa4 := (*unix.RawSockaddrInet4)(unsafe.Pointer(sa))
+		return netip.AddrPortFrom(netip.AddrFrom4(sa4.Addr), networkPort(sa4.Port)), true
+	case unix.AF_INET6:
+		sa6 := (*unix.RawSockaddrInet6)(unsafe.Pointer(sa))
+		return netip.AddrPortFrom(netip.AddrFrom16(sa6.Addr).Unmap(), networkPort(sa6.Port)), true
+	default:
+		return netip.AddrPort{}, false
+	}
+}
+
+// PutSockaddr encodes a destination in the family of the socket and returns
+// its length, IPv4 addresses are mapped on IPv6 sockets
+func PutSockaddr(sa *unix.RawSockaddrAny, addr netip.AddrPort, ipv4 bool) uint32 {
+	if ipv4 {
+		sa4 := (*unix.RawSockaddrInet4)(unsafe.Pointer(sa))
+		*sa4 = unix.RawSockaddrInet4{Family: unix.AF_INET, Addr: addr.Addr().Unmap().As4()}
+		binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&sa4.Port))[:], addr.Port())
+		return unix.SizeofSockaddrInet4
+	}
+	sa6 := (*unix.RawSockaddrInet6)(unsafe.Pointer(sa))
+	*sa6 = unix.RawSockaddrInet6{Family: unix.AF_INET6, Addr: addr.Addr().As16()}
+	binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&sa6.Port))[:], addr.Port())
+	return unix.SizeofSockaddrInet6
+}
+
+// networkPort converts a port in network byte order
+func networkPort(p uint16) uint16 {
+	return binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&p))[:])
+}
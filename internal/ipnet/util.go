@@ -7,6 +7,7 @@ package ipnet
 import (
 	"errors"
 	"net"
+	"net/netip"
 )
 
 var errFailedToCastAddr = errors.New("failed to cast net.Addr to *net.UDPAddr or *net.TCPAddr")
@@ -42,14 +43,29 @@ func AddrEqual(a, b net.Addr) bool {
 	return aUDP.IP.Equal(bUDP.IP) && aUDP.Port == bUDP.Port
 }
 
-// FingerprintAddr generates a fingerprint from net.UDPAddr or net.TCPAddr's
-// which can be used for indexing maps.
-func FingerprintAddr(addr net.Addr) string {
+// FingerprintAddr generates a fingerprint from the IP of net.UDPAddr or
+// net.TCPAddr's which can be used for indexing maps. IPv4-mapped addresses
+// have the fingerprint of their IPv4 address.
+func FingerprintAddr(addr net.Addr) netip.Addr {
+	var ip net.IP
 	switch a := addr.(type) {
 	case *net.UDPAddr:
-		return a.IP.String()
-	case *net.TCPAddr: // Do we really need this case?
-		return a.IP.String()
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
 	}
-	return "" // Should never happen
+	fingerprint, _ := netip.AddrFromSlice(ip)
+	return fingerprint.Unmap()
+}
+
+// FingerprintAddrPort generates a fingerprint from the IP and port of
+// net.UDPAddr or net.TCPAddr's like FingerprintAddr
+func FingerprintAddrPort(addr net.Addr) netip.AddrPort {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return netip.AddrPortFrom(FingerprintAddr(a), uint16(a.Port))
+	case *net.TCPAddr:
+		return netip.AddrPortFrom(FingerprintAddr(a), uint16(a.Port))
+	}
+	return netip.AddrPort{}
 }
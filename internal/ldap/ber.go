@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package ldap implements the small subset of LDAPv3 (RFC 4511) needed to look up
+// credentials: simple binds, equality searches and StartTLS.
+package ldap
+
+import (
+	"bufio"
+	"io"
+)
+
+// BER identifier octets of the elements used by the protocol
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	tagBindRequest     = 0x60
+	tagBindResponse    = 0x61
+	tagUnbindRequest   = 0x42
+	tagSearchRequest   = 0x63
+	tagSearchEntry     = 0x64
+	tagSearchDone      = 0x65
+	tagSearchReference = 0x73
+	tagExtendedRequest = 0x77
+	tagExtendedResp    = 0x78
+
+	tagSimpleAuth      = 0x80 // [0] in BindRequest.authentication
+	tagEqualityFilter  = 0xa3 // [3] in Filter
+	tagExtendedReqName = 0x80 // [0] in ExtendedRequest
+)
+
+// maxMessageSize bounds the messages read from the server
+const maxMessageSize = 1 << 20
+
+// element is a decoded BER TLV
+type element struct {
+	tag     byte
+	content []byte
+}
+
+// appendElement appends a BER TLV with definite length to b
+func appendElement(b []byte, tag byte, content []byte) []byte {
+	b = append(b, tag)
+	switch n := len(content); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, content...)
+}
+
+func appendInteger(b []byte, tag byte, v int) []byte {
+	// Minimal two's complement encoding
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		v >>= 8
+		if (v == 0 && content[0]&0x80 == 0) || (v == -1 && content[0]&0x80 != 0) {
+			break
+		}
+	}
+	return appendElement(b, tag, content)
+}
+
+func appendBoolean(b []byte, v bool) []byte {
+	if v {
+		return appendElement(b, tagBoolean, []byte{0xff})
+	}
+	return appendElement(b, tagBoolean, []byte{0x00})
+}
+
+func appendString(b []byte, tag byte, s string) []byte {
+	return appendElement(b, tag, []byte(s))
+}
+
+// parseElement decodes the first TLV of b and returns it with the remaining bytes
+func parseElement(b []byte) (element, []byte, error) {
+	if len(b) < 2 {
+		return element{}, nil, errMalformed
+	}
+	tag, length, n := b[0], int(b[1]), 2
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		if octets == 0 || octets > 4 || len(b) < 2+octets {
+			return element{}, nil, errMalformed
+		}
+		length = 0
+		for _, o := range b[2 : 2+octets] {
+			length = length<<8 | int(o)
+		}
+		n += octets
+	}
+	if length < 0 || len(b)-n < length {
+		return element{}, nil, errMalformed
+	}
+	return element{tag: tag, content: b[n : n+length]}, b[n+length:], nil
+}
+
+// children decodes the elements of a constructed element
+func (e element) children() ([]element, error) {
+	var children []element
+	for rest := e.content; len(rest) > 0; {
+		var child element
+		var err error
+		if child, rest, err = parseElement(rest); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+func (e element) integer() (int, error) {
+	if (e.tag != tagInteger && e.tag != tagEnumerated) || len(e.content) == 0 || len(e.content) > 4 {
+		return 0, errMalformed
+	}
+	v := int(int8(e.content[0]))
+	for _, o := range e.content[1:] {
+		v = v<<8 | int(o)
+	}
+	return v, nil
+}
+
+// readElement reads a single TLV from the stream
+func readElement(r *bufio.Reader) (element, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return element{}, err
+	}
+	if header[1]&0x80 != 0 {
+		octets := int(header[1] & 0x7f)
+		if octets == 0 || octets > 4 {
+			return element{}, errMalformed
+		}
+		header = header[:2+octets]
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return element{}, err
+		}
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		length = 0
+		for _, o := range header[2:] {
+			length = length<<8 | int(o)
+		}
+	}
+	if length < 0 || length > maxMessageSize {
+		return element{}, errMessageTooLarge
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return element{}, err
+	}
+	return element{tag: header[0], content: content}, nil
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInteger(t *testing.T) {
+	for _, tc := range []struct {
+		value   int
+		encoded []byte
+	}{
+		{0, []byte{0x02, 0x01, 0x00}},
+		{3, []byte{0x02, 0x01, 0x03}},
+		{127, []byte{0x02, 0x01, 0x7f}},
+		{128, []byte{0x02, 0x02, 0x00, 0x80}},
+		{256, []byte{0x02, 0x02, 0x01, 0x00}},
+		{-1, []byte{0x02, 0x01, 0xff}},
+		{-129, []byte{0x02, 0x02, 0xff, 0x7f}},
+	} {
+		encoded := appendInteger(nil, tagInteger, tc.value)
+		assert.Equal(t, tc.encoded, encoded, "%d", tc.value)
+
+		e, rest, err := parseElement(encoded)
+		assert.NoError(t, err)
+		assert.Empty(t, rest)
+		v, err := e.integer()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.value, v)
+	}
+}
+
+func TestElementLength(t *testing.T) {
+	for _, n := range []int{0, 0x7f, 0x80, 0xff, 0x100, 0x10000} {
+		content := bytes.Repeat([]byte{'a'}, n)
+		encoded := appendElement(nil, tagOctetString, content)
+
+		e, rest, err := parseElement(append(encoded, 0x05, 0x00))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x05, 0x00}, rest)
+		assert.Equal(t, content, e.content)
+
+		e, err = readElement(bufio.NewReader(bytes.NewReader(encoded)))
+		assert.NoError(t, err)
+		assert.Equal(t, content, e.content)
+	}
+
+	_, _, err := parseElement([]byte{0x04, 0x05, 'a'})
+	assert.ErrorIs(t, err, errMalformed)
+	_, _, err = parseElement([]byte{0x30, 0x80, 0x00, 0x00})
+	assert.ErrorIs(t, err, errMalformed, "indefinite lengths are not supported")
+	_, err = readElement(bufio.NewReader(bytes.NewReader([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff})))
+	assert.ErrorIs(t, err, errMessageTooLarge)
+}
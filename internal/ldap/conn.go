@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	resultSuccess = 0
+	startTLSOID   = "1.3.6.1.4.1.1466.20037"
+)
+
+// Conn is a connection to an LDAP server. It sends one operation at a time and
+// is not safe for concurrent use.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// Entry is an entry returned by a search
+type Entry struct {
+	DN string
+
+	attributes map[string][][]byte // Keyed by the lower case attribute type
+}
+
+// NewEntry returns an entry with the attributes
+func NewEntry(dn string, attributes map[string][][]byte) *Entry {
+	entry := &Entry{DN: dn, attributes: map[string][][]byte{}}
+	for name, values := range attributes {
+		entry.attributes[strings.ToLower(name)] = values
+	}
+	return entry
+}
+
+// Values returns the values of an attribute of the entry
+func (e *Entry) Values(attribute string) [][]byte {
+	return e.attributes[strings.ToLower(attribute)]
+}
+
+// NewConn returns a Conn over an established connection, e.g. a tls.Conn to an
+// ldaps:// server
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{conn: conn, reader: bufio.NewReader(conn), nextID: 1}
+}
+
+// SetDeadline sets the deadline of the underlying connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// StartTLS upgrades the connection to TLS (RFC 4511, section 4.14)
+func (c *Conn) StartTLS(config *tls.Config) error {
+	req := appendString(nil, tagExtendedReqName, startTLSOID)
+	res, err := c.roundTrip(appendElement(nil, tagExtendedRequest, req), tagExtendedResp)
+	if err != nil {
+		return err
+	}
+	if err := checkResult(res); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates the connection with a simple bind; an empty DN and password
+// binds anonymously
+func (c *Conn) Bind(dn, password string) error {
+	req := appendInteger(nil, tagInteger, 3)
+	req = appendString(req, tagOctetString, dn)
+	req = appendString(req, tagSimpleAuth, password)
+	res, err := c.roundTrip(appendElement(nil, tagBindRequest, req), tagBindResponse)
+	if err != nil {
+		return err
+	}
+	return checkResult(res)
+}
+
+// Search returns the entries below baseDN whose attribute equals value, with the
+// requested attributes. At most sizeLimit entries are returned, zero means no limit.
+//
+// The value is sent as an assertion value, not as a filter string, so it needs no
+// escaping.
+func (c *Conn) Search(baseDN, attribute, value string, sizeLimit int, attributes ...string) ([]*Entry, error) {
+	filter := appendString(nil, tagOctetString, attribute)
+	filter = appendString(filter, tagOctetString, value)
+
+	var attrs []byte
+	for _, a := range attributes {
+		attrs = appendString(attrs, tagOctetString, a)
+	}
+
+	req := appendString(nil, tagOctetString, baseDN)
+	req = appendInteger(req, tagEnumerated, 2) // wholeSubtree
+	req = appendInteger(req, tagEnumerated, 0) // neverDerefAliases
+	req = appendInteger(req, tagInteger, sizeLimit)
+	req = appendInteger(req, tagInteger, 0) // No time limit, the deadline applies
+	req = appendBoolean(req, false)
+	req = appendElement(req, tagEqualityFilter, filter)
+	req = appendElement(req, tagSequence, attrs)
+
+	id, err := c.send(appendElement(nil, tagSearchRequest, req))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case tagSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case tagSearchReference:
+			// Referrals to other servers are not followed
+		case tagSearchDone:
+			if err := checkResult(op); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errUnexpectedResponse
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	_, _ = c.send(appendElement(nil, tagUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+func (c *Conn) roundTrip(op []byte, responseTag byte) (element, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return element{}, err
+	}
+	res, err := c.receive(id)
+	if err != nil {
+		return element{}, err
+	}
+	if res.tag != responseTag {
+		return element{}, errUnexpectedResponse
+	}
+	return res, nil
+}
+
+// send writes an LDAPMessage with the operation and returns its message ID
+func (c *Conn) send(op []byte) (int, error) {
+	id := c.nextID
+	c.nextID++
+	if c.nextID > 1<<31-1 {
+		c.nextID = 1
+	}
+
+	msg := appendInteger(nil, tagInteger, id)
+	msg = append(msg, op...)
+	_, err := c.conn.Write(appendElement(nil, tagSequence, msg))
+	return id, err
+}
+
+// receive reads LDAPMessages until one answers the message ID, and returns its operation
+func (c *Conn) receive(id int) (element, error) {
+	for {
+		msg, err := readElement(c.reader)
+		if err != nil {
+			return element{}, err
+		}
+		if msg.tag != tagSequence {
+			return element{}, errMalformed
+		}
+		children, err := msg.children()
+		if err != nil {
+			return element{}, err
+		}
+		if len(children) < 2 {
+			return element{}, errMalformed
+		}
+
+		msgID, err := children[0].integer()
+		if err != nil {
+			return element{}, err
+		}
+		switch msgID {
+		case id:
+			return children[1], nil
+		case 0:
+			// Unsolicited notification, the only one defined is the Notice of Disconnection
+			return element{}, errDisconnected
+		}
+		// A late answer to an operation that was given up on
+	}
+}
+
+// checkResult returns the LDAPResult of a response as an error if it is not a success
+func checkResult(res element) error {
+	children, err := res.children()
+	if err != nil {
+		return err
+	}
+	if len(children) < 3 {
+		return errMalformed
+	}
+	code, err := children[0].integer()
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &Error{Code: code, Message: string(children[2].content)}
+	}
+	return nil
+}
+
+func parseEntry(op element) (*Entry, error) {
+	children, err := op.children()
+	if err != nil {
+		return nil, err
+	}
+	if len(children) < 2 {
+		return nil, errMalformed
+	}
+
+	attributes, err := children[1].children()
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{DN: string(children[0].content), attributes: map[string][][]byte{}}
+	for _, attribute := range attributes {
+		parts, err := attribute.children()
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) != 2 {
+			return nil, errMalformed
+		}
+		values, err := parts[1].children()
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.ToLower(string(parts[0].content))
+		for _, v := range values {
+			entry.attributes[name] = append(entry.attributes[name], v.content)
+		}
+	}
+	return entry, nil
+}
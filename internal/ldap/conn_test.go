@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ldapResult(tag byte, code int, message string) []byte {
+	res := appendInteger(nil, tagEnumerated, code)
+	res = appendString(res, tagOctetString, "")
+	res = appendString(res, tagOctetString, message)
+	return appendElement(nil, tag, res)
+}
+
+func searchEntry(dn string, attributes map[string][]string) []byte {
+	var attrs []byte
+	for name, values := range attributes {
+		var vals []byte
+		for _, v := range values {
+			vals = appendString(vals, tagOctetString, v)
+		}
+		attr := appendString(nil, tagOctetString, name)
+		attr = appendElement(attr, tagSet, vals)
+		attrs = appendElement(attrs, tagSequence, attr)
+	}
+	entry := appendString(nil, tagOctetString, dn)
+	entry = appendElement(entry, tagSequence, attrs)
+	return appendElement(nil, tagSearchEntry, entry)
+}
+
+// fakeServer answers the operations of a Conn like a directory with a single user
+func fakeServer(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	reply := func(id int, op []byte) {
+		msg := appendInteger(nil, tagInteger, id)
+		_, err := conn.Write(appendElement(nil, tagSequence, append(msg, op...)))
+		assert.NoError(t, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := readElement(reader)
+		if err != nil {
+			return
+		}
+		children, err := msg.children()
+		require.NoError(t, err)
+		id, err := children[0].integer()
+		require.NoError(t, err)
+		op := children[1]
+		fields, err := op.children()
+
+		switch op.tag {
+		case tagBindRequest:
+			require.NoError(t, err)
+			if string(fields[1].content) == "cn=turn,dc=example,dc=com" && string(fields[2].content) == "secret" {
+				reply(id, ldapResult(tagBindResponse, 0, ""))
+			} else {
+				reply(id, ldapResult(tagBindResponse, 49, "invalid credentials"))
+			}
+		case tagSearchRequest:
+			require.NoError(t, err)
+			assert.Equal(t, "dc=example,dc=com", string(fields[0].content))
+			ava, err := fields[6].children()
+			require.NoError(t, err)
+			assert.Equal(t, "uid", string(ava[0].content))
+
+			// A late answer to an abandoned operation is skipped
+			reply(id-1, ldapResult(tagSearchDone, 0, ""))
+			if string(ava[1].content) == "alice" {
+				reply(id, searchEntry("uid=alice,dc=example,dc=com", map[string][]string{
+					"turnPassword": {"pass"},
+				}))
+			}
+			reply(id, appendElement(nil, tagSearchReference, appendString(nil, tagOctetString, "ldap://other")))
+			reply(id, ldapResult(tagSearchDone, 0, ""))
+		case tagUnbindRequest:
+			return
+		default:
+			t.Errorf("unexpected operation %x", op.tag)
+			return
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		fakeServer(t, server)
+		assert.NoError(t, server.Close())
+		close(done)
+	}()
+
+	conn := NewConn(client)
+
+	var ldapErr *Error
+	assert.ErrorAs(t, conn.Bind("cn=turn,dc=example,dc=com", "wrong"), &ldapErr)
+	assert.Equal(t, 49, ldapErr.Code)
+	assert.NoError(t, conn.Bind("cn=turn,dc=example,dc=com", "secret"))
+
+	entries, err := conn.Search("dc=example,dc=com", "uid", "alice", 2, "turnPassword")
+	assert.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "uid=alice,dc=example,dc=com", entries[0].DN)
+	assert.Equal(t, [][]byte{[]byte("pass")}, entries[0].Values("TURNPASSWORD"))
+
+	entries, err = conn.Search("dc=example,dc=com", "uid", "*)(uid=alice", 2, "turnPassword")
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "the value should not be parsed as a filter")
+
+	assert.NoError(t, conn.Close())
+	<-done
+}
+
+func TestConnDisconnected(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(server)
+		_, _ = readElement(reader)
+
+		// Notice of Disconnection
+		msg := appendInteger(nil, tagInteger, 0)
+		msg = append(msg, ldapResult(tagExtendedResp, 52, "shutting down")...)
+		_, _ = server.Write(appendElement(nil, tagSequence, msg))
+		_ = server.Close()
+	}()
+
+	conn := NewConn(client)
+	assert.ErrorIs(t, conn.Bind("", ""), errDisconnected)
+	assert.NoError(t, client.Close())
+}
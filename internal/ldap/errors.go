@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errMalformed          = errors.New("malformed LDAP message")
+	errMessageTooLarge    = errors.New("LDAP message too large")
+	errUnexpectedResponse = errors.New("unexpected LDAP response")
+	errDisconnected       = errors.New("LDAP server closed the connection")
+)
+
+// Error is an LDAP operation that the server did not complete successfully
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.Code)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
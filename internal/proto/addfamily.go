@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"errors"
+
+	"github.com/pion/stun/v3"
+)
+
+// Attributes of dual allocations as defined in RFC 8656 Section 18.
+const (
+	AttrAdditionalAddressFamily stun.AttrType = 0x8000 // ADDITIONAL-ADDRESS-FAMILY
+	AttrAddressErrorCode        stun.AttrType = 0x8001 // ADDRESS-ERROR-CODE
+)
+
+// AdditionalAddressFamily represents the ADDITIONAL-ADDRESS-FAMILY attribute as
+// defined in RFC 8656 Section 18.11. It requests an IPv6 relayed transport
+// address in addition to the IPv4 one.
+type AdditionalAddressFamily byte
+
+var errInvalidAdditionalFamilyValue = errors.New("invalid value for additional address family attribute")
+
+// AddTo adds ADDITIONAL-ADDRESS-FAMILY to message.
+func (f AdditionalAddressFamily) AddTo(m *stun.Message) error {
+	v := make([]byte, requestedFamilySize)
+	v[0] = byte(f)
+	m.Add(AttrAdditionalAddressFamily, v)
+	return nil
+}
+
+// GetFrom decodes ADDITIONAL-ADDRESS-FAMILY from message.
+func (f *AdditionalAddressFamily) GetFrom(m *stun.Message) error {
+	v, err := m.Get(AttrAdditionalAddressFamily)
+	if err != nil {
+		return err
+	}
+	if err = stun.CheckSize(AttrAdditionalAddressFamily, len(v), requestedFamilySize); err != nil {
+		return err
+	}
+	// Only IPv6 may be requested additionally
+	if v[0] != byte(RequestedFamilyIPv6) {
+		return errInvalidAdditionalFamilyValue
+	}
+	*f = AdditionalAddressFamily(v[0])
+	return nil
+}
+
+// AddressErrorCode represents the ADDRESS-ERROR-CODE attribute as defined in
+// RFC 8656 Section 18.12. The server includes it in a success response when
+// it could not allocate a relayed transport address of the family.
+type AddressErrorCode struct {
+	Family RequestedAddressFamily
+	Code   stun.ErrorCode
+	Reason []byte
+}
+
+const addressErrorCodeHeaderSize = 4
+
+var errAddressErrorCodeTooShort = errors.New("ADDRESS-ERROR-CODE is too short")
+
+// AddTo adds ADDRESS-ERROR-CODE to message.
+func (c AddressErrorCode) AddTo(m *stun.Message) error {
+	v := make([]byte, addressErrorCodeHeaderSize+len(c.Reason))
+	v[0] = byte(c.Family)
+	v[2] = byte(c.Code / 100)
+	v[3] = byte(c.Code % 100)
+	copy(v[addressErrorCodeHeaderSize:], c.Reason)
+	m.Add(AttrAddressErrorCode, v)
+	return nil
+}
+
+// GetFrom decodes ADDRESS-ERROR-CODE from message.
+func (c *AddressErrorCode) GetFrom(m *stun.Message) error {
+	v, err := m.Get(AttrAddressErrorCode)
+	if err != nil {
+		return err
+	}
+	if len(v) < addressErrorCodeHeaderSize {
+		return errAddressErrorCodeTooShort
+	}
+	c.Family = RequestedAddressFamily(v[0])
+	c.Code = stun.ErrorCode(int(v[2]&0x07)*100 + int(v[3]))
+	c.Reason = append(c.Reason[:0], v[addressErrorCodeHeaderSize:]...)
+	return nil
+}
+
+func (c AddressErrorCode) String() string {
+	return c.Family.String() + ": " + stun.ErrorCodeAttribute{Code: c.Code, Reason: c.Reason}.String()
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/stun/v3"
+)
+
+func TestAdditionalAddressFamily(t *testing.T) {
+	m := new(stun.Message)
+	f := AdditionalAddressFamily(RequestedFamilyIPv6)
+	if err := f.AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteHeader()
+
+	decoded := new(stun.Message)
+	if _, err := decoded.Write(m.Raw); err != nil {
+		t.Fatal("failed to decode message:", err)
+	}
+	var got AdditionalAddressFamily
+	if err := got.GetFrom(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got != f {
+		t.Errorf("Decoded %d, expected %d", got, f)
+	}
+
+	t.Run("HandleErr", func(t *testing.T) {
+		m := new(stun.Message)
+		var handle AdditionalAddressFamily
+		if err := handle.GetFrom(m); !errors.Is(err, stun.ErrAttributeNotFound) {
+			t.Errorf("%v should be not found", err)
+		}
+		m.Add(AttrAdditionalAddressFamily, []byte{byte(RequestedFamilyIPv4), 0, 0, 0})
+		if err := handle.GetFrom(m); !errors.Is(err, errInvalidAdditionalFamilyValue) {
+			t.Errorf("IPv4 should be invalid: %v", err)
+		}
+	})
+}
+
+func TestAddressErrorCode(t *testing.T) {
+	m := new(stun.Message)
+	c := AddressErrorCode{
+		Family: RequestedFamilyIPv6,
+		Code:   stun.CodeInsufficientCapacity,
+		Reason: []byte("Insufficient Capacity"),
+	}
+	if err := c.AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteHeader()
+
+	decoded := new(stun.Message)
+	if _, err := decoded.Write(m.Raw); err != nil {
+		t.Fatal("failed to decode message:", err)
+	}
+	var got AddressErrorCode
+	if err := got.GetFrom(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != c.String() {
+		t.Errorf("Decoded %q, expected %q", got, c)
+	}
+	if got.String() != "IPv6: 508: Insufficient Capacity" {
+		t.Errorf("bad string %q", got)
+	}
+
+	t.Run("HandleErr", func(t *testing.T) {
+		m := new(stun.Message)
+		var handle AddressErrorCode
+		if err := handle.GetFrom(m); !errors.Is(err, stun.ErrAttributeNotFound) {
+			t.Errorf("%v should be not found", err)
+		}
+		m.Add(AttrAddressErrorCode, []byte{1, 2})
+		if err := handle.GetFrom(m); !errors.Is(err, errAddressErrorCodeTooShort) {
+			t.Errorf("%v should be too short", err)
+		}
+	})
+}
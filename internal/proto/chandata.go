@@ -71,6 +71,39 @@ func (c *ChannelData) Encode() {
 
 const padding = 4
 
+// ChannelDataHeaderSize is the size of the header of a ChannelData message.
+const ChannelDataHeaderSize = channelDataHeaderSize
+
+// EncodeChannelDataHeader writes the header of a ChannelData message carrying
+// length bytes on channel number to buf, which must fit ChannelDataHeaderSize
+// bytes. It lets callers send the data behind the header without copying it.
+func EncodeChannelDataHeader(buf []byte, number ChannelNumber, length int) {
+	_ = buf[:channelDataHeaderSize]
+	binary.BigEndian.PutUint16(buf[:channelDataNumberSize], uint16(number))
+	binary.BigEndian.PutUint16(buf[channelDataNumberSize:channelDataHeaderSize], uint16(length))
+}
+
+// EncodeChannelDataPrefix encodes a ChannelData message carrying length bytes on
+// channel number in place: buf holds the data behind ChannelDataHeaderSize bytes
+// left free for the header. The padding is written behind the data, within the
+// capacity of buf if it fits. The returned message is a view of buf then, so
+// relaying data read behind the prefix does not allocate.
+func EncodeChannelDataPrefix(buf []byte, number ChannelNumber, length int) []byte {
+	EncodeChannelDataHeader(buf, number, length)
+	buf = buf[:channelDataHeaderSize+length]
+	for i := ChannelDataPadding(length); i > 0; i-- {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// ChannelDataPadding returns how many zero bytes Encode appends to a
+// ChannelData message carrying length bytes.
+func ChannelDataPadding(length int) int {
+	l := channelDataHeaderSize + length
+	return nearestPaddedValueLength(l) - l
+}
+
 func nearestPaddedValueLength(l int) int {
 	n := padding * (l / padding)
 	if n < l {
@@ -98,7 +131,15 @@ func (c *ChannelData) WriteHeader() {
 // to actual data length.
 var ErrBadChannelDataLength = errors.New("channelData length != len(Data)")
 
-// Decode decodes The ChannelData Message from Raw.
+// DecodeChannelData decodes the ChannelData Message in buf. Raw and Data of the
+// result are views of buf, which must not change while they are used.
+func DecodeChannelData(buf []byte) (ChannelData, error) {
+	c := ChannelData{Raw: buf}
+	err := c.Decode()
+	return c, err
+}
+
+// Decode decodes The ChannelData Message from Raw. Data is a view of Raw.
 func (c *ChannelData) Decode() error {
 	buf := c.Raw
 	if len(buf) < channelDataHeaderSize {
@@ -31,6 +31,76 @@ func TestChannelData_Encode(t *testing.T) {
 	}
 }
 
+func TestEncodeChannelDataHeader(t *testing.T) {
+	for length := 0; length <= 8; length++ {
+		d := &ChannelData{
+			Data:   bytes.Repeat([]byte{1}, length),
+			Number: MinChannelNumber + 1,
+		}
+		d.Encode()
+
+		raw := make([]byte, ChannelDataHeaderSize)
+		EncodeChannelDataHeader(raw, d.Number, length)
+		raw = append(raw, d.Data...)
+		raw = append(raw, make([]byte, ChannelDataPadding(length))...)
+		if !bytes.Equal(raw, d.Raw) {
+			t.Errorf("length %d: %x != %x", length, raw, d.Raw)
+		}
+	}
+}
+
+func TestEncodeChannelDataPrefix(t *testing.T) {
+	for length := 0; length <= 8; length++ {
+		d := &ChannelData{
+			Data:   bytes.Repeat([]byte{1}, length),
+			Number: MinChannelNumber + 1,
+		}
+		d.Encode()
+
+		buf := make([]byte, ChannelDataHeaderSize+8+ChannelDataHeaderSize)
+		for i := range buf {
+			buf[i] = 0xff // The padding must be zeroed
+		}
+		copy(buf[ChannelDataHeaderSize:], d.Data)
+		raw := EncodeChannelDataPrefix(buf, d.Number, length)
+		if !bytes.Equal(raw, d.Raw) {
+			t.Errorf("length %d: %x != %x", length, raw, d.Raw)
+		}
+		if &raw[0] != &buf[0] {
+			t.Errorf("length %d: should be encoded in place", length)
+		}
+	}
+
+	// Without the capacity for the padding it is appended
+	buf := []byte{0, 0, 0, 0, 1}
+	raw := EncodeChannelDataPrefix(buf, MinChannelNumber, 1)
+	if !bytes.Equal(raw, []byte{0x40, 0, 0, 1, 1, 0, 0, 0}) {
+		t.Errorf("unexpected %x", raw)
+	}
+}
+
+func TestDecodeChannelData(t *testing.T) {
+	buf := []byte{0x40, 0, 0, 2, 1, 2, 0, 0}
+	d, err := DecodeChannelData(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Number != MinChannelNumber || !bytes.Equal(d.Data, []byte{1, 2}) {
+		t.Errorf("unexpected %+v", d)
+	}
+	if &d.Data[0] != &buf[ChannelDataHeaderSize] {
+		t.Error("data should be a view of the buffer")
+	}
+	if _, err := DecodeChannelData(buf[:3]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if allocs := testing.AllocsPerRun(10, func() {
+		_, _ = DecodeChannelData(buf)
+	}); allocs != 0 {
+		t.Errorf("decoding allocated %v times", allocs)
+	}
+}
+
 func TestChannelData_Equal(t *testing.T) {
 	for _, tc := range []struct {
 		name  string
@@ -197,6 +267,15 @@ func BenchmarkChannelData_Encode(b *testing.B) {
 	}
 }
 
+func BenchmarkEncodeChannelDataPrefix(b *testing.B) {
+	buf := make([]byte, channelDataHeaderSize+4+padding)
+	b.ReportAllocs()
+	b.SetBytes(4 + channelDataHeaderSize)
+	for i := 0; i < b.N; i++ {
+		EncodeChannelDataPrefix(buf, MinChannelNumber+1, 4)
+	}
+}
+
 func BenchmarkChannelData_Decode(b *testing.B) {
 	d := &ChannelData{
 		Data:   []byte{1, 2, 3, 4},
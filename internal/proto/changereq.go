@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pion/stun/v3"
+)
+
+// ChangeRequest represents CHANGE-REQUEST attribute.
+//
+// This attribute asks the server to send the response from another IP
+// address and/or port, which lets a client determine the filtering
+// behavior of its NAT.
+//
+// RFC 5780 Section 7.2
+type ChangeRequest struct {
+	ChangeIP   bool
+	ChangePort bool
+}
+
+func (c ChangeRequest) String() string {
+	return fmt.Sprintf("change IP: %t, change port: %t", c.ChangeIP, c.ChangePort)
+}
+
+const (
+	changeRequestSize = 4
+	changeIPFlag      = 0x04
+	changePortFlag    = 0x02
+)
+
+// AddTo adds CHANGE-REQUEST to message.
+func (c ChangeRequest) AddTo(m *stun.Message) error {
+	var flags uint32
+	if c.ChangeIP {
+		flags |= changeIPFlag
+	}
+	if c.ChangePort {
+		flags |= changePortFlag
+	}
+	v := make([]byte, changeRequestSize)
+	binary.BigEndian.PutUint32(v, flags)
+	m.Add(stun.AttrChangeRequest, v)
+	return nil
+}
+
+// GetFrom decodes CHANGE-REQUEST from message.
+func (c *ChangeRequest) GetFrom(m *stun.Message) error {
+	v, err := m.Get(stun.AttrChangeRequest)
+	if err != nil {
+		return err
+	}
+	if err = stun.CheckSize(stun.AttrChangeRequest, len(v), changeRequestSize); err != nil {
+		return err
+	}
+	flags := binary.BigEndian.Uint32(v)
+	c.ChangeIP = flags&changeIPFlag != 0
+	c.ChangePort = flags&changePortFlag != 0
+	return nil
+}
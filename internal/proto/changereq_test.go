@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pion/stun/v3"
+)
+
+func TestChangeRequest(t *testing.T) {
+	t.Run("AddTo", func(t *testing.T) {
+		for _, tc := range []struct {
+			req   ChangeRequest
+			value []byte
+		}{
+			{ChangeRequest{}, []byte{0, 0, 0, 0}},
+			{ChangeRequest{ChangePort: true}, []byte{0, 0, 0, 0x02}},
+			{ChangeRequest{ChangeIP: true, ChangePort: true}, []byte{0, 0, 0, 0x06}},
+		} {
+			m := new(stun.Message)
+			if err := tc.req.AddTo(m); err != nil {
+				t.Fatal(err)
+			}
+			m.WriteHeader()
+			v, err := m.Get(stun.AttrChangeRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(v, tc.value) {
+				t.Errorf("%s: %x != %x", tc.req, v, tc.value)
+			}
+
+			decoded := new(stun.Message)
+			if _, err := decoded.Write(m.Raw); err != nil {
+				t.Fatal("failed to decode message:", err)
+			}
+			var req ChangeRequest
+			if err := req.GetFrom(decoded); err != nil {
+				t.Fatal(err)
+			}
+			if req != tc.req {
+				t.Errorf("%s != %s", req, tc.req)
+			}
+		}
+	})
+	t.Run("HandleErr", func(t *testing.T) {
+		m := new(stun.Message)
+		var req ChangeRequest
+		if err := req.GetFrom(m); !errors.Is(err, stun.ErrAttributeNotFound) {
+			t.Errorf("%v should be not found", err)
+		}
+		m.Add(stun.AttrChangeRequest, []byte{1, 2, 3})
+		if !stun.IsAttrSizeInvalid(req.GetFrom(m)) {
+			t.Error("should error")
+		}
+	})
+}
@@ -3,7 +3,12 @@
 
 package proto
 
-import "github.com/pion/stun/v3"
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/pion/stun/v3"
+)
 
 // Data represents DATA attribute.
 //
@@ -31,3 +36,81 @@ func (d *Data) GetFrom(m *stun.Message) error {
 	*d = v
 	return nil
 }
+
+const (
+	magicCookie       = 0x2112A442
+	stunHeaderSize    = 20
+	attrHeaderSize    = 4
+	peerAddressV4Size = 8
+	peerAddressV6Size = 20
+)
+
+// MaxDataIndicationPrefixSize is the most room EncodeDataIndicationPrefix
+// needs in front of the data, for a peer with an IPv6 address.
+const MaxDataIndicationPrefixSize = stunHeaderSize + attrHeaderSize + peerAddressV6Size + attrHeaderSize
+
+// DataIndicationPrefixSize returns the room EncodeDataIndicationPrefix needs
+// in front of data from peer: the STUN header, XOR-PEER-ADDRESS and the header
+// of DATA.
+func DataIndicationPrefixSize(peer netip.Addr) int {
+	if peer.Unmap().Is4() {
+		return stunHeaderSize + attrHeaderSize + peerAddressV4Size + attrHeaderSize
+	}
+	return MaxDataIndicationPrefixSize
+}
+
+// EncodeDataIndicationPrefix encodes a Data indication carrying length bytes
+// from peer in place: buf holds the data behind DataIndicationPrefixSize bytes
+// left free for the header and attributes. The padding is written behind the
+// data, within the capacity of buf if it fits. The returned message is a view
+// of buf then, like with EncodeChannelDataPrefix, and equals the message built
+// with PeerAddress and Data.
+func EncodeDataIndicationPrefix(buf []byte, transactionID [stun.TransactionIDSize]byte, peer netip.AddrPort, length int) []byte {
+	addr := peer.Addr().Unmap()
+	addressSize := peerAddressV6Size
+	if addr.Is4() {
+		addressSize = peerAddressV4Size
+	}
+	prefix := stunHeaderSize + attrHeaderSize + addressSize + attrHeaderSize
+	padded := nearestPaddedValueLength(length)
+
+	t := stun.NewType(stun.MethodData, stun.ClassIndication)
+	binary.BigEndian.PutUint16(buf[0:2], t.Value())
+	binary.BigEndian.PutUint16(buf[2:4], uint16(prefix-stunHeaderSize+padded))
+	binary.BigEndian.PutUint32(buf[4:8], magicCookie)
+	copy(buf[8:stunHeaderSize], transactionID[:])
+
+	// XOR-PEER-ADDRESS, RFC 5389 Section 15.2
+	attr := buf[stunHeaderSize:]
+	binary.BigEndian.PutUint16(attr[0:2], uint16(stun.AttrXORPeerAddress))
+	binary.BigEndian.PutUint16(attr[2:4], uint16(addressSize))
+	value := attr[attrHeaderSize : attrHeaderSize+addressSize]
+	value[0] = 0
+	value[1] = 0x01 // IPv4
+	if !addr.Is4() {
+		value[1] = 0x02 // IPv6
+	}
+	binary.BigEndian.PutUint16(value[2:4], peer.Port()^uint16(magicCookie>>16))
+	ip := addr.As16()
+	if addr.Is4() {
+		v4 := addr.As4()
+		copy(ip[:], v4[:])
+	}
+	copy(value[4:], ip[:addressSize-4])
+	for i := range value[4:] {
+		// The address is XORed with the magic cookie and the transaction ID,
+		// which follow it in the header
+		value[4+i] ^= buf[4+i]
+	}
+
+	// DATA
+	attr = attr[attrHeaderSize+addressSize:]
+	binary.BigEndian.PutUint16(attr[0:2], uint16(stun.AttrData))
+	binary.BigEndian.PutUint16(attr[2:4], uint16(length))
+
+	buf = buf[:prefix+length]
+	for i := padded - length; i > 0; i-- {
+		buf = append(buf, 0)
+	}
+	return buf
+}
@@ -6,6 +6,8 @@ package proto
 import (
 	"bytes"
 	"errors"
+	"net"
+	"net/netip"
 	"testing"
 
 	"github.com/pion/stun/v3"
@@ -89,3 +91,34 @@ func TestData(t *testing.T) {
 		})
 	})
 }
+
+func TestEncodeDataIndicationPrefix(t *testing.T) {
+	transactionID := stun.NewTransactionID()
+	for _, peer := range []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.1:3478"),
+		netip.MustParseAddrPort("[2001:db8::1]:49152"),
+	} {
+		for length := 0; length <= 8; length++ {
+			data := Data(bytes.Repeat([]byte{1}, length))
+			m := new(stun.Message)
+			if err := m.Build(stun.NewTransactionIDSetter(transactionID), stun.NewType(stun.MethodData, stun.ClassIndication),
+				PeerAddress{IP: net.IP(peer.Addr().AsSlice()), Port: int(peer.Port())}, data); err != nil {
+				t.Fatal(err)
+			}
+
+			prefix := DataIndicationPrefixSize(peer.Addr())
+			buf := make([]byte, MaxDataIndicationPrefixSize+8+ChannelDataHeaderSize)
+			for i := range buf {
+				buf[i] = 0xff // The padding must be zeroed
+			}
+			copy(buf[prefix:], data)
+			raw := EncodeDataIndicationPrefix(buf, transactionID, peer, length)
+			if !bytes.Equal(raw, m.Raw) {
+				t.Errorf("%s length %d: %x != %x", peer, length, raw, m.Raw)
+			}
+			if &raw[0] != &buf[0] {
+				t.Errorf("%s length %d: should be encoded in place", peer, length)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"errors"
+
+	"github.com/pion/stun/v3"
+)
+
+var errInvalidIntegritySize = errors.New("HMAC of unexpected size")
+
+// ExternalIntegrity represents MESSAGE-INTEGRITY or MESSAGE-INTEGRITY-SHA256
+// attribute whose HMAC is computed and verified by functions instead of with
+// a key in memory, e.g. by an HSM holding the key.
+type ExternalIntegrity struct {
+	// SHA256 selects MESSAGE-INTEGRITY-SHA256 over MESSAGE-INTEGRITY
+	SHA256 bool
+
+	// Compute returns the HMAC of message
+	Compute func(message []byte) ([]byte, error)
+
+	// Verify tells if mac is the HMAC of message
+	Verify func(message, mac []byte) (bool, error)
+}
+
+func (i ExternalIntegrity) attr() (stun.AttrType, int) {
+	if i.SHA256 {
+		return stun.AttrMessageIntegritySHA256, sha256.Size
+	}
+	return stun.AttrMessageIntegrity, sha1.Size
+}
+
+// AddTo adds the integrity attribute to message.
+func (i ExternalIntegrity) AddTo(m *stun.Message) error {
+	attr, size := i.attr()
+	return addIntegrity(m, attr, size, i.Compute)
+}
+
+// Check checks the integrity attribute of message.
+func (i ExternalIntegrity) Check(m *stun.Message) error {
+	attr, _ := i.attr()
+	return checkIntegrity(m, attr, func(message, mac []byte) error {
+		ok, err := i.Verify(message, mac)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return stun.ErrIntegrityMismatch
+		}
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hmacIntegrity is an ExternalIntegrity computing the HMAC with key
+func hmacIntegrity(key []byte, sha256Attr bool) ExternalIntegrity {
+	h := sha1.New
+	if sha256Attr {
+		h = sha256.New
+	}
+	compute := func(message []byte) ([]byte, error) {
+		mac := hmac.New(h, key)
+		mac.Write(message) //nolint:errcheck,gosec
+		return mac.Sum(nil), nil
+	}
+	return ExternalIntegrity{
+		SHA256:  sha256Attr,
+		Compute: compute,
+		Verify: func(message, mac []byte) (bool, error) {
+			expected, _ := compute(message)
+			return hmac.Equal(mac, expected), nil
+		},
+	}
+}
+
+func TestExternalIntegrity(t *testing.T) {
+	key := []byte("key")
+
+	// It matches the integrity computed with the key in memory, both ways
+	for _, tc := range []struct {
+		name     string
+		external ExternalIntegrity
+		local    interface {
+			stun.Setter
+			Check(*stun.Message) error
+		}
+	}{
+		{"MessageIntegrity", hmacIntegrity(key, false), stun.MessageIntegrity(key)},
+		{"MessageIntegritySHA256", hmacIntegrity(key, true), MessageIntegritySHA256(key)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, signed := range []stun.Setter{tc.external, tc.local} {
+				m, err := stun.Build(stun.BindingRequest, stun.NewUsername("alice"), signed, stun.Fingerprint)
+				require.NoError(t, err)
+
+				decoded := new(stun.Message)
+				_, err = decoded.Write(m.Raw)
+				require.NoError(t, err)
+				assert.NoError(t, tc.external.Check(decoded))
+				assert.NoError(t, tc.local.Check(decoded))
+				assert.NoError(t, stun.Fingerprint.Check(decoded), "the length should be restored")
+				assert.ErrorIs(t, hmacIntegrity([]byte("other key"), tc.external.SHA256).Check(decoded), stun.ErrIntegrityMismatch)
+			}
+		})
+	}
+
+	errHSM := errors.New("hsm unavailable")
+	failing := ExternalIntegrity{
+		Compute: func([]byte) ([]byte, error) { return nil, errHSM },
+		Verify:  func([]byte, []byte) (bool, error) { return false, errHSM },
+	}
+	_, err := stun.Build(stun.BindingRequest, failing)
+	assert.ErrorIs(t, err, errHSM)
+	m, err := stun.Build(stun.BindingRequest, stun.MessageIntegrity(key))
+	require.NoError(t, err)
+	assert.ErrorIs(t, failing.Check(m), errHSM)
+
+	short := ExternalIntegrity{Compute: func([]byte) ([]byte, error) { return []byte{1}, nil }}
+	_, err = stun.Build(stun.BindingRequest, short)
+	assert.ErrorIs(t, err, errInvalidIntegritySize)
+}
@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sync"
+
+	"github.com/pion/stun/v3"
+)
+
+// PasswordAlgorithm represents PASSWORD-ALGORITHM attribute.
+//
+// The PASSWORD-ALGORITHM attribute is present only in requests. It
+// contains the algorithm that the server must use to derive a key from
+// the long-term password.
+//
+// RFC 8489 Section 14.12
+type PasswordAlgorithm uint16
+
+// Password algorithms, see RFC 8489 Section 18.5.
+const (
+	PasswordAlgorithmMD5    PasswordAlgorithm = 0x0001
+	PasswordAlgorithmSHA256 PasswordAlgorithm = 0x0002
+)
+
+const passwordAlgorithmHeaderSize = 4 // algorithm and parameters length: 2 bytes each
+
+func (a PasswordAlgorithm) String() string {
+	switch a {
+	case PasswordAlgorithmMD5:
+		return "MD5"
+	case PasswordAlgorithmSHA256:
+		return "SHA-256"
+	default:
+		return "unknown"
+	}
+}
+
+// AddTo adds PASSWORD-ALGORITHM to message.
+func (a PasswordAlgorithm) AddTo(m *stun.Message) error {
+	v := make([]byte, passwordAlgorithmHeaderSize)
+	binary.BigEndian.PutUint16(v, uint16(a))
+	m.Add(stun.AttrPasswordAlgorithm, v)
+	return nil
+}
+
+// GetFrom decodes PASSWORD-ALGORITHM from message. Parameters of the
+// algorithm are ignored, neither MD5 nor SHA-256 have any.
+func (a *PasswordAlgorithm) GetFrom(m *stun.Message) error {
+	v, err := m.Get(stun.AttrPasswordAlgorithm)
+	if err != nil {
+		return err
+	}
+	if len(v) < passwordAlgorithmHeaderSize {
+		return errInvalidPasswordAlgorithms
+	}
+	*a = PasswordAlgorithm(binary.BigEndian.Uint16(v))
+	return nil
+}
+
+// PasswordAlgorithms represents PASSWORD-ALGORITHMS attribute.
+//
+// The PASSWORD-ALGORITHMS attribute may be present in requests and
+// responses. It contains the list of algorithms that the server can use
+// to derive the long-term password, in order of preference.
+//
+// RFC 8489 Section 14.11
+type PasswordAlgorithms []PasswordAlgorithm
+
+var errInvalidPasswordAlgorithms = errors.New("invalid PASSWORD-ALGORITHMS")
+
+// AddTo adds PASSWORD-ALGORITHMS to message.
+func (a PasswordAlgorithms) AddTo(m *stun.Message) error {
+	v := make([]byte, passwordAlgorithmHeaderSize*len(a))
+	for i, algorithm := range a {
+		binary.BigEndian.PutUint16(v[i*passwordAlgorithmHeaderSize:], uint16(algorithm))
+	}
+	m.Add(stun.AttrPasswordAlgorithms, v)
+	return nil
+}
+
+// GetFrom decodes PASSWORD-ALGORITHMS from message.
+func (a *PasswordAlgorithms) GetFrom(m *stun.Message) error {
+	v, err := m.Get(stun.AttrPasswordAlgorithms)
+	if err != nil {
+		return err
+	}
+	var algorithms PasswordAlgorithms
+	for len(v) > 0 {
+		if len(v) < passwordAlgorithmHeaderSize {
+			return errInvalidPasswordAlgorithms
+		}
+		algorithms = append(algorithms, PasswordAlgorithm(binary.BigEndian.Uint16(v)))
+		paramsLength := int(binary.BigEndian.Uint16(v[2:]))
+		paramsLength += (4 - paramsLength%4) % 4 // Parameters are padded to 32 bits
+		if len(v) < passwordAlgorithmHeaderSize+paramsLength {
+			return errInvalidPasswordAlgorithms
+		}
+		v = v[passwordAlgorithmHeaderSize+paramsLength:]
+	}
+	*a = algorithms
+	return nil
+}
+
+// Equal tells if both lists contain the same algorithms in the same order.
+func (a PasswordAlgorithms) Equal(b PasswordAlgorithms) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains tells if the list contains the algorithm.
+func (a PasswordAlgorithms) Contains(algorithm PasswordAlgorithm) bool {
+	for _, other := range a {
+		if other == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageIntegritySHA256 represents MESSAGE-INTEGRITY-SHA256 attribute,
+// the key it signs and checks messages with.
+//
+// The MESSAGE-INTEGRITY-SHA256 attribute contains an HMAC-SHA256 of the
+// STUN message, like MESSAGE-INTEGRITY contains an HMAC-SHA1 of it.
+//
+// RFC 8489 Section 14.6
+type MessageIntegritySHA256 []byte
+
+const (
+	messageHeaderSize   = 20
+	attributeHeaderSize = 4
+)
+
+// AddTo adds MESSAGE-INTEGRITY-SHA256 to message.
+func (i MessageIntegritySHA256) AddTo(m *stun.Message) error {
+	h := hmacSHA256Pool.Get().(*hmacSHA256) //nolint:forcetypeassert
+	defer hmacSHA256Pool.Put(h)
+	return addIntegrity(m, stun.AttrMessageIntegritySHA256, sha256.Size, func(message []byte) ([]byte, error) {
+		return h.sum(i, message), nil
+	})
+}
+
+// Check checks MESSAGE-INTEGRITY-SHA256 attribute.
+func (i MessageIntegritySHA256) Check(m *stun.Message) error {
+	h := hmacSHA256Pool.Get().(*hmacSHA256) //nolint:forcetypeassert
+	defer hmacSHA256Pool.Put(h)
+	return checkIntegrity(m, stun.AttrMessageIntegritySHA256, func(message, mac []byte) error {
+		if !hmac.Equal(mac, h.sum(i, message)) {
+			return stun.ErrIntegrityMismatch
+		}
+		return nil
+	})
+}
+
+// addIntegrity adds the integrity attribute with the HMAC of the message
+func addIntegrity(m *stun.Message, attr stun.AttrType, size int, mac func(message []byte) ([]byte, error)) error {
+	for _, a := range m.Attributes {
+		if a.Type == stun.AttrFingerprint {
+			return stun.ErrFingerprintBeforeIntegrity
+		}
+	}
+	// The HMAC covers the message up to the attribute, with the length in
+	// the header already including it
+	length := m.Length
+	m.Length += uint32(size + attributeHeaderSize)
+	m.WriteLength()
+	v, err := mac(m.Raw)
+	m.Length = length
+	m.WriteLength()
+	if err != nil {
+		return err
+	}
+	if len(v) != size {
+		return errInvalidIntegritySize
+	}
+
+	m.Add(attr, v)
+	return nil
+}
+
+// checkIntegrity calls verify with the part of the message the integrity
+// attribute covers and its HMAC
+func checkIntegrity(m *stun.Message, attr stun.AttrType, verify func(message, mac []byte) error) error {
+	v, err := m.Get(attr)
+	if err != nil {
+		return err
+	}
+
+	// Attributes after the integrity, i.e. FINGERPRINT, are not covered by
+	// the length in the header either
+	var (
+		length           = m.Length
+		afterIntegrity   = false
+		sizeReduced      uint32
+		integrityPadding = (4 - len(v)%4) % 4
+	)
+	for _, a := range m.Attributes {
+		if afterIntegrity {
+			sizeReduced += uint32(attributeHeaderSize + int(a.Length) + (4-int(a.Length)%4)%4)
+		}
+		if a.Type == attr {
+			afterIntegrity = true
+		}
+	}
+	m.Length -= sizeReduced
+	m.WriteLength()
+	startOfHMAC := messageHeaderSize + int(m.Length) - attributeHeaderSize - len(v) - integrityPadding
+	err = verify(m.Raw[:startOfHMAC], v)
+	m.Length = length
+	m.WriteLength()
+	return err
+}
+
+// hmacSHA256Pool holds the hashes and scratch buffers of HMAC-SHA256, which
+// crypto/hmac allocates for every key
+var hmacSHA256Pool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return &hmacSHA256{inner: sha256.New(), outer: sha256.New()}
+	},
+}
+
+type hmacSHA256 struct {
+	inner, outer hash.Hash
+	pad          [sha256.BlockSize]byte
+	mac          [sha256.Size]byte
+}
+
+// sum returns the HMAC of message with key, valid until h is used again.
+// See RFC 2104.
+func (h *hmacSHA256) sum(key, message []byte) []byte {
+	if len(key) > sha256.BlockSize {
+		h.inner.Reset()
+		h.inner.Write(key) //nolint:errcheck,gosec
+		key = h.inner.Sum(h.mac[:0])
+	}
+	h.pad = [sha256.BlockSize]byte{}
+	copy(h.pad[:], key)
+	for i := range h.pad {
+		h.pad[i] ^= 0x36
+	}
+	h.inner.Reset()
+	h.inner.Write(h.pad[:]) //nolint:errcheck,gosec
+	h.inner.Write(message)  //nolint:errcheck,gosec
+	for i := range h.pad {
+		h.pad[i] ^= 0x36 ^ 0x5c
+	}
+	h.outer.Reset()
+	h.outer.Write(h.pad[:])               //nolint:errcheck,gosec
+	h.outer.Write(h.inner.Sum(h.mac[:0])) //nolint:errcheck,gosec
+	return h.outer.Sum(h.mac[:0])
+}
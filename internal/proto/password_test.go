@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordAlgorithms(t *testing.T) {
+	m, err := stun.Build(stun.BindingRequest,
+		PasswordAlgorithms{PasswordAlgorithmSHA256, PasswordAlgorithmMD5},
+		PasswordAlgorithmSHA256,
+	)
+	require.NoError(t, err)
+
+	decoded := new(stun.Message)
+	_, err = decoded.Write(m.Raw)
+	require.NoError(t, err)
+
+	var algorithms PasswordAlgorithms
+	assert.NoError(t, algorithms.GetFrom(decoded))
+	assert.Equal(t, PasswordAlgorithms{PasswordAlgorithmSHA256, PasswordAlgorithmMD5}, algorithms)
+	assert.True(t, algorithms.Equal(PasswordAlgorithms{PasswordAlgorithmSHA256, PasswordAlgorithmMD5}))
+	assert.False(t, algorithms.Equal(PasswordAlgorithms{PasswordAlgorithmMD5, PasswordAlgorithmSHA256}))
+	assert.True(t, algorithms.Contains(PasswordAlgorithmMD5))
+
+	var algorithm PasswordAlgorithm
+	assert.NoError(t, algorithm.GetFrom(decoded))
+	assert.Equal(t, PasswordAlgorithmSHA256, algorithm)
+	assert.Equal(t, "SHA-256", algorithm.String())
+
+	t.Run("Parameters", func(t *testing.T) {
+		m := new(stun.Message)
+		// An unknown algorithm with 3 bytes of parameters, padded to 4
+		m.Add(stun.AttrPasswordAlgorithms, []byte{0x00, 0x07, 0x00, 0x03, 1, 2, 3, 0, 0x00, 0x01, 0x00, 0x00})
+		var algorithms PasswordAlgorithms
+		assert.NoError(t, algorithms.GetFrom(m))
+		assert.Equal(t, PasswordAlgorithms{7, PasswordAlgorithmMD5}, algorithms)
+
+		m.Reset()
+		m.Add(stun.AttrPasswordAlgorithms, []byte{0x00, 0x01, 0x00, 0x04})
+		assert.ErrorIs(t, algorithms.GetFrom(m), errInvalidPasswordAlgorithms)
+	})
+}
+
+func TestMessageIntegritySHA256(t *testing.T) {
+	integrity := MessageIntegritySHA256("key")
+	m, err := stun.Build(stun.BindingRequest, stun.NewUsername("alice"), integrity, stun.Fingerprint)
+	require.NoError(t, err)
+
+	decoded := new(stun.Message)
+	_, err = decoded.Write(m.Raw)
+	require.NoError(t, err)
+	assert.NoError(t, integrity.Check(decoded))
+	assert.NoError(t, stun.Fingerprint.Check(decoded), "the length should be restored")
+	assert.ErrorIs(t, MessageIntegritySHA256("other key").Check(decoded), stun.ErrIntegrityMismatch)
+
+	_, err = stun.Build(stun.BindingRequest, stun.Fingerprint, integrity)
+	assert.ErrorIs(t, err, stun.ErrFingerprintBeforeIntegrity)
+
+	// Tampering with a covered attribute breaks it
+	decoded.Raw[len(decoded.Raw)-48] ^= 1
+	_, err = decoded.Write(decoded.Raw)
+	require.NoError(t, err)
+	assert.ErrorIs(t, integrity.Check(decoded), stun.ErrIntegrityMismatch)
+}
+
+func TestHMACSHA256(t *testing.T) {
+	h := hmacSHA256Pool.Get().(*hmacSHA256) //nolint:forcetypeassert
+	defer hmacSHA256Pool.Put(h)
+
+	message := []byte("message")
+	// Keys longer than a block are hashed first
+	for _, size := range []int{0, 16, sha256.BlockSize, sha256.BlockSize + 1} {
+		key := bytes.Repeat([]byte{1}, size)
+		mac := hmac.New(sha256.New, key)
+		mac.Write(message) //nolint:errcheck,gosec
+		assert.Equal(t, mac.Sum(nil), h.sum(key, message), size)
+	}
+}
+
+func TestHMACSHA256Allocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+
+	integrity := MessageIntegritySHA256("key")
+	m, err := stun.Build(stun.BindingRequest, stun.NewUsername("alice"))
+	require.NoError(t, err)
+	length := len(m.Raw)
+	assert.Zero(t, testing.AllocsPerRun(10, func() {
+		m.Raw, m.Length = m.Raw[:length], uint32(length-messageHeaderSize)
+		m.Attributes = m.Attributes[:1]
+		m.WriteLength()
+		_ = integrity.AddTo(m)
+		_ = integrity.Check(m)
+	}))
+}
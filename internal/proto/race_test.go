@@ -0,0 +1,10 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build race
+// +build race
+
+package proto
+
+// raceEnabled tells whether the race detector, which allocates, instruments the tests
+const raceEnabled = true
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// Client sends requests to a RADIUS server over UDP
+type Client struct {
+	// Addr is the host:port of the server
+	Addr string
+	// Secret is shared with the server
+	Secret []byte
+	// Timeout is how long to wait for a response to every attempt
+	Timeout time.Duration
+	// Retries is how often a request is sent again when it is not answered
+	Retries int
+}
+
+// Exchange sends the request and returns the response to it. Datagrams that are
+// not a valid response to the request are ignored.
+func (c *Client) Exchange(request *Packet) (*Packet, error) {
+	b, err := request.Encode(c.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every exchange uses a socket of its own, so identifiers never collide
+	conn, err := net.Dial("udp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	buf := make([]byte, maxPacketSize)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err = conn.Write(b); err != nil {
+			return nil, err
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(buf)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			response, err := Decode(buf[:n])
+			if err != nil || response.Identifier != request.Identifier {
+				continue
+			}
+			if err := VerifyResponse(buf[:n], request, c.Secret); err != nil {
+				continue
+			}
+			return response, nil
+		}
+	}
+	return nil, errNoResponse
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientExchange(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, maxPacketSize)
+		for attempt := 0; ; attempt++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := Decode(buf[:n])
+			if !assert.NoError(t, err) || !assert.NoError(t, VerifyRequest(buf[:n], testSecret)) {
+				return
+			}
+			if attempt == 0 {
+				continue // Lost, the client must retry
+			}
+
+			// A response signed with another secret, then the real one
+			for _, secret := range [][]byte{[]byte("wrong"), testSecret} {
+				b, err := (&Packet{Code: CodeAccountingResponse}).EncodeResponse(request, secret)
+				assert.NoError(t, err)
+				_, err = conn.WriteTo(b, addr)
+				assert.NoError(t, err)
+			}
+		}
+	}()
+
+	client := &Client{
+		Addr:    conn.LocalAddr().String(),
+		Secret:  testSecret,
+		Timeout: 100 * time.Millisecond,
+		Retries: 1,
+	}
+	request, err := NewRequest(CodeAccountingRequest)
+	require.NoError(t, err)
+	request.AddUint32(AcctStatusType, StatusStop)
+	response, err := client.Exchange(request)
+	require.NoError(t, err)
+	assert.Equal(t, CodeAccountingResponse, response.Code)
+
+	assert.NoError(t, conn.Close())
+	<-done
+
+	client.Retries = 0
+	_, err = client.Exchange(request)
+	assert.Error(t, err)
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import "errors"
+
+var (
+	errMalformed            = errors.New("malformed RADIUS packet")
+	errPacketTooLarge       = errors.New("RADIUS packet too large")
+	errAttributeTooLarge    = errors.New("RADIUS attribute too large")
+	errInvalidAuthenticator = errors.New("invalid RADIUS authenticator")
+	errMalformedPassword    = errors.New("malformed RADIUS Tunnel-Password")
+	errNoResponse           = errors.New("no response from RADIUS server")
+)
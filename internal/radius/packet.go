@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package radius implements the parts of RADIUS (RFC 2865) and RADIUS
+// Accounting (RFC 2866) needed to authenticate and account for TURN users
+package radius
+
+import (
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"encoding/binary"
+)
+
+const (
+	headerSize        = 20
+	authenticatorSize = 16
+	maxPacketSize     = 4096
+	maxAttributeSize  = 253
+)
+
+var zeroAuthenticator [authenticatorSize]byte //nolint:gochecknoglobals
+
+// Code is the type of a packet
+type Code byte
+
+// Packet types, RFC 2865 section 3 and RFC 2866 section 3
+const (
+	CodeAccessRequest      Code = 1
+	CodeAccessAccept       Code = 2
+	CodeAccessReject       Code = 3
+	CodeAccountingRequest  Code = 4
+	CodeAccountingResponse Code = 5
+	CodeAccessChallenge    Code = 11
+)
+
+// AttributeType is the type of an attribute
+type AttributeType byte
+
+// Attribute types, RFC 2865 section 5, RFC 2866 section 5, RFC 2868 and RFC 3579
+const (
+	UserName             AttributeType = 1
+	ServiceType          AttributeType = 6
+	CalledStationID      AttributeType = 30
+	CallingStationID     AttributeType = 31
+	NASIdentifier        AttributeType = 32
+	AcctStatusType       AttributeType = 40
+	AcctInputOctets      AttributeType = 42
+	AcctOutputOctets     AttributeType = 43
+	AcctSessionID        AttributeType = 44
+	AcctSessionTime      AttributeType = 46
+	AcctInputPackets     AttributeType = 47
+	AcctOutputPackets    AttributeType = 48
+	AcctInputGigawords   AttributeType = 52
+	AcctOutputGigawords  AttributeType = 53
+	TunnelPassword       AttributeType = 69
+	MessageAuthenticator AttributeType = 80
+)
+
+// Values of ServiceType and AcctStatusType
+const (
+	ServiceTypeAuthorizeOnly = 17
+	StatusStart              = 1
+	StatusStop               = 2
+	StatusInterimUpdate      = 3
+)
+
+// Attribute is an attribute of a packet
+type Attribute struct {
+	Type  AttributeType
+	Value []byte
+}
+
+// Packet is a RADIUS packet
+type Packet struct {
+	Code          Code
+	Identifier    byte
+	Authenticator [authenticatorSize]byte
+	Attributes    []Attribute
+}
+
+// NewRequest returns a request with a random identifier and Request Authenticator
+func NewRequest(code Code) (*Packet, error) {
+	p := &Packet{Code: code}
+	var random [1 + authenticatorSize]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return nil, err
+	}
+	p.Identifier = random[0]
+	copy(p.Authenticator[:], random[1:])
+	return p, nil
+}
+
+// Add appends an attribute
+func (p *Packet) Add(t AttributeType, value []byte) {
+	p.Attributes = append(p.Attributes, Attribute{Type: t, Value: value})
+}
+
+// AddString appends a text attribute
+func (p *Packet) AddString(t AttributeType, value string) {
+	p.Add(t, []byte(value))
+}
+
+// AddUint32 appends an integer attribute
+func (p *Packet) AddUint32(t AttributeType, value uint32) {
+	p.Add(t, binary.BigEndian.AppendUint32(nil, value))
+}
+
+// Get returns the value of the first attribute of type t
+func (p *Packet) Get(t AttributeType) ([]byte, bool) {
+	for _, a := range p.Attributes {
+		if a.Type == t {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GetUint32 returns the value of the first integer attribute of type t
+func (p *Packet) GetUint32(t AttributeType) (uint32, bool) {
+	v, ok := p.Get(t)
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+// Encode serializes a request. An Accounting-Request gets its Request
+// Authenticator from the secret (RFC 2866, section 3), a Message-Authenticator
+// attribute (RFC 3579, section 3.2) is signed with it.
+func (p *Packet) Encode(secret []byte) ([]byte, error) {
+	b, err := p.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if p.Code != CodeAccountingRequest {
+		signMessageAuthenticator(b, secret)
+		return b, nil
+	}
+
+	// Signed like a response to a request with a zero authenticator
+	copy(b[4:headerSize], zeroAuthenticator[:])
+	signMessageAuthenticator(b, secret)
+	sum := authenticator(b, secret)
+	copy(p.Authenticator[:], sum)
+	copy(b[4:headerSize], sum)
+	return b, nil
+}
+
+// EncodeResponse serializes a response to request, signing its Response
+// Authenticator and Message-Authenticator (RFC 2865, section 3)
+func (p *Packet) EncodeResponse(request *Packet, secret []byte) ([]byte, error) {
+	p.Identifier = request.Identifier
+	p.Authenticator = request.Authenticator
+	b, err := p.marshal()
+	if err != nil {
+		return nil, err
+	}
+	signMessageAuthenticator(b, secret)
+	sum := authenticator(b, secret)
+	copy(p.Authenticator[:], sum)
+	copy(b[4:headerSize], sum)
+	return b, nil
+}
+
+func (p *Packet) marshal() ([]byte, error) {
+	b := make([]byte, headerSize, maxPacketSize)
+	b[0] = byte(p.Code)
+	b[1] = p.Identifier
+	copy(b[4:headerSize], p.Authenticator[:])
+	for _, a := range p.Attributes {
+		if len(a.Value) > maxAttributeSize {
+			return nil, errAttributeTooLarge
+		}
+		value := a.Value
+		if a.Type == MessageAuthenticator {
+			value = make([]byte, md5.Size) // Signed once the packet is complete
+		}
+		b = append(b, byte(a.Type), byte(2+len(value)))
+		b = append(b, value...)
+	}
+	if len(b) > maxPacketSize {
+		return nil, errPacketTooLarge
+	}
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	return b, nil
+}
+
+// Decode parses a packet without verifying it, see VerifyRequest and VerifyResponse
+func Decode(b []byte) (*Packet, error) {
+	b, err := trim(b)
+	if err != nil {
+		return nil, err
+	}
+	p := &Packet{Code: Code(b[0]), Identifier: b[1]}
+	copy(p.Authenticator[:], b[4:headerSize])
+	for attributes := b[headerSize:]; len(attributes) > 0; {
+		if len(attributes) < 2 || attributes[1] < 2 || int(attributes[1]) > len(attributes) {
+			return nil, errMalformed
+		}
+		p.Add(AttributeType(attributes[0]), append([]byte(nil), attributes[2:attributes[1]]...))
+		attributes = attributes[attributes[1]:]
+	}
+	return p, nil
+}
+
+// VerifyRequest checks the Request Authenticator of an Accounting-Request and the
+// Message-Authenticator of any request, if present
+func VerifyRequest(b []byte, secret []byte) error {
+	b, err := trim(b)
+	if err != nil {
+		return err
+	}
+	if Code(b[0]) != CodeAccountingRequest {
+		return verifyMessageAuthenticator(b, nil, secret)
+	}
+
+	signed := append([]byte(nil), b...)
+	copy(signed[4:headerSize], zeroAuthenticator[:])
+	if !hmac.Equal(authenticator(signed, secret), b[4:headerSize]) {
+		return errInvalidAuthenticator
+	}
+	return verifyMessageAuthenticator(b, zeroAuthenticator[:], secret)
+}
+
+// VerifyResponse checks the Response Authenticator of a response to request,
+// and its Message-Authenticator if present
+func VerifyResponse(b []byte, request *Packet, secret []byte) error {
+	b, err := trim(b)
+	if err != nil {
+		return err
+	}
+	signed := append([]byte(nil), b...)
+	copy(signed[4:headerSize], request.Authenticator[:])
+	if !hmac.Equal(authenticator(signed, secret), b[4:headerSize]) {
+		return errInvalidAuthenticator
+	}
+	return verifyMessageAuthenticator(b, request.Authenticator[:], secret)
+}
+
+// trim returns the packet without the bytes following its length
+func trim(b []byte) ([]byte, error) {
+	if len(b) < headerSize {
+		return nil, errMalformed
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < headerSize || length > len(b) {
+		return nil, errMalformed
+	}
+	return b[:length], nil
+}
+
+// authenticator returns MD5(Code+Identifier+Length+Authenticator+Attributes+Secret)
+func authenticator(b []byte, secret []byte) []byte {
+	h := md5.New()  //nolint:gosec
+	h.Write(b)      //nolint:errcheck,gosec
+	h.Write(secret) //nolint:errcheck,gosec
+	return h.Sum(nil)
+}
+
+// messageAuthenticator returns the offset of the value of the Message-Authenticator of
+// an encoded packet, or -1
+func messageAuthenticator(b []byte) int {
+	for offset := headerSize; offset+2 <= len(b) && b[offset+1] >= 2; offset += int(b[offset+1]) {
+		if AttributeType(b[offset]) == MessageAuthenticator && b[offset+1] == 2+md5.Size && offset+2+md5.Size <= len(b) {
+			return offset + 2
+		}
+	}
+	return -1
+}
+
+// signMessageAuthenticator sets the Message-Authenticator of the encoded packet to
+// its HMAC-MD5 with the attribute zeroed, if it has one
+func signMessageAuthenticator(b []byte, secret []byte) {
+	if offset := messageAuthenticator(b); offset >= 0 {
+		mac := hmac.New(md5.New, secret)
+		mac.Write(b) //nolint:errcheck,gosec
+		copy(b[offset:], mac.Sum(nil))
+	}
+}
+
+// verifyMessageAuthenticator checks the Message-Authenticator of the encoded
+// packet, if present. Responses and Accounting-Requests are signed with another
+// authenticator in place of their own.
+func verifyMessageAuthenticator(b []byte, requestAuthenticator []byte, secret []byte) error {
+	offset := messageAuthenticator(b)
+	if offset < 0 {
+		return nil
+	}
+	signed := append([]byte(nil), b...)
+	copy(signed[offset:offset+md5.Size], make([]byte, md5.Size))
+	if requestAuthenticator != nil {
+		copy(signed[4:headerSize], requestAuthenticator)
+	}
+	mac := hmac.New(md5.New, secret)
+	mac.Write(signed) //nolint:errcheck,gosec
+	if !hmac.Equal(mac.Sum(nil), b[offset:offset+md5.Size]) {
+		return errInvalidAuthenticator
+	}
+	return nil
+}
+
+// EncryptTunnelPassword returns the value of a Tunnel-Password attribute with tag
+// zero for a response to a request with requestAuthenticator (RFC 2868, section 3.5)
+func EncryptTunnelPassword(password string, secret []byte, requestAuthenticator [authenticatorSize]byte) ([]byte, error) {
+	plain := append([]byte{byte(len(password))}, password...)
+	if len(plain)%md5.Size != 0 {
+		plain = append(plain, make([]byte, md5.Size-len(plain)%md5.Size)...)
+	}
+	if 3+len(plain) > maxAttributeSize {
+		return nil, errAttributeTooLarge
+	}
+
+	value := make([]byte, 3, 3+len(plain))
+	if _, err := rand.Read(value[1:3]); err != nil {
+		return nil, err
+	}
+	value[1] |= 0x80 // The most significant bit of the salt must be set
+	return append(value, tunnelPasswordCipher(plain, secret, requestAuthenticator[:], value[1:3], true)...), nil
+}
+
+// DecryptTunnelPassword returns the password of a Tunnel-Password attribute of a
+// response to a request with requestAuthenticator
+func DecryptTunnelPassword(value []byte, secret []byte, requestAuthenticator [authenticatorSize]byte) (string, error) {
+	if len(value) < 3+md5.Size || (len(value)-3)%md5.Size != 0 {
+		return "", errMalformedPassword
+	}
+	plain := tunnelPasswordCipher(value[3:], secret, requestAuthenticator[:], value[1:3], false)
+	if int(plain[0]) > len(plain)-1 {
+		return "", errMalformedPassword
+	}
+	return string(plain[1 : 1+plain[0]]), nil
+}
+
+// tunnelPasswordCipher XORs every 16 byte block with MD5(secret + previous ciphertext
+// block), starting with MD5(secret + requestAuthenticator + salt)
+func tunnelPasswordCipher(in, secret, requestAuthenticator, salt []byte, encrypt bool) []byte {
+	out := make([]byte, len(in))
+	previous := append(append([]byte(nil), requestAuthenticator...), salt...)
+	for i := 0; i < len(in); i += md5.Size {
+		h := md5.New()    //nolint:gosec
+		h.Write(secret)   //nolint:errcheck,gosec
+		h.Write(previous) //nolint:errcheck,gosec
+		pad := h.Sum(nil)
+		for j := range pad {
+			out[i+j] = in[i+j] ^ pad[j]
+		}
+		if encrypt {
+			previous = out[i : i+md5.Size]
+		} else {
+			previous = in[i : i+md5.Size]
+		}
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package radius
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("xyzzy5461") //nolint:gochecknoglobals
+
+func TestAccessRequest(t *testing.T) {
+	request, err := NewRequest(CodeAccessRequest)
+	require.NoError(t, err)
+	request.AddString(UserName, "alice")
+	request.AddUint32(ServiceType, ServiceTypeAuthorizeOnly)
+	request.Add(MessageAuthenticator, nil)
+	b, err := request.Encode(testSecret)
+	require.NoError(t, err)
+	assert.NoError(t, VerifyRequest(b, testSecret))
+	assert.ErrorIs(t, VerifyRequest(b, []byte("wrong")), errInvalidAuthenticator)
+
+	decoded, err := Decode(b)
+	require.NoError(t, err)
+	assert.Equal(t, request.Identifier, decoded.Identifier)
+	assert.Equal(t, request.Authenticator, decoded.Authenticator)
+	userName, ok := decoded.Get(UserName)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", string(userName))
+	serviceType, ok := decoded.GetUint32(ServiceType)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(ServiceTypeAuthorizeOnly), serviceType)
+
+	response := &Packet{Code: CodeAccessAccept}
+	response.Add(MessageAuthenticator, nil)
+	b, err = response.EncodeResponse(decoded, testSecret)
+	require.NoError(t, err)
+	assert.NoError(t, VerifyResponse(b, request, testSecret))
+	assert.ErrorIs(t, VerifyResponse(b, request, []byte("wrong")), errInvalidAuthenticator)
+
+	// A tampered Message-Authenticator
+	b[len(b)-1] ^= 1
+	assert.ErrorIs(t, VerifyResponse(b, request, testSecret), errInvalidAuthenticator)
+}
+
+func TestAccountingRequest(t *testing.T) {
+	request, err := NewRequest(CodeAccountingRequest)
+	require.NoError(t, err)
+	request.AddUint32(AcctStatusType, StatusStart)
+	request.AddString(AcctSessionID, "1")
+	b, err := request.Encode(testSecret)
+	require.NoError(t, err)
+	assert.NoError(t, VerifyRequest(b, testSecret))
+
+	b[len(b)-1] = '2'
+	assert.ErrorIs(t, VerifyRequest(b, testSecret), errInvalidAuthenticator)
+}
+
+func TestDecode(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{1, 0, 0, 19, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{1, 0, 0, 22, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		{1, 0, 0, 22, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 3},
+		{1, 0, 0, 22, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1},
+	} {
+		_, err := Decode(b)
+		assert.ErrorIs(t, err, errMalformed, b)
+	}
+
+	// Bytes past the length are padding
+	p, err := Decode([]byte{2, 7, 0, 23, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 3, 'a', 0xff})
+	require.NoError(t, err)
+	assert.Equal(t, []Attribute{{Type: UserName, Value: []byte("a")}}, p.Attributes)
+}
+
+func TestTunnelPassword(t *testing.T) {
+	request, err := NewRequest(CodeAccessRequest)
+	require.NoError(t, err)
+
+	for _, password := range []string{"", "pass", "a password of more than sixteen bytes"} {
+		value, err := EncryptTunnelPassword(password, testSecret, request.Authenticator)
+		require.NoError(t, err)
+		assert.Zero(t, (len(value)-3)%16)
+
+		actual, err := DecryptTunnelPassword(value, testSecret, request.Authenticator)
+		assert.NoError(t, err)
+		assert.Equal(t, password, actual)
+	}
+
+	_, err = DecryptTunnelPassword([]byte{0, 0x80, 1, 2}, testSecret, request.Authenticator)
+	assert.ErrorIs(t, err, errMalformedPassword)
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 56
+)
+
+// PrefixLimiter rate limits events per source network: a /24 for IPv4 and
+// a /56 for IPv6 addresses, the usual size of a single customer network
+type PrefixLimiter struct {
+	rate, burst int64
+	idle        time.Duration // After which a bucket is full again
+	dropped     atomic.Uint64
+
+	mutex   sync.Mutex
+	buckets map[string]*prefixBucket
+	sweptAt time.Time
+}
+
+type prefixBucket struct {
+	bucket   *TokenBucket
+	lastUsed time.Time
+}
+
+// NewPrefixLimiter creates a PrefixLimiter admitting rate events per second and
+// bursts of burst events for every network
+func NewPrefixLimiter(rate, burst int64) *PrefixLimiter {
+	idle := time.Duration(burst) * time.Second / time.Duration(rate)
+	if idle < time.Second {
+		idle = time.Second
+	}
+	return &PrefixLimiter{
+		rate:    rate,
+		burst:   burst,
+		idle:    idle,
+		buckets: map[string]*prefixBucket{},
+	}
+}
+
+// Allow reports whether an event from ip is admitted, and counts it as dropped if not
+func (l *PrefixLimiter) Allow(ip net.IP) bool {
+	key := prefix(ip)
+	now := time.Now()
+
+	l.mutex.Lock()
+	// Buckets that were idle long enough are full, so the same as a new one
+	if now.Sub(l.sweptAt) > l.idle {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastUsed) > l.idle {
+				delete(l.buckets, k)
+			}
+		}
+		l.sweptAt = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &prefixBucket{bucket: NewTokenBucket(l.rate, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastUsed = now
+	l.mutex.Unlock()
+
+	if !b.bucket.Allow(1) {
+		l.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+// Dropped returns the number of events that were not admitted
+func (l *PrefixLimiter) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+func prefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(ipv4PrefixBits, 8*net.IPv4len)).String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6PrefixBits, 8*net.IPv6len)).String()
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ratelimit
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixLimiter(t *testing.T) {
+	l := NewPrefixLimiter(1, 2)
+
+	// The whole /24 shares a bucket
+	assert.True(t, l.Allow(net.ParseIP("192.0.2.1")))
+	assert.True(t, l.Allow(net.ParseIP("192.0.2.200")))
+	assert.False(t, l.Allow(net.ParseIP("192.0.2.3")))
+	assert.True(t, l.Allow(net.ParseIP("192.0.3.1")))
+
+	// And so does the whole /56
+	assert.True(t, l.Allow(net.ParseIP("2001:db8:0:100::1")))
+	assert.True(t, l.Allow(net.ParseIP("2001:db8:0:1ff::1")))
+	assert.False(t, l.Allow(net.ParseIP("2001:db8:0:142::1")))
+	assert.True(t, l.Allow(net.ParseIP("2001:db8:0:200::1")))
+
+	// IPv4-mapped addresses are IPv4
+	assert.False(t, l.Allow(net.ParseIP("::ffff:192.0.2.4")))
+
+	assert.Equal(t, uint64(3), l.Dropped())
+}
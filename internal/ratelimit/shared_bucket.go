@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ratelimit
+
+import (
+	"sync"
+)
+
+// SharedBucket divides a bandwidth limit between a changing set of Shares.
+//
+// Every Share is guaranteed an equal part of the limit. Traffic above its
+// part is still admitted while the limit is not contended, which is the
+// case as long as the shared bucket is more than half full. Once it is not,
+// only traffic within the equal parts is admitted, so heavy users can never
+// push light ones out.
+type SharedBucket struct {
+	bitsPerSecond int64
+	bucket        *TokenBucket
+	reserve       float64
+
+	mutex  sync.Mutex
+	shares map[*Share]struct{}
+}
+
+// Share is the part of a SharedBucket used by a single member
+type Share struct {
+	shared *SharedBucket
+	bucket *TokenBucket
+}
+
+// NewSharedBucket creates a SharedBucket for a limit given in bits per second
+func NewSharedBucket(bitsPerSecond int64) *SharedBucket {
+	rate, burst := BandwidthRate(bitsPerSecond)
+	return &SharedBucket{
+		bitsPerSecond: bitsPerSecond,
+		bucket:        NewTokenBucket(rate, burst),
+		reserve:       float64(burst) / 2,
+		shares:        map[*Share]struct{}{},
+	}
+}
+
+// Join adds a Share to the bucket, reducing the part of all other Shares.
+// The Share must be released with Leave.
+func (s *SharedBucket) Join() *Share {
+	share := &Share{shared: s}
+
+	s.mutex.Lock()
+	s.shares[share] = struct{}{}
+	s.rebalance()
+	s.mutex.Unlock()
+
+	return share
+}
+
+// Shares returns the number of Shares currently in the bucket
+func (s *SharedBucket) Shares() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.shares)
+}
+
+// rebalance gives every share an equal part. The burst of a share never
+// exceeds the reserve, so bursts within a part always find room in the shared
+// bucket. Must be called with the mutex held
+func (s *SharedBucket) rebalance() {
+	if len(s.shares) == 0 {
+		return
+	}
+
+	rate, burst := BandwidthRate(s.bitsPerSecond / int64(len(s.shares)))
+	if float64(burst) > s.reserve {
+		burst = int64(s.reserve)
+	}
+
+	for share := range s.shares {
+		if share.bucket == nil {
+			share.bucket = NewTokenBucket(rate, burst)
+		} else {
+			share.bucket.SetRate(rate, burst)
+		}
+	}
+}
+
+// Allow consumes n bytes of the Share and reports whether they may be sent
+func (s *Share) Allow(n int) bool {
+	if s.bucket.Allow(n) {
+		return s.shared.bucket.Allow(n)
+	}
+
+	return s.shared.bucket.allowAbove(n, s.shared.reserve)
+}
+
+// Leave removes the Share from the bucket, increasing the part of all other
+// Shares. Leaving more than once has no effect.
+func (s *Share) Leave() {
+	s.shared.mutex.Lock()
+	defer s.shared.mutex.Unlock()
+
+	if _, ok := s.shared.shares[s]; !ok {
+		return
+	}
+	delete(s.shared.shares, s)
+	s.shared.rebalance()
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func allowed(s *Share, packets, size int) (n int) {
+	for i := 0; i < packets; i++ {
+		if s.Allow(size) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSharedBucket(t *testing.T) {
+	t.Run("Contended", func(t *testing.T) {
+		// 10000 bytes per second with a burst of 3200, so 1600 per share
+		s := NewSharedBucket(80_000)
+		heavy, light := s.Join(), s.Join()
+		assert.Equal(t, 2, s.Shares())
+
+		assert.Equal(t, 1, allowed(heavy, 10, 1000))
+		assert.Equal(t, 1, allowed(light, 1, 1000), "heavy share must not starve the light one")
+	})
+
+	t.Run("Uncontended", func(t *testing.T) {
+		// 1MB per second with a burst of 100000, so 25000 per share
+		s := NewSharedBucket(8_000_000)
+		shares := []*Share{s.Join(), s.Join(), s.Join(), s.Join()}
+
+		assert.Equal(t, 50, allowed(shares[0], 100, 1000), "idle capacity should be used")
+		for _, share := range shares[1:] {
+			assert.Equal(t, 16, allowed(share, 16, 1000))
+		}
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		s := NewSharedBucket(8_000_000)
+		a, b := s.Join(), s.Join()
+		b.Leave()
+		b.Leave()
+		assert.Equal(t, 1, s.Shares())
+		assert.True(t, a.Allow(1000))
+		a.Leave()
+		assert.Equal(t, 0, s.Shares())
+	})
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package ratelimit implements the rate limiters used by the TURN server
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a thread-safe token bucket. Tokens accumulate at rate per
+// second up to burst, and every admitted unit of work consumes tokens.
+type TokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket
+func NewTokenBucket(rate, burst int64) *TokenBucket {
+	return newTokenBucket(rate, burst, time.Now)
+}
+
+func newTokenBucket(rate, burst int64, now func() time.Time) *TokenBucket {
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// Allow consumes n tokens and reports whether there were enough of them.
+// If there were not, no tokens are consumed.
+func (b *TokenBucket) Allow(n int) bool {
+	return b.allowAbove(n, 0)
+}
+
+// allowAbove is Allow, but leaves at least reserve tokens in the bucket
+func (b *TokenBucket) allowAbove(n int, reserve float64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	if b.tokens-float64(n) < reserve {
+		return false
+	}
+
+	b.tokens -= float64(n)
+	return true
+}
+
+// SetRate changes the rate and burst of the bucket, keeping the tokens that
+// have accumulated so far up to the new burst
+func (b *TokenBucket) SetRate(rate, burst int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	b.rate = float64(rate)
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+const (
+	bandwidthBurstDuration = 100 * time.Millisecond
+	minBandwidthBurst      = 3200
+)
+
+// NewBandwidthLimiter creates a TokenBucket counting bytes for a limit given
+// in bits per second. Bursts of 100ms worth of traffic, but at least two full
+// sized datagrams, are admitted.
+func NewBandwidthLimiter(bitsPerSecond int64) *TokenBucket {
+	rate, burst := BandwidthRate(bitsPerSecond)
+	return NewTokenBucket(rate, burst)
+}
+
+// BandwidthRate converts a limit given in bits per second to the byte rate
+// and burst of a TokenBucket created by NewBandwidthLimiter
+func BandwidthRate(bitsPerSecond int64) (rate, burst int64) {
+	rate = bitsPerSecond / 8
+	burst = int64(float64(rate) * bandwidthBurstDuration.Seconds())
+	if burst < minBandwidthBurst {
+		burst = minBandwidthBurst
+	}
+	return rate, burst
+}
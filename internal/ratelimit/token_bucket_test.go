@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(1000, 100, func() time.Time { return now })
+
+	assert.True(t, b.Allow(60))
+	assert.False(t, b.Allow(60), "should not admit more than the burst")
+	assert.True(t, b.Allow(40))
+
+	now = now.Add(50 * time.Millisecond)
+	assert.True(t, b.Allow(50))
+	assert.False(t, b.Allow(1))
+
+	now = now.Add(time.Hour)
+	assert.True(t, b.Allow(100))
+	assert.False(t, b.Allow(1), "tokens must not accumulate above the burst")
+
+	b.SetRate(2000, 10)
+	now = now.Add(time.Second)
+	assert.True(t, b.Allow(10))
+	assert.False(t, b.Allow(1))
+}
+
+func TestBandwidthRate(t *testing.T) {
+	rate, burst := BandwidthRate(8_000_000)
+	assert.Equal(t, int64(1_000_000), rate)
+	assert.Equal(t, int64(100_000), burst)
+
+	rate, burst = BandwidthRate(8000)
+	assert.Equal(t, int64(1000), rate)
+	assert.Equal(t, int64(minBandwidthBurst), burst)
+}
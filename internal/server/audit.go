@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"net"
+
+	"github.com/pion/stun/v3"
+)
+
+// AuditEventType is the kind of an AuditEvent
+type AuditEventType int
+
+const (
+	// AuditAuthSuccess is a request with valid credentials
+	AuditAuthSuccess AuditEventType = iota
+	// AuditAuthFailure is a request with credentials that were refused
+	AuditAuthFailure
+	// AuditQuotaRejected is an Allocate request refused for lack of capacity
+	AuditQuotaRejected
+	// AuditPermissionDenied is a peer a client was not permitted to use
+	AuditPermissionDenied
+)
+
+// AuditEvent is a security relevant outcome of a request
+type AuditEvent struct {
+	Type     AuditEventType
+	Method   stun.Method
+	Username string
+	SrcAddr  net.Addr
+	PeerIP   net.IP
+	Code     stun.ErrorCode
+	Detail   string
+}
+
+func (r Request) audit(event AuditEvent) {
+	if r.Audit == nil {
+		return
+	}
+	event.SrcAddr = r.SrcAddr
+	r.Audit(event)
+}
@@ -8,6 +8,7 @@ import "errors"
 var (
 	errFailedToGenerateNonce                  = errors.New("failed to generate nonce")
 	errInvalidNonce                           = errors.New("invalid nonce")
+	errNonceUsedUp                            = errors.New("nonce used up")
 	errFailedToSendError                      = errors.New("failed to send error message")
 	errNoSuchUser                             = errors.New("no such user exists")
 	errUnexpectedClass                        = errors.New("unexpected class")
@@ -26,4 +27,9 @@ var (
 	errShortWrite                             = errors.New("packet write smaller than packet")
 	errNoSuchChannelBind                      = errors.New("no such channel bind")
 	errFailedWriteSocket                      = errors.New("failed writing to socket")
+	errNoPeerAddress                          = errors.New("no XOR-PEER-ADDRESS in request")
+	errInvalidReservationToken                = errors.New("no reservation for RESERVATION-TOKEN")
+	errAllocationNotAuthorized                = errors.New("allocation not authorized")
+	errGuestCapacity                          = errors.New("maximum number of guest allocations reached")
+	errPasswordAlgorithmMismatch              = errors.New("PASSWORD-ALGORITHMS does not match the advertised ones")
 )
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"time"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/allocation"
+)
+
+// Guest configures a listener that grants allocations without credentials
+type Guest struct {
+	// Policy of every guest allocation, with Guest set
+	Policy allocation.Policy
+
+	// MaxLifetime caps the total lifetime of a guest allocation, refreshes
+	// can not extend it any further
+	MaxLifetime time.Duration
+
+	// MaxAllocations limits the allocations of the listener, zero means unlimited
+	MaxAllocations int
+}
+
+// lifetime returns the lifetime granted for the requested one to a guest
+// allocation created at createdAt
+func (g *Guest) lifetime(requested time.Duration, createdAt time.Time) time.Duration {
+	remaining := g.MaxLifetime - time.Since(createdAt)
+	if remaining < 0 {
+		return 0
+	}
+	if requested > remaining {
+		return remaining
+	}
+	return requested
+}
+
+// noIntegrity takes the place of MESSAGE-INTEGRITY in responses to guests,
+// which have no key to sign them with
+type noIntegrity struct{}
+
+func (noIntegrity) AddTo(*stun.Message) error { return nil }
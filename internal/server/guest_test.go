@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuestLifetime(t *testing.T) {
+	guest := &Guest{MaxLifetime: time.Minute}
+	now := time.Now()
+
+	assert.Equal(t, 30*time.Second, guest.lifetime(30*time.Second, now))
+	assert.InDelta(t, time.Minute, guest.lifetime(10*time.Minute, now), float64(time.Second))
+	// Refreshes do not extend the allocation past MaxLifetime
+	assert.InDelta(t, 20*time.Second, guest.lifetime(10*time.Minute, now.Add(-40*time.Second)), float64(time.Second))
+	assert.Equal(t, time.Duration(0), guest.lifetime(10*time.Minute, now.Add(-2*time.Minute)))
+}
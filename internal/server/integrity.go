@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// IntegrityCalculator computes and verifies the HMACs of MESSAGE-INTEGRITY and
+// MESSAGE-INTEGRITY-SHA256 with long-term keys it holds itself
+type IntegrityCalculator interface {
+	ComputeMAC(credentials IntegrityCredentials, message []byte) ([]byte, error)
+	VerifyMAC(credentials IntegrityCredentials, message, mac []byte) (bool, error)
+}
+
+// IntegrityCredentials select the key and HMAC of an IntegrityCalculator
+type IntegrityCredentials struct {
+	Username          string
+	Realm             string
+	PasswordAlgorithm proto.PasswordAlgorithm
+	SHA256            bool
+}
+
+// calculatedIntegrity returns the integrity of the IntegrityCalculator the
+// request is signed with, so the response is signed the same way
+func calculatedIntegrity(m *stun.Message, c IntegrityCalculator, credentials IntegrityCredentials) messageIntegrity {
+	credentials.SHA256 = m.Contains(stun.AttrMessageIntegritySHA256)
+	return proto.ExternalIntegrity{
+		SHA256: credentials.SHA256,
+		Compute: func(message []byte) ([]byte, error) {
+			return c.ComputeMAC(credentials, message)
+		},
+		Verify: func(message, mac []byte) (bool, error) {
+			return c.VerifyMAC(credentials, message, mac)
+		},
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// LockoutConfig configures a Lockout
+type LockoutConfig struct {
+	// Threshold is the number of failures within Window that lock a username or IP out
+	Threshold int
+	Window    time.Duration
+
+	// Duration is the first lockout, every further lockout doubles it up to MaxDuration
+	Duration    time.Duration
+	MaxDuration time.Duration
+
+	// Reject answers locked out attempts with 403 instead of dropping them
+	Reject bool
+
+	// OnLockout is called whenever a username, or else an IP, is locked out. Optional
+	OnLockout func(username string, ip net.IP, failures int, duration time.Duration)
+}
+
+// Lockout tracks failed authentications per username and per source IP and locks
+// them out once they fail too often
+type Lockout struct {
+	config LockoutConfig
+
+	mutex   sync.Mutex
+	users   map[string]*lockoutEntry
+	ips     map[string]*lockoutEntry
+	sweptAt time.Time
+}
+
+type lockoutEntry struct {
+	failures    int
+	windowStart time.Time
+	lastFailure time.Time
+	lockouts    int
+	lockedUntil time.Time
+}
+
+// NewLockout creates a Lockout
+func NewLockout(config LockoutConfig) *Lockout {
+	return &Lockout{
+		config: config,
+		users:  map[string]*lockoutEntry{},
+		ips:    map[string]*lockoutEntry{},
+	}
+}
+
+// Locked tells if the username or the IP is locked out
+func (l *Lockout) Locked(username string, ip net.IP) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if e, ok := l.users[username]; ok && now.Before(e.lockedUntil) {
+		return true
+	}
+	if e, ok := l.ips[ip.String()]; ok && now.Before(e.lockedUntil) {
+		return true
+	}
+	return false
+}
+
+// Fail records a failed authentication of username from ip
+func (l *Lockout) Fail(username string, ip net.IP) {
+	l.mutex.Lock()
+	now := time.Now()
+	l.sweep(now)
+	userFailures, userLocked := l.fail(l.users, username, now)
+	ipFailures, ipLocked := l.fail(l.ips, ip.String(), now)
+	l.mutex.Unlock()
+
+	if l.config.OnLockout == nil {
+		return
+	}
+	if userLocked > 0 {
+		l.config.OnLockout(username, nil, userFailures, userLocked)
+	}
+	if ipLocked > 0 {
+		l.config.OnLockout("", ip, ipFailures, ipLocked)
+	}
+}
+
+// Succeed forgets the failures of username once it authenticated. Failures of the
+// IP are kept, so one valid account does not allow guessing others.
+func (l *Lockout) Succeed(username string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.users, username)
+}
+
+// fail counts a failure of key and returns the lockout it causes, if any
+func (l *Lockout) fail(entries map[string]*lockoutEntry, key string, now time.Time) (int, time.Duration) {
+	e, ok := entries[key]
+	if !ok {
+		e = &lockoutEntry{}
+		entries[key] = e
+	}
+	if now.Sub(e.windowStart) > l.config.Window {
+		e.failures, e.windowStart = 0, now
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures < l.config.Threshold {
+		return e.failures, 0
+	}
+
+	duration := l.config.Duration
+	for i := 0; i < e.lockouts && duration < l.config.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > l.config.MaxDuration {
+		duration = l.config.MaxDuration
+	}
+	failures := e.failures
+	e.lockouts++
+	e.failures, e.windowStart = 0, now
+	e.lockedUntil = now.Add(duration)
+	return failures, duration
+}
+
+// sweep forgets entries that are neither locked nor failed for MaxDuration, at most
+// once per Window, so the backoff of a key lasts that long
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < l.config.Window {
+		return
+	}
+	l.sweptAt = now
+	for _, entries := range []map[string]*lockoutEntry{l.users, l.ips} {
+		for key, e := range entries {
+			if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.config.MaxDuration {
+				delete(entries, key)
+			}
+		}
+	}
+}
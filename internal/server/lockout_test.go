@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockout(t *testing.T) {
+	type event struct {
+		username string
+		ip       string
+		duration time.Duration
+	}
+	var events []event
+	l := NewLockout(LockoutConfig{
+		Threshold:   3,
+		Window:      time.Minute,
+		Duration:    time.Second,
+		MaxDuration: 3 * time.Second,
+		OnLockout: func(username string, ip net.IP, failures int, duration time.Duration) {
+			assert.Equal(t, 3, failures)
+			e := event{username: username, duration: duration}
+			if ip != nil {
+				e.ip = ip.String()
+			}
+			events = append(events, e)
+		},
+	})
+	attacker := net.IPv4(192, 0, 2, 1)
+	user := net.IPv4(192, 0, 2, 2)
+
+	l.Fail("alice", net.IPv4(198, 51, 100, 1))
+	l.Fail("alice", net.IPv4(198, 51, 100, 2))
+	assert.False(t, l.Locked("alice", user))
+	l.Succeed("alice")
+	l.Fail("alice", net.IPv4(198, 51, 100, 3))
+	assert.False(t, l.Locked("alice", user), "a success should forget the failures of the username")
+	assert.Empty(t, events)
+
+	l.Fail("bob", attacker)
+	l.Fail("carol", attacker)
+	l.Fail("dave", attacker)
+	assert.True(t, l.Locked("frank", attacker), "the failures of the IP should add up")
+	assert.False(t, l.Locked("frank", user))
+	assert.Equal(t, []event{{ip: "192.0.2.1", duration: time.Second}}, events)
+
+	for i := 0; i < 3; i++ {
+		l.Fail("grace", user)
+	}
+	assert.True(t, l.Locked("grace", net.IPv4(192, 0, 2, 3)))
+
+	// Lockouts back off exponentially up to the maximum
+	for _, duration := range []time.Duration{2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		events = nil
+		for i := 0; i < 3; i++ {
+			l.Fail("eve", attacker)
+		}
+		assert.Contains(t, events, event{ip: "192.0.2.1", duration: duration})
+	}
+}
@@ -7,65 +7,239 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
+	"hash"
+	"net"
+	"sync"
 	"time"
 )
 
 const (
-	nonceLifetime  = time.Hour // See: https://tools.ietf.org/html/rfc5766#section-4
-	nonceLength    = 40
-	nonceKeyLength = 64
+	nonceLifetime      = time.Hour // See: https://tools.ietf.org/html/rfc5766#section-4
+	nonceSaltLength    = 8
+	nonceMACLength     = 16 // HMAC-SHA256 truncated to 128 bits, see RFC 2104 Section 5
+	nonceLength        = 8 + nonceSaltLength + nonceMACLength
+	nonceKeyLength     = 64
+	nonceSweepInterval = time.Minute
+
+	// maxNonceUses bounds the nonces whose uses are remembered. Only requests
+	// that passed the integrity check count a use, so filling it takes valid
+	// credentials.
+	maxNonceUses = 1 << 16
 )
 
+// encodedNonceLength is the length of a nonce in unpadded base64
+const encodedNonceLength = (nonceLength*8 + 5) / 6
+
+//nolint:gochecknoglobals
+var nonceEncoding = base64.RawURLEncoding.Strict()
+
+// NonceHashConfig configures a NonceHash
+type NonceHashConfig struct {
+	// BindAddr mixes the client address into the nonces, so a nonce is only
+	// valid from the address it was generated for
+	BindAddr bool
+
+	// MaxUses is the number of requests a nonce may authenticate, see Use. Zero
+	// means unlimited. The uses of every nonce are remembered for its whole
+	// lifetime.
+	MaxUses int
+
+	// Key signs the nonces, so the nonces of every NonceHash with the same key
+	// validate, e.g. of the process before a restart. Random if empty.
+	Key []byte
+}
+
 // NewNonceHash creates a NonceHash
 func NewNonceHash() (*NonceHash, error) {
-	key := make([]byte, nonceKeyLength)
-	if _, err := rand.Read(key); err != nil {
-		return nil, err
+	return NewNonceHashWithConfig(NonceHashConfig{})
+}
+
+// NewNonceHashWithConfig creates a NonceHash with the options of config
+func NewNonceHashWithConfig(config NonceHashConfig) (*NonceHash, error) {
+	key := append([]byte(nil), config.Key...)
+	if len(key) == 0 {
+		key = make([]byte, nonceKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	n := &NonceHash{
+		bindAddr: config.BindAddr,
+		maxUses:  config.MaxUses,
+	}
+	n.macs.New = func() interface{} { return &nonceMAC{hash: hmac.New(sha256.New, key)} }
+	if n.maxUses > 0 {
+		n.uses = map[string]int{}
+		n.usesCap = maxNonceUses
+		n.lastSweep = time.Now()
 	}
 
-	return &NonceHash{key}, nil
+	return n, nil
 }
 
-// NonceHash is used to create and verify nonces
+// NonceHash is used to create and verify nonces. A nonce is the time it was
+// generated, a random salt and their truncated HMAC, base64url encoded.
 type NonceHash struct {
-	key []byte
+	bindAddr bool
+	macs     sync.Pool // *nonceMAC with the key
+
+	maxUses   int
+	usesLock  sync.Mutex
+	uses      map[string]int
+	usesCap   int
+	lastSweep time.Time
 }
 
 // Generate a nonce
 func (n *NonceHash) Generate() (string, error) {
-	nonce := make([]byte, 8, nonceLength)
+	return n.GenerateFor(nil)
+}
+
+// GenerateFor generates a nonce for the client at srcAddr
+func (n *NonceHash) GenerateFor(srcAddr net.Addr) (string, error) {
+	m := n.macs.Get().(*nonceMAC) //nolint:forcetypeassert
+	defer n.macs.Put(m)
+
+	// The salt tells apart nonces generated in the same millisecond, so their
+	// uses are counted separately
+	nonce := m.decoded[:nonceLength]
 	binary.BigEndian.PutUint64(nonce, uint64(time.Now().UnixMilli()))
+	if _, err := rand.Read(nonce[8 : 8+nonceSaltLength]); err != nil {
+		return "", fmt.Errorf("%w: %v", errFailedToGenerateNonce, err) //nolint:errorlint
+	}
 
-	hash := hmac.New(sha256.New, n.key)
-	if _, err := hash.Write(nonce[:8]); err != nil {
+	mac, err := m.sum(nonce[:8+nonceSaltLength], n.bindAddr, srcAddr)
+	if err != nil {
 		return "", fmt.Errorf("%w: %v", errFailedToGenerateNonce, err) //nolint:errorlint
 	}
-	nonce = hash.Sum(nonce)
+	copy(nonce[8+nonceSaltLength:], mac)
 
-	return hex.EncodeToString(nonce), nil
+	return nonceEncoding.EncodeToString(nonce), nil
 }
 
 // Validate checks that nonce is signed and is not expired
 func (n *NonceHash) Validate(nonce string) error {
-	b, err := hex.DecodeString(nonce)
-	if err != nil || len(b) != nonceLength {
+	return n.ValidateFrom(nonce, nil)
+}
+
+// ValidateFrom checks that nonce is signed for the client at srcAddr and is
+// not expired. It does not count a use, see Use.
+func (n *NonceHash) ValidateFrom(nonce string, srcAddr net.Addr) error {
+	// Every authenticated request validates a nonce, in the buffers of the pool
+	m := n.macs.Get().(*nonceMAC) //nolint:forcetypeassert
+	defer n.macs.Put(m)
+
+	if len(nonce) != encodedNonceLength {
+		return errInvalidNonce
+	}
+	copy(m.encoded[:], nonce)
+	if _, err := nonceEncoding.Decode(m.decoded[:], m.encoded[:]); err != nil {
 		return fmt.Errorf("%w: %v", errInvalidNonce, err) //nolint:errorlint
 	}
+	b := m.decoded[:]
 
 	if ts := time.UnixMilli(int64(binary.BigEndian.Uint64(b))); time.Since(ts) > nonceLifetime {
 		return errInvalidNonce
 	}
 
-	hash := hmac.New(sha256.New, n.key)
-	if _, err = hash.Write(b[:8]); err != nil {
+	mac, err := m.sum(b[:8+nonceSaltLength], n.bindAddr, srcAddr)
+	if err != nil {
 		return fmt.Errorf("%w: %v", errInvalidNonce, err) //nolint:errorlint
 	}
-	if !hmac.Equal(b[8:], hash.Sum(nil)) {
+	if !hmac.Equal(b[8+nonceSaltLength:], mac) {
 		return errInvalidNonce
 	}
 
 	return nil
 }
+
+// Use counts a request authenticated with the nonce, which must have been
+// validated, and fails once the nonce authenticated MaxUses requests. It is
+// only called for requests that passed the integrity check, as anyone can
+// obtain a valid nonce with an unauthenticated request. Once the uses of
+// maxNonceUses nonces are remembered, further nonces are refused until the
+// oldest expire.
+func (n *NonceHash) Use(nonce string) error {
+	if n.maxUses == 0 {
+		return nil
+	}
+
+	n.usesLock.Lock()
+	defer n.usesLock.Unlock()
+
+	if now := time.Now(); now.Sub(n.lastSweep) > nonceSweepInterval {
+		n.lastSweep = now
+		for nonce := range n.uses {
+			if ts, ok := nonceTime(nonce); ok && now.Sub(ts) > nonceLifetime {
+				delete(n.uses, nonce)
+			}
+		}
+	}
+
+	uses, ok := n.uses[nonce]
+	if uses >= n.maxUses || (!ok && len(n.uses) >= n.usesCap) {
+		return errNonceUsedUp
+	}
+	n.uses[nonce] = uses + 1
+
+	return nil
+}
+
+// nonceTime returns when a nonce was generated
+func nonceTime(nonce string) (time.Time, bool) {
+	b, err := nonceEncoding.DecodeString(nonce)
+	if err != nil || len(b) < 8 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(b))), true
+}
+
+// nonceMAC is the HMAC of a NonceHash with the buffers of a nonce
+type nonceMAC struct {
+	hash    hash.Hash
+	encoded [encodedNonceLength]byte
+	decoded [nonceLength]byte
+	addr    [1 + net.IPv6len + 2]byte
+	mac     [sha256.Size]byte
+}
+
+// sum signs the timestamp and salt of a nonce, and the client address if
+// nonces are bound to it. The signature is valid until m is used again.
+func (m *nonceMAC) sum(timestampAndSalt []byte, bindAddr bool, srcAddr net.Addr) ([]byte, error) {
+	m.hash.Reset()
+	if _, err := m.hash.Write(timestampAndSalt); err != nil {
+		return nil, err
+	}
+	if bindAddr && srcAddr != nil {
+		if _, err := m.hash.Write(m.encodeAddr(srcAddr)); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.hash.Sum(m.mac[:0])[:nonceMACLength], nil
+}
+
+// encodeAddr returns the client address the nonces are bound to
+func (m *nonceMAC) encodeAddr(addr net.Addr) []byte {
+	var network byte
+	var ip net.IP
+	var port int
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		network, ip, port = 'u', a.IP, a.Port
+	case *net.TCPAddr:
+		network, ip, port = 't', a.IP, a.Port
+	}
+	if network == 0 || ip.To16() == nil {
+		return []byte(addr.Network() + " " + addr.String())
+	}
+
+	m.addr[0] = network
+	copy(m.addr[1:], ip.To16())
+	binary.BigEndian.PutUint16(m.addr[1+net.IPv6len:], uint16(port))
+	return m.addr[:]
+}
@@ -4,7 +4,10 @@
 package server
 
 import (
+	"encoding/binary"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,4 +20,92 @@ func TestNonceHash(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NoError(t, h.Validate(nonce))
 	})
+
+	t.Run("bound to the client address", func(t *testing.T) {
+		alice := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+		mallory := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5001}
+
+		h, err := NewNonceHashWithConfig(NonceHashConfig{BindAddr: true})
+		assert.NoError(t, err)
+		nonce, err := h.GenerateFor(alice)
+		assert.NoError(t, err)
+		assert.NoError(t, h.ValidateFrom(nonce, alice))
+		assert.ErrorIs(t, h.ValidateFrom(nonce, mallory), errInvalidNonce)
+		assert.ErrorIs(t, h.ValidateFrom(nonce, &net.TCPAddr{IP: alice.IP, Port: alice.Port}), errInvalidNonce)
+
+		// Without the option the address does not matter
+		h, err = NewNonceHash()
+		assert.NoError(t, err)
+		nonce, err = h.GenerateFor(alice)
+		assert.NoError(t, err)
+		assert.NoError(t, h.ValidateFrom(nonce, mallory))
+	})
+
+	t.Run("limited uses", func(t *testing.T) {
+		h, err := NewNonceHashWithConfig(NonceHashConfig{MaxUses: 2})
+		assert.NoError(t, err)
+		nonce, err := h.Generate()
+		assert.NoError(t, err)
+		other, err := h.Generate()
+		assert.NoError(t, err)
+
+		// Validating counts no use, only authenticated requests do
+		assert.NoError(t, h.Validate(nonce))
+		assert.Empty(t, h.uses)
+
+		assert.NoError(t, h.Use(nonce))
+		assert.NoError(t, h.Use(nonce))
+		assert.ErrorIs(t, h.Use(nonce), errNonceUsedUp)
+		assert.NoError(t, h.Validate(nonce), "a used up nonce is still authentic")
+		assert.NoError(t, h.Use(other), "uses should be counted per nonce")
+		assert.Len(t, h.uses, 2)
+
+		// Expired nonces are forgotten
+		h.lastSweep = time.Now().Add(-2 * nonceSweepInterval)
+		expired := make([]byte, nonceLength)
+		binary.BigEndian.PutUint64(expired, uint64(time.Now().Add(-2*nonceLifetime).UnixMilli()))
+		h.uses[nonceEncoding.EncodeToString(expired)] = 1
+		assert.NoError(t, h.Use(other))
+		assert.Len(t, h.uses, 2)
+	})
+
+	t.Run("bounded uses", func(t *testing.T) {
+		h, err := NewNonceHashWithConfig(NonceHashConfig{MaxUses: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, maxNonceUses, h.usesCap)
+		h.usesCap = 2
+
+		nonces := make([]string, 3)
+		for i := range nonces {
+			nonces[i], err = h.Generate()
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, h.Use(nonces[0]))
+		assert.NoError(t, h.Use(nonces[1]))
+		assert.ErrorIs(t, h.Use(nonces[2]), errNonceUsedUp, "no further nonce should be remembered")
+		assert.NoError(t, h.Use(nonces[0]), "remembered nonces should still be usable")
+		assert.Len(t, h.uses, 2)
+
+		// Unlimited nonces are not remembered at all
+		h, err = NewNonceHash()
+		assert.NoError(t, err)
+		assert.NoError(t, h.Use(nonces[0]))
+		assert.Nil(t, h.uses)
+	})
+
+	t.Run("compact encoding without allocations", func(t *testing.T) {
+		if raceEnabled {
+			t.Skip("the race detector allocates")
+		}
+
+		addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+		h, err := NewNonceHashWithConfig(NonceHashConfig{BindAddr: true})
+		assert.NoError(t, err)
+		nonce, err := h.GenerateFor(addr)
+		assert.NoError(t, err)
+		assert.Len(t, nonce, 43)
+		assert.Zero(t, testing.AllocsPerRun(100, func() {
+			_ = h.ValidateFrom(nonce, addr)
+		}))
+	})
 }
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// passwordAlgorithmsNonceCookie starts the nonces of servers advertising
+// PASSWORD-ALGORITHMS, so clients know they may pick one. It is the nonce
+// cookie followed by the security feature set with only "Password algorithms"
+// set, see RFC 8489 Section 9.2.
+const passwordAlgorithmsNonceCookie = "obMatJos2AAAB"
+
+// PasswordAlgorithms restricts the algorithms long-term credentials may be
+// derived with. Without it only MD5 is accepted and nothing is advertised.
+type PasswordAlgorithms struct {
+	// Accept are the algorithms requests may be authenticated with
+	Accept proto.PasswordAlgorithms
+
+	// Advertise are the algorithms sent in PASSWORD-ALGORITHMS, nothing is
+	// advertised if empty
+	Advertise proto.PasswordAlgorithms
+
+	// ReportOnly accepts authentic requests with an algorithm missing from
+	// Accept, only reporting them to OnRejected
+	ReportOnly bool
+
+	OnRejected func(username string, algorithm proto.PasswordAlgorithm, srcAddr net.Addr)
+}
+
+func (p *PasswordAlgorithms) accepts(algorithm proto.PasswordAlgorithm) bool {
+	if p == nil {
+		return algorithm == proto.PasswordAlgorithmMD5
+	}
+	return p.Accept.Contains(algorithm)
+}
+
+func (p *PasswordAlgorithms) advertises() bool {
+	return p != nil && len(p.Advertise) > 0
+}
+
+func (p *PasswordAlgorithms) reject(username string, algorithm proto.PasswordAlgorithm, srcAddr net.Addr) {
+	if p != nil && p.OnRejected != nil {
+		p.OnRejected(username, algorithm, srcAddr)
+	}
+}
+
+// requestPasswordAlgorithm returns the algorithm the client derived its key
+// with, MD5 unless it says otherwise. ok is false if the request does not
+// match what the server advertised, which RFC 8489 Section 9.2.4 answers with
+// 400 (Bad Request) to keep the algorithms from being downgraded.
+func requestPasswordAlgorithm(r Request, m *stun.Message) (algorithm proto.PasswordAlgorithm, ok bool) {
+	algorithm = proto.PasswordAlgorithmMD5
+	hasAlgorithm := m.Contains(stun.AttrPasswordAlgorithm)
+	hasAlgorithms := m.Contains(stun.AttrPasswordAlgorithms)
+	switch {
+	case !hasAlgorithm && !hasAlgorithms:
+		return algorithm, true
+	case hasAlgorithm != hasAlgorithms, !r.PasswordAlgorithms.advertises():
+		return algorithm, false
+	}
+
+	var algorithms proto.PasswordAlgorithms
+	if err := algorithms.GetFrom(m); err != nil || !algorithms.Equal(r.PasswordAlgorithms.Advertise) {
+		return algorithm, false
+	}
+	if err := algorithm.GetFrom(m); err != nil || !algorithms.Contains(algorithm) {
+		return algorithm, false
+	}
+	return algorithm, true
+}
+
+// trimNonceCookie returns the nonce the NonceHash generated
+func trimNonceCookie(nonce string) string {
+	return strings.TrimPrefix(nonce, passwordAlgorithmsNonceCookie)
+}
+
+type messageIntegrity interface {
+	stun.Setter
+	Check(m *stun.Message) error
+}
+
+// requestIntegrity returns the integrity the request is signed with, so the
+// response is signed the same way
+func requestIntegrity(m *stun.Message, key []byte) messageIntegrity {
+	if m.Contains(stun.AttrMessageIntegritySHA256) {
+		return proto.MessageIntegritySHA256(key)
+	}
+	return stun.MessageIntegrity(key)
+}
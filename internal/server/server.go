@@ -14,7 +14,9 @@ import (
 	"github.com/pion/stun/v3"
 
 	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/fastlog"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/ratelimit"
 )
 
 // Request contains all the state needed to process a single incoming datagram
@@ -24,6 +26,16 @@ type Request struct {
 	SrcAddr net.Addr
 	Buff    []byte
 
+	// Config is shared by the requests of a listener, which copy the Request
+	// for every datagram
+	*Config
+
+	span Span
+}
+
+// Config is the state and configuration of a listener, which does not change
+// while it handles requests
+type Config struct {
 	// Server State
 	AllocationManager *allocation.Manager
 	NonceHash         *NonceHash
@@ -31,14 +43,55 @@ type Request struct {
 	// User Configuration
 	RelayConnHandler   func(username string, realm string, relaySocket net.PacketConn) (net.PacketConn, error)
 	AuthHandler        func(username string, realm string, srcAddr net.Addr) (key []byte, ok bool)
+	PolicyAuthHandler  func(username string, realm string, srcAddr net.Addr) (key []byte, policy *allocation.Policy, ok bool)
+	AllocationPolicy   allocation.Policy
 	Log                logging.LeveledLogger
 	Realm              string
 	ChannelBindTimeout time.Duration
+
+	MultiKeyAuthHandler func(username string, realm string, srcAddr net.Addr) (keys [][]byte, ok bool)
+	Lockout             *Lockout
+	ChallengeLimiter    *ratelimit.PrefixLimiter
+	RequestAuthHandler  func(username, realm string, srcAddr net.Addr, m *stun.Message) (key []byte, policy *allocation.Policy, ok bool)
+	Guest               *Guest
+
+	CredentialExpiry       func(username string) (expiry time.Time, ok bool)
+	StopAtCredentialExpiry bool
+
+	// AuthorizeAllocation returns the error to deny an authenticated Allocate request with
+	AuthorizeAllocation func(username, realm string, srcAddr net.Addr, m *stun.Message) *stun.ErrorCodeAttribute
+
+	// SHA256AuthHandler returns the SHA-256 key of credentials, see PasswordAlgorithms
+	SHA256AuthHandler  func(username, realm string, srcAddr net.Addr) (key []byte, ok bool)
+	PasswordAlgorithms *PasswordAlgorithms
+
+	// IntegrityCalculator verifies and signs messages in place of the AuthHandlers
+	IntegrityCalculator IntegrityCalculator
+
+	// Audit receives the AuditEvents of the request. Optional.
+	Audit func(event AuditEvent)
+
+	// StrictRealm challenges requests for any other realm than Realm again
+	StrictRealm bool
+
+	// SessionKeys authenticates the requests of an allocation with the key its
+	// last request was authenticated with, before asking the auth handlers
+	SessionKeys bool
+
+	// Responded is called with the method of every response sent to the
+	// client and its error code, zero for success responses. Optional.
+	Responded func(method stun.Method, code stun.ErrorCode)
+
+	// Trace starts the Span of a request before it is handled. The message is
+	// reused once handled, so nothing of it may be kept. Optional.
+	Trace func(m *stun.Message, srcAddr net.Addr) Span
 }
 
 // HandleRequest processes the give Request
 func HandleRequest(r Request) error {
-	r.Log.Debugf("Received %d bytes of udp from %s on %s", len(r.Buff), r.SrcAddr, r.Conn.LocalAddr())
+	if fastlog.Enabled(r.Log, logging.LogLevelDebug) {
+		fastlog.Debugw(r.Log, "Received datagram", "src", r.SrcAddr, "listener", r.Conn.LocalAddr(), "bytes", len(r.Buff))
+	}
 
 	if proto.IsChannelData(r.Buff) {
 		return handleDataPacket(r)
@@ -48,14 +101,15 @@ func HandleRequest(r Request) error {
 }
 
 func handleDataPacket(r Request) error {
-	r.Log.Debugf("Received DataPacket from %s", r.SrcAddr.String())
-	c := proto.ChannelData{Raw: r.Buff}
-	if err := c.Decode(); err != nil {
+	if fastlog.Enabled(r.Log, logging.LogLevelDebug) {
+		fastlog.Debugw(r.Log, "Received DataPacket", "src", r.SrcAddr)
+	}
+	c, err := proto.DecodeChannelData(r.Buff)
+	if err != nil {
 		return fmt.Errorf("%w: %v", errFailedToCreateChannelData, err) //nolint:errorlint
 	}
 
-	err := handleChannelData(r, &c)
-	if err != nil {
+	if err = handleChannelData(r, &c); err != nil {
 		if errors.Is(err, errNoAllocationFound) {
 			return nil
 		}
@@ -67,7 +121,15 @@ func handleDataPacket(r Request) error {
 
 func handleTURNPacket(r Request) error {
 	r.Log.Debug("Handling TURN packet")
-	m := &stun.Message{Raw: append([]byte{}, r.Buff...)}
+	// The message is decoded in place, and both it and the read buffer are
+	// reused once handled, so nothing may keep them or their attributes
+	m := getMessage()
+	raw := m.Raw
+	defer func() {
+		m.Raw = raw // The read buffer must not be built in by a response
+		putMessage(m)
+	}()
+	m.Raw = r.Buff
 	if err := m.Decode(); err != nil {
 		return fmt.Errorf("%w: %v", errFailedToCreateSTUNPacket, err) //nolint:errorlint
 	}
@@ -77,7 +139,13 @@ func handleTURNPacket(r Request) error {
 		return fmt.Errorf("%w %v-%v from %v: %v", errUnhandledSTUNPacket, m.Type.Method, m.Type.Class, r.SrcAddr, err) //nolint:errorlint
 	}
 
+	if r.Trace != nil && m.Type.Class == stun.ClassRequest {
+		r.span = r.Trace(m, r.SrcAddr)
+	}
 	err = h(r, m)
+	if r.span != nil {
+		r.span.End(err)
+	}
 	if err != nil {
 		if errors.Is(err, errNoAllocationFound) || errors.Is(err, errNoSuchUser) {
 			return nil
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// discardConn is a net.PacketConn keeping the last packet written to it
+type discardConn struct {
+	net.PacketConn
+	last []byte
+}
+
+func (c *discardConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.last = append(c.last[:0], p...)
+	return len(p), nil
+}
+
+func (c *discardConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+}
+
+func TestHandleRequestReusesMessages(t *testing.T) {
+	request, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+	require.NoError(t, err)
+
+	buff := append([]byte(nil), request.Raw...)
+	conn := &discardConn{}
+	r := Request{
+		Conn:    conn,
+		SrcAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		Buff:    buff,
+		Config:  &Config{Log: logging.NewDefaultLoggerFactory().NewLogger("test")},
+	}
+	require.NoError(t, HandleRequest(r))
+
+	response := new(stun.Message)
+	_, err = response.Write(conn.last)
+	require.NoError(t, err)
+	assert.Equal(t, stun.BindingSuccess, response.Type)
+	assert.Equal(t, request.TransactionID, response.TransactionID)
+	assert.Equal(t, request.Raw, buff, "the read buffer should be left as it was")
+
+	// Neither the request nor the response allocate a message or setters, only
+	// log arguments and the addresses of this conn remain
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = HandleRequest(r)
+	})
+	assert.LessOrEqual(t, allocs, 6.0)
+}
+
+func TestHandleRefreshRequestAllocations(t *testing.T) {
+	logger := logging.NewDefaultLoggerFactory().NewLogger("test")
+	allocationManager, err := allocation.NewManager(allocation.ManagerConfig{
+		AllocatePacketConn: func(network string, _ int) (net.PacketConn, net.Addr, error) {
+			conn, listenErr := net.ListenPacket(network, "127.0.0.1:0")
+			if listenErr != nil {
+				return nil, nil, listenErr
+			}
+			return conn, conn.LocalAddr(), nil
+		},
+		AllocateConn:  func(string, int) (net.Conn, net.Addr, error) { return nil, nil, nil },
+		LeveledLogger: logger,
+	})
+	require.NoError(t, err)
+	defer allocationManager.Close() //nolint:errcheck
+
+	nonceHash, err := NewNonceHash()
+	require.NoError(t, err)
+	nonce, err := nonceHash.Generate()
+	require.NoError(t, err)
+	key := stun.NewLongTermIntegrity("alice", "pion.ly", "pass")
+
+	conn := &discardConn{}
+	r := Request{
+		Conn:    conn,
+		SrcAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		Config: &Config{
+			AllocationManager: allocationManager,
+			NonceHash:         nonceHash,
+			Log:               logger,
+			Realm:             "pion.ly",
+			AuthHandler:       func(string, string, net.Addr) ([]byte, bool) { return key, true },
+		},
+	}
+	fiveTuple := &allocation.FiveTuple{SrcAddr: r.SrcAddr, DstAddr: conn.LocalAddr(), Protocol: allocation.UDP}
+	_, err = allocationManager.CreateAllocation(fiveTuple, conn, 0, time.Hour, nil, allocation.Policy{})
+	require.NoError(t, err)
+
+	for name, integrity := range map[string]messageIntegrity{
+		"MessageIntegrity":       key,
+		"MessageIntegritySHA256": proto.MessageIntegritySHA256(key),
+	} {
+		t.Run(name, func(t *testing.T) {
+			request, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+				proto.Lifetime{Duration: time.Minute}, stun.NewUsername("alice"), stun.NewRealm("pion.ly"),
+				stun.NewNonce(nonce), integrity)
+			require.NoError(t, err)
+			r.Buff = request.Raw
+			require.NoError(t, HandleRequest(r))
+
+			response := new(stun.Message)
+			_, err = response.Write(conn.last)
+			require.NoError(t, err)
+			assert.Equal(t, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse), response.Type)
+			assert.NoError(t, integrity.Check(response))
+			var lifetime proto.Lifetime
+			assert.NoError(t, lifetime.GetFrom(response))
+			assert.Equal(t, time.Minute, lifetime.Duration)
+
+			if raceEnabled {
+				t.Skip("the race detector allocates")
+			}
+
+			// Neither the nonce, the integrity nor the response allocate, only the
+			// username and nonce strings, log arguments and the addresses of this conn
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = HandleRequest(r)
+			})
+			assert.LessOrEqual(t, allocs, 14.0)
+		})
+	}
+}
+
+func TestAuthenticateRequestNonceUses(t *testing.T) {
+	logger := logging.NewDefaultLoggerFactory().NewLogger("test")
+	allocationManager, err := allocation.NewManager(allocation.ManagerConfig{
+		AllocatePacketConn: func(network string, _ int) (net.PacketConn, net.Addr, error) {
+			conn, listenErr := net.ListenPacket(network, "127.0.0.1:0")
+			if listenErr != nil {
+				return nil, nil, listenErr
+			}
+			return conn, conn.LocalAddr(), nil
+		},
+		AllocateConn:  func(string, int) (net.Conn, net.Addr, error) { return nil, nil, nil },
+		LeveledLogger: logger,
+	})
+	require.NoError(t, err)
+	defer allocationManager.Close() //nolint:errcheck
+
+	nonceHash, err := NewNonceHashWithConfig(NonceHashConfig{MaxUses: 1})
+	require.NoError(t, err)
+	nonce, err := nonceHash.Generate()
+	require.NoError(t, err)
+	key := stun.NewLongTermIntegrity("alice", "pion.ly", "pass")
+
+	conn := &discardConn{}
+	r := Request{
+		Conn:    conn,
+		SrcAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		Config: &Config{
+			AllocationManager: allocationManager,
+			NonceHash:         nonceHash,
+			Log:               logger,
+			Realm:             "pion.ly",
+			AuthHandler:       func(string, string, net.Addr) ([]byte, bool) { return key, true },
+		},
+	}
+	fiveTuple := &allocation.FiveTuple{SrcAddr: r.SrcAddr, DstAddr: conn.LocalAddr(), Protocol: allocation.UDP}
+	_, err = allocationManager.CreateAllocation(fiveTuple, conn, 0, time.Hour, nil, allocation.Policy{})
+	require.NoError(t, err)
+
+	refresh := func(integrity stun.Setter) *stun.Message {
+		request, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+			proto.Lifetime{Duration: time.Minute}, stun.NewUsername("alice"), stun.NewRealm("pion.ly"),
+			stun.NewNonce(nonce), integrity)
+		require.NoError(t, err)
+		r.Buff = request.Raw
+		_ = HandleRequest(r) // Requests failing the integrity check are answered and reported
+
+		response := new(stun.Message)
+		_, err = response.Write(conn.last)
+		require.NoError(t, err)
+		return response
+	}
+	errorCode := func(response *stun.Message) stun.ErrorCode {
+		var code stun.ErrorCodeAttribute
+		require.NoError(t, code.GetFrom(response))
+		return code.Code
+	}
+
+	// Anyone can get a nonce, requests failing the integrity check must not use it up
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, stun.CodeBadRequest, errorCode(refresh(stun.NewLongTermIntegrity("alice", "pion.ly", "wrong"))))
+	}
+	assert.Empty(t, nonceHash.uses)
+
+	assert.Equal(t, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse), refresh(key).Type)
+	assert.Equal(t, stun.CodeStaleNonce, errorCode(refresh(key)))
+}
@@ -5,21 +5,23 @@ package server
 
 import (
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/fastlog"
 	"github.com/pion/turn/v4/internal/ipnet"
 )
 
 func handleBindingRequest(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received BindingRequest from %s", r.SrcAddr)
+	fastlog.Debugw(r.Log, "Received request", "method", stun.MethodBinding, "src", r.SrcAddr)
 
 	ip, port, err := ipnet.AddrIPPort(r.SrcAddr)
 	if err != nil {
 		return err
 	}
 
-	attrs := buildMsg(m.TransactionID, stun.BindingSuccess, &stun.XORMappedAddress{
-		IP:   ip,
-		Port: port,
-	}, stun.Fingerprint)
+	msg := newResponse(m, stun.BindingSuccess)
+	err = stun.XORMappedAddress{IP: ip, Port: port}.AddTo(msg)
+	if err == nil {
+		err = stun.Fingerprint.AddTo(msg)
+	}
 
-	return buildAndSend(r.Conn, r.SrcAddr, attrs...)
+	return sendResponse(r, msg, err)
 }
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"github.com/pion/stun/v3"
+)
+
+// Span traces the handling of a single request, see Request.Trace
+type Span interface {
+	// SetUsername is called with the username of the request once it is read
+	SetUsername(username string)
+	// SetResponseCode is called with the error code of every response sent,
+	// zero for success responses
+	SetResponseCode(code stun.ErrorCode)
+	// End is called once the request is handled, with the error its handler
+	// returned
+	End(err error)
+}
@@ -4,13 +4,17 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/randutil"
 	"github.com/pion/stun/v3"
 
 	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/fastlog"
 	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
 )
@@ -19,14 +23,14 @@ const runesAlpha = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 // See: https://tools.ietf.org/html/rfc5766#section-6.2
 func handleAllocateRequest(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received AllocateRequest from %s", r.SrcAddr)
+	fastlog.Debugw(r.Log, "Received request", "method", stun.MethodAllocate, "src", r.SrcAddr)
 
 	// 1. The server MUST require that the request be authenticated.  This
 	//    authentication MUST be done using the long-term credential
 	//    mechanism of [https://tools.ietf.org/html/rfc5389#section-10.2.2]
 	//    unless the client and server agree to use another mechanism through
 	//    some procedure outside the scope of this document.
-	messageIntegrity, hasAuth, err := authenticateRequest(r, m, stun.MethodAllocate)
+	messageIntegrity, policy, hasAuth, err := authenticateRequest(r, m, stun.MethodAllocate)
 	if !hasAuth {
 		return err
 	}
@@ -39,8 +43,12 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	requestedPort := 0
 	reservationToken := ""
 
-	badRequestMsg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
-	insufficientCapacityMsg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeInsufficientCapacity})
+	badRequestMsg := func() []stun.Setter {
+		return buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
+	}
+	insufficientCapacityMsg := func() []stun.Setter {
+		return buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeInsufficientCapacity})
+	}
 
 	// 2. The server checks if the 5-tuple is currently in use by an
 	//    existing allocation.  If yes, the server rejects the request with
@@ -49,11 +57,11 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 		id, attrs := alloc.GetResponseCache()
 		if id != m.TransactionID {
 			msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeAllocMismatch})
-			return buildAndSendErr(r.Conn, r.SrcAddr, errRelayAlreadyAllocatedForFiveTuple, msg...)
+			return buildAndSendErr(r, errRelayAlreadyAllocatedForFiveTuple, msg...)
 		}
 		// A retry allocation
-		msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse), append(attrs, messageIntegrity)...)
-		return buildAndSend(r.Conn, r.SrcAddr, msg...)
+		msg := newResponse(m, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse))
+		return sendResponse(r, msg, addAttributes(msg, messageIntegrity, attrs))
 	}
 
 	// 3. The server checks if the request contains a REQUESTED-TRANSPORT
@@ -64,10 +72,10 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	//    request with a 442 (Unsupported Transport Protocol) error.
 	var requestedTransport proto.RequestedTransport
 	if err = requestedTransport.GetFrom(m); err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	} else if requestedTransport.Protocol != proto.ProtoUDP && requestedTransport.Protocol != proto.ProtoTCP {
 		msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeUnsupportedTransProto})
-		return buildAndSendErr(r.Conn, r.SrcAddr, errUnsupportedTransportProtocol, msg...)
+		return buildAndSendErr(r, errUnsupportedTransportProtocol, msg...)
 	}
 
 	// 4. The request may contain a DONT-FRAGMENT attribute.  If it does,
@@ -77,7 +85,7 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	//    comprehension-required attribute.
 	if m.Contains(stun.AttrDontFragment) {
 		msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeUnknownAttribute}, &stun.UnknownAttributes{stun.AttrDontFragment})
-		return buildAndSendErr(r.Conn, r.SrcAddr, errNoDontFragmentSupport, msg...)
+		return buildAndSendErr(r, errNoDontFragmentSupport, msg...)
 	}
 
 	// 5.  The server checks if the request contains a RESERVATION-TOKEN
@@ -92,8 +100,14 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	if err = reservationTokenAttr.GetFrom(m); err == nil {
 		var evenPort proto.EvenPort
 		if err = evenPort.GetFrom(m); err == nil {
-			return buildAndSendErr(r.Conn, r.SrcAddr, errRequestWithReservationTokenAndEvenPort, badRequestMsg...)
+			return buildAndSendErr(r, errRequestWithReservationTokenAndEvenPort, badRequestMsg()...)
+		}
+
+		reservedPort, ok := r.AllocationManager.GetReservation(string(reservationTokenAttr))
+		if !ok {
+			return buildAndSendErr(r, errInvalidReservationToken, insufficientCapacityMsg()...)
 		}
+		requestedPort = reservedPort
 	}
 
 	// 6. The server checks if the request contains an EVEN-PORT attribute.
@@ -107,18 +121,27 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 		var randomPort int
 		randomPort, err = r.AllocationManager.GetRandomEvenPort()
 		if err != nil {
-			return buildAndSendErr(r.Conn, r.SrcAddr, err, insufficientCapacityMsg...)
+			return buildAndSendErr(r, err, insufficientCapacityMsg()...)
 		}
 		requestedPort = randomPort
-		reservationToken, err = randutil.GenerateCryptoRandomString(8, runesAlpha)
-		if err != nil {
-			return err
+		if evenPort.ReservePort {
+			reservationToken, err = randutil.GenerateCryptoRandomString(8, runesAlpha)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	username := stun.Username{}
-	if err := username.GetFrom(m); err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+	if err := username.GetFrom(m); err != nil && r.Guest == nil {
+		return buildAndSendErr(r, err, badRequestMsg()...)
+	}
+	if r.AuthorizeAllocation != nil {
+		if code := r.AuthorizeAllocation(username.String(), r.Realm, r.SrcAddr, m); code != nil {
+			fastlog.Debugw(r.Log, "Allocation not authorized", "src", r.SrcAddr, "username", username, "code", int(code.Code))
+			msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), code, messageIntegrity)
+			return buildAndSendErr(r, errAllocationNotAuthorized, msg...)
+		}
 	}
 	// 7. At any point, the server MAY choose to reject the request with a
 	//    486 (Allocation Quota Reached) error if it feels the client is
@@ -132,19 +155,41 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	//    client to a different server.  The use of this error code and
 	//    attribute follow the specification in [RFC5389].
 	lifetimeDuration := allocationLifeTime(m)
+	if r.Guest != nil {
+		if r.Guest.MaxAllocations > 0 && r.AllocationManager.AllocationCount() >= r.Guest.MaxAllocations {
+			r.audit(AuditEvent{Type: AuditQuotaRejected, Method: stun.MethodAllocate, Code: stun.CodeInsufficientCapacity, Detail: "guest capacity"})
+			return buildAndSendErr(r, errGuestCapacity, insufficientCapacityMsg()...)
+		}
+		lifetimeDuration = r.Guest.lifetime(lifetimeDuration, time.Now())
+		fastlog.Debugw(r.Log, "Granting guest allocation", "src", r.SrcAddr, "lifetime", lifetimeDuration)
+	}
+	if expiry, ok := credentialExpiry(r, m); ok {
+		policy.CredentialExpiry = expiry
+		if r.StopAtCredentialExpiry {
+			lifetimeDuration = lifetimeUntil(lifetimeDuration, expiry)
+		}
+	}
+	policy.Realm = r.Realm
 	a, err := r.AllocationManager.CreateAllocation(
 		fiveTuple,
 		r.Conn,
 		requestedPort,
 		lifetimeDuration,
-		username)
+		append(stun.Username(nil), username...), // The message buffer is reused
+		policy)
 	if err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, insufficientCapacityMsg...)
+		if errors.Is(err, allocation.ErrInsufficientCapacity) {
+			r.audit(AuditEvent{
+				Type: AuditQuotaRejected, Method: stun.MethodAllocate, Username: username.String(),
+				Code: stun.CodeInsufficientCapacity, Detail: err.Error(),
+			})
+		}
+		return buildAndSendErr(r, err, insufficientCapacityMsg()...)
 	}
 	if r.RelayConnHandler != nil {
 		a.RelaySocket, err = r.RelayConnHandler(string(username), r.Realm, a.RelaySocket)
 		if err != nil {
-			return buildAndSendErr(r.Conn, r.SrcAddr, err, insufficientCapacityMsg...)
+			return buildAndSendErr(r, err, insufficientCapacityMsg()...)
 		}
 	}
 
@@ -162,12 +207,12 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 
 	srcIP, srcPort, err := ipnet.AddrIPPort(r.SrcAddr)
 	if err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
 	relayIP, relayPort, err := ipnet.AddrIPPort(a.RelayAddr)
 	if err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
 	responseAttrs := []stun.Setter{
@@ -185,19 +230,19 @@ func handleAllocateRequest(r Request, m *stun.Message) error {
 	}
 
 	if reservationToken != "" {
-		r.AllocationManager.CreateReservation(reservationToken, relayPort)
+		r.AllocationManager.CreateReservation(reservationToken, relayPort+1)
 		responseAttrs = append(responseAttrs, proto.ReservationToken([]byte(reservationToken)))
 	}
 
-	msg := buildMsg(m.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse), append(responseAttrs, messageIntegrity)...)
 	a.SetResponseCache(m.TransactionID, responseAttrs)
-	return buildAndSend(r.Conn, r.SrcAddr, msg...)
+	msg := newResponse(m, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse))
+	return sendResponse(r, msg, addAttributes(msg, messageIntegrity, responseAttrs))
 }
 
 func handleRefreshRequest(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received RefreshRequest from %s", r.SrcAddr)
+	fastlog.Debugw(r.Log, "Received request", "method", stun.MethodRefresh, "src", r.SrcAddr)
 
-	messageIntegrity, hasAuth, err := authenticateRequest(r, m, stun.MethodRefresh)
+	messageIntegrity, _, hasAuth, err := authenticateRequest(r, m, stun.MethodRefresh)
 	if !hasAuth {
 		return err
 	}
@@ -215,21 +260,31 @@ func handleRefreshRequest(r Request, m *stun.Message) error {
 		if a == nil {
 			return fmt.Errorf("%w %v:%v", errNoAllocationFound, r.SrcAddr, r.Conn.LocalAddr())
 		}
+		if r.Guest != nil {
+			lifetimeDuration = r.Guest.lifetime(lifetimeDuration, a.CreatedAt())
+		}
+		if expiry, ok := credentialExpiry(r, m); ok {
+			a.SetCredentialExpiry(expiry)
+			if r.StopAtCredentialExpiry {
+				lifetimeDuration = lifetimeUntil(lifetimeDuration, expiry)
+			}
+		}
 		a.Refresh(lifetimeDuration)
 	} else {
 		r.AllocationManager.DeleteAllocation(fiveTuple)
 	}
 
-	return buildAndSend(r.Conn, r.SrcAddr, buildMsg(m.TransactionID, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse), []stun.Setter{
-		&proto.Lifetime{
-			Duration: lifetimeDuration,
-		},
-		messageIntegrity,
-	}...)...)
+	msg := newResponse(m, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse))
+	err = proto.Lifetime{Duration: lifetimeDuration}.AddTo(msg)
+	if err == nil {
+		err = messageIntegrity.AddTo(msg)
+	}
+
+	return sendResponse(r, msg, err)
 }
 
 func handleCreatePermissionRequest(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received CreatePermission from %s", r.SrcAddr)
+	fastlog.Debugw(r.Log, "Received request", "method", stun.MethodCreatePermission, "src", r.SrcAddr)
 
 	a := r.AllocationManager.GetAllocation(&allocation.FiveTuple{
 		SrcAddr:  r.SrcAddr,
@@ -240,50 +295,56 @@ func handleCreatePermissionRequest(r Request, m *stun.Message) error {
 		return fmt.Errorf("%w %v:%v", errNoAllocationFound, r.SrcAddr, r.Conn.LocalAddr())
 	}
 
-	messageIntegrity, hasAuth, err := authenticateRequest(r, m, stun.MethodCreatePermission)
+	messageIntegrity, _, hasAuth, err := authenticateRequest(r, m, stun.MethodCreatePermission)
 	if !hasAuth {
 		return err
 	}
 
-	addCount := 0
-
+	// The request is atomic, either all peers are permitted or none is
+	var peers []*net.UDPAddr
 	if err := m.ForEach(stun.AttrXORPeerAddress, func(m *stun.Message) error {
 		var peerAddress proto.PeerAddress
 		if err := peerAddress.GetFrom(m); err != nil {
 			return err
 		}
-
-		if err := r.AllocationManager.GrantPermission(r.SrcAddr, peerAddress.IP); err != nil {
-			r.Log.Infof("permission denied for client %s to peer %s", r.SrcAddr, peerAddress.IP)
-			return err
-		}
-
-		r.Log.Debugf("Adding permission for %s", fmt.Sprintf("%s:%d",
-			peerAddress.IP, peerAddress.Port))
-
-		a.AddPermission(allocation.NewPermission(
-			&net.UDPAddr{
-				IP:   peerAddress.IP,
-				Port: peerAddress.Port,
-			},
-			r.Log,
-		))
-		addCount++
+		peers = append(peers, &net.UDPAddr{
+			IP:   peerAddress.IP,
+			Port: peerAddress.Port,
+		})
 		return nil
-	}); err != nil {
-		addCount = 0
+	}); err != nil || len(peers) == 0 {
+		if err == nil {
+			err = errNoPeerAddress
+		}
+		return buildAndSendErr(r, err, buildMsg(m.TransactionID,
+			stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest}, messageIntegrity)...)
+	}
+
+	for _, peer := range peers {
+		if err := r.AllocationManager.GrantPermission(r.SrcAddr, peer.IP); err != nil {
+			fastlog.Infow(a.Log(), "Permission denied", "method", stun.MethodCreatePermission, "peer", peer.IP)
+			r.audit(AuditEvent{
+				Type: AuditPermissionDenied, Method: stun.MethodCreatePermission, Username: a.Username(),
+				PeerIP: peer.IP, Code: stun.CodeForbidden, Detail: err.Error(),
+			})
+			forbiddenMsg := buildMsg(m.TransactionID, stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeForbidden}, messageIntegrity)
+			return buildAndSendErr(r, err, forbiddenMsg...)
+		}
 	}
 
-	respClass := stun.ClassSuccessResponse
-	if addCount == 0 {
-		respClass = stun.ClassErrorResponse
+	for _, peer := range peers {
+		fastlog.Debugw(a.Log(), "Adding permission", "peer", peer)
+		a.AddPermission(allocation.NewPermission(peer, a.Log()))
 	}
 
-	return buildAndSend(r.Conn, r.SrcAddr, buildMsg(m.TransactionID, stun.NewType(stun.MethodCreatePermission, respClass), []stun.Setter{messageIntegrity}...)...)
+	msg := newResponse(m, stun.NewType(stun.MethodCreatePermission, stun.ClassSuccessResponse))
+	return sendResponse(r, msg, messageIntegrity.AddTo(msg))
 }
 
 func handleSendIndication(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received SendIndication from %s", r.SrcAddr)
+	if fastlog.Enabled(r.Log, logging.LogLevelDebug) {
+		fastlog.Debugw(r.Log, "Received indication", "method", stun.MethodSend, "src", r.SrcAddr)
+	}
 	a := r.AllocationManager.GetAllocation(&allocation.FiveTuple{
 		SrcAddr:  r.SrcAddr,
 		DstAddr:  r.Conn.LocalAddr(),
@@ -304,11 +365,13 @@ func handleSendIndication(r Request, m *stun.Message) error {
 	}
 
 	msgDst := &net.UDPAddr{IP: peerAddress.IP, Port: peerAddress.Port}
-	if perm := a.GetPermission(msgDst); perm == nil {
+	perm := a.GetPermission(msgDst)
+	if perm == nil {
 		return fmt.Errorf("%w: %v", errNoPermission, msgDst)
 	}
+	perm.Touch()
 
-	l, err := a.RelaySocket.WriteTo(dataAttr, msgDst)
+	l, err := a.WriteToPeer(dataAttr, msgDst)
 	if l != len(dataAttr) {
 		return fmt.Errorf("%w %d != %d (expected) err: %v", errShortWrite, l, len(dataAttr), err) //nolint:errorlint
 	}
@@ -316,7 +379,7 @@ func handleSendIndication(r Request, m *stun.Message) error {
 }
 
 func handleChannelBindRequest(r Request, m *stun.Message) error {
-	r.Log.Debugf("Received ChannelBindRequest from %s", r.SrcAddr)
+	fastlog.Debugw(r.Log, "Received request", "method", stun.MethodChannelBind, "src", r.SrcAddr)
 
 	a := r.AllocationManager.GetAllocation(&allocation.FiveTuple{
 		SrcAddr:  r.SrcAddr,
@@ -327,47 +390,56 @@ func handleChannelBindRequest(r Request, m *stun.Message) error {
 		return fmt.Errorf("%w %v:%v", errNoAllocationFound, r.SrcAddr, r.Conn.LocalAddr())
 	}
 
-	badRequestMsg := buildMsg(m.TransactionID, stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
+	badRequestMsg := func() []stun.Setter {
+		return buildMsg(m.TransactionID, stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
+	}
 
-	messageIntegrity, hasAuth, err := authenticateRequest(r, m, stun.MethodChannelBind)
+	messageIntegrity, _, hasAuth, err := authenticateRequest(r, m, stun.MethodChannelBind)
 	if !hasAuth {
 		return err
 	}
 
 	var channel proto.ChannelNumber
 	if err = channel.GetFrom(m); err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
 	peerAddr := proto.PeerAddress{}
 	if err = peerAddr.GetFrom(m); err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
 	if err = r.AllocationManager.GrantPermission(r.SrcAddr, peerAddr.IP); err != nil {
-		r.Log.Infof("permission denied for client %s to peer %s", r.SrcAddr, peerAddr.IP)
+		fastlog.Infow(a.Log(), "Permission denied", "method", stun.MethodChannelBind, "peer", peerAddr.IP)
+		r.audit(AuditEvent{
+			Type: AuditPermissionDenied, Method: stun.MethodChannelBind, Username: a.Username(),
+			PeerIP: peerAddr.IP, Code: stun.CodeUnauthorized, Detail: err.Error(),
+		})
 
 		unauthorizedRequestMsg := buildMsg(m.TransactionID,
 			stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse),
 			&stun.ErrorCodeAttribute{Code: stun.CodeUnauthorized})
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, unauthorizedRequestMsg...)
+		return buildAndSendErr(r, err, unauthorizedRequestMsg...)
 	}
 
-	r.Log.Debugf("Binding channel %d to %s", channel, peerAddr)
+	fastlog.Debugw(a.Log(), "Binding channel", "channel", int(channel), "peer", peerAddr)
 	err = a.AddChannelBind(allocation.NewChannelBind(
 		channel,
 		&net.UDPAddr{IP: peerAddr.IP, Port: peerAddr.Port},
-		r.Log,
+		a.Log(),
 	), r.ChannelBindTimeout)
 	if err != nil {
-		return buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
-	return buildAndSend(r.Conn, r.SrcAddr, buildMsg(m.TransactionID, stun.NewType(stun.MethodChannelBind, stun.ClassSuccessResponse), []stun.Setter{messageIntegrity}...)...)
+	msg := newResponse(m, stun.NewType(stun.MethodChannelBind, stun.ClassSuccessResponse))
+	return sendResponse(r, msg, messageIntegrity.AddTo(msg))
 }
 
 func handleChannelData(r Request, c *proto.ChannelData) error {
-	r.Log.Debugf("Received ChannelData from %s", r.SrcAddr)
+	if fastlog.Enabled(r.Log, logging.LogLevelDebug) {
+		fastlog.Debugw(r.Log, "Received ChannelData", "src", r.SrcAddr)
+	}
 
 	a := r.AllocationManager.GetAllocation(&allocation.FiveTuple{
 		SrcAddr:  r.SrcAddr,
@@ -382,8 +454,9 @@ func handleChannelData(r Request, c *proto.ChannelData) error {
 	if channel == nil {
 		return fmt.Errorf("%w %x", errNoSuchChannelBind, uint16(c.Number))
 	}
+	channel.Touch()
 
-	l, err := a.RelaySocket.WriteTo(c.Data, channel.Peer)
+	l, err := a.WriteToPeer(c.Data, channel.Peer)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errFailedWriteSocket, err.Error())
 	} else if l != len(c.Data) {
@@ -85,19 +85,21 @@ func TestAllocationLifeTime(t *testing.T) {
 		assert.NoError(t, err)
 
 		r := Request{
-			AllocationManager: allocationManager,
-			NonceHash:         nonceHash,
-			Conn:              l,
-			SrcAddr:           &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
-			Log:               logger,
-			AuthHandler: func(string, string, net.Addr) (key []byte, ok bool) {
-				return []byte(staticKey), true
+			Conn:    l,
+			SrcAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+			Config: &Config{
+				AllocationManager: allocationManager,
+				NonceHash:         nonceHash,
+				Log:               logger,
+				AuthHandler: func(string, string, net.Addr) (key []byte, ok bool) {
+					return []byte(staticKey), true
+				},
 			},
 		}
 
 		fiveTuple := &allocation.FiveTuple{SrcAddr: r.SrcAddr, DstAddr: r.Conn.LocalAddr(), Protocol: allocation.UDP}
 
-		_, err = r.AllocationManager.CreateAllocation(fiveTuple, r.Conn, 0, time.Hour)
+		_, err = r.AllocationManager.CreateAllocation(fiveTuple, r.Conn, 0, time.Hour, nil, allocation.Policy{})
 		assert.NoError(t, err)
 
 		assert.NotNil(t, r.AllocationManager.GetAllocation(fiveTuple))
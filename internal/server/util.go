@@ -7,10 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/pion/stun/v3"
 
+	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
 )
 
@@ -18,12 +22,87 @@ const (
 	maximumAllocationLifetime = time.Hour // See: https://tools.ietf.org/html/rfc5766#section-6.2 defines 3600 seconds recommendation
 )
 
-func buildAndSend(conn net.PacketConn, dst net.Addr, attrs ...stun.Setter) error {
-	msg, err := stun.Build(attrs...)
+// messagePool holds the messages requests are decoded into and responses are
+// built in, so handling a request does not allocate a message
+var messagePool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} { return new(stun.Message) },
+}
+
+// getMessage returns an empty message of the pool, to return with putMessage
+// once it is no longer used
+func getMessage() *stun.Message {
+	m := messagePool.Get().(*stun.Message) //nolint:forcetypeassert
+	m.Reset()
+	return m
+}
+
+func putMessage(m *stun.Message) {
+	messagePool.Put(m)
+}
+
+func buildAndSend(r Request, attrs ...stun.Setter) error {
+	msg := getMessage()
+	defer putMessage(msg)
+	if err := msg.Build(attrs...); err != nil {
+		return err
+	}
+
+	return send(r, msg)
+}
+
+// newResponse returns a message of the pool with the header of the response
+// of type t to m. The success responses clients send most, to Binding and
+// Refresh requests, add their attributes to it by value and send it with
+// sendResponse, instead of allocating setters for buildMsg.
+func newResponse(m *stun.Message, t stun.MessageType) *stun.Message {
+	msg := getMessage()
+	msg.Type = t
+	msg.TransactionID = m.TransactionID
+	msg.WriteHeader()
+	return msg
+}
+
+// sendResponse sends a message of newResponse unless adding its attributes
+// failed with err, and returns it to the pool
+func sendResponse(r Request, msg *stun.Message, err error) error {
+	defer putMessage(msg)
 	if err != nil {
 		return err
 	}
-	_, err = conn.WriteTo(msg.Raw, dst)
+
+	return send(r, msg)
+}
+
+// addAttributes adds attrs and then integrity to a message of newResponse
+func addAttributes(msg *stun.Message, integrity stun.Setter, attrs []stun.Setter) error {
+	for _, attr := range attrs {
+		if err := attr.AddTo(msg); err != nil {
+			return err
+		}
+	}
+	return integrity.AddTo(msg)
+}
+
+// send sends msg to the client of the request and reports it to the
+// Responded hook
+func send(r Request, msg *stun.Message) error {
+	if r.Responded != nil || r.span != nil {
+		var code stun.ErrorCode
+		if msg.Type.Class == stun.ClassErrorResponse {
+			var errorCode stun.ErrorCodeAttribute
+			if errorCode.GetFrom(msg) == nil {
+				code = errorCode.Code
+			}
+		}
+		if r.Responded != nil {
+			r.Responded(msg.Type.Method, code)
+		}
+		if r.span != nil {
+			r.span.SetResponseCode(code)
+		}
+	}
+
+	_, err := r.Conn.WriteTo(msg.Raw, r.SrcAddr)
 	if errors.Is(err, net.ErrClosed) {
 		return nil
 	}
@@ -32,73 +111,310 @@ func buildAndSend(conn net.PacketConn, dst net.Addr, attrs ...stun.Setter) error
 }
 
 // Send a STUN packet and return the original error to the caller
-func buildAndSendErr(conn net.PacketConn, dst net.Addr, err error, attrs ...stun.Setter) error {
-	if sendErr := buildAndSend(conn, dst, attrs...); sendErr != nil {
+func buildAndSendErr(r Request, err error, attrs ...stun.Setter) error {
+	if sendErr := buildAndSend(r, attrs...); sendErr != nil {
 		err = fmt.Errorf("%w %v %v", errFailedToSendError, sendErr, err) //nolint:errorlint
 	}
 	return err
 }
 
 func buildMsg(transactionID [stun.TransactionIDSize]byte, msgType stun.MessageType, additional ...stun.Setter) []stun.Setter {
-	return append([]stun.Setter{&stun.Message{TransactionID: transactionID}, msgType}, additional...)
+	return append([]stun.Setter{transactionIDSetter(transactionID), msgType}, additional...)
+}
+
+// transactionIDSetter sets the transaction ID of a response to the one of the
+// request, without a message of its own like a *stun.Message setter
+type transactionIDSetter [stun.TransactionIDSize]byte
+
+func (t transactionIDSetter) AddTo(m *stun.Message) error {
+	m.TransactionID = t
+	m.WriteTransactionID()
+	return nil
 }
 
-func authenticateRequest(r Request, m *stun.Message, callingMethod stun.Method) (stun.MessageIntegrity, bool, error) {
-	respondWithNonce := func(responseCode stun.ErrorCode) (stun.MessageIntegrity, bool, error) {
-		nonce, err := r.NonceHash.Generate()
+// authenticateRequest verifies the long-term credentials of the request. On
+// success it returns the MESSAGE-INTEGRITY or MESSAGE-INTEGRITY-SHA256 the
+// request was signed with for the response, and the allocation Policy that
+// applies to the credentials.
+func authenticateRequest(r Request, m *stun.Message, callingMethod stun.Method) (stun.Setter, allocation.Policy, bool, error) {
+	// Guests are not authenticated, and responses to them are not signed
+	if r.Guest != nil {
+		return noIntegrity{}, r.Guest.Policy, true, nil
+	}
+
+	policy := r.AllocationPolicy
+	respondWithNonce := func(responseCode stun.ErrorCode) (stun.Setter, allocation.Policy, bool, error) {
+		// Floods of unauthenticated requests are dropped before they cost a nonce
+		if r.ChallengeLimiter != nil {
+			if ip, _, err := ipnet.AddrIPPort(r.SrcAddr); err == nil && !r.ChallengeLimiter.Allow(ip) {
+				return nil, policy, false, nil
+			}
+		}
+
+		nonce, err := r.NonceHash.GenerateFor(r.SrcAddr)
 		if err != nil {
-			return nil, false, err
+			return nil, policy, false, err
 		}
 
-		return nil, false, buildAndSend(r.Conn, r.SrcAddr, buildMsg(m.TransactionID,
-			stun.NewType(callingMethod, stun.ClassErrorResponse),
+		if r.PasswordAlgorithms.advertises() {
+			nonce = passwordAlgorithmsNonceCookie + nonce
+		}
+		attrs := []stun.Setter{
 			&stun.ErrorCodeAttribute{Code: responseCode},
 			stun.NewNonce(nonce),
 			stun.NewRealm(r.Realm),
-		)...)
+		}
+		if r.PasswordAlgorithms.advertises() {
+			attrs = append(attrs, r.PasswordAlgorithms.Advertise)
+		}
+		return nil, policy, false, buildAndSend(r, buildMsg(m.TransactionID,
+			stun.NewType(callingMethod, stun.ClassErrorResponse), attrs...)...)
 	}
 
-	if !m.Contains(stun.AttrMessageIntegrity) {
+	if !m.Contains(stun.AttrMessageIntegrity) && !m.Contains(stun.AttrMessageIntegritySHA256) {
 		return respondWithNonce(stun.CodeUnauthorized)
 	}
 
-	nonceAttr := &stun.Nonce{}
-	usernameAttr := &stun.Username{}
-	realmAttr := &stun.Realm{}
-	badRequestMsg := buildMsg(m.TransactionID, stun.NewType(callingMethod, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
+	var (
+		nonceAttr    stun.Nonce
+		usernameAttr stun.Username
+		realmAttr    stun.Realm
+	)
+	// Error responses are only built when sent, authentic requests build none
+	badRequestMsg := func() []stun.Setter {
+		return buildMsg(m.TransactionID, stun.NewType(callingMethod, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeBadRequest})
+	}
 
 	// No Auth handler is set, server is running in STUN only mode
 	// Respond with 400 so clients don't retry
-	if r.AuthHandler == nil {
-		sendErr := buildAndSend(r.Conn, r.SrcAddr, badRequestMsg...)
-		return nil, false, sendErr
+	if r.AuthHandler == nil && r.PolicyAuthHandler == nil && r.MultiKeyAuthHandler == nil && r.RequestAuthHandler == nil &&
+		r.SHA256AuthHandler == nil && r.IntegrityCalculator == nil {
+		sendErr := buildAndSend(r, badRequestMsg()...)
+		return nil, policy, false, sendErr
 	}
 
 	if err := nonceAttr.GetFrom(m); err != nil {
-		return nil, false, buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return nil, policy, false, buildAndSendErr(r, err, badRequestMsg()...)
 	}
 
 	// Assert Nonce is signed and is not expired
-	if err := r.NonceHash.Validate(nonceAttr.String()); err != nil {
+	nonce := trimNonceCookie(nonceAttr.String())
+	if err := r.NonceHash.ValidateFrom(nonce, r.SrcAddr); err != nil {
 		return respondWithNonce(stun.CodeStaleNonce)
 	}
 
 	if err := realmAttr.GetFrom(m); err != nil {
-		return nil, false, buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return nil, policy, false, buildAndSendErr(r, err, badRequestMsg()...)
 	} else if err := usernameAttr.GetFrom(m); err != nil {
-		return nil, false, buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+		return nil, policy, false, buildAndSendErr(r, err, badRequestMsg()...)
+	}
+	if r.span != nil {
+		r.span.SetUsername(usernameAttr.String())
 	}
 
-	ourKey, ok := r.AuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr)
+	if r.StrictRealm && realmAttr.String() != r.Realm {
+		fastlog.Debugw(r.Log, "Refusing credentials for another realm", "method", callingMethod, "src", r.SrcAddr,
+			"username", usernameAttr, "realm", realmAttr)
+		return respondWithNonce(stun.CodeUnauthorized)
+	}
+
+	algorithm, ok := requestPasswordAlgorithm(r, m)
 	if !ok {
-		return nil, false, buildAndSendErr(r.Conn, r.SrcAddr, fmt.Errorf("%w %s", errNoSuchUser, usernameAttr.String()), badRequestMsg...)
+		return nil, policy, false, buildAndSendErr(r, errPasswordAlgorithmMismatch, badRequestMsg()...)
+	}
+	accepted := r.PasswordAlgorithms.accepts(algorithm)
+	if !accepted && (r.PasswordAlgorithms == nil || !r.PasswordAlgorithms.ReportOnly) {
+		fastlog.Debugw(r.Log, "Refusing password algorithm", "method", callingMethod, "src", r.SrcAddr,
+			"username", usernameAttr, "algorithm", algorithm)
+		r.PasswordAlgorithms.reject(usernameAttr.String(), algorithm, r.SrcAddr)
+		r.audit(AuditEvent{
+			Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(),
+			Code: stun.CodeUnauthorized, Detail: "password algorithm " + algorithm.String() + " not accepted",
+		})
+		return respondWithNonce(stun.CodeUnauthorized)
+	}
+
+	// Locked out attempts do not reach the AuthHandler
+	var srcIP net.IP
+	if r.Lockout != nil {
+		srcIP, _, _ = ipnet.AddrIPPort(r.SrcAddr)
+		if r.Lockout.Locked(usernameAttr.String(), srcIP) {
+			fastlog.Debugw(r.Log, "Refusing locked out credentials", "method", callingMethod, "src", r.SrcAddr, "username", usernameAttr)
+			auditEvent := AuditEvent{Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(), Detail: "locked out"}
+			if !r.Lockout.config.Reject {
+				r.audit(auditEvent)
+				return nil, policy, false, nil
+			}
+			auditEvent.Code = stun.CodeForbidden
+			r.audit(auditEvent)
+			return nil, policy, false, buildAndSend(r, buildMsg(m.TransactionID,
+				stun.NewType(callingMethod, stun.ClassErrorResponse),
+				&stun.ErrorCodeAttribute{Code: stun.CodeForbidden},
+			)...)
+		}
 	}
 
-	if err := stun.MessageIntegrity(ourKey).Check(m); err != nil {
-		return nil, false, buildAndSendErr(r.Conn, r.SrcAddr, err, badRequestMsg...)
+	// The cached key of the allocation saves asking the auth handlers
+	session := sessionAllocation(r, callingMethod)
+	var sessionKey []byte
+	if session != nil {
+		if key, ok := session.SessionKey(usernameAttr.String(), realmAttr.String(), algorithm); ok {
+			if requestIntegrity(m, key).Check(m) == nil {
+				sessionKey = key
+			} else {
+				session.RevokeSessionKey() // E.g. the password changed
+			}
+		}
 	}
+	verified := sessionKey != nil
 
-	return stun.MessageIntegrity(ourKey), true, nil
+	var ourKeys [][]byte
+	var integrities []messageIntegrity
+	switch {
+	case verified:
+		ourKeys, ok = [][]byte{sessionKey}, true
+	case r.IntegrityCalculator != nil:
+		integrities = []messageIntegrity{calculatedIntegrity(m, r.IntegrityCalculator, IntegrityCredentials{
+			Username:          usernameAttr.String(),
+			Realm:             realmAttr.String(),
+			PasswordAlgorithm: algorithm,
+		})}
+		ok = true
+	case algorithm == proto.PasswordAlgorithmSHA256 && r.SHA256AuthHandler != nil:
+		var ourKey []byte
+		ourKey, ok = r.SHA256AuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr)
+		ourKeys = [][]byte{ourKey}
+	case algorithm != proto.PasswordAlgorithmMD5:
+		ok = false // No key for the algorithm
+	case r.RequestAuthHandler != nil:
+		var ourKey []byte
+		var userPolicy *allocation.Policy
+		if ourKey, userPolicy, ok = r.RequestAuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr, m); ok && userPolicy != nil {
+			policy = *userPolicy
+		}
+		ourKeys = [][]byte{ourKey}
+	case r.PolicyAuthHandler != nil:
+		var ourKey []byte
+		var userPolicy *allocation.Policy
+		if ourKey, userPolicy, ok = r.PolicyAuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr); ok && userPolicy != nil {
+			policy = *userPolicy
+		}
+		ourKeys = [][]byte{ourKey}
+	case r.MultiKeyAuthHandler != nil:
+		ourKeys, ok = r.MultiKeyAuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr)
+		ok = ok && len(ourKeys) > 0
+	default:
+		var ourKey []byte
+		ourKey, ok = r.AuthHandler(usernameAttr.String(), realmAttr.String(), r.SrcAddr)
+		ourKeys = [][]byte{ourKey}
+	}
+	if !ok {
+		if r.Lockout != nil {
+			r.Lockout.Fail(usernameAttr.String(), srcIP)
+		}
+		r.audit(AuditEvent{
+			Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(),
+			Code: stun.CodeBadRequest, Detail: "unknown user",
+		})
+		return nil, policy, false, buildAndSendErr(r, fmt.Errorf("%w %s", errNoSuchUser, usernameAttr.String()), badRequestMsg()...)
+	}
+
+	for _, ourKey := range ourKeys {
+		integrities = append(integrities, requestIntegrity(m, ourKey))
+	}
+
+	// The request is authentic if any of the keys signed it
+	var err error
+	for i, integrity := range integrities {
+		if !verified {
+			err = integrity.Check(m)
+		}
+		if err == nil {
+			// Only authentic requests use the nonce up
+			if r.NonceHash.Use(nonce) != nil {
+				fastlog.Debugw(r.Log, "Refusing used up nonce", "method", callingMethod, "src", r.SrcAddr, "username", usernameAttr)
+				return respondWithNonce(stun.CodeStaleNonce)
+			}
+			if r.Lockout != nil {
+				r.Lockout.Succeed(usernameAttr.String())
+			}
+			// Expired credentials are challenged, whether the AuthHandler checks
+			// their expiry or not, so clients fetch new ones
+			if expiry, ok := credentialExpiry(r, m); ok && !time.Now().Before(expiry) {
+				fastlog.Debugw(r.Log, "Refusing expired credentials", "method", callingMethod, "src", r.SrcAddr, "username", usernameAttr)
+				if session != nil {
+					session.RevokeSessionKey()
+				}
+				r.audit(AuditEvent{
+					Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(),
+					Code: stun.CodeUnauthorized, Detail: "credentials expired",
+				})
+				return respondWithNonce(stun.CodeUnauthorized)
+			}
+			if !accepted {
+				fastlog.Debugw(r.Log, "Would refuse password algorithm", "method", callingMethod, "src", r.SrcAddr,
+					"username", usernameAttr, "algorithm", algorithm)
+				r.PasswordAlgorithms.reject(usernameAttr.String(), algorithm, r.SrcAddr)
+			}
+			if session != nil && !verified && i < len(ourKeys) {
+				session.SetSessionKey(usernameAttr.String(), realmAttr.String(), algorithm, ourKeys[i])
+			}
+			r.audit(AuditEvent{Type: AuditAuthSuccess, Method: callingMethod, Username: usernameAttr.String()})
+			return integrity, policy, true, nil
+		}
+		if r.IntegrityCalculator != nil && !errors.Is(err, stun.ErrIntegrityMismatch) {
+			// An unavailable IntegrityCalculator is no failed attempt of the user
+			r.audit(AuditEvent{
+				Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(),
+				Code: stun.CodeServerError, Detail: "integrity calculator failed",
+			})
+			return nil, policy, false, buildAndSendErr(r, err, buildMsg(m.TransactionID,
+				stun.NewType(callingMethod, stun.ClassErrorResponse), &stun.ErrorCodeAttribute{Code: stun.CodeServerError})...)
+		}
+	}
+	if r.Lockout != nil {
+		r.Lockout.Fail(usernameAttr.String(), srcIP)
+	}
+	r.audit(AuditEvent{
+		Type: AuditAuthFailure, Method: callingMethod, Username: usernameAttr.String(),
+		Code: stun.CodeBadRequest, Detail: "integrity check failed",
+	})
+	return nil, policy, false, buildAndSendErr(r, err, badRequestMsg()...)
+}
+
+// sessionAllocation returns the allocation whose session key may authenticate
+// the request. Allocate requests are always authenticated by the auth handlers,
+// which return the policy of the allocation.
+func sessionAllocation(r Request, callingMethod stun.Method) *allocation.Allocation {
+	if !r.SessionKeys || r.IntegrityCalculator != nil || callingMethod == stun.MethodAllocate {
+		return nil
+	}
+	return r.AllocationManager.GetAllocation(&allocation.FiveTuple{
+		SrcAddr:  r.SrcAddr,
+		DstAddr:  r.Conn.LocalAddr(),
+		Protocol: allocation.UDP,
+	})
+}
+
+// credentialExpiry returns when the credentials of the request expire, if
+// the CredentialExpiry handler tells
+func credentialExpiry(r Request, m *stun.Message) (time.Time, bool) {
+	if r.CredentialExpiry == nil {
+		return time.Time{}, false
+	}
+	var username stun.Username
+	if err := username.GetFrom(m); err != nil {
+		return time.Time{}, false
+	}
+	return r.CredentialExpiry(username.String())
+}
+
+// lifetimeUntil caps the lifetime of an allocation so it ends at expiry
+func lifetimeUntil(lifetime time.Duration, expiry time.Time) time.Duration {
+	if remaining := time.Until(expiry); remaining < lifetime {
+		return remaining
+	}
+	return lifetime
 }
 
 func allocationLifeTime(m *stun.Message) time.Duration {
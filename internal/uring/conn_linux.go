@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package uring
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pion/transport/v3/deadline"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/ipnet"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// receives is the number of receives every Conn keeps in flight, so a busy
+	// socket completes several datagrams per round of the reaper
+	receives = 8
+
+	defaultQueueSize = 256
+)
+
+var errNotUDP = errors.New("address is not a UDP address")
+
+type datagram struct {
+	data *[]byte
+	from netip.AddrPort
+}
+
+// Conn is a net.PacketConn that reads and writes a UDP socket through a Ring
+// instead of the Go runtime. Datagrams are received ahead into a queue, the
+// datagrams that arrive while it is full are dropped.
+type Conn struct {
+	ring *Ring
+	conn *net.UDPConn
+	fd   int
+	ipv4 bool // Family of the socket
+	pool *bufpool.Pool
+
+	lock     sync.Mutex // Guards closed and the ids of the receives
+	recvs    [receives]*request
+	closed   bool
+	inFlight sync.WaitGroup
+
+	datagrams    chan datagram
+	closeCh      chan struct{}
+	closeOnce    sync.Once
+	readDeadline *deadline.Deadline
+
+	writes sync.Pool
+}
+
+type writeRequest struct {
+	request
+	res chan int32
+}
+
+// NewConn reads and writes conn through the ring from now on, and closes it
+// with the Conn. Datagrams larger than bufferSize are dropped.
+func NewConn(ring *Ring, conn *net.UDPConn, bufferSize int) (*Conn, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	// The descriptor stays valid until conn is closed, after the last receive
+	fd, domain := -1, 0
+	if err := raw.Control(func(s uintptr) {
+		fd = int(s)
+		domain, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+	}); err != nil {
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		ring:         ring,
+		conn:         conn,
+		fd:           fd,
+		ipv4:         domain == unix.AF_INET,
+		pool:         bufpool.New(bufferSize),
+		datagrams:    make(chan datagram, defaultQueueSize),
+		closeCh:      make(chan struct{}),
+		readDeadline: deadline.New(),
+	}
+	c.writes.New = func() interface{} {
+		return &writeRequest{res: make(chan int32, 1)}
+	}
+
+	c.lock.Lock()
+	for i := range c.recvs {
+		req := &request{buf: make([]byte, bufferSize)}
+		req.complete = func(res int32) { c.received(req, res) }
+		req.iov.Base = &req.buf[0]
+		req.iov.SetLen(len(req.buf))
+		if err := c.receive(req, i == len(c.recvs)-1); err != nil {
+			c.closed = true
+			ids := c.receiveIDs()
+			c.lock.Unlock()
+			c.ring.cancel(ids)
+			c.inFlight.Wait()
+			return nil, err
+		}
+		c.recvs[i] = req
+	}
+	c.lock.Unlock()
+	return c, nil
+}
+
+// receive submits req, flushed with the last receive of a batch. Called with
+// the lock held.
+func (c *Conn) receive(req *request, flush bool) error {
+	req.msg = unix.Msghdr{Name: (*byte)(unsafe.Pointer(&req.addr)), Namelen: unix.SizeofSockaddrAny, Iov: &req.iov}
+	req.msg.SetIovlen(1)
+	c.inFlight.Add(1)
+	// MSG_TRUNC returns the length of truncated datagrams, which are dropped
+	s := sqe{opcode: opRecvmsg, fd: int32(c.fd), addr: uint64(uintptr(unsafe.Pointer(&req.msg))), len: 1, opFlags: unix.MSG_TRUNC}
+	if err := c.ring.submit(req, s, flush); err != nil {
+		c.inFlight.Done()
+		return err
+	}
+	return nil
+}
+
+// received is called by the reaper with the result of a receive, which it
+// submits again. The reaper submits it with its next round.
+func (c *Conn) received(req *request, res int32) {
+	if res >= 0 && int(res) <= len(req.buf) {
+		if from, ok := ipnet.SockaddrAddrPort(&req.addr); ok {
+			select {
+			case c.datagrams <- datagram{data: c.pool.Copy(req.buf[:res]), from: from}:
+			default: // Dropped like by a full socket buffer
+			}
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inFlight.Done()
+	if c.closed || res == -int32(unix.ECANCELED) {
+		return
+	}
+	if err := c.receive(req, false); err != nil {
+		c.closeOnce.Do(func() { close(c.closeCh) })
+	}
+}
+
+// ReadFrom reads a datagram received ahead
+func (c *Conn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closeCh:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	default:
+	}
+	select {
+	case d := <-c.datagrams:
+		return c.copyDatagram(p, d)
+	default:
+	}
+
+	select {
+	case d := <-c.datagrams:
+		return c.copyDatagram(p, d)
+	case <-c.closeCh:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	case <-c.ring.closing:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: net.ErrClosed}
+	case <-c.readDeadline.Done():
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Source: c.LocalAddr(), Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// Buffered returns the number of datagrams received ahead, which ReadFrom
+// returns without waiting
+func (c *Conn) Buffered() int {
+	return len(c.datagrams)
+}
+
+func (c *Conn) copyDatagram(p []byte, d datagram) (int, net.Addr, error) {
+	n := copy(p, *d.data)
+	c.pool.Put(d.data)
+	return n, net.UDPAddrFromAddrPort(d.from), nil
+}
+
+// WriteTo sends a datagram and waits for it to be sent
+func (c *Conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: errNotUDP}
+	}
+
+	req := c.writes.Get().(*writeRequest) //nolint:forcetypeassert
+	defer c.writes.Put(req)
+	if req.complete == nil {
+		req.complete = func(res int32) { req.res <- res }
+	}
+	namelen := ipnet.PutSockaddr(&req.addr, udpAddr.AddrPort(), c.ipv4)
+	req.buf = p
+	if len(p) > 0 {
+		req.iov.Base = &p[0]
+	} else {
+		req.iov.Base = nil
+	}
+	req.iov.SetLen(len(p))
+	req.msg = unix.Msghdr{Name: (*byte)(unsafe.Pointer(&req.addr)), Namelen: namelen, Iov: &req.iov}
+	req.msg.SetIovlen(1)
+	defer func() { req.buf = nil }()
+
+	if err := c.ring.submit(&req.request, sqe{opcode: opSendmsg, fd: int32(c.fd), addr: uint64(uintptr(unsafe.Pointer(&req.msg))), len: 1}, true); err != nil {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: err}
+	}
+	if res := <-req.res; res < 0 {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.LocalAddr(), Addr: addr, Err: os.NewSyscallError("sendmsg", unix.Errno(-res))}
+	}
+	return len(p), nil
+}
+
+// Close cancels the receives in flight and closes the socket
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return c.conn.Close()
+	}
+	c.closed = true
+	c.closeOnce.Do(func() { close(c.closeCh) })
+	ids := c.receiveIDs()
+	c.lock.Unlock()
+	c.ring.cancel(ids)
+
+	// The kernel must be done with the buffers and the socket
+	c.inFlight.Wait()
+	return c.conn.Close()
+}
+
+// receiveIDs returns the ids of the receives in flight. Called with the lock
+// held, once closed keeps them from being submitted again.
+func (c *Conn) receiveIDs() []uint64 {
+	ids := make([]uint64, 0, len(c.recvs))
+	for _, req := range c.recvs {
+		if req != nil {
+			ids = append(ids, req.id)
+		}
+	}
+	return ids
+}
+
+// LocalAddr returns the address of the socket
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// SetDeadline sets the read deadline, writes do not time out
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of ReadFrom
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes do not time out
+func (c *Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package uring
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRing(t *testing.T) *Ring {
+	t.Helper()
+	ring, err := NewRing(0)
+	if err != nil {
+		t.Skipf("io_uring is unavailable: %s", err)
+	}
+	return ring
+}
+
+func TestConn(t *testing.T) {
+	ring := newTestRing(t)
+
+	for _, network := range []string{"udp4", "udp6"} {
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "udp6" {
+				addr = "[::1]:0"
+			}
+			udpConn, err := net.ListenUDP(network, net.UDPAddrFromAddrPort(netip.MustParseAddrPort(addr)))
+			if err != nil {
+				t.Skipf("%s is unavailable: %s", network, err)
+			}
+			peer, err := net.ListenPacket(network, addr)
+			require.NoError(t, err)
+			defer peer.Close() //nolint:errcheck
+
+			conn, err := NewConn(ring, udpConn, 64)
+			require.NoError(t, err)
+
+			// More datagrams than receives in flight, in order
+			for i := 0; i < 3*receives; i++ {
+				_, err = peer.WriteTo([]byte(fmt.Sprintf("datagram %d", i)), conn.LocalAddr())
+				require.NoError(t, err)
+				if i == receives {
+					// Too large for the buffers, dropped
+					_, err = peer.WriteTo(make([]byte, 65), conn.LocalAddr())
+					require.NoError(t, err)
+				}
+			}
+			buf := make([]byte, 128)
+			for i := 0; i < 3*receives; i++ {
+				n, from, err := conn.ReadFrom(buf)
+				require.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("datagram %d", i), string(buf[:n]))
+				assert.Equal(t, peer.LocalAddr().String(), from.String())
+			}
+
+			n, err := conn.WriteTo([]byte("reply"), peer.LocalAddr())
+			require.NoError(t, err)
+			assert.Equal(t, 5, n)
+			n, from, err := peer.ReadFrom(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "reply", string(buf[:n]))
+			assert.Equal(t, conn.LocalAddr().String(), from.String())
+
+			assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+			_, _, err = conn.ReadFrom(buf)
+			var netErr net.Error
+			assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "the read should time out")
+
+			assert.NoError(t, conn.Close())
+			_, _, err = conn.ReadFrom(buf)
+			assert.ErrorIs(t, err, net.ErrClosed)
+		})
+	}
+
+	t.Run("RingClosed", func(t *testing.T) {
+		udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		conn, err := NewConn(ring, udpConn, 64)
+		require.NoError(t, err)
+
+		// The receives in flight are canceled
+		assert.NoError(t, ring.Close())
+		_, _, err = conn.ReadFrom(make([]byte, 64))
+		assert.ErrorIs(t, err, net.ErrClosed)
+		_, err = conn.WriteTo([]byte("late"), udpConn.LocalAddr())
+		assert.ErrorIs(t, err, errClosed)
+		assert.NoError(t, conn.Close())
+
+		_, err = NewConn(ring, udpConn, 64)
+		assert.Error(t, err)
+	})
+}
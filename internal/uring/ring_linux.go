@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+// Package uring does the socket I/O of the server through an io_uring(7) of
+// the kernel. The datagrams of all sockets sharing a Ring complete into one
+// queue, which is drained and refilled with receives a batch at a time instead
+// of a system call per datagram.
+package uring
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultEntries = 256
+
+	opNop         = 0
+	opSendmsg     = 9
+	opRecvmsg     = 10
+	opAsyncCancel = 14
+
+	enterGetEvents = 1 << 0
+	featNoDrop     = 1 << 1
+
+	offSQRing = 0
+	offCQRing = 0x8000000
+	offSQEs   = 0x10000000
+
+	// ignoredID is the user data of the operations nobody waits for
+	ignoredID = 0
+)
+
+var (
+	errClosed      = errors.New("ring closed")
+	errQueueFull   = errors.New("submission queue full")
+	errUnsupported = errors.New("kernel does not keep completions on overflow, Linux 5.5 or later is required")
+)
+
+type sqOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type cqOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// params is struct io_uring_params
+type params struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqOffsets
+	cqOff                                                                  cqOffsets
+}
+
+// sqe is struct io_uring_sqe
+type sqe struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	_           uint64
+}
+
+// cqe is struct io_uring_cqe
+type cqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// request is an operation in flight. The ring references it until it
+// completes, so the memory the kernel reads and writes stays alive.
+type request struct {
+	msg  unix.Msghdr
+	iov  unix.Iovec
+	addr unix.RawSockaddrAny
+	buf  []byte
+
+	id       uint64
+	complete func(res int32)
+}
+
+// Ring is an io_uring with a goroutine reaping its completions
+type Ring struct {
+	fd                   int
+	sqMem, cqMem, sqeMem []byte
+
+	sqHead, sqTail *uint32
+	sqArray        []uint32
+	sqes           []sqe
+	sqEntries      uint32
+
+	cqHead, cqTail *uint32
+	cqes           []cqe
+	cqMask         uint32
+
+	lock    sync.Mutex // Guards the submission queue, pending and closed
+	pending map[uint64]*request
+	nextID  uint64
+	closed  bool
+
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRing creates a ring with room for entries submissions at a time, 256 if
+// entries is 0. It fails where io_uring is unavailable or disabled, e.g. by
+// the kernel.io_uring_disabled sysctl or a seccomp filter.
+func NewRing(entries uint32) (*Ring, error) {
+	if entries == 0 {
+		entries = defaultEntries
+	}
+
+	var p params
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r := &Ring{
+		fd:      int(fd),
+		pending: map[uint64]*request{},
+		nextID:  ignoredID + 1,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if p.features&featNoDrop == 0 {
+		_ = r.release()
+		return nil, errUnsupported
+	}
+	if err := r.mmap(&p); err != nil {
+		_ = r.release()
+		return nil, err
+	}
+
+	go r.run()
+	return r, nil
+}
+
+func (r *Ring) mmap(p *params) (err error) {
+	r.sqMem, err = unix.Mmap(r.fd, offSQRing, int(p.sqOff.array+p.sqEntries*4), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	r.cqMem, err = unix.Mmap(r.fd, offCQRing, int(p.cqOff.cqes+p.cqEntries*uint32(unsafe.Sizeof(cqe{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	r.sqeMem, err = unix.Mmap(r.fd, offSQEs, int(p.sqEntries*uint32(unsafe.Sizeof(sqe{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.tail]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*sqe)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+	r.sqEntries = p.sqEntries
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.tail]))
+	r.cqes = unsafe.Slice((*cqe)(unsafe.Pointer(&r.cqMem[p.cqOff.cqes])), p.cqEntries)
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.ringMask]))
+	return nil
+}
+
+// Close cancels the operations in flight and releases the ring. Conns of the
+// ring fail from then on.
+func (r *Ring) Close() (err error) {
+	r.lock.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.closing)
+		ids := make([]uint64, 0, len(r.pending))
+		for id := range r.pending {
+			ids = append(ids, id)
+		}
+		for _, id := range ids {
+			r.queueWait(sqe{opcode: opAsyncCancel, fd: -1, addr: id})
+		}
+		// Wakes the reaper even if nothing is in flight
+		r.queueWait(sqe{opcode: opNop, fd: -1})
+		r.flush()
+	}
+	r.lock.Unlock()
+
+	<-r.done
+	r.closeOnce.Do(func() {
+		err = r.release()
+	})
+	return err
+}
+
+func (r *Ring) release() error {
+	var errs []error
+	for _, mem := range [][]byte{r.sqeMem, r.cqMem, r.sqMem} {
+		if mem != nil {
+			errs = append(errs, unix.Munmap(mem))
+		}
+	}
+	return errors.Join(append(errs, unix.Close(r.fd))...)
+}
+
+// submit queues the operation of s for req. The operation is started right
+// away with flush, otherwise on the next round of the reaper, which saves the
+// system call for callbacks of completions.
+func (r *Ring) submit(req *request, s sqe, flush bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return errClosed
+	}
+
+	s.userData = r.nextID
+	if !r.queueLocked(s) {
+		return errQueueFull
+	}
+	req.id = r.nextID
+	r.nextID++
+	r.pending[req.id] = req
+	if flush {
+		r.flush()
+	}
+	return nil
+}
+
+// cancel asks the kernel to complete the requests early. Requests that
+// already completed are not affected.
+func (r *Ring) cancel(ids []uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, id := range ids {
+		if r.closed { // Close cancels everything
+			return
+		}
+		r.queueWait(sqe{opcode: opAsyncCancel, fd: -1, addr: id})
+	}
+	r.flush()
+}
+
+// queueLocked adds s to the submission queue, false if the kernel does not
+// make room for it
+func (r *Ring) queueLocked(s sqe) bool {
+	tail := *r.sqTail
+	if tail-atomic.LoadUint32(r.sqHead) == r.sqEntries {
+		r.flush()
+		if tail-atomic.LoadUint32(r.sqHead) == r.sqEntries {
+			return false
+		}
+	}
+	idx := tail & (r.sqEntries - 1)
+	r.sqes[idx] = s
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	return true
+}
+
+// queueWait queues s, releasing the lock while the reaper makes room
+func (r *Ring) queueWait(s sqe) {
+	for !r.queueLocked(s) {
+		r.lock.Unlock()
+		runtime.Gosched()
+		r.lock.Lock()
+	}
+}
+
+// flush starts the queued operations. Those the kernel can not take yet, while
+// completions are backed up, are taken on the next round of the reaper.
+func (r *Ring) flush() {
+	_ = r.enter(0, 0)
+}
+
+// enter submits every queued operation and waits for minComplete completions
+func (r *Ring) enter(minComplete, flags uint32) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(r.sqEntries), uintptr(minComplete), uintptr(flags), 0, 0)
+		switch errno {
+		case 0:
+			return nil
+		case unix.EINTR:
+			continue
+		default:
+			return errno
+		}
+	}
+}
+
+// run reaps completions until the ring is closed and nothing is in flight
+func (r *Ring) run() {
+	defer close(r.done)
+
+	for {
+		switch err := r.enter(1, enterGetEvents); {
+		case err == nil, errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EBUSY):
+		default:
+			r.fail()
+			return
+		}
+
+		head, tail := *r.cqHead, atomic.LoadUint32(r.cqTail)
+		for ; head != tail; head++ {
+			c := r.cqes[head&r.cqMask]
+			atomic.StoreUint32(r.cqHead, head+1)
+			if c.userData == ignoredID {
+				continue
+			}
+
+			r.lock.Lock()
+			req := r.pending[c.userData]
+			delete(r.pending, c.userData)
+			r.lock.Unlock()
+			if req != nil {
+				req.complete(c.res)
+			}
+		}
+
+		r.lock.Lock()
+		exit := r.closed && len(r.pending) == 0
+		r.lock.Unlock()
+		if exit {
+			return
+		}
+	}
+}
+
+// fail completes the requests the ring can no longer wait for
+func (r *Ring) fail() {
+	r.lock.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.closing)
+	}
+	pending := r.pending
+	r.pending = map[uint64]*request{}
+	r.lock.Unlock()
+
+	for _, req := range pending {
+		req.complete(-int32(unix.ECANCELED))
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package xdp manages the maps of the XDP program that relays the ChannelData
+// of established channel bindings in the kernel, see
+// examples/turn-server/xdp/bpf/channeldata.c
+package xdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+var errNotIPv4 = errors.New("only specified IPv4 UDP addresses can be offloaded")
+
+const (
+	// ChannelsMap is the pinned map from ClientSide to PeerSide
+	ChannelsMap = "turn_channels"
+	// PeersMap is the pinned map from PeerSide to ClientSide
+	PeersMap = "turn_peers"
+
+	// ClientSideSize and PeerSideSize are the sizes of the map keys and values
+	ClientSideSize = 16
+	PeerSideSize   = 12
+)
+
+// ClientSide is a channel as the client sees it, the ChannelData it sends to
+// the server. Addresses and the number are stored in network byte order, the
+// way the program reads them from the packet.
+type ClientSide struct {
+	Client *net.UDPAddr
+	Server *net.UDPAddr
+	Number uint16
+}
+
+// PeerSide is a channel as the peer sees it, the datagrams it sends to the
+// relayed transport address
+type PeerSide struct {
+	Peer  *net.UDPAddr
+	Relay *net.UDPAddr
+}
+
+// MarshalBinary encodes c as struct client_side
+func (c ClientSide) MarshalBinary() ([]byte, error) {
+	b := make([]byte, ClientSideSize)
+	if err := putAddrs(b, c.Client, c.Server); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[12:], c.Number)
+	return b, nil
+}
+
+// MarshalBinary encodes p as struct peer_side
+func (p PeerSide) MarshalBinary() ([]byte, error) {
+	b := make([]byte, PeerSideSize)
+	if err := putAddrs(b, p.Peer, p.Relay); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// putAddrs stores the IPs of a and b followed by their ports
+func putAddrs(dst []byte, a, b *net.UDPAddr) error {
+	for i, addr := range []*net.UDPAddr{a, b} {
+		if addr == nil || addr.IP.To4() == nil || addr.IP.IsUnspecified() || addr.Port == 0 {
+			return errNotIPv4
+		}
+		copy(dst[4*i:], addr.IP.To4())
+		binary.BigEndian.PutUint16(dst[8+2*i:], uint16(addr.Port))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package xdp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalFlow(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478}
+	relay := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 49152}
+	peer := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 6000}
+
+	b, err := ClientSide{Client: client, Server: server, Number: 0x4001}.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		192, 0, 2, 1, 198, 51, 100, 1,
+		0xc3, 0x50, 0x0d, 0x96,
+		0x40, 0x01, 0, 0,
+	}, b)
+
+	b, err = PeerSide{Peer: peer, Relay: relay}.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		203, 0, 113, 7, 198, 51, 100, 1,
+		0x17, 0x70, 0xc0, 0x00,
+	}, b)
+
+	for _, addr := range []*net.UDPAddr{
+		nil,
+		{IP: net.IPv4zero, Port: 3478},
+		{IP: net.ParseIP("2001:db8::1"), Port: 3478},
+		{IP: net.IPv4(192, 0, 2, 1)},
+	} {
+		_, err = PeerSide{Peer: peer, Relay: addr}.MarshalBinary()
+		assert.ErrorIs(t, err, errNotIPv4, addr)
+	}
+}
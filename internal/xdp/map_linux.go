@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package xdp
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Commands of bpf(2)
+const (
+	bpfMapUpdateElem  = 2
+	bpfMapDeleteElem  = 3
+	bpfObjGet         = 7
+	bpfObjGetInfoByFD = 15
+
+	bpfAny = 0
+)
+
+var errMapLayout = errors.New("pinned map does not match the program")
+
+// Map is a pinned BPF map, opened by path
+type Map struct {
+	fd int
+}
+
+type objGetAttr struct {
+	pathname  uint64
+	bpfFD     uint32
+	fileFlags uint32
+}
+
+type mapElemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+type infoAttr struct {
+	bpfFD   uint32
+	infoLen uint32
+	info    uint64
+}
+
+// The head of struct bpf_map_info
+type mapInfo struct {
+	mapType   uint32
+	id        uint32
+	keySize   uint32
+	valueSize uint32
+}
+
+// OpenPinnedMap opens the map pinned at path, which must have keys and values
+// of the given sizes
+func OpenPinnedMap(path string, keySize, valueSize int) (*Map, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	attr := objGetAttr{pathname: uint64(uintptr(unsafe.Pointer(p)))}
+	fd, err := bpf(bpfObjGet, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	m := &Map{fd: int(fd)}
+	var info mapInfo
+	infoAttr := infoAttr{bpfFD: uint32(fd), infoLen: uint32(unsafe.Sizeof(info)), info: uint64(uintptr(unsafe.Pointer(&info)))}
+	if _, err := bpf(bpfObjGetInfoByFD, unsafe.Pointer(&infoAttr), unsafe.Sizeof(infoAttr)); err != nil {
+		_ = m.Close()
+		return nil, err
+	}
+	if info.keySize != uint32(keySize) || info.valueSize != uint32(valueSize) {
+		_ = m.Close()
+		return nil, fmt.Errorf("%w: %s", errMapLayout, path)
+	}
+	return m, nil
+}
+
+// Update creates or replaces the value of key
+func (m *Map) Update(key, value []byte) error {
+	attr := mapElemAttr{
+		mapFD: uint32(m.fd),
+		key:   uint64(uintptr(unsafe.Pointer(&key[0]))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+		flags: bpfAny,
+	}
+	_, err := bpf(bpfMapUpdateElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// Delete removes key, which does not need to exist
+func (m *Map) Delete(key []byte) error {
+	attr := mapElemAttr{mapFD: uint32(m.fd), key: uint64(uintptr(unsafe.Pointer(&key[0])))}
+	_, err := bpf(bpfMapDeleteElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	return err
+}
+
+// Close closes the map, which stays pinned
+func (m *Map) Close() error {
+	return unix.Close(m.fd)
+}
+
+func bpf(cmd uintptr, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/logging"
+)
+
+// ioEngine takes the I/O of the UDP sockets of a server over from the Go runtime
+type ioEngine interface {
+	// wrap returns the conn to use in place of conn, which it closes. Conns the
+	// engine does not support are returned as they are.
+	wrap(conn net.PacketConn) net.PacketConn
+	Close() error
+}
+
+// newIOEngine returns nil for IOEngineStandard
+func newIOEngine(engine IOEngine, bufferSize int, log logging.LeveledLogger) (ioEngine, error) {
+	switch engine {
+	case IOEngineStandard:
+		return nil, nil
+	case IOEngineIOURing:
+		return newIOURing(bufferSize, log)
+	case IOEngineEpoll:
+		return newIOEpoll(bufferSize, log)
+	default:
+		return nil, errInvalidIOEngine
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayThroughIOEngine relays through a server with the engine in both directions,
+// wrapped tells the conns of the engine apart
+func relayThroughIOEngine(t *testing.T, engine IOEngine, wrapped func(net.PacketConn) bool) {
+	t.Helper()
+	relayThroughServer(t, func(config *ServerConfig) { config.IOEngine = engine }, wrapped)
+}
+
+// relayThroughServer relays through a server with the configuration in both
+// directions, wrapped tells the listener apart
+func relayThroughServer(t *testing.T, configure func(*ServerConfig), wrapped func(net.PacketConn) bool) {
+	t.Helper()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	config := ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	}
+	configure(&config)
+	server, err := NewServer(config)
+	require.NoError(t, err)
+	assert.True(t, wrapped(server.packetConnConfigs[0].PacketConn), "the listener should be read by the engine")
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client, err := NewClient(&ClientConfig{
+		STUNServerAddr: serverConn.LocalAddr().String(),
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "alice",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	// Through the relay socket in both directions
+	buf := make([]byte, 1500)
+	_, err = relayConn.WriteTo([]byte("to peer"), peer.LocalAddr())
+	require.NoError(t, err)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, relayAddr, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "to peer", string(buf[:n]))
+	assert.Equal(t, relayConn.LocalAddr().String(), relayAddr.String())
+
+	_, err = peer.WriteTo([]byte("to client"), relayAddr)
+	require.NoError(t, err)
+	require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err := relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "to client", string(buf[:n]))
+	assert.Equal(t, peer.LocalAddr().String(), from.String())
+
+	assert.NoError(t, server.Close())
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+import "github.com/pion/logging"
+
+// newIOEpoll fails on platforms other than Linux
+func newIOEpoll(int, logging.LeveledLogger) (ioEngine, error) {
+	return nil, errEpollUnsupported
+}
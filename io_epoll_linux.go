@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/epoll"
+)
+
+// ioEpoll reads UDP sockets from an event loop per CPU, the sockets are spread
+// over the loops in turn
+type ioEpoll struct {
+	loops []*epoll.Loop
+	next  atomic.Uint32
+	log   logging.LeveledLogger
+}
+
+func newIOEpoll(bufferSize int, log logging.LeveledLogger) (ioEngine, error) {
+	e := &ioEpoll{log: log}
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		loop, err := epoll.NewLoop(bufferSize)
+		if err != nil {
+			return nil, errors.Join(err, e.Close())
+		}
+		e.loops = append(e.loops, loop)
+	}
+	return e, nil
+}
+
+func (e *ioEpoll) wrap(conn net.PacketConn) net.PacketConn {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return conn
+	}
+	loop := e.loops[(e.next.Add(1)-1)%uint32(len(e.loops))]
+	wrapped, err := epoll.NewConn(loop, udpConn)
+	if err != nil {
+		e.log.Warnf("Failed to use epoll for %s, falling back to the Go runtime: %s", conn.LocalAddr(), err)
+		return conn
+	}
+	return wrapped
+}
+
+func (e *ioEpoll) Close() error {
+	var errs []error
+	for _, loop := range e.loops {
+		errs = append(errs, loop.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/turn/v4/internal/epoll"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIOEpoll(t *testing.T) {
+	relayThroughIOEngine(t, IOEngineEpoll, func(conn net.PacketConn) bool {
+		_, ok := conn.(*epoll.Conn)
+		return ok
+	})
+}
+
+func TestSharedRelayReaders(t *testing.T) {
+	for _, engine := range []IOEngine{IOEngineStandard, IOEngineEpoll} {
+		var relaySockets []net.PacketConn
+		relayThroughServer(t, func(config *ServerConfig) {
+			config.IOEngine = engine
+			config.SharedRelayReaders = true
+			config.OnAllocationCreated = func(a ServerAllocation) {
+				relaySockets = append(relaySockets, a.allocation.RelaySocket)
+			}
+		}, func(conn net.PacketConn) bool {
+			_, ok := conn.(*epoll.Conn)
+			return ok == (engine == IOEngineEpoll)
+		})
+
+		if assert.Len(t, relaySockets, 1) {
+			_, ok := relaySockets[0].(*epoll.Conn)
+			assert.True(t, ok, "the relay socket should be read by a loop with %v", engine)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/uring"
+)
+
+// ioURing reads and writes UDP sockets through a single io_uring
+type ioURing struct {
+	ring       *uring.Ring
+	bufferSize int
+	log        logging.LeveledLogger
+}
+
+func newIOURing(bufferSize int, log logging.LeveledLogger) (ioEngine, error) {
+	ring, err := uring.NewRing(0)
+	if err != nil {
+		return nil, err
+	}
+	return &ioURing{ring: ring, bufferSize: bufferSize, log: log}, nil
+}
+
+func (e *ioURing) wrap(conn net.PacketConn) net.PacketConn {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return conn
+	}
+	wrapped, err := uring.NewConn(e.ring, udpConn, e.bufferSize)
+	if err != nil {
+		e.log.Warnf("Failed to use io_uring for %s, falling back to the Go runtime: %s", conn.LocalAddr(), err)
+		return conn
+	}
+	return wrapped
+}
+
+func (e *ioURing) Close() error {
+	return e.ring.Close()
+}
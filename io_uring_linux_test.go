@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/turn/v4/internal/uring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIOURing(t *testing.T) {
+	_, err := NewServer(ServerConfig{IOEngine: 5, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidIOEngine)
+
+	ring, err := uring.NewRing(0)
+	if err != nil {
+		t.Skipf("io_uring is unavailable: %s", err)
+	}
+	assert.NoError(t, ring.Close())
+
+	relayThroughIOEngine(t, IOEngineIOURing, func(conn net.PacketConn) bool {
+		_, ok := conn.(*uring.Conn)
+		return ok
+	})
+}
@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// JWTAuthConfig configures an AuthHandler for TURN credentials that carry a JSON Web
+// Token, see NewJWTAuthHandler
+type JWTAuthConfig struct {
+	// SharedSecret derives the TURN password from the token, see GenerateJWTTURNCredentials
+	SharedSecret string
+
+	// VerificationKey checks the signature of the tokens: a []byte secret for HS256,
+	// an *rsa.PublicKey for RS256 or an *ecdsa.PublicKey on P-256 for ES256. Tokens
+	// signed with any other algorithm are rejected.
+	VerificationKey crypto.PublicKey
+
+	// Audience must be among the "aud" of a token
+	Audience string
+
+	// Issuer must be the "iss" of a token, unless it is empty
+	Issuer string
+
+	// Leeway tolerates clock skew between the issuer and the server when checking
+	// "exp" and "nbf"
+	Leeway time.Duration
+
+	Log logging.LeveledLogger
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// GenerateJWTTURNCredentials returns the TURN credentials for a token issued for
+// a NewJWTAuthHandler: the token itself is the username, the password its
+// HMAC-SHA1 with the shared secret, like GenerateLongTermTURNRESTCredentials
+func GenerateJWTTURNCredentials(sharedSecret, token string) (string, string, error) {
+	password, err := longTermCredentials(token, sharedSecret)
+	return token, password, err
+}
+
+// NewJWTAuthHandler returns a turn.AuthHandler for credentials generated with
+// GenerateJWTTURNCredentials. It accepts a token as long as its signature, "aud",
+// "iss", "exp" and "nbf" are valid; "exp" is required.
+//
+// A TURN server never receives the password, only a proof that the client knows it,
+// so the token is carried in the username and the password keeps others from using
+// it. Every request of an allocation is authenticated again, so an allocation can
+// not be refreshed once its token expired.
+//
+// STUN limits usernames to 513 bytes, which leaves room for the few claims needed.
+func NewJWTAuthHandler(config JWTAuthConfig) (AuthHandler, error) {
+	if config.SharedSecret == "" || config.Audience == "" {
+		return nil, errInvalidJWTConfig
+	}
+	switch key := config.VerificationKey.(type) {
+	case []byte:
+		if len(key) == 0 {
+			return nil, errInvalidJWTConfig
+		}
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().Name != "P-256" {
+			return nil, errInvalidJWTConfig
+		}
+	default:
+		return nil, errInvalidJWTConfig
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	return func(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+		config.Log.Tracef("Authentication realm=%q srcAddr=%v", realm, srcAddr)
+		claims, err := verifyJWT(username, &config, time.Now())
+		if err != nil {
+			config.Log.Errorf("Invalid token from %v: %s", srcAddr, err)
+			return nil, false
+		}
+		config.Log.Tracef("Authenticated sub=%q", claims.Subject)
+
+		password, err := longTermCredentials(username, config.SharedSecret)
+		if err != nil {
+			config.Log.Error(err.Error())
+			return nil, false
+		}
+		return GenerateAuthKey(username, realm, password), true
+	}, nil
+}
+
+// verifyJWT validates the signature and claims of a compact serialized token
+func verifyJWT(token string, config *JWTAuthConfig, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	if err := verifyJWTSignature(header.Alg, parts[0]+"."+parts[1], signature, config.VerificationKey); err != nil {
+		return nil, err
+	}
+
+	// The claims are only looked at once the token is known to be authentic
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil || now.After(jwtTime(*claims.ExpiresAt).Add(config.Leeway)) {
+		return nil, errJWTExpired
+	}
+	if claims.NotBefore != nil && now.Add(config.Leeway).Before(jwtTime(*claims.NotBefore)) {
+		return nil, errJWTNotYetValid
+	}
+	if config.Issuer != "" && claims.Issuer != config.Issuer {
+		return nil, errJWTIssuer
+	}
+	if !jwtHasAudience(claims.Audience, config.Audience) {
+		return nil, errJWTAudience
+	}
+	return &claims, nil
+}
+
+func verifyJWTSignature(alg, signed string, signature []byte, key crypto.PublicKey) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	// The algorithm must match the type of the key, so a token can not make the
+	// server use e.g. an RSA public key as HMAC secret
+	switch key := key.(type) {
+	case []byte:
+		if alg != "HS256" {
+			return errJWTAlgorithm
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed)) //nolint:errcheck,gosec
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errJWTSignature
+		}
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return errJWTAlgorithm
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errJWTSignature
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return errJWTAlgorithm
+		}
+		if len(signature) != 64 {
+			return errJWTSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errJWTSignature
+		}
+	default:
+		return errJWTAlgorithm
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+// jwtHasAudience tells if the "aud" claim, a string or an array of strings, contains audience
+func jwtHasAudience(claim json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(claim, &single); err == nil {
+		return single == audience
+	}
+	var multiple []string
+	if err := json.Unmarshal(claim, &multiple); err != nil {
+		return false
+	}
+	for _, aud := range multiple {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtTime converts a NumericDate, seconds since the epoch, to a time
+func jwtTime(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT returns a compact serialized token with the claims, signed by key
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed)) //nolint:errcheck,gosec
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	now := time.Now()
+	hmacKey := []byte("signing key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://auth.example.com",
+			"aud": "turn.example.com",
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		key   crypto.PublicKey
+		err   error
+	}{
+		{"HS256", signJWT(t, "HS256", hmacKey, claims(nil)), hmacKey, nil},
+		{"ES256", signJWT(t, "ES256", ecKey, claims(nil)), &ecKey.PublicKey, nil},
+		{"RS256", signJWT(t, "RS256", rsaKey, claims(nil)), &rsaKey.PublicKey, nil},
+		{"AudienceArray", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"aud": []string{"api.example.com", "turn.example.com"},
+		})), hmacKey, nil},
+		{"WithinLeeway", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"exp": now.Add(-time.Second).Unix(),
+			"nbf": now.Add(time.Second).Unix(),
+		})), hmacKey, nil},
+
+		{"Expired", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"exp": now.Add(-time.Minute).Unix(),
+		})), hmacKey, errJWTExpired},
+		{"NoExpiry", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{"exp": nil})), hmacKey, errJWTExpired},
+		{"NotYetValid", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"nbf": now.Add(time.Minute).Unix(),
+		})), hmacKey, errJWTNotYetValid},
+		{"OtherAudience", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"aud": "api.example.com",
+		})), hmacKey, errJWTAudience},
+		{"NoAudience", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{"aud": nil})), hmacKey, errJWTAudience},
+		{"OtherIssuer", signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{
+			"iss": "https://evil.example.com",
+		})), hmacKey, errJWTIssuer},
+		{"WrongKey", signJWT(t, "HS256", []byte("other key"), claims(nil)), hmacKey, errJWTSignature},
+		{"NoneAlgorithm", signJWT(t, "none", nil, claims(nil)), hmacKey, errJWTAlgorithm},
+		// The public key must not be usable as HMAC secret
+		{"AlgorithmConfusion", signJWT(t, "HS256", []byte("public key"), claims(nil)), &rsaKey.PublicKey, errJWTAlgorithm},
+		{"Malformed", "not a token", hmacKey, errJWTMalformed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyJWT(tc.token, &JWTAuthConfig{
+				VerificationKey: tc.key,
+				Audience:        "turn.example.com",
+				Issuer:          "https://auth.example.com",
+				Leeway:          5 * time.Second,
+			}, now)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	t.Run("Tampered", func(t *testing.T) {
+		config := &JWTAuthConfig{VerificationKey: hmacKey, Audience: "turn.example.com"}
+		token := strings.Split(signJWT(t, "HS256", hmacKey, claims(nil)), ".")
+		other := strings.Split(signJWT(t, "HS256", hmacKey, claims(map[string]interface{}{"sub": "mallory"})), ".")
+
+		// The claims of another token with the signature of the first
+		_, err := verifyJWT(strings.Join([]string{token[0], other[1], token[2]}, "."), config, now)
+		assert.ErrorIs(t, err, errJWTSignature)
+	})
+}
+
+func TestNewJWTAuthHandler(t *testing.T) {
+	const sharedSecret = "HELLO_WORLD"
+	signingKey := []byte("signing key")
+
+	_, err := NewJWTAuthHandler(JWTAuthConfig{SharedSecret: sharedSecret, Audience: "turn.example.com"})
+	assert.ErrorIs(t, err, errInvalidJWTConfig)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewJWTAuthHandler(JWTAuthConfig{
+		SharedSecret:    sharedSecret,
+		Audience:        "turn.example.com",
+		VerificationKey: &p384.PublicKey,
+	})
+	assert.ErrorIs(t, err, errInvalidJWTConfig)
+
+	handler, err := NewJWTAuthHandler(JWTAuthConfig{
+		SharedSecret:    sharedSecret,
+		VerificationKey: signingKey,
+		Audience:        "turn.example.com",
+	})
+	require.NoError(t, err)
+
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	assert.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: handler,
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+
+	allocate := func(token, password string) error {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: "127.0.0.1:3478",
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			Username:       token,
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	token := signJWT(t, "HS256", signingKey, map[string]interface{}{
+		"sub": "alice",
+		"aud": "turn.example.com",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	username, password, err := GenerateJWTTURNCredentials(sharedSecret, token)
+	assert.NoError(t, err)
+	assert.Equal(t, token, username)
+	assert.NoError(t, allocate(username, password))
+
+	assert.Error(t, allocate(username, "wrong password"))
+
+	expired := signJWT(t, "HS256", signingKey, map[string]interface{}{
+		"sub": "alice",
+		"aud": "turn.example.com",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	username, password, err = GenerateJWTTURNCredentials(sharedSecret, expired)
+	assert.NoError(t, err)
+	assert.Error(t, allocate(username, password))
+
+	assert.NoError(t, server.Close())
+}
@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/ldap"
+)
+
+const (
+	defaultLDAPTimeout       = 5 * time.Second
+	defaultLDAPUserAttribute = "uid"
+)
+
+// LDAPAuthConfig configures an AuthHandler that reads the TURN credentials of users
+// from an LDAP or Active Directory server, see NewLDAPAuthHandler
+type LDAPAuthConfig struct {
+	// URL of the directory, ldaps://host[:636] or ldap://host[:389]
+	URL string
+
+	// StartTLS upgrades an ldap:// connection to TLS before binding
+	StartTLS bool
+
+	// TLSConfig is used for ldaps:// and StartTLS. Defaults to verifying the
+	// certificate against the host of the URL.
+	TLSConfig *tls.Config
+
+	// BindDN and BindPassword authenticate the lookups, e.g. as a read-only service
+	// account. Lookups are anonymous if both are empty.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is the subtree users are searched in
+	BaseDN string
+
+	// UserAttribute is matched against the TURN username. Defaults to "uid",
+	// Active Directory usually uses "sAMAccountName".
+	UserAttribute string
+
+	// KeyAttribute holds the hex encoded TURN key of a user, see GenerateAuthKey.
+	// If it is empty, the key is derived from the cleartext PasswordAttribute.
+	KeyAttribute      string
+	PasswordAttribute string
+
+	// Timeout bounds connecting to the directory and every lookup. Defaults to 5 seconds.
+	Timeout time.Duration
+
+	// CacheTTL is how long a key is cached. Defaults to a minute; a negative value
+	// disables the cache.
+	CacheTTL time.Duration
+
+	Log logging.LeveledLogger
+}
+
+// ldapConn is the part of an ldap.Conn used by the handler
+type ldapConn interface {
+	SetDeadline(t time.Time) error
+	Bind(dn, password string) error
+	Search(baseDN, attribute, value string, sizeLimit int, attributes ...string) ([]*ldap.Entry, error)
+	Close() error
+}
+
+// NewLDAPAuthHandler returns a turn.AuthHandler that looks the TURN username up in
+// an LDAP directory and reads the key of the user from one of its attributes.
+//
+// TURN clients prove that they know the password without sending it, so the
+// directory can not verify it with a bind as the user. Instead, the handler binds
+// as BindDN and reads KeyAttribute or PasswordAttribute of the one entry whose
+// UserAttribute is the username. Users without such an entry or attribute are rejected.
+func NewLDAPAuthHandler(config LDAPAuthConfig) (AuthHandler, error) {
+	if config.BaseDN == "" || (config.KeyAttribute == "" && config.PasswordAttribute == "") {
+		return nil, errInvalidLDAPConfig
+	}
+	if config.UserAttribute == "" {
+		config.UserAttribute = defaultLDAPUserAttribute
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultLDAPTimeout
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultAuthCacheTTL
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	directory, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var useTLS bool
+	port := "389"
+	switch directory.Scheme {
+	case "ldaps":
+		useTLS, port = true, "636"
+	case "ldap":
+	default:
+		return nil, errInvalidLDAPConfig
+	}
+	if directory.Hostname() == "" || (useTLS && config.StartTLS) {
+		return nil, errInvalidLDAPConfig
+	}
+	if directory.Port() != "" {
+		port = directory.Port()
+	}
+	addr := net.JoinHostPort(directory.Hostname(), port)
+
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig = config.TLSConfig.Clone()
+		config.TLSConfig.ServerName = directory.Hostname()
+	}
+
+	return newLDAPAuthHandler(config, func() (ldapConn, error) {
+		dialer := &net.Dialer{Timeout: config.Timeout}
+		if useTLS {
+			conn, err := tls.DialWithDialer(dialer, "tcp", addr, config.TLSConfig)
+			if err != nil {
+				return nil, err
+			}
+			return ldap.NewConn(conn), nil
+		}
+
+		conn, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		ldapConn := ldap.NewConn(conn)
+		if config.StartTLS {
+			if err := ldapConn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+				return nil, errors.Join(err, conn.Close())
+			}
+			if err := ldapConn.StartTLS(config.TLSConfig); err != nil {
+				return nil, errors.Join(err, conn.Close())
+			}
+		}
+		return ldapConn, nil
+	}), nil
+}
+
+func newLDAPAuthHandler(config LDAPAuthConfig, dial func() (ldapConn, error)) AuthHandler {
+	handler := &ldapAuthHandler{LDAPAuthConfig: config, dial: dial, cache: newAuthKeyCache()}
+	return handler.authenticate
+}
+
+type ldapAuthHandler struct {
+	LDAPAuthConfig
+	dial  func() (ldapConn, error)
+	cache *authKeyCache
+
+	mutex sync.Mutex
+	conn  ldapConn // Reused by the lookups until it fails
+}
+
+func (h *ldapAuthHandler) authenticate(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	h.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	if key, ok := h.cache.get(username, realm); ok {
+		return key, true
+	}
+
+	entry, err := h.lookup(username)
+	if errors.Is(err, errLDAPNoUniqueEntry) {
+		h.Log.Debugf("No unique LDAP entry for %q", username)
+		return nil, false
+	} else if err != nil {
+		h.Log.Errorf("LDAP lookup of %q failed: %s", username, err)
+		return nil, false
+	}
+
+	if h.KeyAttribute != "" {
+		values := entry.Values(h.KeyAttribute)
+		if len(values) != 1 {
+			h.Log.Debugf("LDAP entry %q has no %s", entry.DN, h.KeyAttribute)
+			return nil, false
+		}
+		if key, err = hex.DecodeString(string(values[0])); err != nil || len(key) == 0 {
+			h.Log.Errorf("LDAP entry %q has an invalid %s", entry.DN, h.KeyAttribute)
+			return nil, false
+		}
+	} else {
+		values := entry.Values(h.PasswordAttribute)
+		if len(values) != 1 {
+			h.Log.Debugf("LDAP entry %q has no %s", entry.DN, h.PasswordAttribute)
+			return nil, false
+		}
+		key = GenerateAuthKey(username, realm, string(values[0]))
+	}
+
+	h.cache.put(username, realm, key, h.CacheTTL)
+	return key, true
+}
+
+// lookup returns the single entry of the user
+func (h *ldapAuthHandler) lookup(username string) (*ldap.Entry, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.conn == nil {
+		conn, err := h.dial()
+		if err != nil {
+			return nil, err
+		}
+		if err = conn.SetDeadline(time.Now().Add(h.Timeout)); err == nil {
+			err = conn.Bind(h.BindDN, h.BindPassword)
+		}
+		if err != nil {
+			return nil, errors.Join(err, conn.Close())
+		}
+		h.conn = conn
+	}
+
+	attribute := h.KeyAttribute
+	if attribute == "" {
+		attribute = h.PasswordAttribute
+	}
+	err := h.conn.SetDeadline(time.Now().Add(h.Timeout))
+	var entries []*ldap.Entry
+	if err == nil {
+		entries, err = h.conn.Search(h.BaseDN, h.UserAttribute, username, 2, attribute)
+	}
+
+	var ldapErr *ldap.Error
+	switch {
+	case errors.As(err, &ldapErr):
+		// The directory answered, the connection is still fine
+		return nil, err
+	case err != nil:
+		_ = h.conn.Close()
+		h.conn = nil
+		return nil, err
+	case len(entries) != 1:
+		return nil, errLDAPNoUniqueEntry
+	}
+	return entries[0], nil
+}
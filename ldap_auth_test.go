@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/ldap"
+	"github.com/stretchr/testify/assert"
+)
+
+var errLDAPInvalidCredentials = &ldap.Error{Code: 49, Message: "invalid credentials"}
+
+// fakeDirectory is an ldapConn searching users by their uid
+type fakeDirectory struct {
+	entries  map[string]*ldap.Entry
+	searches int
+	broken   bool
+	closed   bool
+}
+
+func (d *fakeDirectory) SetDeadline(time.Time) error { return nil }
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if dn != "cn=turn,dc=example,dc=com" || password != "secret" {
+		return errLDAPInvalidCredentials
+	}
+	return nil
+}
+
+func (d *fakeDirectory) Search(baseDN, attribute, value string, _ int, _ ...string) ([]*ldap.Entry, error) {
+	d.searches++
+	if d.broken {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if baseDN != "dc=example,dc=com" || attribute != "uid" {
+		return nil, nil
+	}
+	if entry, ok := d.entries[value]; ok {
+		return []*ldap.Entry{entry}, nil
+	}
+	return nil, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestNewLDAPAuthHandler(t *testing.T) {
+	for _, config := range []LDAPAuthConfig{
+		{URL: "ldaps://ldap.example.com", KeyAttribute: "turnKey"},
+		{URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com"},
+		{URL: "https://ldap.example.com", BaseDN: "dc=example,dc=com", KeyAttribute: "turnKey"},
+		{URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", KeyAttribute: "turnKey", StartTLS: true},
+	} {
+		_, err := NewLDAPAuthHandler(config)
+		assert.ErrorIs(t, err, errInvalidLDAPConfig)
+	}
+	_, err := NewLDAPAuthHandler(LDAPAuthConfig{
+		URL:          "ldap://ldap.example.com",
+		StartTLS:     true,
+		BaseDN:       "dc=example,dc=com",
+		KeyAttribute: "turnKey",
+	})
+	assert.NoError(t, err)
+
+	key := GenerateAuthKey("alice", "pion.ly", "pass")
+	directory := &fakeDirectory{entries: map[string]*ldap.Entry{}}
+	var dials int
+	dial := func() (ldapConn, error) {
+		dials++
+		directory.closed = false
+		return directory, nil
+	}
+	config := LDAPAuthConfig{
+		BindDN:        "cn=turn,dc=example,dc=com",
+		BindPassword:  "secret",
+		BaseDN:        "dc=example,dc=com",
+		UserAttribute: "uid",
+		Timeout:       time.Second,
+		CacheTTL:      time.Minute,
+		Log:           logging.NewDefaultLoggerFactory().NewLogger("test"),
+	}
+
+	t.Run("KeyAttribute", func(t *testing.T) {
+		directory.entries["alice"] = ldapEntry(t, "uid=alice,dc=example,dc=com", "turnKey", hex.EncodeToString(key))
+		config := config
+		config.KeyAttribute = "turnKey"
+		handler := newLDAPAuthHandler(config, dial)
+
+		for i := 0; i < 3; i++ {
+			actualKey, ok := handler("alice", "pion.ly", nil)
+			assert.True(t, ok)
+			assert.Equal(t, key, actualKey)
+		}
+		assert.Equal(t, 1, directory.searches, "the key should be cached")
+
+		_, ok := handler("mallory", "pion.ly", nil)
+		assert.False(t, ok)
+	})
+
+	t.Run("PasswordAttribute", func(t *testing.T) {
+		directory.entries["alice"] = ldapEntry(t, "uid=alice,dc=example,dc=com", "turnPassword", "pass")
+		config := config
+		config.PasswordAttribute = "turnPassword"
+		config.CacheTTL = -1
+		handler := newLDAPAuthHandler(config, dial)
+
+		actualKey, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, key, actualKey)
+
+		// A KeyAttribute of the entry does not count
+		directory.entries["alice"] = ldapEntry(t, "uid=alice,dc=example,dc=com", "turnKey", hex.EncodeToString(key))
+		_, ok = handler("alice", "pion.ly", nil)
+		assert.False(t, ok, "the key should not be cached")
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		directory.entries["alice"] = ldapEntry(t, "uid=alice,dc=example,dc=com", "turnKey", hex.EncodeToString(key))
+		config := config
+		config.KeyAttribute = "turnKey"
+		config.CacheTTL = -1
+		handler := newLDAPAuthHandler(config, dial)
+
+		dials = 0
+		_, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+
+		directory.broken = true
+		_, ok = handler("alice", "pion.ly", nil)
+		assert.False(t, ok)
+		assert.True(t, directory.closed, "a broken connection should be closed")
+
+		directory.broken = false
+		_, ok = handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, 2, dials)
+	})
+
+	t.Run("BindFailed", func(t *testing.T) {
+		config := config
+		config.KeyAttribute = "turnKey"
+		config.BindPassword = "wrong"
+		handler := newLDAPAuthHandler(config, dial)
+
+		_, ok := handler("alice", "pion.ly", nil)
+		assert.False(t, ok)
+		assert.True(t, directory.closed, "the connection should be closed")
+	})
+}
+
+// ldapEntry builds an entry the way the ldap package decodes search results
+func ldapEntry(t *testing.T, dn, attribute, value string) *ldap.Entry {
+	t.Helper()
+	return ldap.NewEntry(dn, map[string][][]byte{attribute: {[]byte(value)}})
+}
@@ -32,6 +32,127 @@ func GenerateLongTermTURNRESTCredentials(sharedSecret string, user string, durat
 	return username, password, err
 }
 
+// TURNRESTCredentials are the credentials a TURN REST API service returns to a client,
+// in the JSON format of draft-uberti-behave-turn-rest section 2.2
+type TURNRESTCredentials struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	TTL      int64    `json:"ttl"`
+	URIs     []string `json:"uris,omitempty"`
+}
+
+// GenerateTURNRESTCredentials mints credentials for user valid for ttl, for the TURN
+// servers at uris. They are accepted by LongTermTURNRESTAuthHandler and
+// NewTURNRESTAuthHandler, and by coturn with the same static-auth-secret.
+func GenerateTURNRESTCredentials(sharedSecret, user string, ttl time.Duration, uris ...string) (*TURNRESTCredentials, error) {
+	username, password, err := GenerateLongTermTURNRESTCredentials(sharedSecret, user, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &TURNRESTCredentials{
+		Username: username,
+		Password: password,
+		TTL:      int64(ttl / time.Second),
+		URIs:     uris,
+	}, nil
+}
+
+// TURNRESTAuthConfig configures NewTURNRESTAuthHandler
+type TURNRESTAuthConfig struct {
+	// Secrets are the shared secrets credentials may be signed with. To rotate a secret,
+	// add the new one, switch the services minting credentials over to it, and remove the
+	// old one once the credentials it signed expired.
+	Secrets []string
+
+	// RealmSecrets are the shared secrets of realms with their own, e.g. one per tenant, so
+	// credentials minted for one realm are not valid in another. Secrets are used for every
+	// other realm and may be empty if all realms are listed.
+	RealmSecrets map[string][]string
+
+	// MaxTTL rejects credentials expiring more than MaxTTL in the future, so a leaked
+	// secret can not mint credentials that stay valid after it has been rotated.
+	// Defaults to 0, which means no limit.
+	MaxTTL time.Duration
+
+	Log logging.LeveledLogger
+}
+
+// NewTURNRESTAuthHandler returns a turn.MultiKeyAuthHandler for the time-windowed
+// credentials of LongTermTURNRESTAuthHandler, signed with any of multiple secrets.
+// Set it as the ServerConfig.MultiKeyAuthHandler.
+//
+// Usernames are the expiry timestamp, optionally followed by a colon and a user id,
+// like coturn accepts them with use-auth-secret.
+func NewTURNRESTAuthHandler(config TURNRESTAuthConfig) (MultiKeyAuthHandler, error) {
+	if len(config.Secrets) == 0 && len(config.RealmSecrets) == 0 {
+		return nil, errNoTURNRESTSecret
+	}
+	for _, secret := range config.Secrets {
+		if secret == "" {
+			return nil, errNoTURNRESTSecret
+		}
+	}
+	secrets := append([]string(nil), config.Secrets...)
+	realmSecrets := make(map[string][]string, len(config.RealmSecrets))
+	for realm, rs := range config.RealmSecrets {
+		if len(rs) == 0 {
+			return nil, errNoTURNRESTSecret
+		}
+		for _, secret := range rs {
+			if secret == "" {
+				return nil, errNoTURNRESTSecret
+			}
+		}
+		realmSecrets[realm] = append([]string(nil), rs...)
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	return func(username, realm string, srcAddr net.Addr) (keys [][]byte, ok bool) {
+		config.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+		secrets := secrets
+		if rs, ok := realmSecrets[realm]; ok {
+			secrets = rs
+		}
+		if len(secrets) == 0 {
+			config.Log.Errorf("No shared secret for realm %q", realm)
+			return nil, false
+		}
+		return turnRESTKeys(username, realm, secrets, config.MaxTTL, config.Log)
+	}, nil
+}
+
+// turnRESTKeys returns the key of a time-windowed username for every secret
+func turnRESTKeys(username, realm string, secrets []string, maxTTL time.Duration, log logging.LeveledLogger) ([][]byte, bool) {
+	timestamp, _, _ := strings.Cut(username, ":")
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		log.Errorf("Invalid time-windowed username %q", username)
+		return nil, false
+	}
+	now := time.Now()
+	if t < now.Unix() {
+		log.Errorf("Expired time-windowed username %q", username)
+		return nil, false
+	}
+	if maxTTL > 0 && t > now.Add(maxTTL).Unix() {
+		log.Errorf("Time-windowed username %q expires after the maximum TTL", username)
+		return nil, false
+	}
+
+	keys := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		password, err := longTermCredentials(username, secret)
+		if err != nil {
+			log.Error(err.Error())
+			return nil, false
+		}
+		keys = append(keys, GenerateAuthKey(username, realm, password))
+	}
+	return keys, true
+}
+
 func longTermCredentials(username string, sharedSecret string) (string, error) {
 	mac := hmac.New(sha1.New, []byte(sharedSecret))
 	_, err := mac.Write([]byte(username))
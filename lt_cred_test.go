@@ -7,12 +7,15 @@
 package turn
 
 import (
+	"encoding/json"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLtCredMech(t *testing.T) {
@@ -123,3 +126,125 @@ func TestLongTermTURNRESTAuthHandler(t *testing.T) {
 	assert.NoError(t, conn.Close())
 	assert.NoError(t, server.Close())
 }
+
+func TestGenerateTURNRESTCredentials(t *testing.T) {
+	credentials, err := GenerateTURNRESTCredentials("HELLO_WORLD", "testuser", time.Hour, "turn:127.0.0.1:3478")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3600), credentials.TTL)
+	assert.True(t, strings.HasSuffix(credentials.Username, ":testuser"))
+	password, err := longTermCredentials(credentials.Username, "HELLO_WORLD")
+	assert.NoError(t, err)
+	assert.Equal(t, password, credentials.Password)
+
+	b, err := json.Marshal(credentials)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"username":"`+credentials.Username+`","password":"`+password+`","ttl":3600,"uris":["turn:127.0.0.1:3478"]}`, string(b))
+}
+
+func TestNewTURNRESTAuthHandler(t *testing.T) {
+	const oldSecret, newSecret = "OLD_SECRET", "NEW_SECRET"
+
+	_, err := NewTURNRESTAuthHandler(TURNRESTAuthConfig{})
+	assert.ErrorIs(t, err, errNoTURNRESTSecret)
+	_, err = NewTURNRESTAuthHandler(TURNRESTAuthConfig{Secrets: []string{oldSecret, ""}})
+	assert.ErrorIs(t, err, errNoTURNRESTSecret)
+
+	handler, err := NewTURNRESTAuthHandler(TURNRESTAuthConfig{
+		Secrets: []string{newSecret, oldSecret},
+		MaxTTL:  time.Hour,
+	})
+	assert.NoError(t, err)
+
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	assert.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		MultiKeyAuthHandler: handler,
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+
+	allocate := func(username, password string) error {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		assert.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: "0.0.0.0:3478",
+			TURNServerAddr: "0.0.0.0:3478",
+			Conn:           conn,
+			Username:       username,
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	// Credentials of either secret are accepted while they are rotated
+	for _, secret := range []string{oldSecret, newSecret} {
+		username, password, err := GenerateLongTermTURNRESTCredentials(secret, "testuser", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, allocate(username, password), secret)
+	}
+
+	// Just a timestamp is a valid username too
+	username, password, err := GenerateLongTermCredentials(newSecret, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, allocate(username, password))
+
+	username, password, err = GenerateLongTermTURNRESTCredentials("OTHER_SECRET", "testuser", time.Minute)
+	assert.NoError(t, err)
+	assert.Error(t, allocate(username, password))
+
+	username, password, err = GenerateLongTermTURNRESTCredentials(newSecret, "testuser", 2*time.Hour)
+	assert.NoError(t, err)
+	assert.Error(t, allocate(username, password), "credentials beyond MaxTTL should be rejected")
+
+	username, password, err = GenerateLongTermTURNRESTCredentials(newSecret, "testuser", -time.Minute)
+	assert.NoError(t, err)
+	assert.Error(t, allocate(username, password), "expired credentials should be rejected")
+
+	assert.NoError(t, server.Close())
+}
+
+func TestNewTURNRESTAuthHandlerRealmSecrets(t *testing.T) {
+	_, err := NewTURNRESTAuthHandler(TURNRESTAuthConfig{RealmSecrets: map[string][]string{"pion.ly": nil}})
+	assert.ErrorIs(t, err, errNoTURNRESTSecret)
+
+	handler, err := NewTURNRESTAuthHandler(TURNRESTAuthConfig{
+		RealmSecrets: map[string][]string{"pion.ly": {"PION_SECRET"}, "example.com": {"EXAMPLE_SECRET"}},
+	})
+	require.NoError(t, err)
+
+	username, password, err := GenerateLongTermTURNRESTCredentials("PION_SECRET", "alice", time.Minute)
+	require.NoError(t, err)
+	keys, ok := handler(username, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{GenerateAuthKey(username, "pion.ly", password)}, keys)
+
+	keys, ok = handler(username, "example.com", nil)
+	assert.True(t, ok)
+	assert.NotContains(t, keys, GenerateAuthKey(username, "example.com", password),
+		"credentials should only be valid in the realm of their secret")
+
+	_, ok = handler(username, "other.org", nil)
+	assert.False(t, ok, "realms without secrets should be rejected")
+}
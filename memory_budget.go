@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"github.com/pion/turn/v4/internal/allocation"
+)
+
+// MemoryBudgetConfig bounds the relayed packets a server buffers, see ServerConfig.MemoryBudget.
+// Load beyond the budget is shed in a fixed order: the packets of the allocations buffering the
+// most are dropped first, new allocations are only refused once the total budget is exhausted.
+type MemoryBudgetConfig struct {
+	// PerAllocation is the payload bytes the relay queue of every allocation may hold, further
+	// packets of the allocation are dropped. Defaults to 0, which only limits the queue to
+	// RelayQueueSize packets.
+	PerAllocation int
+
+	// Total is the payload bytes the relay queues of all allocations may hold. From 3/4 of it
+	// on, see MemoryPressureHigh, the packets of allocations holding more than their equal
+	// share of Total are dropped. Once it is reached, see MemoryPressureShedding, every
+	// relayed packet is dropped and Allocate requests are rejected with 508 (Insufficient
+	// Capacity) until the usage falls below 3/4 again. Defaults to 0, which means unlimited.
+	Total int
+}
+
+func (c *MemoryBudgetConfig) validate(relayQueueSize int) error {
+	switch {
+	case c.PerAllocation < 0 || c.Total < 0:
+		return errInvalidMemoryBudget
+	case (c.PerAllocation > 0 || c.Total > 0) && relayQueueSize == 0:
+		return errMemoryBudgetWithoutRelayQueue
+	default:
+		return nil
+	}
+}
+
+func (c *MemoryBudgetConfig) toInternal() *allocation.MemoryBudget {
+	if c.PerAllocation == 0 && c.Total == 0 {
+		return nil
+	}
+	return allocation.NewMemoryBudget(int64(c.PerAllocation), int64(c.Total))
+}
+
+// MemoryPressure is the state of the MemoryBudget of a server, from the least to the most loaded
+type MemoryPressure int
+
+const (
+	// MemoryPressureNormal only drops the packets of allocations over their PerAllocation budget
+	MemoryPressureNormal = MemoryPressure(allocation.PressureNormal)
+	// MemoryPressureHigh also drops the packets of allocations over their share of the Total budget
+	MemoryPressureHigh = MemoryPressure(allocation.PressureHigh)
+	// MemoryPressureShedding drops every relayed packet and refuses new allocations
+	MemoryPressureShedding = MemoryPressure(allocation.PressureShedding)
+)
+
+func (p MemoryPressure) String() string {
+	switch p {
+	case MemoryPressureNormal:
+		return "normal"
+	case MemoryPressureHigh:
+		return "high"
+	case MemoryPressureShedding:
+		return "shedding"
+	default:
+		return "unknown"
+	}
+}
+
+// MemoryStats are the counters of the MemoryBudget of a server, see Server.MemoryStats
+type MemoryStats struct {
+	// BufferedBytes is the payload currently held by the relay queues of all allocations
+	BufferedBytes int64
+	Pressure      MemoryPressure
+
+	// PacketsDropped and AllocationsRefused count the load shed for the budget
+	PacketsDropped     uint64
+	AllocationsRefused uint64
+}
+
+// MemoryStats returns the state of ServerConfig.MemoryBudget, zero without a budget
+func (s *Server) MemoryStats() MemoryStats {
+	if s.memoryBudget == nil {
+		return MemoryStats{}
+	}
+	return MemoryStats{
+		BufferedBytes:      s.memoryBudget.Used(),
+		Pressure:           MemoryPressure(s.memoryBudget.Pressure()),
+		PacketsDropped:     s.memoryBudget.Dropped(),
+		AllocationsRefused: s.memoryBudget.Refused(),
+	}
+}
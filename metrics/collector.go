@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package metrics collects the metrics of a turn.Server, and pushes them to statsd or
+// another MetricsSink, see Exporter. The modules metrics/prometheus and metrics/otel
+// expose them to Prometheus and OpenTelemetry, so their dependencies are only
+// required by the servers using them.
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/pion/turn/v4"
+)
+
+// RequestKey is the STUN method of the requests and the error code of their
+// responses, zero for success responses
+type RequestKey struct {
+	Method string
+	Code   int
+}
+
+// CodeLabel returns the label of the error code of the responses, "ok" for success
+func (k RequestKey) CodeLabel() string {
+	if k.Code == 0 {
+		return "ok"
+	}
+	return strconv.Itoa(k.Code)
+}
+
+// Snapshot is the value of the metrics of a Collector at one point in time
+type Snapshot struct {
+	Allocations        int
+	AllocationsCreated uint64
+	Requests           map[RequestKey]uint64
+	Traffic            turn.AllocationTraffic // Relayed by all allocations so far
+	AuthFailures       uint64
+	Permissions        int
+	ChannelBindings    int
+}
+
+// Collector collects the allocations, requests, relayed traffic and authentication
+// failures of a turn.Server. It learns about them through the hooks of the ServerConfig,
+// see Instrument, so any number of servers can be collected by collectors of their own:
+//
+//	collector := metrics.NewCollector()
+//	collector.Instrument(&config)
+//	server, err := turn.NewServer(config)
+//	...
+//	snapshot := collector.Snapshot()
+type Collector struct {
+	mutex       sync.Mutex
+	allocations map[turn.ServerAllocation]struct{}
+	created     uint64
+	deleted     turn.AllocationTraffic // Relayed by deleted allocations
+	requests    map[RequestKey]uint64
+	authFailed  uint64
+}
+
+// NewCollector returns a Collector, which collects nothing until it instruments the
+// configuration of a server
+func NewCollector() *Collector {
+	return &Collector{
+		allocations: map[turn.ServerAllocation]struct{}{},
+		requests:    map[RequestKey]uint64{},
+	}
+}
+
+// Instrument sets the hooks of config the collector learns from: OnAllocationCreated,
+// OnAllocationDeleted, OnRequestHandled and AuditSink. Hooks already set are still
+// called, after the collector. Instrument the config before creating the server with it.
+func (c *Collector) Instrument(config *turn.ServerConfig) {
+	onCreated, onDeleted, onRequestHandled := config.OnAllocationCreated, config.OnAllocationDeleted, config.OnRequestHandled
+
+	config.OnAllocationCreated = func(a turn.ServerAllocation) {
+		c.allocationCreated(a)
+		if onCreated != nil {
+			onCreated(a)
+		}
+	}
+	config.OnAllocationDeleted = func(a turn.ServerAllocation) {
+		c.allocationDeleted(a)
+		if onDeleted != nil {
+			onDeleted(a)
+		}
+	}
+	config.OnRequestHandled = func(method string, code int) {
+		c.requestHandled(method, code)
+		if onRequestHandled != nil {
+			onRequestHandled(method, code)
+		}
+	}
+	config.AuditSink = &auditSink{collector: c, next: config.AuditSink}
+}
+
+func (c *Collector) allocationCreated(a turn.ServerAllocation) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.allocations[a] = struct{}{}
+	c.created++
+}
+
+func (c *Collector) allocationDeleted(a turn.ServerAllocation) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.allocations[a]; !ok {
+		return
+	}
+	delete(c.allocations, a)
+	addTraffic(&c.deleted, a.Traffic())
+}
+
+func (c *Collector) requestHandled(method string, code int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.requests[RequestKey{Method: method, Code: code}]++
+}
+
+func addTraffic(total *turn.AllocationTraffic, t turn.AllocationTraffic) {
+	total.BytesToPeer += t.BytesToPeer
+	total.BytesFromPeer += t.BytesFromPeer
+	total.PacketsToPeer += t.PacketsToPeer
+	total.PacketsFromPeer += t.PacketsFromPeer
+}
+
+// auditSink counts authentication failures and passes all events on
+type auditSink struct {
+	collector *Collector
+	next      turn.AuditSink
+}
+
+func (s *auditSink) Audit(event turn.AuditEvent) error {
+	if event.Type == turn.AuditAuthFailure {
+		s.collector.mutex.Lock()
+		s.collector.authFailed++
+		s.collector.mutex.Unlock()
+	}
+	if s.next != nil {
+		return s.next.Audit(event)
+	}
+	return nil
+}
+
+// Snapshot returns the current value of the metrics. The traffic, permissions and
+// channel bindings of the current allocations are read when taken.
+func (c *Collector) Snapshot() Snapshot {
+	c.mutex.Lock()
+	allocations := make([]turn.ServerAllocation, 0, len(c.allocations))
+	for a := range c.allocations {
+		allocations = append(allocations, a)
+	}
+	snapshot := Snapshot{
+		Allocations:        len(allocations),
+		AllocationsCreated: c.created,
+		Requests:           make(map[RequestKey]uint64, len(c.requests)),
+		Traffic:            c.deleted,
+		AuthFailures:       c.authFailed,
+	}
+	for key, n := range c.requests {
+		snapshot.Requests[key] = n
+	}
+	c.mutex.Unlock()
+
+	for _, a := range allocations {
+		addTraffic(&snapshot.Traffic, a.Traffic())
+		snapshot.Permissions += a.PermissionCount()
+		snapshot.ChannelBindings += a.ChannelBindingCount()
+	}
+	return snapshot
+}
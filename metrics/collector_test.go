@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package metrics
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pion/turn/v4"
+)
+
+func TestCollector(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var created, handled atomic.Int32
+	config := turn.ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return turn.GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:               "pion.ly",
+		LoggerFactory:       logging.NewDefaultLoggerFactory(),
+		OnAllocationCreated: func(turn.ServerAllocation) { created.Add(1) },
+		OnRequestHandled:    func(string, int) { handled.Add(1) },
+	}
+	collector := NewCollector()
+	collector.Instrument(&config)
+	server, err := turn.NewServer(config)
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	newClient := func(password string) *turn.Client {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		client, err := turn.NewClient(&turn.ClientConfig{
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Conn:           conn,
+			Username:       "user",
+			Password:       password,
+			Realm:          "pion.ly",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client
+	}
+
+	client := newClient("pass")
+	defer client.Close()
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err = peer.ReadFrom(buf)
+	require.NoError(t, err)
+
+	snapshot := collector.Snapshot()
+	assert.Equal(t, 1, snapshot.Allocations)
+	assert.Equal(t, uint64(1), snapshot.AllocationsCreated)
+	assert.Equal(t, uint64(1), snapshot.Requests[RequestKey{Method: "Allocate"}])
+	assert.Equal(t, uint64(1), snapshot.Requests[RequestKey{Method: "Allocate", Code: 401}])
+	assert.Equal(t, uint64(1), snapshot.Requests[RequestKey{Method: "CreatePermission"}])
+	assert.Equal(t, 1, snapshot.Permissions)
+	// The client binds a channel to the peer it wrote to in the background
+	assert.Eventually(t, func() bool { return collector.Snapshot().ChannelBindings == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(5), snapshot.Traffic.BytesToPeer)
+	assert.Equal(t, uint64(1), snapshot.Traffic.PacketsToPeer)
+	assert.Equal(t, int32(1), created.Load(), "hooks set before should still be called")
+	assert.Positive(t, handled.Load())
+
+	// Refused credentials
+	refused := newClient("wrong")
+	defer refused.Close()
+	_, err = refused.Allocate()
+	assert.Error(t, err)
+	assert.Equal(t, uint64(1), collector.Snapshot().AuthFailures)
+
+	// The traffic of deleted allocations is kept
+	require.NoError(t, relayConn.Close())
+	assert.Eventually(t, func() bool { return collector.Snapshot().Allocations == 0 }, time.Second, 10*time.Millisecond)
+	snapshot = collector.Snapshot()
+	assert.Equal(t, uint64(5), snapshot.Traffic.BytesToPeer)
+	assert.Equal(t, uint64(1), snapshot.Requests[RequestKey{Method: "Refresh"}])
+}
+
+func TestRequestKeyCodeLabel(t *testing.T) {
+	assert.Equal(t, "ok", RequestKey{Method: "Allocate"}.CodeLabel())
+	assert.Equal(t, "401", RequestKey{Method: "Allocate", Code: 401}.CodeLabel())
+}
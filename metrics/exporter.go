@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// defaultExportInterval is how often an Exporter pushes without an interval configured
+const defaultExportInterval = 10 * time.Second
+
+// MetricsSink receives the metrics an Exporter pushes, e.g. a StatsdSink or the Sink of
+// module metrics/otel
+type MetricsSink interface { //nolint:revive
+	// Export pushes a snapshot of the metrics. Counters are the totals since the
+	// Collector was created, sinks of deltas keep the last snapshot exported.
+	Export(snapshot Snapshot) error
+}
+
+// ExporterConfig configures an Exporter
+type ExporterConfig struct {
+	// Collector is instrumenting the servers whose metrics are exported
+	Collector *Collector
+
+	// Sink receives the metrics
+	Sink MetricsSink
+
+	// Interval is how often the metrics are pushed, 10 seconds by default
+	Interval time.Duration
+
+	LoggerFactory logging.LoggerFactory
+}
+
+// Exporter pushes the metrics of a Collector to a MetricsSink at an interval, for
+// metrics pipelines other than Prometheus scraping the collector
+type Exporter struct {
+	collector *Collector
+	sink      MetricsSink
+	log       logging.LeveledLogger
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewExporter starts pushing the metrics of config.Collector to config.Sink until
+// the returned Exporter is closed
+func NewExporter(config ExporterConfig) *Exporter {
+	if config.Interval <= 0 {
+		config.Interval = defaultExportInterval
+	}
+	if config.LoggerFactory == nil {
+		config.LoggerFactory = logging.NewDefaultLoggerFactory()
+	}
+
+	e := &Exporter{
+		collector: config.Collector,
+		sink:      config.Sink,
+		log:       config.LoggerFactory.NewLogger("metrics"),
+		done:      make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run(config.Interval)
+	return e
+}
+
+func (e *Exporter) run(interval time.Duration) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := e.sink.Export(e.collector.Snapshot()); err != nil {
+			e.log.Warnf("Failed to export metrics: %v", err)
+		}
+	}
+}
+
+// Close stops pushing and pushes the metrics one last time, returning the error of
+// that push. The sink is left open.
+func (e *Exporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		e.wg.Wait()
+		e.closeErr = e.sink.Export(e.collector.Snapshot())
+	})
+	return e.closeErr
+}
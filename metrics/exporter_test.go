@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pion/turn/v4"
+)
+
+var errExport = errors.New("export failed")
+
+// recordingSink records the snapshots exported
+type recordingSink struct {
+	mutex     sync.Mutex
+	snapshots []Snapshot
+	err       error
+}
+
+func (s *recordingSink) Export(snapshot Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshots = append(s.snapshots, snapshot)
+	return s.err
+}
+
+func (s *recordingSink) exported() []Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Snapshot{}, s.snapshots...)
+}
+
+func TestExporter(t *testing.T) {
+	collector := NewCollector()
+	config := turn.ServerConfig{}
+	collector.Instrument(&config)
+	config.OnRequestHandled("Allocate", 401)
+	config.OnRequestHandled("Allocate", 0)
+
+	sink := &recordingSink{}
+	exporter := NewExporter(ExporterConfig{
+		Collector:     collector,
+		Sink:          sink,
+		Interval:      10 * time.Millisecond,
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	assert.Eventually(t, func() bool { return len(sink.exported()) >= 2 }, time.Second, time.Millisecond)
+
+	config.OnRequestHandled("Refresh", 0)
+	assert.NoError(t, exporter.Close())
+	assert.NoError(t, exporter.Close())
+
+	// Closing pushes the metrics one last time
+	exported := sink.exported()
+	assert.Equal(t, map[RequestKey]uint64{
+		{Method: "Allocate", Code: 401}: 1,
+		{Method: "Allocate", Code: 0}:   1,
+	}, exported[0].Requests)
+	assert.Equal(t, uint64(1), exported[len(exported)-1].Requests[RequestKey{Method: "Refresh"}])
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Len(t, sink.exported(), len(exported), "closed exporters should not push")
+}
+
+func TestExporterCloseError(t *testing.T) {
+	sink := &recordingSink{err: errExport}
+	exporter := NewExporter(ExporterConfig{Collector: NewCollector(), Sink: sink, Interval: time.Hour})
+	assert.ErrorIs(t, exporter.Close(), errExport)
+	assert.Len(t, sink.exported(), 1)
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package otel records the metrics of a metrics.Collector with OpenTelemetry. It is a
+// module of its own, so only the servers exporting to OpenTelemetry require it.
+package otel
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/pion/turn/v4/metrics"
+)
+
+// instrumentationName names the meter of the instruments of a Sink
+const instrumentationName = "github.com/pion/turn/v4/metrics/otel"
+
+// Sink is a metrics.MetricsSink recording the metrics with the instruments of an
+// OpenTelemetry meter, exported over OTLP by the reader of its provider, e.g. a
+// PeriodicReader of an otlpmetrichttp exporter. Readers collect on their own schedule,
+// the instruments observe the snapshot exported last:
+//
+//	turn.allocations, turn.permissions and turn.channel_bindings gauges
+//	turn.allocations.created and turn.auth_failures counters
+//	turn.requests counter by turn.method and turn.code, "ok" for success responses
+//	turn.relayed.bytes and turn.relayed.packets counters by turn.direction
+//
+// It is exported to by a metrics.Exporter:
+//
+//	sink, err := otel.NewSink(provider)
+//	...
+//	exporter := metrics.NewExporter(metrics.ExporterConfig{Collector: collector, Sink: sink})
+type Sink struct {
+	mutex sync.Mutex
+	last  *metrics.Snapshot // nil until the first export
+
+	registration metric.Registration
+}
+
+// NewSink returns a Sink registering its instruments with a meter of provider
+func NewSink(provider metric.MeterProvider) (*Sink, error) {
+	meter := provider.Meter(instrumentationName)
+	s := &Sink{}
+
+	allocations, err := meter.Int64ObservableGauge("turn.allocations",
+		metric.WithDescription("Allocations currently relaying."), metric.WithUnit("{allocation}"))
+	if err != nil {
+		return nil, err
+	}
+	created, err := meter.Int64ObservableCounter("turn.allocations.created",
+		metric.WithDescription("Allocations created."), metric.WithUnit("{allocation}"))
+	if err != nil {
+		return nil, err
+	}
+	requests, err := meter.Int64ObservableCounter("turn.requests",
+		metric.WithDescription("Requests answered by STUN method and error code of the response."), metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := meter.Int64ObservableCounter("turn.relayed.bytes",
+		metric.WithDescription("Payload relayed, excluding TURN framing."), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	packets, err := meter.Int64ObservableCounter("turn.relayed.packets",
+		metric.WithDescription("Packets relayed."), metric.WithUnit("{packet}"))
+	if err != nil {
+		return nil, err
+	}
+	authFailures, err := meter.Int64ObservableCounter("turn.auth_failures",
+		metric.WithDescription("Requests whose credentials were refused."), metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := meter.Int64ObservableGauge("turn.permissions",
+		metric.WithDescription("Permissions of the current allocations."), metric.WithUnit("{permission}"))
+	if err != nil {
+		return nil, err
+	}
+	channelBindings, err := meter.Int64ObservableGauge("turn.channel_bindings",
+		metric.WithDescription("Channel bindings of the current allocations."), metric.WithUnit("{binding}"))
+	if err != nil {
+		return nil, err
+	}
+
+	toPeer := metric.WithAttributes(attribute.String("turn.direction", "to_peer"))
+	fromPeer := metric.WithAttributes(attribute.String("turn.direction", "from_peer"))
+	s.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s.mutex.Lock()
+		snapshot := s.last
+		s.mutex.Unlock()
+		if snapshot == nil {
+			return nil
+		}
+
+		o.ObserveInt64(allocations, int64(snapshot.Allocations))
+		o.ObserveInt64(created, int64(snapshot.AllocationsCreated))
+		for key, n := range snapshot.Requests {
+			o.ObserveInt64(requests, int64(n), metric.WithAttributes(
+				attribute.String("turn.method", key.Method), attribute.String("turn.code", key.CodeLabel())))
+		}
+		o.ObserveInt64(bytes, int64(snapshot.Traffic.BytesToPeer), toPeer)
+		o.ObserveInt64(bytes, int64(snapshot.Traffic.BytesFromPeer), fromPeer)
+		o.ObserveInt64(packets, int64(snapshot.Traffic.PacketsToPeer), toPeer)
+		o.ObserveInt64(packets, int64(snapshot.Traffic.PacketsFromPeer), fromPeer)
+		o.ObserveInt64(authFailures, int64(snapshot.AuthFailures))
+		o.ObserveInt64(permissions, int64(snapshot.Permissions))
+		o.ObserveInt64(channelBindings, int64(snapshot.ChannelBindings))
+		return nil
+	}, allocations, created, requests, bytes, packets, authFailures, permissions, channelBindings)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Export implements metrics.MetricsSink
+func (s *Sink) Export(snapshot metrics.Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.last = &snapshot
+	return nil
+}
+
+// Close unregisters the instruments of the sink
+func (s *Sink) Close() error {
+	return s.registration.Unregister()
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/pion/turn/v4"
+	"github.com/pion/turn/v4/metrics"
+)
+
+// points returns the values of the points of the metrics collected by reader by
+// name and attributes
+func points(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	values := map[string]int64{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			var dataPoints []metricdata.DataPoint[int64]
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				dataPoints = data.DataPoints
+			case metricdata.Sum[int64]:
+				dataPoints = data.DataPoints
+			}
+			for _, point := range dataPoints {
+				name := m.Name
+				for _, kv := range point.Attributes.ToSlice() {
+					name += "," + string(kv.Key) + "=" + kv.Value.Emit()
+				}
+				values[name] = point.Value
+			}
+		}
+	}
+	return values
+}
+
+func TestSink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	sink, err := NewSink(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	require.NoError(t, err)
+
+	// Nothing is observed before the first export
+	assert.Empty(t, points(t, reader))
+
+	require.NoError(t, sink.Export(metrics.Snapshot{
+		Allocations:        2,
+		AllocationsCreated: 3,
+		Requests:           map[metrics.RequestKey]uint64{{Method: "Allocate"}: 3, {Method: "Allocate", Code: 401}: 3},
+		Traffic:            turn.AllocationTraffic{BytesToPeer: 100, PacketsFromPeer: 2},
+		AuthFailures:       1,
+		ChannelBindings:    1,
+	}))
+	values := points(t, reader)
+	assert.Equal(t, int64(2), values["turn.allocations"])
+	assert.Equal(t, int64(3), values["turn.allocations.created"])
+	assert.Equal(t, int64(3), values["turn.requests,turn.code=ok,turn.method=Allocate"])
+	assert.Equal(t, int64(3), values["turn.requests,turn.code=401,turn.method=Allocate"])
+	assert.Equal(t, int64(100), values["turn.relayed.bytes,turn.direction=to_peer"])
+	assert.Equal(t, int64(2), values["turn.relayed.packets,turn.direction=from_peer"])
+	assert.Equal(t, int64(1), values["turn.auth_failures"])
+	assert.Equal(t, int64(0), values["turn.permissions"])
+	assert.Equal(t, int64(1), values["turn.channel_bindings"])
+
+	require.NoError(t, sink.Close())
+	assert.Empty(t, points(t, reader))
+}
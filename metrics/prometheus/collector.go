@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package prometheus exposes the metrics of a metrics.Collector to Prometheus. It is a
+// module of its own, so only the servers scraped by Prometheus require its client.
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/pion/turn/v4/metrics"
+)
+
+const namespace = "turn"
+
+// Collector is a prometheus.Collector of the metrics of a metrics.Collector, and is
+// registered like any other collector:
+//
+//	source := metrics.NewCollector()
+//	source.Instrument(&config)
+//	server, err := turn.NewServer(config)
+//	...
+//	registry.MustRegister(prometheus.NewCollector(source))
+type Collector struct {
+	source *metrics.Collector
+
+	allocationsDesc        *prometheus.Desc
+	allocationsCreatedDesc *prometheus.Desc
+	requestsDesc           *prometheus.Desc
+	bytesDesc              *prometheus.Desc
+	packetsDesc            *prometheus.Desc
+	authFailuresDesc       *prometheus.Desc
+	permissionsDesc        *prometheus.Desc
+	channelBindingsDesc    *prometheus.Desc
+}
+
+// NewCollector returns a Collector of the metrics of source
+func NewCollector(source *metrics.Collector) *Collector {
+	return &Collector{
+		source: source,
+
+		allocationsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "allocations"),
+			"Allocations currently relaying.", nil, nil),
+		allocationsCreatedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "allocations_created_total"),
+			"Allocations created.", nil, nil),
+		requestsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "requests_total"),
+			`Requests answered by STUN method and error code of the response, "ok" for success responses.`,
+			[]string{"method", "code"}, nil),
+		bytesDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "relayed", "bytes_total"),
+			`Payload relayed "to_peer" or "from_peer", excluding TURN framing.`, []string{"direction"}, nil),
+		packetsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "relayed", "packets_total"),
+			`Packets relayed "to_peer" or "from_peer".`, []string{"direction"}, nil),
+		authFailuresDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "auth_failures_total"),
+			"Requests whose credentials were refused.", nil, nil),
+		permissionsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "permissions"),
+			"Permissions of the current allocations.", nil, nil),
+		channelBindingsDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "channel_bindings"),
+			"Channel bindings of the current allocations.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.allocationsDesc
+	ch <- c.allocationsCreatedDesc
+	ch <- c.requestsDesc
+	ch <- c.bytesDesc
+	ch <- c.packetsDesc
+	ch <- c.authFailuresDesc
+	ch <- c.permissionsDesc
+	ch <- c.channelBindingsDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.source.Snapshot()
+
+	ch <- prometheus.MustNewConstMetric(c.allocationsDesc, prometheus.GaugeValue, float64(s.Allocations))
+	ch <- prometheus.MustNewConstMetric(c.allocationsCreatedDesc, prometheus.CounterValue, float64(s.AllocationsCreated))
+	for key, n := range s.Requests {
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(n), key.Method, key.CodeLabel())
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytesDesc, prometheus.CounterValue, float64(s.Traffic.BytesToPeer), "to_peer")
+	ch <- prometheus.MustNewConstMetric(c.bytesDesc, prometheus.CounterValue, float64(s.Traffic.BytesFromPeer), "from_peer")
+	ch <- prometheus.MustNewConstMetric(c.packetsDesc, prometheus.CounterValue, float64(s.Traffic.PacketsToPeer), "to_peer")
+	ch <- prometheus.MustNewConstMetric(c.packetsDesc, prometheus.CounterValue, float64(s.Traffic.PacketsFromPeer), "from_peer")
+	ch <- prometheus.MustNewConstMetric(c.authFailuresDesc, prometheus.CounterValue, float64(s.AuthFailures))
+	ch <- prometheus.MustNewConstMetric(c.permissionsDesc, prometheus.GaugeValue, float64(s.Permissions))
+	ch <- prometheus.MustNewConstMetric(c.channelBindingsDesc, prometheus.GaugeValue, float64(s.ChannelBindings))
+}
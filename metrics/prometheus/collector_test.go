@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package prometheus
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pion/turn/v4"
+	"github.com/pion/turn/v4/metrics"
+)
+
+// value returns the value of the metric with the name and labels gathered from registry
+func value(t *testing.T, registry *prometheus.Registry, name string, labels ...string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for i, label := range metric.GetLabel() {
+				if i*2+1 >= len(labels) || label.GetName() != labels[i*2] || label.GetValue() != labels[i*2+1] {
+					continue metrics
+				}
+			}
+			return metricValue(metric)
+		}
+	}
+	return 0
+}
+
+func metricValue(metric *dto.Metric) float64 {
+	if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetGauge().GetValue()
+}
+
+func TestCollector(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var created, handled atomic.Int32
+	config := turn.ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return turn.GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:               "pion.ly",
+		LoggerFactory:       logging.NewDefaultLoggerFactory(),
+		OnAllocationCreated: func(turn.ServerAllocation) { created.Add(1) },
+		OnRequestHandled:    func(string, int) { handled.Add(1) },
+	}
+	source := metrics.NewCollector()
+	source.Instrument(&config)
+	server, err := turn.NewServer(config)
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(NewCollector(source)))
+
+	newClient := func(password string) *turn.Client {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		client, err := turn.NewClient(&turn.ClientConfig{
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Conn:           conn,
+			Username:       "user",
+			Password:       password,
+			Realm:          "pion.ly",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		return client
+	}
+
+	client := newClient("pass")
+	defer client.Close()
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err = peer.ReadFrom(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, value(t, registry, "turn_allocations"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_allocations_created_total"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_requests_total", "code", "ok", "method", "Allocate"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_requests_total", "code", "401", "method", "Allocate"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_requests_total", "code", "ok", "method", "CreatePermission"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_permissions"))
+	// The client binds a channel to the peer it wrote to in the background
+	assert.Eventually(t, func() bool { return value(t, registry, "turn_channel_bindings") == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 5.0, value(t, registry, "turn_relayed_bytes_total", "direction", "to_peer"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_relayed_packets_total", "direction", "to_peer"))
+	assert.Equal(t, int32(1), created.Load(), "hooks set before should still be called")
+	assert.Positive(t, handled.Load())
+
+	// Refused credentials
+	refused := newClient("wrong")
+	defer refused.Close()
+	_, err = refused.Allocate()
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, value(t, registry, "turn_auth_failures_total"))
+
+	// The traffic of deleted allocations is kept
+	require.NoError(t, relayConn.Close())
+	assert.Eventually(t, func() bool { return value(t, registry, "turn_allocations") == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 5.0, value(t, registry, "turn_relayed_bytes_total", "direction", "to_peer"))
+	assert.Equal(t, 1.0, value(t, registry, "turn_requests_total", "code", "ok", "method", "Refresh"))
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// maxStatsdPacketSize keeps the datagrams of a StatsdSink within the MTU of
+// most networks
+const maxStatsdPacketSize = 1432
+
+// StatsdSink is a MetricsSink sending the metrics to a statsd server, in datagrams of
+// as many lines as fit. Gauges are sent as is, counters as their increase since the
+// last export, and only when they increased:
+//
+//	turn.allocations:3|g
+//	turn.allocations_created_total:1|c
+//	turn.requests_total.Allocate.ok:1|c
+//	turn.relayed.bytes_total.to_peer:1200|c
+type StatsdSink struct {
+	conn   net.Conn
+	prefix string
+
+	mutex sync.Mutex // Guards last and buf
+	last  Snapshot
+	buf   bytes.Buffer
+}
+
+// NewStatsdSink returns a StatsdSink writing to conn, typically a UDP socket connected
+// to the statsd server, with the names of the metrics prefixed by prefix, "turn" if empty
+func NewStatsdSink(conn net.Conn, prefix string) *StatsdSink {
+	if prefix == "" {
+		prefix = "turn"
+	}
+	return &StatsdSink{conn: conn, prefix: prefix}
+}
+
+// DialStatsd returns a StatsdSink sending to the statsd server at address over UDP
+func DialStatsd(address, prefix string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewStatsdSink(conn, prefix), nil
+}
+
+// Export implements MetricsSink
+func (s *StatsdSink) Export(snapshot Snapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.buf.Reset()
+	var err error
+	line := func(name string, value uint64, kind string) {
+		if err != nil {
+			return
+		}
+		n := len(s.prefix) + 1 + len(name) + 1 + 20 + 1 + len(kind) + 1
+		if s.buf.Len() > 0 && s.buf.Len()+n > maxStatsdPacketSize {
+			err = s.flush()
+		}
+		if s.buf.Len() > 0 {
+			s.buf.WriteByte('\n')
+		}
+		s.buf.WriteString(s.prefix)
+		s.buf.WriteByte('.')
+		s.buf.WriteString(name)
+		s.buf.WriteByte(':')
+		s.buf.WriteString(strconv.FormatUint(value, 10))
+		s.buf.WriteByte('|')
+		s.buf.WriteString(kind)
+	}
+	gauge := func(name string, value int) {
+		line(name, uint64(value), "g")
+	}
+	counter := func(name string, value, last uint64) {
+		if value > last {
+			line(name, value-last, "c")
+		}
+	}
+
+	gauge("allocations", snapshot.Allocations)
+	counter("allocations_created_total", snapshot.AllocationsCreated, s.last.AllocationsCreated)
+	for _, key := range sortedRequests(snapshot.Requests) {
+		counter("requests_total."+key.Method+"."+key.CodeLabel(), snapshot.Requests[key], s.last.Requests[key])
+	}
+	counter("relayed.bytes_total.to_peer", snapshot.Traffic.BytesToPeer, s.last.Traffic.BytesToPeer)
+	counter("relayed.bytes_total.from_peer", snapshot.Traffic.BytesFromPeer, s.last.Traffic.BytesFromPeer)
+	counter("relayed.packets_total.to_peer", snapshot.Traffic.PacketsToPeer, s.last.Traffic.PacketsToPeer)
+	counter("relayed.packets_total.from_peer", snapshot.Traffic.PacketsFromPeer, s.last.Traffic.PacketsFromPeer)
+	counter("auth_failures_total", snapshot.AuthFailures, s.last.AuthFailures)
+	gauge("permissions", snapshot.Permissions)
+	gauge("channel_bindings", snapshot.ChannelBindings)
+	if err == nil {
+		err = s.flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	// The increase of a failed export is sent again with the next one
+	s.last = snapshot
+	return nil
+}
+
+func (s *StatsdSink) flush() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(s.buf.Bytes())
+	s.buf.Reset()
+	return err
+}
+
+// Close closes the connection to the statsd server
+func (s *StatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+// sortedRequests returns the keys of requests in a stable order
+func sortedRequests(requests map[RequestKey]uint64) []RequestKey {
+	keys := make([]RequestKey, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Method != keys[j].Method {
+			return keys[i].Method < keys[j].Method
+		}
+		return keys[i].Code < keys[j].Code
+	})
+	return keys
+}
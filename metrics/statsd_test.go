@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pion/turn/v4"
+)
+
+func TestStatsdSink(t *testing.T) {
+	server, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	sink, err := DialStatsd(server.LocalAddr().String(), "relay")
+	require.NoError(t, err)
+	defer sink.Close() //nolint:errcheck
+
+	read := func() []string {
+		buf := make([]byte, 2*maxStatsdPacketSize)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := server.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, n, maxStatsdPacketSize)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	snapshot := Snapshot{
+		Allocations:        2,
+		AllocationsCreated: 3,
+		Requests:           map[RequestKey]uint64{{Method: "Allocate"}: 3, {Method: "Allocate", Code: 401}: 3},
+		Traffic:            turn.AllocationTraffic{BytesToPeer: 100, PacketsToPeer: 2},
+		Permissions:        1,
+	}
+	require.NoError(t, sink.Export(snapshot))
+	assert.Equal(t, []string{
+		"relay.allocations:2|g",
+		"relay.allocations_created_total:3|c",
+		"relay.requests_total.Allocate.ok:3|c",
+		"relay.requests_total.Allocate.401:3|c",
+		"relay.relayed.bytes_total.to_peer:100|c",
+		"relay.relayed.packets_total.to_peer:2|c",
+		"relay.permissions:1|g",
+		"relay.channel_bindings:0|g",
+	}, read())
+
+	// Counters are sent as their increase
+	snapshot.Allocations = 1
+	snapshot.Requests = map[RequestKey]uint64{{Method: "Allocate"}: 3, {Method: "Allocate", Code: 401}: 3, {Method: "Refresh"}: 1}
+	snapshot.Traffic.BytesToPeer = 150
+	require.NoError(t, sink.Export(snapshot))
+	assert.Equal(t, []string{
+		"relay.allocations:1|g",
+		"relay.requests_total.Refresh.ok:1|c",
+		"relay.relayed.bytes_total.to_peer:50|c",
+		"relay.permissions:1|g",
+		"relay.channel_bindings:0|g",
+	}, read())
+
+	// Lines are split across datagrams
+	many := Snapshot{Requests: map[RequestKey]uint64{}}
+	for i := 0; i < 100; i++ {
+		many.Requests[RequestKey{Method: fmt.Sprintf("Method%02d", i)}] = 1
+	}
+	sink, err = DialStatsd(server.LocalAddr().String(), "")
+	require.NoError(t, err)
+	defer sink.Close() //nolint:errcheck
+	require.NoError(t, sink.Export(many))
+	var lines []string
+	for len(lines) < 103 {
+		lines = append(lines, read()...)
+	}
+	assert.Equal(t, "turn.allocations:0|g", lines[0])
+	assert.Equal(t, "turn.requests_total.Method99.ok:1|c", lines[100])
+}
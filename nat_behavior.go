@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+const defaultNATTestTimeout = 3 * time.Second
+
+// NATBehavior classifies how a NAT maps or filters UDP traffic, see
+// https://datatracker.ietf.org/doc/html/rfc4787#section-4
+type NATBehavior int
+
+// NATBehavior values
+const (
+	NATBehaviorUnknown NATBehavior = iota
+	NATBehaviorEndpointIndependent
+	NATBehaviorAddressDependent
+	NATBehaviorAddressAndPortDependent
+)
+
+func (b NATBehavior) String() string {
+	switch b {
+	case NATBehaviorEndpointIndependent:
+		return "endpoint independent"
+	case NATBehaviorAddressDependent:
+		return "address dependent"
+	case NATBehaviorAddressAndPortDependent:
+		return "address and port dependent"
+	default:
+		return "unknown"
+	}
+}
+
+// NATDiscovery is the NAT behavior determined by DetectNATBehavior
+type NATDiscovery struct {
+	MappedAddr        net.Addr // Server reflexive address of the client
+	NoNAT             bool     // The mapped address is the local address
+	MappingBehavior   NATBehavior
+	FilteringBehavior NATBehavior
+}
+
+// RelayRequired reports whether peers can likely not reach the client directly, as
+// its NAT maps every destination to another address, or the mapping is unknown
+func (d *NATDiscovery) RelayRequired() bool {
+	return d.MappingBehavior != NATBehaviorEndpointIndependent
+}
+
+// DetectNATBehavior determines the mapping and filtering behavior of the NAT of the
+// client with the tests of https://datatracker.ietf.org/doc/html/rfc5780#section-4,
+// before an allocation is made at all. The STUN server must support them, and be
+// reached over UDP. Missing responses are part of the tests, each is waited for up
+// to NATTestTimeout.
+func (c *Client) DetectNATBehavior() (*NATDiscovery, error) {
+	return c.DetectNATBehaviorContext(context.Background())
+}
+
+// DetectNATBehaviorContext is DetectNATBehavior, giving up once the context is done
+func (c *Client) DetectNATBehaviorContext(ctx context.Context) (*NATDiscovery, error) {
+	server, ok := c.stunServerAddr.(*net.UDPAddr)
+	if !ok {
+		return nil, errSTUNServerAddressNotSet
+	}
+
+	// Test I: a regular Binding request
+	res, err := c.natProbe(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := reflexiveAddr(res)
+	if err != nil {
+		return nil, err
+	}
+	var other stun.OtherAddress
+	if err = other.GetFrom(res); err != nil {
+		return nil, errNATDiscoveryUnsupported
+	}
+	otherAddr := &net.UDPAddr{IP: other.IP, Port: other.Port}
+	discovery := &NATDiscovery{MappedAddr: mapped}
+
+	// The filtering tests run first, as the mapping tests send to the other
+	// address, which would open an address dependent filter for it
+	discovery.FilteringBehavior, err = c.detectFiltering(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapped.String() == c.packetConn().LocalAddr().String() {
+		discovery.NoNAT = true
+		discovery.MappingBehavior = NATBehaviorEndpointIndependent
+		return discovery, nil
+	}
+	discovery.MappingBehavior, err = c.detectMapping(ctx, server, otherAddr, mapped)
+	if err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
+
+// detectFiltering runs the filtering tests II and III of RFC 5780 Section 4.4
+func (c *Client) detectFiltering(ctx context.Context, server net.Addr) (NATBehavior, error) {
+	// Test II: the response comes from the other address and port
+	_, err := c.natProbe(ctx, server, proto.ChangeRequest{ChangeIP: true, ChangePort: true})
+	switch {
+	case err == nil:
+		return NATBehaviorEndpointIndependent, nil
+	case !errors.Is(err, errNATTestNoResponse):
+		return NATBehaviorUnknown, err
+	}
+
+	// Test III: the response comes from the other port
+	_, err = c.natProbe(ctx, server, proto.ChangeRequest{ChangePort: true})
+	switch {
+	case err == nil:
+		return NATBehaviorAddressDependent, nil
+	case errors.Is(err, errNATTestNoResponse):
+		return NATBehaviorAddressAndPortDependent, nil
+	default:
+		return NATBehaviorUnknown, err
+	}
+}
+
+// detectMapping runs the mapping tests II and III of RFC 5780 Section 4.3
+func (c *Client) detectMapping(ctx context.Context, server, otherAddr *net.UDPAddr, mapped net.Addr) (NATBehavior, error) {
+	// Test II: to the other address, but the primary port
+	res, err := c.natProbe(ctx, &net.UDPAddr{IP: otherAddr.IP, Port: server.Port})
+	if errors.Is(err, errNATTestNoResponse) {
+		return NATBehaviorUnknown, nil
+	} else if err != nil {
+		return NATBehaviorUnknown, err
+	}
+	mapped2, err := reflexiveAddr(res)
+	if err != nil {
+		return NATBehaviorUnknown, err
+	}
+	if mapped2.String() == mapped.String() {
+		return NATBehaviorEndpointIndependent, nil
+	}
+
+	// Test III: to the other address and port
+	res, err = c.natProbe(ctx, otherAddr)
+	if errors.Is(err, errNATTestNoResponse) {
+		return NATBehaviorUnknown, nil
+	} else if err != nil {
+		return NATBehaviorUnknown, err
+	}
+	mapped3, err := reflexiveAddr(res)
+	if err != nil {
+		return NATBehaviorUnknown, err
+	}
+	if mapped3.String() == mapped2.String() {
+		return NATBehaviorAddressDependent, nil
+	}
+	return NATBehaviorAddressAndPortDependent, nil
+}
+
+// natProbe sends a Binding request of a NAT behavior test. A missing response is a
+// result of the test, so the transaction is given up after NATTestTimeout without
+// being counted as timed out, and errNATTestNoResponse is returned.
+func (c *Client) natProbe(ctx context.Context, to net.Addr, setters ...stun.Setter) (*stun.Message, error) {
+	probeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(c.natTestTimeout, cancel)
+	defer timer.Stop()
+
+	attrs := append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, setters...)
+	msg, err := stun.Build(append(attrs, c.requestSetters...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	trRes, err := c.performTransaction(probeCtx, msg, to, false, false)
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, errAllRetransmissionsFailed):
+		return nil, errNATTestNoResponse
+	default:
+		return nil, err
+	}
+
+	if trRes.Msg.Type.Class == stun.ClassErrorResponse {
+		// Like 420 (Unknown Attribute) for CHANGE-REQUEST
+		return nil, errNATDiscoveryUnsupported
+	}
+	return trRes.Msg, nil
+}
+
+// reflexiveAddr returns the XOR-MAPPED-ADDRESS of a Binding response
+func reflexiveAddr(res *stun.Message) (net.Addr, error) {
+	var reflAddr stun.XORMappedAddress
+	if err := reflAddr.GetFrom(res); err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: reflAddr.IP, Port: reflAddr.Port}, nil
+}
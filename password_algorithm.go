@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto/sha256"
+	"net"
+	"strings"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/server"
+)
+
+// PasswordAlgorithm is an algorithm long-term credentials derive their key with, see
+// RFC 8489 Section 18.5
+type PasswordAlgorithm uint16
+
+const (
+	// PasswordAlgorithmMD5 is MD5(username:realm:password), see GenerateAuthKey. It is the
+	// only algorithm of clients predating RFC 8489.
+	PasswordAlgorithmMD5 = PasswordAlgorithm(proto.PasswordAlgorithmMD5)
+	// PasswordAlgorithmSHA256 is SHA-256(username:realm:password), see GenerateSHA256AuthKey
+	PasswordAlgorithmSHA256 = PasswordAlgorithm(proto.PasswordAlgorithmSHA256)
+)
+
+func (a PasswordAlgorithm) String() string {
+	return proto.PasswordAlgorithm(a).String()
+}
+
+// PasswordAlgorithmConfig selects the password algorithms of a Server, see
+// ServerConfig.PasswordAlgorithms.
+//
+// To phase MD5 out, accept both algorithms so RFC 8489 clients switch to SHA-256, then
+// only accept SHA-256 with ReportOnly until OnRejected no longer reports clients, and
+// finally drop ReportOnly.
+type PasswordAlgorithmConfig struct {
+	// Accept lists the algorithms requests may be authenticated with. Defaults to MD5 only.
+	// SHA-256 requires ServerConfig.SHA256AuthHandler.
+	Accept []PasswordAlgorithm
+
+	// Advertise lists the algorithms offered to clients in the PASSWORD-ALGORITHMS of
+	// challenges, in order of preference. Defaults to Accept, nothing is advertised while
+	// both are empty.
+	Advertise []PasswordAlgorithm
+
+	// ReportOnly accepts authentic requests whose algorithm is missing from Accept, only
+	// reporting them to OnRejected, to see which clients a policy would reject
+	ReportOnly bool
+
+	// OnRejected is called for every request that is, or with ReportOnly would be, rejected
+	// for its algorithm. Requests are rejected before their credentials are verified, while
+	// ReportOnly only reports authentic requests. Optional.
+	OnRejected func(username string, algorithm PasswordAlgorithm, srcAddr net.Addr)
+}
+
+// GenerateSHA256AuthKey generates keys for the SHA-256 password algorithm, in the format
+// used by ServerConfig.SHA256AuthHandler
+func GenerateSHA256AuthKey(username, realm, password string) []byte {
+	key := sha256.Sum256([]byte(strings.Join([]string{username, realm, password}, ":")))
+	return key[:]
+}
+
+// validate checks the algorithms, SHA-256 requires keys of it
+func (c *PasswordAlgorithmConfig) validate(sha256Keys bool) error {
+	for _, algorithms := range [][]PasswordAlgorithm{c.Accept, c.Advertise} {
+		for _, algorithm := range algorithms {
+			switch {
+			case algorithm == PasswordAlgorithmSHA256 && !sha256Keys:
+				return errNoSHA256AuthHandler
+			case algorithm != PasswordAlgorithmMD5 && algorithm != PasswordAlgorithmSHA256:
+				return errInvalidPasswordAlgorithm
+			}
+		}
+	}
+	return nil
+}
+
+func (c *PasswordAlgorithmConfig) toInternal() *server.PasswordAlgorithms {
+	if len(c.Accept) == 0 && len(c.Advertise) == 0 && !c.ReportOnly && c.OnRejected == nil {
+		return nil
+	}
+
+	internal := &server.PasswordAlgorithms{ReportOnly: c.ReportOnly}
+	for _, algorithm := range c.Accept {
+		internal.Accept = append(internal.Accept, proto.PasswordAlgorithm(algorithm))
+	}
+	if len(internal.Accept) == 0 {
+		internal.Accept = proto.PasswordAlgorithms{proto.PasswordAlgorithmMD5}
+	}
+	for _, algorithm := range c.Advertise {
+		internal.Advertise = append(internal.Advertise, proto.PasswordAlgorithm(algorithm))
+	}
+	if len(c.Advertise) == 0 && len(c.Accept) != 0 {
+		internal.Advertise = internal.Accept
+	}
+	if c.OnRejected != nil {
+		internal.OnRejected = func(username string, algorithm proto.PasswordAlgorithm, srcAddr net.Addr) {
+			c.OnRejected(username, PasswordAlgorithm(algorithm), srcAddr)
+		}
+	}
+	return internal
+}
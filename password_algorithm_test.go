@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordAlgorithmConfig(t *testing.T) {
+	assert.NoError(t, (&PasswordAlgorithmConfig{}).validate(false))
+	assert.ErrorIs(t, (&PasswordAlgorithmConfig{Accept: []PasswordAlgorithm{PasswordAlgorithmSHA256}}).validate(false), errNoSHA256AuthHandler)
+	assert.ErrorIs(t, (&PasswordAlgorithmConfig{Advertise: []PasswordAlgorithm{7}}).validate(true), errInvalidPasswordAlgorithm)
+
+	assert.Nil(t, (&PasswordAlgorithmConfig{}).toInternal(), "nothing should be advertised by default")
+	internal := (&PasswordAlgorithmConfig{Accept: []PasswordAlgorithm{PasswordAlgorithmSHA256, PasswordAlgorithmMD5}}).toInternal()
+	assert.Equal(t, proto.PasswordAlgorithms{proto.PasswordAlgorithmSHA256, proto.PasswordAlgorithmMD5}, internal.Advertise)
+	internal = (&PasswordAlgorithmConfig{ReportOnly: true}).toInternal()
+	assert.Equal(t, proto.PasswordAlgorithms{proto.PasswordAlgorithmMD5}, internal.Accept)
+	assert.Empty(t, internal.Advertise)
+}
+
+func TestServerPasswordAlgorithms(t *testing.T) {
+	var mutex sync.Mutex
+	var rejected []PasswordAlgorithm
+	config := PasswordAlgorithmConfig{
+		Accept: []PasswordAlgorithm{PasswordAlgorithmSHA256},
+		OnRejected: func(_ string, algorithm PasswordAlgorithm, _ net.Addr) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			rejected = append(rejected, algorithm)
+		},
+	}
+	rejections := func() []PasswordAlgorithm {
+		mutex.Lock()
+		defer mutex.Unlock()
+		r := rejected
+		rejected = nil
+		return r
+	}
+
+	newServer := func(config PasswordAlgorithmConfig) *Server {
+		serverConn, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+		require.NoError(t, err)
+
+		server, err := NewServer(ServerConfig{
+			AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateAuthKey(username, realm, "pass"), true
+			},
+			SHA256AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateSHA256AuthKey(username, realm, "pass"), true
+			},
+			PasswordAlgorithms: config,
+			PacketConnConfigs: []PacketConnConfig{
+				{
+					PacketConn: serverConn,
+					RelayAddressGenerator: &RelayAddressGeneratorStatic{
+						RelayAddress: net.ParseIP("127.0.0.1"),
+						Address:      "0.0.0.0",
+					},
+				},
+			},
+			Realm:         "pion.ly",
+			LoggerFactory: logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		return server
+	}
+
+	// allocate authenticates an Allocate request with a client that predates RFC 8489
+	allocate := func() error {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:3478",
+			Conn:           conn,
+			Username:       "user",
+			Password:       "pass",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	t.Run("SHA256", func(t *testing.T) {
+		server := newServer(config)
+		defer server.Close() //nolint:errcheck
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		roundTrip := func(setters ...stun.Setter) *stun.Message {
+			setters = append([]stun.Setter{
+				stun.TransactionID,
+				stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+				proto.RequestedTransport{Protocol: proto.ProtoUDP},
+			}, setters...)
+			msg, err := stun.Build(append(setters, stun.Fingerprint)...)
+			require.NoError(t, err)
+			_, err = conn.WriteTo(msg.Raw, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478})
+			require.NoError(t, err)
+
+			buf := make([]byte, 1500)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			n, _, err := conn.ReadFrom(buf)
+			require.NoError(t, err)
+			res := new(stun.Message)
+			require.NoError(t, stun.Decode(buf[:n], res))
+			return res
+		}
+		errorCode := func(m *stun.Message) stun.ErrorCode {
+			var code stun.ErrorCodeAttribute
+			require.NoError(t, code.GetFrom(m))
+			return code.Code
+		}
+
+		challenge := roundTrip()
+		assert.Equal(t, stun.CodeUnauthorized, errorCode(challenge))
+		var nonce stun.Nonce
+		require.NoError(t, nonce.GetFrom(challenge))
+		assert.True(t, strings.HasPrefix(nonce.String(), "obMatJos2AAAB"), "the nonce should carry the cookie")
+		var algorithms proto.PasswordAlgorithms
+		require.NoError(t, algorithms.GetFrom(challenge))
+		assert.Equal(t, proto.PasswordAlgorithms{proto.PasswordAlgorithmSHA256}, algorithms)
+
+		credentials := []stun.Setter{stun.NewUsername("user"), stun.NewRealm("pion.ly"), nonce}
+		key := GenerateSHA256AuthKey("user", "pion.ly", "pass")
+
+		// A downgraded PASSWORD-ALGORITHMS is refused
+		res := roundTrip(append(credentials,
+			proto.PasswordAlgorithms{proto.PasswordAlgorithmMD5, proto.PasswordAlgorithmSHA256},
+			proto.PasswordAlgorithmSHA256,
+			proto.MessageIntegritySHA256(key),
+		)...)
+		assert.Equal(t, stun.CodeBadRequest, errorCode(res))
+
+		res = roundTrip(append(credentials,
+			algorithms,
+			proto.PasswordAlgorithmSHA256,
+			proto.MessageIntegritySHA256(key),
+		)...)
+		assert.Equal(t, stun.ClassSuccessResponse, res.Type.Class)
+		assert.NoError(t, proto.MessageIntegritySHA256(key).Check(res), "the response should be signed alike")
+		assert.Empty(t, rejections())
+
+		// Legacy clients are refused
+		assert.Error(t, allocate())
+		assert.Equal(t, []PasswordAlgorithm{PasswordAlgorithmMD5}, rejections())
+	})
+
+	t.Run("ReportOnly", func(t *testing.T) {
+		config := config
+		config.ReportOnly = true
+		server := newServer(config)
+		defer server.Close() //nolint:errcheck
+
+		assert.NoError(t, allocate())
+		assert.Equal(t, []PasswordAlgorithm{PasswordAlgorithmMD5}, rejections())
+	})
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// peerConn is a net.Conn relaying to a single peer through the UDP allocation
+type peerConn struct {
+	relayConn net.PacketConn
+	peer      net.Addr
+	owned     bool // True if Close releases the allocation
+}
+
+// Dial returns a net.Conn whose reads and writes are relayed to and from the peer.
+// It creates the UDP allocation unless Allocate was already called, creates the
+// permission and binds a channel to the peer. Packets from other peers are discarded
+// by Read, so there should be a single reader on the allocation. Closing the returned
+// conn releases the allocation if Dial created it.
+func (c *Client) Dial(peer net.Addr) (net.Conn, error) {
+	return c.DialContext(context.Background(), peer)
+}
+
+// DialContext is Dial, giving up once the context is done
+func (c *Client) DialContext(ctx context.Context, peer net.Addr) (net.Conn, error) {
+	var relayConn net.PacketConn
+	owned := false
+	if conn := c.relayedUDPConn(); conn != nil {
+		relayConn = conn
+	} else {
+		var err error
+		if relayConn, err = c.AllocateContext(ctx); err != nil {
+			return nil, err
+		}
+		owned = true
+	}
+
+	if err := c.BindChannelContext(ctx, peer); err != nil {
+		if owned {
+			relayConn.Close() //nolint:errcheck,gosec
+		}
+		return nil, err
+	}
+
+	return &peerConn{
+		relayConn: relayConn,
+		peer:      peer,
+		owned:     owned,
+	}, nil
+}
+
+// Read reads the next packet of the peer
+func (p *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, from, err := p.relayConn.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+		if from.String() == p.peer.String() {
+			return n, nil
+		}
+	}
+}
+
+// Write relays the packet to the peer
+func (p *peerConn) Write(b []byte) (int, error) {
+	return p.relayConn.WriteTo(b, p.peer)
+}
+
+// Close releases the allocation if Dial created it
+func (p *peerConn) Close() error {
+	if p.owned {
+		return p.relayConn.Close()
+	}
+	return nil
+}
+
+// LocalAddr returns the relayed address
+func (p *peerConn) LocalAddr() net.Addr {
+	return p.relayConn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (p *peerConn) RemoteAddr() net.Addr {
+	return p.peer
+}
+
+// SetDeadline sets the read and write deadlines
+func (p *peerConn) SetDeadline(t time.Time) error {
+	return p.relayConn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (p *peerConn) SetReadDeadline(t time.Time) error {
+	return p.relayConn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline
+func (p *peerConn) SetWriteDeadline(t time.Time) error {
+	return p.relayConn.SetWriteDeadline(t)
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// profilingPath is where ProfilingHandler serves the profiles, like net/http/pprof
+	profilingPath = "/debug/pprof/"
+
+	defaultCPUProfileDuration = 30 * time.Second
+	maxCPUProfileDuration     = 5 * time.Minute
+
+	// labelRefreshInterval is how often the "allocations" label is brought up to date
+	labelRefreshInterval = time.Second
+)
+
+// allocationsLabel returns the bucket of the number of allocations n the readers of
+// a server are labeled with, a power of ten so the labels rarely change
+func allocationsLabel(n int) string {
+	switch {
+	case n < 10:
+		return "0-9"
+	case n < 100:
+		return "10-99"
+	case n < 1000:
+		return "100-999"
+	case n < 10000:
+		return "1000-9999"
+	case n < 100000:
+		return "10000-99999"
+	default:
+		return "100000+"
+	}
+}
+
+// readerLabels are the labels of the readers of a server while they are enabled,
+// replaced whenever they change
+type readerLabels struct {
+	allocations string
+}
+
+// profiler holds the profiling toggles of a Server, see SetProfilerLabels and
+// SetProfilingEndpoints
+type profiler struct {
+	allocationCount func() int
+
+	labels    atomic.Pointer[readerLabels] // nil while the labels are off
+	endpoints atomic.Bool
+
+	lock    sync.Mutex // Guards refresh
+	refresh chan struct{}
+}
+
+// setLabels turns the labels of the readers on or off. While they are on the
+// "allocations" label is refreshed in the background.
+func (p *profiler) setLabels(enabled bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	switch {
+	case enabled && p.refresh == nil:
+		p.labels.Store(&readerLabels{allocations: allocationsLabel(p.allocationCount())})
+		p.refresh = make(chan struct{})
+		go p.refreshLabels(p.refresh)
+	case !enabled && p.refresh != nil:
+		close(p.refresh)
+		p.refresh = nil
+		p.labels.Store(nil)
+	}
+}
+
+func (p *profiler) refreshLabels(done chan struct{}) {
+	ticker := time.NewTicker(labelRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		allocations := allocationsLabel(p.allocationCount())
+		if current := p.labels.Load(); current != nil && current.allocations != allocations {
+			p.labels.CompareAndSwap(current, &readerLabels{allocations: allocations})
+		}
+	}
+}
+
+func (p *profiler) close() {
+	p.setLabels(false)
+}
+
+// goroutineLabeler labels a reader of a listener with the current labels of
+// the profiler
+type goroutineLabeler struct {
+	profiler        *profiler
+	listener, realm string
+	current         *readerLabels
+}
+
+// update relabels the calling goroutine if the labels changed since the last
+// call, which is only an atomic load otherwise
+func (l *goroutineLabeler) update() {
+	labels := l.profiler.labels.Load()
+	if labels == l.current {
+		return
+	}
+	l.current = labels
+
+	if labels == nil {
+		pprof.SetGoroutineLabels(context.Background())
+		return
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(
+		"listener", l.listener, "realm", l.realm, "allocations", labels.allocations)))
+}
+
+// SetProfilerLabels turns the pprof labels of the goroutines of the server on or off
+// while it runs, see ServerConfig.ProfilerLabels. Readers are relabeled once they read
+// their next packet, allocations from their creation on.
+func (s *Server) SetProfilerLabels(enabled bool) {
+	s.profiler.setLabels(enabled)
+	for _, am := range s.allocationManagers {
+		am.SetProfilerLabels(enabled)
+	}
+}
+
+// SetProfilingEndpoints turns the profiles served by ProfilingHandler on or off while
+// the server runs, see ServerConfig.ProfilingEndpoints.
+func (s *Server) SetProfilingEndpoints(enabled bool) {
+	s.profiler.endpoints.Store(enabled)
+}
+
+// ProfilingHandler returns a handler serving the profiles of the process under
+// /debug/pprof/ like net/http/pprof, without registering on http.DefaultServeMux: the
+// index of the profiles at /debug/pprof/, a CPU profile of the next "seconds" at
+// /debug/pprof/profile, and the profiles of runtime/pprof such as the heap, allocs and
+// goroutine profiles at /debug/pprof/<name>, in text with "debug" set. While the
+// endpoints are off, see SetProfilingEndpoints, it responds 404 (Not Found). Mount it
+// on an address only operators can reach.
+func (s *Server) ProfilingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.profiler.endpoints.Load() || !strings.HasPrefix(r.URL.Path, profilingPath) {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch name := strings.TrimPrefix(r.URL.Path, profilingPath); name {
+		case "":
+			serveProfileIndex(w)
+		case "profile":
+			serveCPUProfile(w, r)
+		default:
+			serveProfile(w, r, name)
+		}
+	})
+}
+
+func serveProfileIndex(w http.ResponseWriter) {
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "profile\tCPU profile of the next ?seconds=%d\n", int(defaultCPUProfileDuration.Seconds())) //nolint:errcheck
+	for _, p := range profiles {
+		fmt.Fprintf(w, "%s\t%d\n", p.Name(), p.Count()) //nolint:errcheck
+	}
+}
+
+func serveCPUProfile(w http.ResponseWriter, r *http.Request) {
+	duration := defaultCPUProfileDuration
+	if seconds := r.URL.Query().Get("seconds"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil || n <= 0 || time.Duration(n)*time.Second > maxCPUProfileDuration {
+			http.Error(w, "invalid seconds", http.StatusBadRequest)
+			return
+		}
+		duration = time.Duration(n) * time.Second
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		// E.g. another CPU profile is being taken
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("Could not enable CPU profiling: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-r.Context().Done():
+	}
+	pprof.StopCPUProfile()
+}
+
+func serveProfile(w http.ResponseWriter, r *http.Request, name string) {
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	_ = profile.WriteTo(w, debug)
+}
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocationsLabel(t *testing.T) {
+	for n, label := range map[int]string{
+		0:      "0-9",
+		9:      "0-9",
+		10:     "10-99",
+		999:    "100-999",
+		5000:   "1000-9999",
+		99999:  "10000-99999",
+		100000: "100000+",
+	} {
+		assert.Equal(t, label, allocationsLabel(n), "%d allocations", n)
+	}
+}
+
+func TestServerProfilerLabels(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		PacketConnConfigs: []PacketConnConfig{{PacketConn: serverConn}},
+		Realm:             "pion.ly",
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	labeled := func() bool {
+		var profile bytes.Buffer
+		assert.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+		return strings.Contains(profile.String(), `"listener":"`+serverConn.LocalAddr().String()+`"`)
+	}
+	// Readers are relabeled by their next packet
+	poke := func() {
+		_, err := client.WriteTo([]byte("not stun"), serverConn.LocalAddr())
+		assert.NoError(t, err)
+	}
+
+	poke()
+	assert.Never(t, labeled, 100*time.Millisecond, 10*time.Millisecond)
+
+	server.SetProfilerLabels(true)
+	assert.Eventually(t, func() bool {
+		poke()
+		return labeled()
+	}, time.Second, 10*time.Millisecond)
+
+	server.SetProfilerLabels(false)
+	assert.Eventually(t, func() bool {
+		poke()
+		return !labeled()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServerProfilingHandler(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		PacketConnConfigs: []PacketConnConfig{{PacketConn: serverConn}},
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ProfilingHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// Off by default
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/heap").Code)
+
+	server.SetProfilingEndpoints(true)
+	index := get("/debug/pprof/")
+	assert.Equal(t, http.StatusOK, index.Code)
+	assert.Contains(t, index.Body.String(), "heap")
+
+	heap := get("/debug/pprof/heap")
+	assert.Equal(t, http.StatusOK, heap.Code)
+	assert.NotEmpty(t, heap.Body.Bytes())
+
+	goroutines := get("/debug/pprof/goroutine?debug=1")
+	assert.Equal(t, http.StatusOK, goroutines.Code)
+	assert.Contains(t, goroutines.Body.String(), "goroutine profile")
+
+	cpu := get("/debug/pprof/profile?seconds=1")
+	assert.Equal(t, http.StatusOK, cpu.Code)
+	assert.NotEmpty(t, cpu.Body.Bytes())
+
+	assert.Equal(t, http.StatusBadRequest, get("/debug/pprof/profile?seconds=-1").Code)
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/unknown").Code)
+	assert.Equal(t, http.StatusNotFound, get("/metrics").Code)
+
+	server.SetProfilingEndpoints(false)
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/").Code)
+}
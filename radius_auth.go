@@ -0,0 +1,313 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/radius"
+)
+
+const (
+	defaultRADIUSAuthPort       = "1812"
+	defaultRADIUSAccountingPort = "1813"
+	defaultRADIUSNASIdentifier  = "pion-turn"
+	defaultRADIUSTimeout        = 2 * time.Second
+	defaultRADIUSRetries        = 2
+	radiusAccountingQueueSize   = 256
+)
+
+// RADIUSConfig configures a RADIUSClient
+type RADIUSConfig struct {
+	// Addr is the host:port of the RADIUS server authenticating users. The port
+	// defaults to 1812.
+	Addr string
+
+	// AccountingAddr is the host:port accounting records are sent to. Defaults to
+	// the host of Addr on port 1813.
+	AccountingAddr string
+
+	// Secret is shared with the RADIUS server
+	Secret string
+
+	// NASIdentifier identifies the server to the RADIUS server. Defaults to "pion-turn".
+	NASIdentifier string
+
+	// Timeout is how long to wait for an answer to every attempt of a request, and
+	// Retries how often an unanswered request is sent again. Default to 2 seconds
+	// and 2 retries; a negative Retries sends every request once.
+	Timeout time.Duration
+	Retries int
+
+	// InterimInterval is how often an Interim-Update record is sent for every
+	// allocation. Defaults to 0, which only sends Start and Stop records.
+	InterimInterval time.Duration
+
+	// CacheTTL is how long a key is cached. Defaults to a minute; a negative value
+	// disables the cache.
+	CacheTTL time.Duration
+
+	Log logging.LeveledLogger
+}
+
+// RADIUSClient authenticates TURN users against a RADIUS server (RFC 2865) and
+// accounts for their allocations (RFC 2866), see NewRADIUSClient
+type RADIUSClient struct {
+	auth          *radius.Client
+	accounting    *radius.Client
+	nasIdentifier string
+	cacheTTL      time.Duration
+	log           logging.LeveledLogger
+	cache         *authKeyCache
+
+	mutex    sync.Mutex
+	sessions map[ServerAllocation]string // Acct-Session-Id of every allocation
+	queue    chan *radius.Packet
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRADIUSClient returns a RADIUSClient. Set its AuthHandler as the
+// ServerConfig.AuthHandler, and its OnAllocationCreated and OnAllocationDeleted
+// as those of the ServerConfig for accounting. Close it once the server is closed.
+//
+// A TURN server never receives the password of a user, only a proof that the
+// client knows it, so it can not present the password to the RADIUS server.
+// Instead it sends an Access-Request with Service-Type Authorize-Only, and the
+// Access-Accept must return the TURN password of the user in a Tunnel-Password
+// attribute, which is encrypted with the shared secret.
+//
+// Every allocation is accounted as a session: an Accounting-Request with
+// Acct-Status-Type Start is sent once it is created and Stop once it is deleted,
+// optionally with Interim-Updates in between. Acct-Input-Octets counts the payload
+// the client relayed to its peers and Acct-Output-Octets the payload relayed back.
+func NewRADIUSClient(config RADIUSConfig) (*RADIUSClient, error) {
+	if config.Addr == "" || config.Secret == "" {
+		return nil, errInvalidRADIUSConfig
+	}
+	host, port, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		host, port = config.Addr, defaultRADIUSAuthPort
+	}
+	if config.AccountingAddr == "" {
+		config.AccountingAddr = net.JoinHostPort(host, defaultRADIUSAccountingPort)
+	}
+	if config.NASIdentifier == "" {
+		config.NASIdentifier = defaultRADIUSNASIdentifier
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultRADIUSTimeout
+	}
+	switch {
+	case config.Retries == 0:
+		config.Retries = defaultRADIUSRetries
+	case config.Retries < 0:
+		config.Retries = 0
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultAuthCacheTTL
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	c := &RADIUSClient{
+		auth: &radius.Client{
+			Addr:    net.JoinHostPort(host, port),
+			Secret:  []byte(config.Secret),
+			Timeout: config.Timeout,
+			Retries: config.Retries,
+		},
+		accounting: &radius.Client{
+			Addr:    config.AccountingAddr,
+			Secret:  []byte(config.Secret),
+			Timeout: config.Timeout,
+			Retries: config.Retries,
+		},
+		nasIdentifier: config.NASIdentifier,
+		cacheTTL:      config.CacheTTL,
+		log:           config.Log,
+		cache:         newAuthKeyCache(),
+		sessions:      map[ServerAllocation]string{},
+		queue:         make(chan *radius.Packet, radiusAccountingQueueSize),
+		done:          make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.sendAccounting()
+	if config.InterimInterval > 0 {
+		c.wg.Add(1)
+		go c.sendInterimUpdates(config.InterimInterval)
+	}
+	return c, nil
+}
+
+// AuthHandler returns a turn.AuthHandler authenticating users against the RADIUS server
+func (c *RADIUSClient) AuthHandler() AuthHandler {
+	return c.authenticate
+}
+
+// OnAllocationCreated starts the accounting session of an allocation
+func (c *RADIUSClient) OnAllocationCreated(a ServerAllocation) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		c.log.Errorf("Failed to generate Acct-Session-Id: %s", err)
+		return
+	}
+	sessionID := hex.EncodeToString(id[:])
+
+	c.mutex.Lock()
+	c.sessions[a] = sessionID
+	c.mutex.Unlock()
+	c.enqueue(a, sessionID, radius.StatusStart)
+}
+
+// OnAllocationDeleted stops the accounting session of an allocation
+func (c *RADIUSClient) OnAllocationDeleted(a ServerAllocation) {
+	c.mutex.Lock()
+	sessionID, ok := c.sessions[a]
+	delete(c.sessions, a)
+	c.mutex.Unlock()
+	if ok {
+		c.enqueue(a, sessionID, radius.StatusStop)
+	}
+}
+
+// Close sends the queued accounting records and stops the client
+func (c *RADIUSClient) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.queue)
+	close(c.done)
+	c.mutex.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
+
+func (c *RADIUSClient) authenticate(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	c.log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	if key, ok := c.cache.get(username, realm); ok {
+		return key, true
+	}
+
+	request, err := radius.NewRequest(radius.CodeAccessRequest)
+	if err != nil {
+		c.log.Errorf("Failed to create Access-Request: %s", err)
+		return nil, false
+	}
+	request.AddString(radius.UserName, username)
+	request.AddUint32(radius.ServiceType, radius.ServiceTypeAuthorizeOnly)
+	request.AddString(radius.NASIdentifier, c.nasIdentifier)
+	if srcAddr != nil {
+		request.AddString(radius.CallingStationID, srcAddr.String())
+	}
+	request.Add(radius.MessageAuthenticator, nil)
+
+	response, err := c.auth.Exchange(request)
+	if err != nil {
+		c.log.Errorf("Access-Request for %q failed: %s", username, err)
+		return nil, false
+	}
+	if response.Code != radius.CodeAccessAccept {
+		c.log.Debugf("RADIUS server rejected %q with code %d", username, response.Code)
+		return nil, false
+	}
+
+	value, ok := response.Get(radius.TunnelPassword)
+	if !ok {
+		c.log.Errorf("Access-Accept for %q has no Tunnel-Password", username)
+		return nil, false
+	}
+	password, err := radius.DecryptTunnelPassword(value, c.auth.Secret, request.Authenticator)
+	if err != nil {
+		c.log.Errorf("Access-Accept for %q has an invalid Tunnel-Password: %s", username, err)
+		return nil, false
+	}
+
+	key = GenerateAuthKey(username, realm, password)
+	c.cache.put(username, realm, key, c.cacheTTL)
+	return key, true
+}
+
+// enqueue queues an accounting record of the allocation, without blocking the
+// server on the RADIUS server
+func (c *RADIUSClient) enqueue(a ServerAllocation, sessionID string, status uint32) {
+	request, err := radius.NewRequest(radius.CodeAccountingRequest)
+	if err != nil {
+		c.log.Errorf("Failed to create Accounting-Request: %s", err)
+		return
+	}
+	traffic := a.Traffic()
+	request.AddUint32(radius.AcctStatusType, status)
+	request.AddString(radius.AcctSessionID, sessionID)
+	request.AddString(radius.UserName, a.Username())
+	request.AddString(radius.NASIdentifier, c.nasIdentifier)
+	request.AddString(radius.CallingStationID, a.ClientAddr().String())
+	request.AddString(radius.CalledStationID, a.ServerAddr().String())
+	if status != radius.StatusStart {
+		request.AddUint32(radius.AcctSessionTime, uint32(time.Since(a.CreatedAt())/time.Second))
+		request.AddUint32(radius.AcctInputOctets, uint32(traffic.BytesToPeer))
+		request.AddUint32(radius.AcctInputGigawords, uint32(traffic.BytesToPeer>>32))
+		request.AddUint32(radius.AcctOutputOctets, uint32(traffic.BytesFromPeer))
+		request.AddUint32(radius.AcctOutputGigawords, uint32(traffic.BytesFromPeer>>32))
+		request.AddUint32(radius.AcctInputPackets, uint32(traffic.PacketsToPeer))
+		request.AddUint32(radius.AcctOutputPackets, uint32(traffic.PacketsFromPeer))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- request:
+	default:
+		c.log.Warnf("Accounting queue is full, dropping record of session %s", sessionID)
+	}
+}
+
+func (c *RADIUSClient) sendAccounting() {
+	defer c.wg.Done()
+	for request := range c.queue {
+		if _, err := c.accounting.Exchange(request); err != nil {
+			c.log.Errorf("Accounting-Request failed: %s", err)
+		}
+	}
+}
+
+func (c *RADIUSClient) sendInterimUpdates(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mutex.Lock()
+		sessions := make(map[ServerAllocation]string, len(c.sessions))
+		for a, sessionID := range c.sessions {
+			sessions[a] = sessionID
+		}
+		c.mutex.Unlock()
+		for a, sessionID := range sessions {
+			c.enqueue(a, sessionID, radius.StatusInterimUpdate)
+		}
+	}
+}
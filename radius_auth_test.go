@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/radius"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRADIUSSecret = "radius secret"
+
+// fakeRADIUSServer answers Access-Requests for the users in passwords and
+// records every Accounting-Request
+type fakeRADIUSServer struct {
+	auth, accounting net.PacketConn
+	passwords        map[string]string
+
+	mutex   sync.Mutex
+	records []*radius.Packet
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newFakeRADIUSServer(t *testing.T, passwords map[string]string) *fakeRADIUSServer {
+	t.Helper()
+
+	auth, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	accounting, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeRADIUSServer{
+		auth:       auth,
+		accounting: accounting,
+		passwords:  passwords,
+		stopped:    make(chan struct{}, 16),
+	}
+	s.wg.Add(2)
+	go s.serve(t, auth)
+	go s.serve(t, accounting)
+	return s
+}
+
+func (s *fakeRADIUSServer) serve(t *testing.T, conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if !assert.NoError(t, radius.VerifyRequest(buf[:n], []byte(testRADIUSSecret))) {
+			continue
+		}
+		request, err := radius.Decode(buf[:n])
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		response := &radius.Packet{Code: radius.CodeAccountingResponse}
+		if request.Code == radius.CodeAccessRequest {
+			response.Code = radius.CodeAccessReject
+			username, _ := request.Get(radius.UserName)
+			serviceType, _ := request.GetUint32(radius.ServiceType)
+			if password, ok := s.passwords[string(username)]; ok && serviceType == radius.ServiceTypeAuthorizeOnly {
+				value, err := radius.EncryptTunnelPassword(password, []byte(testRADIUSSecret), request.Authenticator)
+				assert.NoError(t, err)
+				response.Code = radius.CodeAccessAccept
+				response.Add(radius.TunnelPassword, value)
+			}
+			response.Add(radius.MessageAuthenticator, nil)
+		} else {
+			s.mutex.Lock()
+			s.records = append(s.records, request)
+			s.mutex.Unlock()
+			if status, _ := request.GetUint32(radius.AcctStatusType); status == radius.StatusStop {
+				s.stopped <- struct{}{}
+			}
+		}
+
+		b, err := response.EncodeResponse(request, []byte(testRADIUSSecret))
+		assert.NoError(t, err)
+		_, err = conn.WriteTo(b, addr)
+		assert.NoError(t, err)
+	}
+}
+
+func (s *fakeRADIUSServer) Close() {
+	_ = s.auth.Close()
+	_ = s.accounting.Close()
+	s.wg.Wait()
+}
+
+func TestRADIUSClient(t *testing.T) {
+	_, err := NewRADIUSClient(RADIUSConfig{Addr: "127.0.0.1"})
+	assert.ErrorIs(t, err, errInvalidRADIUSConfig)
+
+	radiusServer := newFakeRADIUSServer(t, map[string]string{"alice": "pass"})
+	defer radiusServer.Close()
+
+	radiusClient, err := NewRADIUSClient(RADIUSConfig{
+		Addr:            radiusServer.auth.LocalAddr().String(),
+		AccountingAddr:  radiusServer.accounting.LocalAddr().String(),
+		Secret:          testRADIUSSecret,
+		Timeout:         time.Second,
+		InterimInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	handler := radiusClient.AuthHandler()
+	key, ok := handler("alice", "pion.ly", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+	assert.True(t, ok)
+	assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "pass"), key)
+	_, ok = handler("mallory", "pion.ly", nil)
+	assert.False(t, ok)
+
+	serverListener, err := net.ListenPacket("udp4", "0.0.0.0:3478")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		AuthHandler: handler,
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm:               "pion.ly",
+		LoggerFactory:       logging.NewDefaultLoggerFactory(),
+		OnAllocationCreated: radiusClient.OnAllocationCreated,
+		OnAllocationDeleted: radiusClient.OnAllocationDeleted,
+	})
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		STUNServerAddr: "127.0.0.1:3478",
+		TURNServerAddr: "127.0.0.1:3478",
+		Conn:           conn,
+		Username:       "alice",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	// 10 bytes to the peer, 4 bytes back
+	_, err = relayConn.WriteTo([]byte("0123456789"), peer.LocalAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	n, _, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	_, err = peer.WriteTo([]byte("pong"), relayConn.LocalAddr())
+	require.NoError(t, err)
+	n, _, err = relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	assert.NoError(t, relayConn.Close())
+	select {
+	case <-radiusServer.stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no Stop record")
+	}
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+	assert.NoError(t, radiusClient.Close())
+
+	radiusServer.mutex.Lock()
+	defer radiusServer.mutex.Unlock()
+	require.Len(t, radiusServer.records, 2)
+	start, stop := radiusServer.records[0], radiusServer.records[1]
+	for status, record := range map[uint32]*radius.Packet{radius.StatusStart: start, radius.StatusStop: stop} {
+		actual, _ := record.GetUint32(radius.AcctStatusType)
+		assert.Equal(t, status, actual)
+		username, _ := record.Get(radius.UserName)
+		assert.Equal(t, "alice", string(username))
+	}
+	startID, _ := start.Get(radius.AcctSessionID)
+	stopID, _ := stop.Get(radius.AcctSessionID)
+	assert.Equal(t, startID, stopID)
+
+	for attribute, expected := range map[radius.AttributeType]uint32{
+		radius.AcctInputOctets:   10,
+		radius.AcctOutputOctets:  4,
+		radius.AcctInputPackets:  1,
+		radius.AcctOutputPackets: 1,
+	} {
+		actual, ok := stop.GetUint32(attribute)
+		assert.True(t, ok, attribute)
+		assert.Equal(t, expected, actual, attribute)
+	}
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+import "net"
+
+// readBatches is only supported on Linux, conns are read one datagram at a time
+func (s *Server) readBatches(net.PacketConn, func(buf []byte, n int, addr net.Addr)) bool {
+	return false
+}
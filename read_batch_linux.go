@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+)
+
+// batchReader reads several datagrams per system call, with recvmmsg(2)
+type batchReader interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// readBatches reads datagrams from UDP sockets in batches of ReadBatchSize and
+// hands them to handle until the socket fails. It returns false for any other
+// conn, which must then be read one datagram at a time.
+func (s *Server) readBatches(conn net.PacketConn, handle func(buf []byte, n int, addr net.Addr)) bool {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok || s.readBatchSize <= 1 {
+		return false
+	}
+
+	var reader batchReader = ipv4.NewPacketConn(udpConn)
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+		reader = ipv6.NewPacketConn(udpConn)
+	}
+
+	ms := make([]ipv4.Message, s.readBatchSize)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, s.inboundMTU)}
+	}
+	for {
+		n, err := reader.ReadBatch(ms, 0)
+		if err != nil {
+			fastlog.Debugw(s.log, "Exit read loop on error", "listener", conn.LocalAddr(), "err", err)
+			s.publishListenerError(conn.LocalAddr(), err)
+			return true
+		}
+		for i := range ms[:n] {
+			handle(ms[i].Buffers[0], ms[i].N, ms[i].Addr)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatches(t *testing.T) {
+	_, err := NewServer(ServerConfig{ReadBatchSize: -1, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidReadBatchSize)
+
+	for _, network := range []string{"udp4", "udp6"} {
+		t.Run(network, func(t *testing.T) {
+			address := "127.0.0.1:0"
+			if network == "udp6" {
+				address = "[::1]:0"
+			}
+			serverConn, err := net.ListenPacket(network, address)
+			if err != nil {
+				t.Skipf("No %s: %s", network, err)
+			}
+			server, err := NewServer(ServerConfig{
+				PacketConnConfigs: []PacketConnConfig{
+					{
+						PacketConn: serverConn,
+						RelayAddressGenerator: &RelayAddressGeneratorStatic{
+							RelayAddress: net.ParseIP("127.0.0.1"),
+							Address:      "0.0.0.0",
+						},
+					},
+				},
+				Realm:         "pion.ly",
+				ReadBatchSize: 8,
+				LoggerFactory: logging.NewDefaultLoggerFactory(),
+			})
+			require.NoError(t, err)
+			defer server.Close() //nolint:errcheck
+
+			conn, err := net.ListenPacket(network, address)
+			require.NoError(t, err)
+			defer conn.Close() //nolint:errcheck
+
+			// A burst of requests is read in batches, every one of them is answered
+			const requests = 64
+			transactions := map[[stun.TransactionIDSize]byte]bool{}
+			for i := 0; i < requests; i++ {
+				m, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+				require.NoError(t, err)
+				transactions[m.TransactionID] = true
+				_, err = conn.WriteTo(m.Raw, serverConn.LocalAddr())
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			buf := make([]byte, 1500)
+			for len(transactions) > 0 {
+				n, _, err := conn.ReadFrom(buf)
+				require.NoError(t, err)
+				m := &stun.Message{Raw: buf[:n]}
+				require.NoError(t, m.Decode())
+				assert.Equal(t, stun.BindingSuccess, m.Type)
+
+				var mapped stun.XORMappedAddress
+				require.NoError(t, mapped.GetFrom(m))
+				assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, mapped.Port) //nolint:forcetypeassert
+				delete(transactions, m.TransactionID)
+			}
+		})
+	}
+}
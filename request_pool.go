@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/server"
+)
+
+const defaultRequestQueueSize = 1024
+
+// sendIndication is the type of Send indications in the first two bytes of a message
+var sendIndication = stun.NewType(stun.MethodSend, stun.ClassIndication).Value() //nolint:gochecknoglobals
+
+type requestJob struct {
+	request server.Request
+	buf     *[]byte
+}
+
+// requestPool handles STUN messages on a bounded set of workers, apart from the
+// readers that keep relaying ChannelData and Send indications
+type requestPool struct {
+	log     logging.LeveledLogger
+	jobs    chan requestJob
+	buffers *bufpool.Pool
+	dropped atomic.Uint64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	workers   sync.WaitGroup
+}
+
+func newRequestPool(workers, queueSize int, buffers *bufpool.Pool, log logging.LeveledLogger) *requestPool {
+	if queueSize == 0 {
+		queueSize = defaultRequestQueueSize
+	}
+	p := &requestPool{
+		log:     log,
+		jobs:    make(chan requestJob, queueSize),
+		buffers: buffers,
+		closed:  make(chan struct{}),
+	}
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// isRelayed tells if buf is relayed rather than handled by the pool
+func isRelayed(buf []byte) bool {
+	return proto.IsChannelData(buf) || (len(buf) >= 2 && binary.BigEndian.Uint16(buf) == sendIndication)
+}
+
+// submit queues a copy of the request and its buffer, or drops it if the queue
+// is full. Clients retransmit dropped requests.
+func (p *requestPool) submit(request server.Request) {
+	buf := p.buffers.Copy(request.Buff)
+	request.Buff = *buf
+	select {
+	case p.jobs <- requestJob{request: request, buf: buf}:
+	default:
+		p.buffers.Put(buf)
+		p.dropped.Add(1)
+	}
+}
+
+func (p *requestPool) work() {
+	defer p.workers.Done()
+	for {
+		select {
+		case job := <-p.jobs:
+			if err := server.HandleRequest(job.request); err != nil {
+				fastlog.Errorw(p.log, "Failed to handle datagram", "src", job.request.SrcAddr, "err", err)
+			}
+			p.buffers.Put(job.buf)
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// Close stops the workers once they handled their current request
+func (p *requestPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	p.workers.Wait()
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestPool(t *testing.T) {
+	channelData := &proto.ChannelData{Number: proto.MinChannelNumber, Data: []byte("media")}
+	channelData.Encode()
+	send, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodSend, stun.ClassIndication))
+	require.NoError(t, err)
+	allocate, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest))
+	require.NoError(t, err)
+	assert.True(t, isRelayed(channelData.Raw))
+	assert.True(t, isRelayed(send.Raw))
+	assert.False(t, isRelayed(allocate.Raw))
+
+	// Without workers the queue fills up
+	pool := newRequestPool(0, 2, bufpool.New(1500), logging.NewDefaultLoggerFactory().NewLogger("test"))
+	for i := 0; i < 5; i++ {
+		pool.submit(server.Request{Buff: allocate.Raw})
+	}
+	assert.Equal(t, uint64(3), pool.dropped.Load())
+	pool.Close()
+}
+
+func TestServerRequestWorkers(t *testing.T) {
+	_, err := NewServer(ServerConfig{RequestWorkers: -1, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidRequestWorkers)
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm:          "pion.ly",
+		RequestWorkers: 2,
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+
+	// Requests are handled by the workers, the data in between by the reader
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	buf := make([]byte, 1500)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < 3; i++ {
+		_, err = relayConn.WriteTo([]byte("to peer"), peer.LocalAddr())
+		require.NoError(t, err)
+		n, _, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "to peer", string(buf[:n]))
+	}
+	assert.Equal(t, uint64(0), server.RequestsDropped())
+
+	assert.NoError(t, server.Close())
+}
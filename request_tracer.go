@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/pion/turn/v4/internal/server"
+)
+
+// RequestTracer traces the requests handled by a Server, see ServerConfig.RequestTracer
+// and the OpenTelemetry tracer of module tracing/otel.
+type RequestTracer interface {
+	// StartRequest starts the span of a request with its STUN method, e.g. "Allocate",
+	// and transaction ID from the client at srcAddr
+	StartRequest(method string, transactionID [stun.TransactionIDSize]byte, srcAddr net.Addr) RequestSpan
+}
+
+// RequestSpan traces the handling of a single request. Its methods are called on the
+// goroutine handling the request.
+type RequestSpan interface {
+	// SetUsername is called with the username of an authenticated request once it is
+	// read, before its credentials are checked
+	SetUsername(username string)
+	// SetResponseCode is called with the error code of the response sent to the
+	// request, zero for success responses
+	SetResponseCode(code int)
+	// End is called once the request is handled, with the error handling it failed
+	// with if any. Requests may fail without a response, e.g. when they are not
+	// authenticated like their allocation.
+	End(err error)
+}
+
+// internalSpan adapts a RequestSpan to the spans of internal/server
+type internalSpan struct {
+	RequestSpan
+}
+
+func (s internalSpan) SetResponseCode(code stun.ErrorCode) {
+	s.RequestSpan.SetResponseCode(int(code))
+}
+
+func internalRequestTracer(tracer RequestTracer) func(m *stun.Message, srcAddr net.Addr) server.Span {
+	if tracer == nil {
+		return nil
+	}
+	return func(m *stun.Message, srcAddr net.Addr) server.Span {
+		return internalSpan{tracer.StartRequest(m.Type.Method.String(), m.TransactionID, srcAddr)}
+	}
+}
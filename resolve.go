@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/transport/v3"
+)
+
+// SRVResolver looks up DNS SRV records of TURN servers, like net.Resolver does
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// turnResolver resolves the addresses and URIs of TURN servers
+type turnResolver struct {
+	net      transport.Net
+	resolver SRVResolver
+	log      logging.LeveledLogger
+}
+
+func isTURNURI(addr string) bool {
+	return strings.HasPrefix(addr, "turn:") || strings.HasPrefix(addr, "turns:")
+}
+
+// resolve resolves a TURN server address, or the servers of a TURN URI, see
+// https://datatracker.ietf.org/doc/html/rfc7065. If the URI has no port and its
+// host is no IP address, the SRV records of the host are looked up as described in
+// https://datatracker.ietf.org/doc/html/rfc5928#section-3, and the targets are
+// returned in the order they should be tried. Without SRV records, the host is
+// resolved with the default port of the scheme.
+func (r *turnResolver) resolve(ctx context.Context, addr string) ([]net.Addr, error) {
+	if !isTURNURI(addr) {
+		serv, err := r.net.ResolveUDPAddr("udp4", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Addr{serv}, nil
+	}
+
+	uri, err := stun.ParseURI(addr)
+	if err != nil {
+		return nil, err
+	}
+	defaultAddr := net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+	if hasPort(addr) || net.ParseIP(uri.Host) != nil {
+		return r.resolve(ctx, defaultAddr)
+	}
+
+	service, proto := "turn", "udp"
+	switch {
+	case uri.Scheme == stun.SchemeTypeTURNS:
+		service, proto = "turns", "tcp"
+	case uri.Proto == stun.ProtoTypeTCP:
+		proto = "tcp"
+	}
+	_, records, err := r.resolver.LookupSRV(ctx, service, proto, uri.Host)
+	if err != nil || len(records) == 0 {
+		r.log.Debugf("No SRV records for %s, resolving %s", addr, defaultAddr)
+		return r.resolve(ctx, defaultAddr)
+	}
+
+	var servers []net.Addr
+	for _, record := range orderSRV(records) {
+		if record.Target == "." {
+			continue // The service is decidedly not available at the host
+		}
+		target := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		serv, resolveErr := r.net.ResolveUDPAddr("udp4", target)
+		if resolveErr != nil {
+			// The other targets are fallbacks
+			r.log.Warnf("Failed to resolve SRV target %s of %s: %s", target, addr, resolveErr)
+			err = resolveErr
+			continue
+		}
+		servers = append(servers, serv)
+	}
+	if len(servers) == 0 {
+		if err == nil {
+			err = errTURNServiceUnavailable
+		}
+		return nil, err
+	}
+	return servers, nil
+}
+
+// hasPort reports whether a TURN URI has an explicit port
+func hasPort(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	_, _, err = net.SplitHostPort(u.Opaque)
+	return err == nil
+}
+
+// orderSRV orders SRV records by priority, and randomly by weight within a
+// priority, see https://datatracker.ietf.org/doc/html/rfc2782
+func orderSRV(records []*net.SRV) []*net.SRV {
+	remaining := append([]*net.SRV{}, records...)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		if remaining[i].Priority != remaining[j].Priority {
+			return remaining[i].Priority < remaining[j].Priority
+		}
+		// Records of weight 0 go first, with a small chance to be picked
+		return remaining[i].Weight == 0 && remaining[j].Weight != 0
+	})
+
+	ordered := make([]*net.SRV, 0, len(remaining))
+	for len(remaining) > 0 {
+		// Records of the lowest remaining priority
+		n := 1
+		for n < len(remaining) && remaining[n].Priority == remaining[0].Priority {
+			n++
+		}
+
+		group := remaining[:n]
+		for len(group) > 0 {
+			total := 0
+			for _, record := range group {
+				total += int(record.Weight)
+			}
+			pick := rand.Intn(total + 1) //nolint:gosec
+			i := 0
+			for sum := int(group[0].Weight); sum < pick; sum += int(group[i].Weight) {
+				i++
+			}
+			ordered = append(ordered, group[i])
+			group = append(group[:i], group[i+1:]...)
+		}
+		remaining = remaining[n:]
+	}
+	return ordered
+}
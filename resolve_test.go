@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3/stdnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// srvResolver answers SRV lookups from a map by "_service._proto.name"
+type srvResolver struct {
+	records map[string][]*net.SRV
+	lookups []string
+}
+
+func (r *srvResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	key := "_" + service + "._" + proto + "." + name
+	r.lookups = append(r.lookups, key)
+	records, ok := r.records[key]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: key, IsNotFound: true}
+	}
+	return key, records, nil
+}
+
+func TestTURNResolver(t *testing.T) {
+	n, err := stdnet.NewNet()
+	require.NoError(t, err)
+
+	resolver := &srvResolver{records: map[string][]*net.SRV{
+		"_turn._udp.turn.example.com": {
+			{Target: "127.0.0.2.", Port: 3479, Priority: 20},
+			{Target: "127.0.0.1.", Port: 3478, Priority: 10},
+		},
+		"_turn._tcp.turn.example.com":  {{Target: "127.0.0.1.", Port: 3480}},
+		"_turns._tcp.turn.example.com": {{Target: "127.0.0.1.", Port: 5349}},
+		"_turn._udp.none.example.com":  {{Target: "."}},
+	}}
+	r := &turnResolver{
+		net:      n,
+		resolver: resolver,
+		log:      logging.NewDefaultLoggerFactory().NewLogger("test"),
+	}
+
+	for _, tc := range []struct {
+		addr    string
+		servers []string
+		lookup  string
+	}{
+		{"127.0.0.1:3478", []string{"127.0.0.1:3478"}, ""},
+		{"turn:turn.example.com", []string{"127.0.0.1:3478", "127.0.0.2:3479"}, "_turn._udp.turn.example.com"},
+		{"turn:turn.example.com?transport=tcp", []string{"127.0.0.1:3480"}, "_turn._tcp.turn.example.com"},
+		{"turns:turn.example.com", []string{"127.0.0.1:5349"}, "_turns._tcp.turn.example.com"},
+		{"turn:127.0.0.1", []string{"127.0.0.1:3478"}, ""},
+		{"turn:localhost:3481", []string{"127.0.0.1:3481"}, ""},
+		{"turn:localhost", []string{"127.0.0.1:3478"}, "_turn._udp.localhost"}, // Without SRV records
+	} {
+		resolver.lookups = nil
+		servers, err := r.resolve(context.Background(), tc.addr)
+		require.NoError(t, err, tc.addr)
+
+		var addrs []string
+		for _, server := range servers {
+			addrs = append(addrs, server.String())
+		}
+		assert.Equal(t, tc.servers, addrs, tc.addr)
+		if tc.lookup == "" {
+			assert.Empty(t, resolver.lookups, tc.addr)
+		} else {
+			assert.Equal(t, []string{tc.lookup}, resolver.lookups, tc.addr)
+		}
+	}
+
+	_, err = r.resolve(context.Background(), "turn:none.example.com")
+	assert.ErrorIs(t, err, errTURNServiceUnavailable)
+
+	// The targets become the servers of a client
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	require.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		Conn:            conn,
+		TURNServerAddr:  "turn:turn.example.com",
+		TURNServerAddrs: []string{"turns:turn.example.com"},
+		Resolver:        resolver,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3478", client.TURNServerAddr().String())
+	assert.Len(t, client.turnServers, 3)
+	assert.NoError(t, conn.Close())
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c", Priority: 30},
+		{Target: "a1", Priority: 10},
+		{Target: "b1", Priority: 20, Weight: 0},
+		{Target: "b2", Priority: 20, Weight: 100},
+		{Target: "a2", Priority: 10},
+	}
+
+	heavyFirst := 0
+	for i := 0; i < 100; i++ {
+		ordered := orderSRV(records)
+		require.Len(t, ordered, len(records))
+		assert.ElementsMatch(t, []string{"a1", "a2"}, []string{ordered[0].Target, ordered[1].Target})
+		assert.ElementsMatch(t, []string{"b1", "b2"}, []string{ordered[2].Target, ordered[3].Target})
+		assert.Equal(t, "c", ordered[4].Target)
+		if ordered[2].Target == "b2" {
+			heavyFirst++
+		}
+	}
+	assert.Greater(t, heavyFirst, 90)
+
+	// The records are not reordered in place
+	assert.Equal(t, "c", records[0].Target)
+}
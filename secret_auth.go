@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+const defaultSecretPollInterval = 10 * time.Second
+
+// SecretCredentialStoreConfig configures a SecretCredentialStore
+type SecretCredentialStoreConfig struct {
+	// Dir is the directory a Kubernetes Secret or ConfigMap is mounted at. Every key of it
+	// is a username, its value the password of the user.
+	Dir string
+
+	// Keys reads the values as hex encoded keys of GenerateAuthKey instead of passwords,
+	// so the passwords are not stored, but the keys only work for the realm they were
+	// generated for
+	Keys bool
+
+	// Realms scopes the users by realm, so the same username can have other credentials in
+	// another realm: every subdirectory of Dir is a realm with the users of that realm, e.g.
+	// one Secret per realm mounted at Dir/<realm>. Files directly in Dir are ignored then.
+	Realms bool
+
+	// PollInterval is how often the directory is read for changes. Defaults to 10 seconds.
+	// Kubernetes itself takes up to a minute to update mounted Secrets.
+	PollInterval time.Duration
+
+	// OnReload is called whenever the credentials changed, with the number of users, or
+	// when reading them failed. The store keeps the previous credentials on failures.
+	// Optional.
+	OnReload func(users int, err error)
+
+	Log logging.LeveledLogger
+}
+
+// SecretCredentialStore authenticates users with the credentials of a mounted Kubernetes
+// Secret or ConfigMap, and picks changes up without a restart, so small clusters can
+// manage users with kubectl:
+//
+//	kubectl create secret generic turn-users --from-literal=alice=pass
+//
+// Any directory with one file per user works the same, files starting with a dot are
+// ignored.
+type SecretCredentialStore struct {
+	config      SecretCredentialStoreConfig
+	credentials atomic.Value // map[string][]byte
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewSecretCredentialStore reads the credentials and starts watching them for changes.
+// Close it once the server is closed.
+func NewSecretCredentialStore(config SecretCredentialStoreConfig) (*SecretCredentialStore, error) {
+	if config.Dir == "" || config.PollInterval < 0 {
+		return nil, errInvalidSecretStoreConfig
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultSecretPollInterval
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	s := &SecretCredentialStore{config: config, done: make(chan struct{})}
+	credentials, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	s.credentials.Store(credentials)
+
+	go s.watch()
+	return s, nil
+}
+
+// AuthHandler returns a turn.AuthHandler looking the users up in the store
+func (s *SecretCredentialStore) AuthHandler() AuthHandler {
+	return s.authenticate
+}
+
+// Close stops watching the credentials
+func (s *SecretCredentialStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *SecretCredentialStore) authenticate(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	s.config.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	name := username
+	if s.config.Realms {
+		name = realmScopedName(realm, username)
+	}
+	credential, ok := s.credentials.Load().(map[string][]byte)[name] //nolint:forcetypeassert
+	if !ok {
+		return nil, false
+	}
+	if s.config.Keys {
+		return credential, true
+	}
+	return GenerateAuthKey(username, realm, string(credential)), true
+}
+
+func (s *SecretCredentialStore) watch() {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload reads the credentials and swaps them in if they changed
+func (s *SecretCredentialStore) reload() {
+	credentials, err := s.read()
+	if err != nil {
+		s.config.Log.Errorf("Failed to read credentials from %s: %s", s.config.Dir, err)
+		if s.config.OnReload != nil {
+			s.config.OnReload(0, err)
+		}
+		return
+	}
+	if equalCredentials(credentials, s.credentials.Load().(map[string][]byte)) {
+		return
+	}
+
+	s.credentials.Store(credentials)
+	s.config.Log.Infof("Reloaded %d users from %s", len(credentials), s.config.Dir)
+	if s.config.OnReload != nil {
+		s.config.OnReload(len(credentials), nil)
+	}
+}
+
+// read reads the credentials of every user in the directory, or in the directories of
+// the realms
+func (s *SecretCredentialStore) read() (map[string][]byte, error) {
+	credentials := map[string][]byte{}
+	if !s.config.Realms {
+		return credentials, s.readDir(s.config.Dir, "", credentials)
+	}
+
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(s.config.Dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := s.readDir(path, entry.Name(), credentials); err != nil {
+			return nil, err
+		}
+	}
+	return credentials, nil
+}
+
+// readDir reads the credentials of every user in dir, of the realm unless it is empty.
+// Kubernetes mounts every key as a symbolic link into a hidden directory, which is
+// swapped atomically on updates.
+func (s *SecretCredentialStore) readDir(dir, realm string, credentials map[string][]byte) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		value, err := os.ReadFile(path) //nolint:gosec
+		if err != nil {
+			return err
+		}
+
+		name := entry.Name()
+		if realm != "" {
+			name = realmScopedName(realm, name)
+		}
+		value = bytes.TrimSpace(value)
+		if s.config.Keys {
+			if value, err = hex.DecodeString(string(value)); err != nil || len(value) != md5KeySize {
+				s.config.Log.Errorf("Invalid key for %q", name)
+				continue
+			}
+		}
+		credentials[name] = value
+	}
+	return nil
+}
+
+// realmScopedName names the credentials of a user of a realm in the stores that scope
+// their users by realm
+func realmScopedName(realm, username string) string {
+	return realm + "/" + username
+}
+
+func equalCredentials(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for username, credential := range a {
+		if other, ok := b[username]; !ok || !bytes.Equal(credential, other) {
+			return false
+		}
+	}
+	return true
+}
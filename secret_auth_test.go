@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mountSecret writes the data the way the kubelet mounts a Secret: the files are in a
+// timestamped directory behind the ..data symlink, which is swapped on updates, and
+// every key is a symlink through it
+func mountSecret(t *testing.T, dir, version string, data map[string]string) {
+	t.Helper()
+
+	versionDir := filepath.Join(dir, ".."+version)
+	require.NoError(t, os.Mkdir(versionDir, 0o750))
+	for key, value := range data {
+		require.NoError(t, os.WriteFile(filepath.Join(versionDir, key), []byte(value), 0o600))
+		if _, err := os.Lstat(filepath.Join(dir, key)); err != nil {
+			require.NoError(t, os.Symlink(filepath.Join("..data", key), filepath.Join(dir, key)))
+		}
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	require.NoError(t, os.Symlink(".."+version, tmp))
+	require.NoError(t, os.Rename(tmp, filepath.Join(dir, "..data")))
+}
+
+func TestSecretCredentialStore(t *testing.T) {
+	_, err := NewSecretCredentialStore(SecretCredentialStoreConfig{})
+	assert.ErrorIs(t, err, errInvalidSecretStoreConfig)
+	_, err = NewSecretCredentialStore(SecretCredentialStoreConfig{Dir: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+
+	t.Run("Passwords", func(t *testing.T) {
+		dir := t.TempDir()
+		mountSecret(t, dir, "1", map[string]string{"alice": "pass\n", "bob": "secret"})
+
+		var reloads []int
+		store, err := NewSecretCredentialStore(SecretCredentialStoreConfig{
+			Dir: dir,
+			OnReload: func(users int, err error) {
+				assert.NoError(t, err)
+				reloads = append(reloads, users)
+			},
+		})
+		require.NoError(t, err)
+		defer store.Close() //nolint:errcheck
+		handler := store.AuthHandler()
+
+		key, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "pass"), key, "the trailing newline should be ignored")
+		_, ok = handler("..data", "pion.ly", nil)
+		assert.False(t, ok, "hidden files should be ignored")
+
+		store.reload()
+		assert.Empty(t, reloads, "unchanged credentials should not be reloaded")
+
+		// kubectl edit removes bob and changes the password of alice
+		require.NoError(t, os.Remove(filepath.Join(dir, "bob")))
+		mountSecret(t, dir, "2", map[string]string{"alice": "new pass"})
+		store.reload()
+		assert.Equal(t, []int{1}, reloads)
+
+		key, ok = handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "new pass"), key)
+		_, ok = handler("bob", "pion.ly", nil)
+		assert.False(t, ok)
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		dir := t.TempDir()
+		key := GenerateAuthKey("alice", "pion.ly", "pass")
+		mountSecret(t, dir, "1", map[string]string{"alice": hex.EncodeToString(key), "bob": "not a key"})
+
+		store, err := NewSecretCredentialStore(SecretCredentialStoreConfig{Dir: dir, Keys: true})
+		require.NoError(t, err)
+		handler := store.AuthHandler()
+
+		actualKey, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, key, actualKey)
+		_, ok = handler("bob", "pion.ly", nil)
+		assert.False(t, ok, "invalid keys should be skipped")
+
+		// A failed read keeps the credentials
+		require.NoError(t, os.RemoveAll(dir))
+		store.reload()
+		_, ok = handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.NoError(t, store.Close())
+	})
+	t.Run("Realms", func(t *testing.T) {
+		dir := t.TempDir()
+		for realm, password := range map[string]string{"pion.ly": "pass", "example.com": "other pass"} {
+			require.NoError(t, os.Mkdir(filepath.Join(dir, realm), 0o750))
+			mountSecret(t, filepath.Join(dir, realm), "1", map[string]string{"alice": password})
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bob"), []byte("pass"), 0o600))
+
+		store, err := NewSecretCredentialStore(SecretCredentialStoreConfig{Dir: dir, Realms: true})
+		require.NoError(t, err)
+		defer store.Close() //nolint:errcheck
+		handler := store.AuthHandler()
+
+		key, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "pass"), key)
+		key, ok = handler("alice", "example.com", nil)
+		assert.True(t, ok)
+		assert.Equal(t, GenerateAuthKey("alice", "example.com", "other pass"), key)
+		_, ok = handler("alice", "other.org", nil)
+		assert.False(t, ok)
+		_, ok = handler("bob", "pion.ly", nil)
+		assert.False(t, ok, "users outside a realm should be ignored")
+	})
+}
@@ -0,0 +1,415 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/logging"
+
+	"github.com/pion/turn/v4/internal/sigv4"
+)
+
+const (
+	defaultSecretRefreshInterval = 5 * time.Minute
+	defaultSecretRotationGrace   = time.Hour
+	defaultSecretFetchTimeout    = 10 * time.Second
+	maxSecretResponseSize        = 1024 * 1024
+)
+
+// CredentialSource fetches the fields of a secret from a secret manager, see
+// NewSecretManagerStore
+type CredentialSource interface {
+	// FetchCredentials returns the fields of the secret and its version, which is
+	// empty if the secret manager does not version secrets
+	FetchCredentials(ctx context.Context) (fields map[string]string, version string, err error)
+}
+
+// VaultSource is a CredentialSource reading a secret of the KV version 2 secrets
+// engine of HashiCorp Vault
+type VaultSource struct {
+	// Addr of the Vault server, e.g. https://vault.example.com:8200
+	Addr string
+
+	// Token authenticates the TURN server against Vault. It needs read access to the
+	// secret only.
+	Token string
+
+	// Namespace of Vault Enterprise. Optional.
+	Namespace string
+
+	// Mount is the path the secrets engine is mounted at. Defaults to "secret".
+	Mount string
+
+	// Path is the path of the secret in the engine, e.g. "turn/users"
+	Path string
+
+	// Client sends the requests. Defaults to an http.Client with a timeout of 5 seconds
+	Client *http.Client
+}
+
+// FetchCredentials reads the latest version of the secret
+func (s *VaultSource) FetchCredentials(ctx context.Context) (map[string]string, string, error) {
+	mount := s.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(s.Addr, "/")+"/v1/"+strings.Trim(mount, "/")+"/data/"+strings.Trim(s.Path, "/"), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+
+	var res struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := doSecretRequest(s.Client, req, &res); err != nil {
+		return nil, "", err
+	}
+
+	fields := make(map[string]string, len(res.Data.Data))
+	for name, value := range res.Data.Data {
+		if value, ok := value.(string); ok {
+			fields[name] = value
+		}
+	}
+	return fields, strconv.Itoa(res.Data.Metadata.Version), nil
+}
+
+// AWSSecretsManagerSource is a CredentialSource reading a secret of AWS Secrets Manager,
+// whose SecretString is a JSON object of string fields
+type AWSSecretsManagerSource struct {
+	// Region of the secret, e.g. "eu-central-1"
+	Region string
+
+	// SecretID is the name or ARN of the secret
+	SecretID string
+
+	// Credentials of an identity allowed to secretsmanager:GetSecretValue the secret.
+	// SessionToken is only set for temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint replaces https://secretsmanager.<Region>.amazonaws.com, e.g. for a VPC
+	// endpoint. Optional.
+	Endpoint string
+
+	// Client sends the requests. Defaults to an http.Client with a timeout of 5 seconds
+	Client *http.Client
+}
+
+// FetchCredentials reads the current version of the secret
+func (s *AWSSecretsManagerSource) FetchCredentials(ctx context.Context) (map[string]string, string, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + s.Region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": s.SecretID})
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.Sign(req, body, sigv4.Credentials{
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		SessionToken:    s.SessionToken,
+	}, s.Region, "secretsmanager", time.Now())
+
+	var res struct {
+		SecretString string `json:"SecretString"`
+		VersionID    string `json:"VersionId"`
+	}
+	if err := doSecretRequest(s.Client, req, &res); err != nil {
+		return nil, "", err
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(res.SecretString), &fields); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errInvalidSecret, err) //nolint:errorlint
+	}
+	return fields, res.VersionID, nil
+}
+
+// doSecretRequest sends the request to a secret manager and decodes its JSON response
+func doSecretRequest(client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", errSecretManagerStatus, res.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxSecretResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidSecret, err) //nolint:errorlint
+	}
+	return nil
+}
+
+// SecretManagerStoreConfig configures a SecretManagerStore
+type SecretManagerStoreConfig struct {
+	// Source is the secret manager, e.g. a VaultSource or an AWSSecretsManagerSource
+	Source CredentialSource
+
+	// SharedSecretField is the field of the secret holding the shared secret of TURN REST
+	// credentials, see SecretManagerStore.TURNRESTAuthHandler. Every other field is a
+	// username with its password.
+	SharedSecretField string
+
+	// Realms scopes the users by realm, so the same username can have another password in
+	// another realm: the fields are named "<realm>/<username>", and the shared secret of a
+	// realm is in the field "<realm>/<SharedSecretField>".
+	Realms bool
+
+	// RefreshInterval is how often the secret is fetched again. Defaults to 5 minutes.
+	RefreshInterval time.Duration
+
+	// RotationGrace is how long the previous shared secret stays valid once it is rotated,
+	// so credentials signed shortly before keep working. Defaults to an hour.
+	RotationGrace time.Duration
+
+	// MaxTTL rejects TURN REST credentials expiring more than MaxTTL in the future, see
+	// TURNRESTAuthConfig.MaxTTL
+	MaxTTL time.Duration
+
+	// Timeout bounds every fetch. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// OnRotation is called whenever the fetched credentials changed. Optional.
+	OnRotation func(rotation CredentialRotation)
+
+	Log logging.LeveledLogger
+}
+
+// CredentialRotation is a change of the credentials of a SecretManagerStore
+type CredentialRotation struct {
+	// Version of the secret, as reported by the secret manager
+	Version string
+
+	// Users is the number of users of the secret
+	Users int
+
+	// SharedSecretRotated is set when the shared secret changed
+	SharedSecretRotated bool
+}
+
+// SecretManagerStore authenticates users with credentials kept in a secret manager like
+// HashiCorp Vault or AWS Secrets Manager, and picks up rotations without a restart
+type SecretManagerStore struct {
+	config    SecretManagerStoreConfig
+	state     atomic.Value // *secretManagerState
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type secretManagerState struct {
+	fields  map[string]string
+	version string
+
+	// previous are the rotated shared secrets by their field, valid during the RotationGrace
+	previous map[string]rotatedSecret
+}
+
+type rotatedSecret struct {
+	secret string
+	until  time.Time
+}
+
+// NewSecretManagerStore fetches the secret and starts refreshing it. Close it once the
+// server is closed.
+func NewSecretManagerStore(config SecretManagerStoreConfig) (*SecretManagerStore, error) {
+	if config.Source == nil || config.RefreshInterval < 0 || config.RotationGrace < 0 || config.Timeout < 0 {
+		return nil, errInvalidSecretManagerConfig
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = defaultSecretRefreshInterval
+	}
+	if config.RotationGrace == 0 {
+		config.RotationGrace = defaultSecretRotationGrace
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultSecretFetchTimeout
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	s := &SecretManagerStore{config: config, done: make(chan struct{})}
+	fields, version, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.state.Store(&secretManagerState{fields: fields, version: version})
+
+	go s.watch()
+	return s, nil
+}
+
+// AuthHandler returns a turn.AuthHandler for the users of the secret
+func (s *SecretManagerStore) AuthHandler() AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+		s.config.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+		name := s.field(realm, username)
+		if s.isSharedSecretField(name) {
+			return nil, false
+		}
+		password, ok := s.state.Load().(*secretManagerState).fields[name] //nolint:forcetypeassert
+		if !ok {
+			return nil, false
+		}
+		return GenerateAuthKey(username, realm, password), true
+	}
+}
+
+// TURNRESTAuthHandler returns a turn.MultiKeyAuthHandler for TURN REST credentials signed
+// with the shared secret of the secret, like NewTURNRESTAuthHandler, or with the previous
+// one during the RotationGrace
+func (s *SecretManagerStore) TURNRESTAuthHandler() MultiKeyAuthHandler {
+	return func(username, realm string, srcAddr net.Addr) (keys [][]byte, ok bool) {
+		s.config.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+		state := s.state.Load().(*secretManagerState) //nolint:forcetypeassert
+		field := s.field(realm, s.config.SharedSecretField)
+		var secrets []string
+		if secret := state.fields[field]; secret != "" && s.config.SharedSecretField != "" {
+			secrets = append(secrets, secret)
+		}
+		if previous, ok := state.previous[field]; ok && time.Now().Before(previous.until) {
+			secrets = append(secrets, previous.secret)
+		}
+		if len(secrets) == 0 {
+			s.config.Log.Errorf("No shared secret in field %q", field)
+			return nil, false
+		}
+		return turnRESTKeys(username, realm, secrets, s.config.MaxTTL, s.config.Log)
+	}
+}
+
+// Close stops refreshing the secret
+func (s *SecretManagerStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *SecretManagerStore) fetch() (map[string]string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	return s.config.Source.FetchCredentials(ctx)
+}
+
+func (s *SecretManagerStore) watch() {
+	ticker := time.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.refresh()
+		}
+	}
+}
+
+// refresh fetches the secret and swaps it in if it changed. The last credentials are
+// kept while the secret manager can not be reached.
+func (s *SecretManagerStore) refresh() {
+	fields, version, err := s.fetch()
+	if err != nil {
+		s.config.Log.Errorf("Failed to fetch credentials: %s", err)
+		return
+	}
+
+	old := s.state.Load().(*secretManagerState) //nolint:forcetypeassert
+	if equalFields(fields, old.fields) {
+		return
+	}
+
+	now := time.Now()
+	state := &secretManagerState{fields: fields, version: version, previous: map[string]rotatedSecret{}}
+	for field, previous := range old.previous {
+		if now.Before(previous.until) {
+			state.previous[field] = previous
+		}
+	}
+	rotation := CredentialRotation{Version: version}
+	for name := range fields {
+		if !s.isSharedSecretField(name) {
+			rotation.Users++
+		}
+	}
+	for name, previous := range old.fields {
+		if s.isSharedSecretField(name) && previous != "" && previous != fields[name] {
+			rotation.SharedSecretRotated = true
+			state.previous[name] = rotatedSecret{secret: previous, until: now.Add(s.config.RotationGrace)}
+		}
+	}
+	s.state.Store(state)
+
+	s.config.Log.Infof("Credentials rotated to version %q", version)
+	if s.config.OnRotation != nil {
+		s.config.OnRotation(rotation)
+	}
+}
+
+// field is the name of the field of a user or the shared secret of the realm
+func (s *SecretManagerStore) field(realm, name string) string {
+	if s.config.Realms {
+		return realmScopedName(realm, name)
+	}
+	return name
+}
+
+func (s *SecretManagerStore) isSharedSecretField(name string) bool {
+	if s.config.SharedSecretField == "" {
+		return false
+	}
+	if s.config.Realms {
+		return strings.HasSuffix(name, "/"+s.config.SharedSecretField)
+	}
+	return name == s.config.SharedSecretField
+}
+
+func equalFields(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || value != other {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCredentialSource is a CredentialSource returning fields set by the test
+type fakeCredentialSource struct {
+	mutex   sync.Mutex
+	fields  map[string]string
+	version string
+	err     error
+}
+
+func (s *fakeCredentialSource) FetchCredentials(context.Context) (map[string]string, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fields := make(map[string]string, len(s.fields))
+	for name, value := range s.fields {
+		fields[name] = value
+	}
+	return fields, s.version, s.err
+}
+
+func (s *fakeCredentialSource) set(fields map[string]string, version string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fields, s.version, s.err = fields, version, err
+}
+
+func TestSecretManagerStore(t *testing.T) {
+	_, err := NewSecretManagerStore(SecretManagerStoreConfig{})
+	assert.ErrorIs(t, err, errInvalidSecretManagerConfig)
+
+	source := &fakeCredentialSource{err: errInvalidSecret}
+	_, err = NewSecretManagerStore(SecretManagerStoreConfig{Source: source})
+	assert.ErrorIs(t, err, errInvalidSecret, "the first fetch should be required")
+
+	source.set(map[string]string{"alice": "pass", "restSecret": "old secret"}, "1", nil)
+	var rotations []CredentialRotation
+	store, err := NewSecretManagerStore(SecretManagerStoreConfig{
+		Source:            source,
+		SharedSecretField: "restSecret",
+		RefreshInterval:   time.Hour,
+		OnRotation:        func(rotation CredentialRotation) { rotations = append(rotations, rotation) },
+	})
+	require.NoError(t, err)
+	defer store.Close() //nolint:errcheck
+
+	auth := store.AuthHandler()
+	rest := store.TURNRESTAuthHandler()
+
+	key, ok := auth("alice", "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "pass"), key)
+	_, ok = auth("restSecret", "pion.ly", nil)
+	assert.False(t, ok, "the shared secret should not be a password")
+
+	oldUsername, oldPassword, err := GenerateLongTermTURNRESTCredentials("old secret", "bob", time.Minute)
+	require.NoError(t, err)
+	keys, ok := rest(oldUsername, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{GenerateAuthKey(oldUsername, "pion.ly", oldPassword)}, keys)
+
+	// Unchanged credentials are no rotation
+	store.refresh()
+	assert.Empty(t, rotations)
+
+	// An unreachable secret manager keeps the credentials
+	source.set(nil, "", errSecretManagerStatus)
+	store.refresh()
+	_, ok = auth("alice", "pion.ly", nil)
+	assert.True(t, ok)
+
+	source.set(map[string]string{"carol": "pass", "restSecret": "new secret"}, "2", nil)
+	store.refresh()
+	assert.Equal(t, []CredentialRotation{{Version: "2", Users: 1, SharedSecretRotated: true}}, rotations)
+
+	_, ok = auth("alice", "pion.ly", nil)
+	assert.False(t, ok)
+	_, ok = auth("carol", "pion.ly", nil)
+	assert.True(t, ok)
+
+	newUsername, newPassword, err := GenerateLongTermTURNRESTCredentials("new secret", "bob", time.Minute)
+	require.NoError(t, err)
+	keys, ok = rest(newUsername, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Contains(t, keys, GenerateAuthKey(newUsername, "pion.ly", newPassword))
+	keys, ok = rest(oldUsername, "pion.ly", nil)
+	assert.True(t, ok, "the previous secret should stay valid during the grace period")
+	assert.Contains(t, keys, GenerateAuthKey(oldUsername, "pion.ly", oldPassword))
+
+	state := store.state.Load().(*secretManagerState) //nolint:forcetypeassert
+	state.previous["restSecret"] = rotatedSecret{secret: "old secret", until: time.Now().Add(-time.Second)}
+	keys, ok = rest(oldUsername, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.NotContains(t, keys, GenerateAuthKey(oldUsername, "pion.ly", oldPassword))
+}
+
+func TestSecretManagerStoreRealms(t *testing.T) {
+	source := &fakeCredentialSource{fields: map[string]string{
+		"pion.ly/alice":          "pass",
+		"pion.ly/restSecret":     "pion secret",
+		"example.com/alice":      "other pass",
+		"example.com/restSecret": "example secret",
+	}, version: "1"}
+	var rotations []CredentialRotation
+	store, err := NewSecretManagerStore(SecretManagerStoreConfig{
+		Source:            source,
+		SharedSecretField: "restSecret",
+		Realms:            true,
+		RefreshInterval:   time.Hour,
+		OnRotation:        func(rotation CredentialRotation) { rotations = append(rotations, rotation) },
+	})
+	require.NoError(t, err)
+	defer store.Close() //nolint:errcheck
+
+	auth := store.AuthHandler()
+	rest := store.TURNRESTAuthHandler()
+
+	key, ok := auth("alice", "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Equal(t, GenerateAuthKey("alice", "pion.ly", "pass"), key)
+	key, ok = auth("alice", "example.com", nil)
+	assert.True(t, ok)
+	assert.Equal(t, GenerateAuthKey("alice", "example.com", "other pass"), key)
+	_, ok = auth("alice", "other.org", nil)
+	assert.False(t, ok)
+	_, ok = auth("restSecret", "pion.ly", nil)
+	assert.False(t, ok, "the shared secret should not be a password")
+
+	username, password, err := GenerateLongTermTURNRESTCredentials("pion secret", "bob", time.Minute)
+	require.NoError(t, err)
+	keys, ok := rest(username, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{GenerateAuthKey(username, "pion.ly", password)}, keys)
+	keys, ok = rest(username, "example.com", nil)
+	assert.True(t, ok)
+	assert.NotContains(t, keys, GenerateAuthKey(username, "example.com", password))
+
+	// Rotating the secret of one realm keeps the previous one of that realm only
+	source.set(map[string]string{
+		"pion.ly/alice":          "pass",
+		"pion.ly/restSecret":     "new pion secret",
+		"example.com/restSecret": "example secret",
+	}, "2", nil)
+	store.refresh()
+	assert.Equal(t, []CredentialRotation{{Version: "2", Users: 1, SharedSecretRotated: true}}, rotations)
+	keys, ok = rest(username, "pion.ly", nil)
+	assert.True(t, ok)
+	assert.Contains(t, keys, GenerateAuthKey(username, "pion.ly", password))
+	keys, ok = rest(username, "example.com", nil)
+	assert.True(t, ok)
+	assert.Len(t, keys, 1)
+}
+
+func TestVaultSource(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/kv/data/turn/users" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"alice":"pass","port":3478},"metadata":{"version":7}}}`))
+	}))
+	defer vault.Close()
+
+	source := &VaultSource{Addr: vault.URL + "/", Token: "token", Namespace: "team", Mount: "kv", Path: "/turn/users"}
+	fields, version, err := source.FetchCredentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": "pass"}, fields, "fields that are no strings should be skipped")
+	assert.Equal(t, "7", version)
+
+	source.Token = "wrong"
+	_, _, err = source.FetchCredentials(context.Background())
+	assert.ErrorIs(t, err, errSecretManagerStatus)
+}
+
+func TestAWSSecretsManagerSource(t *testing.T) {
+	secretString := `{"alice":"pass"}`
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ SecretId string } //nolint:revive,stylecheck
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil ||
+			r.Method != http.MethodPost ||
+			r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			r.Header.Get("X-Amz-Security-Token") != "session" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-central-1/secretsmanager/aws4_request") ||
+			body.SecretId != "turn/users" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		res, _ := json.Marshal(map[string]string{"SecretString": secretString, "VersionId": "v1"})
+		_, _ = w.Write(res)
+	}))
+	defer aws.Close()
+
+	source := &AWSSecretsManagerSource{
+		Region:          "eu-central-1",
+		SecretID:        "turn/users",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        aws.URL,
+	}
+	fields, version, err := source.FetchCredentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": "pass"}, fields)
+	assert.Equal(t, "v1", version)
+
+	secretString = "not json"
+	_, _, err = source.FetchCredentials(context.Background())
+	assert.ErrorIs(t, err, errInvalidSecret)
+
+	source.SessionToken = ""
+	_, _, err = source.FetchCredentials(context.Background())
+	assert.ErrorIs(t, err, errSecretManagerStatus)
+}
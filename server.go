@@ -8,23 +8,37 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
 
 	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/pion/turn/v4/internal/fastlog"
+	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/ratelimit"
 	"github.com/pion/turn/v4/internal/server"
 )
 
 const (
-	defaultInboundMTU = 1600
+	defaultInboundMTU    = 1600
+	defaultReadBatchSize = 32
+	minNonceKeyLength    = 32
 )
 
 // Server is an instance of the Pion TURN Server
 type Server struct {
 	log                logging.LeveledLogger
 	authHandler        AuthHandler
+	policyAuthHandler  PolicyAuthHandler
+	multiKeyAuth       MultiKeyAuthHandler
+	requestAuth        RequestAuthHandler
+	allocationPolicy   AllocationPolicy
 	relayConnHandler   RelayConnHandler
 	realm              string
 	channelBindTimeout time.Duration
@@ -34,6 +48,63 @@ type Server struct {
 	listenerConfigs    []ListenerConfig
 	allocationManagers []*allocation.Manager
 	inboundMTU         int
+	readBatchSize      int
+	packetConnReaders  int
+	ioEngine           ioEngine
+	relayEngine        ioEngine // Reads the relay sockets shared, see SharedRelayReaders
+	requestPool        *requestPool
+
+	streamWriteQueueSize int
+	streamWritesDropped  atomic.Uint64
+
+	socketBuffers SocketBufferConfig
+	sockets       []net.PacketConn // PacketConns of packetConnConfigs before the ioEngine wrapped them
+	socketTuner   *socketTuner
+
+	connectRelaySockets  bool
+	udpOffload           bool
+	dataIndicationBatch  int
+	relayQueueSize       int
+	relayQueueDropPolicy RelayQueueDropPolicy
+
+	maxPermissions     int
+	maxChannelBindings int
+	evictionHandler    EvictionHandler
+	channelOffloader   allocation.ChannelOffloader
+
+	egressLimiter *ratelimit.SharedBucket
+	fairQueue     *allocation.FairQueue
+	admission     *allocation.Admission
+	memoryBudget  *allocation.MemoryBudget
+	timerWheel    *allocation.TimerWheel
+	bufferPool    *bufpool.Pool
+
+	profilerLabels bool
+	profiler       profiler
+	expvar         *expvarServer // Nil unless published, see ServerConfig.ExpvarPrefix
+
+	onAllocationCreated func(a ServerAllocation)
+	onAllocationDeleted func(a ServerAllocation)
+	onRequestHandled    func(method string, code int)
+	requestTracer       RequestTracer
+	events              eventHub
+
+	lockout          *server.Lockout
+	challengeLimiter *ratelimit.PrefixLimiter
+
+	guestAllocationManagers []*allocation.Manager
+
+	credentialExpiry       CredentialExpiryHandler
+	stopAtCredentialExpiry bool
+	authorizeAllocation    AllocationAuthorizer
+
+	sha256AuthHandler  AuthHandler
+	passwordAlgorithms *server.PasswordAlgorithms
+
+	auditSink AuditSink
+
+	integrityCalculator server.IntegrityCalculator
+	cacheSessionKeys    bool
 }
 
 // NewServer creates the Pion TURN server
@@ -44,6 +115,10 @@ func NewServer(config ServerConfig) (*Server, error) {
 		return nil, err
 	}
 
+	if err := checkExpvarPrefix(config.ExpvarPrefix); err != nil {
+		return nil, err
+	}
+
 	loggerFactory := config.LoggerFactory
 	if loggerFactory == nil {
 		loggerFactory = logging.NewDefaultLoggerFactory()
@@ -54,57 +129,186 @@ func NewServer(config ServerConfig) (*Server, error) {
 		mtu = config.InboundMTU
 	}
 
-	nonceHash, err := server.NewNonceHash()
+	readBatchSize := defaultReadBatchSize
+	if config.ReadBatchSize != 0 {
+		readBatchSize = config.ReadBatchSize
+	}
+
+	nonceHash, err := server.NewNonceHashWithConfig(server.NonceHashConfig{
+		BindAddr: config.BindNoncesToClientAddr,
+		MaxUses:  config.NonceMaxUses,
+		Key:      config.NonceKey,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Server{
-		log:                loggerFactory.NewLogger("turn"),
+		log:                fastlog.New(loggerFactory, "turn", config.LogRateLimit),
 		relayConnHandler:   config.RelayConnHandler,
 		authHandler:        config.AuthHandler,
+		policyAuthHandler:  config.PolicyAuthHandler,
+		multiKeyAuth:       config.MultiKeyAuthHandler,
+		requestAuth:        config.RequestAuthHandler,
+		allocationPolicy:   config.AllocationPolicy,
 		realm:              config.Realm,
 		channelBindTimeout: config.ChannelBindTimeout,
 		packetConnConfigs:  config.PacketConnConfigs,
 		listenerConfigs:    config.ListenerConfigs,
 		nonceHash:          nonceHash,
 		inboundMTU:         mtu,
+		bufferPool:         bufpool.New(mtu),
+		readBatchSize:      readBatchSize,
+		packetConnReaders:  1,
+
+		streamWriteQueueSize: config.StreamWriteQueueSize,
+		socketBuffers:        config.SocketBuffers,
+
+		connectRelaySockets:  config.ConnectRelaySockets,
+		udpOffload:           config.UDPOffload,
+		dataIndicationBatch:  config.DataIndicationBatch,
+		relayQueueSize:       config.RelayQueueSize,
+		relayQueueDropPolicy: config.RelayQueueDropPolicy,
+
+		maxPermissions:     config.MaxPermissionsPerAllocation,
+		maxChannelBindings: config.MaxChannelBindingsPerAllocation,
+		evictionHandler:    config.EvictionHandler,
+		channelOffloader:   newInternalChannelOffloader(config.ChannelOffloader),
+
+		onAllocationCreated: config.OnAllocationCreated,
+		onAllocationDeleted: config.OnAllocationDeleted,
+		onRequestHandled:    config.OnRequestHandled,
+		requestTracer:       config.RequestTracer,
+
+		credentialExpiry:       config.CredentialExpiry,
+		stopAtCredentialExpiry: config.StopAtCredentialExpiry,
+		authorizeAllocation:    config.AuthorizeAllocation,
+
+		sha256AuthHandler:  config.SHA256AuthHandler,
+		passwordAlgorithms: config.PasswordAlgorithms.toInternal(),
+
+		auditSink: config.AuditSink,
+
+		integrityCalculator: newInternalIntegrityCalculator(config.IntegrityCalculator),
+		cacheSessionKeys:    config.CacheSessionKeys,
+
+		profilerLabels: config.ProfilerLabels,
+	}
+
+	if config.PacketConnReaders != 0 {
+		s.packetConnReaders = config.PacketConnReaders
+	}
+
+	if config.RequestWorkers > 0 {
+		s.requestPool = newRequestPool(config.RequestWorkers, config.RequestQueueSize, s.bufferPool, s.log)
 	}
 
 	if s.channelBindTimeout == 0 {
 		s.channelBindTimeout = proto.DefaultLifetime
 	}
 
+	if config.EgressBandwidth > 0 {
+		s.egressLimiter = ratelimit.NewSharedBucket(config.EgressBandwidth)
+	}
+
+	if config.MaxAllocations > 0 {
+		s.admission = allocation.NewAdmission(config.MaxAllocations, config.ReservedAllocations)
+	}
+
+	if config.FairQueueing {
+		s.fairQueue = allocation.NewFairQueue()
+	}
+
+	s.memoryBudget = config.MemoryBudget.toInternal()
+
+	if config.TimerResolution > 0 {
+		s.timerWheel = allocation.NewTimerWheel(config.TimerResolution)
+	}
+
+	if config.Lockout.Threshold > 0 {
+		s.lockout = server.NewLockout(config.Lockout.toInternal())
+	}
+
+	if config.ChallengeRateLimit > 0 {
+		s.challengeLimiter = ratelimit.NewPrefixLimiter(int64(config.ChallengeRateLimit), 2*int64(config.ChallengeRateLimit))
+	}
+
+	for _, cfg := range s.packetConnConfigs {
+		if err := setSocketBuffers(cfg.PacketConn, s.socketBuffers); err != nil {
+			return nil, fmt.Errorf("failed to size the socket buffers: %w", err)
+		}
+		s.sockets = append(s.sockets, cfg.PacketConn)
+	}
+
+	if s.ioEngine, err = newIOEngine(config.IOEngine, mtu, s.log); err != nil {
+		return nil, err
+	}
+	if s.ioEngine != nil {
+		// The conns of the caller are closed with their replacements
+		s.packetConnConfigs = append([]PacketConnConfig(nil), s.packetConnConfigs...)
+		for i := range s.packetConnConfigs {
+			s.packetConnConfigs[i].PacketConn = s.ioEngine.wrap(s.packetConnConfigs[i].PacketConn)
+		}
+	}
+	if config.SharedRelayReaders && s.relayConnHandler == nil {
+		if config.IOEngine == IOEngineEpoll {
+			s.relayEngine = s.ioEngine
+		} else if s.relayEngine, err = newIOEpoll(mtu, s.log); err != nil {
+			return nil, errors.Join(err, s.closeIOEngines())
+		}
+	}
+
 	for _, cfg := range s.packetConnConfigs {
-		am, err := s.createAllocationManager(cfg.RelayAddressGenerator, cfg.PermissionHandler)
+		am, err := s.createAllocationManager(cfg.RelayAddressGenerator, cfg.PermissionHandler, cfg.Guest)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create AllocationManager: %w", err)
 		}
 
-		go func(cfg PacketConnConfig, am *allocation.Manager) {
-			s.readLoop(cfg.PacketConn, am)
+		var readers sync.WaitGroup
+		for i := 0; i < s.packetConnReaders; i++ {
+			readers.Add(1)
+			go func(cfg PacketConnConfig, am *allocation.Manager, reader int) {
+				defer readers.Done()
+				if len(cfg.CPUs) > 0 {
+					s.pinReader(cfg.PacketConn, cfg.CPUs[reader%len(cfg.CPUs)])
+				}
+				s.readLoop(cfg.PacketConn, am, cfg.Guest.toInternal(), s.realm, false)
+			}(cfg, am, i)
+		}
 
+		go func(am *allocation.Manager) {
+			readers.Wait()
 			if err := am.Close(); err != nil {
-				s.log.Errorf("Failed to close AllocationManager: %s", err)
+				fastlog.Errorw(s.log, "Failed to close AllocationManager", "err", err)
 			}
-		}(cfg, am)
+		}(am)
 	}
 
 	for _, cfg := range s.listenerConfigs {
-		am, err := s.createAllocationManager(cfg.RelayAddressGenerator, cfg.PermissionHandler)
+		am, err := s.createAllocationManager(cfg.RelayAddressGenerator, cfg.PermissionHandler, cfg.Guest)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create AllocationManager: %w", err)
 		}
 
 		go func(cfg ListenerConfig, am *allocation.Manager) {
-			s.readListener(cfg.Listener, am)
+			s.readListener(cfg, am)
 
 			if err := am.Close(); err != nil {
-				s.log.Errorf("Failed to close AllocationManager: %s", err)
+				fastlog.Errorw(s.log, "Failed to close AllocationManager", "err", err)
 			}
 		}(cfg, am)
 	}
 
+	if s.socketBuffers.MaxReadBuffer > 0 {
+		s.socketTuner = newSocketTuner(s.sockets, s.socketBuffers, s.log)
+	}
+
+	s.profiler.allocationCount = s.AllocationCount
+	s.profiler.setLabels(config.ProfilerLabels)
+	s.profiler.endpoints.Store(config.ProfilingEndpoints)
+
+	s.publishExpvar(config.ExpvarPrefix)
+
 	return s, nil
 }
 
@@ -117,6 +321,64 @@ func (s *Server) AllocationCount() int {
 	return allocs
 }
 
+// RelayQueueDropped returns the number of packets discarded because the relay queue
+// of their allocation was full, see ServerConfig.RelayQueueSize
+func (s *Server) RelayQueueDropped() uint64 {
+	var dropped uint64
+	for _, am := range s.allocationManagers {
+		dropped += am.RelayQueueDropped()
+	}
+	return dropped
+}
+
+// ChallengesDropped returns the number of unauthenticated requests that were dropped
+// instead of challenged, see ServerConfig.ChallengeRateLimit
+func (s *Server) ChallengesDropped() uint64 {
+	if s.challengeLimiter == nil {
+		return 0
+	}
+	return s.challengeLimiter.Dropped()
+}
+
+// RequestsDropped returns the number of STUN requests that were dropped because the
+// queue of the request workers was full, see ServerConfig.RequestQueueSize
+func (s *Server) RequestsDropped() uint64 {
+	if s.requestPool == nil {
+		return 0
+	}
+	return s.requestPool.dropped.Load()
+}
+
+// SocketStats returns the kernel buffers and drops of the UDP sockets of PacketConnConfigs,
+// see ServerConfig.SocketBuffers. Only supported on Linux, other conns are skipped.
+func (s *Server) SocketStats() []SocketStats {
+	var stats []SocketStats
+	for _, conn := range s.sockets {
+		if st, err := socketStats(conn); err == nil {
+			stats = append(stats, st)
+		}
+	}
+	return stats
+}
+
+// StreamWritesDropped returns the number of packets to TCP, TLS and DTLS clients that were
+// dropped because the write queue of their connection was full, see
+// ServerConfig.StreamWriteQueueSize
+func (s *Server) StreamWritesDropped() uint64 {
+	return s.streamWritesDropped.Load()
+}
+
+// RevokeSessionKeys drops the keys cached for the allocations of the user, so their next
+// requests are authenticated by the AuthHandlers again, and returns the number of
+// allocations that had one. See ServerConfig.CacheSessionKeys.
+func (s *Server) RevokeSessionKeys(username string) int {
+	revoked := 0
+	for _, am := range s.allocationManagers {
+		revoked += am.RevokeSessionKeys(username)
+	}
+	return revoked
+}
+
 // Close stops the TURN Server. It cleans up any associated state and closes all connections it is managing
 func (s *Server) Close() error {
 	var errors []error
@@ -133,6 +395,32 @@ func (s *Server) Close() error {
 		}
 	}
 
+	if s.fairQueue != nil {
+		s.fairQueue.Close()
+	}
+
+	if s.socketTuner != nil {
+		s.socketTuner.Close()
+	}
+
+	if s.timerWheel != nil {
+		s.timerWheel.Close()
+	}
+
+	if s.requestPool != nil {
+		s.requestPool.Close()
+	}
+
+	s.profiler.close()
+
+	// Relay sockets still open fail, which deletes their allocations
+	if err := s.closeIOEngines(); err != nil {
+		errors = append(errors, err)
+	}
+
+	s.events.close()
+	s.unpublishExpvar()
+
 	if len(errors) == 0 {
 		return nil
 	}
@@ -145,16 +433,59 @@ func (s *Server) Close() error {
 	return err
 }
 
-func (s *Server) readListener(l net.Listener, am *allocation.Manager) {
+func (s *Server) closeIOEngines() error {
+	var errs []error
+	if s.ioEngine != nil {
+		errs = append(errs, s.ioEngine.Close())
+	}
+	if s.relayEngine != nil && s.relayEngine != s.ioEngine {
+		errs = append(errs, s.relayEngine.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// pinReader locks the calling reader to its OS thread and the thread to cpu. The
+// thread is not unlocked, so it exits with the reader instead of running other
+// goroutines on cpu.
+func (s *Server) pinReader(conn net.PacketConn, cpu int) {
+	runtime.LockOSThread()
+	if err := setThreadAffinity(cpu); err != nil {
+		runtime.UnlockOSThread()
+		fastlog.Warnw(s.log, "Failed to pin a reader to its CPU", "listener", conn.LocalAddr(), "cpu", cpu, "err", err)
+	}
+}
+
+func (s *Server) readListener(cfg ListenerConfig, am *allocation.Manager) {
+	guest := cfg.Guest.toInternal()
 	for {
-		conn, err := l.Accept()
+		conn, err := cfg.Listener.Accept()
 		if err != nil {
-			s.log.Debugf("Failed to accept: %s", err)
+			fastlog.Debugw(s.log, "Failed to accept", "listener", cfg.Listener.Addr(), "err", err)
+			s.publishListenerError(cfg.Listener.Addr(), err)
 			return
 		}
 
 		go func() {
-			s.readLoop(NewSTUNConn(conn), am)
+			realm, strictRealm := s.realm, false
+			if cfg.RealmForServerName != nil {
+				serverName, err := connServerName(conn)
+				if err != nil {
+					fastlog.Debugw(s.log, "Failed TLS handshake", "src", conn.RemoteAddr(), "err", err)
+					_ = conn.Close()
+					return
+				}
+				if selected := cfg.RealmForServerName(serverName); selected != "" {
+					realm, strictRealm = selected, true
+				}
+			}
+
+			var packetConn net.PacketConn = NewSTUNConn(conn)
+			if s.streamWriteQueueSize > 0 {
+				writer := newStreamWriter(packetConn, s.streamWriteQueueSize, s.bufferPool, &s.streamWritesDropped, s.log)
+				defer writer.Close() //nolint:errcheck
+				packetConn = writer
+			}
+			s.readLoop(packetConn, am, guest, realm, strictRealm)
 
 			// Delete allocation
 			am.DeleteAllocation(&allocation.FiveTuple{
@@ -164,7 +495,7 @@ func (s *Server) readListener(l net.Listener, am *allocation.Manager) {
 			})
 
 			if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-				s.log.Errorf("Failed to close conn: %s", err)
+				fastlog.Errorw(s.log, "Failed to close conn", "src", conn.RemoteAddr(), "err", err)
 			}
 		}()
 	}
@@ -182,55 +513,197 @@ func (n *nilAddressGenerator) AllocateConn(string, int) (net.Conn, net.Addr, err
 	return nil, nil, errRelayAddressGeneratorNil
 }
 
-func (s *Server) createAllocationManager(addrGenerator RelayAddressGenerator, handler PermissionHandler) (*allocation.Manager, error) {
-	if handler == nil {
+func (s *Server) createAllocationManager(addrGenerator RelayAddressGenerator, handler PermissionHandler, guest *GuestConfig) (*allocation.Manager, error) {
+	switch {
+	case handler != nil:
+	case guest != nil:
+		handler = GuestPermissionHandler
+	default:
 		handler = DefaultPermissionHandler
 	}
 	if addrGenerator == nil {
 		addrGenerator = &nilAddressGenerator{}
 	}
 
+	var evictionHandler func(clientAddr, relayAddr, peer net.Addr, number proto.ChannelNumber)
+	if s.evictionHandler != nil {
+		evictionHandler = func(clientAddr, relayAddr, peer net.Addr, number proto.ChannelNumber) {
+			s.evictionHandler(clientAddr, relayAddr, peer, uint16(number))
+		}
+	}
+
+	// Subscribers come and go while the server runs, so the events are always hooked
+	onCreated := func(a *allocation.Allocation) {
+		if s.onAllocationCreated != nil {
+			s.onAllocationCreated(ServerAllocation{a})
+		}
+		s.events.publish(Event{Type: EventAllocationCreated, Allocation: ServerAllocation{a}})
+	}
+	onDeleted := func(a *allocation.Allocation) {
+		if s.onAllocationDeleted != nil {
+			s.onAllocationDeleted(ServerAllocation{a})
+		}
+		s.events.publish(Event{Type: EventAllocationDeleted, Allocation: ServerAllocation{a}})
+	}
+	onPermissionAdded := func(a *allocation.Allocation, peer net.Addr) {
+		if !s.events.enabled() {
+			return
+		}
+		peerIP, _, _ := ipnet.AddrIPPort(peer)
+		s.events.publish(Event{Type: EventPermissionAdded, Allocation: ServerAllocation{a}, PeerIP: peerIP})
+	}
+
+	allocatePacketConn := addrGenerator.AllocatePacketConn
+	if s.ioEngine != nil || s.relayEngine != nil || s.socketBuffers.ReadBuffer > 0 || s.socketBuffers.WriteBuffer > 0 {
+		allocatePacketConn = func(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+			conn, addr, err := addrGenerator.AllocatePacketConn(network, requestedPort)
+			if err != nil {
+				return nil, nil, err
+			}
+			// A relay socket with the buffers of the system still relays
+			if err := setSocketBuffers(conn, s.socketBuffers); err != nil {
+				fastlog.Warnw(s.log, "Failed to size the buffers of relay socket", "allocation", addr, "err", err)
+			}
+			if s.relayEngine != nil {
+				conn = s.relayEngine.wrap(conn)
+			} else if s.ioEngine != nil {
+				conn = s.ioEngine.wrap(conn)
+			}
+			return conn, addr, nil
+		}
+	}
+
 	am, err := allocation.NewManager(allocation.ManagerConfig{
-		AllocatePacketConn: addrGenerator.AllocatePacketConn,
+		AllocatePacketConn: allocatePacketConn,
 		AllocateConn:       addrGenerator.AllocateConn,
 		PermissionHandler:  handler,
 		LeveledLogger:      s.log,
+
+		ConnectRelaySockets:  s.connectRelaySockets,
+		UDPOffload:           s.udpOffload,
+		SharedRelayReaders:   s.relayEngine != nil,
+		DataIndicationBatch:  s.dataIndicationBatch,
+		RelayQueueSize:       s.relayQueueSize,
+		RelayQueueDropPolicy: allocation.DropPolicy(s.relayQueueDropPolicy),
+		FairQueue:            s.fairQueue,
+		BufferPool:           s.bufferPool,
+
+		MaxPermissions:     s.maxPermissions,
+		MaxChannelBindings: s.maxChannelBindings,
+		EvictionHandler:    evictionHandler,
+		ChannelOffloader:   s.channelOffloader,
+
+		EgressLimiter: s.egressLimiter,
+		Admission:     s.admission,
+		MemoryBudget:  s.memoryBudget,
+		TimerWheel:    s.timerWheel,
+
+		ProfilerLabels: s.profilerLabels,
+
+		OnAllocationCreated: onCreated,
+		OnAllocationDeleted: onDeleted,
+		OnPermissionAdded:   onPermissionAdded,
 	})
 	if err != nil {
 		return am, err
 	}
 
 	s.allocationManagers = append(s.allocationManagers, am)
+	if guest != nil {
+		s.guestAllocationManagers = append(s.guestAllocationManagers, am)
+	}
 
 	return am, err
 }
 
-func (s *Server) readLoop(p net.PacketConn, allocationManager *allocation.Manager) {
-	buf := make([]byte, s.inboundMTU)
-	for {
-		n, addr, err := p.ReadFrom(buf)
-		switch {
-		case err != nil:
-			s.log.Debugf("Exit read loop on error: %s", err)
-			return
-		case n >= s.inboundMTU:
-			s.log.Debugf("Read bytes exceeded MTU, packet is possibly truncated")
-			continue
+func (s *Server) readLoop(p net.PacketConn, allocationManager *allocation.Manager, guest *server.Guest, realm string, strictRealm bool) {
+	allocationPolicy := s.allocationPolicy.toInternal()
+
+	var policyAuthHandler func(username, realm string, srcAddr net.Addr) ([]byte, *allocation.Policy, bool)
+	if s.policyAuthHandler != nil {
+		policyAuthHandler = func(username, realm string, srcAddr net.Addr) ([]byte, *allocation.Policy, bool) {
+			key, policy, ok := s.policyAuthHandler(username, realm, srcAddr)
+			if policy == nil {
+				return key, nil, ok
+			}
+			internalPolicy := policy.toInternal()
+			return key, &internalPolicy, ok
 		}
+	}
 
-		if err := server.HandleRequest(server.Request{
-			Conn:               p,
-			SrcAddr:            addr,
-			Buff:               buf[:n],
+	requestAuthHandler := internalRequestAuthHandler(s.requestAuth)
+	authorizeAllocation := internalAllocationAuthorizer(s.authorizeAllocation)
+
+	var responded func(method stun.Method, code stun.ErrorCode)
+	if s.onRequestHandled != nil {
+		responded = func(method stun.Method, code stun.ErrorCode) {
+			s.onRequestHandled(method.String(), int(code))
+		}
+	}
+
+	request := server.Request{
+		Conn: p,
+		Config: &server.Config{
 			Log:                s.log,
 			RelayConnHandler:   s.relayConnHandler,
 			AuthHandler:        s.authHandler,
-			Realm:              s.realm,
+			PolicyAuthHandler:  policyAuthHandler,
+			AllocationPolicy:   allocationPolicy,
+			Realm:              realm,
 			AllocationManager:  allocationManager,
 			ChannelBindTimeout: s.channelBindTimeout,
 			NonceHash:          s.nonceHash,
-		}); err != nil {
-			s.log.Errorf("Failed to handle datagram: %v", err)
+
+			MultiKeyAuthHandler: s.multiKeyAuth,
+			Lockout:             s.lockout,
+			ChallengeLimiter:    s.challengeLimiter,
+			RequestAuthHandler:  requestAuthHandler,
+			Guest:               guest,
+
+			CredentialExpiry:       s.credentialExpiry,
+			StopAtCredentialExpiry: s.stopAtCredentialExpiry,
+			AuthorizeAllocation:    authorizeAllocation,
+
+			SHA256AuthHandler:  s.sha256AuthHandler,
+			PasswordAlgorithms: s.passwordAlgorithms,
+
+			Audit:       s.audit,
+			StrictRealm: strictRealm,
+
+			IntegrityCalculator: s.integrityCalculator,
+			SessionKeys:         s.cacheSessionKeys,
+			Responded:           responded,
+			Trace:               internalRequestTracer(s.requestTracer),
+		},
+	}
+	labeler := &goroutineLabeler{profiler: &s.profiler, listener: p.LocalAddr().String(), realm: realm}
+	handle := func(buf []byte, n int, addr net.Addr) {
+		labeler.update()
+		if n >= s.inboundMTU {
+			fastlog.Debugw(s.log, "Read bytes exceeded MTU, packet is possibly truncated", "src", addr, "bytes", n)
+			return
+		}
+		request.SrcAddr, request.Buff = addr, buf[:n]
+		if s.requestPool != nil && !isRelayed(request.Buff) {
+			s.requestPool.submit(request)
+			return
+		}
+		if err := server.HandleRequest(request); err != nil {
+			fastlog.Errorw(s.log, "Failed to handle datagram", "src", addr, "err", err)
+		}
+	}
+
+	if s.readBatches(p, handle) {
+		return
+	}
+	buf := make([]byte, s.inboundMTU)
+	for {
+		n, addr, err := p.ReadFrom(buf)
+		if err != nil {
+			fastlog.Debugw(s.log, "Exit read loop on error", "listener", p.LocalAddr(), "err", err)
+			s.publishListenerError(p.LocalAddr(), err)
+			return
 		}
+		handle(buf, n, addr)
 	}
 }
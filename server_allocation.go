@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/turn/v4/internal/allocation"
+)
+
+// ServerAllocation is an allocation of a Server, see ServerConfig.OnAllocationCreated.
+// Values for the same allocation are equal, so they can be used as map keys.
+type ServerAllocation struct {
+	allocation *allocation.Allocation
+}
+
+// AllocationTraffic is the payload an allocation relayed, excluding TURN framing
+type AllocationTraffic struct {
+	BytesToPeer     uint64
+	BytesFromPeer   uint64
+	PacketsToPeer   uint64
+	PacketsFromPeer uint64
+}
+
+// ClientAddr returns the address of the client
+func (a ServerAllocation) ClientAddr() net.Addr {
+	return a.allocation.FiveTuple().SrcAddr
+}
+
+// ServerAddr returns the address of the server the client talks to
+func (a ServerAllocation) ServerAddr() net.Addr {
+	return a.allocation.FiveTuple().DstAddr
+}
+
+// RelayAddr returns the relayed transport address
+func (a ServerAllocation) RelayAddr() net.Addr {
+	return a.allocation.RelayAddr
+}
+
+// Username returns the username the allocation was created with
+func (a ServerAllocation) Username() string {
+	return a.allocation.Username()
+}
+
+// Guest reports whether the allocation was granted without credentials, see GuestConfig
+func (a ServerAllocation) Guest() bool {
+	return a.allocation.Guest()
+}
+
+// CreatedAt returns when the allocation was created
+func (a ServerAllocation) CreatedAt() time.Time {
+	return a.allocation.CreatedAt()
+}
+
+// CredentialExpiry returns when the credentials the allocation was last refreshed with
+// expire, the zero time if unknown, see ServerConfig.CredentialExpiry
+func (a ServerAllocation) CredentialExpiry() time.Time {
+	return a.allocation.CredentialExpiry()
+}
+
+// SocketStats returns the kernel buffers and drops of the relay socket, see
+// ServerConfig.SocketBuffers. Only supported on Linux for UDP relay sockets that are
+// not read by an IOEngine.
+func (a ServerAllocation) SocketStats() (SocketStats, error) {
+	return socketStats(a.allocation.RelaySocket)
+}
+
+// BufferedBytes returns the payload waiting in the relay queue, see ServerConfig.MemoryBudget
+func (a ServerAllocation) BufferedBytes() int64 {
+	return a.allocation.RelayQueueBytes()
+}
+
+// RevokeSessionKey drops the key cached for the allocation, so its next request is
+// authenticated by the AuthHandlers again, see ServerConfig.CacheSessionKeys
+func (a ServerAllocation) RevokeSessionKey() {
+	a.allocation.RevokeSessionKey()
+}
+
+// Traffic returns the payload relayed so far. Packets dropped by bandwidth
+// limits are not counted.
+func (a ServerAllocation) Traffic() AllocationTraffic {
+	t := a.allocation.Traffic()
+	return AllocationTraffic{
+		BytesToPeer:     t.BytesToPeer,
+		BytesFromPeer:   t.BytesFromPeer,
+		PacketsToPeer:   t.PacketsToPeer,
+		PacketsFromPeer: t.PacketsFromPeer,
+	}
+}
+
+// PermissionCount returns the number of peers the client installed a permission for
+func (a ServerAllocation) PermissionCount() int {
+	return a.allocation.PermissionCount()
+}
+
+// ChannelBindingCount returns the number of channels the client bound to peers
+func (a ServerAllocation) ChannelBindingCount() int {
+	return a.allocation.ChannelBindCount()
+}
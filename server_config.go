@@ -11,6 +11,9 @@ import (
 	"time"
 
 	"github.com/pion/logging"
+
+	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/server"
 )
 
 // RelayAddressGenerator is used to generate a RelayAddress when creating an allocation.
@@ -49,8 +52,18 @@ type PacketConnConfig struct {
 
 	// PermissionHandler is a callback to filter peer addresses. Can be set as nil, in which
 	// case the DefaultPermissionHandler is automatically instantiated to admit all peer
-	// connections
+	// connections, or the GuestPermissionHandler for guest listeners
 	PermissionHandler PermissionHandler
+
+	// Guest grants allocations without credentials on this listener when set
+	Guest *GuestConfig
+
+	// CPUs pins the readers of PacketConn, see ServerConfig.PacketConnReaders, to their own
+	// OS threads running on these CPUs, reader i on CPUs[i % len(CPUs)]. Aligning them with
+	// the CPUs the NIC steers the queue of the socket to, e.g. with SO_REUSEPORT sockets per
+	// RSS queue, keeps the datagrams in the caches of one NUMA node. Only supported on Linux;
+	// the readers are not pinned elsewhere. Optional.
+	CPUs []int
 }
 
 func (c *PacketConnConfig) validate() error {
@@ -58,12 +71,22 @@ func (c *PacketConnConfig) validate() error {
 		return errConnUnset
 	}
 
+	for _, cpu := range c.CPUs {
+		if cpu < 0 {
+			return errInvalidCPU
+		}
+	}
+
 	if c.RelayAddressGenerator != nil {
 		if err := c.RelayAddressGenerator.Validate(); err != nil {
 			return err
 		}
 	}
 
+	if c.Guest != nil {
+		return c.Guest.validate()
+	}
+
 	return nil
 }
 
@@ -77,8 +100,19 @@ type ListenerConfig struct {
 
 	// PermissionHandler is a callback to filter peer addresses. Can be set as nil, in which
 	// case the DefaultPermissionHandler is automatically instantiated to admit all peer
-	// connections
+	// connections, or the GuestPermissionHandler for guest listeners
 	PermissionHandler PermissionHandler
+
+	// Guest grants allocations without credentials on this listener when set
+	Guest *GuestConfig
+
+	// RealmForServerName selects the realm of a connection, and so the credentials valid on
+	// it, by the TLS server name (SNI) the client presented, e.g. to host TURN for several
+	// customer domains on one IP. An empty realm selects ServerConfig.Realm, while requests
+	// for other realms than a selected one are challenged again. Supported for crypto/tls
+	// connections and connections with a ServerName() string method, e.g. a wrapped DTLS
+	// connection. Optional.
+	RealmForServerName func(serverName string) (realm string)
 }
 
 func (c *ListenerConfig) validate() error {
@@ -90,12 +124,62 @@ func (c *ListenerConfig) validate() error {
 		return errRelayAddressGeneratorUnset
 	}
 
+	if c.Guest != nil {
+		if err := c.Guest.validate(); err != nil {
+			return err
+		}
+	}
+
 	return c.RelayAddressGenerator.Validate()
 }
 
 // AuthHandler is a callback used to handle incoming auth requests, allowing users to customize Pion TURN with custom behavior
 type AuthHandler func(username, realm string, srcAddr net.Addr) (key []byte, ok bool)
 
+// AllocationPolicy constrains how an allocation relays traffic
+type AllocationPolicy struct {
+	// PeerBandwidth limits the bits per second relayed to, and separately from, any single
+	// peer IP address of the allocation, so one peer cannot monopolize a shared relay.
+	// Packets above the limit are dropped. Zero means unlimited.
+	PeerBandwidth int64
+
+	// Bandwidth limits the bits per second relayed by the allocation in both directions
+	// combined. Packets above the limit are dropped. Zero means unlimited.
+	Bandwidth int64
+
+	// Priority is the class the allocation is admitted with, see ServerConfig.MaxAllocations,
+	// and scheduled with, see ServerConfig.FairQueueing. Defaults to PriorityStandard.
+	Priority PriorityClass
+}
+
+func (p AllocationPolicy) toInternal() allocation.Policy {
+	return allocation.Policy{
+		PeerBandwidth: p.PeerBandwidth,
+		Bandwidth:     p.Bandwidth,
+		Priority:      int(p.Priority),
+	}
+}
+
+// PriorityClass is the quality of service class of an allocation
+type PriorityClass int
+
+const (
+	// PriorityStandard is the class of allocations without a specific priority
+	PriorityStandard PriorityClass = allocation.PriorityStandard
+	// PriorityPremium allocations may use the capacity reserved by
+	// ServerConfig.ReservedAllocations and get four times the egress share of standard
+	// allocations when fair queueing is enabled
+	PriorityPremium PriorityClass = allocation.PriorityPremium
+)
+
+// PolicyAuthHandler is an AuthHandler that also returns the AllocationPolicy for allocations
+// created with the credentials. A nil policy selects ServerConfig.AllocationPolicy.
+type PolicyAuthHandler func(username, realm string, srcAddr net.Addr) (key []byte, policy *AllocationPolicy, ok bool)
+
+// MultiKeyAuthHandler is an AuthHandler that may return several keys for the credentials, e.g.
+// one per shared secret while secrets are rotated. A request is authentic if any of them signed it.
+type MultiKeyAuthHandler func(username, realm string, srcAddr net.Addr) (keys [][]byte, ok bool)
+
 type RelayConnHandler func(username, realm string, relaySocket net.PacketConn) (net.PacketConn, error)
 
 // GenerateAuthKey is a convenience function to easily generate keys in the format used by AuthHandler
@@ -106,6 +190,137 @@ func GenerateAuthKey(username, realm, password string) []byte {
 	return h.Sum(nil)
 }
 
+// EvictionHandler is called when a permission or channel binding is evicted before its natural
+// expiry to make room for a new one, see ServerConfig.MaxPermissionsPerAllocation. channelNumber
+// is zero for permissions.
+type EvictionHandler func(clientAddr, relayAddr, peerAddr net.Addr, channelNumber uint16)
+
+// LockoutConfig configures the brute-force protection of a Server, see ServerConfig.Lockout
+type LockoutConfig struct {
+	// Threshold is the number of failed authentications of a username, or from a source IP,
+	// within Window after which further attempts are refused. Defaults to 0, which disables
+	// the lockout.
+	Threshold int
+
+	// Window is the period failures are counted in. Defaults to a minute.
+	Window time.Duration
+
+	// Duration is how long the first lockout of a username or IP lasts, every further lockout
+	// doubles it up to MaxDuration. Default to a minute and an hour.
+	Duration    time.Duration
+	MaxDuration time.Duration
+
+	// Reject answers refused attempts with 403 (Forbidden) instead of silently dropping them
+	Reject bool
+
+	// Handler is called for every lockout, e.g. for security monitoring. Optional.
+	Handler LockoutHandler
+}
+
+func (c LockoutConfig) toInternal() server.LockoutConfig {
+	internal := server.LockoutConfig{
+		Threshold:   c.Threshold,
+		Window:      c.Window,
+		Duration:    c.Duration,
+		MaxDuration: c.MaxDuration,
+		Reject:      c.Reject,
+	}
+	if internal.Window == 0 {
+		internal.Window = time.Minute
+	}
+	if internal.Duration == 0 {
+		internal.Duration = time.Minute
+	}
+	if internal.MaxDuration == 0 {
+		internal.MaxDuration = time.Hour
+	}
+	if internal.MaxDuration < internal.Duration {
+		internal.MaxDuration = internal.Duration
+	}
+	if c.Handler != nil {
+		internal.OnLockout = func(username string, ip net.IP, failures int, duration time.Duration) {
+			c.Handler(LockoutEvent{Username: username, IP: ip, Failures: failures, Duration: duration})
+		}
+	}
+	return internal
+}
+
+// LockoutEvent describes a username or source IP that is locked out
+type LockoutEvent struct {
+	// Username is set when a username is locked out, IP when a source IP is
+	Username string
+	IP       net.IP
+
+	// Failures is the number of failed authentications that caused the lockout
+	Failures int
+	Duration time.Duration
+}
+
+// LockoutHandler is called for every LockoutEvent
+type LockoutHandler func(event LockoutEvent)
+
+// CredentialExpiryHandler returns when the credentials of a username expire, ok is false if
+// they do not tell
+type CredentialExpiryHandler func(username string) (expiry time.Time, ok bool)
+
+// RelayQueueDropPolicy selects which packet is discarded when the relay queue of an allocation is full
+type RelayQueueDropPolicy int
+
+const (
+	// RelayQueueDropTail discards the packet that is being enqueued
+	RelayQueueDropTail RelayQueueDropPolicy = iota
+	// RelayQueueDropHead discards the oldest queued packet to make room for the new one
+	RelayQueueDropHead
+)
+
+// IOEngine selects how a server reads and writes its UDP sockets, see ServerConfig.IOEngine
+type IOEngine int
+
+const (
+	// IOEngineStandard reads and writes with the Go runtime
+	IOEngineStandard IOEngine = iota
+	// IOEngineIOURing reads and writes through an io_uring(7) shared by all sockets of the
+	// server. Receives are kept in flight and refilled a batch at a time, so the datagrams of
+	// many busy sockets complete per system call. Experimental; requires Linux 5.5 or later
+	// with io_uring enabled, but no privileges.
+	IOEngineIOURing
+	// IOEngineEpoll reads the sockets of the server from an event loop per CPU, see
+	// runtime.GOMAXPROCS, each an epoll(7) instance waited on by a thread of its own. A loop
+	// drains every ready socket before it waits again, instead of a goroutine blocking in
+	// the read of each socket, and writes go out right away. Experimental; Linux only.
+	IOEngineEpoll
+)
+
+// SocketBufferConfig sizes the kernel buffers of the UDP sockets of a server, see
+// ServerConfig.SocketBuffers. Datagrams that arrive while the read buffer of a socket is
+// full are dropped by the kernel, see Server.SocketStats.
+type SocketBufferConfig struct {
+	// ReadBuffer and WriteBuffer are the SO_RCVBUF and SO_SNDBUF of the PacketConns of
+	// PacketConnConfigs and of the UDP relay sockets, in bytes. Linux caps them at the
+	// net.core.rmem_max and wmem_max sysctls unless the server has CAP_NET_ADMIN. Default
+	// to 0, which keeps the size of the system.
+	ReadBuffer  int
+	WriteBuffer int
+
+	// MaxReadBuffer grows the read buffer of PacketConns that drop datagrams, doubling it
+	// every AutotuneInterval the kernel reports drops until MaxReadBuffer. Relay sockets are
+	// not tuned. Only supported on Linux. Defaults to 0, which disables the autotuning.
+	MaxReadBuffer int
+
+	// AutotuneInterval is how often the drops are checked. Defaults to 10 seconds.
+	AutotuneInterval time.Duration
+}
+
+func (c *SocketBufferConfig) validate() error {
+	if c.ReadBuffer < 0 || c.WriteBuffer < 0 || c.MaxReadBuffer < 0 || c.AutotuneInterval < 0 {
+		return errInvalidSocketBufferConfig
+	}
+	if c.MaxReadBuffer != 0 && c.MaxReadBuffer < c.ReadBuffer {
+		return errInvalidSocketBufferConfig
+	}
+	return nil
+}
+
 // ServerConfig configures the Pion TURN Server
 type ServerConfig struct {
 	// PacketConnConfigs and ListenerConfigs are a list of all the turn listeners
@@ -113,22 +328,309 @@ type ServerConfig struct {
 	PacketConnConfigs []PacketConnConfig
 	ListenerConfigs   []ListenerConfig
 
-	// LoggerFactory must be set for logging from this server.
+	// LoggerFactory must be set for logging from this server. The server knows the levels
+	// a logging.DefaultLoggerFactory logs, and skips formatting the lines of the others.
 	LoggerFactory logging.LoggerFactory
 
+	// LogRateLimit caps the lines the server logs per second and level, zero means
+	// unlimited. At debug and trace level every packet is logged, a limit keeps floods of
+	// packets from spending the CPU on logging. Dropped lines are counted in a warning.
+	LogRateLimit int
+
 	// Realm sets the realm for this server
 	Realm string
 
 	RelayConnHandler RelayConnHandler
 
+	// The credentials of a request are verified with the first that applies of
+	//
+	//   - the key cached for its allocation, see CacheSessionKeys
+	//   - the IntegrityCalculator, which must not be set with any auth handler
+	//   - the SHA256AuthHandler, for the SHA-256 password algorithm. Requests of another
+	//     algorithm than MD5 are refused otherwise.
+	//   - the one of AuthHandler, PolicyAuthHandler, MultiKeyAuthHandler and
+	//     RequestAuthHandler that is set, for the MD5 password algorithm. NewServer refuses
+	//     more than one of them.
+	//
+	// Without any of them the server only answers STUN Binding requests.
+
 	// AuthHandler is a callback used to handle incoming auth requests, allowing users to customize Pion TURN with custom behavior
 	AuthHandler AuthHandler
 
+	// PolicyAuthHandler is an AuthHandler returning a per user AllocationPolicy together
+	// with the key.
+	PolicyAuthHandler PolicyAuthHandler
+
+	// RequestAuthHandler is an AuthHandler authenticating requests with their full context.
+	RequestAuthHandler RequestAuthHandler
+
+	// MultiKeyAuthHandler is an AuthHandler returning every key the credentials may have
+	// been generated with.
+	MultiKeyAuthHandler MultiKeyAuthHandler
+
+	// AllocationPolicy is applied to allocations for which the PolicyAuthHandler returned no
+	// policy of its own. Defaults to no limits.
+	AllocationPolicy AllocationPolicy
+
 	// ChannelBindTimeout sets the lifetime of channel binding. Defaults to 10 minutes.
 	ChannelBindTimeout time.Duration
 
 	// Sets the server inbound MTU(Maximum transmition unit). Defaults to 1600 bytes.
 	InboundMTU int
+
+	// ReadBatchSize is the number of datagrams read per system call from the UDP sockets of
+	// PacketConnConfigs on Linux, with recvmmsg(2), which saves most system calls of busy
+	// listeners. Every listener keeps ReadBatchSize buffers of InboundMTU bytes. Defaults to
+	// 32; 1 reads a datagram at a time, like on other platforms.
+	ReadBatchSize int
+
+	// PacketConnReaders is the number of goroutines reading each of the PacketConnConfigs
+	// concurrently, because a single reader caps the throughput of a listener well below a
+	// NIC on many-core machines. Allocations are dispatched by their five-tuple, so each
+	// client keeps a single allocation whichever reader handles its requests, but requests
+	// and ChannelData of one client may be handled out of order. Defaults to 1.
+	PacketConnReaders int
+
+	// RequestWorkers handles STUN requests, which are comparatively expensive to authenticate
+	// and allocate for, on a pool of as many goroutines apart from the readers of the
+	// listeners. The readers then only relay ChannelData and Send indications, so bursts of
+	// requests do not delay media, and vice versa. Defaults to 0, which handles requests on
+	// the readers.
+	RequestWorkers int
+
+	// RequestQueueSize bounds the requests waiting for the RequestWorkers. Requests that
+	// arrive while it is full are dropped and retransmitted by clients, see
+	// Server.RequestsDropped. Defaults to 1024.
+	RequestQueueSize int
+
+	// StreamWriteQueueSize is the number of packets every connection of ListenerConfigs may
+	// queue for writing. The responses and relayed packets of a connection are then written
+	// by a goroutine of its own, so a client that reads slowly stalls neither the reading of
+	// its requests nor the relay of its allocation. Packets that arrive while the queue is
+	// full are dropped, see Server.StreamWritesDropped. Defaults to 0, which writes
+	// synchronously.
+	StreamWriteQueueSize int
+
+	// IOEngine reads and writes the UDP sockets of PacketConnConfigs and the UDP relay sockets,
+	// which are *net.UDPConns, with another I/O engine than the Go runtime. The relay sockets
+	// of IOEngineIOURing and IOEngineEpoll are neither connected nor offloaded, see
+	// ConnectRelaySockets and UDPOffload, and listeners are not read in batches. Defaults to
+	// IOEngineStandard.
+	IOEngine IOEngine
+
+	// SocketBuffers sizes the kernel buffers of the UDP sockets, which need to hold the
+	// bursts of busy listeners while their readers are descheduled. Optional.
+	SocketBuffers SocketBufferConfig
+
+	// ConnectRelaySockets connect()s the relay socket of an allocation to its peer while
+	// that peer holds the only permission of the allocation, which is the common ICE case,
+	// whether it is reached with a channel binding or Send indications. The socket is
+	// connected to the port of the channel binding of the peer, or of the first
+	// CreatePermission for it. The kernel then filters stray packets, including those from
+	// other ports of the peer, and relayed writes take the cheaper connected path. Only
+	// supported on Linux for UDP relay sockets.
+	ConnectRelaySockets bool
+
+	// UDPOffload lets the kernel segment and coalesce relayed datagrams, which saves most
+	// of the per-packet CPU of high rate media. Queued packets to the same peer are written
+	// as one datagram with UDP segmentation offload (GSO), which requires RelayQueueSize, and
+	// relay sockets are read with UDP receive offload (GRO). Only supported on Linux 5.0 and
+	// later for UDP relay sockets; ignored elsewhere.
+	UDPOffload bool
+
+	// SharedRelayReaders reads the UDP relay sockets from the event loops of IOEngineEpoll,
+	// one per CPU, which relay the datagrams of every ready socket to its client, instead
+	// of a goroutine per allocation blocking in the read of its relay socket. That saves
+	// the goroutine and its stack of every allocation, so 50k allocations take a handful
+	// of threads instead of 50k goroutines. The loops of IOEngineEpoll are shared with the
+	// listeners if it is the IOEngine, otherwise they only read relay sockets. Relay
+	// sockets with UDPOffload, or replaced by a RelayConnHandler, keep a goroutine of their
+	// own. Only supported on Linux.
+	SharedRelayReaders bool
+
+	// DataIndicationBatch is the most Data indications an allocation writes to its client
+	// at once, which saves the per-packet cost of chatty peers of clients without channel
+	// bindings. Indications are batched while more datagrams of the relay socket are ready,
+	// with IOEngineEpoll, IOEngineIOURing or UDPOffload, and never wait for a batch to fill.
+	// A batch is written to UDP clients with a single system call on Linux, to TCP and TLS
+	// clients as a single write of the consecutive messages. Relay sockets read by
+	// SharedRelayReaders are not batched. Defaults to 0, which writes them one at a time.
+	DataIndicationBatch int
+
+	// RelayQueueSize is the number of packets each allocation may buffer while they wait to
+	// be written to the peer. When set, writes to the relay socket no longer happen on the
+	// listener read loop, so a stalled relay socket only affects its own allocation. Defaults
+	// to 0, which writes synchronously.
+	RelayQueueSize int
+
+	// RelayQueueDropPolicy selects which packet is discarded when a relay queue is full.
+	// Defaults to RelayQueueDropTail.
+	RelayQueueDropPolicy RelayQueueDropPolicy
+
+	// FairQueueing drains the relay queues of all allocations with a deficit round robin
+	// scheduler instead of first come first served, so interactive low rate sessions keep a
+	// low latency while bulk sessions saturate the egress path. Requires RelayQueueSize.
+	FairQueueing bool
+
+	// MemoryBudget bounds the bytes buffered in the relay queues, per allocation and for the
+	// whole server, and sheds load beyond it, see Server.MemoryStats. Requires RelayQueueSize.
+	MemoryBudget MemoryBudgetConfig
+
+	// MaxPermissionsPerAllocation and MaxChannelBindingsPerAllocation bound the permission and
+	// channel binding tables of every allocation. Instead of rejecting a CreatePermission or
+	// ChannelBind request once a table is full, the entry that has been idle for longest is
+	// evicted to make room. Evicting a permission also removes channels bound to that peer.
+	// Defaults to 0, which means unlimited.
+	MaxPermissionsPerAllocation     int
+	MaxChannelBindingsPerAllocation int
+
+	// EvictionHandler is called for every evicted permission and channel binding. Optional.
+	EvictionHandler EvictionHandler
+
+	// ChannelOffloader relays established channel bindings outside the server, e.g. in the
+	// kernel with an XDPChannelOffloader. Optional.
+	ChannelOffloader ChannelOffloader
+
+	// EgressBandwidth caps the bits per second relayed by the whole server, in both
+	// directions and across all listeners, so a relay co-hosted with other services can be
+	// limited to a fixed slice of the NIC. Every allocation is guaranteed an equal part of the
+	// cap and may use more while the cap is not reached. Defaults to 0, which means unlimited.
+	EgressBandwidth int64
+
+	// MaxAllocations limits the number of allocations of the server. Further Allocate requests
+	// are rejected with 508 (Insufficient Capacity). Defaults to 0, which means unlimited.
+	MaxAllocations int
+
+	// ReservedAllocations is the part of MaxAllocations that is only granted to allocations
+	// above PriorityStandard, so prioritized users can still allocate when the server is full.
+	ReservedAllocations int
+
+	// TimerResolution fires the lifetime timers of all allocations, permissions and channel
+	// bindings together in ticks of this resolution from a single goroutine, instead of a
+	// runtime timer each, which saves the timer churn and wakeups of many allocations.
+	// Lifetimes then end up to a tick late; a second is fine for lifetimes of minutes.
+	// Defaults to 0, which uses a runtime timer per lifetime.
+	TimerResolution time.Duration
+
+	// ProfilerLabels labels the goroutines relaying for every allocation with the pprof labels
+	// "username" and "realm", so goroutine and CPU profiles of servers with many allocations
+	// can be broken down by user. Note that the usernames then end up in the profiles. The
+	// readers of PacketConnConfigs and of the connections of ListenerConfigs are labeled with
+	// "listener", its local address, "realm" and "allocations", the number of allocations of
+	// the server rounded down to a power of ten such as "100-999", so hotspots can be told
+	// apart by listener and load. It can be changed while the server runs with
+	// Server.SetProfilerLabels.
+	ProfilerLabels bool
+
+	// ProfilingEndpoints serves the CPU, heap and other profiles of the process from
+	// Server.ProfilingHandler, which can be mounted on an operator-only address up front and
+	// turned on when needed with Server.SetProfilingEndpoints.
+	ProfilingEndpoints bool
+
+	// ExpvarPrefix publishes the counters of the server with expvar under this name, so
+	// /debug/vars and other debug tooling reading expvar pick them up: allocations, relay
+	// ports in use, packets and bytes relayed, goroutines relaying for allocations, and the
+	// depth and drops of the relay, request and stream write queues. The prefix can only be
+	// used by one server at a time; it reads null once the server is closed. Optional.
+	ExpvarPrefix string
+
+	// Lockout refuses the authentication attempts of usernames and source IPs that failed
+	// to authenticate too often. Note that anyone can lock a username out this way.
+	Lockout LockoutConfig
+
+	// ChallengeRateLimit limits the 401 (Unauthorized) and 438 (Stale Nonce) challenges sent
+	// to every /24 IPv4 or /56 IPv6 network per second, allowing bursts of twice as many.
+	// Further unauthenticated requests are dropped, see Server.ChallengesDropped. Defaults to
+	// 0, which means unlimited.
+	ChallengeRateLimit int
+
+	// BindNoncesToClientAddr makes nonces only valid from the client address and port they
+	// were sent to, so a nonce captured from one client can not be replayed from another
+	// address. Clients behind NATs that keep changing their mapping then get 438 (Stale
+	// Nonce) for every new mapping, which breaks clients that give up after a few retries.
+	BindNoncesToClientAddr bool
+
+	// NonceMaxUses limits the requests every nonce may authenticate, closing the window in
+	// which a captured request can be replayed. Further requests get 438 (Stale Nonce) and
+	// are retried by clients with a new nonce. Only requests passing the integrity check count.
+	// The server remembers the uses of up to 65536 nonces for their lifetime of an hour.
+	// Defaults to 0, which means unlimited.
+	NonceMaxUses int
+
+	// NonceKey signs the nonces, at least 32 random bytes. Servers with the same key accept
+	// each other's nonces, e.g. of the process before a restart, so clients are not challenged
+	// again. Defaults to a random key.
+	NonceKey []byte
+
+	// CredentialExpiry tells when credentials expire, e.g. CredentialExpiryOf. Requests with
+	// expired credentials are then challenged with 401 (Unauthorized) even if the AuthHandler
+	// accepts them, so allocations can not be refreshed past the expiry. Optional.
+	CredentialExpiry CredentialExpiryHandler
+
+	// StopAtCredentialExpiry caps the lifetime of allocations at the expiry of the credentials
+	// they were last refreshed with, so they stop relaying unless the client refreshes them
+	// with newer credentials. Requires CredentialExpiry.
+	StopAtCredentialExpiry bool
+
+	// AuthorizeAllocation is called for every Allocate request once its credentials are
+	// verified, and may deny it with a specific error code. Optional.
+	AuthorizeAllocation AllocationAuthorizer
+
+	// SHA256AuthHandler returns the key of GenerateSHA256AuthKey for requests whose client
+	// derived it with the SHA-256 password algorithm of RFC 8489. AllocationPolicy applies
+	// to their allocations. Optional.
+	SHA256AuthHandler AuthHandler
+
+	// PasswordAlgorithms selects the password algorithms accepted from, and advertised to,
+	// clients. Defaults to MD5 only, without advertising it.
+	PasswordAlgorithms PasswordAlgorithmConfig
+
+	// AuditSink receives a record of every authentication, quota rejection, permission
+	// denial and admin action, e.g. a FileAuditSink or SyslogAuditSink. Unlike the log, it is
+	// meant to be kept for security reviews. Optional.
+	AuditSink AuditSink
+
+	// IntegrityCalculator verifies and signs messages with keys held outside of the process,
+	// e.g. in an HSM, in place of the AuthHandlers, which must not be set with it. Requests
+	// of either password algorithm of PasswordAlgorithms are passed to it. AllocationPolicy
+	// applies to all allocations. Optional.
+	IntegrityCalculator IntegrityCalculator
+
+	// CacheSessionKeys caches the key every allocation was last authenticated with, so its
+	// refreshes, permissions and channel bindings are verified with a single HMAC instead of
+	// asking the AuthHandlers, which then only see its Allocate request and requests with other
+	// credentials. Revoke the keys of users whose credentials are withdrawn with
+	// Server.RevokeSessionKeys. Has no effect with an IntegrityCalculator.
+	CacheSessionKeys bool
+
+	// OnAllocationCreated is called for every allocation once it relays, and
+	// OnAllocationDeleted once it has been closed, e.g. to account for its traffic. They are
+	// called on the goroutines of the server and must not block. Optional.
+	OnAllocationCreated func(a ServerAllocation)
+	OnAllocationDeleted func(a ServerAllocation)
+
+	// OnRequestHandled is called for every response the server sends to a request, with the
+	// STUN method of the request, e.g. "Allocate", and the error code of the response, zero
+	// for success responses. Challenges are answered with 401 (Unauthorized) like refused
+	// credentials, see AuditSink to tell them apart. It is called on the goroutines of the
+	// server and must not block. Optional.
+	OnRequestHandled func(method string, code int)
+
+	// RequestTracer traces the handling of every request, e.g. with OpenTelemetry, see
+	// module tracing/otel. Indications and ChannelData are not traced. Optional.
+	RequestTracer RequestTracer
+}
+
+// authHandlers returns how many of the auth handlers of the MD5 password algorithm are set
+func (s *ServerConfig) authHandlers() (n int) {
+	for _, set := range []bool{
+		s.AuthHandler != nil, s.PolicyAuthHandler != nil, s.MultiKeyAuthHandler != nil, s.RequestAuthHandler != nil,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
 }
 
 func (s *ServerConfig) validate() error {
@@ -136,6 +638,95 @@ func (s *ServerConfig) validate() error {
 		return errNoAvailableConns
 	}
 
+	if s.ReadBatchSize < 0 {
+		return errInvalidReadBatchSize
+	}
+
+	if s.PacketConnReaders < 0 {
+		return errInvalidPacketConnReaders
+	}
+
+	if s.RequestWorkers < 0 || s.RequestQueueSize < 0 {
+		return errInvalidRequestWorkers
+	}
+
+	if s.StreamWriteQueueSize < 0 {
+		return errInvalidStreamWriteQueueSize
+	}
+
+	if s.LogRateLimit < 0 {
+		return errInvalidLogRateLimit
+	}
+
+	if s.IOEngine != IOEngineStandard && s.IOEngine != IOEngineIOURing && s.IOEngine != IOEngineEpoll {
+		return errInvalidIOEngine
+	}
+
+	if err := s.SocketBuffers.validate(); err != nil {
+		return err
+	}
+
+	if s.RelayQueueSize < 0 {
+		return errInvalidRelayQueueSize
+	}
+
+	if s.FairQueueing && s.RelayQueueSize == 0 {
+		return errFairQueueingWithoutRelayQueue
+	}
+
+	if err := s.MemoryBudget.validate(s.RelayQueueSize); err != nil {
+		return err
+	}
+
+	if s.MaxPermissionsPerAllocation < 0 || s.MaxChannelBindingsPerAllocation < 0 {
+		return errInvalidTableLimit
+	}
+
+	if s.EgressBandwidth < 0 {
+		return errInvalidEgressBandwidth
+	}
+
+	if s.MaxAllocations < 0 || s.ReservedAllocations < 0 || s.ReservedAllocations > s.MaxAllocations {
+		return errInvalidAllocationLimit
+	}
+
+	if s.TimerResolution < 0 {
+		return errInvalidTimerResolution
+	}
+
+	if s.StopAtCredentialExpiry && s.CredentialExpiry == nil {
+		return errNoCredentialExpiry
+	}
+
+	if s.IntegrityCalculator != nil && (s.AuthHandler != nil || s.PolicyAuthHandler != nil || s.MultiKeyAuthHandler != nil ||
+		s.RequestAuthHandler != nil || s.SHA256AuthHandler != nil) {
+		return errIntegrityCalculatorWithAuthHandler
+	}
+
+	if s.authHandlers() > 1 {
+		return errConflictingAuthHandlers
+	}
+
+	if err := s.PasswordAlgorithms.validate(s.SHA256AuthHandler != nil || s.IntegrityCalculator != nil); err != nil {
+		return err
+	}
+
+	if s.NonceMaxUses < 0 {
+		return errInvalidNonceMaxUses
+	}
+
+	if len(s.NonceKey) != 0 && len(s.NonceKey) < minNonceKeyLength {
+		return errInvalidNonceKey
+	}
+
+	if s.ChallengeRateLimit < 0 {
+		return errInvalidChallengeRateLimit
+	}
+
+	if s.Lockout.Threshold < 0 || s.Lockout.Window < 0 || s.Lockout.Duration < 0 || s.Lockout.MaxDuration < 0 {
+		return errInvalidLockoutConfig
+	}
+
 	for _, s := range s.PacketConnConfigs {
 		if err := s.validate(); err != nil {
 			return err
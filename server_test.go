@@ -7,17 +7,23 @@
 package turn
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
 	"github.com/pion/transport/v3/test"
 	"github.com/pion/transport/v3/vnet"
 	"github.com/pion/turn/v4/internal/allocation"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/internal/server"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -616,6 +622,466 @@ func TestSTUNOnly(t *testing.T) {
 	assert.Equal(t, err.Error(), "Allocate error response (error 400: )")
 }
 
+// newTestServer returns a server on a loopback port, relaying from 127.0.0.1, that
+// accepts the password "pass" of every user in the realm "pion.ly". configure, if not
+// nil, adjusts the configuration before the server is created.
+func newTestServer(t *testing.T, configure func(*ServerConfig)) (*Server, net.Addr) {
+	t.Helper()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	config := ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	}
+	if configure != nil {
+		configure(&config)
+	}
+
+	server, err := NewServer(config)
+	if !assert.NoError(t, err) {
+		_ = serverConn.Close()
+		t.FailNow()
+	}
+	return server, serverConn.LocalAddr()
+}
+
+func TestServerConfigValidation(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config ServerConfig
+		err    error
+	}{
+		{"StopAtCredentialExpiry", ServerConfig{StopAtCredentialExpiry: true}, errNoCredentialExpiry},
+		{"NonceKey", ServerConfig{NonceKey: []byte("too short")}, errInvalidNonceKey},
+		{"MemoryBudget", ServerConfig{MemoryBudget: MemoryBudgetConfig{Total: -1}}, errInvalidMemoryBudget},
+		{
+			"MemoryBudgetWithoutRelayQueue",
+			ServerConfig{MemoryBudget: MemoryBudgetConfig{Total: 1 << 20}},
+			errMemoryBudgetWithoutRelayQueue,
+		},
+		{"TimerResolution", ServerConfig{TimerResolution: -1}, errInvalidTimerResolution},
+		{"LogRateLimit", ServerConfig{LogRateLimit: -1}, errInvalidLogRateLimit},
+		{"PacketConnReaders", ServerConfig{PacketConnReaders: -1}, errInvalidPacketConnReaders},
+		{
+			"AuthHandlers",
+			ServerConfig{
+				AuthHandler:         func(string, string, net.Addr) ([]byte, bool) { return nil, false },
+				MultiKeyAuthHandler: func(string, string, net.Addr) ([][]byte, bool) { return nil, false },
+			},
+			errConflictingAuthHandlers,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.PacketConnConfigs = []PacketConnConfig{{}}
+			_, err := NewServer(test.config)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestServerLockout(t *testing.T) {
+	var eventsLock sync.Mutex
+	var events []LockoutEvent
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.Lockout = LockoutConfig{
+			Threshold: 2,
+			Reject:    true,
+			Handler: func(event LockoutEvent) {
+				eventsLock.Lock()
+				defer eventsLock.Unlock()
+				events = append(events, event)
+			},
+		}
+	})
+
+	allocate := func(password string) error {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: serverAddr.String(),
+			TURNServerAddr: serverAddr.String(),
+			Conn:           conn,
+			Username:       "user",
+			Password:       password,
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		assert.NoError(t, err)
+		defer client.Close()
+		assert.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+		return relayConn.Close()
+	}
+
+	assert.NoError(t, allocate("pass"))
+	assert.Error(t, allocate("wrong"))
+	assert.Error(t, allocate("wrong"))
+
+	err := allocate("pass")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+
+	eventsLock.Lock()
+	assert.Equal(t, []LockoutEvent{
+		{Username: "user", Failures: 2, Duration: time.Minute},
+		{IP: net.IPv4(127, 0, 0, 1).To4(), Failures: 2, Duration: time.Minute},
+	}, events)
+	eventsLock.Unlock()
+
+	assert.NoError(t, server.Close())
+}
+
+func TestServerChallengeRateLimit(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.ChallengeRateLimit = 1
+	})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	// A burst of two challenges passes, the third request is dropped
+	for i := 0; i < 3; i++ {
+		msg, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+			proto.RequestedTransport{Protocol: proto.ProtoUDP}, stun.Fingerprint)
+		assert.NoError(t, err)
+		_, err = conn.WriteTo(msg.Raw, serverAddr)
+		assert.NoError(t, err)
+	}
+
+	responses := 0
+	buf := make([]byte, 1500)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(500*time.Millisecond)))
+	for {
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			break
+		}
+		responses++
+	}
+	assert.Equal(t, 2, responses)
+	assert.Equal(t, uint64(1), server.ChallengesDropped())
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerCredentialExpiry(t *testing.T) {
+	var lock sync.Mutex
+	var allocations []ServerAllocation
+	// The AuthHandler does not check expiries
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.CredentialExpiry = CredentialExpiryOf
+		config.StopAtCredentialExpiry = true
+		config.OnAllocationCreated = func(a ServerAllocation) {
+			lock.Lock()
+			defer lock.Unlock()
+			allocations = append(allocations, a)
+		}
+	})
+
+	allocate := func(username string) (net.PacketConn, time.Duration, error) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec
+
+		var lifetime time.Duration
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: serverAddr.String(),
+			Conn:           conn,
+			Username:       username,
+			Password:       "pass",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+			OnAllocationCreated: func(_ net.Addr, l time.Duration) {
+				lifetime = l
+			},
+		})
+		assert.NoError(t, err)
+		t.Cleanup(client.Close)
+		assert.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		return relayConn, lifetime, err
+	}
+
+	_, _, err := allocate(fmt.Sprintf("%d:alice", time.Now().Add(-time.Second).Unix()))
+	assert.Error(t, err, "expired credentials should be refused")
+
+	expiry := time.Unix(time.Now().Add(30*time.Second).Unix(), 0)
+	relayConn, lifetime, err := allocate(fmt.Sprintf("%d:bob", expiry.Unix()))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, lifetime, 30*time.Second, "the allocation should stop at the expiry")
+	assert.Greater(t, lifetime, 20*time.Second)
+
+	lock.Lock()
+	if assert.Len(t, allocations, 1) {
+		assert.Equal(t, expiry, allocations[0].CredentialExpiry())
+	}
+	lock.Unlock()
+
+	assert.NoError(t, relayConn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerNonceMaxUses(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.NonceMaxUses = 1
+	})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverAddr.String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	assert.NoError(t, err)
+
+	// The CreatePermission request has to get a new nonce
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	assert.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerNonceKey(t *testing.T) {
+	// Nonces of another server with the same key are accepted, e.g. after a restart
+	key := bytes.Repeat([]byte{1}, minNonceKeyLength)
+	other, err := server.NewNonceHashWithConfig(server.NonceHashConfig{Key: key})
+	assert.NoError(t, err)
+	nonce, err := other.Generate()
+	assert.NoError(t, err)
+
+	server, _ := newTestServer(t, func(config *ServerConfig) {
+		config.NonceKey = key
+	})
+	assert.NoError(t, server.nonceHash.Validate(nonce))
+	assert.NoError(t, server.Close())
+}
+
+func TestServerMemoryBudget(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.RelayQueueSize = 16
+		config.MemoryBudget = MemoryBudgetConfig{PerAllocation: 64 * 1024, Total: 1 << 20}
+	})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverAddr.String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+	relayConn, err := client.Allocate()
+	assert.NoError(t, err)
+
+	// Relayed packets pass through the budget and return their bytes once written
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	assert.NoError(t, err)
+	buf := make([]byte, 1500)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Eventually(t, func() bool {
+		return server.MemoryStats() == MemoryStats{Pressure: MemoryPressureNormal}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "shedding", MemoryPressureShedding.String())
+
+	assert.NoError(t, relayConn.Close())
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, peer.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerTimerResolution(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.TimerResolution = time.Second
+	})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverAddr.String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+	relayConn, err := client.Allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, server.AllocationCount())
+
+	// The Refresh with a lifetime of zero deletes the allocation
+	assert.NoError(t, relayConn.Close())
+	assert.Eventually(t, func() bool { return server.AllocationCount() == 0 }, time.Second, 10*time.Millisecond)
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerCacheSessionKeys(t *testing.T) {
+	var lookups atomic.Int32
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.AuthHandler = func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			lookups.Add(1)
+			return GenerateAuthKey(username, realm, "pass"), true
+		}
+		config.CacheSessionKeys = true
+	})
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverAddr.String(),
+		Conn:           conn,
+		Username:       "alice",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+	relayConn, err := client.Allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), lookups.Load())
+
+	// Every new peer creates a permission, only the first one asks the AuthHandler
+	createPermission := func(ip string) {
+		_, err := relayConn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.ParseIP(ip), Port: 5000})
+		assert.NoError(t, err)
+	}
+	createPermission("127.0.0.2")
+	createPermission("127.0.0.3")
+	createPermission("127.0.0.4")
+	assert.Equal(t, int32(2), lookups.Load())
+
+	assert.Equal(t, 0, server.RevokeSessionKeys("bob"))
+	assert.Equal(t, 1, server.RevokeSessionKeys("alice"))
+	createPermission("127.0.0.5")
+	createPermission("127.0.0.6")
+	assert.Equal(t, int32(3), lookups.Load())
+
+	assert.NoError(t, relayConn.Close())
+	assert.Eventually(t, func() bool { return server.AllocationCount() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), lookups.Load(), "the Refresh should use the cached key")
+
+	client.Close()
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestServerLogRateLimit(t *testing.T) {
+	var out bytes.Buffer
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.Writer = &out
+	loggerFactory.DefaultLogLevel = logging.LogLevelDebug
+
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.LoggerFactory = loggerFactory
+		config.LogRateLimit = 1
+	})
+
+	// Every Binding request logs several debug lines, of which one a second is written
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	request, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+	assert.NoError(t, err)
+	buf := make([]byte, 1500)
+	for i := 0; i < 10; i++ {
+		_, err = conn.WriteTo(request.Raw, serverAddr)
+		assert.NoError(t, err)
+		assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = conn.ReadFrom(buf)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+	assert.LessOrEqual(t, strings.Count(out.String(), "turn DEBUG:"), 2, "at most one line a second")
+}
+
+func TestServerPacketConnReaders(t *testing.T) {
+	server, serverAddr := newTestServer(t, func(config *ServerConfig) {
+		config.PacketConnReaders = 4
+	})
+
+	// Clients allocating at once are served by all readers
+	const clients = 8
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close() //nolint:errcheck
+			client, err := NewClient(&ClientConfig{
+				TURNServerAddr: serverAddr.String(),
+				Conn:           conn,
+				Username:       "user",
+				Password:       "pass",
+				LoggerFactory:  logging.NewDefaultLoggerFactory(),
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer client.Close()
+			assert.NoError(t, client.Listen())
+			_, err = client.Allocate()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, clients, server.AllocationCount())
+
+	assert.NoError(t, server.Close())
+}
+
 func RunBenchmarkServer(b *testing.B, clientNum int) {
 	loggerFactory := logging.NewDefaultLoggerFactory()
 	credMap := map[string][]byte{
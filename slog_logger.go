@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build go1.21
+// +build go1.21
+
+package turn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pion/logging"
+)
+
+// LevelTrace is the slog level of the trace lines of a SlogLoggerFactory, below
+// slog.LevelDebug
+const LevelTrace = slog.LevelDebug - 4
+
+// SlogLoggerFactory is a logging.LoggerFactory of loggers writing to a slog.Logger,
+// with the scope of each logger as its "scope" attribute. The lines the server logs with
+// fields, such as the method, src, username and allocation of a request, keep them as
+// attributes, so they can be handled by a slog.JSONHandler or any other handler:
+//
+//	config.LoggerFactory = turn.NewSlogLoggerFactory(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+type SlogLoggerFactory struct {
+	logger *slog.Logger
+}
+
+// NewSlogLoggerFactory returns a SlogLoggerFactory writing to logger, slog.Default() if nil
+func NewSlogLoggerFactory(logger *slog.Logger) *SlogLoggerFactory {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLoggerFactory{logger: logger}
+}
+
+// NewLogger implements logging.LoggerFactory
+func (f *SlogLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return &slogLogger{logger: f.logger.With("scope", scope)}
+}
+
+// slogLogger is a logging.LeveledLogger writing to a slog.Logger. The formatted
+// lines are only formatted at the levels the handler of the logger handles.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func slogLevel(level logging.LogLevel) slog.Level {
+	switch level {
+	case logging.LogLevelError:
+		return slog.LevelError
+	case logging.LogLevelWarn:
+		return slog.LevelWarn
+	case logging.LogLevelInfo:
+		return slog.LevelInfo
+	case logging.LogLevelDebug:
+		return slog.LevelDebug
+	default:
+		return LevelTrace
+	}
+}
+
+func (l *slogLogger) log(level slog.Level, msg string) {
+	l.logger.Log(context.Background(), level, msg)
+}
+
+func (l *slogLogger) logf(level slog.Level, format string, args ...interface{}) {
+	if l.logger.Enabled(context.Background(), level) {
+		l.logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// Logw logs msg with the fields as attributes, see fastlog.FieldLogger. Values such
+// as addresses and STUN methods are logged as their String, not marshaled as is.
+func (l *slogLogger) Logw(level logging.LogLevel, msg string, keysAndValues ...interface{}) {
+	slevel := slogLevel(level)
+	if !l.logger.Enabled(context.Background(), slevel) {
+		return
+	}
+
+	for i := 1; i < len(keysAndValues); i += 2 {
+		switch value := keysAndValues[i].(type) {
+		case error, slog.LogValuer, slog.Value:
+		case fmt.Stringer:
+			keysAndValues[i] = value.String()
+		}
+	}
+	l.logger.Log(context.Background(), slevel, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Trace(msg string) { l.log(LevelTrace, msg) }
+func (l *slogLogger) Tracef(format string, args ...interface{}) {
+	l.logf(LevelTrace, format, args...)
+}
+
+func (l *slogLogger) Debug(msg string) { l.log(slog.LevelDebug, msg) }
+func (l *slogLogger) Debugf(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args...)
+}
+
+func (l *slogLogger) Info(msg string) { l.log(slog.LevelInfo, msg) }
+func (l *slogLogger) Infof(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args...)
+}
+
+func (l *slogLogger) Warn(msg string) { l.log(slog.LevelWarn, msg) }
+func (l *slogLogger) Warnf(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args...)
+}
+
+func (l *slogLogger) Error(msg string) { l.log(slog.LevelError, msg) }
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args...)
+}
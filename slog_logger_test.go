@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build go1.21 && !js
+// +build go1.21,!js
+
+package turn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pion/turn/v4/internal/fastlog"
+)
+
+// syncBuffer is a buffer written by the goroutines of a server
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// lines returns the JSON lines written
+func (b *syncBuffer) lines(t *testing.T) (lines []map[string]interface{}) {
+	t.Helper()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestSlogLoggerFactory(t *testing.T) {
+	out := &syncBuffer{}
+	factory := NewSlogLoggerFactory(slog.New(slog.NewJSONHandler(out, nil)))
+	log := factory.NewLogger("turn")
+
+	log.Debugf("not logged %d", 1)
+	log.Infof("formatted %d", 1)
+	fastlog.Warnw(log, "With fields", "src", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+		"method", stun.MethodAllocate, "err", errors.New("closed"), "bytes", 12) //nolint:goerr113
+
+	lines := out.lines(t)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "INFO", lines[0]["level"])
+	assert.Equal(t, "formatted 1", lines[0]["msg"])
+	assert.Equal(t, "turn", lines[0]["scope"])
+	assert.Equal(t, "WARN", lines[1]["level"])
+	assert.Equal(t, "With fields", lines[1]["msg"])
+	assert.Equal(t, "127.0.0.1:5000", lines[1]["src"])
+	assert.Equal(t, "Allocate", lines[1]["method"])
+	assert.Equal(t, "closed", lines[1]["err"])
+	assert.Equal(t, 12.0, lines[1]["bytes"])
+}
+
+func TestSlogLoggerFactoryServer(t *testing.T) {
+	out := &syncBuffer{}
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:         "pion.ly",
+		LoggerFactory: NewSlogLoggerFactory(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "wrong",
+		Realm:          "pion.ly",
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+	_, err = client.Allocate()
+	assert.Error(t, err)
+
+	var received, failed map[string]interface{}
+	for _, line := range out.lines(t) {
+		switch line["msg"] {
+		case "Received request":
+			received = line
+		case "Failed to handle datagram":
+			failed = line
+		}
+	}
+	require.NotNil(t, received)
+	assert.Equal(t, "DEBUG", received["level"])
+	assert.Equal(t, "Allocate", received["method"])
+	assert.Equal(t, conn.LocalAddr().String(), received["src"])
+
+	require.NotNil(t, failed, "the refused credentials should be logged")
+	assert.Equal(t, "ERROR", failed["level"])
+	assert.Equal(t, conn.LocalAddr().String(), failed["src"])
+	assert.Contains(t, failed["err"], "integrity check failed")
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// connServerName returns the TLS server name (SNI) the client of conn presented,
+// completing the handshake of a crypto/tls connection first. It is empty for
+// connections without one.
+func connServerName(conn net.Conn) (string, error) {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+		defer cancel()
+		if err := c.HandshakeContext(ctx); err != nil {
+			return "", err
+		}
+		return c.ConnectionState().ServerName, nil
+	case interface{ ServerName() string }:
+		return c.ServerName(), nil
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSignedCertificate returns a certificate for the DNS names, valid for an hour
+func selfSignedCertificate(t *testing.T, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServerRealmForServerName(t *testing.T) {
+	listener, err := tls.Listen("tcp4", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCertificate(t, "turn.customer.example", "turn.pion.ly")},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	realms := map[string]string{}
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			realms[username] = realm
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		ListenerConfigs: []ListenerConfig{
+			{
+				Listener: listener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+				RealmForServerName: func(serverName string) string {
+					if serverName == "turn.customer.example" {
+						return "customer.example"
+					}
+					return ""
+				},
+			},
+		},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	allocate := func(username, serverName string) {
+		conn, err := tls.Dial("tcp4", listener.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true, //nolint:gosec
+		})
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		client, err := NewClient(&ClientConfig{
+			TURNServerAddr: listener.Addr().String(),
+			Conn:           NewSTUNConn(conn),
+			Username:       username,
+			Password:       "pass",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		require.NoError(t, relayConn.Close())
+	}
+
+	allocate("alice", "turn.customer.example")
+	allocate("bob", "turn.pion.ly")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, map[string]string{
+		"alice": "customer.example",
+		"bob":   "pion.ly", // Unknown server names get the default realm
+	}, realms)
+}
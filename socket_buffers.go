@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+import "net"
+
+func setReadBuffer(conn *net.UDPConn, size int) error {
+	return conn.SetReadBuffer(size)
+}
+
+func setWriteBuffer(conn *net.UDPConn, size int) error {
+	return conn.SetWriteBuffer(size)
+}
+
+// socketStats is only supported on Linux
+func socketStats(net.PacketConn) (SocketStats, error) {
+	return SocketStats{}, errSocketStatsUnsupported
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// skMeminfoDrops is the index of the drop counter in the SO_MEMINFO array
+	// of the kernel, which has skMeminfoVars entries
+	skMeminfoDrops = 8
+	skMeminfoVars  = 9
+)
+
+// setReadBuffer sets SO_RCVBUFFORCE, which exceeds net.core.rmem_max, and falls
+// back to SO_RCVBUF without CAP_NET_ADMIN
+func setReadBuffer(conn *net.UDPConn, size int) error {
+	if err := controlUDPConn(conn, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, size)
+	}); !errors.Is(err, unix.EPERM) {
+		return err
+	}
+	return conn.SetReadBuffer(size)
+}
+
+// setWriteBuffer is setReadBuffer for SO_SNDBUF
+func setWriteBuffer(conn *net.UDPConn, size int) error {
+	if err := controlUDPConn(conn, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUFFORCE, size)
+	}); !errors.Is(err, unix.EPERM) {
+		return err
+	}
+	return conn.SetWriteBuffer(size)
+}
+
+// socketStats reads the buffer sizes and the drop counter of SO_MEMINFO, which the
+// kernel supports since 4.6
+func socketStats(conn net.PacketConn) (SocketStats, error) {
+	stats := SocketStats{LocalAddr: conn.LocalAddr()}
+	err := controlUDPConn(conn, func(fd int) (err error) {
+		if stats.ReadBuffer, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF); err != nil {
+			return err
+		}
+		if stats.WriteBuffer, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF); err != nil {
+			return err
+		}
+
+		var meminfo [skMeminfoVars]uint32
+		size := uint32(unsafe.Sizeof(meminfo))
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_MEMINFO,
+			uintptr(unsafe.Pointer(&meminfo)), uintptr(unsafe.Pointer(&size)), 0)
+		if errno != 0 {
+			return errno
+		}
+		stats.Drops = uint64(meminfo[skMeminfoDrops])
+		return nil
+	})
+	return stats, err
+}
+
+func controlUDPConn(conn net.PacketConn, f func(fd int) error) error {
+	if _, ok := conn.(*net.UDPConn); !ok {
+		return errSocketStatsUnsupported
+	}
+	raw, err := conn.(syscall.Conn).SyscallConn() //nolint:forcetypeassert
+	if err != nil {
+		return err
+	}
+
+	var opErr error
+	if err := raw.Control(func(fd uintptr) {
+		opErr = f(int(fd))
+	}); err != nil {
+		return err
+	}
+	return opErr
+}
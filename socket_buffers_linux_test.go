@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketBuffers(t *testing.T) {
+	_, err := NewServer(ServerConfig{SocketBuffers: SocketBufferConfig{ReadBuffer: -1}, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidSocketBufferConfig)
+	_, err = NewServer(ServerConfig{SocketBuffers: SocketBufferConfig{ReadBuffer: 2, MaxReadBuffer: 1}, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidSocketBufferConfig)
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	created := make(chan ServerAllocation, 1)
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:               "pion.ly",
+		LoggerFactory:       logging.NewDefaultLoggerFactory(),
+		SocketBuffers:       SocketBufferConfig{ReadBuffer: 96 * 1024, WriteBuffer: 80 * 1024},
+		OnAllocationCreated: func(a ServerAllocation) { created <- a },
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	stats := server.SocketStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, serverConn.LocalAddr(), stats[0].LocalAddr)
+	assert.GreaterOrEqual(t, stats[0].ReadBuffer, 96*1024)
+	assert.GreaterOrEqual(t, stats[0].WriteBuffer, 80*1024)
+
+	// Relay sockets get the same buffers
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	client, err := NewClient(&ClientConfig{
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	relayStats, err := (<-created).SocketStats()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, relayStats.ReadBuffer, 96*1024)
+	assert.GreaterOrEqual(t, relayStats.WriteBuffer, 80*1024)
+}
+
+func TestSocketTuner(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	require.NoError(t, setReadBuffer(conn, 4096))
+
+	config := SocketBufferConfig{ReadBuffer: 4096, MaxReadBuffer: 12 * 1024, AutotuneInterval: time.Hour}
+	tuner := newSocketTuner([]net.PacketConn{conn}, config, logging.NewDefaultLoggerFactory().NewLogger("turn"))
+	require.NotNil(t, tuner)
+	defer tuner.Close()
+
+	// Nothing reads the socket, so a burst overflows its read buffer
+	flood := func() {
+		sender, err := net.Dial("udp4", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer sender.Close() //nolint:errcheck
+		for i := 0; i < 64; i++ {
+			_, err = sender.Write(make([]byte, 1000))
+			require.NoError(t, err)
+		}
+	}
+
+	tuner.tune()
+	assert.Equal(t, 4096, tuner.readBuffers[0], "no drops, no growth")
+
+	flood()
+	tuner.tune()
+	assert.Equal(t, 8192, tuner.readBuffers[0])
+	stats, err := socketStats(conn)
+	require.NoError(t, err)
+	assert.Positive(t, stats.Drops)
+	assert.GreaterOrEqual(t, stats.ReadBuffer, 8192)
+
+	flood()
+	tuner.tune()
+	assert.Equal(t, 12*1024, tuner.readBuffers[0], "growth stops at MaxReadBuffer")
+}
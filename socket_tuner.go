@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+const defaultAutotuneInterval = 10 * time.Second
+
+// SocketStats are the kernel buffers of a UDP socket and the datagrams it dropped, see
+// Server.SocketStats
+type SocketStats struct {
+	LocalAddr net.Addr
+
+	// ReadBuffer and WriteBuffer are the SO_RCVBUF and SO_SNDBUF the kernel reports, which
+	// on Linux is twice the size that was set, for its bookkeeping
+	ReadBuffer  int
+	WriteBuffer int
+
+	// Drops is the number of datagrams the kernel dropped since the socket was created,
+	// mostly because its read buffer was full
+	Drops uint64
+}
+
+// setSocketBuffers applies the buffer sizes of config to conn. Conns other than
+// UDP sockets are left alone.
+func setSocketBuffers(conn net.PacketConn, config SocketBufferConfig) error {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	if config.ReadBuffer > 0 {
+		if err := setReadBuffer(udpConn, config.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if config.WriteBuffer > 0 {
+		if err := setWriteBuffer(udpConn, config.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// socketTuner grows the read buffers of UDP sockets that drop datagrams, see
+// SocketBufferConfig.MaxReadBuffer
+type socketTuner struct {
+	conns       []*net.UDPConn
+	readBuffers []int    // Last size set per conn, zero while it has the size of the system
+	drops       []uint64 // Drops per conn at the last check
+	max         int
+	log         logging.LeveledLogger
+
+	done chan struct{}
+}
+
+// newSocketTuner starts tuning the UDP sockets of conns, nil if there are none
+func newSocketTuner(conns []net.PacketConn, config SocketBufferConfig, log logging.LeveledLogger) *socketTuner {
+	t := &socketTuner{max: config.MaxReadBuffer, log: log, done: make(chan struct{})}
+	for _, conn := range conns {
+		udpConn, ok := conn.(*net.UDPConn)
+		if !ok {
+			continue
+		}
+		stats, err := socketStats(udpConn)
+		if err != nil {
+			continue
+		}
+		t.conns = append(t.conns, udpConn)
+		t.readBuffers = append(t.readBuffers, config.ReadBuffer)
+		t.drops = append(t.drops, stats.Drops)
+	}
+	if len(t.conns) == 0 {
+		return nil
+	}
+
+	interval := config.AutotuneInterval
+	if interval == 0 {
+		interval = defaultAutotuneInterval
+	}
+	go t.run(interval)
+	return t
+}
+
+func (t *socketTuner) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.tune()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// tune doubles the read buffers of the sockets that dropped datagrams since the
+// last check
+func (t *socketTuner) tune() {
+	for i, conn := range t.conns {
+		stats, err := socketStats(conn)
+		if err != nil {
+			continue
+		}
+		dropped := stats.Drops - t.drops[i]
+		t.drops[i] = stats.Drops
+		if dropped == 0 || t.readBuffers[i] >= t.max {
+			continue
+		}
+
+		size := 2 * t.readBuffers[i]
+		if size == 0 {
+			size = stats.ReadBuffer // Half of it is the payload, see SocketStats
+		}
+		if size > t.max {
+			size = t.max
+		}
+		if err := setReadBuffer(conn, size); err != nil {
+			t.log.Warnf("Failed to grow the read buffer of %s: %s", conn.LocalAddr(), err)
+			continue
+		}
+		t.readBuffers[i] = size
+		t.log.Infof("Grew the read buffer of %s to %d bytes after %d dropped datagrams", conn.LocalAddr(), size, dropped)
+	}
+}
+
+func (t *socketTuner) Close() {
+	close(t.done)
+}
@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+const (
+	defaultSQLTimeout = 2 * time.Second
+	md5KeySize        = 16
+)
+
+// SQLCredentialFormat is how an SQLCredentialStore stores the credentials of users
+type SQLCredentialFormat int
+
+const (
+	// SQLCredentialPassword is the cleartext TURN password of a user
+	SQLCredentialPassword SQLCredentialFormat = iota
+	// SQLCredentialKey is the key of GenerateAuthKey, MD5(username:realm:password),
+	// as 16 bytes or hex encoded. The password itself is not stored, but only works
+	// for the realm the key was generated for.
+	SQLCredentialKey
+)
+
+// SQLCredentialStoreConfig configures an SQLCredentialStore
+type SQLCredentialStoreConfig struct {
+	// DB is the database with the credentials, with the driver of your choice
+	DB *sql.DB
+
+	// Query selects the credential of a user, with the username as its only
+	// argument in the placeholder syntax of the driver, e.g.
+	//
+	//	SELECT turn_key FROM users WHERE username = $1 AND active
+	//
+	// A user without a row is rejected. Only the first column of the first row is read.
+	Query string
+
+	// RealmArgument passes the realm as the second argument of the Query, so the same
+	// username can have other credentials in another realm, e.g.
+	//
+	//	SELECT turn_key FROM users WHERE username = $1 AND realm = $2
+	RealmArgument bool
+
+	// Format of the credential the query selects
+	Format SQLCredentialFormat
+
+	// Timeout bounds every query. Defaults to 2 seconds.
+	Timeout time.Duration
+
+	// CacheTTL is how long a key is cached. Defaults to a minute; a negative value
+	// disables the cache.
+	CacheTTL time.Duration
+
+	// Metrics receives the counters of the store, to export them. Optional.
+	Metrics SQLCredentialStoreMetrics
+
+	Log logging.LeveledLogger
+}
+
+// SQLCredentialStoreMetrics receives the counters of an SQLCredentialStore. Its
+// methods are called concurrently by the server and must not block.
+type SQLCredentialStoreMetrics interface {
+	// CacheHit is called for every key answered from the cache
+	CacheHit()
+	// Query is called for every query with its duration, whether it found a
+	// credential, and the error it failed with, if any
+	Query(duration time.Duration, found bool, err error)
+}
+
+type nopSQLCredentialStoreMetrics struct{}
+
+func (nopSQLCredentialStoreMetrics) CacheHit()                        {}
+func (nopSQLCredentialStoreMetrics) Query(time.Duration, bool, error) {}
+
+// SQLCredentialStore looks the credentials of users up in an SQL database,
+// see AuthHandler
+type SQLCredentialStore struct {
+	stmt     *sql.Stmt
+	realmArg bool
+	format   SQLCredentialFormat
+	timeout  time.Duration
+	cacheTTL time.Duration
+	metrics  SQLCredentialStoreMetrics
+	log      logging.LeveledLogger
+	cache    *authKeyCache
+}
+
+// NewSQLCredentialStore prepares the query and returns an SQLCredentialStore.
+// Close it once the server is closed.
+//
+// The server only checks the MD5 based MESSAGE-INTEGRITY of requests, so keys
+// for MESSAGE-INTEGRITY-SHA256 can not be used.
+func NewSQLCredentialStore(config SQLCredentialStoreConfig) (*SQLCredentialStore, error) {
+	if config.DB == nil || config.Query == "" {
+		return nil, errInvalidSQLStoreConfig
+	}
+	if config.Format != SQLCredentialPassword && config.Format != SQLCredentialKey {
+		return nil, errInvalidSQLStoreConfig
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultSQLTimeout
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultAuthCacheTTL
+	}
+	if config.Metrics == nil {
+		config.Metrics = nopSQLCredentialStoreMetrics{}
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	stmt, err := config.DB.PrepareContext(ctx, config.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLCredentialStore{
+		stmt:     stmt,
+		realmArg: config.RealmArgument,
+		format:   config.Format,
+		timeout:  config.Timeout,
+		cacheTTL: config.CacheTTL,
+		metrics:  config.Metrics,
+		log:      config.Log,
+		cache:    newAuthKeyCache(),
+	}, nil
+}
+
+// AuthHandler returns a turn.AuthHandler looking the users up in the store
+func (s *SQLCredentialStore) AuthHandler() AuthHandler {
+	return s.authenticate
+}
+
+// Close closes the prepared query. The DB is left open.
+func (s *SQLCredentialStore) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *SQLCredentialStore) authenticate(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	s.log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	if key, ok := s.cache.get(username, realm); ok {
+		s.metrics.CacheHit()
+		return key, true
+	}
+
+	credential, err := s.query(username, realm)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.log.Debugf("No credential for %q", username)
+		return nil, false
+	} else if err != nil {
+		s.log.Errorf("Credential query for %q failed: %s", username, err)
+		return nil, false
+	}
+
+	switch s.format {
+	case SQLCredentialPassword:
+		key = GenerateAuthKey(username, realm, string(credential))
+	case SQLCredentialKey:
+		if key = credential; len(key) != md5KeySize {
+			if key, err = hex.DecodeString(string(credential)); err != nil || len(key) != md5KeySize {
+				s.log.Errorf("Invalid key for %q", username)
+				return nil, false
+			}
+		}
+	}
+
+	s.cache.put(username, realm, key, s.cacheTTL)
+	return key, true
+}
+
+func (s *SQLCredentialStore) query(username, realm string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	args := []interface{}{username}
+	if s.realmArg {
+		args = append(args, realm)
+	}
+	start := time.Now()
+	var credential sql.NullString
+	err := s.stmt.QueryRowContext(ctx, args...).Scan(&credential)
+	if err == nil && !credential.Valid {
+		err = sql.ErrNoRows // NULL is no credential
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.metrics.Query(time.Since(start), false, nil)
+	case err != nil:
+		s.metrics.Query(time.Since(start), false, err)
+	default:
+		s.metrics.Query(time.Since(start), true, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(credential.String), nil
+}
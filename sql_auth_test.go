@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errSQLDown = errors.New("database down")
+
+// fakeSQLDatabase is a database/sql driver answering every query from a map
+// of usernames, or realm/username with a realm argument, to credentials
+type fakeSQLDatabase struct {
+	mutex       sync.Mutex
+	credentials map[string]driver.Value
+	prepares    int
+	queries     int
+	down        bool
+}
+
+func (d *fakeSQLDatabase) Connect(context.Context) (driver.Conn, error) { return &fakeSQLConn{d}, nil }
+func (d *fakeSQLDatabase) Driver() driver.Driver                        { return nil }
+
+type fakeSQLConn struct{ db *fakeSQLDatabase }
+
+func (c *fakeSQLConn) Prepare(string) (driver.Stmt, error) {
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	c.db.prepares++
+	return &fakeSQLStmt{c.db}, nil
+}
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return nil, errSQLDown }
+
+type fakeSQLStmt struct{ db *fakeSQLDatabase }
+
+func (s *fakeSQLStmt) Close() error                               { return nil }
+func (s *fakeSQLStmt) NumInput() int                              { return -1 }
+func (s *fakeSQLStmt) Exec([]driver.Value) (driver.Result, error) { return nil, errSQLDown }
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	s.db.queries++
+	if s.db.down {
+		return nil, errSQLDown
+	}
+	rows := &fakeSQLRows{}
+	name := args[0].(string)
+	if len(args) > 1 {
+		name = realmScopedName(args[1].(string), name)
+	}
+	if credential, ok := s.db.credentials[name]; ok {
+		rows.values = []driver.Value{credential}
+	}
+	return rows, nil
+}
+
+type fakeSQLRows struct {
+	values []driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string { return []string{"credential"} }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+type countingSQLMetrics struct {
+	mutex                           sync.Mutex
+	cacheHits, found, missed, fails int
+}
+
+func (m *countingSQLMetrics) CacheHit() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cacheHits++
+}
+
+func (m *countingSQLMetrics) Query(_ time.Duration, found bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch {
+	case err != nil:
+		m.fails++
+	case found:
+		m.found++
+	default:
+		m.missed++
+	}
+}
+
+func TestSQLCredentialStore(t *testing.T) {
+	key := GenerateAuthKey("alice", "pion.ly", "pass")
+	database := &fakeSQLDatabase{credentials: map[string]driver.Value{
+		"alice":   "pass",
+		"bob":     nil,
+		"hex":     hex.EncodeToString(key),
+		"raw":     key,
+		"invalid": "not a key",
+
+		"pion.ly/alice":     "pass",
+		"example.com/alice": "other pass",
+	}}
+	db := sql.OpenDB(database)
+	defer db.Close() //nolint:errcheck
+
+	_, err := NewSQLCredentialStore(SQLCredentialStoreConfig{DB: db})
+	assert.ErrorIs(t, err, errInvalidSQLStoreConfig)
+	_, err = NewSQLCredentialStore(SQLCredentialStoreConfig{DB: db, Query: "SELECT", Format: 5})
+	assert.ErrorIs(t, err, errInvalidSQLStoreConfig)
+
+	t.Run("Password", func(t *testing.T) {
+		metrics := &countingSQLMetrics{}
+		store, err := NewSQLCredentialStore(SQLCredentialStoreConfig{
+			DB:      db,
+			Query:   "SELECT password FROM users WHERE username = $1",
+			Format:  SQLCredentialPassword,
+			Metrics: metrics,
+		})
+		require.NoError(t, err)
+		handler := store.AuthHandler()
+
+		for i := 0; i < 3; i++ {
+			actualKey, ok := handler("alice", "pion.ly", nil)
+			assert.True(t, ok)
+			assert.Equal(t, key, actualKey)
+		}
+		_, ok := handler("bob", "pion.ly", nil)
+		assert.False(t, ok, "a NULL credential should be rejected")
+		_, ok = handler("mallory", "pion.ly", nil)
+		assert.False(t, ok)
+
+		database.mutex.Lock()
+		database.down = true
+		database.mutex.Unlock()
+		_, ok = handler("carol", "pion.ly", nil)
+		assert.False(t, ok)
+		actualKey, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok, "cached keys should outlive the database")
+		assert.Equal(t, key, actualKey)
+		database.mutex.Lock()
+		database.down = false
+		database.mutex.Unlock()
+
+		assert.Equal(t, &countingSQLMetrics{cacheHits: 3, found: 1, missed: 2, fails: 1}, metrics)
+		assert.NoError(t, store.Close())
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		store, err := NewSQLCredentialStore(SQLCredentialStoreConfig{
+			DB:       db,
+			Query:    "SELECT turn_key FROM users WHERE username = $1",
+			Format:   SQLCredentialKey,
+			CacheTTL: -1,
+		})
+		require.NoError(t, err)
+		handler := store.AuthHandler()
+
+		database.mutex.Lock()
+		database.prepares, database.queries = 0, 0
+		database.mutex.Unlock()
+
+		for _, username := range []string{"hex", "raw"} {
+			actualKey, ok := handler(username, "pion.ly", nil)
+			assert.True(t, ok, username)
+			assert.Equal(t, key, actualKey, username)
+		}
+		_, ok := handler("invalid", "pion.ly", nil)
+		assert.False(t, ok)
+		_, ok = handler("hex", "pion.ly", nil)
+		assert.True(t, ok)
+
+		database.mutex.Lock()
+		assert.Equal(t, 4, database.queries, "the cache should be disabled")
+		assert.Equal(t, 0, database.prepares, "the query should stay prepared")
+		database.mutex.Unlock()
+		assert.NoError(t, store.Close())
+	})
+	t.Run("RealmArgument", func(t *testing.T) {
+		store, err := NewSQLCredentialStore(SQLCredentialStoreConfig{
+			DB:            db,
+			Query:         "SELECT password FROM users WHERE username = $1 AND realm = $2",
+			RealmArgument: true,
+		})
+		require.NoError(t, err)
+		handler := store.AuthHandler()
+
+		actualKey, ok := handler("alice", "pion.ly", nil)
+		assert.True(t, ok)
+		assert.Equal(t, key, actualKey)
+		actualKey, ok = handler("alice", "example.com", nil)
+		assert.True(t, ok)
+		assert.Equal(t, GenerateAuthKey("alice", "example.com", "other pass"), actualKey)
+		_, ok = handler("alice", "other.org", nil)
+		assert.False(t, ok)
+		assert.NoError(t, store.Close())
+	})
+}
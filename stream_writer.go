@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/bufpool"
+)
+
+// streamWriter writes the packets of a stream connection on a goroutine of its
+// own, see ServerConfig.StreamWriteQueueSize. Neither the reader of the
+// connection nor the relay of its allocation then wait for a slow client.
+type streamWriter struct {
+	net.PacketConn
+
+	packets chan *[]byte
+	pool    *bufpool.Pool
+	dropped *atomic.Uint64 // Shared by all connections of a server
+	log     logging.LeveledLogger
+
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newStreamWriter(conn net.PacketConn, size int, pool *bufpool.Pool, dropped *atomic.Uint64, log logging.LeveledLogger) *streamWriter {
+	w := &streamWriter{
+		PacketConn: conn,
+		packets:    make(chan *[]byte, size),
+		pool:       pool,
+		dropped:    dropped,
+		log:        log,
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// WriteTo queues a copy of p, or drops it if the queue is full. Reliable
+// transports are not retransmitted, but a client that fell a whole queue
+// behind would not be helped by waiting.
+func (w *streamWriter) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-w.closing:
+		return 0, &net.OpError{Op: "write", Net: w.LocalAddr().Network(), Addr: addr, Err: net.ErrClosed}
+	default:
+	}
+
+	b := w.pool.Copy(p)
+	select {
+	case w.packets <- b:
+	default:
+		w.pool.Put(b)
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+func (w *streamWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case b := <-w.packets:
+			_, err := w.PacketConn.WriteTo(*b, nil)
+			w.pool.Put(b)
+			if err != nil {
+				// The stream is broken, which ends the reader of the connection
+				w.log.Debugf("Failed to write to %s: %s", w.LocalAddr(), err)
+				_ = w.PacketConn.Close()
+				return
+			}
+		case <-w.closing:
+			return
+		}
+	}
+}
+
+// Close stops the writer and closes the connection. Packets still queued are
+// discarded.
+func (w *streamWriter) Close() (err error) {
+	w.closeOnce.Do(func() {
+		close(w.closing)
+		err = w.PacketConn.Close()
+		<-w.done
+		for {
+			select {
+			case b := <-w.packets:
+				w.pool.Put(b)
+			default:
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/internal/bufpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamWriter(t *testing.T) {
+	_, err := NewServer(ServerConfig{StreamWriteQueueSize: -1, PacketConnConfigs: []PacketConnConfig{{}}})
+	assert.ErrorIs(t, err, errInvalidStreamWriteQueueSize)
+
+	t.Run("slow client", func(t *testing.T) {
+		// Nobody reads the client side of the pipe, so the first write blocks
+		serverSide, clientSide := net.Pipe()
+		defer clientSide.Close() //nolint:errcheck
+		var dropped atomic.Uint64
+		w := newStreamWriter(NewSTUNConn(serverSide), 2, bufpool.New(64), &dropped, logging.NewDefaultLoggerFactory().NewLogger("turn"))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 10; i++ {
+				n, err := w.WriteTo([]byte("response"), nil)
+				assert.NoError(t, err)
+				assert.Equal(t, len("response"), n)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "a slow client should not block writes")
+		}
+		assert.GreaterOrEqual(t, dropped.Load(), uint64(7))
+
+		assert.NoError(t, w.Close())
+		_, err := w.WriteTo([]byte("response"), nil)
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("TCP", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		server, err := NewServer(ServerConfig{
+			AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateAuthKey(username, realm, "pass"), true
+			},
+			ListenerConfigs: []ListenerConfig{{
+				Listener: tcpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			}},
+			Realm:                "pion.ly",
+			LoggerFactory:        logging.NewDefaultLoggerFactory(),
+			StreamWriteQueueSize: 16,
+		})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		conn, err := net.Dial("tcp4", tcpListener.Addr().String())
+		require.NoError(t, err)
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: tcpListener.Addr().String(),
+			TURNServerAddr: tcpListener.Addr().String(),
+			Conn:           NewSTUNConn(conn),
+			Username:       "user",
+			Password:       "pass",
+			LoggerFactory:  logging.NewDefaultLoggerFactory(),
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+
+		// Responses and relayed packets are written by the writer of the connection
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer peer.Close() //nolint:errcheck
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+		buf := make([]byte, 1500)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		_, err = peer.WriteTo([]byte("world"), from)
+		require.NoError(t, err)
+
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "world", string(buf[:n]))
+		assert.Equal(t, uint64(0), server.StreamWritesDropped())
+	})
+}
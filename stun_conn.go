@@ -96,6 +96,23 @@ func (s *STUNConn) WriteTo(p []byte, _ net.Addr) (n int, err error) {
 	return s.nextConn.Write(p)
 }
 
+// WriteBuffersTo writes a packet gathered from bufs. Over TCP the buffers are written
+// with a single writev, else they are joined first so that packets written
+// concurrently don't interleave.
+func (s *STUNConn) WriteBuffersTo(bufs net.Buffers, _ net.Addr) (int, error) {
+	if _, ok := s.nextConn.(*net.TCPConn); ok {
+		n, err := bufs.WriteTo(s.nextConn)
+		return int(n), err
+	}
+
+	buf := getWriteBuffer()
+	defer putWriteBuffer(buf)
+	for _, b := range bufs {
+		*buf = append(*buf, b...)
+	}
+	return s.nextConn.Write(*buf)
+}
+
 // Close implements Close from net.PacketConn
 func (s *STUNConn) Close() error {
 	return s.nextConn.Close()
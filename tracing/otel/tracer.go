@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package otel traces the requests of a turn.Server with OpenTelemetry. It is a module
+// of its own, so only the servers tracing their requests require OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pion/turn/v4"
+)
+
+// instrumentationName names the tracer of the spans
+const instrumentationName = "github.com/pion/turn/v4/tracing/otel"
+
+// Attributes of the spans
+const (
+	MethodKey        = attribute.Key("turn.method")
+	TransactionIDKey = attribute.Key("turn.transaction_id")
+	UsernameKey      = attribute.Key("turn.username")
+	ResponseCodeKey  = attribute.Key("turn.response_code")
+	ClientAddressKey = attribute.Key("client.address")
+)
+
+// Tracer is a turn.RequestTracer starting a server span named "TURN <method>" for
+// every request, e.g. "TURN Allocate", with the method, transaction ID and client
+// address of the request, its username once read and the error code of its response,
+// zero for success responses:
+//
+//	config.RequestTracer = otel.NewTracer(nil)
+//
+// Spans of requests that failed to be handled or were answered with a 5xx error code
+// have the error status. Requests for a new nonce or credentials, answered with 401
+// (Unauthorized) or 438 (Stale Nonce), are expected and are not errors.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer with a tracer of provider, of the global provider if nil
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// StartRequest implements turn.RequestTracer
+func (t *Tracer) StartRequest(method string, transactionID [12]byte, srcAddr net.Addr) turn.RequestSpan {
+	_, span := t.tracer.Start(context.Background(), "TURN "+method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			MethodKey.String(method),
+			TransactionIDKey.String(hex.EncodeToString(transactionID[:])),
+			ClientAddressKey.String(srcAddr.String()),
+		))
+	return &requestSpan{span: span}
+}
+
+type requestSpan struct {
+	span trace.Span
+	code int
+}
+
+func (s *requestSpan) SetUsername(username string) {
+	s.span.SetAttributes(UsernameKey.String(username))
+}
+
+func (s *requestSpan) SetResponseCode(code int) {
+	s.code = code
+	s.span.SetAttributes(ResponseCodeKey.Int(code))
+}
+
+func (s *requestSpan) End(err error) {
+	switch {
+	case err != nil:
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	case s.code >= 500:
+		s.span.SetStatus(codes.Error, fmt.Sprintf("responded with %d", s.code))
+	}
+	s.span.End()
+}
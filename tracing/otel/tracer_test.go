@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package otel
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pion/turn/v4"
+)
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := turn.NewServer(turn.ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return turn.GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: serverConn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+		Realm:         "pion.ly",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+		RequestTracer: NewTracer(provider),
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	client, err := turn.NewClient(&turn.ClientConfig{
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Conn:           conn,
+		Username:       "user",
+		Password:       "pass",
+		Realm:          "pion.ly",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	require.NoError(t, relayConn.Close())
+
+	// The span of the Refresh ends once its response is sent
+	require.Eventually(t, func() bool { return len(recorder.Ended()) == 3 }, time.Second, time.Millisecond)
+	spans := recorder.Ended()
+
+	// Challenged for credentials
+	challenge := attributes(spans[0])
+	assert.Equal(t, "TURN Allocate", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, "Allocate", challenge[MethodKey].AsString())
+	assert.Equal(t, int64(401), challenge[ResponseCodeKey].AsInt64())
+	assert.Equal(t, conn.LocalAddr().String(), challenge[ClientAddressKey].AsString())
+	assert.Len(t, challenge[TransactionIDKey].AsString(), 24)
+	assert.NotContains(t, challenge, UsernameKey)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	allocate := attributes(spans[1])
+	assert.Equal(t, "TURN Allocate", spans[1].Name())
+	assert.Equal(t, "user", allocate[UsernameKey].AsString())
+	assert.Equal(t, int64(0), allocate[ResponseCodeKey].AsInt64())
+	assert.NotEqual(t, challenge[TransactionIDKey], allocate[TransactionIDKey])
+
+	refresh := attributes(spans[2])
+	assert.Equal(t, "TURN Refresh", spans[2].Name())
+	assert.Equal(t, "user", refresh[UsernameKey].AsString())
+	assert.Equal(t, int64(0), refresh[ResponseCodeKey].AsInt64())
+}
+
+func TestRequestSpanStatus(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	srcAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	unauthorized := tracer.StartRequest("Allocate", [12]byte{}, srcAddr)
+	unauthorized.SetResponseCode(401)
+	unauthorized.End(nil)
+
+	failed := tracer.StartRequest("Allocate", [12]byte{}, srcAddr)
+	failed.SetResponseCode(508)
+	failed.End(nil)
+
+	unhandled := tracer.StartRequest("Refresh", [12]byte{}, srcAddr)
+	unhandled.End(net.ErrClosed)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+	assert.Len(t, spans[2].Events(), 1, "the error should be recorded")
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+const (
+	defaultWebhookTimeout  = 5 * time.Second
+	maxWebhookResponseSize = 64 * 1024
+)
+
+// WebhookAuthConfig configures an AuthHandler that asks an HTTPS endpoint for the
+// key of a user, see NewWebhookAuthHandler
+type WebhookAuthConfig struct {
+	// URL is the HTTPS endpoint the requests are POSTed to
+	URL string
+
+	// Header is added to every request, e.g. to authenticate the TURN server
+	// against the endpoint
+	Header http.Header
+
+	// Client sends the requests. Defaults to an http.Client with a timeout of 5 seconds
+	Client *http.Client
+
+	// CacheTTL is how long a key is cached, unless the endpoint returns its own ttl.
+	// Defaults to a minute; a negative value disables the cache.
+	CacheTTL time.Duration
+
+	Log logging.LeveledLogger
+}
+
+// webhookAuthRequest is the JSON body POSTed to the endpoint
+type webhookAuthRequest struct {
+	Username string `json:"username"`
+	Realm    string `json:"realm"`
+	SrcAddr  string `json:"srcAddr"`
+}
+
+// webhookAuthResponse is the JSON body the endpoint answers an accepted user with
+type webhookAuthResponse struct {
+	Key string `json:"key"`           // Hex encoded, as returned by GenerateAuthKey
+	TTL *int   `json:"ttl,omitempty"` // Seconds the key may be cached for
+}
+
+// NewWebhookAuthHandler returns a turn.AuthHandler that POSTs the username, realm
+// and source address of every request as JSON to an HTTPS endpoint:
+//
+//	{"username": "user", "realm": "pion.ly", "srcAddr": "192.0.2.1:50000"}
+//
+// The endpoint accepts the user by answering 200 OK with the hex encoded key
+// (see GenerateAuthKey), and optionally how many seconds it may be cached for:
+//
+//	{"key": "6e6b1d...", "ttl": 300}
+//
+// Any other status rejects the user. Keys are cached per username and realm, so
+// the source address only reaches the endpoint on a cache miss. Rejections and
+// failed requests are never cached.
+func NewWebhookAuthHandler(config WebhookAuthConfig) (AuthHandler, error) {
+	endpoint, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, errWebhookNotHTTPS
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultAuthCacheTTL
+	}
+	if config.Log == nil {
+		config.Log = logging.NewDefaultLoggerFactory().NewLogger("turn")
+	}
+
+	handler := &webhookAuthHandler{
+		WebhookAuthConfig: config,
+		url:               endpoint.String(),
+		cache:             newAuthKeyCache(),
+	}
+	return handler.authenticate, nil
+}
+
+type webhookAuthHandler struct {
+	WebhookAuthConfig
+	url   string
+	cache *authKeyCache
+}
+
+func (h *webhookAuthHandler) authenticate(username, realm string, srcAddr net.Addr) (key []byte, ok bool) {
+	h.Log.Tracef("Authentication username=%q realm=%q srcAddr=%v", username, realm, srcAddr)
+
+	if key, ok := h.cache.get(username, realm); ok {
+		return key, true
+	}
+
+	key, ttl, err := h.fetch(username, realm, srcAddr)
+	if err != nil {
+		h.Log.Errorf("Webhook authentication of %q failed: %s", username, err)
+		return nil, false
+	}
+	if key == nil {
+		h.Log.Debugf("Webhook rejected %q", username)
+		return nil, false
+	}
+
+	h.cache.put(username, realm, key, ttl)
+	return key, true
+}
+
+func (h *webhookAuthHandler) fetch(username, realm string, srcAddr net.Addr) ([]byte, time.Duration, error) {
+	req := webhookAuthRequest{Username: username, Realm: realm}
+	if srcAddr != nil {
+		req.SrcAddr = srcAddr.String()
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(context.Background(), http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range h.Header {
+		httpReq.Header[name] = values
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := h.Client.Do(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer httpRes.Body.Close() //nolint:errcheck
+
+	if httpRes.StatusCode != http.StatusOK {
+		// Drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, io.LimitReader(httpRes.Body, maxWebhookResponseSize))
+		return nil, 0, nil
+	}
+
+	var res webhookAuthResponse
+	if err := json.NewDecoder(io.LimitReader(httpRes.Body, maxWebhookResponseSize)).Decode(&res); err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", errInvalidWebhookResponse, err) //nolint:errorlint
+	}
+	key, err := hex.DecodeString(res.Key)
+	if err != nil || len(key) == 0 {
+		return nil, 0, fmt.Errorf("%w: invalid key", errInvalidWebhookResponse)
+	}
+
+	ttl := h.CacheTTL
+	if res.TTL != nil {
+		ttl = time.Duration(*res.TTL) * time.Second
+	}
+	return key, ttl, nil
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebhookAuthHandler(t *testing.T) {
+	srcAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+
+	var requests atomic.Int32
+	endpoint := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req webhookAuthRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "pion.ly", req.Realm)
+		assert.Equal(t, srcAddr.String(), req.SrcAddr)
+
+		switch req.Username {
+		case "user", "uncached":
+			res := map[string]any{"key": hex.EncodeToString(GenerateAuthKey(req.Username, req.Realm, "pass"))}
+			if req.Username == "uncached" {
+				res["ttl"] = 0
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(res))
+		case "garbage":
+			_, _ = w.Write([]byte(`{"key": "not hex"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer endpoint.Close()
+
+	_, err := NewWebhookAuthHandler(WebhookAuthConfig{URL: "http://" + endpoint.Listener.Addr().String()})
+	assert.ErrorIs(t, err, errWebhookNotHTTPS)
+
+	handler, err := NewWebhookAuthHandler(WebhookAuthConfig{
+		URL:    endpoint.URL,
+		Client: endpoint.Client(),
+		Header: http.Header{"Authorization": []string{"Bearer secret"}},
+	})
+	require.NoError(t, err)
+
+	t.Run("Accepted", func(t *testing.T) {
+		requests.Store(0)
+		for i := 0; i < 3; i++ {
+			key, ok := handler("user", "pion.ly", srcAddr)
+			assert.True(t, ok)
+			assert.Equal(t, GenerateAuthKey("user", "pion.ly", "pass"), key)
+		}
+		assert.Equal(t, int32(1), requests.Load(), "the key should be cached")
+	})
+
+	t.Run("Uncached", func(t *testing.T) {
+		requests.Store(0)
+		for i := 0; i < 2; i++ {
+			_, ok := handler("uncached", "pion.ly", srcAddr)
+			assert.True(t, ok)
+		}
+		assert.Equal(t, int32(2), requests.Load(), "a ttl of 0 should disable the cache")
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		requests.Store(0)
+		for i := 0; i < 2; i++ {
+			key, ok := handler("stranger", "pion.ly", srcAddr)
+			assert.False(t, ok)
+			assert.Nil(t, key)
+		}
+		assert.Equal(t, int32(2), requests.Load(), "rejections should not be cached")
+	})
+
+	t.Run("InvalidResponse", func(t *testing.T) {
+		_, ok := handler("garbage", "pion.ly", srcAddr)
+		assert.False(t, ok)
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		unreachable, err := NewWebhookAuthHandler(WebhookAuthConfig{URL: endpoint.URL})
+		require.NoError(t, err)
+
+		// The default client does not trust the test certificate
+		_, ok := unreachable("user", "pion.ly", srcAddr)
+		assert.False(t, ok)
+	})
+}
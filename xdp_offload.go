@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+// XDPChannelOffloader is only supported on Linux
+type XDPChannelOffloader struct{}
+
+// NewXDPChannelOffloader fails on platforms other than Linux
+func NewXDPChannelOffloader(XDPChannelOffloaderConfig) (*XDPChannelOffloader, error) {
+	return nil, errXDPUnsupported
+}
+
+// Offload fails on platforms other than Linux
+func (o *XDPChannelOffloader) Offload(ChannelFlow) error {
+	return errXDPUnsupported
+}
+
+// Remove fails on platforms other than Linux
+func (o *XDPChannelOffloader) Remove(ChannelFlow) error {
+	return errXDPUnsupported
+}
+
+// Close does nothing on platforms other than Linux
+func (o *XDPChannelOffloader) Close() error {
+	return nil
+}
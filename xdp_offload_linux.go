@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+
+	"github.com/pion/turn/v4/internal/xdp"
+)
+
+// XDPChannelOffloader is a ChannelOffloader for the XDP program of
+// examples/turn-server/xdp, which rewrites ChannelData to UDP datagrams and back and
+// transmits them from the driver. The program is loaded and attached by the operator, the
+// offloader only manages its maps.
+//
+// The program forwards IPv4 only and sends packets back out of the interface they arrived
+// on, so listeners must be bound to the address clients send to, and the relay addresses
+// must be owned by the host. Closing the server removes its flows, flows of a server that
+// crashed stay in the maps until the program is loaded again.
+type XDPChannelOffloader struct {
+	channels *xdp.Map
+	peers    *xdp.Map
+}
+
+// NewXDPChannelOffloader opens the maps pinned by the XDP program. It requires
+// CAP_BPF or root.
+func NewXDPChannelOffloader(config XDPChannelOffloaderConfig) (*XDPChannelOffloader, error) {
+	if config.PinPath == "" {
+		return nil, errInvalidXDPConfig
+	}
+
+	channels, err := xdp.OpenPinnedMap(filepath.Join(config.PinPath, xdp.ChannelsMap), xdp.ClientSideSize, xdp.PeerSideSize)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := xdp.OpenPinnedMap(filepath.Join(config.PinPath, xdp.PeersMap), xdp.PeerSideSize, xdp.ClientSideSize)
+	if err != nil {
+		_ = channels.Close()
+		return nil, err
+	}
+	return &XDPChannelOffloader{channels: channels, peers: peers}, nil
+}
+
+// Offload adds the flow to the maps of the program
+func (o *XDPChannelOffloader) Offload(flow ChannelFlow) error {
+	clientSide, peerSide, err := xdpChannel(flow)
+	if err != nil {
+		return err
+	}
+
+	if err := o.peers.Update(peerSide, clientSide); err != nil {
+		return err
+	}
+	if err := o.channels.Update(clientSide, peerSide); err != nil {
+		return errors.Join(err, o.peers.Delete(peerSide))
+	}
+	return nil
+}
+
+// Remove deletes the flow from the maps of the program
+func (o *XDPChannelOffloader) Remove(flow ChannelFlow) error {
+	clientSide, peerSide, err := xdpChannel(flow)
+	if err != nil {
+		return err
+	}
+	return errors.Join(o.channels.Delete(clientSide), o.peers.Delete(peerSide))
+}
+
+// Close closes the maps, which keep their flows
+func (o *XDPChannelOffloader) Close() error {
+	return errors.Join(o.channels.Close(), o.peers.Close())
+}
+
+// xdpChannel returns the map entries of both directions of the flow
+func xdpChannel(flow ChannelFlow) (clientSide, peerSide []byte, err error) {
+	udpAddr := func(addr net.Addr) *net.UDPAddr {
+		a, _ := addr.(*net.UDPAddr)
+		return a
+	}
+
+	if clientSide, err = (xdp.ClientSide{
+		Client: udpAddr(flow.ClientAddr),
+		Server: udpAddr(flow.ServerAddr),
+		Number: flow.Number,
+	}).MarshalBinary(); err != nil {
+		return nil, nil, err
+	}
+	if peerSide, err = (xdp.PeerSide{
+		Peer:  udpAddr(flow.PeerAddr),
+		Relay: udpAddr(flow.RelayAddr),
+	}).MarshalBinary(); err != nil {
+		return nil, nil, err
+	}
+	return clientSide, peerSide, nil
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXDPChannelOffloader(t *testing.T) {
+	_, err := NewXDPChannelOffloader(XDPChannelOffloaderConfig{})
+	assert.ErrorIs(t, err, errInvalidXDPConfig)
+	_, err = NewXDPChannelOffloader(XDPChannelOffloaderConfig{PinPath: t.TempDir()})
+	assert.Error(t, err, "the maps should not be pinned")
+
+	flow := ChannelFlow{
+		ClientAddr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 50000},
+		ServerAddr: &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478},
+		RelayAddr:  &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 49152},
+		PeerAddr:   &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 6000},
+		Number:     0x4001,
+	}
+	clientSide, peerSide, err := xdpChannel(flow)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xc3, 0x50, 0x0d, 0x96, 0x40, 0x01, 0, 0}, clientSide)
+	assert.Equal(t, []byte{203, 0, 113, 7, 198, 51, 100, 1, 0x17, 0x70, 0xc0, 0x00}, peerSide)
+
+	// A listener on all interfaces does not tell the program which address to answer from
+	flow.ServerAddr = &net.UDPAddr{IP: net.IPv4zero, Port: 3478}
+	_, _, err = xdpChannel(flow)
+	assert.Error(t, err)
+	flow.ServerAddr = &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478}
+	_, _, err = xdpChannel(flow)
+	assert.Error(t, err)
+}